@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/christopherwong-hinge/auction/tokens"
+)
+
+func newBalanceCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "balance",
+		Short: "Read team balances",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "get TEAM...",
+		Short: "Print the balance and reputation of teams",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			balances, err := c.tm.GetTokenBalances(cmd.Context(), args)
+			if err != nil {
+				return err
+			}
+
+			// in the order asked for, which the map loses
+			resp := make([]tokens.TeamBalance, 0, len(args))
+			for _, teamID := range args {
+				if b, ok := balances[teamID]; ok {
+					resp = append(resp, b)
+				}
+			}
+			return printJSON(cmd, resp)
+		},
+	})
+	return cmd
+}
+
+func newTokensCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tokens",
+		Short: "Change team balances",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "refill TEAM...",
+		Short: "Reset teams' balances and reputations to their initial values",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.tm.RefillTokens(cmd.Context(), args)
+		},
+	})
+
+	var reason, actor string
+	grant := &cobra.Command{
+		Use:   "grant TEAM AMOUNT",
+		Short: "Grant tokens to a team, recording who did it and why",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			amount, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil || amount <= 0 {
+				return fmt.Errorf("amount must be a positive integer, got %q", args[1])
+			}
+
+			adjustment, err := c.tm.AdjustBalance(cmd.Context(), args[0], amount, reason, actor)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, adjustment)
+		},
+	}
+	grant.Flags().StringVar(&reason, "reason", "", "why the tokens are granted (required)")
+	grant.Flags().StringVar(&actor, "actor", os.Getenv("USER"), "who is granting the tokens")
+	grant.MarkFlagRequired("reason")
+	cmd.AddCommand(grant)
+
+	return cmd
+}
+
+func newBidsCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bids",
+		Short: "Read recorded bids",
+	}
+
+	var limit int
+	list := &cobra.Command{
+		Use:   "list TEAM",
+		Short: "Print a team's bids, oldest first, or its newest with --limit",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var (
+				rows []tokens.BidRow
+				err  error
+			)
+			switch {
+			case limit < 0:
+				return fmt.Errorf("limit must not be negative, got %d", limit)
+			case limit > 0:
+				rows, err = c.tm.GetRecentBids(cmd.Context(), args[0], limit)
+			default:
+				rows, err = c.tm.GetBids(cmd.Context(), args[0])
+			}
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, rows)
+		},
+	}
+	list.Flags().IntVar(&limit, "limit", 0, "print only the newest n bids")
+	cmd.AddCommand(list)
+
+	return cmd
+}
+
+func newAuctionCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "auction",
+		Short: "Run auctions",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "run USER TEAM:PRIORITY[:CURRENCY]...",
+		Short: "Run an auction for a user over the given bids and print its result",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bids := make([]tokens.Bid, 0, len(args)-1)
+			for _, arg := range args[1:] {
+				bid, err := parseBid(args[0], arg)
+				if err != nil {
+					return err
+				}
+				bids = append(bids, bid)
+			}
+
+			result, err := c.tm.RunAuction(cmd.Context(), bids)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, result)
+		},
+	})
+	return cmd
+}
+
+// parseBid parses a TEAM:PRIORITY[:CURRENCY] argument into a bid on userID.
+func parseBid(userID, arg string) (tokens.Bid, error) {
+	parts := strings.Split(arg, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return tokens.Bid{}, fmt.Errorf("bid %q must be TEAM:PRIORITY[:CURRENCY]", arg)
+	}
+	priority, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return tokens.Bid{}, fmt.Errorf("bid %q has an invalid priority: %v", arg, err)
+	}
+
+	bid := tokens.Bid{TeamID: parts[0], UserID: userID, Priority: priority}
+	if len(parts) == 3 {
+		bid.Currency = parts[2]
+	}
+	return bid, nil
+}
+
+func newTeamCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "team",
+		Short: "Manage teams",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "init TEAM...",
+		Short: "Create teams with the initial balance, backfilling any that exist",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.tm.InitializeTokens(cmd.Context(), args)
+		},
+	})
+
+	var name string
+	create := &cobra.Command{
+		Use:   "create TEAM",
+		Short: "Onboard a team with the initial balance, failing if it exists",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			team, err := c.tm.CreateTeam(cmd.Context(), args[0], name)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, team)
+		},
+	}
+	create.Flags().StringVar(&name, "name", "", "the team's display name")
+	cmd.AddCommand(create)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "get TEAM",
+		Short: "Print a team's status",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			team, err := c.tm.GetTeam(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, team)
+		},
+	})
+
+	var status string
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "Print every team, or those with --status",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			teams, err := c.tm.ListTeams(cmd.Context(), tokens.TeamStatus(status))
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, teams)
+		},
+	}
+	list.Flags().StringVar(&status, "status", "", "active, suspended or archived")
+	cmd.AddCommand(list)
+
+	var reason string
+	suspend := &cobra.Command{
+		Use:   "suspend TEAM",
+		Short: "Stop a team from bidding, keeping its balance and history",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			team, err := c.tm.SuspendTeam(cmd.Context(), args[0], reason)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, team)
+		},
+	}
+	suspend.Flags().StringVar(&reason, "reason", "", "why the team is suspended (required)")
+	suspend.MarkFlagRequired("reason")
+	cmd.AddCommand(suspend)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "reinstate TEAM",
+		Short: "Let a suspended team bid again",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			team, err := c.tm.ReinstateTeam(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, team)
+		},
+	})
+
+	archive := &cobra.Command{
+		Use:   "archive TEAM",
+		Short: "Tombstone a team, keeping it on record",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			team, err := c.tm.ArchiveTeam(cmd.Context(), args[0], reason)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, team)
+		},
+	}
+	archive.Flags().StringVar(&reason, "reason", "", "why the team is archived (required)")
+	archive.MarkFlagRequired("reason")
+	cmd.AddCommand(archive)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "delete TEAM",
+		Short: "Delete a team for good, keeping its bids and ledger",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return c.tm.DeleteTeam(cmd.Context(), args[0])
+		},
+	})
+	return cmd
+}
@@ -0,0 +1,98 @@
+// Command auctionctl runs operator tasks, such as refilling or granting
+// tokens, against the same tables and config as auctiond.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/christopherwong-hinge/auction/tokens"
+)
+
+// cli holds what every subcommand shares: the flags on the root command and
+// the Manager they configure, opened before a subcommand runs.
+type cli struct {
+	configPath string
+	logger     *zap.Logger
+	tm         *tokens.Manager
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := newRootCmd().ExecuteContext(ctx); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	c := &cli{}
+	root := &cobra.Command{
+		Use:   "auctionctl",
+		Short: "Operate the token auction",
+		Long: "auctionctl reads and changes team balances, bids and auctions directly in the\n" +
+			"auction's DynamoDB tables, using the same config as auctiond.",
+		SilenceUsage:      true,
+		PersistentPreRunE: c.open,
+		PersistentPostRun: c.close,
+	}
+	root.PersistentFlags().StringVar(&c.configPath, "config", "", "JSON config file; AUCTION_* environment variables override it")
+
+	root.AddCommand(
+		newBalanceCmd(c),
+		newTokensCmd(c),
+		newBidsCmd(c),
+		newAuctionCmd(c),
+		newTeamCmd(c),
+	)
+	return root
+}
+
+// open creates the Manager for a subcommand. Like auctiond it never creates
+// tables; run auctiond migrate for that.
+func (c *cli) open(cmd *cobra.Command, args []string) error {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		return err
+	}
+	c.logger = logger
+
+	cfg, err := tokens.LoadConfig(c.configPath)
+	if err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+	cfg.Logger = logger
+	cfg.SkipTableCreation = true
+
+	c.tm, err = tokens.NewManagerFromConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("error creating token manager: %v", err)
+	}
+	return nil
+}
+
+func (c *cli) close(cmd *cobra.Command, args []string) {
+	if c.tm != nil {
+		if err := c.tm.Close(); err != nil {
+			c.logger.Error("Failed to close token manager", zap.Error(err))
+		}
+	}
+	if c.logger != nil {
+		c.logger.Sync()
+	}
+}
+
+// printJSON writes v to the command's output as indented JSON.
+func printJSON(cmd *cobra.Command, v any) error {
+	enc := json.NewEncoder(cmd.OutOrStdout())
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
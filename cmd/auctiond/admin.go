@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	auctionv1 "github.com/christopherwong-hinge/auction/api/auction/v1"
+)
+
+// adminRPCs are the gRPC methods that need an admin token, like the HTTP
+// API's admin routes.
+var adminRPCs = map[string]bool{
+	auctionv1.AuctionService_RefillTokens_FullMethodName: true,
+}
+
+// adminTokens are the operators allowed to use the admin routes, by their
+// bearer tokens.
+type adminTokens map[string]string
+
+// loadAdminTokens reads the operators' tokens from path, one "actor token"
+// pair per line. Blank lines and lines starting with # are skipped.
+func loadAdminTokens(path string) (adminTokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := make(adminTokens)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want an actor and a token", path, line)
+		}
+		tokens[fields[1]] = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// actor returns the operator whose token was presented. Every token is
+// compared in constant time, so timing doesn't tell how much of one matched.
+func (t adminTokens) actor(presented string) (string, bool) {
+	var actor string
+	for token, name := range t {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(presented)) == 1 {
+			actor = name
+		}
+	}
+	return actor, actor != ""
+}
+
+// authenticate is a tokens.AdminAuthenticator for requests with an
+// "Authorization: Bearer <token>" header.
+func (t adminTokens) authenticate(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	return t.actor(token)
+}
+
+// unaryInterceptor refuses calls to adminRPCs without an admin token in
+// their "authorization" metadata, as "Bearer <token>".
+func (t adminTokens) unaryInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	if !adminRPCs[info.FullMethod] {
+		return handler(ctx, req)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(value, "Bearer ")
+		if !ok {
+			continue
+		}
+		if _, ok := t.actor(token); ok {
+			return handler(ctx, req)
+		}
+	}
+	return nil, status.Error(codes.Unauthenticated, "admin authentication required")
+}
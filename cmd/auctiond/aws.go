@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+
+	"github.com/christopherwong-hinge/auction/tokens"
+)
+
+// loadAWSConfig returns the config of auctiond's SNS, SQS, Kinesis and S3
+// clients: the SDK's default config, from the environment and shared config
+// files, or with cfg.LocalStack, like the Manager's DynamoDB client, one for
+// cfg.Endpoint or tokens.DefaultEndpoint with LocalStack's static
+// credentials.
+func loadAWSConfig(ctx context.Context, cfg tokens.Config) (aws.Config, error) {
+	awsCfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if cfg.LocalStack {
+		endpoint := cfg.Endpoint
+		if endpoint == "" {
+			endpoint = tokens.DefaultEndpoint
+		}
+		awsCfg.BaseEndpoint = aws.String(endpoint)
+		awsCfg.Credentials = credentials.NewStaticCredentialsProvider("test", "test", "")
+	}
+	return awsCfg, nil
+}
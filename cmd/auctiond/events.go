@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/segmentio/kafka-go"
+
+	"github.com/christopherwong-hinge/auction/events"
+)
+
+// eventFlags choose where auctiond publishes events; at most one may be set.
+type eventFlags struct {
+	snsTopic     string
+	sqsQueue     string
+	kafkaBrokers string
+	kafkaTopic   string
+}
+
+// publisher returns the Publisher the flags choose, or nil for none, and a
+// func to close it once the Manager is closed. The SNS and SQS clients are
+// built from awsCfg.
+func (f eventFlags) publisher(awsCfg aws.Config) (events.Publisher, func() error, error) {
+	set := 0
+	for _, v := range []string{f.snsTopic, f.sqsQueue, f.kafkaBrokers} {
+		if v != "" {
+			set++
+		}
+	}
+	switch {
+	case set == 0:
+		return nil, nil, nil
+	case set > 1:
+		return nil, nil, errors.New("only one of -events-sns-topic, -events-sqs-queue and -events-kafka-brokers may be set")
+	case f.kafkaBrokers != "":
+		if f.kafkaTopic == "" {
+			return nil, nil, errors.New("-events-kafka-topic is required with -events-kafka-brokers")
+		}
+		w := newKafkaWriter(f.kafkaBrokers, f.kafkaTopic)
+		return events.NewKafkaPublisher(w), w.Close, nil
+	}
+
+	if f.snsTopic != "" {
+		return events.NewSNSPublisher(sns.NewFromConfig(awsCfg), f.snsTopic), noClose, nil
+	}
+	return events.NewSQSPublisher(sqs.NewFromConfig(awsCfg), f.sqsQueue), noClose, nil
+}
+
+// settlementFlags choose where auctiond publishes an AuctionSettled for each
+// settled auction; at most one may be set.
+type settlementFlags struct {
+	kinesisStream string
+	kafkaBrokers  string
+	kafkaTopic    string
+}
+
+// publisher returns the Publisher the flags choose, or nil for none, and a
+// func to close it, like eventFlags.publisher.
+func (f settlementFlags) publisher(awsCfg aws.Config) (events.Publisher, func() error, error) {
+	switch {
+	case f.kinesisStream != "" && f.kafkaBrokers != "":
+		return nil, nil, errors.New("only one of -settlement-kinesis-stream and -settlement-kafka-brokers may be set")
+	case f.kafkaBrokers != "":
+		if f.kafkaTopic == "" {
+			return nil, nil, errors.New("-settlement-kafka-topic is required with -settlement-kafka-brokers")
+		}
+		w := newKafkaWriter(f.kafkaBrokers, f.kafkaTopic)
+		return events.NewKafkaPublisher(w), w.Close, nil
+	case f.kinesisStream != "":
+		return events.NewKinesisPublisher(kinesis.NewFromConfig(awsCfg), f.kinesisStream), noClose, nil
+	default:
+		return nil, nil, nil
+	}
+}
+
+// newKafkaWriter returns a writer to topic on the comma-separated brokers,
+// hashing keys to partitions.
+func newKafkaWriter(brokers, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:     kafka.TCP(strings.Split(brokers, ",")...),
+		Topic:    topic,
+		Balancer: &kafka.Hash{},
+	}
+}
+
+func noClose() error {
+	return nil
+}
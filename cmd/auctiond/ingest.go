@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.uber.org/zap"
+
+	"github.com/christopherwong-hinge/auction/tokens"
+)
+
+const (
+	// ingestWaitSeconds is how long each receive long-polls for messages.
+	ingestWaitSeconds = 20
+	// ingestBatchSize is the most messages a receive returns, SQS's limit.
+	ingestBatchSize = 10
+	// ingestRetryDelay is how long a poller waits after a failed receive.
+	ingestRetryDelay = time.Second
+)
+
+// queuedBid is the body of a bid submission on the ingestion queue: a sealed
+// bid for an open auction window.
+type queuedBid struct {
+	AuctionID string `json:"auction_id"`
+	TeamID    string `json:"team_id"`
+	Priority  int64  `json:"priority"`
+}
+
+// sqsAPI is the subset of *sqs.Client the ingester uses.
+type sqsAPI interface {
+	ReceiveMessage(ctx context.Context, in *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, in *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	SendMessage(ctx context.Context, in *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// bidIngester polls an SQS queue of bid submissions and records each as a
+// sealed bid. A message is deleted once its bid is recorded. One that can
+// never be recorded, because it is malformed or the Manager rejects the bid,
+// is sent to the dead-letter queue if there is one and deleted; without one
+// it is left for the queue's redrive policy. Any other failure leaves the
+// message to be received again after its visibility timeout.
+type bidIngester struct {
+	client     sqsAPI
+	queue      string
+	deadLetter string
+	tm         *tokens.Manager
+	logger     *zap.Logger
+}
+
+// run polls the queue with workers concurrent pollers until ctx is done.
+func (in *bidIngester) run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			in.poll(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (in *bidIngester) poll(ctx context.Context) {
+	for ctx.Err() == nil {
+		out, err := in.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(in.queue),
+			MaxNumberOfMessages: ingestBatchSize,
+			WaitTimeSeconds:     ingestWaitSeconds,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			in.logger.Error("Failed to receive bid submissions", zap.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(ingestRetryDelay):
+			}
+			continue
+		}
+		for _, msg := range out.Messages {
+			in.handle(ctx, msg)
+		}
+	}
+}
+
+// handle records the bid msg carries and acks or dead-letters it.
+func (in *bidIngester) handle(ctx context.Context, msg types.Message) {
+	logger := in.logger.With(zap.String("messageID", aws.ToString(msg.MessageId)))
+
+	bid, err := decodeQueuedBid(aws.ToString(msg.Body))
+	if err == nil {
+		var row *tokens.BidRow
+		row, err = in.tm.SubmitSealedBid(ctx, bid.AuctionID, bid.TeamID, bid.Priority)
+		if err == nil {
+			logger.Info("Ingested bid",
+				zap.String("auctionID", bid.AuctionID),
+				zap.String("bidID", row.BidID))
+			in.delete(ctx, msg, logger)
+			return
+		}
+	}
+
+	if !rejected(err) {
+		logger.Warn("Failed to ingest bid, leaving it for redelivery", zap.Error(err))
+		return
+	}
+	if in.deadLetter == "" {
+		logger.Error("Rejected bid submission", zap.Error(err))
+		return
+	}
+	_, sendErr := in.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(in.deadLetter),
+		MessageBody: msg.Body,
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"error": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(err.Error()),
+			},
+			"source_message_id": {
+				DataType:    aws.String("String"),
+				StringValue: msg.MessageId,
+			},
+		},
+	})
+	if sendErr != nil {
+		logger.Error("Failed to dead-letter rejected bid submission",
+			zap.NamedError("rejection", err), zap.Error(sendErr))
+		return
+	}
+	logger.Warn("Dead-lettered rejected bid submission", zap.Error(err))
+	in.delete(ctx, msg, logger)
+}
+
+func (in *bidIngester) delete(ctx context.Context, msg types.Message, logger *zap.Logger) {
+	_, err := in.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(in.queue),
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	if err != nil {
+		// the message comes back after its visibility timeout
+		logger.Error("Failed to delete bid submission", zap.Error(err))
+	}
+}
+
+// errMalformedBid is returned for a submission that isn't a valid queuedBid.
+var errMalformedBid = errors.New("malformed bid submission")
+
+func decodeQueuedBid(body string) (queuedBid, error) {
+	var bid queuedBid
+	if err := json.Unmarshal([]byte(body), &bid); err != nil {
+		return bid, fmt.Errorf("%w: %v", errMalformedBid, err)
+	}
+	switch {
+	case bid.AuctionID == "":
+		return bid, fmt.Errorf("%w: auction_id is required", errMalformedBid)
+	case bid.TeamID == "":
+		return bid, fmt.Errorf("%w: team_id is required", errMalformedBid)
+	}
+	return bid, nil
+}
+
+// rejected reports whether a submission that failed with err would fail
+// the same way every time it was received: it is malformed, or the Manager
+// rejected the bid itself rather than failing to record it.
+func rejected(err error) bool {
+	if errors.Is(err, errMalformedBid) {
+		return true
+	}
+	if errors.Is(err, tokens.ErrAuctionConflict) || errors.Is(err, tokens.ErrConditionFailed) ||
+		errors.Is(err, tokens.ErrAuctionInProgress) {
+		return false
+	}
+	status := tokens.HTTPStatus(err)
+	return status >= 400 && status < 500
+}
@@ -2,56 +2,254 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"go.uber.org/zap"
 	"golang.org/x/exp/rand"
+	"google.golang.org/grpc"
 
-	"github.com/christopherwong-hinge/auction/internal/tokens"
+	auctionv1 "github.com/christopherwong-hinge/auction/api/auction/v1"
+	"github.com/christopherwong-hinge/auction/tokens"
 )
 
+// flags are auctiond's command-line flags.
+type flags struct {
+	configPath         string
+	addr               string
+	grpcAddr           string
+	seed               uint64
+	teams              string
+	memory             bool
+	events             eventFlags
+	settlement         settlementFlags
+	ingestQueue        string
+	ingestDeadLetter   string
+	ingestWorkers      int
+	bidArchiveBucket   string
+	bidArchiveInterval time.Duration
+	shutdownTimeout    time.Duration
+	adminTokensFile    string
+}
+
 func main() {
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
 
-	zap.ReplaceGlobals(logger)
+	var f flags
+	flag.StringVar(&f.configPath, "config", "", "JSON config file; AUCTION_* environment variables override it")
+	flag.StringVar(&f.addr, "addr", ":8080", "address to serve the HTTP API on")
+	flag.StringVar(&f.grpcAddr, "grpc-addr", "", "address to serve the gRPC AuctionService on (empty disables it)")
+	flag.Uint64Var(&f.seed, "seed", 0, "seed for reproducible bid IDs and winners (0 uses the current time)")
+	flag.StringVar(&f.teams, "teams", "", "comma-separated team IDs to initialize with a full token balance on startup")
+	flag.BoolVar(&f.memory, "memory", false, "keep all state in memory instead of DynamoDB")
+	flag.StringVar(&f.events.snsTopic, "events-sns-topic", "", "ARN of an SNS topic to publish auction events to")
+	flag.StringVar(&f.events.sqsQueue, "events-sqs-queue", "", "URL of an SQS queue to send auction events to")
+	flag.StringVar(&f.events.kafkaBrokers, "events-kafka-brokers", "", "comma-separated Kafka brokers to write auction events to")
+	flag.StringVar(&f.events.kafkaTopic, "events-kafka-topic", "", "Kafka topic for auction events")
+	flag.StringVar(&f.settlement.kinesisStream, "settlement-kinesis-stream", "", "name or ARN of a Kinesis stream to put settled auctions on")
+	flag.StringVar(&f.settlement.kafkaBrokers, "settlement-kafka-brokers", "", "comma-separated Kafka brokers to write settled auctions to")
+	flag.StringVar(&f.settlement.kafkaTopic, "settlement-kafka-topic", "", "Kafka topic for settled auctions")
+	flag.StringVar(&f.ingestQueue, "ingest-queue", "", "with ingest, URL of the SQS queue of bid submissions to poll")
+	flag.StringVar(&f.ingestDeadLetter, "ingest-dead-letter-queue", "", "with ingest, URL of an SQS queue to move rejected bid submissions to")
+	flag.IntVar(&f.ingestWorkers, "ingest-workers", 4, "with ingest, number of concurrent queue pollers")
+	flag.StringVar(&f.bidArchiveBucket, "bid-archive-bucket", "", "S3 bucket to archive bids to before bid_retention expires them")
+	flag.DurationVar(&f.bidArchiveInterval, "bid-archive-interval", time.Hour, "with -bid-archive-bucket, how often to archive expiring bids")
+	flag.DurationVar(&f.shutdownTimeout, "shutdown-timeout", 10*time.Second, "how long to wait for in-flight requests on shutdown")
+	flag.StringVar(&f.adminTokensFile, "admin-tokens-file", "", "file of \"actor token\" lines authenticating the admin routes (empty disables them)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [migrate|ingest]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Serves the HTTP API, with migrate creates the DynamoDB tables and exits, or with ingest")
+		fmt.Fprintln(flag.CommandLine.Output(), "records sealed bids from the SQS queue -ingest-queue until interrupted.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
-	r := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	mode := flag.Arg(0)
+	switch mode {
+	case "", "migrate":
+	case "ingest":
+		if f.ingestQueue == "" || f.ingestWorkers < 1 {
+			fmt.Fprintln(flag.CommandLine.Output(), "ingest requires -ingest-queue and a positive -ingest-workers")
+			os.Exit(2)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
 
-	teams := []string{
-		"2nCsmWUM2frXOp3HHceWJu75uxP",
-		"2nCsmWs19fatOPEQaHTL8E1WcSu",
-		"2nCsmWz9FpdfQCiEgzdImRAiuLt",
+	// run returns rather than exiting so its deferred cleanup, such as
+	// flushing the Manager's buffered bids and events, always runs
+	if err := run(logger, mode, f); err != nil {
+		logger.Fatal("auctiond failed", zap.Error(err))
 	}
+}
 
-	tm, err := tokens.NewManager()
+// run runs auctiond in mode until it is interrupted or fails.
+func run(logger *zap.Logger, mode string, f flags) error {
+	cfg, err := tokens.LoadConfig(f.configPath)
 	if err != nil {
-		logger.Fatal("Failed to create token manager", zap.Error(err))
+		return fmt.Errorf("failed to load config: %w", err)
 	}
+	cfg.Logger = logger
+	cfg.Metrics = tokens.NewMetrics()
+	if f.seed != 0 {
+		cfg.RandSource = rand.NewSource(f.seed)
+	}
+	if f.memory {
+		cfg.Store = tokens.NewMemoryStore()
+	}
+	// tables are created by migrate, not on every start
+	cfg.SkipTableCreation = true
 
-	// Initialize tokens for all teams
-	err = tm.InitializeTokens(context.TODO(), teams)
+	awsCfg, err := loadAWSConfig(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	publisher, closePublisher, err := f.events.publisher(awsCfg)
 	if err != nil {
-		logger.Fatal("Failed to initialize tokens", zap.Error(err))
+		return fmt.Errorf("failed to create event publisher: %w", err)
+	}
+	if publisher != nil {
+		cfg.EventPublisher = publisher
+		defer closePublisher()
 	}
 
-	bids := []tokens.Bid{
-		{TeamID: teams[0], UserID: "123", Priority: int64(r.Intn(10) + 1)},
-		{TeamID: teams[1], UserID: "123", Priority: int64(r.Intn(10) + 1)},
-		{TeamID: teams[2], UserID: "123", Priority: int64(r.Intn(10) + 1)},
+	settlementPublisher, closeSettlementPublisher, err := f.settlement.publisher(awsCfg)
+	if err != nil {
+		return fmt.Errorf("failed to create settlement publisher: %w", err)
+	}
+	if settlementPublisher != nil {
+		cfg.SettlementPublisher = settlementPublisher
+		defer closeSettlementPublisher()
 	}
 
-	_ = bids
+	if f.bidArchiveBucket != "" {
+		// LocalStack serves buckets by path rather than by subdomain
+		client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+			o.UsePathStyle = cfg.LocalStack
+		})
+		cfg.BidArchiver = tokens.NewS3BidArchiver(client, f.bidArchiveBucket, "bids/")
+		cfg.BidArchiveInterval = f.bidArchiveInterval
+	}
 
-	// Run an auction for a user
-	_, err = tm.RunAuction(context.TODO(), bids)
+	tm, err := tokens.NewManagerFromConfig(cfg)
 	if err != nil {
-		logger.Fatal("Auction failed", zap.Error(err))
+		return fmt.Errorf("failed to create token manager: %w", err)
 	}
+	defer tm.Close()
 
-	// Refill tokens for all teams
-	// err = tm.RefillTokens(context.TODO(), teams)
-	// if err != nil {
-	// 	logger.Fatal("Failed to refill tokens", zap.Error(err))
-	// }
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if mode == "migrate" {
+		if err := tm.EnsureTables(ctx); err != nil {
+			return fmt.Errorf("failed to provision tables: %w", err)
+		}
+		logger.Info("Provisioned tables")
+		return nil
+	}
+
+	if f.teams != "" {
+		if err := tm.InitializeTokens(ctx, strings.Split(f.teams, ",")); err != nil {
+			return fmt.Errorf("failed to initialize tokens: %w", err)
+		}
+	}
+
+	if mode == "ingest" {
+		ingester := &bidIngester{
+			client:     sqs.NewFromConfig(awsCfg),
+			queue:      f.ingestQueue,
+			deadLetter: f.ingestDeadLetter,
+			tm:         tm,
+			logger:     logger,
+		}
+		logger.Info("Ingesting bids", zap.String("queue", f.ingestQueue), zap.Int("workers", f.ingestWorkers))
+		ingester.run(ctx, f.ingestWorkers)
+		logger.Info("Shutting down")
+		return nil
+	}
+
+	// without tokens no one can authenticate, so the admin routes are refused
+	var admins adminTokens
+	if f.adminTokensFile != "" {
+		admins, err = loadAdminTokens(f.adminTokensFile)
+		if err != nil {
+			return fmt.Errorf("failed to load admin tokens: %w", err)
+		}
+	}
+
+	// listen before serving HTTP, so a failure here leaves nothing to stop
+	var grpcLis net.Listener
+	if f.grpcAddr != "" {
+		grpcLis, err = net.Listen("tcp", f.grpcAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for gRPC: %w", err)
+		}
+	}
+
+	srv := &http.Server{
+		Addr:    f.addr,
+		Handler: newServer(tm, cfg.Metrics, admins, logger).handler(),
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		logger.Info("Serving HTTP API", zap.String("addr", f.addr))
+		errc <- srv.ListenAndServe()
+	}()
+
+	var grpcSrv *grpc.Server
+	grpcErrc := make(chan error, 1)
+	if grpcLis != nil {
+		grpcSrv = grpc.NewServer(grpc.UnaryInterceptor(admins.unaryInterceptor))
+		auctionv1.RegisterAuctionServiceServer(grpcSrv, tokens.NewGRPCServer(tm))
+		go func() {
+			logger.Info("Serving gRPC API", zap.String("addr", f.grpcAddr))
+			grpcErrc <- grpcSrv.Serve(grpcLis)
+		}()
+	}
+
+	// a server that failed still has the other shut down before returning
+	var serveErr error
+	select {
+	case err := <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			serveErr = fmt.Errorf("HTTP server failed: %w", err)
+		}
+	case err := <-grpcErrc:
+		serveErr = fmt.Errorf("gRPC server failed: %w", err)
+	case <-ctx.Done():
+		logger.Info("Shutting down")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), f.shutdownTimeout)
+	defer cancel()
+	grpcStopped := make(chan struct{})
+	go func() {
+		if grpcSrv != nil {
+			grpcSrv.GracefulStop()
+		}
+		close(grpcStopped)
+	}()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Failed to shut down HTTP server cleanly", zap.Error(err))
+	}
+	select {
+	case <-grpcStopped:
+	case <-shutdownCtx.Done():
+		logger.Error("Failed to shut down gRPC server cleanly", zap.Error(shutdownCtx.Err()))
+		grpcSrv.Stop()
+	}
+	return serveErr
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+
+	"github.com/christopherwong-hinge/auction/tokens"
+)
+
+// server is the auctiond HTTP API: the Manager's API as served by
+// tokens.NewHTTPHandler, its admin routes authenticated by admins' bearer
+// tokens, with every request logged, and
+//
+//	GET  /metrics                Prometheus metrics: tokens.Metrics, the Go runtime's and the process's
+type server struct {
+	tm      *tokens.Manager
+	metrics *tokens.Metrics
+	admins  adminTokens
+	logger  *zap.Logger
+}
+
+func newServer(tm *tokens.Manager, metrics *tokens.Metrics, admins adminTokens, logger *zap.Logger) *server {
+	return &server{
+		tm:      tm,
+		metrics: metrics,
+		admins:  admins,
+		logger:  logger,
+	}
+}
+
+func (s *server) handler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		s.metrics,
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.Handle("/", tokens.NewHTTPHandler(s.tm, tokens.WithAdminAuth(s.admins.authenticate)))
+	return s.logRequests(mux)
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (s *server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		s.logger.Info("request",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", rec.status),
+			zap.Duration("duration", time.Since(start)),
+		)
+	})
+}
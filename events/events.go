@@ -0,0 +1,216 @@
+// Package events defines what the auction engine tells other services about:
+// auctions starting, being won and settling, bids being recorded, tokens
+// being spent and reputations changing. A Manager given a Publisher with
+// tokens.WithEventPublisher emits each as it happens, so downstream teams
+// can react to auction outcomes without reading the engine's tables.
+//
+// Publishers for SNS, SQS, Kafka and Kinesis send each event as the JSON Marshal
+// returns, tagged with its type; consumers decode it with Unmarshal.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Types of event, as returned by Event.EventType.
+const (
+	TypeAuctionStarted    = "AuctionStarted"
+	TypeBidRecorded       = "BidRecorded"
+	TypeAuctionWon        = "AuctionWon"
+	TypeAuctionSettled    = "AuctionSettled"
+	TypeTokensSpent       = "TokensSpent"
+	TypeReputationChanged = "ReputationChanged"
+)
+
+// Event is one of the event types in this package.
+type Event interface {
+	// EventType is one of the Type constants.
+	EventType() string
+	// EventKey orders events: publishers that partition, such as Kafka or
+	// FIFO SNS topics and SQS queues, keep events with the same key in
+	// order. It is the user for auction events and the team otherwise.
+	EventKey() string
+}
+
+// AuctionStarted is emitted when an auction has locked its user and is about
+// to score the bids.
+type AuctionStarted struct {
+	AuctionID    string   `json:"auction_id"`
+	UserID       string   `json:"user_id"`
+	TeamIDs      []string `json:"team_ids"`
+	OccurredAtMs int64    `json:"occurred_at_ms"`
+}
+
+func (AuctionStarted) EventType() string  { return TypeAuctionStarted }
+func (e AuctionStarted) EventKey() string { return e.UserID }
+
+// BidRecorded is emitted when a bid is recorded, priced and scored.
+type BidRecorded struct {
+	BidID    string  `json:"bid_id"`
+	TeamID   string  `json:"team_id"`
+	UserID   string  `json:"user_id"`
+	Priority int64   `json:"priority"`
+	Cost     int64   `json:"cost"`
+	Score    float64 `json:"score"`
+	// Currency is empty for standard tokens.
+	Currency     string `json:"currency,omitempty"`
+	OccurredAtMs int64  `json:"occurred_at_ms"`
+}
+
+func (BidRecorded) EventType() string  { return TypeBidRecorded }
+func (e BidRecorded) EventKey() string { return e.TeamID }
+
+// AuctionWon is emitted for each winner of an auction once it is charged.
+type AuctionWon struct {
+	AuctionID string  `json:"auction_id"`
+	UserID    string  `json:"user_id"`
+	TeamID    string  `json:"team_id"`
+	BidID     string  `json:"bid_id,omitempty"`
+	Cost      int64   `json:"cost"`
+	Score     float64 `json:"score"`
+	// RemainingBalance is the winner's balance after the charge.
+	RemainingBalance int64 `json:"remaining_balance"`
+	OccurredAtMs     int64 `json:"occurred_at_ms"`
+}
+
+func (AuctionWon) EventType() string  { return TypeAuctionWon }
+func (e AuctionWon) EventKey() string { return e.UserID }
+
+// AuctionSettled is emitted once per auction that ran to an outcome, after
+// its winners were charged, with every bid it scored. An auction without a
+// winner has no Winners and says why in NoWinnerReason.
+type AuctionSettled struct {
+	AuctionID      string          `json:"auction_id"`
+	UserID         string          `json:"user_id"`
+	Bids           []SettledBid    `json:"bids"`
+	Winners        []SettledWinner `json:"winners"`
+	NoWinnerReason string          `json:"no_winner_reason,omitempty"`
+	StartedAtMs    int64           `json:"started_at_ms"`
+	OccurredAtMs   int64           `json:"occurred_at_ms"`
+}
+
+func (AuctionSettled) EventType() string  { return TypeAuctionSettled }
+func (e AuctionSettled) EventKey() string { return e.UserID }
+
+// SettledBid is one bid in an AuctionSettled, in the order it was submitted.
+type SettledBid struct {
+	BidID    string  `json:"bid_id,omitempty"`
+	TeamID   string  `json:"team_id"`
+	Priority int64   `json:"priority"`
+	Score    float64 `json:"score"`
+	// Cost is what the bid would have cost to win at its own price.
+	Cost int64 `json:"cost"`
+	// SkipReason says why the bid didn't compete, and is empty for bids
+	// that won or were outranked.
+	SkipReason string `json:"skip_reason,omitempty"`
+	Won        bool   `json:"won"`
+}
+
+// SettledWinner is a winner of an AuctionSettled, best first.
+type SettledWinner struct {
+	TeamID string  `json:"team_id"`
+	BidID  string  `json:"bid_id,omitempty"`
+	Score  float64 `json:"score"`
+	// Cost is what the winner was charged.
+	Cost int64 `json:"cost"`
+}
+
+// TokensSpent is emitted when a team is charged, whether for an auction win
+// or a direct spend.
+type TokensSpent struct {
+	TeamID   string `json:"team_id"`
+	Amount   int64  `json:"amount"`
+	Priority int64  `json:"priority"`
+	// Currency is empty for standard tokens.
+	Currency string `json:"currency,omitempty"`
+	// Balance is the team's balance in the currency after the charge.
+	Balance      int64 `json:"balance"`
+	OccurredAtMs int64 `json:"occurred_at_ms"`
+}
+
+func (TokensSpent) EventType() string  { return TypeTokensSpent }
+func (e TokensSpent) EventKey() string { return e.TeamID }
+
+// ReputationChanged is emitted when a team's reputation is penalized,
+// rewarded, recovers or is reset by a refill.
+type ReputationChanged struct {
+	TeamID string `json:"team_id"`
+	// Reason is "penalty", "reward", "recovery" or "refill".
+	Reason string `json:"reason"`
+	// Delta is zero for refills, which reset reputation without reading it.
+	Delta      int64 `json:"delta"`
+	Reputation int64 `json:"reputation"`
+	// Priority is the priority of the spend behind a penalty or reward.
+	Priority     int64 `json:"priority,omitempty"`
+	OccurredAtMs int64 `json:"occurred_at_ms"`
+}
+
+func (ReputationChanged) EventType() string  { return TypeReputationChanged }
+func (e ReputationChanged) EventKey() string { return e.TeamID }
+
+// Publisher delivers events downstream. Publish is called synchronously as
+// events happen, so it should be quick; a failure is logged by the Manager
+// and the event dropped.
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// Nop is a Publisher that drops every event.
+var Nop Publisher = nopPublisher{}
+
+type nopPublisher struct{}
+
+func (nopPublisher) Publish(context.Context, Event) error {
+	return nil
+}
+
+// envelope is an event as publishers send it.
+type envelope struct {
+	Type  string          `json:"type"`
+	Event json.RawMessage `json:"event"`
+}
+
+// Marshal encodes e as JSON tagged with its type:
+//
+//	{"type": "AuctionWon", "event": {"auction_id": ..., ...}}
+func Marshal(e Event) ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling %s event: %v", e.EventType(), err)
+	}
+	return json.Marshal(envelope{Type: e.EventType(), Event: data})
+}
+
+// Unmarshal decodes an event encoded by Marshal into its concrete type,
+// e.g. an AuctionWon.
+func Unmarshal(data []byte) (Event, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("error unmarshaling event: %v", err)
+	}
+
+	var e Event
+	switch env.Type {
+	case TypeAuctionStarted:
+		e = &AuctionStarted{}
+	case TypeBidRecorded:
+		e = &BidRecorded{}
+	case TypeAuctionWon:
+		e = &AuctionWon{}
+	case TypeAuctionSettled:
+		e = &AuctionSettled{}
+	case TypeTokensSpent:
+		e = &TokensSpent{}
+	case TypeReputationChanged:
+		e = &ReputationChanged{}
+	default:
+		return nil, fmt.Errorf("unknown event type %q", env.Type)
+	}
+
+	if err := json.Unmarshal(env.Event, e); err != nil {
+		return nil, fmt.Errorf("error unmarshaling %s event: %v", env.Type, err)
+	}
+	return e, nil
+}
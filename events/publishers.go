@@ -0,0 +1,157 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/segmentio/kafka-go"
+)
+
+// typeAttribute is the message attribute or header carrying an event's
+// type, so subscribers can filter on it without decoding the body.
+const typeAttribute = "event_type"
+
+// SNSPublisher publishes events to an SNS topic. On a FIFO topic each
+// event's key is its message group, and the topic must deduplicate on
+// content.
+type SNSPublisher struct {
+	client   *sns.Client
+	topicARN string
+}
+
+// NewSNSPublisher returns a Publisher to the topic with the given ARN.
+func NewSNSPublisher(client *sns.Client, topicARN string) *SNSPublisher {
+	return &SNSPublisher{client: client, topicARN: topicARN}
+}
+
+func (p *SNSPublisher) Publish(ctx context.Context, e Event) error {
+	body, err := Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	input := &sns.PublishInput{
+		TopicArn: aws.String(p.topicARN),
+		Message:  aws.String(string(body)),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			typeAttribute: {DataType: aws.String("String"), StringValue: aws.String(e.EventType())},
+		},
+	}
+	if strings.HasSuffix(p.topicARN, ".fifo") {
+		input.MessageGroupId = aws.String(e.EventKey())
+	}
+
+	_, err = p.client.Publish(ctx, input)
+	if err != nil {
+		return fmt.Errorf("error publishing %s event to SNS: %v", e.EventType(), err)
+	}
+	return nil
+}
+
+// SQSPublisher sends events to an SQS queue. On a FIFO queue each event's
+// key is its message group, and the queue must deduplicate on content.
+type SQSPublisher struct {
+	client   *sqs.Client
+	queueURL string
+}
+
+// NewSQSPublisher returns a Publisher to the queue at queueURL.
+func NewSQSPublisher(client *sqs.Client, queueURL string) *SQSPublisher {
+	return &SQSPublisher{client: client, queueURL: queueURL}
+}
+
+func (p *SQSPublisher) Publish(ctx context.Context, e Event) error {
+	body, err := Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(p.queueURL),
+		MessageBody: aws.String(string(body)),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			typeAttribute: {DataType: aws.String("String"), StringValue: aws.String(e.EventType())},
+		},
+	}
+	if strings.HasSuffix(p.queueURL, ".fifo") {
+		input.MessageGroupId = aws.String(e.EventKey())
+	}
+
+	_, err = p.client.SendMessage(ctx, input)
+	if err != nil {
+		return fmt.Errorf("error sending %s event to SQS: %v", e.EventType(), err)
+	}
+	return nil
+}
+
+// KafkaPublisher writes events to Kafka, keyed by each event's key so a
+// team's or user's events land on one partition in order.
+type KafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaPublisher returns a Publisher writing with w, which must set its
+// Topic. The caller closes w once the Manager is closed.
+func NewKafkaPublisher(w *kafka.Writer) *KafkaPublisher {
+	return &KafkaPublisher{writer: w}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, e Event) error {
+	body, err := Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	err = p.writer.WriteMessages(ctx, kafka.Message{
+		Key:     []byte(e.EventKey()),
+		Value:   body,
+		Headers: []kafka.Header{{Key: typeAttribute, Value: []byte(e.EventType())}},
+	})
+	if err != nil {
+		return fmt.Errorf("error writing %s event to Kafka: %v", e.EventType(), err)
+	}
+	return nil
+}
+
+// KinesisPublisher puts events on a Kinesis data stream, partitioned by each
+// event's key so a team's or user's events land on one shard in order.
+// Records have no attributes, so consumers read the type from the body.
+type KinesisPublisher struct {
+	client *kinesis.Client
+	stream string
+}
+
+// NewKinesisPublisher returns a Publisher to stream, a stream's name or ARN.
+func NewKinesisPublisher(client *kinesis.Client, stream string) *KinesisPublisher {
+	return &KinesisPublisher{client: client, stream: stream}
+}
+
+func (p *KinesisPublisher) Publish(ctx context.Context, e Event) error {
+	body, err := Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	input := &kinesis.PutRecordInput{
+		Data:         body,
+		PartitionKey: aws.String(e.EventKey()),
+	}
+	if strings.HasPrefix(p.stream, "arn:") {
+		input.StreamARN = aws.String(p.stream)
+	} else {
+		input.StreamName = aws.String(p.stream)
+	}
+
+	_, err = p.client.PutRecord(ctx, input)
+	if err != nil {
+		return fmt.Errorf("error putting %s event on Kinesis: %v", e.EventType(), err)
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+// Package simulator runs synthetic auctions through a tokens.Manager backed
+// by a MemoryStore, to see how a cost map or other settings play out before
+// shipping them: which teams win, when they run out of tokens and how their
+// reputations move.
+//
+// Simulated time advances by a fixed step per auction, so drips, cooldowns
+// and recovery behave as they would over the simulated span, and a seeded
+// random source makes every run reproducible.
+//
+//	stats, err := simulator.Run(ctx, simulator.Config{
+//		Teams: []simulator.Team{
+//			{ID: "team-a", Strategy: simulator.Fixed(5)},
+//			{ID: "team-b", Strategy: simulator.Uniform(1, 5)},
+//		},
+//		Auctions:    5000,
+//		Seed:        1,
+//		RefillEvery: 1000,
+//		Options:     []tokens.Option{tokens.WithCostMap(costs)},
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	stats.WriteSummary(os.Stdout)
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/exp/rand"
+
+	"github.com/christopherwong-hinge/auction/tokens"
+)
+
+const (
+	defaultStep        = time.Minute
+	defaultSampleEvery = 100
+)
+
+// start is when every simulation starts, so runs with the same seed match.
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Team is a simulated team and how it bids.
+type Team struct {
+	ID       string
+	Strategy Strategy
+}
+
+// Config describes a simulation.
+type Config struct {
+	Teams []Team
+	// Auctions is how many auctions to run.
+	Auctions int
+	// Users is how many users the auctions rotate over. It defaults to 1.
+	Users int
+	// Seed seeds both the strategies and the Manager's random decisions.
+	Seed uint64
+	// Step is the simulated time between auctions. It defaults to a minute.
+	Step time.Duration
+	// RefillEvery refills every team after that many auctions, or never if
+	// zero. Drip refills are set with tokens.WithDripRefill in Options.
+	RefillEvery int
+	// SampleEvery is how many auctions apart reputations are sampled. It
+	// defaults to 100.
+	SampleEvery int
+	// Options configure the Manager under test, e.g. tokens.WithCostMap.
+	// The simulator sets its store, clock and random source.
+	Options []tokens.Option
+}
+
+// Stats summarizes a simulation.
+type Stats struct {
+	Auctions int
+	// NoWinner counts auctions that had no winner, including those no team
+	// bid in.
+	NoWinner int
+	// Elapsed is the simulated time the auctions spanned.
+	Elapsed time.Duration
+	// Teams are in the order they were configured.
+	Teams []TeamStats
+}
+
+// TeamStats is one team's part in a simulation.
+type TeamStats struct {
+	TeamID string
+	Bids   int
+	Wins   int
+	// WinShare is the team's share of auctions that had a winner.
+	WinShare float64
+	Spent    int64
+	// ExhaustedAt is the first auction in which the team couldn't afford
+	// its bid, or -1 if it always could. ExhaustedAfter is the simulated
+	// time by then.
+	ExhaustedAt     int
+	ExhaustedAfter  time.Duration
+	FinalBalance    int64
+	FinalReputation int64
+	// Reputation is the team's reputation before every SampleEvery'th
+	// auction and after the last.
+	Reputation []ReputationSample
+}
+
+// ReputationSample is a team's reputation before an auction.
+type ReputationSample struct {
+	Auction    int
+	Reputation int64
+}
+
+// Run runs cfg.Auctions auctions, each for the next user in rotation over
+// the bids the teams' strategies make.
+func Run(ctx context.Context, cfg Config) (*Stats, error) {
+	for _, t := range cfg.Teams {
+		if t.Strategy == nil {
+			return nil, fmt.Errorf("team %s has no strategy", t.ID)
+		}
+	}
+
+	users := max(cfg.Users, 1)
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	return run(ctx, cfg, cfg.Auctions, func(i int, balances map[string]tokens.TeamBalance) []tokens.Bid {
+		userID := fmt.Sprintf("user-%d", i%users)
+
+		var bids []tokens.Bid
+		for _, t := range cfg.Teams {
+			b := balances[t.ID]
+			priority, ok := t.Strategy.Bid(TeamState{
+				TeamID:     t.ID,
+				UserID:     userID,
+				Balance:    b.TokenBalance,
+				Reputation: b.ReputationScore,
+				Auction:    i,
+			}, rng)
+			if ok {
+				bids = append(bids, tokens.Bid{TeamID: t.ID, UserID: userID, Priority: priority})
+			}
+		}
+		return bids
+	})
+}
+
+// Replay reruns recorded auctions, one per element of rounds, against the
+// Manager cfg describes, e.g. to see how past bidding would have played
+// out under a new cost map. cfg.Teams may leave out strategies; teams that
+// bid in rounds but aren't in cfg.Teams are added in the order they first
+// bid. cfg.Auctions and cfg.Users are ignored.
+func Replay(ctx context.Context, cfg Config, rounds [][]tokens.Bid) (*Stats, error) {
+	known := make(map[string]bool, len(cfg.Teams))
+	teams := make([]Team, 0, len(cfg.Teams))
+	for _, t := range cfg.Teams {
+		known[t.ID] = true
+		teams = append(teams, t)
+	}
+	for _, bids := range rounds {
+		for _, bid := range bids {
+			if !known[bid.TeamID] {
+				known[bid.TeamID] = true
+				teams = append(teams, Team{ID: bid.TeamID})
+			}
+		}
+	}
+	cfg.Teams = teams
+
+	return run(ctx, cfg, len(rounds), func(i int, _ map[string]tokens.TeamBalance) []tokens.Bid {
+		return rounds[i]
+	})
+}
+
+// run runs n auctions over the bids returned by bidsFor, given each team's
+// balance before the auction.
+func run(
+	ctx context.Context,
+	cfg Config,
+	n int,
+	bidsFor func(i int, balances map[string]tokens.TeamBalance) []tokens.Bid,
+) (*Stats, error) {
+	step := cfg.Step
+	if step <= 0 {
+		step = defaultStep
+	}
+	sampleEvery := cfg.SampleEvery
+	if sampleEvery <= 0 {
+		sampleEvery = defaultSampleEvery
+	}
+
+	clock := &simClock{now: start}
+	opts := append(
+		append([]tokens.Option(nil), cfg.Options...),
+		tokens.WithStore(tokens.NewMemoryStore()),
+		tokens.WithClock(clock),
+		tokens.WithRandSource(rand.NewSource(cfg.Seed)),
+	)
+	tm, err := tokens.NewManager(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating token manager: %v", err)
+	}
+	defer tm.Close()
+
+	teamIDs := make([]string, len(cfg.Teams))
+	stats := &Stats{Auctions: n, Teams: make([]TeamStats, len(cfg.Teams))}
+	byTeam := make(map[string]*TeamStats, len(cfg.Teams))
+	for i, t := range cfg.Teams {
+		teamIDs[i] = t.ID
+		stats.Teams[i] = TeamStats{TeamID: t.ID, ExhaustedAt: -1}
+		byTeam[t.ID] = &stats.Teams[i]
+	}
+
+	if err := tm.InitializeTokens(ctx, teamIDs); err != nil {
+		return nil, fmt.Errorf("error initializing teams: %v", err)
+	}
+
+	for i := 0; i < n; i++ {
+		if cfg.RefillEvery > 0 && i > 0 && i%cfg.RefillEvery == 0 {
+			if err := tm.RefillTokens(ctx, teamIDs); err != nil {
+				return nil, fmt.Errorf("error refilling teams before auction %d: %v", i, err)
+			}
+		}
+
+		balances, err := tm.GetTokenBalances(ctx, teamIDs)
+		if err != nil {
+			return nil, fmt.Errorf("error reading balances before auction %d: %v", i, err)
+		}
+		if i%sampleEvery == 0 {
+			sampleReputations(stats, balances, i)
+		}
+
+		bids := bidsFor(i, balances)
+		for _, bid := range bids {
+			ts := byTeam[bid.TeamID]
+			ts.Bids++
+			if ts.ExhaustedAt >= 0 {
+				continue
+			}
+			b := balances[bid.TeamID]
+			cost, err := tm.CalculateCost(bid.Priority, b.ReputationScore)
+			if err == nil && cost > b.TokenBalance {
+				ts.ExhaustedAt = i
+				ts.ExhaustedAfter = clock.Now().Sub(start)
+			}
+		}
+
+		if len(bids) == 0 {
+			stats.NoWinner++
+		} else {
+			result, err := tm.RunAuction(ctx, bids)
+			switch {
+			case errors.Is(err, tokens.ErrNoWinner):
+				stats.NoWinner++
+			case err != nil:
+				return nil, fmt.Errorf("error running auction %d: %v", i, err)
+			default:
+				ts := byTeam[result.TeamID]
+				ts.Wins++
+				ts.Spent += result.Cost
+			}
+		}
+
+		clock.advance(step)
+	}
+
+	balances, err := tm.GetTokenBalances(ctx, teamIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading final balances: %v", err)
+	}
+	sampleReputations(stats, balances, n)
+
+	stats.Elapsed = clock.Now().Sub(start)
+	won := n - stats.NoWinner
+	for i := range stats.Teams {
+		ts := &stats.Teams[i]
+		ts.FinalBalance = balances[ts.TeamID].TokenBalance
+		ts.FinalReputation = balances[ts.TeamID].ReputationScore
+		if won > 0 {
+			ts.WinShare = float64(ts.Wins) / float64(won)
+		}
+	}
+	return stats, nil
+}
+
+func sampleReputations(stats *Stats, balances map[string]tokens.TeamBalance, auction int) {
+	for i := range stats.Teams {
+		ts := &stats.Teams[i]
+		ts.Reputation = append(ts.Reputation, ReputationSample{
+			Auction:    auction,
+			Reputation: balances[ts.TeamID].ReputationScore,
+		})
+	}
+}
+
+// WriteSummary writes a table of the stats, one row per team.
+func (s *Stats) WriteSummary(w io.Writer) error {
+	fmt.Fprintf(w, "%d auctions over %v, %d without a winner\n\n", s.Auctions, s.Elapsed, s.NoWinner)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "team\tbids\twins\twin share\tspent\texhausted at\tbalance\treputation (min..max)")
+	for _, ts := range s.Teams {
+		exhausted := "-"
+		if ts.ExhaustedAt >= 0 {
+			exhausted = fmt.Sprintf("#%d (%v)", ts.ExhaustedAt, ts.ExhaustedAfter)
+		}
+
+		lo, hi := ts.FinalReputation, ts.FinalReputation
+		for _, r := range ts.Reputation {
+			lo, hi = min(lo, r.Reputation), max(hi, r.Reputation)
+		}
+
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\t%d\t%s\t%d\t%d (%d..%d)\n",
+			ts.TeamID, ts.Bids, ts.Wins, 100*ts.WinShare, ts.Spent, exhausted,
+			ts.FinalBalance, ts.FinalReputation, lo, hi)
+	}
+	return tw.Flush()
+}
+
+// simClock is the simulation's Clock, advanced by hand between auctions.
+type simClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *simClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *simClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
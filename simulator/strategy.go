@@ -0,0 +1,66 @@
+package simulator
+
+import (
+	"golang.org/x/exp/rand"
+)
+
+// TeamState is what a Strategy sees of its team before an auction.
+type TeamState struct {
+	TeamID     string
+	UserID     string
+	Balance    int64
+	Reputation int64
+	// Auction is the index of the auction about to run, from 0.
+	Auction int
+}
+
+// Strategy decides a team's bid in each simulated auction: the priority to
+// bid at, or false to sit the auction out. rng is the simulation's seeded
+// source, so a Strategy drawing from it keeps runs reproducible.
+type Strategy interface {
+	Bid(state TeamState, rng *rand.Rand) (priority int64, ok bool)
+}
+
+// StrategyFunc adapts a function to a Strategy.
+type StrategyFunc func(state TeamState, rng *rand.Rand) (int64, bool)
+
+func (f StrategyFunc) Bid(state TeamState, rng *rand.Rand) (int64, bool) {
+	return f(state, rng)
+}
+
+// Fixed bids priority in every auction.
+func Fixed(priority int64) Strategy {
+	return StrategyFunc(func(TeamState, *rand.Rand) (int64, bool) {
+		return priority, true
+	})
+}
+
+// Uniform bids a priority drawn uniformly from [minPriority, maxPriority]
+// in every auction.
+func Uniform(minPriority, maxPriority int64) Strategy {
+	return StrategyFunc(func(_ TeamState, rng *rand.Rand) (int64, bool) {
+		return minPriority + rng.Int63n(maxPriority-minPriority+1), true
+	})
+}
+
+// Sporadic bids like s in a fraction of auctions chosen at random, and sits
+// the rest out.
+func Sporadic(s Strategy, fraction float64) Strategy {
+	return StrategyFunc(func(state TeamState, rng *rand.Rand) (int64, bool) {
+		if rng.Float64() >= fraction {
+			return 0, false
+		}
+		return s.Bid(state, rng)
+	})
+}
+
+// Conserving bids maxPriority while its balance is at least threshold and
+// minPriority below it, stretching a dwindling budget.
+func Conserving(minPriority, maxPriority, threshold int64) Strategy {
+	return StrategyFunc(func(state TeamState, _ *rand.Rand) (int64, bool) {
+		if state.Balance >= threshold {
+			return maxPriority, true
+		}
+		return minPriority, true
+	})
+}
@@ -0,0 +1,107 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BalanceChangeAdjustment is the reason recorded for balance snapshots taken
+// after an AdjustBalance.
+const BalanceChangeAdjustment = "adjustment"
+
+// AdjustmentRow is the audit record of a manual balance correction. It lives
+// in the tokens table and is written in the same transaction as the change,
+// never to be updated.
+type AdjustmentRow struct {
+	Pk           string `dynamodbav:"pk" json:"-"`
+	AdjustmentID string `dynamodbav:"adjustment_id" json:"adjustment_id"`
+	TeamID       string `dynamodbav:"team_id" json:"team_id"`
+	// Delta is the tokens granted, or deducted if negative.
+	Delta int64 `dynamodbav:"delta" json:"delta"`
+	// Reason says why the balance was corrected and Actor who did it.
+	Reason string `dynamodbav:"reason" json:"reason"`
+	Actor  string `dynamodbav:"actor" json:"actor"`
+	// BalanceAfter is the team's balance once the adjustment applied, as
+	// read just before it; a concurrent spend can make it run ahead.
+	BalanceAfter int64 `dynamodbav:"balance_after" json:"balance_after"`
+	CreatedAtMs  int64 `dynamodbav:"created_at_ms" json:"created_at_ms"`
+}
+
+// TruncateAll deletes every row in the Manager's store: with DynamoDB, every
+// item in the tokens, bids, auctions and balance history tables. It is meant
+// for wiping test environments and returns ErrTruncateDisabled unless the
+// Manager was built WithTruncateAll.
+func (tm *Manager) TruncateAll(ctx context.Context) error {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	if !tm.allowTruncate {
+		return ErrTruncateDisabled
+	}
+
+	return tm.store.Truncate(ctx)
+}
+
+// AdjustBalance grants delta tokens to a team, or deducts them if delta is
+// negative, and records who did it and why in an AdjustmentRow written in
+// the same transaction. Unlike RefillTokens it leaves the rest of the team's
+// row alone. A deduction can't take the balance below zero; it fails with
+// ErrInsufficientBalance instead.
+func (tm *Manager) AdjustBalance(ctx context.Context, teamID string, delta int64, reason, actor string) (*AdjustmentRow, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	reason, actor = strings.TrimSpace(reason), strings.TrimSpace(actor)
+	if delta == 0 {
+		return nil, fmt.Errorf("%w: zero delta", ErrInvalidAdjustment)
+	}
+	if reason == "" || actor == "" {
+		return nil, fmt.Errorf("%w: reason and actor are required", ErrInvalidAdjustment)
+	}
+
+	// reading the row applies any drip due, so a deduction is checked
+	// against the current balance
+	row, err := tm.getTokenRow(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+	teamID = row.TeamID
+	if row.TokenBalance+delta < 0 {
+		return nil, fmt.Errorf("%w: team %s has %d, adjustment deducts %d", ErrInsufficientBalance, teamID, row.TokenBalance, -delta)
+	}
+
+	now := tm.clock.Now()
+	adjustmentID, err := tm.newID("adjustment_", now)
+	if err != nil {
+		return nil, err
+	}
+	adjustment := &AdjustmentRow{
+		Pk:           GetAdjustmentPK(adjustmentID),
+		AdjustmentID: adjustmentID,
+		TeamID:       teamID,
+		Delta:        delta,
+		Reason:       reason,
+		Actor:        actor,
+		BalanceAfter: row.TokenBalance + delta,
+		CreatedAtMs:  now.UnixMilli(),
+	}
+
+	row, err = tm.store.AdjustBalance(ctx, adjustment)
+	if err != nil {
+		var condErr *ConditionFailedError
+		if !errors.As(err, &condErr) {
+			return nil, err
+		}
+		if condErr.Row == nil {
+			return nil, fmt.Errorf("%w: %s", ErrTeamNotFound, teamID)
+		}
+		// spent since it was read
+		return nil, fmt.Errorf("%w: team %s has %d, adjustment deducts %d",
+			ErrInsufficientBalance, teamID, condErr.Row.TokenBalance, -delta)
+	}
+
+	tm.recordBalance(ctx, teamID, row.TokenBalance, BalanceChangeAdjustment)
+	return adjustment, nil
+}
@@ -0,0 +1,54 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTruncateAll(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr error
+	}{
+		{name: "enabled", opts: []Option{WithTruncateAll()}},
+		{name: "disabled by default", wantErr: ErrTruncateDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tm := newTestManager(t, []string{"a", "b"}, tt.opts...)
+			_, err := tm.RunAuction(ctx, []Bid{
+				{TeamID: "a", UserID: "u", Priority: 5},
+				{TeamID: "b", UserID: "u", Priority: 1},
+			})
+			if err != nil {
+				t.Fatalf("RunAuction: %v", err)
+			}
+
+			if err := tm.TruncateAll(ctx); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TruncateAll = %v, want %v", err, tt.wantErr)
+			}
+
+			_, _, balanceErr := tm.GetTokenBalance(ctx, "a")
+			bids, err := tm.GetBids(ctx, "b")
+			if err != nil {
+				t.Fatalf("GetBids: %v", err)
+			}
+			if tt.wantErr != nil {
+				// nothing is deleted
+				if balanceErr != nil || len(bids) != 1 {
+					t.Errorf("after refused truncate: balance error %v and %d bids, want the team and its bid", balanceErr, len(bids))
+				}
+				return
+			}
+			if !errors.Is(balanceErr, ErrTeamNotFound) {
+				t.Errorf("GetTokenBalance after truncate = %v, want %v", balanceErr, ErrTeamNotFound)
+			}
+			if len(bids) != 0 {
+				t.Errorf("got %d bids after truncate, want none", len(bids))
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package tokens
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// bidArchivePK is the tokens table row recording how far bids have been
+// archived.
+const bidArchivePK = "archive#bids"
+
+// BidArchiver stores bids before DynamoDB's TTL deletes them, e.g. as an
+// object in S3. A batch that fails is retried by the next archive run.
+type BidArchiver interface {
+	ArchiveBids(ctx context.Context, batch BidArchiveBatch) error
+}
+
+// BidArchiveBatch is the bids expiring in [FromSec, ToSec), in Unix seconds.
+// Each range is archived once, so it makes a natural object key.
+type BidArchiveBatch struct {
+	FromSec int64
+	ToSec   int64
+	Bids    []BidRow
+}
+
+// WriteJSONLines writes the batch's bids to w as NDJSON, one bid per line.
+func (b BidArchiveBatch) WriteJSONLines(w io.Writer) error {
+	log := newJSONLog(w)
+	for i := range b.Bids {
+		if err := log.write(&b.Bids[i]); err != nil {
+			return fmt.Errorf("error writing bid %s: %v", b.Bids[i].BidID, err)
+		}
+	}
+	return nil
+}
+
+// bidExpiresAt returns the expires_at of a bid recorded at createdAtMs, or
+// zero if bids are retained forever.
+func (tm *Manager) bidExpiresAt(createdAtMs int64) int64 {
+	if tm.bidRetention <= 0 {
+		return 0
+	}
+	return time.UnixMilli(createdAtMs).Add(tm.bidRetention).Unix()
+}
+
+// ArchiveExpiringBids hands the bids expiring before through, and not yet
+// archived, to the Manager's BidArchiver, and returns how many it archived.
+// It queries IndexNameBidsByExpiry, one hour of expiries at a time; the first
+// run starts from the current time, as bids that already expired may be gone.
+// The archiver scheduler calls it with through two archive intervals ahead,
+// so one missed run still archives every bid before it expires.
+//
+// Bids are archived at least once: if two instances archive the same range
+// at once, both batches are stored.
+func (tm *Manager) ArchiveExpiringBids(ctx context.Context, through time.Time) (int, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	if tm.bidArchiver == nil {
+		return 0, fmt.Errorf("%w: no bid archiver", ErrInvalidConfig)
+	}
+
+	watermark, err := tm.store.GetBidArchiveWatermark(ctx)
+	if err != nil {
+		return 0, err
+	}
+	from := watermark
+	if from == 0 {
+		from = tm.clock.Now().Unix()
+	}
+	to := through.Unix()
+	if to <= from {
+		return 0, nil
+	}
+
+	bids, err := tm.store.QueryExpiringBids(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	slices.SortFunc(bids, func(a, b BidRow) int {
+		return cmp.Or(cmp.Compare(a.ExpiresAt, b.ExpiresAt), strings.Compare(a.Pk, b.Pk), strings.Compare(a.Sk, b.Sk))
+	})
+
+	if len(bids) > 0 {
+		err = tm.bidArchiver.ArchiveBids(ctx, BidArchiveBatch{FromSec: from, ToSec: to, Bids: bids})
+		if err != nil {
+			return 0, fmt.Errorf("error archiving bids: %v", err)
+		}
+	}
+
+	err = tm.store.AdvanceBidArchiveWatermark(ctx, watermark, to)
+	if errors.Is(err, ErrConditionFailed) {
+		// a concurrent run archived the range too
+		return len(bids), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(bids), nil
+}
+
+// runBidArchiver calls ArchiveExpiringBids every interval until the Manager
+// is closed, then closes done.
+func (tm *Manager) runBidArchiver(interval time.Duration, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tm.baseCtx.Done():
+			return
+		case <-ticker.C:
+			n, err := tm.ArchiveExpiringBids(tm.baseCtx, tm.clock.Now().Add(2*interval))
+			if err != nil && tm.baseCtx.Err() == nil {
+				tm.logger.Warn("failed to archive expiring bids", zap.Error(err))
+				continue
+			}
+			if n > 0 {
+				tm.logger.Debug("archived expiring bids", zap.Int("bids", n))
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package tokens
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingArchiver keeps every batch it's handed.
+type recordingArchiver struct {
+	mu      sync.Mutex
+	batches []BidArchiveBatch
+}
+
+func (a *recordingArchiver) ArchiveBids(ctx context.Context, batch BidArchiveBatch) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.batches = append(a.batches, batch)
+	return nil
+}
+
+func TestArchiveExpiringBids(t *testing.T) {
+	ctx := context.Background()
+	clock := newTestClock()
+	archiver := &recordingArchiver{}
+	tm := newTestManager(t, []string{"a"}, WithClock(clock),
+		WithBidRetention(3*time.Hour), WithBidArchiver(archiver, 0))
+
+	// bids expiring in 2h and 3h
+	for i := range 2 {
+		if i > 0 {
+			clock.Advance(time.Hour)
+		}
+		if _, err := tm.RecordBid(ctx, &Bid{TeamID: "a", UserID: "u", Priority: 1}, CostBreakdown{Cost: 1}, 1); err != nil {
+			t.Fatalf("RecordBid: %v", err)
+		}
+	}
+
+	n, err := tm.ArchiveExpiringBids(ctx, clock.Now().Add(2*time.Hour+time.Second))
+	if err != nil {
+		t.Fatalf("ArchiveExpiringBids: %v", err)
+	}
+	if n != 1 || len(archiver.batches) != 1 {
+		t.Fatalf("archived %d bids in %d batches, want the first bid in one", n, len(archiver.batches))
+	}
+	// the first run starts from the current time
+	if got, want := archiver.batches[0].FromSec, clock.Now().Unix(); got != want {
+		t.Errorf("first batch from %d, want %d", got, want)
+	}
+
+	n, err = tm.ArchiveExpiringBids(ctx, clock.Now().Add(3*time.Hour+time.Second))
+	if err != nil {
+		t.Fatalf("ArchiveExpiringBids: %v", err)
+	}
+	if n != 1 || len(archiver.batches) != 2 {
+		t.Fatalf("archived %d bids in %d batches, want the second bid in a second one", n, len(archiver.batches))
+	}
+	if archiver.batches[1].FromSec != archiver.batches[0].ToSec {
+		t.Errorf("second batch from %d, want the first's end %d", archiver.batches[1].FromSec, archiver.batches[0].ToSec)
+	}
+}
@@ -0,0 +1,343 @@
+package tokens
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// AuctionConfig holds per-auction settings. The zero value uses the
+// Manager's configuration.
+type AuctionConfig struct {
+	// MaxReputation overrides the Manager's max reputation when scoring and
+	// pricing bids.
+	MaxReputation int64
+
+	// UseHolds places a hold on the winner's tokens rather than spending
+	// them. The hold must be settled with ConfirmAuctionDelivery or
+	// CancelAuctionDelivery and is released automatically after HoldTTL
+	// (DefaultHoldTTL if unset).
+	UseHolds bool
+	HoldTTL  time.Duration
+
+	// ReserveBids reserves each eligible bid's cost as it is scored, so the
+	// team can't spend the tokens in another auction before this one
+	// settles. The winner is charged from its reservation and the others are
+	// released when the auction ends. A team's bids each reserve their own
+	// cost, so a team that can only afford one of them competes with that
+	// one. See DefaultReservationTTL.
+	ReserveBids bool
+
+	// Winners is how many teams RunMultiWinnerAuction awards; zero means
+	// one, the only count RunAuctionWithConfig accepts.
+	Winners int
+
+	// IdempotencyKey, if set, makes retries of the auction safe: an auction
+	// run again with the same key returns the first run's result instead of
+	// charging again. See RunAuctionWithConfig.
+	IdempotencyKey string
+
+	// MinScore and MinPriority set the auction's reserve: bids scoring
+	// below MinScore or with a priority below MinPriority are recorded but
+	// can't win. If no bid meets the reserve the auction fails with
+	// ErrReserveNotMet. Zero means no reserve.
+	MinScore    float64
+	MinPriority int64
+
+	// batch is the batch of auctions run by RunAuctions the auction is
+	// part of, if any.
+	batch *auctionBatch
+	// state is the token rows given to RunAuctionWithState, read instead
+	// of the teams' stored rows, if the auction was run by it.
+	state map[string]TokenDBRow
+}
+
+func (cfg AuctionConfig) winners() int {
+	return max(cfg.Winners, 1)
+}
+
+// meetsReserve reports whether a scored bid meets cfg's reserve.
+func (cfg AuctionConfig) meetsReserve(c *candidate) bool {
+	return c.score >= cfg.MinScore && c.bid.Priority >= cfg.MinPriority
+}
+
+func (cfg AuctionConfig) maxReputation(tm *Manager) int64 {
+	if cfg.MaxReputation > 0 {
+		return cfg.MaxReputation
+	}
+	return tm.maxReputation
+}
+
+// scoreBid reads the bidding team's balance and reputation and prices and
+// scores the bid against them. It fails with ErrTeamSuspended or
+// ErrTeamArchived for a team that can't bid.
+func (tm *Manager) scoreBid(ctx context.Context, bid Bid, cfg AuctionConfig) (*candidate, error) {
+	ctx, end := tm.startSpan(ctx, SpanGetTokenBalance, bidAttrs(&bid)...)
+	row, err := tm.getTokenRow(ctx, bid.TeamID)
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+	if err := row.canBid(); err != nil {
+		return nil, err
+	}
+
+	return tm.scoreBidWithState(bid, row, cfg)
+}
+
+// scoreBidWithState prices and scores a bid against a known token row.
+func (tm *Manager) scoreBidWithState(bid Bid, row *TokenDBRow, cfg AuctionConfig) (*candidate, error) {
+	reputation := row.ReputationScore
+
+	cur, err := tm.currency(&bid)
+	if err != nil {
+		return nil, err
+	}
+	if cur != nil && (cfg.UseHolds || cfg.ReserveBids) {
+		return nil, fmt.Errorf("%w: %s tokens can't be held or reserved", ErrInvalidCurrency, bid.Currency)
+	}
+
+	maxReputation := cfg.maxReputation(tm)
+	breakdown, err := tm.priceBid(bid.Priority, cur, reputation, maxReputation)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &candidate{
+		bid:         bid,
+		cost:        breakdown.Cost,
+		breakdown:   breakdown,
+		score:       tm.score(bid, reputation, maxReputation),
+		balance:     row.balanceIn(bid.Currency),
+		reputation:  reputation,
+		lastWinAtMs: row.LastWinAtMs,
+	}
+	switch tm.tieBreak {
+	case TieBreakRandom:
+		c.tieKey = tm.randFloat64()
+	case TieBreakWinRate:
+		c.winRate = winRate(row)
+	}
+	return c, nil
+}
+
+func (c *candidate) affordable() bool {
+	return c.balance >= c.cost
+}
+
+// WinProbabilities previews each team's chance of winning if bids were
+// awarded at random in proportion to score, over the bids that could win
+// now: those the team can afford from a team not in win cooldown. A team
+// with several bids gets their combined chance. If every eligible bid scores
+// zero they share the chance equally. The probabilities sum to 1, or the map
+// is empty if no bid is eligible. Nothing is recorded or charged.
+func (tm *Manager) WinProbabilities(ctx context.Context, bids []Bid) (map[string]float64, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	bids = tm.normalizeBids(bids)
+
+	teamIDs := make([]string, len(bids))
+	for i, bid := range bids {
+		teamIDs[i] = bid.TeamID
+	}
+	rows, missing, err := tm.BatchGetTokenBalance(ctx, teamIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTeamNotFound, missing[0])
+	}
+
+	var eligible []*candidate
+	var total float64
+	nowMilli := tm.clock.Now().UnixMilli()
+	for _, bid := range bids {
+		row := rows[bid.TeamID]
+		c, err := tm.scoreBidWithState(bid, &row, AuctionConfig{})
+		if err != nil {
+			return nil, err
+		}
+		if !c.affordable() || tm.inCooldown(c.lastWinAtMs, nowMilli) {
+			continue
+		}
+		eligible = append(eligible, c)
+		total += c.score
+	}
+
+	probabilities := make(map[string]float64)
+	for _, c := range eligible {
+		if total > 0 {
+			probabilities[c.bid.TeamID] += c.score / total
+		} else {
+			probabilities[c.bid.TeamID] += 1 / float64(len(eligible))
+		}
+	}
+	return probabilities, nil
+}
+
+// SimulateAuction picks the winner RunAuction would pick for bids under cfg,
+// using current balances, reputations, win cooldowns and frequency caps,
+// without recording bids or spending tokens.
+func (tm *Manager) SimulateAuction(ctx context.Context, bids []Bid, cfg AuctionConfig) (*AuctionResult, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	bids, _, _, err := tm.validateBids(tm.normalizeBids(bids), nil)
+	if err != nil {
+		return nil, err
+	}
+	return tm.simulateAuction(ctx, bids, nil, cfg)
+}
+
+// simulateAuction is SimulateAuction for bids that may already have been
+// recorded; rows, if non-nil, holds the recorded row for each bid.
+func (tm *Manager) simulateAuction(
+	ctx context.Context,
+	bids []Bid,
+	rows []*BidRow,
+	cfg AuctionConfig,
+) (*AuctionResult, error) {
+	nowMs := tm.clock.Now().UnixMilli()
+	capped, err := tm.frequencyCapped(ctx, bids, nowMs)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []*candidate
+	active, belowReserve := 0, 0
+	for i, bid := range bids {
+		spanCtx, end := tm.startSpan(ctx, SpanGetTokenBalance, bidAttrs(&bid)...)
+		row, err := tm.getTokenRow(spanCtx, bid.TeamID)
+		end(err)
+		if err != nil {
+			return nil, err
+		}
+		// as in RunAuction, a suspended or archived team's bid is skipped
+		// rather than failing the auction
+		if row.canBid() != nil {
+			continue
+		}
+		active++
+
+		c, err := tm.scoreBidWithState(bid, row, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if rows != nil {
+			c.row = rows[i]
+			c.createdAtMs = rows[i].CreatedAtMs
+		}
+		if !cfg.meetsReserve(c) {
+			belowReserve++
+			continue
+		}
+
+		if c.affordable() && !tm.inCooldown(c.lastWinAtMs, nowMs) &&
+			!capped[GetFrequencyPK(bid.TeamID, bid.UserID)] {
+			candidates = append(candidates, c)
+		}
+	}
+
+	if active > 0 && belowReserve == active {
+		return nil, ErrReserveNotMet
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoWinner
+	}
+	rankCandidates(candidates, tm.tieBreak)
+	winner := candidates[0]
+	// the simulation doesn't ask the veto about its winner either
+	price, err := tm.clearingPrice(ctx, winner, candidates[1:], nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AuctionResult{
+		TeamID: winner.bid.TeamID,
+		Score:  winner.score,
+		Cost:   price,
+	}
+	if winner.row != nil {
+		result.BidID = winner.row.BidID
+	}
+	return result, nil
+}
+
+// replayAuctionWindow is how far apart the bids of one recorded auction can
+// be created. Bids are recorded as the auction scores them, so an auction's
+// bids are normally milliseconds apart.
+const replayAuctionWindow = time.Second
+
+// replayAuction is the rows ReplayBids takes to be one recorded auction.
+type replayAuction struct {
+	rows  []*BidRow
+	teams map[string]bool
+}
+
+// ReplayBids re-runs recorded bids through the current auction logic under
+// cfg, e.g. to backtest a config change. Rows are grouped into the auctions
+// that recorded them: bids on the same target user created within
+// replayAuctionWindow of the auction's first bid, at most one per team, so
+// later auctions for the same user replay separately. Auctions are replayed
+// in order of their earliest bid and scored against the teams' current
+// balances, reputations, win cooldowns and frequency caps, skipping the bids
+// of teams since suspended or archived. Nothing is written. Auctions without a winner, including those
+// under the reserve, produce no result.
+func (tm *Manager) ReplayBids(ctx context.Context, rows []BidRow, cfg AuctionConfig) ([]AuctionResult, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	sorted := make([]*BidRow, len(rows))
+	for i := range rows {
+		sorted[i] = &rows[i]
+	}
+	slices.SortStableFunc(sorted, func(a, b *BidRow) int {
+		return cmp.Compare(a.CreatedAtMs, b.CreatedAtMs)
+	})
+
+	var auctions []*replayAuction
+	open := make(map[string]*replayAuction)
+	for _, row := range sorted {
+		teamID := bidTeamID(row)
+		a := open[row.Target]
+		if a == nil || a.teams[teamID] ||
+			row.CreatedAtMs-a.rows[0].CreatedAtMs > replayAuctionWindow.Milliseconds() {
+			a = &replayAuction{teams: make(map[string]bool)}
+			open[row.Target] = a
+			auctions = append(auctions, a)
+		}
+		a.rows = append(a.rows, row)
+		a.teams[teamID] = true
+	}
+
+	var results []AuctionResult
+	for _, a := range auctions {
+		auctionRows := a.rows
+
+		bids := make([]Bid, len(auctionRows))
+		for i, row := range auctionRows {
+			bids[i] = Bid{
+				TeamID:   bidTeamID(row),
+				UserID:   row.Target,
+				Priority: row.Priority,
+				Currency: row.Currency,
+			}
+		}
+
+		result, err := tm.simulateAuction(ctx, bids, auctionRows, cfg)
+		switch {
+		case errors.Is(err, ErrNoWinner):
+			// including ErrReserveNotMet
+			continue
+		case err != nil:
+			return nil, err
+		}
+		results = append(results, *result)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,224 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// replayRow returns a recorded bid for ReplayBids.
+func replayRow(teamID, target string, priority, createdAtMs int64) BidRow {
+	bidID := fmt.Sprintf("bid_%s_%d", teamID, createdAtMs)
+	return BidRow{
+		Pk:          GetBidPK(teamID),
+		Sk:          fmt.Sprintf("%s#%s#%d", teamID, bidID, createdAtMs),
+		BidID:       bidID,
+		Target:      target,
+		Priority:    priority,
+		CreatedAtMs: createdAtMs,
+	}
+}
+
+func TestReplayBids(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []BidRow
+		cfg  AuctionConfig
+		// suspend and archive are teams suspended or archived before the
+		// replay
+		suspend, archive string
+		// want is the winning team of each replayed auction, in order
+		want []string
+	}{
+		{
+			name: "one auction",
+			rows: []BidRow{replayRow("a", "u", 5, 1000), replayRow("b", "u", 1, 1001)},
+			want: []string{"a"},
+		},
+		{
+			name: "later auction for the same user",
+			rows: []BidRow{
+				replayRow("a", "u", 5, 1000), replayRow("b", "u", 1, 1001),
+				replayRow("a", "u", 1, 60000), replayRow("b", "u", 5, 60001),
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "same team twice within the window",
+			rows: []BidRow{replayRow("a", "u", 5, 1000), replayRow("a", "u", 1, 1100)},
+			want: []string{"a", "a"},
+		},
+		{
+			name: "auctions for different users",
+			rows: []BidRow{
+				replayRow("b", "v", 5, 1001), replayRow("a", "u", 5, 1000), replayRow("b", "u", 1, 1002),
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "auction under the reserve",
+			rows: []BidRow{replayRow("a", "u", 1, 1000), replayRow("b", "v", 5, 1001)},
+			cfg:  AuctionConfig{MinPriority: 3},
+			want: []string{"b"},
+		},
+		{
+			name:    "auction with a suspended team",
+			rows:    []BidRow{replayRow("c", "u", 5, 1000), replayRow("b", "v", 5, 1001)},
+			suspend: "c",
+			want:    []string{"b"},
+		},
+		{
+			name: "suspended team outbid the winner",
+			rows: []BidRow{
+				replayRow("a", "u", 1, 1000), replayRow("c", "u", 10, 1001), replayRow("b", "u", 5, 1002),
+			},
+			suspend: "c",
+			want:    []string{"b"},
+		},
+		{
+			name:    "auction with an archived team",
+			rows:    []BidRow{replayRow("c", "u", 5, 1000), replayRow("b", "v", 5, 1001)},
+			archive: "c",
+			want:    []string{"b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tm := newTestManager(t, []string{"a", "b", "c"})
+			if tt.suspend != "" {
+				if _, err := tm.SuspendTeam(ctx, tt.suspend, "test"); err != nil {
+					t.Fatalf("SuspendTeam: %v", err)
+				}
+			}
+			if tt.archive != "" {
+				if _, err := tm.ArchiveTeam(ctx, tt.archive, "test"); err != nil {
+					t.Fatalf("ArchiveTeam: %v", err)
+				}
+			}
+
+			results, err := tm.ReplayBids(ctx, tt.rows, tt.cfg)
+			if err != nil {
+				t.Fatalf("ReplayBids: %v", err)
+			}
+			var got []string
+			for _, result := range results {
+				got = append(got, result.TeamID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("winners %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimulateAuctionEligibility(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{name: "no limits", want: "a"},
+		{name: "winner in cooldown", opts: []Option{WithWinCooldown(time.Hour)}, want: "b"},
+		{name: "winner at its frequency cap", opts: []Option{WithFrequencyCap(FrequencyCap{MaxWins: 1, Window: time.Hour})}, want: "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tm := newTestManager(t, []string{"a", "b"}, tt.opts...)
+			bids := []Bid{
+				{TeamID: "a", UserID: "u", Priority: 10},
+				{TeamID: "b", UserID: "u", Priority: 5},
+			}
+			if _, err := tm.RunAuction(ctx, bids); err != nil {
+				t.Fatalf("RunAuction: %v", err)
+			}
+
+			simulated, err := tm.SimulateAuction(ctx, bids, AuctionConfig{})
+			if err != nil {
+				t.Fatalf("SimulateAuction: %v", err)
+			}
+			// the simulation agrees with the auction it previews
+			result, err := tm.RunAuction(ctx, bids)
+			if err != nil {
+				t.Fatalf("RunAuction: %v", err)
+			}
+			if simulated.TeamID != tt.want || result.TeamID != tt.want {
+				t.Errorf("simulated winner %s, auction winner %s, want %s", simulated.TeamID, result.TeamID, tt.want)
+			}
+		})
+	}
+}
+
+func TestWinProbabilities(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		bids  []Bid
+		broke []string
+		want  map[string]float64
+	}{
+		{
+			name: "proportional to score",
+			bids: []Bid{
+				{TeamID: "a", UserID: "u", Priority: 10},
+				{TeamID: "b", UserID: "u", Priority: 1},
+			},
+			want: map[string]float64{"a": 100.0 / 130, "b": 30.0 / 130},
+		},
+		{
+			name: "unaffordable bids excluded",
+			bids: []Bid{
+				{TeamID: "a", UserID: "u", Priority: 10},
+				{TeamID: "b", UserID: "u", Priority: 1},
+			},
+			broke: []string{"a"},
+			want:  map[string]float64{"b": 1},
+		},
+		{
+			name: "all scoring zero share equally",
+			opts: []Option{WithScoreWeights(ScoreWeights{Priority: 1})},
+			bids: []Bid{
+				{TeamID: "a", UserID: "u", Priority: 1},
+				{TeamID: "b", UserID: "u", Priority: 1},
+			},
+			want: map[string]float64{"a": 0.5, "b": 0.5},
+		},
+		{
+			name:  "none eligible",
+			bids:  []Bid{{TeamID: "a", UserID: "u", Priority: 10}},
+			broke: []string{"a"},
+			want:  map[string]float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := NewMemoryStore()
+			tm := newTestManager(t, []string{"a", "b"}, append([]Option{WithStore(mem)}, tt.opts...)...)
+			for _, team := range tt.broke {
+				mem.tokens[team].TokenBalance = 0
+			}
+
+			got, err := tm.WinProbabilities(ctx, tt.bids)
+			if err != nil {
+				t.Fatalf("WinProbabilities: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("probabilities = %v, want %v", got, tt.want)
+			}
+			for team, want := range tt.want {
+				if math.Abs(got[team]-want) > 1e-9 {
+					t.Errorf("probability of %s = %v, want %v", team, got[team], want)
+				}
+			}
+			// previewing charges nobody
+			if balance := tokenRow(t, tm, "b").TokenBalance; balance != InitialTokenCount {
+				t.Errorf("balance of b = %d, want %d", balance, InitialTokenCount)
+			}
+		})
+	}
+}
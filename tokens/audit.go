@@ -0,0 +1,114 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// auditTimeout bounds writing an auction's audit record, which may happen
+// after the auction's own context is cancelled.
+const auditTimeout = 5 * time.Second
+
+// AuctionAudit is the complete record of how an auction was decided, kept
+// so a disputed outcome can be reconstructed: every bid considered with its
+// score, cost and eligibility, the rules the auction ran under, and how the
+// winners were settled. Audit records live in the auctions table and are
+// written once, when the auction ends, and never changed.
+type AuctionAudit struct {
+	Pk        string `dynamodbav:"pk" json:"pk"`
+	Sk        string `dynamodbav:"sk" json:"sk"`
+	AuctionID string `dynamodbav:"auction_id" json:"auction_id"`
+	UserID    string `dynamodbav:"user_id" json:"user_id"`
+
+	// Strategy and TieBreak are named as in the config file.
+	Strategy    string  `dynamodbav:"strategy" json:"strategy"`
+	TieBreak    string  `dynamodbav:"tie_break" json:"tie_break"`
+	Winners     int     `dynamodbav:"winners" json:"winners"`
+	MinScore    float64 `dynamodbav:"min_score,omitempty" json:"min_score,omitempty"`
+	MinPriority int64   `dynamodbav:"min_priority,omitempty" json:"min_priority,omitempty"`
+	UseHolds    bool    `dynamodbav:"use_holds,omitempty" json:"use_holds,omitempty"`
+	ReserveBids bool    `dynamodbav:"reserve_bids,omitempty" json:"reserve_bids,omitempty"`
+
+	// Bids holds every bid scored, in the order they were submitted. Bids
+	// the auction failed before scoring are left out.
+	Bids []BidDecision `dynamodbav:"bids" json:"bids"`
+	// Results are the winners', best first, as they were charged.
+	Results        []AuctionResult `dynamodbav:"results,omitempty" json:"results,omitempty"`
+	NoWinnerReason string          `dynamodbav:"no_winner_reason,omitempty" json:"no_winner_reason,omitempty"`
+	// Error is why the auction failed, if it did.
+	Error       string `dynamodbav:"error,omitempty" json:"error,omitempty"`
+	StartedAtMs int64  `dynamodbav:"started_at_ms" json:"started_at_ms"`
+	SettledAtMs int64  `dynamodbav:"settled_at_ms" json:"settled_at_ms"`
+}
+
+// auditAuction writes an auction's audit record. Like recordAuction it logs
+// failures rather than returning them, and it writes even after ctx is
+// cancelled so that failed auctions are audited too.
+func (tm *Manager) auditAuction(
+	ctx context.Context,
+	auctionID string,
+	startedAt time.Time,
+	bids []Bid,
+	cfg AuctionConfig,
+	scored []*candidate,
+	candidates []*candidate,
+	results []*AuctionResult,
+	err error,
+) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditTimeout)
+	defer cancel()
+
+	var userID string
+	if len(bids) > 0 {
+		userID = bids[0].UserID
+	}
+
+	audit := AuctionAudit{
+		Pk:          GetAuctionAuditPK(auctionID),
+		Sk:          auctionID,
+		AuctionID:   auctionID,
+		UserID:      userID,
+		Strategy:    tm.auctionStrategy.String(),
+		TieBreak:    tm.tieBreak.String(),
+		Winners:     cfg.winners(),
+		MinScore:    cfg.MinScore,
+		MinPriority: cfg.MinPriority,
+		UseHolds:    cfg.UseHolds,
+		ReserveBids: cfg.ReserveBids,
+		Bids:        bidDecisions(scored),
+		StartedAtMs: startedAt.UnixMilli(),
+		SettledAtMs: tm.clock.Now().UnixMilli(),
+	}
+	for _, result := range results {
+		audit.Results = append(audit.Results, *result)
+	}
+	if len(results) == 0 && (err == nil || errors.Is(err, ErrNoWinner)) {
+		audit.NoWinnerReason = noWinnerReason(scored, candidates)
+	}
+	if err != nil {
+		audit.Error = err.Error()
+	}
+
+	putErr := tm.store.PutAuctionAudit(ctx, &audit)
+	if putErr != nil {
+		tm.logger.Warn(
+			"failed to write auction audit",
+			zap.String("auction_id", auctionID),
+			zap.String("user_id", userID),
+			zap.Error(putErr),
+		)
+	}
+}
+
+// GetAuctionAudit returns the audit record of an auction, e.g. one a team
+// disputes. It fails with ErrAuctionAuditNotFound for an auction that wasn't
+// audited.
+func (tm *Manager) GetAuctionAudit(ctx context.Context, auctionID string) (*AuctionAudit, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.store.GetAuctionAudit(ctx, auctionID)
+}
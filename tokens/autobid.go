@@ -0,0 +1,154 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// AutoBidPolicy is a team's standing instruction to the auto-bidder: when an
+// auction window opens for a user it matches, the Manager submits a sealed
+// bid for the team at the highest priority the policy can afford. Policies
+// live in the tokens table, one per team.
+type AutoBidPolicy struct {
+	Pk     string `dynamodbav:"pk" json:"pk"`
+	TeamID string `dynamodbav:"team_id" json:"team_id"`
+	// MaxPriority is the highest priority to bid at.
+	MaxPriority int64 `dynamodbav:"max_priority" json:"max_priority"`
+	// MaxCost caps what one bid may cost, or is zero for no cap.
+	MaxCost int64 `dynamodbav:"max_cost,omitempty" json:"max_cost,omitempty"`
+	// ReserveBalance is the balance a bid must leave the team.
+	ReserveBalance int64 `dynamodbav:"reserve_balance,omitempty" json:"reserve_balance,omitempty"`
+	// UserIDs are the users to bid on, or empty for every user.
+	UserIDs     []string `dynamodbav:"user_ids,omitempty" json:"user_ids,omitempty"`
+	CreatedAtMs int64    `dynamodbav:"created_at_ms" json:"created_at_ms"`
+	UpdatedAtMs int64    `dynamodbav:"updated_at_ms" json:"updated_at_ms"`
+}
+
+func (p *AutoBidPolicy) validate() error {
+	if p.MaxPriority < 1 {
+		return fmt.Errorf("%w: max priority must be positive, got %d", ErrInvalidAutoBidPolicy, p.MaxPriority)
+	}
+	if p.MaxCost < 0 || p.ReserveBalance < 0 {
+		return fmt.Errorf("%w: max cost and reserve balance must not be negative, got %d and %d",
+			ErrInvalidAutoBidPolicy, p.MaxCost, p.ReserveBalance)
+	}
+	return nil
+}
+
+// matches reports whether the policy bids on userID.
+func (p *AutoBidPolicy) matches(userID string) bool {
+	return len(p.UserIDs) == 0 || slices.Contains(p.UserIDs, userID)
+}
+
+// SetAutoBidPolicy registers a team's auto-bid policy, replacing any it had.
+// The team must exist.
+func (tm *Manager) SetAutoBidPolicy(ctx context.Context, policy AutoBidPolicy) (*AutoBidPolicy, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+
+	policy.TeamID = tm.normalizeID(policy.TeamID)
+	if _, err := tm.getTokenRow(ctx, policy.TeamID); err != nil {
+		return nil, err
+	}
+
+	policy.UserIDs = slices.Clone(policy.UserIDs)
+	for i, userID := range policy.UserIDs {
+		policy.UserIDs[i] = tm.normalizeID(userID)
+	}
+
+	nowMs := tm.clock.Now().UnixMilli()
+	policy.Pk = GetAutoBidPolicyPK(policy.TeamID)
+	policy.CreatedAtMs = nowMs
+	if prior, err := tm.store.GetAutoBidPolicy(ctx, policy.TeamID); err == nil {
+		policy.CreatedAtMs = prior.CreatedAtMs
+	}
+	policy.UpdatedAtMs = nowMs
+
+	err := tm.store.PutAutoBidPolicy(ctx, &policy)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// GetAutoBidPolicy reads a team's auto-bid policy.
+func (tm *Manager) GetAutoBidPolicy(ctx context.Context, teamID string) (*AutoBidPolicy, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.store.GetAutoBidPolicy(ctx, tm.normalizeID(teamID))
+}
+
+// DeleteAutoBidPolicy stops auto-bidding for a team.
+func (tm *Manager) DeleteAutoBidPolicy(ctx context.Context, teamID string) error {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.store.DeleteAutoBidPolicy(ctx, tm.normalizeID(teamID))
+}
+
+// placeAutoBids submits a bid to a newly opened window for every auto-bid
+// policy matching its user. Bids that fail, e.g. for a team that can't
+// afford any priority, are logged and skipped; they never fail the window.
+func (tm *Manager) placeAutoBids(ctx context.Context, w *AuctionWindow) {
+	policies, err := tm.store.ListAutoBidPolicies(ctx)
+	if err != nil {
+		tm.logger.Warn("failed to list auto-bid policies", zap.String("auction_id", w.AuctionID), zap.Error(err))
+		return
+	}
+
+	for i := range policies {
+		p := &policies[i]
+		if !p.matches(w.UserID) {
+			continue
+		}
+
+		priority, ok, err := tm.autoBidPriority(ctx, p)
+		if err == nil && ok {
+			_, err = tm.addWindowBid(ctx, w, Bid{TeamID: p.TeamID, UserID: w.UserID, Priority: priority})
+		}
+		if err != nil {
+			tm.logger.Warn(
+				"failed to place auto-bid",
+				zap.String("auction_id", w.AuctionID),
+				zap.String("team_id", p.TeamID),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// autoBidPriority returns the highest priority up to the policy's max whose
+// cost the policy allows at the team's current balance and reputation, or
+// false if there is none. Like any sealed bid, it is priced again when the
+// window settles.
+func (tm *Manager) autoBidPriority(ctx context.Context, p *AutoBidPolicy) (int64, bool, error) {
+	row, err := tm.getTokenRow(ctx, p.TeamID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	priorities := tm.priorities()
+	slices.Sort(priorities)
+	for _, priority := range slices.Backward(priorities) {
+		if priority > p.MaxPriority {
+			continue
+		}
+
+		cost, err := tm.computeBidcost(&Bid{TeamID: p.TeamID, Priority: priority}, row.ReputationScore)
+		if err != nil {
+			return 0, false, err
+		}
+		if (p.MaxCost == 0 || cost <= p.MaxCost) && row.TokenBalance-cost >= p.ReserveBalance {
+			return priority, true, nil
+		}
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,92 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Reasons a balance snapshot was taken.
+const (
+	BalanceChangeSpend  = "spend"
+	BalanceChangeRefill = "refill"
+)
+
+// BalanceSnapshot is a team's token balance right after a spend or refill,
+// stored in the balance_history table when WithBalanceHistory is set.
+type BalanceSnapshot struct {
+	Pk           string `dynamodbav:"pk" json:"-"`
+	Sk           string `dynamodbav:"sk" json:"-"`
+	TeamID       string `dynamodbav:"team_id" json:"team_id"`
+	TokenBalance int64  `dynamodbav:"token_balance" json:"token_balance"`
+	Reason       string `dynamodbav:"reason" json:"reason"`
+	TimestampMs  int64  `dynamodbav:"timestamp_ms" json:"timestamp_ms"`
+}
+
+// balanceHistorySk orders snapshots by time; the ID keeps snapshots taken in
+// the same millisecond apart.
+func balanceHistorySk(timestampMs int64, id string) string {
+	return fmt.Sprintf("%013d#%s", timestampMs, id)
+}
+
+// balanceHistorySkFrom and balanceHistorySkTo bound the sort keys of the
+// snapshots taken between startMs and endMs inclusive.
+func balanceHistorySkFrom(startMs int64) string {
+	return fmt.Sprintf("%013d", startMs)
+}
+
+func balanceHistorySkTo(endMs int64) string {
+	// '~' sorts after the '#' separator, taking in all of endMs
+	return fmt.Sprintf("%013d~", endMs)
+}
+
+// recordBalance reports a team's balance to the Manager's metrics, if any,
+// and snapshots it if balance history is enabled. Failures are logged rather
+// than returned since the balance change they describe has already been
+// applied.
+func (tm *Manager) recordBalance(ctx context.Context, teamID string, balance int64, reason string) {
+	tm.observeBalance(teamID, balance)
+
+	if !tm.balanceHistory {
+		return
+	}
+
+	now := tm.clock.Now()
+	id, err := tm.newID("", now)
+	if err != nil {
+		tm.logger.Warn("failed to generate balance snapshot ID", zap.Error(err))
+		return
+	}
+
+	snapshot := BalanceSnapshot{
+		Pk:           GetBalanceHistoryPK(teamID),
+		Sk:           balanceHistorySk(now.UnixMilli(), id),
+		TeamID:       teamID,
+		TokenBalance: balance,
+		Reason:       reason,
+		TimestampMs:  now.UnixMilli(),
+	}
+
+	err = tm.store.PutBalanceSnapshot(ctx, &snapshot)
+	if err != nil {
+		tm.logger.Warn(
+			"failed to record balance snapshot",
+			zap.String("team_id", teamID),
+			zap.String("reason", reason),
+			zap.Error(err),
+		)
+	}
+}
+
+// GetBalanceHistory returns a team's balance snapshots taken between startMs
+// and endMs inclusive, oldest first. Snapshots are only recorded while
+// WithBalanceHistory is set.
+func (tm *Manager) GetBalanceHistory(ctx context.Context, teamID string, startMs, endMs int64) ([]BalanceSnapshot, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	teamID = tm.normalizeID(teamID)
+
+	return tm.store.QueryBalanceSnapshots(ctx, teamID, startMs, endMs)
+}
@@ -0,0 +1,69 @@
+package tokens
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBalanceHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		// from and to bound the queried window, relative to the first spend
+		from, to    time.Duration
+		wantReasons []string
+	}{
+		{name: "disabled", to: time.Hour},
+		{
+			name: "every change", enabled: true, to: time.Hour,
+			wantReasons: []string{BalanceChangeSpend, BalanceChangeSpend, BalanceChangeRefill},
+		},
+		{
+			name: "window", enabled: true, from: time.Minute, to: time.Minute,
+			wantReasons: []string{BalanceChangeSpend},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := newTestClock()
+			tm := newTestManager(t, []string{"a"}, WithClock(clock), WithBalanceHistory(tt.enabled))
+			start := clock.Now()
+
+			// spends a minute apart, then a refill
+			for range 2 {
+				if _, err := tm.SpendTokens(ctx, &Bid{TeamID: "a", UserID: "u", Priority: 5}); err != nil {
+					t.Fatalf("SpendTokens: %v", err)
+				}
+				clock.Advance(time.Minute)
+			}
+			if err := tm.RefillTokens(ctx, []string{"a"}); err != nil {
+				t.Fatalf("RefillTokens: %v", err)
+			}
+
+			snapshots, err := tm.GetBalanceHistory(ctx, "a",
+				start.Add(tt.from).UnixMilli(), start.Add(tt.to).UnixMilli())
+			if err != nil {
+				t.Fatalf("GetBalanceHistory: %v", err)
+			}
+			if len(snapshots) != len(tt.wantReasons) {
+				t.Fatalf("got %d snapshots %+v, want %d", len(snapshots), snapshots, len(tt.wantReasons))
+			}
+			for i, s := range snapshots {
+				if s.Reason != tt.wantReasons[i] {
+					t.Errorf("snapshot %d reason = %s, want %s", i, s.Reason, tt.wantReasons[i])
+				}
+			}
+			if tt.enabled && tt.from == 0 {
+				// oldest first, each the balance after its change
+				want := []int64{InitialTokenCount - 5, InitialTokenCount - 10, InitialTokenCount}
+				for i, s := range snapshots {
+					if s.TokenBalance != want[i] {
+						t.Errorf("snapshot %d balance = %d, want %d", i, s.TokenBalance, want[i])
+					}
+				}
+			}
+		})
+	}
+}
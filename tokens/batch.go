@@ -0,0 +1,420 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// batchAuctionParallelism bounds how many auctions RunAuctions runs, and how
+// many bid batches it writes, at once.
+const batchAuctionParallelism = 16
+
+// settleGroupSize bounds how many winners' charges settleGroups commits in
+// one transaction. A charge takes up to five of a transaction's 100 items:
+// the token row, the won bid, the reservation, the lock check and the
+// ledger entry.
+const settleGroupSize = 20
+
+// settleGroupLinger is how long settleGroups waits for more charges to join
+// a group that isn't full before committing it.
+const settleGroupLinger = 5 * time.Millisecond
+
+// BatchAuctionResult is the outcome of one auction run by RunAuctions: its
+// result, or the error it failed with, as RunAuction would return them.
+type BatchAuctionResult struct {
+	Result *AuctionResult
+	Err    error
+}
+
+// RunAuctions runs an auction for every user in auctions, keyed by user ID,
+// as RunAuction would one by one, for batches of many auctions such as the
+// nightly run. It takes far fewer store round trips to do so:
+//
+//   - the token rows of every bidding team are read once, in batches, and
+//     carried from auction to auction, less what each team won and was
+//     charged, rather than read again by every auction;
+//   - every bid is recorded up front with batch writes;
+//   - the charges of winners of different teams are committed together, up
+//     to settleGroupSize in one transaction. A group whose transaction fails
+//     falls back to charging each winner on its own, so each auction still
+//     falls back to its next bid as RunAuction does (see
+//     WithChargeFallback).
+//
+// Bids are priced and scored against the shared token rows, which may be
+// stale, e.g. if a team spent elsewhere; as with RunAuctionWithState, a
+// stale balance can fail a charge but never overdraw a team. Up to
+// batchAuctionParallelism auctions run at once, each under its user's lock.
+//
+// A bid with no user ID bids on the user it is keyed under; one keyed under
+// another user fails its auction with ErrInvalidBid. Each auction succeeds
+// or fails on its own, and the bids of one that fails without charging
+// anyone, other than for want of a winner, are marked aborted. The returned
+// error is only non-nil if the batch as a whole failed, e.g. reading the
+// token rows or recording the bids, in which case no auction was run.
+func (tm *Manager) RunAuctions(ctx context.Context, auctions map[string][]Bid) (map[string]BatchAuctionResult, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	outcomes := make(map[string]BatchAuctionResult, len(auctions))
+	prepared := make(map[string][]Bid, len(auctions))
+	var teamIDs []string
+	for userID, bids := range auctions {
+		bids, err := tm.prepareBatchAuction(tm.normalizeID(userID), bids)
+		if err != nil {
+			outcomes[userID] = BatchAuctionResult{Err: err}
+			continue
+		}
+		prepared[userID] = bids
+		for _, bid := range bids {
+			teamIDs = append(teamIDs, bid.TeamID)
+		}
+	}
+
+	rows, _, err := tm.batchGetTokenRows(ctx, teamIDs)
+	if err != nil {
+		return nil, err
+	}
+	b := &auctionBatch{
+		rows:   make(map[string]*TokenDBRow, len(rows)),
+		groups: &settleGroups{store: tm.store, ctx: ctx},
+	}
+	for teamID := range rows {
+		row := rows[teamID]
+		b.rows[teamID] = &row
+	}
+	if tm.degraded != nil {
+		tm.degraded.remember(b.rows, tm.clock.Now().UnixMilli())
+	}
+
+	bidRows, err := tm.recordBatchBids(ctx, b, prepared, outcomes)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	sem := make(chan struct{}, batchAuctionParallelism)
+	for _, userID := range slices.Sorted(maps.Keys(prepared)) {
+		bids := prepared[userID]
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results, err := tm.runAuction(ctx, bids, bidRows[userID], AuctionConfig{batch: b})
+			if err != nil && !errors.Is(err, ErrNoWinner) && chargedNothing(err) {
+				// the auction never got to the bids recorded for it
+				tm.abortDropped(ctx, bidRows[userID])
+			}
+
+			outcome := BatchAuctionResult{Err: err}
+			if err == nil {
+				outcome.Result = results[0]
+			}
+			mu.Lock()
+			outcomes[userID] = outcome
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return outcomes, nil
+}
+
+// prepareBatchAuction normalizes and validates the bids of one auction of a
+// batch on userID, as runAuction would.
+func (tm *Manager) prepareBatchAuction(userID string, bids []Bid) ([]Bid, error) {
+	if len(bids) > tm.maxBidsPerAuction {
+		return nil, fmt.Errorf("%w: %d bids, max %d", ErrTooManyBids, len(bids), tm.maxBidsPerAuction)
+	}
+	bids = tm.normalizeBids(bids)
+	for i := range bids {
+		if bids[i].UserID == "" {
+			bids[i].UserID = userID
+		}
+		if bids[i].UserID != userID {
+			return nil, fmt.Errorf("%w: bid %d is on user %s, not %s", ErrInvalidBid, i, bids[i].UserID, userID)
+		}
+	}
+	bids, _, _, err := tm.validateBids(bids, nil)
+	return bids, err
+}
+
+// recordBatchBids prices, scores and records the bids of every prepared
+// auction against the batch's token rows, returning the rows recorded per
+// user. An auction bid on by a team without a token row fails with
+// ErrTeamNotFound, unless invalid bids are dropped, in which case the bid
+// is; either way nothing is recorded for it. A failing auction is removed
+// from prepared and its outcome set.
+func (tm *Manager) recordBatchBids(
+	ctx context.Context,
+	b *auctionBatch,
+	prepared map[string][]Bid,
+	outcomes map[string]BatchAuctionResult,
+) (map[string][]*BidRow, error) {
+	nowMilli := tm.clock.Now().UnixMilli()
+
+	byUser := make(map[string][]*BidRow, len(prepared))
+	var all []*BidRow
+	for userID, bids := range prepared {
+		bids, rows, err := tm.scoreBatchAuction(b, bids, nowMilli)
+		if err != nil {
+			delete(prepared, userID)
+			outcomes[userID] = BatchAuctionResult{Err: err}
+			continue
+		}
+		prepared[userID] = bids
+		byUser[userID] = rows
+		all = append(all, rows...)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, batchAuctionParallelism)
+	for start := 0; start < len(all); start += batchWriteLimit {
+		batch := all[start:min(start+batchWriteLimit, len(all))]
+
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := tm.store.PutBids(ctx, batch); err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	for userID, bids := range prepared {
+		for i, br := range byUser[userID] {
+			tm.publishBidRecorded(&bids[i], br)
+		}
+	}
+	return byUser, nil
+}
+
+// scoreBatchAuction prices and scores the bids of one auction of a batch
+// against the batch's token rows. It returns the bids kept and the rows to
+// record them as.
+func (tm *Manager) scoreBatchAuction(b *auctionBatch, bids []Bid, nowMilli int64) (kept []Bid, rows []*BidRow, err error) {
+	kept = make([]Bid, 0, len(bids))
+	rows = make([]*BidRow, 0, len(bids))
+	for _, bid := range bids {
+		row := b.rows[bid.TeamID]
+		if row == nil && tm.bidValidation.DropInvalid {
+			tm.logger.Warn("dropping bid from unknown team", zap.String("team_id", bid.TeamID))
+			continue
+		}
+		if row == nil {
+			return nil, nil, fmt.Errorf("%w: %s", ErrTeamNotFound, bid.TeamID)
+		}
+
+		c, err := tm.scoreBidWithState(bid, row, AuctionConfig{})
+		if err != nil {
+			return nil, nil, err
+		}
+		br, err := tm.newBidRow(&bid, c.breakdown, c.score, nowMilli)
+		if err != nil {
+			return nil, nil, err
+		}
+		kept = append(kept, bid)
+		rows = append(rows, br)
+	}
+
+	return kept, rows, nil
+}
+
+// auctionBatch is the state the auctions of a RunAuctions batch share.
+type auctionBatch struct {
+	// mu guards rows, the token rows of the teams bidding, as read before
+	// the batch less what the batch charged.
+	mu   sync.Mutex
+	rows map[string]*TokenDBRow
+
+	groups *settleGroups
+}
+
+// tokenRows returns copies of the token rows of the teams bidding. It fails
+// with ErrTeamNotFound if any team has no row, unless dropMissing is set.
+func (b *auctionBatch) tokenRows(bids []Bid, dropMissing bool) (map[string]*TokenDBRow, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	rows := make(map[string]*TokenDBRow, len(bids))
+	for _, bid := range bids {
+		row, ok := b.rows[bid.TeamID]
+		if !ok && !dropMissing {
+			return nil, fmt.Errorf("%w: %s", ErrTeamNotFound, bid.TeamID)
+		}
+		if ok {
+			rows[bid.TeamID] = cloneTokenRow(row)
+		}
+	}
+	return rows, nil
+}
+
+// charged carries a win into the batch's token rows, so later auctions
+// price and score the winning team's bids against what it has left.
+func (b *auctionBatch) charged(bid Bid, result *AuctionResult, nowMs int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	row, ok := b.rows[bid.TeamID]
+	if !ok {
+		return
+	}
+	setBalanceIn(row, bid.Currency, result.RemainingBalance)
+	row.LastWinAtMs = nowMs
+	row.WinCount++
+}
+
+// settleGroups commits the charges of concurrent auctions' winners in
+// groups: charges are queued until settleGroupSize of different teams are
+// waiting, or settleGroupLinger has passed, and then committed with a
+// single UpdateBalances. If a group's transaction fails its condition,
+// which doesn't say whose failed, every charge in it is made on its own
+// instead, so each fails or succeeds as it would have alone.
+type settleGroups struct {
+	store Store
+	// ctx is the context groups are committed in once they linger.
+	ctx context.Context
+
+	mu      sync.Mutex
+	pending []*groupedSpend
+	timer   *time.Timer
+}
+
+// groupedSpend is a charge waiting for its group to be committed.
+type groupedSpend struct {
+	u   BalanceUpdate
+	row *TokenDBRow
+	err error
+	// alone is set if the spend is to be made on its own.
+	alone bool
+	done  chan struct{}
+}
+
+// update charges u with its group, returning the team's token row after
+// it, as UpdateBalance would.
+func (g *settleGroups) update(ctx context.Context, u BalanceUpdate) (*TokenDBRow, error) {
+	spend := &groupedSpend{u: u, done: make(chan struct{})}
+
+	g.mu.Lock()
+	g.pending = append(g.pending, spend)
+	group := g.take(false)
+	g.mu.Unlock()
+
+	if group != nil {
+		g.commit(ctx, group)
+	}
+	<-spend.done
+
+	if spend.alone {
+		return g.store.UpdateBalance(ctx, u)
+	}
+	return spend.row, spend.err
+}
+
+// flush commits whatever group is pending once it lingered.
+func (g *settleGroups) flush() {
+	g.mu.Lock()
+	g.timer = nil
+	group := g.take(true)
+	g.mu.Unlock()
+
+	g.commit(g.ctx, group)
+}
+
+// take removes the next group from the pending charges: the oldest charge
+// of each team, up to settleGroupSize. Unless lingered is set, it returns
+// nil rather than a group that isn't full. A timer is left running to
+// flush any charges still pending. g.mu must be held.
+func (g *settleGroups) take(lingered bool) []*groupedSpend {
+	teams := make(map[string]bool, settleGroupSize)
+	var group, rest []*groupedSpend
+	for _, spend := range g.pending {
+		if len(group) == settleGroupSize || teams[spend.u.TeamID] {
+			rest = append(rest, spend)
+			continue
+		}
+		teams[spend.u.TeamID] = true
+		group = append(group, spend)
+	}
+
+	if len(group) < settleGroupSize && !lingered {
+		group = nil
+	} else {
+		g.pending = rest
+	}
+	if len(g.pending) > 0 && g.timer == nil {
+		g.timer = time.AfterFunc(settleGroupLinger, g.flush)
+	}
+	return group
+}
+
+// commit commits a group of charges and wakes up their callers.
+func (g *settleGroups) commit(ctx context.Context, group []*groupedSpend) {
+	defer func() {
+		for _, spend := range group {
+			close(spend.done)
+		}
+	}()
+
+	switch len(group) {
+	case 0:
+		return
+	case 1:
+		group[0].alone = true
+		return
+	}
+
+	updates := make([]BalanceUpdate, len(group))
+	for i, spend := range group {
+		updates[i] = spend.u
+	}
+	rows, err := g.store.UpdateBalances(ctx, updates)
+	for i, spend := range group {
+		switch {
+		case err == nil:
+			spend.row = rows[i]
+		case errors.Is(err, ErrConditionFailed):
+			spend.alone = true
+		default:
+			spend.err = err
+		}
+	}
+}
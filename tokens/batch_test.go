@@ -0,0 +1,192 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestRunAuctions(t *testing.T) {
+	tests := []struct {
+		name     string
+		initial  int64
+		auctions map[string][]Bid
+		// wantWinners is the winner of each auction, or empty if it has
+		// none; wantErr is the error of each that fails
+		wantWinners map[string]string
+		wantErr     map[string]error
+		// wantWins counts the wins of each team, for auctions whose winner
+		// depends on the order they ran in
+		wantWins map[string]int
+	}{
+		{
+			name:    "every user awarded",
+			initial: InitialTokenCount,
+			auctions: map[string][]Bid{
+				"u1": {{TeamID: "a", Priority: 5}, {TeamID: "b", Priority: 1}},
+				"u2": {{TeamID: "b", Priority: 5}, {TeamID: "c", Priority: 1}},
+				"u3": {{TeamID: "c", Priority: 5}},
+			},
+			wantWinners: map[string]string{"u1": "a", "u2": "b", "u3": "c"},
+			wantWins:    map[string]int{"a": 1, "b": 1, "c": 1},
+		},
+		{
+			name:    "balance carried across auctions",
+			initial: 10,
+			auctions: map[string][]Bid{
+				"u1": {{TeamID: "a", Priority: 10}, {TeamID: "b", Priority: 1}},
+				"u2": {{TeamID: "a", Priority: 10}, {TeamID: "b", Priority: 1}},
+			},
+			wantWins: map[string]int{"a": 1, "b": 1},
+		},
+		{
+			name:    "failures stay with their auction",
+			initial: InitialTokenCount,
+			auctions: map[string][]Bid{
+				"u1": {{TeamID: "a", UserID: "u2", Priority: 5}},
+				"u2": {{TeamID: "missing", Priority: 5}},
+				"u3": {{TeamID: "b", Priority: 5}},
+			},
+			wantWinners: map[string]string{"u3": "b"},
+			wantErr:     map[string]error{"u1": ErrInvalidBid, "u2": ErrTeamNotFound},
+			wantWins:    map[string]int{"b": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tm := newTestManager(t, []string{"a", "b", "c"}, WithInitialTokenCount(tt.initial))
+
+			outcomes, err := tm.RunAuctions(ctx, tt.auctions)
+			if err != nil {
+				t.Fatalf("RunAuctions: %v", err)
+			}
+			if len(outcomes) != len(tt.auctions) {
+				t.Fatalf("got %d outcomes, want %d", len(outcomes), len(tt.auctions))
+			}
+
+			spent := make(map[string]int64)
+			wins := make(map[string]int)
+			for userID, outcome := range outcomes {
+				if want := tt.wantErr[userID]; want != nil || outcome.Err != nil {
+					if !errors.Is(outcome.Err, want) {
+						t.Errorf("auction of %s failed with %v, want %v", userID, outcome.Err, want)
+					}
+					continue
+				}
+				if want, ok := tt.wantWinners[userID]; ok && outcome.Result.TeamID != want {
+					t.Errorf("auction of %s won by %s, want %s", userID, outcome.Result.TeamID, want)
+				}
+				spent[outcome.Result.TeamID] += outcome.Result.Cost
+				wins[outcome.Result.TeamID]++
+			}
+
+			for _, teamID := range []string{"a", "b", "c"} {
+				if wins[teamID] != tt.wantWins[teamID] {
+					t.Errorf("team %s won %d auctions, want %d", teamID, wins[teamID], tt.wantWins[teamID])
+				}
+				row := tokenRow(t, tm, teamID)
+				if want := tt.initial - spent[teamID]; row.TokenBalance != want {
+					t.Errorf("team %s balance = %d, want %d", teamID, row.TokenBalance, want)
+				}
+				if row.WinCount != int64(wins[teamID]) {
+					t.Errorf("team %s win count = %d, want %d", teamID, row.WinCount, wins[teamID])
+				}
+			}
+		})
+	}
+}
+
+func TestRunAuctionsRecordsBids(t *testing.T) {
+	ctx := context.Background()
+	tm := newTestManager(t, []string{"a", "b"})
+
+	outcomes, err := tm.RunAuctions(ctx, map[string][]Bid{
+		"u1": {{TeamID: "a", Priority: 5}, {TeamID: "b", Priority: 1}},
+		"u2": {{TeamID: "a", Priority: 1}, {TeamID: "b", Priority: 5}},
+	})
+	if err != nil {
+		t.Fatalf("RunAuctions: %v", err)
+	}
+
+	for _, teamID := range []string{"a", "b"} {
+		bids, err := tm.GetBids(ctx, teamID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bids) != 2 {
+			t.Fatalf("team %s has %d bids recorded, want 2", teamID, len(bids))
+		}
+		for _, bid := range bids {
+			outcome := outcomes[bid.Target]
+			if won := outcome.Result.BidID == bid.BidID; bid.Won != won {
+				t.Errorf("bid %s of team %s on %s won = %v, want %v", bid.BidID, teamID, bid.Target, bid.Won, won)
+			}
+		}
+	}
+}
+
+func TestSettleGroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		teams   []string
+		amounts []int64
+		wantErr []bool
+	}{
+		{
+			name:    "all covered",
+			teams:   []string{"a", "b", "c"},
+			amounts: []int64{10, 20, 30},
+			wantErr: []bool{false, false, false},
+		},
+		{
+			name:    "one uncovered",
+			teams:   []string{"a", "b", "c"},
+			amounts: []int64{10, InitialTokenCount + 1, 30},
+			wantErr: []bool{false, true, false},
+		},
+		{
+			name:    "same team twice",
+			teams:   []string{"a", "a", "b"},
+			amounts: []int64{10, 20, 30},
+			wantErr: []bool{false, false, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tm := newTestManager(t, []string{"a", "b", "c"})
+			g := &settleGroups{store: tm.store, ctx: ctx}
+
+			errs := make([]error, len(tt.teams))
+			var wg sync.WaitGroup
+			for i, teamID := range tt.teams {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, errs[i] = g.update(ctx, BalanceUpdate{TeamID: teamID, Amount: tt.amounts[i], Priority: 1, Win: true})
+				}()
+			}
+			wg.Wait()
+
+			spent := make(map[string]int64)
+			for i, err := range errs {
+				if (err != nil) != tt.wantErr[i] {
+					t.Errorf("update %d of team %s = %v, want error %v", i, tt.teams[i], err, tt.wantErr[i])
+				}
+				if err != nil && !errors.Is(err, ErrConditionFailed) {
+					t.Errorf("update %d = %v, want ErrConditionFailed", i, err)
+				}
+				if err == nil {
+					spent[tt.teams[i]] += tt.amounts[i]
+				}
+			}
+			for teamID, amount := range spent {
+				if row := tokenRow(t, tm, teamID); row.TokenBalance != InitialTokenCount-amount {
+					t.Errorf("team %s balance = %d, want %d", teamID, row.TokenBalance, InitialTokenCount-amount)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package tokens
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// BidBufferConfig enables buffered bid recording. Rather than one PutItem per
+// bid, RecordBid queues rows and writes them with BatchWriteItem once
+// MaxSize rows are queued or every FlushInterval, whichever comes first.
+//
+// Buffering trades durability for latency: bids still queued when the
+// process exits without calling Close are lost, and queued bids are not
+// visible to GetBids until flushed.
+type BidBufferConfig struct {
+	MaxSize       int
+	FlushInterval time.Duration
+}
+
+type bidBuffer struct {
+	tm  *Manager
+	cfg BidBufferConfig
+
+	mu   sync.Mutex
+	rows []*BidRow
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newBidBuffer(tm *Manager, cfg BidBufferConfig) *bidBuffer {
+	b := &bidBuffer{
+		tm:   tm,
+		cfg:  cfg,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	if cfg.FlushInterval > 0 {
+		go b.run()
+	} else {
+		close(b.done)
+	}
+	return b
+}
+
+func (b *bidBuffer) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			if err := b.flush(b.tm.baseCtx); err != nil {
+				b.tm.logger.Warn("failed to flush buffered bids", zap.Error(err))
+			}
+		}
+	}
+}
+
+// add queues a row, flushing if the buffer is full.
+func (b *bidBuffer) add(ctx context.Context, br *BidRow) error {
+	b.mu.Lock()
+	b.rows = append(b.rows, br)
+	full := b.cfg.MaxSize > 0 && len(b.rows) >= b.cfg.MaxSize
+	b.mu.Unlock()
+
+	if full {
+		return b.flush(ctx)
+	}
+	return nil
+}
+
+// markWon sets Won on br if it is still queued, reporting whether it was.
+func (b *bidBuffer) markWon(br *BidRow) bool {
+	return b.modify(br, func(br *BidRow) { br.Won = true })
+}
+
+// markAborted sets Aborted on br if it is still queued, reporting whether it
+// was.
+func (b *bidBuffer) markAborted(br *BidRow) bool {
+	return b.modify(br, func(br *BidRow) { br.Aborted = true })
+}
+
+// modify applies f to br if it is still queued, reporting whether it was.
+func (b *bidBuffer) modify(br *BidRow, f func(*BidRow)) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !slices.Contains(b.rows, br) {
+		return false
+	}
+	f(br)
+	return true
+}
+
+func (b *bidBuffer) flush(ctx context.Context) error {
+	b.mu.Lock()
+	rows := b.rows
+	b.rows = nil
+	b.mu.Unlock()
+
+	for start := 0; start < len(rows); start += batchWriteLimit {
+		end := min(start+batchWriteLimit, len(rows))
+
+		err := b.tm.store.PutBids(ctx, rows[start:end])
+		if err != nil {
+			// requeue what wasn't written so a later flush can retry it
+			b.mu.Lock()
+			b.rows = append(rows[start:], b.rows...)
+			b.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *bidBuffer) close(ctx context.Context) error {
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+	}
+	<-b.done
+
+	return b.flush(ctx)
+}
+
+// Flush writes any buffered bids. It is a no-op unless WithBidBuffer is set.
+func (tm *Manager) Flush(ctx context.Context) error {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	if tm.bidBuffer == nil {
+		return nil
+	}
+	return tm.bidBuffer.flush(ctx)
+}
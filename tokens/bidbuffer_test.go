@@ -0,0 +1,118 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBidBuffer(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxSize  int
+		auctions int
+		flush    bool
+		// wantVisible is how many of the losing team's bids GetBids returns
+		// afterwards
+		wantVisible int
+	}{
+		// every auction queues two bids
+		{name: "queued below max size", maxSize: 5, auctions: 2, wantVisible: 0},
+		{name: "flushed at max size", maxSize: 4, auctions: 2, wantVisible: 2},
+		{name: "flushed on request", maxSize: 10, auctions: 2, flush: true, wantVisible: 2},
+		{name: "no max size", auctions: 5, wantVisible: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tm := newTestManager(t, []string{"a", "b"}, WithBidBuffer(BidBufferConfig{MaxSize: tt.maxSize}))
+
+			for range tt.auctions {
+				_, err := tm.RunAuction(ctx, []Bid{
+					{TeamID: "a", UserID: "u", Priority: 5},
+					{TeamID: "b", UserID: "u", Priority: 1},
+				})
+				if err != nil {
+					t.Fatalf("RunAuction: %v", err)
+				}
+			}
+			if tt.flush {
+				if err := tm.Flush(ctx); err != nil {
+					t.Fatalf("Flush: %v", err)
+				}
+			}
+
+			lost, err := tm.GetBids(ctx, "b")
+			if err != nil {
+				t.Fatalf("GetBids: %v", err)
+			}
+			if len(lost) != tt.wantVisible {
+				t.Errorf("got %d losing bids, want %d", len(lost), tt.wantVisible)
+			}
+
+			// winning rows are written with the charge, so they are visible
+			// at once, and flushing their queued copies mustn't unmark them
+			if err := tm.Flush(ctx); err != nil {
+				t.Fatalf("Flush: %v", err)
+			}
+			won, err := tm.GetBids(ctx, "a")
+			if err != nil {
+				t.Fatalf("GetBids: %v", err)
+			}
+			if len(won) != tt.auctions {
+				t.Errorf("got %d winning bids, want %d", len(won), tt.auctions)
+			}
+			for _, bid := range won {
+				if !bid.Won {
+					t.Errorf("bid %s not marked won after flush", bid.BidID)
+				}
+			}
+		})
+	}
+}
+
+// failingPutStore fails the next fail calls to PutBids.
+type failingPutStore struct {
+	Store
+	fail int
+}
+
+func (s *failingPutStore) PutBids(ctx context.Context, rows []*BidRow) error {
+	if s.fail > 0 {
+		s.fail--
+		return errors.New("put failed")
+	}
+	return s.Store.PutBids(ctx, rows)
+}
+
+func TestBidBufferRequeuesFailedFlush(t *testing.T) {
+	ctx := context.Background()
+	store := &failingPutStore{Store: NewMemoryStore()}
+	tm := newTestManager(t, []string{"a", "b"}, WithStore(store), WithBidBuffer(BidBufferConfig{}))
+
+	for range 2 {
+		_, err := tm.RunAuction(ctx, []Bid{
+			{TeamID: "a", UserID: "u", Priority: 5},
+			{TeamID: "b", UserID: "u", Priority: 1},
+		})
+		if err != nil {
+			t.Fatalf("RunAuction: %v", err)
+		}
+	}
+
+	store.fail = 1
+	if err := tm.Flush(ctx); err == nil {
+		t.Fatal("Flush succeeded, want the store's error")
+	}
+	if err := tm.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	lost, err := tm.GetBids(ctx, "b")
+	if err != nil {
+		t.Fatalf("GetBids: %v", err)
+	}
+	if len(lost) != 2 {
+		t.Errorf("got %d losing bids after retrying the flush, want 2", len(lost))
+	}
+}
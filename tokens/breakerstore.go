@@ -0,0 +1,659 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// BreakerConfig tunes a BreakerStore. Zero fields take their defaults.
+type BreakerConfig struct {
+	// Threshold is how many calls in a row must fail for the circuit to
+	// open. It defaults to 5.
+	Threshold int
+	// Cooldown is how long the circuit stays open before a single call is
+	// let through to probe whether the store recovered. It defaults to 30
+	// seconds.
+	Cooldown time.Duration
+}
+
+func (c BreakerConfig) withDefaults() BreakerConfig {
+	if c.Threshold <= 0 {
+		c.Threshold = defaultBreakerThreshold
+	}
+	if c.Cooldown <= 0 {
+		c.Cooldown = defaultBreakerCooldown
+	}
+	return c
+}
+
+// BreakerState is where a BreakerStore's circuit stands.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every call through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails every call with ErrStoreUnavailable.
+	BreakerOpen
+	// BreakerHalfOpen lets one call through at a time to probe the store;
+	// the circuit closes if it succeeds and opens again if it fails.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// BreakerStore is a circuit breaker around another Store. Once Threshold
+// calls in a row fail the way an unhealthy store does, such as 5xx
+// responses, throttling, timeouts or network errors, the circuit opens and
+// calls fail fast with ErrStoreUnavailable, without reaching the store,
+// until Cooldown has passed and a probe succeeds. Failures that come from
+// the rows themselves, such as a failed condition or a missing team, show
+// the store is up. See WithCircuitBreaker.
+type BreakerStore struct {
+	store  Store
+	cfg    BreakerConfig
+	logger *zap.Logger
+	clock  Clock
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	// probing is set while the half-open circuit's probe is in flight.
+	probing bool
+}
+
+// NewBreakerStore returns store behind a circuit breaker configured by cfg.
+// The circuit opening and closing is logged to logger, which may be nil.
+// Cooldowns are timed by the clock given with WithStoreClock.
+func NewBreakerStore(store Store, cfg BreakerConfig, logger *zap.Logger, opts ...StoreOption) *BreakerStore {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	o := newStoreOptions(opts)
+	return &BreakerStore{store: store, cfg: cfg.withDefaults(), logger: logger, clock: o.clock}
+}
+
+// State returns where the circuit stands. An open circuit whose cooldown has
+// passed is reported half-open, as the next call probes the store.
+func (s *BreakerStore) State() BreakerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == BreakerOpen && s.clock.Now().Sub(s.openedAt) >= s.cfg.Cooldown {
+		return BreakerHalfOpen
+	}
+	return s.state
+}
+
+// allow reports whether a call may go through, failing with
+// ErrStoreUnavailable if not, and whether the call is the half-open
+// circuit's probe.
+func (s *BreakerStore) allow() (probe bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.state {
+	case BreakerClosed:
+		return false, nil
+	case BreakerOpen:
+		if s.clock.Now().Sub(s.openedAt) < s.cfg.Cooldown {
+			return false, ErrStoreUnavailable
+		}
+		s.state = BreakerHalfOpen
+	}
+
+	if s.probing {
+		return false, ErrStoreUnavailable
+	}
+	s.probing = true
+	return true, nil
+}
+
+// done records how a call that was let through fared.
+func (s *BreakerStore) done(ctx context.Context, probe bool, err error) {
+	failed := err != nil && unhealthy(ctx, err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if probe {
+		s.probing = false
+	}
+	if !failed {
+		if s.state != BreakerClosed {
+			s.logger.Info("store circuit closed")
+		}
+		s.state = BreakerClosed
+		s.failures = 0
+		return
+	}
+
+	s.failures++
+	if probe || (s.state == BreakerClosed && s.failures >= s.cfg.Threshold) {
+		s.state = BreakerOpen
+		s.openedAt = s.clock.Now()
+		s.logger.Warn(
+			"store circuit opened",
+			zap.Int("failures", s.failures),
+			zap.Duration("cooldown", s.cfg.Cooldown),
+			zap.Error(err),
+		)
+	}
+}
+
+func (s *BreakerStore) call(ctx context.Context, fn func() error) error {
+	probe, err := s.allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	s.done(ctx, probe, err)
+	return err
+}
+
+func breakerValue[T any](ctx context.Context, s *BreakerStore, fn func() (T, error)) (T, error) {
+	var v T
+	err := s.call(ctx, func() error {
+		var err error
+		v, err = fn()
+		return err
+	})
+	return v, err
+}
+
+// unhealthy reports whether a call that failed with err suggests the store
+// itself is failing, rather than the call or its caller.
+func unhealthy(ctx context.Context, err error) bool {
+	if retryable(err, retryTransient) {
+		return true
+	}
+	// the store timing out, rather than the caller giving up
+	if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func (s *BreakerStore) EnsureSchema(ctx context.Context) error {
+	return s.store.EnsureSchema(ctx)
+}
+
+func (s *BreakerStore) Truncate(ctx context.Context) error {
+	return s.store.Truncate(ctx)
+}
+
+func (s *BreakerStore) GetTokenRow(ctx context.Context, teamID string, consistent bool) (*TokenDBRow, error) {
+	return breakerValue(ctx, s, func() (*TokenDBRow, error) {
+		return s.store.GetTokenRow(ctx, teamID, consistent)
+	})
+}
+
+func (s *BreakerStore) BatchGetTokenRows(ctx context.Context, teamIDs []string) (map[string]TokenDBRow, error) {
+	return breakerValue(ctx, s, func() (map[string]TokenDBRow, error) {
+		return s.store.BatchGetTokenRows(ctx, teamIDs)
+	})
+}
+
+func (s *BreakerStore) EnsureTokenRow(ctx context.Context, row *TokenDBRow) error {
+	return s.call(ctx, func() error {
+		return s.store.EnsureTokenRow(ctx, row)
+	})
+}
+
+func (s *BreakerStore) RefillTokenRow(ctx context.Context, teamID string, balance, observed int64, balances map[string]int64, usage map[int]int, reputation, nowMs int64) error {
+	return s.call(ctx, func() error {
+		return s.store.RefillTokenRow(ctx, teamID, balance, observed, balances, usage, reputation, nowMs)
+	})
+}
+
+func (s *BreakerStore) DripTokenRow(ctx context.Context, teamID string, credit, observedMs, refillMs int64) error {
+	return s.call(ctx, func() error {
+		return s.store.DripTokenRow(ctx, teamID, credit, observedMs, refillMs)
+	})
+}
+
+func (s *BreakerStore) CreateTokenRow(ctx context.Context, row *TokenDBRow) error {
+	return s.call(ctx, func() error {
+		return s.store.CreateTokenRow(ctx, row)
+	})
+}
+
+func (s *BreakerStore) SetTeamStatus(ctx context.Context, u TeamStatusUpdate) (*TokenDBRow, error) {
+	return breakerValue(ctx, s, func() (*TokenDBRow, error) {
+		return s.store.SetTeamStatus(ctx, u)
+	})
+}
+
+func (s *BreakerStore) DeleteTeam(ctx context.Context, teamID string, observed, nowMs int64) error {
+	return s.call(ctx, func() error {
+		return s.store.DeleteTeam(ctx, teamID, observed, nowMs)
+	})
+}
+
+func (s *BreakerStore) ScanTokenRows(ctx context.Context) ([]TokenDBRow, error) {
+	return breakerValue(ctx, s, func() ([]TokenDBRow, error) {
+		return s.store.ScanTokenRows(ctx)
+	})
+}
+
+func (s *BreakerStore) UpdateBalance(ctx context.Context, u BalanceUpdate) (*TokenDBRow, error) {
+	return breakerValue(ctx, s, func() (*TokenDBRow, error) {
+		return s.store.UpdateBalance(ctx, u)
+	})
+}
+
+func (s *BreakerStore) UpdateBalances(ctx context.Context, updates []BalanceUpdate) ([]*TokenDBRow, error) {
+	return breakerValue(ctx, s, func() ([]*TokenDBRow, error) {
+		return s.store.UpdateBalances(ctx, updates)
+	})
+}
+
+func (s *BreakerStore) CountAuctionEntry(ctx context.Context, teamID string) error {
+	return s.call(ctx, func() error {
+		return s.store.CountAuctionEntry(ctx, teamID)
+	})
+}
+
+func (s *BreakerStore) GetPacingRow(ctx context.Context, teamID string) (*PacingRow, error) {
+	return breakerValue(ctx, s, func() (*PacingRow, error) {
+		return s.store.GetPacingRow(ctx, teamID)
+	})
+}
+
+func (s *BreakerStore) AddPacedSpend(ctx context.Context, teamID string, amount, windowStartMs, limit int64) error {
+	return s.call(ctx, func() error {
+		return s.store.AddPacedSpend(ctx, teamID, amount, windowStartMs, limit)
+	})
+}
+
+func (s *BreakerStore) RollPacingWindow(ctx context.Context, teamID string, observedStartMs, windowStartMs, prevSpent, spent int64) error {
+	return s.call(ctx, func() error {
+		return s.store.RollPacingWindow(ctx, teamID, observedStartMs, windowStartMs, prevSpent, spent)
+	})
+}
+
+func (s *BreakerStore) RefundPacedSpend(ctx context.Context, teamID string, amount, windowStartMs int64) error {
+	return s.call(ctx, func() error {
+		return s.store.RefundPacedSpend(ctx, teamID, amount, windowStartMs)
+	})
+}
+
+func (s *BreakerStore) GetQuotaRow(ctx context.Context, teamID string) (*QuotaRow, error) {
+	return breakerValue(ctx, s, func() (*QuotaRow, error) {
+		return s.store.GetQuotaRow(ctx, teamID)
+	})
+}
+
+func (s *BreakerStore) AddQuotaUsage(ctx context.Context, teamID string, priority, dayStartMs int64, limit int) error {
+	return s.call(ctx, func() error {
+		return s.store.AddQuotaUsage(ctx, teamID, priority, dayStartMs, limit)
+	})
+}
+
+func (s *BreakerStore) RollQuotaDay(ctx context.Context, teamID string, observedStartMs, dayStartMs, priority int64) error {
+	return s.call(ctx, func() error {
+		return s.store.RollQuotaDay(ctx, teamID, observedStartMs, dayStartMs, priority)
+	})
+}
+
+func (s *BreakerStore) RefundQuotaUsage(ctx context.Context, teamID string, priority, dayStartMs int64) error {
+	return s.call(ctx, func() error {
+		return s.store.RefundQuotaUsage(ctx, teamID, priority, dayStartMs)
+	})
+}
+
+func (s *BreakerStore) BatchGetFrequencyRows(ctx context.Context, userID string, teamIDs []string) (map[string]FrequencyRow, error) {
+	return breakerValue(ctx, s, func() (map[string]FrequencyRow, error) {
+		return s.store.BatchGetFrequencyRows(ctx, userID, teamIDs)
+	})
+}
+
+func (s *BreakerStore) PutFrequencyRow(ctx context.Context, row *FrequencyRow) error {
+	return s.call(ctx, func() error {
+		return s.store.PutFrequencyRow(ctx, row)
+	})
+}
+
+func (s *BreakerStore) SetTokenBalance(ctx context.Context, teamID string, balance, observed, nowMs int64) error {
+	return s.call(ctx, func() error {
+		return s.store.SetTokenBalance(ctx, teamID, balance, observed, nowMs)
+	})
+}
+
+func (s *BreakerStore) AdjustReputation(ctx context.Context, e *ReputationEvent, observed *TokenDBRow, floor, ceiling int64) error {
+	return s.call(ctx, func() error {
+		return s.store.AdjustReputation(ctx, e, observed, floor, ceiling)
+	})
+}
+
+func (s *BreakerStore) RecoverReputation(ctx context.Context, teamID string, increase, ceiling, observedMs, recoveredMs int64) error {
+	return s.call(ctx, func() error {
+		return s.store.RecoverReputation(ctx, teamID, increase, ceiling, observedMs, recoveredMs)
+	})
+}
+
+func (s *BreakerStore) TransferTokens(ctx context.Context, t *TransferRow) (from, to *TokenDBRow, err error) {
+	err = s.call(ctx, func() error {
+		var err error
+		from, to, err = s.store.TransferTokens(ctx, t)
+		return err
+	})
+	return from, to, err
+}
+
+func (s *BreakerStore) AdjustBalance(ctx context.Context, a *AdjustmentRow) (*TokenDBRow, error) {
+	return breakerValue(ctx, s, func() (*TokenDBRow, error) {
+		return s.store.AdjustBalance(ctx, a)
+	})
+}
+
+func (s *BreakerStore) PlaceHold(ctx context.Context, hold *HoldRow, cooldownStartMs int64, winningBid *BidRow, reservation *HoldRow, lock *LockRef) error {
+	return s.call(ctx, func() error {
+		return s.store.PlaceHold(ctx, hold, cooldownStartMs, winningBid, reservation, lock)
+	})
+}
+
+func (s *BreakerStore) ReserveTokens(ctx context.Context, hold *HoldRow) error {
+	return s.call(ctx, func() error {
+		return s.store.ReserveTokens(ctx, hold)
+	})
+}
+
+func (s *BreakerStore) GetHold(ctx context.Context, holdID string) (*HoldRow, error) {
+	return breakerValue(ctx, s, func() (*HoldRow, error) {
+		return s.store.GetHold(ctx, holdID)
+	})
+}
+
+func (s *BreakerStore) ConfirmHold(ctx context.Context, hold *HoldRow, nowMs int64) (*TokenDBRow, error) {
+	return breakerValue(ctx, s, func() (*TokenDBRow, error) {
+		return s.store.ConfirmHold(ctx, hold, nowMs)
+	})
+}
+
+func (s *BreakerStore) ReleaseHold(ctx context.Context, hold *HoldRow, nowMs int64) error {
+	return s.call(ctx, func() error {
+		return s.store.ReleaseHold(ctx, hold, nowMs)
+	})
+}
+
+func (s *BreakerStore) ExpiredHolds(ctx context.Context, nowMs int64) ([]HoldRow, error) {
+	return breakerValue(ctx, s, func() ([]HoldRow, error) {
+		return s.store.ExpiredHolds(ctx, nowMs)
+	})
+}
+
+func (s *BreakerStore) AcquireLock(ctx context.Context, userID, owner string, nowMs, expiresAtMs int64) error {
+	return s.call(ctx, func() error {
+		return s.store.AcquireLock(ctx, userID, owner, nowMs, expiresAtMs)
+	})
+}
+
+func (s *BreakerStore) ReleaseLock(ctx context.Context, userID, owner string) error {
+	return s.call(ctx, func() error {
+		return s.store.ReleaseLock(ctx, userID, owner)
+	})
+}
+
+func (s *BreakerStore) ClaimIdempotencyKey(ctx context.Context, row *IdempotencyRow, nowMs int64) error {
+	return s.call(ctx, func() error {
+		return s.store.ClaimIdempotencyKey(ctx, row, nowMs)
+	})
+}
+
+func (s *BreakerStore) GetIdempotencyRow(ctx context.Context, key string) (*IdempotencyRow, error) {
+	return breakerValue(ctx, s, func() (*IdempotencyRow, error) {
+		return s.store.GetIdempotencyRow(ctx, key)
+	})
+}
+
+func (s *BreakerStore) PutIdempotencyRow(ctx context.Context, row *IdempotencyRow) error {
+	return s.call(ctx, func() error {
+		return s.store.PutIdempotencyRow(ctx, row)
+	})
+}
+
+func (s *BreakerStore) DeleteIdempotencyRow(ctx context.Context, key string) error {
+	return s.call(ctx, func() error {
+		return s.store.DeleteIdempotencyRow(ctx, key)
+	})
+}
+
+func (s *BreakerStore) PutBids(ctx context.Context, rows []*BidRow) error {
+	return s.call(ctx, func() error {
+		return s.store.PutBids(ctx, rows)
+	})
+}
+
+func (s *BreakerStore) MarkBidAborted(ctx context.Context, pk, sk string, nowMs int64) error {
+	return s.call(ctx, func() error {
+		return s.store.MarkBidAborted(ctx, pk, sk, nowMs)
+	})
+}
+
+func (s *BreakerStore) QueryBids(ctx context.Context, q BidQuery) ([]BidRow, error) {
+	return breakerValue(ctx, s, func() ([]BidRow, error) {
+		return s.store.QueryBids(ctx, q)
+	})
+}
+
+func (s *BreakerStore) QueryBidsByTarget(ctx context.Context, userID string) ([]BidRow, error) {
+	return breakerValue(ctx, s, func() ([]BidRow, error) {
+		return s.store.QueryBidsByTarget(ctx, userID)
+	})
+}
+
+func (s *BreakerStore) QueryExpiringBids(ctx context.Context, fromSec, toSec int64) ([]BidRow, error) {
+	return breakerValue(ctx, s, func() ([]BidRow, error) {
+		return s.store.QueryExpiringBids(ctx, fromSec, toSec)
+	})
+}
+
+func (s *BreakerStore) GetBidArchiveWatermark(ctx context.Context) (int64, error) {
+	return breakerValue(ctx, s, func() (int64, error) {
+		return s.store.GetBidArchiveWatermark(ctx)
+	})
+}
+
+func (s *BreakerStore) AdvanceBidArchiveWatermark(ctx context.Context, fromSec, toSec int64) error {
+	return s.call(ctx, func() error {
+		return s.store.AdvanceBidArchiveWatermark(ctx, fromSec, toSec)
+	})
+}
+
+func (s *BreakerStore) DeleteBids(ctx context.Context, pk string) (int, error) {
+	return breakerValue(ctx, s, func() (int, error) {
+		return s.store.DeleteBids(ctx, pk)
+	})
+}
+
+func (s *BreakerStore) PutAuctionWindow(ctx context.Context, w *AuctionWindow) error {
+	return s.call(ctx, func() error {
+		return s.store.PutAuctionWindow(ctx, w)
+	})
+}
+
+func (s *BreakerStore) GetAuctionWindow(ctx context.Context, auctionID string) (*AuctionWindow, error) {
+	return breakerValue(ctx, s, func() (*AuctionWindow, error) {
+		return s.store.GetAuctionWindow(ctx, auctionID)
+	})
+}
+
+func (s *BreakerStore) AddWindowBid(ctx context.Context, auctionID string, bid WindowBid, nowMs int64, maxBids int) error {
+	return s.call(ctx, func() error {
+		return s.store.AddWindowBid(ctx, auctionID, bid, nowMs, maxBids)
+	})
+}
+
+func (s *BreakerStore) SettleAuctionWindow(ctx context.Context, auctionID string, result *AuctionResult, nowMs int64) error {
+	return s.call(ctx, func() error {
+		return s.store.SettleAuctionWindow(ctx, auctionID, result, nowMs)
+	})
+}
+
+func (s *BreakerStore) DueAuctionWindows(ctx context.Context, nowMs int64) ([]AuctionWindow, error) {
+	return breakerValue(ctx, s, func() ([]AuctionWindow, error) {
+		return s.store.DueAuctionWindows(ctx, nowMs)
+	})
+}
+
+func (s *BreakerStore) PutDutchAuction(ctx context.Context, a *DutchAuction) error {
+	return s.call(ctx, func() error {
+		return s.store.PutDutchAuction(ctx, a)
+	})
+}
+
+func (s *BreakerStore) GetDutchAuction(ctx context.Context, auctionID string) (*DutchAuction, error) {
+	return breakerValue(ctx, s, func() (*DutchAuction, error) {
+		return s.store.GetDutchAuction(ctx, auctionID)
+	})
+}
+
+func (s *BreakerStore) ClaimDutchAuction(ctx context.Context, auctionID, teamID string, price, nowMs int64) error {
+	return s.call(ctx, func() error {
+		return s.store.ClaimDutchAuction(ctx, auctionID, teamID, price, nowMs)
+	})
+}
+
+func (s *BreakerStore) ReleaseDutchAuction(ctx context.Context, auctionID, teamID string) error {
+	return s.call(ctx, func() error {
+		return s.store.ReleaseDutchAuction(ctx, auctionID, teamID)
+	})
+}
+
+func (s *BreakerStore) PutAutoBidPolicy(ctx context.Context, p *AutoBidPolicy) error {
+	return s.call(ctx, func() error {
+		return s.store.PutAutoBidPolicy(ctx, p)
+	})
+}
+
+func (s *BreakerStore) GetAutoBidPolicy(ctx context.Context, teamID string) (*AutoBidPolicy, error) {
+	return breakerValue(ctx, s, func() (*AutoBidPolicy, error) {
+		return s.store.GetAutoBidPolicy(ctx, teamID)
+	})
+}
+
+func (s *BreakerStore) DeleteAutoBidPolicy(ctx context.Context, teamID string) error {
+	return s.call(ctx, func() error {
+		return s.store.DeleteAutoBidPolicy(ctx, teamID)
+	})
+}
+
+func (s *BreakerStore) ListAutoBidPolicies(ctx context.Context) ([]AutoBidPolicy, error) {
+	return breakerValue(ctx, s, func() ([]AutoBidPolicy, error) {
+		return s.store.ListAutoBidPolicies(ctx)
+	})
+}
+
+func (s *BreakerStore) PutWebhook(ctx context.Context, w *Webhook) error {
+	return s.call(ctx, func() error {
+		return s.store.PutWebhook(ctx, w)
+	})
+}
+
+func (s *BreakerStore) GetWebhook(ctx context.Context, teamID string) (*Webhook, error) {
+	return breakerValue(ctx, s, func() (*Webhook, error) {
+		return s.store.GetWebhook(ctx, teamID)
+	})
+}
+
+func (s *BreakerStore) DeleteWebhook(ctx context.Context, teamID string) error {
+	return s.call(ctx, func() error {
+		return s.store.DeleteWebhook(ctx, teamID)
+	})
+}
+
+func (s *BreakerStore) PutWebhookDeadLetter(ctx context.Context, d *WebhookDeadLetter) error {
+	return s.call(ctx, func() error {
+		return s.store.PutWebhookDeadLetter(ctx, d)
+	})
+}
+
+func (s *BreakerStore) QueryWebhookDeadLetters(ctx context.Context, teamID string) ([]WebhookDeadLetter, error) {
+	return breakerValue(ctx, s, func() ([]WebhookDeadLetter, error) {
+		return s.store.QueryWebhookDeadLetters(ctx, teamID)
+	})
+}
+
+func (s *BreakerStore) PutTeamStats(ctx context.Context, stats []TeamStats) error {
+	return s.call(ctx, func() error {
+		return s.store.PutTeamStats(ctx, stats)
+	})
+}
+
+func (s *BreakerStore) GetTeamStats(ctx context.Context, teamID string) (*TeamStats, error) {
+	return breakerValue(ctx, s, func() (*TeamStats, error) {
+		return s.store.GetTeamStats(ctx, teamID)
+	})
+}
+
+func (s *BreakerStore) ScanTeamStats(ctx context.Context) ([]TeamStats, error) {
+	return breakerValue(ctx, s, func() ([]TeamStats, error) {
+		return s.store.ScanTeamStats(ctx)
+	})
+}
+
+func (s *BreakerStore) PutAuction(ctx context.Context, row *AuctionRow) error {
+	return s.call(ctx, func() error {
+		return s.store.PutAuction(ctx, row)
+	})
+}
+
+func (s *BreakerStore) QueryAuctions(ctx context.Context, userID string) ([]AuctionRow, error) {
+	return breakerValue(ctx, s, func() ([]AuctionRow, error) {
+		return s.store.QueryAuctions(ctx, userID)
+	})
+}
+
+func (s *BreakerStore) PutAuctionAudit(ctx context.Context, a *AuctionAudit) error {
+	return s.call(ctx, func() error {
+		return s.store.PutAuctionAudit(ctx, a)
+	})
+}
+
+func (s *BreakerStore) GetAuctionAudit(ctx context.Context, auctionID string) (*AuctionAudit, error) {
+	return breakerValue(ctx, s, func() (*AuctionAudit, error) {
+		return s.store.GetAuctionAudit(ctx, auctionID)
+	})
+}
+
+func (s *BreakerStore) PutBalanceSnapshot(ctx context.Context, snapshot *BalanceSnapshot) error {
+	return s.call(ctx, func() error {
+		return s.store.PutBalanceSnapshot(ctx, snapshot)
+	})
+}
+
+func (s *BreakerStore) QueryBalanceSnapshots(ctx context.Context, teamID string, startMs, endMs int64) ([]BalanceSnapshot, error) {
+	return breakerValue(ctx, s, func() ([]BalanceSnapshot, error) {
+		return s.store.QueryBalanceSnapshots(ctx, teamID, startMs, endMs)
+	})
+}
+
+func (s *BreakerStore) QueryLedger(ctx context.Context, teamID string, startMs, endMs int64) ([]LedgerEntry, error) {
+	return breakerValue(ctx, s, func() ([]LedgerEntry, error) {
+		return s.store.QueryLedger(ctx, teamID, startMs, endMs)
+	})
+}
@@ -0,0 +1,68 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// flakyStore fails every token row read with err while it is set.
+type flakyStore struct {
+	Store
+	err   error
+	calls int
+	// onCall runs after every read, e.g. to advance a clock.
+	onCall func()
+}
+
+func (s *flakyStore) GetTokenRow(ctx context.Context, teamID string, consistent bool) (*TokenDBRow, error) {
+	s.calls++
+	if s.onCall != nil {
+		s.onCall()
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.Store.GetTokenRow(ctx, teamID, consistent)
+}
+
+func TestBreakerStoreCooldown(t *testing.T) {
+	ctx := context.Background()
+	clock := newTestClock()
+	mem := NewMemoryStore()
+	if err := mem.EnsureTokenRow(ctx, &TokenDBRow{Pk: GetTokenPK("a"), TeamID: "a"}); err != nil {
+		t.Fatalf("EnsureTokenRow: %v", err)
+	}
+	// the way an unreachable store fails
+	flaky := &flakyStore{Store: mem, err: &net.OpError{Op: "read", Err: errors.New("connection reset")}}
+	s := NewBreakerStore(flaky, BreakerConfig{Threshold: 1, Cooldown: time.Minute}, nil, WithStoreClock(clock))
+
+	if _, err := s.GetTokenRow(ctx, "a", true); err == nil {
+		t.Fatal("GetTokenRow of a failing store succeeded")
+	}
+	if got := s.State(); got != BreakerOpen {
+		t.Fatalf("state = %v after a failure, want open", got)
+	}
+
+	flaky.err = nil
+	clock.Advance(time.Minute - time.Millisecond)
+	if _, err := s.GetTokenRow(ctx, "a", true); !errors.Is(err, ErrStoreUnavailable) {
+		t.Fatalf("GetTokenRow = %v within the cooldown, want ErrStoreUnavailable", err)
+	}
+
+	clock.Advance(time.Millisecond)
+	if got := s.State(); got != BreakerHalfOpen {
+		t.Fatalf("state = %v after the cooldown, want half-open", got)
+	}
+	if _, err := s.GetTokenRow(ctx, "a", true); err != nil {
+		t.Fatalf("probe GetTokenRow: %v", err)
+	}
+	if got := s.State(); got != BreakerClosed {
+		t.Errorf("state = %v after a successful probe, want closed", got)
+	}
+	if flaky.calls != 2 {
+		t.Errorf("store called %d times, want 2", flaky.calls)
+	}
+}
@@ -0,0 +1,17 @@
+package tokens
+
+import "time"
+
+// Clock tells the Manager the time. Every timestamp it records (bids,
+// refills, cooldowns, holds, windows) comes from its Clock, so a fake one
+// makes time-dependent behavior reproducible; see WithClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the default Clock, the wall clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
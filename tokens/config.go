@@ -0,0 +1,458 @@
+package tokens
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/exp/rand"
+
+	"github.com/christopherwong-hinge/auction/events"
+)
+
+// DefaultEndpoint is LocalStack's default endpoint, used by WithLocalStack
+// when no other is configured.
+const DefaultEndpoint = "http://localhost:4566"
+
+// ProvisionedCapacity creates the tables in provisioned billing mode with
+// the given throughput, instead of on-demand. It applies to each table and
+// to the bids table's GSI.
+type ProvisionedCapacity struct {
+	ReadCapacityUnits  int64
+	WriteCapacityUnits int64
+}
+
+func (c *ProvisionedCapacity) throughput() *types.ProvisionedThroughput {
+	return &types.ProvisionedThroughput{
+		ReadCapacityUnits:  aws.Int64(c.ReadCapacityUnits),
+		WriteCapacityUnits: aws.Int64(c.WriteCapacityUnits),
+	}
+}
+
+// Config gathers every Manager setting in one place, as an alternative to
+// passing Options to NewManager. The zero value of each field keeps the
+// default; see the matching With* option for what each field does.
+type Config struct {
+	// Endpoint is the DynamoDB endpoint; see WithEndpoint.
+	Endpoint string
+	// LocalStack talks to LocalStack with its static credentials; see
+	// WithLocalStack.
+	LocalStack bool
+	// DynamoClient replaces the client for Endpoint; see WithDynamoClient.
+	DynamoClient *dynamodb.Client
+	// TableNames names the tables; see WithTableNames.
+	TableNames TableNames
+	// TableSuffix is appended to every default table name.
+	TableSuffix string
+	// LowercaseIDs lowercases team and user IDs; see WithLowercaseIDs.
+	LowercaseIDs bool
+	// Logger receives the Manager's logs; see WithLogger.
+	Logger *zap.Logger
+	// Clock defaults to the system clock; see WithClock.
+	Clock Clock
+	// RandSource seeds every random decision; see WithRandSource.
+	RandSource rand.Source
+	// Store replaces the DynamoDB store; see WithStore.
+	Store Store
+
+	// ProvisionedCapacity is nil for on-demand tables.
+	ProvisionedCapacity *ProvisionedCapacity
+	SkipTableCreation   bool
+
+	// MaxBidsPerAuction defaults to DefaultMaxBidsPerAuction.
+	MaxBidsPerAuction int
+	// BalanceFetchParallelism defaults to DefaultBalanceFetchParallelism.
+	BalanceFetchParallelism int
+	// MaxPriority defaults to MaxPriority.
+	MaxPriority int64
+	// MaxReputation defaults to MaxReputationScore.
+	MaxReputation int64
+	// ReputationPenalty defaults to DefaultReputationPenalty.
+	ReputationPenalty *ReputationPenalty
+	ReputationReward  ReputationReward
+	ReputationFloor   int64
+	CostTiers         []CostTier
+	// CostMap defaults to the built-in priority to base cost map.
+	CostMap map[int64]int64
+	// InitialTokenCount defaults to InitialTokenCount.
+	InitialTokenCount int64
+	// ScoreWeights defaults to DefaultScoreWeights.
+	ScoreWeights     *ScoreWeights
+	TeamScoreWeights map[string]ScoreWeights
+	// Scorer replaces the default score; see WithScorer.
+	Scorer          Scorer
+	WinCooldown     time.Duration
+	AuctionStrategy AuctionStrategy
+	TieBreak        TieBreak
+	// BidValidation checks bids before they are scored; see
+	// WithBidValidation.
+	BidValidation BidValidation
+	// AuctionLockTTL defaults to DefaultAuctionLockTTL.
+	AuctionLockTTL time.Duration
+	// IdempotencyTTL defaults to DefaultIdempotencyTTL.
+	IdempotencyTTL time.Duration
+	WinnerVeto     WinnerVeto
+	// BidShards enables bid partition sharding; see WithBidShards.
+	BidShards int
+
+	// DisableChargeFallback fails an auction whose winner can't be charged
+	// rather than moving on to the next bid; see WithChargeFallback.
+	DisableChargeFallback bool
+	BalanceHistory        bool
+	ConsistencyTimeout    time.Duration
+	AllowTruncate         bool
+
+	BidBuffer  *BidBufferConfig
+	DripRefill *DripRefill
+	// BudgetPacing caps how fast teams spend; see WithBudgetPacing.
+	BudgetPacing *BudgetPacing
+	// PriorityQuotas caps daily spends per priority; see
+	// WithPriorityQuotas.
+	PriorityQuotas *PriorityQuotas
+	// FrequencyCap limits wins per team and user; see WithFrequencyCap.
+	FrequencyCap *FrequencyCap
+	// Currencies adds token currencies by name; see WithCurrencies.
+	Currencies map[string]Currency
+	// WindowSettlementInterval is how often to settle due auction windows;
+	// see WithWindowSettlement.
+	WindowSettlementInterval time.Duration
+	// LedgerReconcileInterval is how often to check balances against the
+	// ledger; see WithLedgerReconcile.
+	LedgerReconcileInterval time.Duration
+	// StatsInterval is how often to compute team stats; see
+	// WithStatsAggregation.
+	StatsInterval time.Duration
+	// BidRetention is how long bids are kept; see WithBidRetention.
+	BidRetention time.Duration
+	// BidArchiver and BidArchiveInterval archive bids before they expire;
+	// see WithBidArchiver.
+	BidArchiver        BidArchiver
+	BidArchiveInterval time.Duration
+	// ReputationRecovery regenerates reputation over time; see
+	// WithReputationRecovery.
+	ReputationRecovery *ReputationRecovery
+	DecisionLog        io.Writer
+	ReputationLog      io.Writer
+	// Retry retries the store's transient failures; see WithRetry.
+	Retry *RetryConfig
+	// CircuitBreaker fails store calls fast while the store is unhealthy;
+	// see WithCircuitBreaker.
+	CircuitBreaker *BreakerConfig
+	// DegradedMode keeps auctions running while the circuit breaker is
+	// open; see WithDegradedMode. It needs CircuitBreaker.
+	DegradedMode *DegradedConfig
+	// Webhooks notifies teams of auction outcomes; see WithWebhooks.
+	Webhooks *WebhookConfig
+	// EventPublisher receives the Manager's events; see WithEventPublisher.
+	EventPublisher events.Publisher
+	// SettlementPublisher receives an AuctionSettled for every settled
+	// auction; see WithSettlementPublisher.
+	SettlementPublisher events.Publisher
+	Metrics             *Metrics
+	Tracer              trace.Tracer
+}
+
+// validate rejects settings that are out of range or inconsistent with each
+// other.
+func (cfg Config) validate() error {
+	if c := cfg.ProvisionedCapacity; c != nil && (c.ReadCapacityUnits <= 0 || c.WriteCapacityUnits <= 0) {
+		return fmt.Errorf("%w: provisioned capacity requires positive read and write capacity units", ErrInvalidConfig)
+	}
+	if cfg.MaxBidsPerAuction < 0 {
+		return fmt.Errorf("%w: negative max bids per auction", ErrInvalidConfig)
+	}
+	if cfg.BalanceFetchParallelism < 0 {
+		return fmt.Errorf("%w: negative balance fetch parallelism", ErrInvalidConfig)
+	}
+	if cfg.BidShards < 0 {
+		return fmt.Errorf("%w: negative bid shard count", ErrInvalidConfig)
+	}
+	if cfg.MaxPriority < 0 {
+		return fmt.Errorf("%w: negative max priority", ErrInvalidConfig)
+	}
+	if cfg.MaxPriority > MaxPriority && len(cfg.CostTiers) == 0 && cfg.CostMap == nil {
+		return fmt.Errorf("%w: max priority above %d requires cost tiers or a cost map", ErrInvalidConfig, MaxPriority)
+	}
+	if len(cfg.CostTiers) == 0 && cfg.CostMap != nil {
+		maxPriority := cfg.MaxPriority
+		if maxPriority == 0 {
+			maxPriority = MaxPriority
+		}
+		if err := validateCostMap(cfg.CostMap, maxPriority); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+	if cfg.InitialTokenCount < 0 {
+		return fmt.Errorf("%w: negative initial token count", ErrInvalidConfig)
+	}
+	if w := cfg.ScoreWeights; w != nil && (w.Priority < 0 || w.Reputation < 0) {
+		return fmt.Errorf("%w: negative score weight", ErrInvalidConfig)
+	}
+	if cfg.AuctionStrategy != FirstPrice && cfg.AuctionStrategy != SecondPrice {
+		return fmt.Errorf("%w: unknown auction strategy %d", ErrInvalidConfig, cfg.AuctionStrategy)
+	}
+	if cfg.TieBreak < TieBreakReputation || cfg.TieBreak > TieBreakEarliest {
+		return fmt.Errorf("%w: unknown tie break %d", ErrInvalidConfig, cfg.TieBreak)
+	}
+	if d := cfg.BidValidation.Duplicates; d < DuplicateBidsCollapse || d > DuplicateBidsReject {
+		return fmt.Errorf("%w: unknown duplicate bid policy %d", ErrInvalidConfig, d)
+	}
+	if cfg.MaxReputation < 0 {
+		return fmt.Errorf("%w: negative max reputation", ErrInvalidConfig)
+	}
+	if cfg.WinCooldown < 0 || cfg.ConsistencyTimeout < 0 || cfg.AuctionLockTTL < 0 || cfg.IdempotencyTTL < 0 ||
+		cfg.WindowSettlementInterval < 0 || cfg.LedgerReconcileInterval < 0 || cfg.StatsInterval < 0 || cfg.BidRetention < 0 || cfg.BidArchiveInterval < 0 {
+		return fmt.Errorf("%w: negative duration", ErrInvalidConfig)
+	}
+	if cfg.DegradedMode != nil && cfg.CircuitBreaker == nil {
+		return fmt.Errorf("%w: degraded mode needs a circuit breaker", ErrInvalidConfig)
+	}
+	if cfg.BidArchiver != nil && cfg.BidRetention == 0 {
+		return fmt.Errorf("%w: a bid archiver needs a bid retention", ErrInvalidConfig)
+	}
+	if cfg.BidArchiver != nil && cfg.BidArchiveInterval > 0 && cfg.BidRetention <= 2*cfg.BidArchiveInterval {
+		return fmt.Errorf("%w: bid retention must be more than twice the bid archive interval", ErrInvalidConfig)
+	}
+	if b := cfg.BidBuffer; b != nil && b.MaxSize <= 0 && b.FlushInterval <= 0 {
+		return fmt.Errorf("%w: bid buffer needs a max size or a flush interval", ErrInvalidConfig)
+	}
+	if d := cfg.DripRefill; d != nil && (d.Interval <= 0 || d.Amount <= 0 || d.Cap < 0 || d.ScheduleInterval < 0) {
+		return fmt.Errorf("%w: drip refill needs a positive interval and amount", ErrInvalidConfig)
+	}
+	if p := cfg.BudgetPacing; p != nil {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+	if f := cfg.FrequencyCap; f != nil {
+		if err := f.validate(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+	if q := cfg.PriorityQuotas; q != nil {
+		maxPriority := cfg.MaxPriority
+		if maxPriority == 0 {
+			maxPriority = MaxPriority
+		}
+		if err := q.validate(maxPriority); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+	for name, c := range cfg.Currencies {
+		maxPriority := cfg.MaxPriority
+		if maxPriority == 0 {
+			maxPriority = MaxPriority
+		}
+		if err := c.validate(name, maxPriority); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+	if cfg.ReputationFloor < 0 {
+		return fmt.Errorf("%w: negative reputation floor", ErrInvalidConfig)
+	}
+	if r := cfg.ReputationRecovery; r != nil && (r.Interval <= 0 || r.Amount <= 0 || r.Cap < 0) {
+		return fmt.Errorf("%w: reputation recovery needs a positive interval and amount", ErrInvalidConfig)
+	}
+	if r := cfg.ReputationReward; r.Amount > 0 && (r.Threshold <= 0 || len(r.Priorities) == 0) {
+		return fmt.Errorf("%w: reputation reward needs priorities and a threshold", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// options translates cfg into the equivalent Options, skipping zero fields
+// so NewManager's defaults apply.
+func (cfg Config) options() []Option {
+	var opts []Option
+	if cfg.Endpoint != "" {
+		opts = append(opts, WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.LocalStack {
+		opts = append(opts, WithLocalStack())
+	}
+	if cfg.DynamoClient != nil {
+		opts = append(opts, WithDynamoClient(cfg.DynamoClient))
+	}
+	if cfg.TableNames != (TableNames{}) {
+		opts = append(opts, WithTableNames(cfg.TableNames))
+	}
+	if cfg.TableSuffix != "" {
+		opts = append(opts, WithTableSuffix(cfg.TableSuffix))
+	}
+	if cfg.LowercaseIDs {
+		opts = append(opts, WithLowercaseIDs(true))
+	}
+	if cfg.Logger != nil {
+		opts = append(opts, WithLogger(cfg.Logger))
+	}
+	if cfg.Clock != nil {
+		opts = append(opts, WithClock(cfg.Clock))
+	}
+	if cfg.RandSource != nil {
+		opts = append(opts, WithRandSource(cfg.RandSource))
+	}
+	if cfg.Store != nil {
+		opts = append(opts, WithStore(cfg.Store))
+	}
+	if cfg.ProvisionedCapacity != nil {
+		opts = append(opts, WithProvisionedCapacity(*cfg.ProvisionedCapacity))
+	}
+	if cfg.SkipTableCreation {
+		opts = append(opts, WithSkipTableCreation(true))
+	}
+	if cfg.MaxBidsPerAuction > 0 {
+		opts = append(opts, WithMaxBidsPerAuction(cfg.MaxBidsPerAuction))
+	}
+	if cfg.BalanceFetchParallelism > 0 {
+		opts = append(opts, WithBalanceFetchParallelism(cfg.BalanceFetchParallelism))
+	}
+	if cfg.MaxPriority > 0 {
+		opts = append(opts, WithMaxPriority(cfg.MaxPriority))
+	}
+	if cfg.MaxReputation > 0 {
+		opts = append(opts, WithMaxReputation(cfg.MaxReputation))
+	}
+	if cfg.ReputationPenalty != nil {
+		opts = append(opts, WithReputationPenalty(*cfg.ReputationPenalty))
+	}
+	if cfg.ReputationReward.enabled() {
+		opts = append(opts, WithReputationReward(cfg.ReputationReward))
+	}
+	if cfg.CostTiers != nil {
+		opts = append(opts, WithCostTiers(cfg.CostTiers))
+	}
+	if cfg.CostMap != nil {
+		opts = append(opts, WithCostMap(cfg.CostMap))
+	}
+	if cfg.InitialTokenCount > 0 {
+		opts = append(opts, WithInitialTokenCount(cfg.InitialTokenCount))
+	}
+	if cfg.ScoreWeights != nil {
+		opts = append(opts, WithScoreWeights(*cfg.ScoreWeights))
+	}
+	if cfg.TeamScoreWeights != nil {
+		opts = append(opts, WithTeamScoreWeights(cfg.TeamScoreWeights))
+	}
+	if cfg.Scorer != nil {
+		opts = append(opts, WithScorer(cfg.Scorer))
+	}
+	if cfg.AuctionLockTTL > 0 {
+		opts = append(opts, WithAuctionLockTTL(cfg.AuctionLockTTL))
+	}
+	if cfg.IdempotencyTTL > 0 {
+		opts = append(opts, WithIdempotencyTTL(cfg.IdempotencyTTL))
+	}
+	if cfg.AuctionStrategy != FirstPrice {
+		opts = append(opts, WithAuctionStrategy(cfg.AuctionStrategy))
+	}
+	if cfg.TieBreak != TieBreakReputation {
+		opts = append(opts, WithTieBreak(cfg.TieBreak))
+	}
+	if cfg.BidValidation != (BidValidation{}) {
+		opts = append(opts, WithBidValidation(cfg.BidValidation))
+	}
+	if cfg.WinCooldown > 0 {
+		opts = append(opts, WithWinCooldown(cfg.WinCooldown))
+	}
+	if cfg.BidShards > 1 {
+		opts = append(opts, WithBidShards(cfg.BidShards))
+	}
+	if cfg.WinnerVeto != nil {
+		opts = append(opts, WithWinnerVeto(cfg.WinnerVeto))
+	}
+	if cfg.BalanceHistory {
+		opts = append(opts, WithBalanceHistory(true))
+	}
+	if cfg.DisableChargeFallback {
+		opts = append(opts, WithChargeFallback(false))
+	}
+	if cfg.ConsistencyTimeout > 0 {
+		opts = append(opts, WithWaitForConsistency(cfg.ConsistencyTimeout))
+	}
+	if cfg.AllowTruncate {
+		opts = append(opts, WithTruncateAll())
+	}
+	if cfg.BidBuffer != nil {
+		opts = append(opts, WithBidBuffer(*cfg.BidBuffer))
+	}
+	if cfg.DripRefill != nil {
+		opts = append(opts, WithDripRefill(*cfg.DripRefill))
+	}
+	if cfg.BudgetPacing != nil {
+		opts = append(opts, WithBudgetPacing(*cfg.BudgetPacing))
+	}
+	if cfg.PriorityQuotas != nil {
+		opts = append(opts, WithPriorityQuotas(*cfg.PriorityQuotas))
+	}
+	if cfg.FrequencyCap != nil {
+		opts = append(opts, WithFrequencyCap(*cfg.FrequencyCap))
+	}
+	if cfg.Currencies != nil {
+		opts = append(opts, WithCurrencies(cfg.Currencies))
+	}
+	if cfg.WindowSettlementInterval > 0 {
+		opts = append(opts, WithWindowSettlement(cfg.WindowSettlementInterval))
+	}
+	if cfg.LedgerReconcileInterval > 0 {
+		opts = append(opts, WithLedgerReconcile(cfg.LedgerReconcileInterval))
+	}
+	if cfg.StatsInterval > 0 {
+		opts = append(opts, WithStatsAggregation(cfg.StatsInterval))
+	}
+	if cfg.BidRetention > 0 {
+		opts = append(opts, WithBidRetention(cfg.BidRetention))
+	}
+	if cfg.BidArchiver != nil {
+		opts = append(opts, WithBidArchiver(cfg.BidArchiver, cfg.BidArchiveInterval))
+	}
+	if cfg.ReputationFloor > 0 {
+		opts = append(opts, WithReputationFloor(cfg.ReputationFloor))
+	}
+	if cfg.ReputationRecovery != nil {
+		opts = append(opts, WithReputationRecovery(*cfg.ReputationRecovery))
+	}
+	if cfg.DecisionLog != nil {
+		opts = append(opts, WithDecisionLog(cfg.DecisionLog))
+	}
+	if cfg.ReputationLog != nil {
+		opts = append(opts, WithReputationLog(cfg.ReputationLog))
+	}
+	if cfg.Retry != nil {
+		opts = append(opts, WithRetry(*cfg.Retry))
+	}
+	if cfg.CircuitBreaker != nil {
+		opts = append(opts, WithCircuitBreaker(*cfg.CircuitBreaker))
+	}
+	if cfg.DegradedMode != nil {
+		opts = append(opts, WithDegradedMode(*cfg.DegradedMode))
+	}
+	if cfg.Webhooks != nil {
+		opts = append(opts, WithWebhooks(*cfg.Webhooks))
+	}
+	if cfg.EventPublisher != nil {
+		opts = append(opts, WithEventPublisher(cfg.EventPublisher))
+	}
+	if cfg.SettlementPublisher != nil {
+		opts = append(opts, WithSettlementPublisher(cfg.SettlementPublisher))
+	}
+	if cfg.Metrics != nil {
+		opts = append(opts, WithMetrics(cfg.Metrics))
+	}
+	if cfg.Tracer != nil {
+		opts = append(opts, WithTracer(cfg.Tracer))
+	}
+	return opts
+}
+
+// NewManagerFromConfig validates cfg and creates a Manager from it. Invalid
+// or inconsistent settings are rejected with ErrInvalidConfig.
+func NewManagerFromConfig(cfg Config) (*Manager, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return NewManager(cfg.options()...)
+}
@@ -0,0 +1,111 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewManagerFromConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{name: "defaults"},
+		{name: "negative max bids per auction", cfg: Config{MaxBidsPerAuction: -1}, wantErr: ErrInvalidConfig},
+		{name: "negative duration", cfg: Config{WinCooldown: -time.Second}, wantErr: ErrInvalidConfig},
+		{name: "unknown strategy", cfg: Config{AuctionStrategy: AuctionStrategy(99)}, wantErr: ErrInvalidConfig},
+		{name: "unknown tie break", cfg: Config{TieBreak: TieBreak(99)}, wantErr: ErrInvalidConfig},
+		{
+			name:    "max priority above the default cost map",
+			cfg:     Config{MaxPriority: MaxPriority + 1},
+			wantErr: ErrInvalidConfig,
+		},
+		{
+			name:    "cost map missing a priority",
+			cfg:     Config{CostMap: map[int64]int64{1: 1}},
+			wantErr: ErrInvalidConfig,
+		},
+		{
+			name:    "degraded mode without a circuit breaker",
+			cfg:     Config{DegradedMode: &DegradedConfig{}},
+			wantErr: ErrInvalidConfig,
+		},
+		{
+			name:    "empty bid buffer",
+			cfg:     Config{BidBuffer: &BidBufferConfig{}},
+			wantErr: ErrInvalidConfig,
+		},
+		{
+			name:    "bid retention within two archive intervals",
+			cfg:     Config{BidRetention: 2 * time.Hour, BidArchiver: &recordingArchiver{}, BidArchiveInterval: time.Hour},
+			wantErr: ErrInvalidConfig,
+		},
+		{
+			name: "bid retention past two archive intervals",
+			cfg:  Config{BidRetention: 3 * time.Hour, BidArchiver: &recordingArchiver{}, BidArchiveInterval: time.Hour},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Store = NewMemoryStore()
+
+			tm, err := NewManagerFromConfig(tt.cfg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NewManagerFromConfig = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				tm.Close()
+			}
+		})
+	}
+}
+
+func TestNewManagerFromConfigOptions(t *testing.T) {
+	ctx := context.Background()
+	tm, err := NewManagerFromConfig(Config{
+		Store:             NewMemoryStore(),
+		Clock:             newTestClock(),
+		InitialTokenCount: 50,
+		MaxBidsPerAuction: 1,
+	})
+	if err != nil {
+		t.Fatalf("NewManagerFromConfig: %v", err)
+	}
+	defer tm.Close()
+	if err := tm.InitializeTokens(ctx, []string{"a", "b"}); err != nil {
+		t.Fatalf("InitializeTokens: %v", err)
+	}
+
+	if balance, _, err := tm.GetTokenBalance(ctx, "a"); err != nil || balance != 50 {
+		t.Errorf("GetTokenBalance = %d, %v, want the configured 50", balance, err)
+	}
+	_, err = tm.RunAuction(ctx, []Bid{
+		{TeamID: "a", UserID: "u", Priority: 1},
+		{TeamID: "b", UserID: "u", Priority: 1},
+	})
+	if !errors.Is(err, ErrTooManyBids) {
+		t.Errorf("RunAuction = %v, want %v past the configured max bids", err, ErrTooManyBids)
+	}
+}
+
+func TestLoadConfigLocalStack(t *testing.T) {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.LocalStack || cfg.Endpoint != "" {
+		t.Errorf("default config has LocalStack %v and endpoint %q, want the SDK's defaults", cfg.LocalStack, cfg.Endpoint)
+	}
+
+	t.Setenv("AUCTION_LOCALSTACK", "true")
+	cfg, err = LoadConfig("")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if !cfg.LocalStack {
+		t.Error("AUCTION_LOCALSTACK=true didn't opt into LocalStack")
+	}
+}
@@ -0,0 +1,481 @@
+package tokens
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/rand"
+)
+
+// ConfigEnvPrefix prefixes the environment variables read by LoadConfig.
+const ConfigEnvPrefix = "AUCTION_"
+
+// fileConfig is the subset of Config that LoadConfig reads: the settings that
+// tune the token economy, plus where the tables live.
+type fileConfig struct {
+	Endpoint                string                  `json:"endpoint"`
+	LocalStack              bool                    `json:"localstack"`
+	TableNames              TableNames              `json:"table_names"`
+	TableSuffix             string                  `json:"table_suffix"`
+	LowercaseIDs            bool                    `json:"lowercase_ids"`
+	MaxBidsPerAuction       int                     `json:"max_bids_per_auction"`
+	BalanceFetchParallelism int                     `json:"balance_fetch_parallelism"`
+	MaxPriority             int64                   `json:"max_priority"`
+	MaxReputation           int64                   `json:"max_reputation"`
+	InitialTokenCount       int64                   `json:"initial_token_count"`
+	CostMap                 map[int64]int64         `json:"cost_map"`
+	CostTiers               []CostTier              `json:"cost_tiers"`
+	ReputationPenalty       *ReputationPenalty      `json:"reputation_penalty"`
+	ReputationReward        ReputationReward        `json:"reputation_reward"`
+	ReputationFloor         int64                   `json:"reputation_floor"`
+	ScoreWeights            *ScoreWeights           `json:"score_weights"`
+	TeamScoreWeights        map[string]ScoreWeights `json:"team_score_weights"`
+	// WinCooldown is a time.ParseDuration string, e.g. "30s".
+	WinCooldown string `json:"win_cooldown"`
+	// AuctionStrategy is "first_price" or "second_price".
+	AuctionStrategy string `json:"auction_strategy"`
+	// TieBreak is "reputation", "random", "win_rate" or "earliest".
+	TieBreak      string             `json:"tie_break"`
+	BidValidation *fileBidValidation `json:"bid_validation"`
+	BidShards     int                `json:"bid_shards"`
+	// RandSeed, if set, seeds the Manager's random decisions so a run can
+	// be reproduced.
+	RandSeed *uint64 `json:"rand_seed"`
+	// DripRefill's durations are time.ParseDuration strings too.
+	DripRefill *fileDripRefill `json:"drip_refill"`
+	// BudgetPacing's window is a time.ParseDuration string too.
+	BudgetPacing *fileBudgetPacing `json:"budget_pacing"`
+	// PriorityQuotas' time zone is an IANA name, e.g. "America/New_York".
+	PriorityQuotas *filePriorityQuotas `json:"priority_quotas"`
+	// FrequencyCap's window is a time.ParseDuration string too.
+	FrequencyCap *fileFrequencyCap   `json:"frequency_cap"`
+	Currencies   map[string]Currency `json:"currencies"`
+	// WindowSettlementInterval is a time.ParseDuration string.
+	WindowSettlementInterval string `json:"window_settlement_interval"`
+	// LedgerReconcileInterval is a time.ParseDuration string.
+	LedgerReconcileInterval string `json:"ledger_reconcile_interval"`
+	// StatsInterval is a time.ParseDuration string.
+	StatsInterval string `json:"stats_interval"`
+	// BidRetention is a time.ParseDuration string.
+	BidRetention string `json:"bid_retention"`
+	// ReputationRecovery's interval is a time.ParseDuration string.
+	ReputationRecovery *fileReputationRecovery `json:"reputation_recovery"`
+	// Retry's durations are time.ParseDuration strings too.
+	Retry *fileRetry `json:"retry"`
+	// CircuitBreaker's cooldown is a time.ParseDuration string.
+	CircuitBreaker *fileCircuitBreaker `json:"circuit_breaker"`
+	// DegradedMode's durations are time.ParseDuration strings too.
+	DegradedMode *fileDegradedMode `json:"degraded_mode"`
+	// Webhooks' durations are time.ParseDuration strings too.
+	Webhooks *fileWebhooks `json:"webhooks"`
+}
+
+type fileBidValidation struct {
+	// Duplicates is "collapse" or "reject".
+	Duplicates  string `json:"duplicates"`
+	DropInvalid bool   `json:"drop_invalid"`
+}
+
+type fileRetry struct {
+	MaxAttempts    int    `json:"max_attempts"`
+	InitialBackoff string `json:"initial_backoff"`
+	MaxBackoff     string `json:"max_backoff"`
+	Budget         string `json:"budget"`
+}
+
+type fileCircuitBreaker struct {
+	Threshold int    `json:"threshold"`
+	Cooldown  string `json:"cooldown"`
+}
+
+type fileDegradedMode struct {
+	MaxPending     int    `json:"max_pending"`
+	SettleInterval string `json:"settle_interval"`
+	MaxStaleness   string `json:"max_staleness"`
+}
+
+type fileWebhooks struct {
+	MaxAttempts    int    `json:"max_attempts"`
+	InitialBackoff string `json:"initial_backoff"`
+	MaxBackoff     string `json:"max_backoff"`
+	Timeout        string `json:"timeout"`
+	Workers        int    `json:"workers"`
+	QueueSize      int    `json:"queue_size"`
+}
+
+type fileReputationRecovery struct {
+	Interval string `json:"interval"`
+	Amount   int64  `json:"amount"`
+	Cap      int64  `json:"cap"`
+}
+
+type fileBudgetPacing struct {
+	Window   string           `json:"window"`
+	Cap      int64            `json:"cap"`
+	TeamCaps map[string]int64 `json:"team_caps"`
+}
+
+type filePriorityQuotas struct {
+	TimeZone string              `json:"time_zone"`
+	Quotas   []filePriorityQuota `json:"quotas"`
+}
+
+type filePriorityQuota struct {
+	Priority int64 `json:"priority"`
+	DailyCap int   `json:"daily_cap"`
+	// Action is "block", "surcharge" or "penalize".
+	Action    string           `json:"action"`
+	Surcharge float64          `json:"surcharge"`
+	Penalty   GraduatedPenalty `json:"penalty"`
+}
+
+type fileFrequencyCap struct {
+	MaxWins int    `json:"max_wins"`
+	Window  string `json:"window"`
+}
+
+type fileDripRefill struct {
+	Interval         string `json:"interval"`
+	Amount           int64  `json:"amount"`
+	Cap              int64  `json:"cap"`
+	ScheduleInterval string `json:"schedule_interval"`
+}
+
+// LoadConfig reads a Config from the JSON file at path, if path is not empty,
+// then applies overrides from the environment. Since JSON is a subset of
+// YAML, the file may also be YAML written in flow style.
+//
+// Each file key can be overridden by the environment variable named after it,
+// uppercased and prefixed with ConfigEnvPrefix, e.g. AUCTION_ENDPOINT or
+// AUCTION_INITIAL_TOKEN_COUNT. Values of string keys are taken as is; all
+// others are parsed as JSON, e.g.
+//
+//	AUCTION_COST_MAP='{"1": 1, "2": 2, ...}'
+//	AUCTION_SCORE_WEIGHTS='{"priority": 0.6, "reputation": 0.4}'
+//
+// Unknown keys are rejected. Settings that can't be written down, such as
+// the logger or a store, are left for the caller to set on the returned
+// Config before passing it to NewManagerFromConfig.
+func LoadConfig(path string) (Config, error) {
+	raw := make(map[string]json.RawMessage)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("error reading config file: %v", err)
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return Config{}, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+		}
+	}
+
+	if err := applyConfigEnv(raw); err != nil {
+		return Config{}, err
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return Config{}, fmt.Errorf("error encoding config: %v", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var fc fileConfig
+	if err := dec.Decode(&fc); err != nil {
+		return Config{}, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	return fc.config()
+}
+
+// applyConfigEnv overlays the environment variables matching fileConfig's
+// keys onto raw.
+func applyConfigEnv(raw map[string]json.RawMessage) error {
+	t := reflect.TypeOf(fileConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("json")
+
+		name := ConfigEnvPrefix + strings.ToUpper(key)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		if field.Type.Kind() == reflect.String {
+			quoted, err := json.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("error encoding %s: %v", name, err)
+			}
+			raw[key] = quoted
+			continue
+		}
+		if !json.Valid([]byte(value)) {
+			return fmt.Errorf("%w: %s is not valid JSON", ErrInvalidConfig, name)
+		}
+		raw[key] = json.RawMessage(value)
+	}
+	return nil
+}
+
+func (fc fileConfig) config() (Config, error) {
+	cfg := Config{
+		Endpoint:                fc.Endpoint,
+		LocalStack:              fc.LocalStack,
+		TableNames:              fc.TableNames,
+		TableSuffix:             fc.TableSuffix,
+		LowercaseIDs:            fc.LowercaseIDs,
+		MaxBidsPerAuction:       fc.MaxBidsPerAuction,
+		BalanceFetchParallelism: fc.BalanceFetchParallelism,
+		MaxPriority:             fc.MaxPriority,
+		MaxReputation:           fc.MaxReputation,
+		InitialTokenCount:       fc.InitialTokenCount,
+		CostMap:                 fc.CostMap,
+		CostTiers:               fc.CostTiers,
+		ReputationPenalty:       fc.ReputationPenalty,
+		ReputationReward:        fc.ReputationReward,
+		ReputationFloor:         fc.ReputationFloor,
+		ScoreWeights:            fc.ScoreWeights,
+		TeamScoreWeights:        fc.TeamScoreWeights,
+		BidShards:               fc.BidShards,
+		Currencies:              fc.Currencies,
+	}
+
+	if fc.RandSeed != nil {
+		cfg.RandSource = rand.NewSource(*fc.RandSeed)
+	}
+
+	if fc.WinCooldown != "" {
+		d, err := time.ParseDuration(fc.WinCooldown)
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: win_cooldown: %v", ErrInvalidConfig, err)
+		}
+		cfg.WinCooldown = d
+	}
+
+	if d := fc.DripRefill; d != nil {
+		cfg.DripRefill = &DripRefill{Amount: d.Amount, Cap: d.Cap}
+
+		interval, err := time.ParseDuration(d.Interval)
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: drip_refill.interval: %v", ErrInvalidConfig, err)
+		}
+		cfg.DripRefill.Interval = interval
+
+		if d.ScheduleInterval != "" {
+			schedule, err := time.ParseDuration(d.ScheduleInterval)
+			if err != nil {
+				return Config{}, fmt.Errorf("%w: drip_refill.schedule_interval: %v", ErrInvalidConfig, err)
+			}
+			cfg.DripRefill.ScheduleInterval = schedule
+		}
+	}
+
+	if p := fc.BudgetPacing; p != nil {
+		window, err := time.ParseDuration(p.Window)
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: budget_pacing.window: %v", ErrInvalidConfig, err)
+		}
+		cfg.BudgetPacing = &BudgetPacing{Window: window, Cap: p.Cap, TeamCaps: p.TeamCaps}
+	}
+
+	if q := fc.PriorityQuotas; q != nil {
+		cfg.PriorityQuotas = &PriorityQuotas{}
+		if q.TimeZone != "" {
+			loc, err := time.LoadLocation(q.TimeZone)
+			if err != nil {
+				return Config{}, fmt.Errorf("%w: priority_quotas.time_zone: %v", ErrInvalidConfig, err)
+			}
+			cfg.PriorityQuotas.Location = loc
+		}
+		for _, quota := range q.Quotas {
+			var action QuotaAction
+			switch quota.Action {
+			case "", "block":
+				action = QuotaBlock
+			case "surcharge":
+				action = QuotaSurcharge
+			case "penalize":
+				action = QuotaPenalize
+			default:
+				return Config{}, fmt.Errorf("%w: unknown priority_quotas action %q", ErrInvalidConfig, quota.Action)
+			}
+			cfg.PriorityQuotas.Quotas = append(cfg.PriorityQuotas.Quotas, PriorityQuota{
+				Priority:  quota.Priority,
+				DailyCap:  quota.DailyCap,
+				Action:    action,
+				Surcharge: quota.Surcharge,
+				Penalty:   quota.Penalty,
+			})
+		}
+	}
+
+	if f := fc.FrequencyCap; f != nil {
+		window, err := time.ParseDuration(f.Window)
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: frequency_cap.window: %v", ErrInvalidConfig, err)
+		}
+		cfg.FrequencyCap = &FrequencyCap{MaxWins: f.MaxWins, Window: window}
+	}
+
+	if fc.WindowSettlementInterval != "" {
+		d, err := time.ParseDuration(fc.WindowSettlementInterval)
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: window_settlement_interval: %v", ErrInvalidConfig, err)
+		}
+		cfg.WindowSettlementInterval = d
+	}
+
+	if fc.LedgerReconcileInterval != "" {
+		d, err := time.ParseDuration(fc.LedgerReconcileInterval)
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: ledger_reconcile_interval: %v", ErrInvalidConfig, err)
+		}
+		cfg.LedgerReconcileInterval = d
+	}
+
+	if fc.StatsInterval != "" {
+		d, err := time.ParseDuration(fc.StatsInterval)
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: stats_interval: %v", ErrInvalidConfig, err)
+		}
+		cfg.StatsInterval = d
+	}
+
+	if fc.BidRetention != "" {
+		d, err := time.ParseDuration(fc.BidRetention)
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: bid_retention: %v", ErrInvalidConfig, err)
+		}
+		cfg.BidRetention = d
+	}
+
+	if r := fc.ReputationRecovery; r != nil {
+		interval, err := time.ParseDuration(r.Interval)
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: reputation_recovery.interval: %v", ErrInvalidConfig, err)
+		}
+		cfg.ReputationRecovery = &ReputationRecovery{Interval: interval, Amount: r.Amount, Cap: r.Cap}
+	}
+
+	if r := fc.Retry; r != nil {
+		cfg.Retry = &RetryConfig{MaxAttempts: r.MaxAttempts}
+
+		durations := []struct {
+			key   string
+			value string
+			d     *time.Duration
+		}{
+			{"initial_backoff", r.InitialBackoff, &cfg.Retry.InitialBackoff},
+			{"max_backoff", r.MaxBackoff, &cfg.Retry.MaxBackoff},
+			{"budget", r.Budget, &cfg.Retry.Budget},
+		}
+		for _, d := range durations {
+			if d.value == "" {
+				continue
+			}
+			parsed, err := time.ParseDuration(d.value)
+			if err != nil {
+				return Config{}, fmt.Errorf("%w: retry.%s: %v", ErrInvalidConfig, d.key, err)
+			}
+			*d.d = parsed
+		}
+	}
+
+	if b := fc.CircuitBreaker; b != nil {
+		cfg.CircuitBreaker = &BreakerConfig{Threshold: b.Threshold}
+		if b.Cooldown != "" {
+			d, err := time.ParseDuration(b.Cooldown)
+			if err != nil {
+				return Config{}, fmt.Errorf("%w: circuit_breaker.cooldown: %v", ErrInvalidConfig, err)
+			}
+			cfg.CircuitBreaker.Cooldown = d
+		}
+	}
+
+	if m := fc.DegradedMode; m != nil {
+		cfg.DegradedMode = &DegradedConfig{MaxPending: m.MaxPending}
+
+		durations := []struct {
+			key   string
+			value string
+			d     *time.Duration
+		}{
+			{"settle_interval", m.SettleInterval, &cfg.DegradedMode.SettleInterval},
+			{"max_staleness", m.MaxStaleness, &cfg.DegradedMode.MaxStaleness},
+		}
+		for _, d := range durations {
+			if d.value == "" {
+				continue
+			}
+			parsed, err := time.ParseDuration(d.value)
+			if err != nil {
+				return Config{}, fmt.Errorf("%w: degraded_mode.%s: %v", ErrInvalidConfig, d.key, err)
+			}
+			*d.d = parsed
+		}
+	}
+
+	if h := fc.Webhooks; h != nil {
+		cfg.Webhooks = &WebhookConfig{MaxAttempts: h.MaxAttempts, Workers: h.Workers, QueueSize: h.QueueSize}
+
+		durations := []struct {
+			key   string
+			value string
+			d     *time.Duration
+		}{
+			{"initial_backoff", h.InitialBackoff, &cfg.Webhooks.InitialBackoff},
+			{"max_backoff", h.MaxBackoff, &cfg.Webhooks.MaxBackoff},
+			{"timeout", h.Timeout, &cfg.Webhooks.Timeout},
+		}
+		for _, d := range durations {
+			if d.value == "" {
+				continue
+			}
+			parsed, err := time.ParseDuration(d.value)
+			if err != nil {
+				return Config{}, fmt.Errorf("%w: webhooks.%s: %v", ErrInvalidConfig, d.key, err)
+			}
+			*d.d = parsed
+		}
+	}
+
+	switch fc.AuctionStrategy {
+	case "", "first_price":
+		cfg.AuctionStrategy = FirstPrice
+	case "second_price":
+		cfg.AuctionStrategy = SecondPrice
+	default:
+		return Config{}, fmt.Errorf("%w: unknown auction strategy %q", ErrInvalidConfig, fc.AuctionStrategy)
+	}
+
+	switch fc.TieBreak {
+	case "", "reputation":
+		cfg.TieBreak = TieBreakReputation
+	case "random":
+		cfg.TieBreak = TieBreakRandom
+	case "win_rate":
+		cfg.TieBreak = TieBreakWinRate
+	case "earliest":
+		cfg.TieBreak = TieBreakEarliest
+	default:
+		return Config{}, fmt.Errorf("%w: unknown tie break %q", ErrInvalidConfig, fc.TieBreak)
+	}
+
+	if v := fc.BidValidation; v != nil {
+		cfg.BidValidation.DropInvalid = v.DropInvalid
+		switch v.Duplicates {
+		case "", "collapse":
+			cfg.BidValidation.Duplicates = DuplicateBidsCollapse
+		case "reject":
+			cfg.BidValidation.Duplicates = DuplicateBidsReject
+		default:
+			return Config{}, fmt.Errorf("%w: unknown bid_validation.duplicates %q", ErrInvalidConfig, v.Duplicates)
+		}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,41 @@
+package tokens
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// consistencyPollInterval is how often waitForConsistency re-reads a row.
+const consistencyPollInterval = 25 * time.Millisecond
+
+// waitForConsistency polls a team's token row with strongly consistent reads
+// until it reflects a write made at updatedAtMs, or until the Manager's
+// consistency timeout passes. The write itself already succeeded, so a
+// timeout is logged rather than returned.
+func (tm *Manager) waitForConsistency(ctx context.Context, teamID string, updatedAtMs int64) {
+	ctx, cancel := context.WithTimeout(ctx, tm.consistencyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(consistencyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		row, err := tm.store.GetTokenRow(ctx, teamID, true)
+		if err == nil && row.UpdatedAtMs >= updatedAtMs {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			tm.logger.Warn(
+				"timed out waiting for token balance to become consistent",
+				zap.String("team_id", teamID),
+				zap.Duration("timeout", tm.consistencyTimeout),
+			)
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package tokens
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// laggingStore serves stale token rows to the first lag strongly consistent
+// reads after a balance update, as a lagging replica would.
+type laggingStore struct {
+	Store
+	lag int
+
+	mu      sync.Mutex
+	written bool
+	reads   int
+}
+
+func (s *laggingStore) UpdateBalance(ctx context.Context, u BalanceUpdate) (*TokenDBRow, error) {
+	row, err := s.Store.UpdateBalance(ctx, u)
+	s.mu.Lock()
+	s.written = err == nil
+	s.mu.Unlock()
+	return row, err
+}
+
+func (s *laggingStore) GetTokenRow(ctx context.Context, teamID string, consistent bool) (*TokenDBRow, error) {
+	row, err := s.Store.GetTokenRow(ctx, teamID, consistent)
+	if err != nil || !consistent {
+		return row, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.written {
+		return row, nil
+	}
+	s.reads++
+	if s.reads <= s.lag {
+		stale := cloneTokenRow(row)
+		stale.UpdatedAtMs = 0
+		return stale, nil
+	}
+	return row, nil
+}
+
+func TestWaitForConsistency(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		lag     int
+		// wantReads is how many consistent reads follow the spend, or the
+		// least many if it timed out
+		wantReads int
+		timedOut  bool
+	}{
+		{name: "disabled", lag: 5, wantReads: 0},
+		{name: "visible at once", timeout: time.Second, wantReads: 1},
+		{name: "visible after polling", timeout: time.Second, lag: 2, wantReads: 3},
+		// the spend still succeeds once the wait times out
+		{name: "never visible", timeout: 3 * consistencyPollInterval, lag: 1000, wantReads: 1, timedOut: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &laggingStore{Store: NewMemoryStore(), lag: tt.lag}
+			tm := newTestManager(t, []string{"a"}, WithStore(store), WithWaitForConsistency(tt.timeout))
+
+			if _, err := tm.SpendTokens(context.Background(), &Bid{TeamID: "a", UserID: "u", Priority: 1}); err != nil {
+				t.Fatalf("SpendTokens: %v", err)
+			}
+			if store.reads != tt.wantReads && !(tt.timedOut && store.reads > tt.wantReads) {
+				t.Errorf("got %d consistent reads after the spend, want %d", store.reads, tt.wantReads)
+			}
+		})
+	}
+}
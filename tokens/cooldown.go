@@ -0,0 +1,47 @@
+package tokens
+
+import (
+	"errors"
+	"fmt"
+)
+
+// inCooldown reports whether a team that last won at lastWinAtMs is still
+// barred from winning at nowMilli.
+func (tm *Manager) inCooldown(lastWinAtMs int64, nowMilli int64) bool {
+	return tm.winCooldown > 0 && lastWinAtMs > 0 &&
+		nowMilli-lastWinAtMs < tm.winCooldown.Milliseconds()
+}
+
+// cooldownStart is the earliest a team may have last won to win again at
+// nowMilli, or zero without a cooldown. Win charges are conditioned on it
+// so concurrent auctions can't both award the same team within its
+// cooldown.
+func (tm *Manager) cooldownStart(nowMilli int64) int64 {
+	if tm.winCooldown <= 0 {
+		return 0
+	}
+	return nowMilli - tm.winCooldown.Milliseconds()
+}
+
+// chargeFailure explains a charge of cost in currency against a team's token
+// row that the store rejected, from the row as it was when the condition
+// failed. Without the row, or if the row would have passed, the charge raced
+// some other write, such as the release of its reservation. Errors other
+// than a failed condition are returned as is.
+func (tm *Manager) chargeFailure(teamID, currency string, cost int64, err error, nowMilli int64) error {
+	var condErr *ConditionFailedError
+	if !errors.As(err, &condErr) {
+		return err
+	}
+
+	row := condErr.Row
+	switch {
+	case row == nil:
+		return fmt.Errorf("%w: team %s", ErrAuctionConflict, teamID)
+	case row.balanceIn(currency) < cost:
+		return fmt.Errorf("%w: team %s", ErrInsufficientBalance, teamID)
+	case tm.inCooldown(row.LastWinAtMs, nowMilli):
+		return fmt.Errorf("%w: team %s", ErrWinCooldown, teamID)
+	}
+	return fmt.Errorf("%w: team %s", ErrAuctionConflict, teamID)
+}
@@ -0,0 +1,51 @@
+package tokens
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWinCooldown(t *testing.T) {
+	tests := []struct {
+		name     string
+		cooldown time.Duration
+		// elapsed is the time between the two auctions
+		elapsed    time.Duration
+		wantWinner string
+		wantSkip   string
+	}{
+		{name: "no cooldown", elapsed: time.Second, wantWinner: "a"},
+		{name: "within cooldown", cooldown: time.Minute, elapsed: time.Second, wantWinner: "b", wantSkip: SkipReasonWinCooldown},
+		{name: "cooldown passed", cooldown: time.Minute, elapsed: time.Minute, wantWinner: "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := newTestClock()
+			tm := newTestManager(t, []string{"a", "b"}, WithClock(clock), WithWinCooldown(tt.cooldown))
+			bids := func(user string) []Bid {
+				return []Bid{
+					{TeamID: "a", UserID: user, Priority: 5},
+					{TeamID: "b", UserID: user, Priority: 1},
+				}
+			}
+
+			if _, err := tm.RunAuction(ctx, bids("u")); err != nil {
+				t.Fatalf("RunAuction: %v", err)
+			}
+			clock.Advance(tt.elapsed)
+			result, err := tm.RunAuction(ctx, bids("v"))
+			if err != nil {
+				t.Fatalf("RunAuction: %v", err)
+			}
+
+			if result.TeamID != tt.wantWinner {
+				t.Errorf("winner = %s, want %s", result.TeamID, tt.wantWinner)
+			}
+			if tt.wantSkip != "" && (len(result.LosingBids) != 1 || result.LosingBids[0].SkipReason != tt.wantSkip) {
+				t.Errorf("losing bids %+v, want a's skipped for %s", result.LosingBids, tt.wantSkip)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package tokens
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CostTier is one segment of a piecewise-linear cost function. Each priority
+// from MinPriority up to the next tier's MinPriority adds CostPerUnit to the
+// base cost, so the base cost of priority p is the sum of CostPerUnit over
+// priorities 1 through p.
+type CostTier struct {
+	MinPriority int64 `json:"min_priority"`
+	CostPerUnit int64 `json:"cost_per_unit"`
+}
+
+// validateCostTiers checks that tiers are sorted by MinPriority and cover
+// every priority from 1 to maxPriority.
+func validateCostTiers(tiers []CostTier, maxPriority int64) error {
+	if len(tiers) == 0 {
+		return nil
+	}
+
+	if tiers[0].MinPriority != 1 {
+		return fmt.Errorf("cost tiers must start at priority 1, got %d", tiers[0].MinPriority)
+	}
+
+	for i, tier := range tiers {
+		if tier.MinPriority > maxPriority {
+			return fmt.Errorf("cost tier %d starts above max priority %d", i, maxPriority)
+		}
+		if tier.CostPerUnit < 0 {
+			return fmt.Errorf("cost tier %d has negative cost per unit", i)
+		}
+		if i > 0 && tier.MinPriority <= tiers[i-1].MinPriority {
+			return fmt.Errorf("cost tiers must be sorted by strictly increasing min priority")
+		}
+	}
+	return nil
+}
+
+// validateCostMap checks that costs is non-negative and prices every priority
+// from 1 to maxPriority.
+func validateCostMap(costs map[int64]int64, maxPriority int64) error {
+	for p := int64(1); p <= maxPriority; p++ {
+		cost, ok := costs[p]
+		if !ok {
+			return fmt.Errorf("cost map has no cost for priority %d", p)
+		}
+		if cost < 0 {
+			return fmt.Errorf("cost map has negative cost for priority %d", p)
+		}
+	}
+	return nil
+}
+
+// tieredCost evaluates the piecewise-linear cost function at priority.
+func tieredCost(tiers []CostTier, priority int64) int64 {
+	var cost int64
+	for i, tier := range tiers {
+		if priority < tier.MinPriority {
+			break
+		}
+
+		end := priority
+		if i+1 < len(tiers) {
+			end = min(end, tiers[i+1].MinPriority-1)
+		}
+		cost += (end - tier.MinPriority + 1) * tier.CostPerUnit
+	}
+	return cost
+}
+
+// baseCost returns the cost of a bid at priority before the reputation
+// multiplier, from the configured cost tiers if any and otherwise from the
+// cost map.
+func (tm *Manager) baseCost(priority int64) (int64, error) {
+	if !tm.HasPriority(priority) {
+		return 0, fmt.Errorf("%w: %d", ErrUnknownPriority, priority)
+	}
+
+	if len(tm.costTiers) > 0 {
+		return tieredCost(tm.costTiers, priority), nil
+	}
+	return tm.costMap[priority], nil
+}
+
+// priorities lists every priority the Manager can price.
+func (tm *Manager) priorities() []int64 {
+	if len(tm.costTiers) > 0 {
+		priorities := make([]int64, 0, tm.maxPriority)
+		for p := int64(1); p <= tm.maxPriority; p++ {
+			priorities = append(priorities, p)
+		}
+		return priorities
+	}
+
+	priorities := make([]int64, 0, len(tm.costMap))
+	for p := range tm.costMap {
+		if p <= tm.maxPriority {
+			priorities = append(priorities, p)
+		}
+	}
+	return priorities
+}
+
+// ReputationForTargetCost returns the lowest reputation at which a bid at
+// priority costs at most targetCost. It returns ErrTargetCostUnreachable if
+// even the max reputation prices the bid above targetCost.
+func (tm *Manager) ReputationForTargetCost(priority, targetCost int64) (int64, error) {
+	cost, err := tm.CalculateCost(priority, tm.maxReputation)
+	if err != nil {
+		return 0, err
+	}
+	if cost > targetCost {
+		return 0, fmt.Errorf("%w: priority %d costs at least %d", ErrTargetCostUnreachable, priority, cost)
+	}
+
+	// cost only falls as reputation rises, so search for the first
+	// reputation that brings it within target
+	reputation := sort.Search(int(tm.maxReputation), func(r int) bool {
+		cost, _ := tm.CalculateCost(priority, int64(r))
+		return cost <= targetCost
+	})
+	return int64(reputation), nil
+}
@@ -0,0 +1,263 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"testing"
+)
+
+func TestCalculateCost(t *testing.T) {
+	tests := []struct {
+		name       string
+		priority   int64
+		reputation int64
+		want       int64
+		wantErr    error
+	}{
+		{name: "max reputation", priority: 10, reputation: MaxReputationScore, want: 10},
+		{name: "zero reputation", priority: 10, reputation: 0, want: 25},
+		{name: "half reputation", priority: 4, reputation: MaxReputationScore / 2, want: 8},
+		{name: "above max priority", priority: MaxPriority + 1, wantErr: ErrUnknownPriority},
+		{name: "zero priority", priority: 0, wantErr: ErrUnknownPriority},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := newTestManager(t, nil)
+
+			got, err := tm.CalculateCost(tt.priority, tt.reputation)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CalculateCost = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CalculateCost = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCostSchedule(t *testing.T) {
+	tests := []struct {
+		name       string
+		teamID     string
+		reputation int64
+		want       map[int64]int64
+		wantErr    error
+	}{
+		{name: "max reputation", teamID: "a", reputation: MaxReputationScore, want: costMap},
+		{
+			name: "zero reputation", teamID: "a", reputation: 0,
+			want: map[int64]int64{1: 2, 2: 2, 3: 2, 4: 12, 5: 12, 6: 12, 7: 17, 8: 17, 9: 17, 10: 25},
+		},
+		{name: "unknown team", teamID: "missing", wantErr: ErrTeamNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := NewMemoryStore()
+			tm := newTestManager(t, []string{"a"}, WithStore(mem))
+			mem.tokens["a"].ReputationScore = tt.reputation
+
+			got, err := tm.CostSchedule(context.Background(), tt.teamID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CostSchedule = %v, want %v", err, tt.wantErr)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("CostSchedule = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownPriorityRejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		priority int64
+		wantErr  error
+	}{
+		{name: "in the cost map", priority: 5},
+		{name: "past the max priority", priority: MaxPriority + 1, wantErr: ErrUnknownPriority},
+		{name: "negative", priority: -1, wantErr: ErrUnknownPriority},
+		{
+			name:     "priced but above a lowered max priority",
+			opts:     []Option{WithMaxPriority(5)},
+			priority: 7, wantErr: ErrUnknownPriority,
+		},
+		{
+			name:     "up to the max priority with cost tiers",
+			opts:     []Option{WithCostTiers([]CostTier{{MinPriority: 1, CostPerUnit: 2}})},
+			priority: MaxPriority,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tm := newTestManager(t, []string{"a"}, tt.opts...)
+
+			if got, want := tm.HasPriority(tt.priority), tt.wantErr == nil; got != want {
+				t.Errorf("HasPriority(%d) = %t, want %t", tt.priority, got, want)
+			}
+			_, err := tm.SpendTokens(ctx, &Bid{TeamID: "a", UserID: "u", Priority: tt.priority})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SpendTokens = %v, want %v", err, tt.wantErr)
+			}
+			_, err = tm.RunAuction(ctx, []Bid{{TeamID: "a", UserID: "v", Priority: tt.priority}})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RunAuction = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				// rejected bids are never charged
+				if balance := tokenRow(t, tm, "a").TokenBalance; balance != InitialTokenCount {
+					t.Errorf("balance = %d, want %d", balance, InitialTokenCount)
+				}
+			}
+		})
+	}
+}
+
+func TestCostTiers(t *testing.T) {
+	tiers := []CostTier{
+		{MinPriority: 1, CostPerUnit: 1},
+		{MinPriority: 4, CostPerUnit: 3},
+		{MinPriority: 8, CostPerUnit: 10},
+	}
+	tests := []struct {
+		priority int64
+		want     int64
+	}{
+		{priority: 1, want: 1},
+		{priority: 3, want: 3},
+		{priority: 4, want: 6},
+		{priority: 7, want: 15},
+		{priority: 8, want: 25},
+		{priority: 10, want: 45},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.priority), func(t *testing.T) {
+			tm := newTestManager(t, nil, WithCostTiers(tiers))
+
+			// the cost at max reputation is the base cost
+			got, err := tm.CalculateCost(tt.priority, MaxReputationScore)
+			if err != nil {
+				t.Fatalf("CalculateCost: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CalculateCost(%d) = %d, want %d", tt.priority, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCostTiersValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		tiers   []CostTier
+		wantErr bool
+	}{
+		{name: "single tier", tiers: []CostTier{{MinPriority: 1, CostPerUnit: 2}}},
+		{name: "not starting at 1", tiers: []CostTier{{MinPriority: 2, CostPerUnit: 2}}, wantErr: true},
+		{
+			name:    "unsorted",
+			tiers:   []CostTier{{MinPriority: 1, CostPerUnit: 1}, {MinPriority: 6}, {MinPriority: 4}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate min priority",
+			tiers:   []CostTier{{MinPriority: 1, CostPerUnit: 1}, {MinPriority: 1, CostPerUnit: 2}},
+			wantErr: true,
+		},
+		{
+			name:    "above max priority",
+			tiers:   []CostTier{{MinPriority: 1, CostPerUnit: 1}, {MinPriority: MaxPriority + 1}},
+			wantErr: true,
+		},
+		{name: "negative cost", tiers: []CostTier{{MinPriority: 1, CostPerUnit: -1}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm, err := NewManager(WithStore(NewMemoryStore()), WithCostTiers(tt.tiers))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewManager = %v, want error %t", err, tt.wantErr)
+			}
+			if err == nil {
+				tm.Close()
+			}
+		})
+	}
+}
+
+func TestReputationForTargetCost(t *testing.T) {
+	tests := []struct {
+		name       string
+		priority   int64
+		targetCost int64
+		want       int64
+		wantErr    error
+	}{
+		{name: "affordable at zero reputation", priority: 10, targetCost: 25, want: 0},
+		{name: "part way up", priority: 10, targetCost: 20, want: 27},
+		{name: "near the top", priority: 10, targetCost: 10, want: 94},
+		{name: "unreachable", priority: 10, targetCost: 9, wantErr: ErrTargetCostUnreachable},
+		{name: "unknown priority", priority: MaxPriority + 1, targetCost: 100, wantErr: ErrUnknownPriority},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := newTestManager(t, nil)
+
+			got, err := tm.ReputationForTargetCost(tt.priority, tt.targetCost)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReputationForTargetCost = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ReputationForTargetCost = %d, want %d", got, tt.want)
+			}
+			if err != nil || got == 0 {
+				return
+			}
+			// the lowest such reputation: one less costs too much
+			if cost, _ := tm.CalculateCost(tt.priority, got-1); cost <= tt.targetCost {
+				t.Errorf("reputation %d already costs %d", got-1, cost)
+			}
+		})
+	}
+}
+
+func TestCurrencyCostMap(t *testing.T) {
+	full := make(map[int64]int64)
+	for p := int64(1); p <= MaxPriority; p++ {
+		full[p] = p
+	}
+	missingLow := maps.Clone(full)
+	delete(missingLow, 1)
+
+	tests := []struct {
+		name     string
+		currency Currency
+		wantErr  bool
+	}{
+		{name: "every priority", currency: Currency{CostMap: full}},
+		{name: "standard prices", currency: Currency{MinPriority: 5}},
+		{name: "missing a priority", currency: Currency{CostMap: missingLow}, wantErr: true},
+		// bids below the min priority are rejected, but the map still
+		// prices them
+		{name: "missing a priority below the min", currency: Currency{MinPriority: 5, CostMap: missingLow}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm, err := NewManager(WithStore(NewMemoryStore()), WithCurrencies(map[string]Currency{"premium": tt.currency}))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewManager = %v, want error %t", err, tt.wantErr)
+			}
+			if err == nil {
+				tm.Close()
+			}
+		})
+	}
+
+	tm := newTestManager(t, nil)
+	_, err := tm.priceBid(1, &Currency{CostMap: missingLow}, MaxReputationScore, MaxReputationScore)
+	if !errors.Is(err, ErrUnknownPriority) {
+		t.Errorf("priceBid of a priority missing from the currency's cost map = %v, want %v", err, ErrUnknownPriority)
+	}
+}
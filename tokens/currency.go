@@ -0,0 +1,99 @@
+package tokens
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CurrencyStandard names the standard token currency, kept in a team's
+// token_balance. Bids without a currency spend it.
+const CurrencyStandard = "standard"
+
+// Currency is a token type besides the standard one, e.g. premium tokens
+// that only fund high-priority bids; see WithCurrencies. A team's balance in
+// it is kept in the balances map of its token row.
+//
+// Only the standard currency drips, counts towards budget pacing and can be
+// transferred, adjusted, held or reserved.
+type Currency struct {
+	// MinPriority is the lowest priority a bid can spend the currency on;
+	// zero allows any.
+	MinPriority int64 `json:"min_priority"`
+	// CostMap prices bids in the currency by priority, before the
+	// reputation multiplier, and needs a cost for every priority up to the
+	// Manager's max priority. Nil prices them like standard bids.
+	CostMap map[int64]int64 `json:"cost_map"`
+	// InitialBalance is what EnsureTeam gives a new team and RefillTokens
+	// resets a team's balance to.
+	InitialBalance int64 `json:"initial_balance"`
+}
+
+func (c *Currency) validate(name string, maxPriority int64) error {
+	if name == "" || normalizeCurrency(name) != name {
+		return fmt.Errorf("currency name %q must be lowercase, non-empty and not %q", name, CurrencyStandard)
+	}
+	if c.MinPriority < 0 || c.MinPriority > maxPriority {
+		return fmt.Errorf("currency %s min priority must be between 0 and %d, got %d", name, maxPriority, c.MinPriority)
+	}
+	if c.InitialBalance < 0 {
+		return fmt.Errorf("currency %s initial balance must not be negative, got %d", name, c.InitialBalance)
+	}
+	for p := int64(1); c.CostMap != nil && p <= maxPriority; p++ {
+		if cost, ok := c.CostMap[p]; !ok || cost < 0 {
+			return fmt.Errorf("currency %s cost map needs a non-negative cost for priority %d", name, p)
+		}
+	}
+	return nil
+}
+
+// normalizeCurrency canonicalizes a bid's currency. The standard currency
+// is always the empty string.
+func normalizeCurrency(currency string) string {
+	currency = strings.ToLower(strings.TrimSpace(currency))
+	if currency == CurrencyStandard {
+		return ""
+	}
+	return currency
+}
+
+// balanceIn returns a team's balance in currency, the empty string being the
+// standard one.
+func (row *TokenDBRow) balanceIn(currency string) int64 {
+	if currency == "" {
+		return row.TokenBalance
+	}
+	return row.Balances[currency]
+}
+
+// currency returns the configuration of a normalized bid's currency, or nil
+// for the standard currency. It fails with ErrInvalidCurrency for a currency
+// the Manager doesn't have, or one the bid's priority can't spend.
+func (tm *Manager) currency(bid *Bid) (*Currency, error) {
+	if bid.Currency == "" {
+		return nil, nil
+	}
+
+	c, ok := tm.currencies[bid.Currency]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown currency %s", ErrInvalidCurrency, bid.Currency)
+	}
+	if bid.Priority < c.MinPriority {
+		return nil, fmt.Errorf("%w: %s tokens need priority %d or above, got %d",
+			ErrInvalidCurrency, bid.Currency, c.MinPriority, bid.Priority)
+	}
+	return &c, nil
+}
+
+// initialBalances returns what a new or refilled team gets in each currency
+// besides the standard one, or nil without any.
+func (tm *Manager) initialBalances() map[string]int64 {
+	if len(tm.currencies) == 0 {
+		return nil
+	}
+
+	balances := make(map[string]int64, len(tm.currencies))
+	for name, c := range tm.currencies {
+		balances[name] = c.InitialBalance
+	}
+	return balances
+}
@@ -0,0 +1,1147 @@
+package tokens
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	"go.uber.org/zap"
+	"golang.org/x/exp/rand"
+
+	"github.com/christopherwong-hinge/auction/events"
+)
+
+func (tm *Manager) RecordBid(ctx context.Context, bid *Bid, cost CostBreakdown, score float64) (*BidRow, error) {
+	ctx, end := tm.startSpan(ctx, SpanRecordBid, bidAttrs(bid)...)
+	br, err := tm.recordBid(ctx, bid, cost, score)
+	end(err)
+	return br, err
+}
+
+func (tm *Manager) recordBid(ctx context.Context, bid *Bid, cost CostBreakdown, score float64) (*BidRow, error) {
+	nowMilli := tm.clock.Now().UnixMilli()
+
+	br, err := tm.newBidRow(bid, cost, score, nowMilli)
+	if err != nil {
+		return nil, err
+	}
+
+	if tm.bidBuffer != nil {
+		if err := tm.bidBuffer.add(ctx, br); err != nil {
+			return br, err
+		}
+	} else if err := tm.store.PutBids(ctx, []*BidRow{br}); err != nil {
+		return nil, err
+	}
+
+	tm.publishBidRecorded(bid, br)
+	return br, nil
+}
+
+// newBidRow returns the row to record a priced and scored bid as.
+func (tm *Manager) newBidRow(bid *Bid, cost CostBreakdown, score float64, nowMilli int64) (*BidRow, error) {
+	bidID, err := tm.newBidID(time.UnixMilli(nowMilli))
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := tm.bidExpiresAt(nowMilli)
+
+	return &BidRow{
+		Pk: tm.bidPK(bid.TeamID, bidID),
+		Sk: strings.Join(
+			[]string{bid.TeamID, bidID, strconv.FormatInt(nowMilli, 10)},
+			"#",
+		),
+		BidID:        bidID,
+		Target:       bid.UserID,
+		Priority:     bid.Priority,
+		Cost:         cost.Cost,
+		Score:        score,
+		BaseCost:     cost.BaseCost,
+		Multiplier:   cost.Multiplier,
+		Reputation:   cost.Reputation,
+		Currency:     bid.Currency,
+		CreatedAtMs:  nowMilli,
+		UpdatedAtMs:  nowMilli,
+		ExpiresAt:    expiresAt,
+		ExpiryBucket: bidExpiryBucket(bidID, expiresAt),
+	}, nil
+}
+
+// publishBidRecorded publishes that bid was recorded as br.
+func (tm *Manager) publishBidRecorded(bid *Bid, br *BidRow) {
+	tm.publish(events.BidRecorded{
+		BidID:        br.BidID,
+		TeamID:       bid.TeamID,
+		UserID:       bid.UserID,
+		Priority:     bid.Priority,
+		Cost:         br.Cost,
+		Score:        br.Score,
+		Currency:     bid.Currency,
+		OccurredAtMs: br.CreatedAtMs,
+	})
+}
+
+// wonBidRow returns the row to write for a recorded bid that won its
+// auction, or nil for an auction whose bids aren't recorded. It is written
+// along with the winner's charge, so a won bid is recorded exactly when its
+// team is charged.
+func (tm *Manager) wonBidRow(br *BidRow) *BidRow {
+	if br == nil {
+		return nil
+	}
+
+	won := *br
+	won.Won = true
+	won.UpdatedAtMs = tm.clock.Now().UnixMilli()
+	return &won
+}
+
+// markBidWon flags br as won once the row from wonBidRow was written.
+func (tm *Manager) markBidWon(br *BidRow) {
+	// a still-buffered row must not overwrite the winning row when flushed
+	if tm.bidBuffer != nil && tm.bidBuffer.markWon(br) {
+		return
+	}
+	br.Won = true
+}
+
+// abortBidsTimeout bounds marking an auction's bids aborted, which runs after
+// the auction's own context is cancelled.
+const abortBidsTimeout = 5 * time.Second
+
+// abortBids marks the bids recorded by a cancelled auction as aborted, so
+// they can be told apart from bids of auctions that resolved.
+func (tm *Manager) abortBids(ctx context.Context, scored []*candidate) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortBidsTimeout)
+	defer cancel()
+
+	for _, c := range scored {
+		if c.row == nil || c.won {
+			continue
+		}
+		if tm.bidBuffer != nil && tm.bidBuffer.markAborted(c.row) {
+			continue
+		}
+
+		err := tm.store.MarkBidAborted(ctx, c.row.Pk, c.row.Sk, tm.clock.Now().UnixMilli())
+		if err != nil {
+			tm.logger.Warn("failed to mark bid aborted", zap.String("bid_id", c.row.BidID), zap.Error(err))
+			continue
+		}
+		c.row.Aborted = true
+	}
+}
+
+// GetWinningBid fetches a bid previously returned in an AuctionResult. It
+// returns ErrBidNotFound if no such bid exists and ErrBidNotWon if the bid
+// exists but did not win its auction.
+func (tm *Manager) GetWinningBid(ctx context.Context, teamID, bidID string) (*BidRow, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	teamID = tm.normalizeID(teamID)
+
+	bids, err := tm.store.QueryBids(ctx, BidQuery{
+		Pk:       tm.bidPK(teamID, bidID),
+		SkPrefix: teamID + "#" + bidID + "#",
+		Limit:    1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bids) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrBidNotFound, bidID)
+	}
+	row := bids[0]
+
+	if !row.Won {
+		return nil, fmt.Errorf("%w: %s", ErrBidNotWon, bidID)
+	}
+
+	return &row, nil
+}
+
+// newBidID returns a ksuid-based bid ID.
+func (tm *Manager) newBidID(t time.Time) (string, error) {
+	return tm.newID("bid_", t)
+}
+
+// randFloat64 returns a random number in [0, 1), drawn from the configured
+// rand source if there is one.
+func (tm *Manager) randFloat64() float64 {
+	if tm.rand == nil {
+		return rand.Float64()
+	}
+
+	tm.randMu.Lock()
+	defer tm.randMu.Unlock()
+	return tm.rand.Float64()
+}
+
+// newID returns a ksuid-based ID with the given prefix, timestamped t so IDs
+// follow the Manager's clock. With a configured rand source the payload is
+// drawn from it so seeded runs generate the same IDs.
+func (tm *Manager) newID(prefix string, t time.Time) (string, error) {
+	if tm.rand == nil {
+		id, err := ksuid.NewRandomWithTime(t)
+		if err != nil {
+			return "", fmt.Errorf("error generating id: %v", err)
+		}
+		return prefix + id.String(), nil
+	}
+
+	payload := make([]byte, 16)
+	tm.randMu.Lock()
+	_, _ = tm.rand.Read(payload)
+	tm.randMu.Unlock()
+
+	id, err := ksuid.FromParts(t, payload)
+	if err != nil {
+		return "", fmt.Errorf("error generating id: %v", err)
+	}
+	return prefix + id.String(), nil
+}
+
+// Get token balance for a team
+func (tm *Manager) GetTokenBalance(ctx context.Context, teamID string) (balance, reputation int64, err error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	ctx, end := tm.startSpan(ctx, SpanGetTokenBalance, AttrTeamID.String(teamID))
+	defer func() { end(err) }()
+
+	row, err := tm.getTokenRow(ctx, teamID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return row.TokenBalance, row.ReputationScore, nil
+}
+
+// getTokenRow reads a team's full token row, applying any drip refill due.
+func (tm *Manager) getTokenRow(ctx context.Context, teamID string) (*TokenDBRow, error) {
+	teamID = tm.normalizeID(teamID)
+
+	row, err := tm.store.GetTokenRow(ctx, teamID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	now := tm.clock.Now().UnixMilli()
+	if err := tm.drip(ctx, row, now); err != nil {
+		return nil, err
+	}
+	if err := tm.recoverReputation(ctx, row, now); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// TeamBalance is a team's balance and reputation, as returned by
+// GetTokenBalances.
+type TeamBalance struct {
+	TeamID          string `json:"team_id"`
+	TokenBalance    int64  `json:"token_balance"`
+	ReputationScore int64  `json:"reputation_score"`
+	// Balances are the team's balances in currencies besides the standard
+	// one; see Currency.
+	Balances map[string]int64 `json:"balances,omitempty"`
+}
+
+// GetTokenBalances reads the balance and reputation of many teams at once,
+// keyed by team ID, in one BatchGetItem request per 100 teams. Like
+// GetTokenBalance it fails with ErrTeamNotFound if any team has no token
+// row.
+func (tm *Manager) GetTokenBalances(ctx context.Context, teamIDs []string) (balances map[string]TeamBalance, err error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	ctx, end := tm.startSpan(ctx, SpanGetTokenBalance, AttrTeamCount.Int(len(teamIDs)))
+	defer func() { end(err) }()
+
+	rows, missing, err := tm.batchGetTokenRows(ctx, teamIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTeamNotFound, strings.Join(missing, ", "))
+	}
+
+	balances = make(map[string]TeamBalance, len(rows))
+	for teamID, row := range rows {
+		balances[teamID] = TeamBalance{
+			TeamID:          teamID,
+			TokenBalance:    row.TokenBalance,
+			ReputationScore: row.ReputationScore,
+			Balances:        row.Balances,
+		}
+	}
+	return balances, nil
+}
+
+// BatchGetTokenBalance reads the token rows for many teams at once, keyed by
+// team ID. Teams without a token row are not an error; their IDs are
+// returned in missing instead. An error is only returned when the store
+// itself fails.
+func (tm *Manager) BatchGetTokenBalance(
+	ctx context.Context,
+	teamIDs []string,
+) (rows map[string]TokenDBRow, missing []string, err error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.batchGetTokenRows(ctx, teamIDs)
+}
+
+// batchGetTokenRows reads the token rows of the given teams, once per team,
+// applying any drip refill and reputation recovery due. Teams are read in
+// batches of up to batchGetLimit, with up to balanceFetchParallelism batches
+// in flight at once; the first failed batch cancels the rest.
+func (tm *Manager) batchGetTokenRows(
+	ctx context.Context,
+	teamIDs []string,
+) (rows map[string]TokenDBRow, missing []string, err error) {
+	seen := make(map[string]bool, len(teamIDs))
+	ids := make([]string, 0, len(teamIDs))
+	for _, teamID := range teamIDs {
+		teamID = tm.normalizeID(teamID)
+		if seen[teamID] {
+			continue
+		}
+		seen[teamID] = true
+		ids = append(ids, teamID)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	rows = make(map[string]TokenDBRow, len(ids))
+	sem := make(chan struct{}, tm.balanceFetchParallelism)
+
+	for start := 0; start < len(ids); start += batchGetLimit {
+		batch := ids[start:min(start+batchGetLimit, len(ids))]
+
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			batchRows, err := tm.store.BatchGetTokenRows(ctx, batch)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				// the batches this cancels fail too; keep the cause
+				if firstErr == nil {
+					firstErr = err
+				}
+				cancel()
+				return
+			}
+			for teamID, row := range batchRows {
+				rows[teamID] = row
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	now := tm.clock.Now().UnixMilli()
+	for teamID, row := range rows {
+		if err := tm.drip(ctx, &row, now); err != nil {
+			return nil, nil, err
+		}
+		if err := tm.recoverReputation(ctx, &row, now); err != nil {
+			return nil, nil, err
+		}
+		rows[teamID] = row
+	}
+
+	for teamID := range seen {
+		if _, ok := rows[teamID]; !ok {
+			missing = append(missing, teamID)
+		}
+	}
+	slices.Sort(missing)
+
+	return rows, missing, nil
+}
+
+// Simulate an auction for a user where teams bid tokens. If ctx is cancelled
+// before a winner is charged, the bids recorded so far are marked aborted.
+// Only one auction per user runs at a time; a concurrent one fails with
+// ErrAuctionInProgress.
+func (tm *Manager) RunAuction(ctx context.Context, bids []Bid) (*AuctionResult, error) {
+	return tm.RunAuctionWithConfig(ctx, bids, AuctionConfig{})
+}
+
+// RunAuctionWithConfig runs an auction with per-auction settings.
+//
+// With cfg.IdempotencyKey set, the key is claimed before the auction runs
+// and stores its result once it has a winner; running an auction with the
+// key again returns that result without recording bids or charging. An
+// auction that fails before charging anyone gives the key up, so it can be
+// retried. One whose failure leaves it unknown whether the winner was
+// charged, such as a store timeout, keeps the key until it expires, as does
+// an auction still running: reusing the key then fails with
+// ErrIdempotencyKeyInUse. A multi-winner auction that fails after settling
+// some winners stores their results, which a retry returns.
+func (tm *Manager) RunAuctionWithConfig(
+	ctx context.Context,
+	bids []Bid,
+	cfg AuctionConfig,
+) (*AuctionResult, error) {
+	if cfg.Winners > 1 {
+		return nil, fmt.Errorf("%w: %d winners need RunMultiWinnerAuction", ErrInvalidConfig, cfg.Winners)
+	}
+
+	results, err := tm.runAuctionOrDegrade(ctx, bids, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// RunMultiWinnerAuction runs an auction that awards up to cfg.Winners
+// teams, e.g. to let a user receive likes from several teams. Bids are
+// ranked as for RunAuction and awarded in order, each team at most once;
+// every winner is settled on its own, so a winner that can't be charged
+// frees its slot for the next bid (see WithChargeFallback). The results are
+// ordered best first and may be fewer than cfg.Winners. ErrNoWinner is
+// returned if no bid wins.
+//
+// If settling a winner fails outright, the results of the winners already
+// charged are returned along with the error.
+func (tm *Manager) RunMultiWinnerAuction(
+	ctx context.Context,
+	bids []Bid,
+	cfg AuctionConfig,
+) ([]*AuctionResult, error) {
+	return tm.runAuctionOrDegrade(ctx, bids, cfg)
+}
+
+// runAuction runs an auction for RunAuctionWithConfig and
+// RunMultiWinnerAuction. rows, if non-nil, holds the row each bid was
+// already recorded under, e.g. by SubmitSealedBid; otherwise every bid is
+// recorded as it is scored.
+func (tm *Manager) runAuction(
+	ctx context.Context,
+	bids []Bid,
+	rows []*BidRow,
+	cfg AuctionConfig,
+) (results []*AuctionResult, err error) {
+	start := time.Now()
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	ctx, end := tm.startSpan(ctx, SpanRunAuction, auctionAttrs(bids)...)
+	defer func() { end(err) }()
+
+	if len(bids) > tm.maxBidsPerAuction {
+		return nil, fmt.Errorf("%w: %d bids, max %d", ErrTooManyBids, len(bids), tm.maxBidsPerAuction)
+	}
+	bids = tm.normalizeBids(bids)
+	bids, rows, dropped, err := tm.validateBids(bids, rows)
+	if err != nil {
+		return nil, err
+	}
+	tm.abortDropped(ctx, dropped)
+
+	if key := cfg.IdempotencyKey; key != "" {
+		prior, claimErr := tm.claimIdempotencyKey(ctx, idempotencyOpAuction, key)
+		if claimErr != nil {
+			return nil, claimErr
+		}
+		if prior != nil {
+			return prior.auctionResults(), nil
+		}
+
+		defer func() {
+			// a multi-winner auction can fail after charging some winners,
+			// whom a retry mustn't charge again
+			if err != nil && len(results) == 0 {
+				tm.releaseIdempotencyKey(ctx, idempotencyOpAuction, key, err)
+				return
+			}
+			tm.completeIdempotencyKey(ctx, idempotencyOpAuction, key, results, 0)
+		}()
+	}
+
+	lock, err := tm.lockAuction(ctx, bids)
+	if err != nil {
+		return nil, err
+	}
+	defer tm.unlockAuction(ctx, lock)
+
+	startedAt := tm.clock.Now()
+	auctionID, err := tm.newID("auction_", startedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	tm.publishAuctionStarted(auctionID, bids)
+
+	var candidates, scored []*candidate
+	defer func() {
+		tm.auditAuction(ctx, auctionID, startedAt, bids, cfg, scored, candidates, results, err)
+		if err == nil || errors.Is(err, ErrNoWinner) {
+			tm.recordAuction(ctx, auctionID, bids, scored, candidates, results)
+			tm.countAuctionEntries(ctx, bids)
+			tm.notifyWebhooks(auctionID, scored, results)
+		}
+		tm.publishAuctionWon(results)
+		if err == nil || errors.Is(err, ErrNoWinner) {
+			tm.publishAuctionSettled(auctionID, startedAt, bids, scored, candidates, results)
+		}
+		if err != nil && ctx.Err() != nil {
+			tm.abortBids(ctx, scored)
+		}
+		tm.releaseReservations(ctx, scored)
+		tm.logDecision(scored, results, err)
+		tm.observeAuction(scored, results, err, start)
+	}()
+
+	var tokenRows map[string]*TokenDBRow
+	switch {
+	case cfg.state != nil:
+		tokenRows, err = stateTokenRows(cfg.state, bids, tm.bidValidation.DropInvalid)
+	case cfg.batch != nil:
+		tokenRows, err = cfg.batch.tokenRows(bids, tm.bidValidation.DropInvalid)
+	default:
+		tokenRows, err = tm.fetchTokenRows(ctx, bids)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tm.bidValidation.DropInvalid {
+		bids, rows, dropped = tm.dropTeamless(bids, rows, tokenRows)
+		tm.abortDropped(ctx, dropped)
+	}
+	capped, err := tm.frequencyCapped(ctx, bids, tm.clock.Now().UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+
+	for i, bid := range bids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		c, err := tm.scoreBidWithState(bid, tokenRows[bid.TeamID], cfg)
+		if err != nil {
+			return nil, err
+		}
+		scored = append(scored, c)
+
+		if rows != nil {
+			// a bid recorded ahead of its auction is rescored against the
+			// balances at settlement, which its won row records
+			row := *rows[i]
+			row.Cost = c.cost
+			row.Score = c.score
+			row.BaseCost = c.breakdown.BaseCost
+			row.Multiplier = c.breakdown.Multiplier
+			row.Reputation = c.breakdown.Reputation
+			c.row = &row
+		} else {
+			// record the bid regardless of validity for record keeping
+			c.row, err = tm.RecordBid(ctx, &c.bid, c.breakdown, c.score)
+			if err != nil {
+				return nil, err
+			}
+		}
+		c.createdAtMs = c.row.CreatedAtMs
+
+		if err := tokenRows[bid.TeamID].canBid(); err != nil {
+			tm.logger.Info("team can't bid", zap.String("team_id", bid.TeamID), zap.Error(err))
+			c.skipReason = SkipReasonTeamInactive
+			continue
+		}
+
+		if !cfg.meetsReserve(c) {
+			c.skipReason = SkipReasonBelowReserve
+			continue
+		}
+
+		if !c.affordable() {
+			tm.logger.Warn(
+				"team has insufficient tokens to bid",
+				zap.String("team_id", bid.TeamID),
+				zap.Int64("balance", c.balance),
+				zap.Int64("bid_cost", c.cost),
+			)
+			c.skipReason = SkipReasonInsufficientBalance
+			continue
+		}
+
+		if tm.inCooldown(c.lastWinAtMs, tm.clock.Now().UnixMilli()) {
+			tm.logger.Info(
+				"team is in win cooldown",
+				zap.String("team_id", bid.TeamID),
+				zap.Int64("last_win_at_ms", c.lastWinAtMs),
+			)
+			c.skipReason = SkipReasonWinCooldown
+			continue
+		}
+
+		if capped[GetFrequencyPK(bid.TeamID, bid.UserID)] {
+			tm.logger.Info(
+				"team is at its frequency cap for user",
+				zap.String("team_id", bid.TeamID),
+				zap.String("user_id", bid.UserID),
+			)
+			c.skipReason = SkipReasonFrequencyCap
+			continue
+		}
+
+		if cfg.ReserveBids {
+			err := tm.reserveBid(ctx, c)
+			if errors.Is(err, ErrInsufficientBalance) {
+				// spent elsewhere since its balance was read
+				c.skipReason = SkipReasonInsufficientBalance
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	// don't start charging for an auction that was already abandoned
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 && noWinnerReason(scored, candidates) == NoWinnerReserveNotMet {
+		return nil, ErrReserveNotMet
+	}
+	results, err = tm.award(ctx, candidates, cfg, lock)
+	tm.describeResults(results, auctionID, scored)
+	return results, err
+}
+
+// fetchTokenRows reads the token row of each team bidding, in batches; see
+// batchGetTokenRows. It fails with ErrTeamNotFound if any team has no row,
+// unless invalid bids are dropped; see BidValidation.DropInvalid.
+func (tm *Manager) fetchTokenRows(ctx context.Context, bids []Bid) (map[string]*TokenDBRow, error) {
+	teamIDs := make([]string, len(bids))
+	for i, bid := range bids {
+		teamIDs[i] = bid.TeamID
+	}
+
+	ctx, end := tm.startSpan(ctx, SpanGetTokenBalance, auctionAttrs(bids)...)
+	rows, missing, err := tm.batchGetTokenRows(ctx, teamIDs)
+	if err == nil && len(missing) > 0 && !tm.bidValidation.DropInvalid {
+		err = fmt.Errorf("%w: %s", ErrTeamNotFound, missing[0])
+	}
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+
+	byTeam := make(map[string]*TokenDBRow, len(rows))
+	for teamID := range rows {
+		row := rows[teamID]
+		byTeam[teamID] = &row
+	}
+	if tm.degraded != nil {
+		tm.degraded.remember(byTeam, tm.clock.Now().UnixMilli())
+	}
+	return byTeam, nil
+}
+
+// RunAuctionWithState runs an auction like RunAuction, but using
+// caller-provided token rows, keyed by team ID, instead of reading each
+// team's balance and reputation. Only those reads are skipped: the auction
+// is settled like any other, so every bid is recorded, the auction is
+// audited and recorded in the user's history, and the reserve and frequency
+// cap apply. It no longer writes just the winner's spend.
+//
+// The state may be stale. A bid is scored and priced against whatever
+// state is given, but the charge is conditional on the team's actual
+// balance, so a stale balance can fail the charge (see WithChargeFallback)
+// but never overdraw a team.
+func (tm *Manager) RunAuctionWithState(
+	ctx context.Context,
+	bids []Bid,
+	state map[string]TokenDBRow,
+) (*AuctionResult, error) {
+	if state == nil {
+		state = map[string]TokenDBRow{}
+	}
+	results, err := tm.runAuction(ctx, bids, nil, AuctionConfig{state: state})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// stateTokenRows returns copies of the token rows in state of the teams
+// bidding. It fails with ErrTeamNotFound if any team has no row, unless
+// dropMissing is set.
+func stateTokenRows(state map[string]TokenDBRow, bids []Bid, dropMissing bool) (map[string]*TokenDBRow, error) {
+	rows := make(map[string]*TokenDBRow, len(bids))
+	for _, bid := range bids {
+		row, ok := state[bid.TeamID]
+		if !ok && !dropMissing {
+			return nil, fmt.Errorf("%w: %s", ErrTeamNotFound, bid.TeamID)
+		}
+		if ok {
+			rows[bid.TeamID] = cloneTokenRow(&row)
+		}
+	}
+	return rows, nil
+}
+
+// describeResults fills in what the winners' results share: the auction
+// they won and its losing bids.
+func (tm *Manager) describeResults(results []*AuctionResult, auctionID string, scored []*candidate) {
+	if len(results) == 0 {
+		return
+	}
+
+	losing := make([]*candidate, 0, len(scored))
+	for _, c := range scored {
+		if !c.won {
+			losing = append(losing, c)
+		}
+	}
+	rankCandidates(losing, tm.tieBreak)
+
+	losingBids := make([]LosingBid, len(losing))
+	for i, c := range losing {
+		losingBids[i] = LosingBid{
+			TeamID:     c.bid.TeamID,
+			Priority:   c.bid.Priority,
+			Score:      c.score,
+			Cost:       c.cost,
+			SkipReason: c.skipReason,
+		}
+		if c.row != nil {
+			losingBids[i].BidID = c.row.BidID
+		}
+	}
+
+	for _, result := range results {
+		result.AuctionID = auctionID
+		result.UserID = scored[0].bid.UserID
+		result.LosingBids = losingBids
+	}
+}
+
+// award settles the best-ranked candidates, up to cfg's winner count and
+// each team at most once, falling back to the next if configured to, and
+// reports the winners best first. An error after some winners were settled
+// is returned along with their results.
+func (tm *Manager) award(ctx context.Context, candidates []*candidate, cfg AuctionConfig, lock *auctionLock) ([]*AuctionResult, error) {
+	rankCandidates(candidates, tm.tieBreak)
+
+	winners := cfg.winners()
+	won := make(map[string]bool, winners)
+	var results []*AuctionResult
+	for i, c := range candidates {
+		if len(results) == winners {
+			break
+		}
+		if won[c.bid.TeamID] {
+			// a team's weaker bids don't compete for the remaining slots
+			continue
+		}
+
+		vetoed, err := tm.vetoed(ctx, c)
+		if err != nil {
+			return results, err
+		}
+		if vetoed {
+			tm.logger.Info("auction winner vetoed, falling back to next bid", zap.String("team_id", c.bid.TeamID))
+			continue
+		}
+
+		c.price, err = tm.clearingPrice(ctx, c, candidates[i+1:], won, true)
+		if err != nil {
+			return results, err
+		}
+
+		result, err := tm.settle(ctx, c, cfg, lock)
+		if err == nil {
+			c.won = true
+			won[c.bid.TeamID] = true
+			results = append(results, result)
+			if tm.degraded != nil {
+				tm.degraded.charged(c.bid.TeamID, c.bid.Currency, result.RemainingBalance, true, tm.clock.Now().UnixMilli())
+			}
+			if cfg.batch != nil {
+				cfg.batch.charged(c.bid, result, tm.clock.Now().UnixMilli())
+			}
+
+			tm.logger.Info(
+				"auction won",
+				zap.String("team_id", c.bid.TeamID),
+				zap.String("user_id", c.bid.UserID),
+				zap.String("bid_id", result.BidID),
+				zap.Int64("priority", c.bid.Priority),
+				zap.Int64("price", c.price),
+				zap.Int64("remaining_balance", result.RemainingBalance),
+			)
+			continue
+		}
+
+		// the state read while scoring may be stale by the time we charge
+		if !tm.chargeFallback ||
+			!(errors.Is(err, ErrInsufficientBalance) || errors.Is(err, ErrWinCooldown) ||
+				errors.Is(err, ErrBudgetExceeded) || errors.Is(err, ErrQuotaExceeded)) {
+			return results, err
+		}
+		switch {
+		case errors.Is(err, ErrBudgetExceeded):
+			c.skipReason = SkipReasonBudgetExceeded
+		case errors.Is(err, ErrQuotaExceeded):
+			c.skipReason = SkipReasonQuotaExceeded
+		default:
+			c.skipReason = SkipReasonChargeFailed
+		}
+		tm.logger.Warn(
+			"failed to charge auction winner, falling back to next bid",
+			zap.String("team_id", c.bid.TeamID),
+			zap.Int64("bid_cost", c.cost),
+			zap.Error(err),
+		)
+	}
+
+	if len(results) == 0 {
+		return nil, ErrNoWinner
+	}
+	return results, nil
+}
+
+// settle charges the winning candidate the cost it was priced at, or holds
+// its tokens if cfg asks for holds, and marks its bid as won. The charge or
+// hold and the won bid commit atomically: either both are written or
+// neither is. Both are conditional on the auction still holding lock on the
+// winner's user, so only one auction settles a user at a time even if a
+// lock outlives its TTL.
+func (tm *Manager) settle(ctx context.Context, winner *candidate, cfg AuctionConfig, lock *auctionLock) (*AuctionResult, error) {
+	userLock := lock.ref(winner.bid.UserID)
+	result := &AuctionResult{TeamID: winner.bid.TeamID, Score: winner.score, Cost: winner.price}
+
+	if cfg.UseHolds {
+		hold, err := tm.placeHold(ctx, winner, cfg.HoldTTL, userLock)
+		if err != nil {
+			return nil, err
+		}
+		winner.price = hold.Amount
+		result.HoldID = hold.HoldID
+		result.Cost = hold.Amount
+		result.RemainingBalance = winner.balance - winner.price
+	} else {
+		win := &winCharge{bid: tm.wonBidRow(winner.row), reservation: winner.reservation, lock: userLock}
+		if cfg.batch != nil {
+			win.group = cfg.batch.groups
+		}
+		balance, charged, err := tm.chargeTokens(ctx, &winner.bid, winner.price, win, nil)
+		if err != nil {
+			return nil, err
+		}
+		winner.price = charged
+		result.Cost = charged
+		result.RemainingBalance = balance
+	}
+	// the reservation was spent along with the charge or hold
+	winner.reservation = nil
+
+	result.BidID = winner.row.BidID
+	tm.markBidWon(winner.row)
+	tm.recordUserWin(ctx, winner.bid.TeamID, winner.bid.UserID, tm.clock.Now().UnixMilli())
+
+	return result, nil
+}
+
+// Refill tokens for all teams
+func (tm *Manager) RefillTokens(ctx context.Context, teams []string) error {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	for _, teamID := range teams {
+		teamID = tm.normalizeID(teamID)
+		if err := tm.refillTokenRow(ctx, teamID); err != nil {
+			return err
+		}
+		tm.recordBalance(ctx, teamID, tm.initialTokenCount, BalanceChangeRefill)
+		tm.logReputation(ReputationEvent{
+			TeamID:     teamID,
+			Reason:     ReputationEventRefill,
+			Reputation: tm.maxReputation,
+		})
+	}
+	return nil
+}
+
+// refillAttempts bounds how often refillTokenRow retries a team whose
+// balance moved while it was refilled.
+const refillAttempts = 3
+
+// refillTokenRow resets a team's balance, reputation and priority usage to
+// their initial values. The ledger records the refill as the difference from
+// the balance it replaces, so it is conditional on that balance and retried
+// if a concurrent write moved it.
+func (tm *Manager) refillTokenRow(ctx context.Context, teamID string) error {
+	for range refillAttempts {
+		var observed int64
+		row, err := tm.store.GetTokenRow(ctx, teamID, true)
+		switch {
+		case err == nil:
+			observed = row.TokenBalance
+		case !errors.Is(err, ErrTeamNotFound):
+			return err
+		}
+
+		err = tm.store.RefillTokenRow(ctx, teamID, tm.initialTokenCount, observed,
+			tm.initialBalances(), tm.InitialPriorityUsage(), tm.maxReputation, tm.clock.Now().UnixMilli())
+		if !errors.Is(err, ErrConditionFailed) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: refill of team %s", ErrAuctionConflict, teamID)
+}
+
+func (tm *Manager) GetBids(ctx context.Context, teamID string) ([]BidRow, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	teamID = tm.normalizeID(teamID)
+
+	var bids []BidRow
+	for _, pk := range tm.bidPKs(teamID) {
+		shardBids, err := tm.store.QueryBids(ctx, BidQuery{Pk: pk, SkPrefix: teamID})
+		if err != nil {
+			return nil, err
+		}
+		bids = append(bids, shardBids...)
+	}
+
+	// merge shards back into sort key order
+	slices.SortFunc(bids, func(a, b BidRow) int {
+		return strings.Compare(a.Sk, b.Sk)
+	})
+	return bids, nil
+}
+
+// GetBidsForUser returns the bids every team placed on a user, oldest
+// first, e.g. to audit which teams bid on them. It reads the
+// bids_by_target index, which is eventually consistent, so a bid recorded
+// moments ago may not be returned yet.
+func (tm *Manager) GetBidsForUser(ctx context.Context, userID string) ([]BidRow, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.store.QueryBidsByTarget(ctx, tm.normalizeID(userID))
+}
+
+// BidFilter restricts the bids returned by GetBidsPage. Zero-valued fields
+// match every bid.
+type BidFilter struct {
+	// FromMs and ToMs bound CreatedAtMs to [FromMs, ToMs).
+	FromMs   int64
+	ToMs     int64
+	Priority int64
+	// UserID is the user the bid's auction was for.
+	UserID string
+}
+
+func (f BidFilter) matches(br *BidRow) bool {
+	return (f.FromMs <= 0 || br.CreatedAtMs >= f.FromMs) &&
+		(f.ToMs <= 0 || br.CreatedAtMs < f.ToMs) &&
+		(f.Priority == 0 || br.Priority == f.Priority) &&
+		(f.UserID == "" || br.Target == f.UserID)
+}
+
+// BidPageQuery selects a page of a team's bids.
+type BidPageQuery struct {
+	BidFilter
+	// Cursor is a previous page's NextCursor; empty starts at the first bid.
+	Cursor string
+	// PageSize defaults to DefaultBidPageSize.
+	PageSize int
+}
+
+// BidPage is one page of a team's bids, in sort key order.
+type BidPage struct {
+	Bids []BidRow `json:"bids"`
+	// NextCursor continues with the next page. It is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// GetBidsPage returns a page of a team's bids matching q's filter, in the
+// sort key order GetBids returns them in. The filter is applied as DynamoDB
+// reads, so a selective filter reads, and bills for, many bids per page.
+func (tm *Manager) GetBidsPage(ctx context.Context, teamID string, q BidPageQuery) (*BidPage, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	teamID = tm.normalizeID(teamID)
+	pageSize := q.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultBidPageSize
+	}
+	filter := q.BidFilter
+	if filter.UserID != "" {
+		filter.UserID = tm.normalizeID(filter.UserID)
+	}
+
+	// every one of the team's sort keys follows its ID and separator
+	afterSk := teamID + "#"
+	if q.Cursor != "" {
+		sk, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil || !strings.HasPrefix(string(sk), afterSk) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidCursor, q.Cursor)
+		}
+		afterSk = string(sk)
+	}
+
+	// reading one bid past the page from each shard tells whether there is
+	// another page
+	bids := []BidRow{}
+	for _, pk := range tm.bidPKs(teamID) {
+		shardBids, err := tm.store.QueryBids(ctx, BidQuery{
+			Pk:      pk,
+			AfterSk: afterSk,
+			Filter:  filter,
+			Limit:   pageSize + 1,
+		})
+		if err != nil {
+			return nil, err
+		}
+		bids = append(bids, shardBids...)
+	}
+
+	slices.SortFunc(bids, func(a, b BidRow) int {
+		return strings.Compare(a.Sk, b.Sk)
+	})
+
+	page := &BidPage{Bids: bids}
+	if len(bids) > pageSize {
+		page.Bids = bids[:pageSize]
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(page.Bids[pageSize-1].Sk))
+	}
+	return page, nil
+}
+
+// GetWinningBids returns every bid of a team that won its auction. It is a
+// filtered query: DynamoDB still reads, and bills for, all of the team's bid
+// rows, losing ones included, across as many pages as needed.
+func (tm *Manager) GetWinningBids(ctx context.Context, teamID string) ([]BidRow, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	teamID = tm.normalizeID(teamID)
+
+	var bids []BidRow
+	for _, pk := range tm.bidPKs(teamID) {
+		shardBids, err := tm.store.QueryBids(ctx, BidQuery{Pk: pk, SkPrefix: teamID, WonOnly: true})
+		if err != nil {
+			return nil, err
+		}
+		bids = append(bids, shardBids...)
+	}
+
+	slices.SortFunc(bids, func(a, b BidRow) int {
+		return strings.Compare(a.Sk, b.Sk)
+	})
+	return bids, nil
+}
+
+// GetBidCountByPriority tallies a team's recorded bids by priority. It reads
+// every one of the team's bid rows.
+func (tm *Manager) GetBidCountByPriority(ctx context.Context, teamID string) (map[int64]int, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	teamID = tm.normalizeID(teamID)
+
+	counts := make(map[int64]int)
+	for _, pk := range tm.bidPKs(teamID) {
+		shardBids, err := tm.store.QueryBids(ctx, BidQuery{Pk: pk, SkPrefix: teamID})
+		if err != nil {
+			return nil, err
+		}
+		for _, bid := range shardBids {
+			counts[bid.Priority]++
+		}
+	}
+
+	return counts, nil
+}
+
+// GetRecentBids returns a team's n most recent bids, newest first. It reads
+// the bids_by_created_at index, which is eventually consistent, so a bid
+// recorded moments ago may not be returned yet.
+func (tm *Manager) GetRecentBids(ctx context.Context, teamID string, n int) ([]BidRow, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	teamID = tm.normalizeID(teamID)
+
+	if n <= 0 {
+		return nil, nil
+	}
+
+	// each shard's n most recent bids include the team's overall n most recent
+	var bids []BidRow
+	for _, pk := range tm.bidPKs(teamID) {
+		shardBids, err := tm.store.QueryBids(ctx, BidQuery{Pk: pk, NewestFirst: true, Limit: n})
+		if err != nil {
+			return nil, err
+		}
+		bids = append(bids, shardBids...)
+	}
+
+	slices.SortStableFunc(bids, func(a, b BidRow) int {
+		return cmp.Compare(b.CreatedAtMs, a.CreatedAtMs)
+	})
+	return bids[:min(n, len(bids))], nil
+}
+
+// PurgeBids deletes every recorded bid for a team and returns how many were
+// deleted. The team's token row is left intact.
+func (tm *Manager) PurgeBids(ctx context.Context, teamID string) (int, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	teamID = tm.normalizeID(teamID)
+
+	var deleted int
+	for _, pk := range tm.bidPKs(teamID) {
+		n, err := tm.store.DeleteBids(ctx, pk)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
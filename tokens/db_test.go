@@ -0,0 +1,574 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/rand"
+)
+
+func TestRandSourceReproducible(t *testing.T) {
+	bids := []Bid{
+		{TeamID: "a", UserID: "u1", Priority: 5},
+		{TeamID: "b", UserID: "u1", Priority: 5},
+		{TeamID: "c", UserID: "u1", Priority: 5},
+	}
+	tests := []struct {
+		name     string
+		seeds    [2]uint64
+		wantSame bool
+	}{
+		{name: "same seed", seeds: [2]uint64{42, 42}, wantSame: true},
+		{name: "different seeds", seeds: [2]uint64{42, 43}, wantSame: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// several auctions, so the winners of tied bids don't match by chance
+			var runs [2][]string
+			for i, seed := range tt.seeds {
+				tm := newTestManager(t, []string{"a", "b", "c"},
+					WithRandSource(rand.NewSource(seed)), WithTieBreak(TieBreakRandom))
+				for range 5 {
+					result, err := tm.RunAuction(context.Background(), bids)
+					if err != nil {
+						t.Fatalf("RunAuction: %v", err)
+					}
+					runs[i] = append(runs[i], result.AuctionID, result.BidID, result.TeamID)
+				}
+			}
+
+			if same := slices.Equal(runs[0], runs[1]); same != tt.wantSame {
+				t.Errorf("got %v and %v, want same=%t", runs[0], runs[1], tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestGetWinningBid(t *testing.T) {
+	ctx := context.Background()
+	tm := newTestManager(t, []string{"a", "b"})
+
+	result, err := tm.RunAuction(ctx, []Bid{
+		{TeamID: "a", UserID: "u", Priority: 5},
+		{TeamID: "b", UserID: "u", Priority: 1},
+	})
+	if err != nil {
+		t.Fatalf("RunAuction: %v", err)
+	}
+	if len(result.LosingBids) != 1 {
+		t.Fatalf("got losing bids %+v, want one", result.LosingBids)
+	}
+
+	tests := []struct {
+		name    string
+		teamID  string
+		bidID   string
+		wantErr error
+	}{
+		{name: "winning bid", teamID: "a", bidID: result.BidID},
+		{name: "losing bid", teamID: "b", bidID: result.LosingBids[0].BidID, wantErr: ErrBidNotWon},
+		{name: "unknown bid", teamID: "a", bidID: "bid_missing", wantErr: ErrBidNotFound},
+		{name: "another team's bid", teamID: "b", bidID: result.BidID, wantErr: ErrBidNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, err := tm.GetWinningBid(ctx, tt.teamID, tt.bidID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetWinningBid = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (row.BidID != result.BidID || row.TeamID() != "a" || !row.Won) {
+				t.Errorf("got %+v, want the won bid %s of a", row, result.BidID)
+			}
+		})
+	}
+}
+
+func TestBatchGetTokenBalance(t *testing.T) {
+	var many []string
+	for i := range 2*batchGetLimit + 1 {
+		many = append(many, fmt.Sprintf("team-%d", i))
+	}
+
+	tests := []struct {
+		name        string
+		teams       []string
+		request     []string
+		wantRows    int
+		wantMissing []string
+	}{
+		{name: "all found", teams: []string{"a", "b"}, request: []string{"a", "b"}, wantRows: 2},
+		{
+			name: "missing teams reported", teams: []string{"a"}, request: []string{"a", "x", "y"},
+			wantRows: 1, wantMissing: []string{"x", "y"},
+		},
+		{name: "duplicates read once", teams: []string{"a"}, request: []string{"a", "a"}, wantRows: 1},
+		{name: "more than one batch", teams: many, request: many, wantRows: len(many)},
+		{name: "none", request: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := newTestManager(t, tt.teams, WithBalanceFetchParallelism(2))
+
+			rows, missing, err := tm.BatchGetTokenBalance(context.Background(), tt.request)
+			if err != nil {
+				t.Fatalf("BatchGetTokenBalance: %v", err)
+			}
+			if len(rows) != tt.wantRows {
+				t.Errorf("got %d rows, want %d", len(rows), tt.wantRows)
+			}
+			for teamID, row := range rows {
+				if row.TeamID != teamID || row.TokenBalance != InitialTokenCount {
+					t.Errorf("row of %s = %+v", teamID, row)
+				}
+			}
+			slices.Sort(missing)
+			if !slices.Equal(missing, tt.wantMissing) {
+				t.Errorf("missing = %v, want %v", missing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestPurgeBids(t *testing.T) {
+	tests := []struct {
+		name   string
+		shards int
+		team   string
+		want   int
+	}{
+		{name: "team with bids", team: "a", want: 3},
+		{name: "across shards", shards: 4, team: "a", want: 3},
+		{name: "team without bids", team: "c", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var opts []Option
+			if tt.shards > 0 {
+				opts = append(opts, WithBidShards(tt.shards))
+			}
+			tm := newTestManager(t, []string{"a", "b", "c"}, opts...)
+			for range 3 {
+				_, err := tm.RunAuction(ctx, []Bid{
+					{TeamID: "a", UserID: "u", Priority: 5},
+					{TeamID: "b", UserID: "u", Priority: 1},
+				})
+				if err != nil {
+					t.Fatalf("RunAuction: %v", err)
+				}
+			}
+			balance, _, err := tm.GetTokenBalance(ctx, tt.team)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			deleted, err := tm.PurgeBids(ctx, tt.team)
+			if err != nil {
+				t.Fatalf("PurgeBids: %v", err)
+			}
+			if deleted != tt.want {
+				t.Errorf("deleted %d bids, want %d", deleted, tt.want)
+			}
+
+			if bids, err := tm.GetBids(ctx, tt.team); err != nil || len(bids) != 0 {
+				t.Errorf("GetBids after purge = %d bids, %v", len(bids), err)
+			}
+			// other teams' bids and the team's own token row are kept
+			if bids, err := tm.GetBids(ctx, "b"); err != nil || len(bids) != 3 {
+				t.Errorf("GetBids of b = %d bids, %v, want 3", len(bids), err)
+			}
+			if after, _, err := tm.GetTokenBalance(ctx, tt.team); err != nil || after != balance {
+				t.Errorf("balance after purge = %d, %v, want %d", after, err, balance)
+			}
+		})
+	}
+}
+
+func TestGetRecentBids(t *testing.T) {
+	tests := []struct {
+		name   string
+		shards int
+		n      int
+		want   int
+	}{
+		{name: "fewer than recorded", n: 2, want: 2},
+		{name: "more than recorded", n: 10, want: 5},
+		{name: "across shards", shards: 3, n: 3, want: 3},
+		{name: "none", n: 0, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := newTestClock()
+			opts := []Option{WithClock(clock)}
+			if tt.shards > 0 {
+				opts = append(opts, WithBidShards(tt.shards))
+			}
+			tm := newTestManager(t, []string{"a"}, opts...)
+
+			var recorded []string
+			for range 5 {
+				clock.Advance(time.Second)
+				result, err := tm.RunAuction(ctx, []Bid{{TeamID: "a", UserID: "u", Priority: 1}})
+				if err != nil {
+					t.Fatalf("RunAuction: %v", err)
+				}
+				recorded = append(recorded, result.BidID)
+			}
+			slices.Reverse(recorded)
+
+			bids, err := tm.GetRecentBids(ctx, "a", tt.n)
+			if err != nil {
+				t.Fatalf("GetRecentBids: %v", err)
+			}
+			var got []string
+			for _, bid := range bids {
+				got = append(got, bid.BidID)
+			}
+			// newest first
+			if want := recorded[:tt.want]; !slices.Equal(got, want) && len(got)+len(want) > 0 {
+				t.Errorf("got bids %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestGetWinningBids(t *testing.T) {
+	tests := []struct {
+		name   string
+		shards int
+		team   string
+		want   int
+	}{
+		{name: "winner", team: "a", want: 2},
+		{name: "winner across shards", shards: 3, team: "a", want: 2},
+		{name: "sometimes winner", team: "b", want: 1},
+		{name: "never won", team: "c", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var opts []Option
+			if tt.shards > 0 {
+				opts = append(opts, WithBidShards(tt.shards))
+			}
+			tm := newTestManager(t, []string{"a", "b", "c"}, opts...)
+			for i, user := range []string{"u", "v", "w"} {
+				// a wins the first two auctions, b the last
+				priorities := map[string]int64{"a": 5, "b": 3, "c": 1}
+				if i == 2 {
+					priorities["b"] = 7
+				}
+				var bids []Bid
+				for _, team := range []string{"a", "b", "c"} {
+					bids = append(bids, Bid{TeamID: team, UserID: user, Priority: priorities[team]})
+				}
+				if _, err := tm.RunAuction(ctx, bids); err != nil {
+					t.Fatalf("RunAuction: %v", err)
+				}
+			}
+
+			bids, err := tm.GetWinningBids(ctx, tt.team)
+			if err != nil {
+				t.Fatalf("GetWinningBids: %v", err)
+			}
+			if len(bids) != tt.want {
+				t.Errorf("got %d winning bids, want %d", len(bids), tt.want)
+			}
+			for _, bid := range bids {
+				if !bid.Won || bid.TeamID() != tt.team {
+					t.Errorf("got %+v, want only won bids of %s", bid, tt.team)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordedCostBreakdown(t *testing.T) {
+	tests := []struct {
+		name           string
+		priority       int64
+		reputation     int64
+		wantBase       int64
+		wantMultiplier float64
+		wantCost       int64
+	}{
+		{name: "max reputation", priority: 5, reputation: MaxReputationScore, wantBase: 5, wantMultiplier: 1, wantCost: 5},
+		{name: "half reputation", priority: 10, reputation: 50, wantBase: 10, wantMultiplier: 1.75, wantCost: 17},
+		{name: "zero reputation", priority: 1, reputation: 0, wantBase: 1, wantMultiplier: 2.5, wantCost: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := NewMemoryStore()
+			tm := newTestManager(t, []string{"a"}, WithStore(mem))
+			mem.tokens["a"].ReputationScore = tt.reputation
+
+			if _, err := tm.RunAuction(ctx, []Bid{{TeamID: "a", UserID: "u", Priority: tt.priority}}); err != nil {
+				t.Fatalf("RunAuction: %v", err)
+			}
+			bids, err := tm.GetBids(ctx, "a")
+			if err != nil || len(bids) != 1 {
+				t.Fatalf("GetBids = %d bids, %v, want one", len(bids), err)
+			}
+
+			bid := bids[0]
+			if bid.BaseCost != tt.wantBase || bid.Multiplier != tt.wantMultiplier ||
+				bid.Reputation != tt.reputation || bid.Cost != tt.wantCost {
+				t.Errorf("recorded base %d, multiplier %v, reputation %d, cost %d; want %d, %v, %d, %d",
+					bid.BaseCost, bid.Multiplier, bid.Reputation, bid.Cost,
+					tt.wantBase, tt.wantMultiplier, tt.reputation, tt.wantCost)
+			}
+		})
+	}
+}
+
+func TestRunAuctionWithState(t *testing.T) {
+	tests := []struct {
+		name string
+		// state overrides the teams' stored rows, keyed by team ID
+		state      map[string]TokenDBRow
+		wantWinner string
+		wantErr    error
+	}{
+		{
+			name: "scored against the given state",
+			state: map[string]TokenDBRow{
+				"a": {TeamID: "a", TokenBalance: 1000, ReputationScore: 0},
+				"b": {TeamID: "b", TokenBalance: 1000, ReputationScore: 100},
+			},
+			wantWinner: "b",
+		},
+		{
+			name: "unaffordable in the given state",
+			state: map[string]TokenDBRow{
+				"a": {TeamID: "a", TokenBalance: 1000, ReputationScore: 100},
+				"b": {TeamID: "b", TokenBalance: 0, ReputationScore: 100},
+			},
+			wantWinner: "a",
+		},
+		{
+			name:    "team missing from the state",
+			state:   map[string]TokenDBRow{"a": {TeamID: "a", TokenBalance: 1000}},
+			wantErr: ErrTeamNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tm := newTestManager(t, []string{"a", "b"})
+
+			result, err := tm.RunAuctionWithState(ctx, []Bid{
+				{TeamID: "a", UserID: "u", Priority: 5},
+				{TeamID: "b", UserID: "u", Priority: 5},
+			}, tt.state)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RunAuctionWithState = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if result.TeamID != tt.wantWinner {
+				t.Errorf("winner = %s, want %s", result.TeamID, tt.wantWinner)
+			}
+			if balance := tokenRow(t, tm, tt.wantWinner).TokenBalance; balance != InitialTokenCount-result.Cost {
+				t.Errorf("balance of %s = %d, want %d", tt.wantWinner, balance, InitialTokenCount-result.Cost)
+			}
+			// the auction is settled like any other
+			if bids, err := tm.GetBids(ctx, tt.wantWinner); err != nil || len(bids) != 1 {
+				t.Errorf("GetBids = %d bids, %v, want the winning bid recorded", len(bids), err)
+			}
+			if history, err := tm.GetAuctionHistory(ctx, "u"); err != nil || len(history) != 1 {
+				t.Errorf("GetAuctionHistory = %d auctions, %v, want the auction recorded", len(history), err)
+			}
+		})
+	}
+}
+
+func TestRunAuctionWithStateFrequencyCap(t *testing.T) {
+	ctx := context.Background()
+	tm := newTestManager(t, []string{"a", "b"}, WithFrequencyCap(FrequencyCap{MaxWins: 1, Window: time.Hour}))
+	state := map[string]TokenDBRow{
+		"a": {TeamID: "a", TokenBalance: 1000, ReputationScore: 100},
+		"b": {TeamID: "b", TokenBalance: 1000, ReputationScore: 0},
+	}
+	bids := []Bid{
+		{TeamID: "a", UserID: "u", Priority: 5},
+		{TeamID: "b", UserID: "u", Priority: 5},
+	}
+
+	for _, want := range []string{"a", "b"} {
+		result, err := tm.RunAuctionWithState(ctx, bids, state)
+		if err != nil {
+			t.Fatalf("RunAuctionWithState: %v", err)
+		}
+		// a is at its cap for u after its first win
+		if result.TeamID != want {
+			t.Errorf("winner = %s, want %s", result.TeamID, want)
+		}
+	}
+}
+
+func TestRunAuctionWithStaleState(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryStore()
+	tm := newTestManager(t, []string{"a", "b"}, WithStore(mem))
+	state := map[string]TokenDBRow{"a": *tokenRow(t, tm, "a"), "b": *tokenRow(t, tm, "b")}
+	// a spent its tokens since the state was read
+	mem.tokens["a"].TokenBalance = 0
+
+	result, err := tm.RunAuctionWithState(ctx, []Bid{
+		{TeamID: "a", UserID: "u", Priority: 5},
+		{TeamID: "b", UserID: "u", Priority: 1},
+	}, state)
+	if err != nil {
+		t.Fatalf("RunAuctionWithState: %v", err)
+	}
+	if result.TeamID != "b" {
+		t.Errorf("winner = %s, want b after a's charge failed", result.TeamID)
+	}
+	if balance := tokenRow(t, tm, "a").TokenBalance; balance != 0 {
+		t.Errorf("balance of a = %d, want it never overdrawn", balance)
+	}
+}
+
+func TestGetBidCountByPriority(t *testing.T) {
+	tests := []struct {
+		name   string
+		shards int
+		team   string
+		want   map[int64]int
+	}{
+		{name: "bids at several priorities", team: "a", want: map[int64]int{5: 2, 3: 1}},
+		{name: "across shards", shards: 3, team: "a", want: map[int64]int{5: 2, 3: 1}},
+		{name: "no bids", team: "c", want: map[int64]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var opts []Option
+			if tt.shards > 0 {
+				opts = append(opts, WithBidShards(tt.shards))
+			}
+			tm := newTestManager(t, []string{"a", "b", "c"}, opts...)
+			for _, priority := range []int64{5, 3, 5} {
+				_, err := tm.RunAuction(ctx, []Bid{
+					{TeamID: "a", UserID: "u", Priority: priority},
+					{TeamID: "b", UserID: "u", Priority: 1},
+				})
+				if err != nil {
+					t.Fatalf("RunAuction: %v", err)
+				}
+			}
+
+			got, err := tm.GetBidCountByPriority(ctx, tt.team)
+			if err != nil {
+				t.Fatalf("GetBidCountByPriority: %v", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("counts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCancelledAuctionAbortsBids(t *testing.T) {
+	tests := []struct {
+		name        string
+		cancel      bool
+		buffered    bool
+		wantAborted bool
+	}{
+		{name: "resolved", wantAborted: false},
+		{name: "cancelled", cancel: true, wantAborted: true},
+		{name: "cancelled with buffered bids", cancel: true, buffered: true, wantAborted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// the veto runs after the bids are recorded, before any charge
+			veto := func(ctx context.Context, teamID string) (bool, error) {
+				if tt.cancel {
+					cancel()
+					return false, ctx.Err()
+				}
+				return false, nil
+			}
+			opts := []Option{WithWinnerVeto(veto)}
+			if tt.buffered {
+				opts = append(opts, WithBidBuffer(BidBufferConfig{MaxSize: 100}))
+			}
+			tm := newTestManager(t, []string{"a", "b"}, opts...)
+
+			_, err := tm.RunAuction(ctx, []Bid{
+				{TeamID: "a", UserID: "u", Priority: 5},
+				{TeamID: "b", UserID: "u", Priority: 1},
+			})
+			if tt.cancel != errors.Is(err, context.Canceled) {
+				t.Fatalf("RunAuction = %v, want cancelled %t", err, tt.cancel)
+			}
+			if err := tm.Flush(context.Background()); err != nil {
+				t.Fatalf("Flush: %v", err)
+			}
+
+			for _, team := range []string{"a", "b"} {
+				bids, err := tm.GetBids(context.Background(), team)
+				if err != nil || len(bids) != 1 {
+					t.Fatalf("GetBids(%s) = %d bids, %v, want one", team, len(bids), err)
+				}
+				if bids[0].Aborted != tt.wantAborted {
+					t.Errorf("bid of %s aborted = %t, want %t", team, bids[0].Aborted, tt.wantAborted)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiWinnerIdempotencyAfterPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryStore()
+	store := &interferingStore{Store: mem}
+	tm := newTestManager(t, []string{"a", "b"}, WithStore(store), WithChargeFallback(false))
+	// b spends its tokens elsewhere while a, the first winner, is charged
+	store.interfere = func() {
+		if err := mem.SetTokenBalance(ctx, "b", 0, InitialTokenCount, 0); err != nil {
+			t.Fatalf("SetTokenBalance: %v", err)
+		}
+	}
+
+	bids := []Bid{
+		{TeamID: "a", UserID: "u", Priority: 10},
+		{TeamID: "b", UserID: "u", Priority: 5},
+	}
+	cfg := AuctionConfig{Winners: 2, IdempotencyKey: "k"}
+	results, err := tm.RunMultiWinnerAuction(ctx, bids, cfg)
+	if !errors.Is(err, ErrInsufficientBalance) || len(results) != 1 {
+		t.Fatalf("RunMultiWinnerAuction = %d results, %v, want a's and ErrInsufficientBalance", len(results), err)
+	}
+	charged := tokenRow(t, tm, "a").TokenBalance
+
+	// b topped up; the retry must not charge a again
+	if err := mem.SetTokenBalance(ctx, "b", InitialTokenCount, 0, 0); err != nil {
+		t.Fatalf("SetTokenBalance: %v", err)
+	}
+	results, err = tm.RunMultiWinnerAuction(ctx, bids, cfg)
+	if err != nil {
+		t.Fatalf("retried RunMultiWinnerAuction: %v", err)
+	}
+	if len(results) != 1 || results[0].TeamID != "a" {
+		t.Errorf("retry returned %d results, want a's from the first run", len(results))
+	}
+	if balance := tokenRow(t, tm, "a").TokenBalance; balance != charged {
+		t.Errorf("balance of a = %d after retry, want %d", balance, charged)
+	}
+	if balance := tokenRow(t, tm, "b").TokenBalance; balance != InitialTokenCount {
+		t.Errorf("balance of b = %d after retry, want %d", balance, InitialTokenCount)
+	}
+}
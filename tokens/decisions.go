@@ -0,0 +1,101 @@
+package tokens
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// AuctionDecision is the record of one auction written to the decision log.
+type AuctionDecision struct {
+	DecidedAtMs int64 `json:"decided_at_ms"`
+	// Result is the top winner's.
+	Result *AuctionResult `json:"result,omitempty"`
+	// Results holds every winner's, best first, for a multi-winner auction.
+	Results []*AuctionResult `json:"results,omitempty"`
+	Error   string           `json:"error,omitempty"`
+	Bids    []BidDecision    `json:"bids"`
+}
+
+// BidDecision is how a single bid fared in an auction.
+type BidDecision struct {
+	TeamID     string        `json:"team_id"`
+	UserID     string        `json:"user_id"`
+	Priority   int64         `json:"priority"`
+	BidID      string        `json:"bid_id,omitempty"`
+	Score      float64       `json:"score"`
+	Balance    int64         `json:"balance"`
+	Cost       CostBreakdown `json:"cost"`
+	Affordable bool          `json:"affordable"`
+	SkipReason string        `json:"skip_reason,omitempty"`
+	Won        bool          `json:"won"`
+}
+
+// jsonLog serializes records as NDJSON onto a writer shared by concurrent
+// auctions.
+type jsonLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newJSONLog(w io.Writer) *jsonLog {
+	return &jsonLog{enc: json.NewEncoder(w)}
+}
+
+func (l *jsonLog) write(v any) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Encode writes the value and its trailing newline in a single Write
+	return l.enc.Encode(v)
+}
+
+// logDecision appends an auction's outcome to the decision log, if any.
+func (tm *Manager) logDecision(scored []*candidate, results []*AuctionResult, err error) {
+	if tm.decisionLog == nil {
+		return
+	}
+
+	decision := AuctionDecision{
+		DecidedAtMs: tm.clock.Now().UnixMilli(),
+		Bids:        bidDecisions(scored),
+	}
+	if len(results) > 0 {
+		decision.Result = results[0]
+	}
+	if len(results) > 1 {
+		decision.Results = results
+	}
+	if err != nil {
+		decision.Error = err.Error()
+	}
+
+	if err := tm.decisionLog.write(decision); err != nil {
+		tm.logger.Warn("failed to write auction decision", zap.Error(err))
+	}
+}
+
+// bidDecisions describes how each scored bid fared.
+func bidDecisions(scored []*candidate) []BidDecision {
+	decisions := make([]BidDecision, 0, len(scored))
+	for _, c := range scored {
+		bd := BidDecision{
+			TeamID:     c.bid.TeamID,
+			UserID:     c.bid.UserID,
+			Priority:   c.bid.Priority,
+			Score:      c.score,
+			Balance:    c.balance,
+			Cost:       c.breakdown,
+			Affordable: c.affordable(),
+			SkipReason: c.skipReason,
+			Won:        c.won,
+		}
+		if c.row != nil {
+			bd.BidID = c.row.BidID
+		}
+		decisions = append(decisions, bd)
+	}
+	return decisions
+}
@@ -0,0 +1,84 @@
+package tokens
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestDecisionLog(t *testing.T) {
+	tests := []struct {
+		name       string
+		bids       []Bid
+		wantWinner string
+		wantErr    error
+		// wantSkips is the skip reason of each logged bid, by team
+		wantSkips map[string]string
+	}{
+		{
+			name: "won",
+			bids: []Bid{
+				{TeamID: "a", UserID: "u", Priority: 5},
+				{TeamID: "b", UserID: "u", Priority: 1},
+			},
+			wantWinner: "a",
+			wantSkips:  map[string]string{"a": "", "b": ""},
+		},
+		{
+			name:      "no winner",
+			bids:      []Bid{{TeamID: "poor", UserID: "u", Priority: 5}},
+			wantErr:   ErrNoWinner,
+			wantSkips: map[string]string{"poor": SkipReasonInsufficientBalance},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			mem := NewMemoryStore()
+			tm := newTestManager(t, []string{"a", "b", "poor"}, WithStore(mem), WithDecisionLog(&buf))
+			mem.tokens["poor"].TokenBalance = 0
+
+			// a second auction checks the log has one line per auction
+			for range 2 {
+				if _, err := tm.RunAuction(context.Background(), tt.bids); !errors.Is(err, tt.wantErr) {
+					t.Fatalf("RunAuction = %v, want %v", err, tt.wantErr)
+				}
+			}
+
+			var decisions []AuctionDecision
+			scanner := bufio.NewScanner(&buf)
+			for scanner.Scan() {
+				var d AuctionDecision
+				if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+					t.Fatalf("decoding %s: %v", scanner.Text(), err)
+				}
+				decisions = append(decisions, d)
+			}
+			if len(decisions) != 2 {
+				t.Fatalf("got %d decisions, want 2", len(decisions))
+			}
+
+			d := decisions[0]
+			if tt.wantErr != nil && d.Error == "" {
+				t.Error("decision has no error")
+			}
+			if tt.wantWinner != "" && (d.Result == nil || d.Result.TeamID != tt.wantWinner) {
+				t.Errorf("decision result %+v, want a win by %s", d.Result, tt.wantWinner)
+			}
+			if len(d.Bids) != len(tt.wantSkips) {
+				t.Fatalf("got %d bid decisions, want %d", len(d.Bids), len(tt.wantSkips))
+			}
+			for _, bd := range d.Bids {
+				if bd.SkipReason != tt.wantSkips[bd.TeamID] {
+					t.Errorf("bid of %s skipped for %q, want %q", bd.TeamID, bd.SkipReason, tt.wantSkips[bd.TeamID])
+				}
+				if bd.Won != (bd.TeamID == tt.wantWinner) {
+					t.Errorf("bid of %s won = %t", bd.TeamID, bd.Won)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,535 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDegradedMaxPending     = 1000
+	defaultDegradedSettleInterval = 10 * time.Second
+	defaultDegradedMaxStaleness   = 5 * time.Minute
+
+	// degradedCloseTimeout bounds the last attempt Close makes to settle
+	// degraded auctions.
+	degradedCloseTimeout = 10 * time.Second
+)
+
+// DegradedConfig tunes degraded mode; see WithDegradedMode. Zero fields take
+// their defaults.
+type DegradedConfig struct {
+	// MaxPending bounds the settlements queued at once. Once it is reached,
+	// auctions fail with ErrStoreUnavailable rather than award tokens that
+	// may never be charged. It defaults to 1000.
+	MaxPending int
+	// SettleInterval is how often queued settlements are charged, once the
+	// store is available. It defaults to 10 seconds.
+	SettleInterval time.Duration
+	// MaxStaleness is how long a team's balance is cached for. A team whose
+	// balance wasn't read within it can't win a degraded auction. It
+	// defaults to 5 minutes.
+	MaxStaleness time.Duration
+}
+
+func (c DegradedConfig) withDefaults() DegradedConfig {
+	if c.MaxPending <= 0 {
+		c.MaxPending = defaultDegradedMaxPending
+	}
+	if c.SettleInterval <= 0 {
+		c.SettleInterval = defaultDegradedSettleInterval
+	}
+	if c.MaxStaleness <= 0 {
+		c.MaxStaleness = defaultDegradedMaxStaleness
+	}
+	return c
+}
+
+// DegradedSettlement is the charge owed by the winner of a degraded auction,
+// queued until the store can take it.
+type DegradedSettlement struct {
+	AuctionID  string `json:"auction_id"`
+	TeamID     string `json:"team_id"`
+	UserID     string `json:"user_id"`
+	Priority   int64  `json:"priority"`
+	Currency   string `json:"currency,omitempty"`
+	Cost       int64  `json:"cost"`
+	QueuedAtMs int64  `json:"queued_at_ms"`
+	// Attempts is how many times charging it failed for want of the store.
+	Attempts int `json:"attempts"`
+}
+
+// degradable reports whether an auction run with cfg can run in degraded
+// mode. Holds, reservations and idempotency keys all need the store.
+func (cfg AuctionConfig) degradable() bool {
+	return !cfg.UseHolds && !cfg.ReserveBids && cfg.IdempotencyKey == ""
+}
+
+type cachedTokenRow struct {
+	row      TokenDBRow
+	readAtMs int64
+}
+
+type owedKey struct {
+	teamID   string
+	currency string
+}
+
+// degradedMode holds what degraded auctions run on: the token rows last
+// read for each team and the settlements queued since.
+type degradedMode struct {
+	cfg DegradedConfig
+
+	mu   sync.Mutex
+	rows map[string]cachedTokenRow
+	// pending are the queued settlements, oldest first, and owed what they
+	// add up to for each team and currency.
+	pending []*DegradedSettlement
+	owed    map[owedKey]int64
+	// users are those a degraded auction is running for.
+	users map[string]bool
+}
+
+func newDegradedMode(cfg DegradedConfig) *degradedMode {
+	return &degradedMode{
+		cfg:   cfg.withDefaults(),
+		rows:  make(map[string]cachedTokenRow),
+		owed:  make(map[owedKey]int64),
+		users: make(map[string]bool),
+	}
+}
+
+// remember caches token rows read at nowMs.
+func (d *degradedMode) remember(rows map[string]*TokenDBRow, nowMs int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for teamID, row := range rows {
+		d.rows[teamID] = cachedTokenRow{row: *cloneTokenRow(row), readAtMs: nowMs}
+	}
+}
+
+// charged updates a team's cached balance after a charge left it at balance.
+// won marks the charge as an auction win, starting the team's cooldown.
+func (d *degradedMode) charged(teamID, currency string, balance int64, won bool, nowMs int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cached, ok := d.rows[teamID]
+	if !ok {
+		return
+	}
+	setBalanceIn(&cached.row, currency, balance)
+	if won {
+		cached.row.LastWinAtMs = nowMs
+	}
+	d.rows[teamID] = cached
+}
+
+// state returns the cached token rows of the given teams with their queued
+// settlements deducted. Teams not read within MaxStaleness are left out.
+func (d *degradedMode) state(teamIDs []string, nowMs int64) map[string]TokenDBRow {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state := make(map[string]TokenDBRow, len(teamIDs))
+	for _, teamID := range teamIDs {
+		cached, ok := d.rows[teamID]
+		if !ok || nowMs-cached.readAtMs > d.cfg.MaxStaleness.Milliseconds() {
+			continue
+		}
+		row := *cloneTokenRow(&cached.row)
+		for key, owed := range d.owed {
+			if key.teamID == teamID {
+				setBalanceIn(&row, key.currency, row.balanceIn(key.currency)-owed)
+			}
+		}
+		state[teamID] = row
+	}
+	return state
+}
+
+// enqueue queues a settlement, failing with ErrStoreUnavailable if the
+// queue is full.
+func (d *degradedMode) enqueue(s *DegradedSettlement) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.pending) >= d.cfg.MaxPending {
+		return ErrStoreUnavailable
+	}
+	d.pending = append(d.pending, s)
+	d.owed[owedKey{s.TeamID, s.Currency}] += s.Cost
+	if cached, ok := d.rows[s.TeamID]; ok {
+		cached.row.LastWinAtMs = s.QueuedAtMs
+		d.rows[s.TeamID] = cached
+	}
+	return nil
+}
+
+// next returns the oldest queued settlement, or nil if there is none.
+func (d *degradedMode) next() *DegradedSettlement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.pending) == 0 {
+		return nil
+	}
+	return d.pending[0]
+}
+
+// dequeue removes the oldest queued settlement, s, once it is charged or
+// given up on.
+func (d *degradedMode) dequeue(s *DegradedSettlement) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.pending) == 0 || d.pending[0] != s {
+		return
+	}
+	d.pending = d.pending[1:]
+
+	key := owedKey{s.TeamID, s.Currency}
+	d.owed[key] -= s.Cost
+	if d.owed[key] <= 0 {
+		delete(d.owed, key)
+	}
+}
+
+// failed counts a failed attempt to charge a queued settlement.
+func (d *degradedMode) failed(s *DegradedSettlement) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s.Attempts++
+}
+
+// settlements returns copies of the queued settlements, oldest first.
+func (d *degradedMode) settlements() []DegradedSettlement {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	settlements := make([]DegradedSettlement, len(d.pending))
+	for i, s := range d.pending {
+		settlements[i] = *s
+	}
+	return settlements
+}
+
+// lockUsers takes the in-process lock of every user bid on, as lockAuction
+// does in the store, and returns a func releasing them. It fails with
+// ErrAuctionInProgress if a degraded auction is already running for one.
+func (d *degradedMode) lockUsers(bids []Bid) (func(), error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var userIDs []string
+	for _, bid := range bids {
+		if slices.Contains(userIDs, bid.UserID) {
+			continue
+		}
+		if d.users[bid.UserID] {
+			for _, userID := range userIDs {
+				delete(d.users, userID)
+			}
+			return nil, fmt.Errorf("%w: user %s", ErrAuctionInProgress, bid.UserID)
+		}
+		userIDs = append(userIDs, bid.UserID)
+		d.users[bid.UserID] = true
+	}
+
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		for _, userID := range userIDs {
+			delete(d.users, userID)
+		}
+	}, nil
+}
+
+// setBalanceIn sets a team's balance in currency, the empty string being the
+// standard one.
+func setBalanceIn(row *TokenDBRow, currency string, balance int64) {
+	if currency == "" {
+		row.TokenBalance = balance
+		return
+	}
+	if row.Balances == nil {
+		row.Balances = make(map[string]int64)
+	}
+	row.Balances[currency] = balance
+}
+
+// runAuctionOrDegrade runs an auction as runAuction does, falling back to a
+// degraded auction if the store is unavailable before anyone was charged.
+func (tm *Manager) runAuctionOrDegrade(ctx context.Context, bids []Bid, cfg AuctionConfig) ([]*AuctionResult, error) {
+	results, err := tm.runAuction(ctx, bids, nil, cfg)
+	if tm.degraded == nil || len(results) > 0 || !errors.Is(err, ErrStoreUnavailable) || !cfg.degradable() {
+		return results, err
+	}
+
+	tm.logger.Warn("store unavailable, running degraded auction", zap.Int("bids", len(bids)))
+	return tm.runDegradedAuction(ctx, bids, cfg)
+}
+
+// runDegradedAuction runs an auction without the store: bids are scored and
+// priced against the cached balances, less the settlements already queued,
+// and each winner's charge is queued for settleDegraded. Bids aren't
+// recorded and frequency caps aren't checked; the auction is logged to the
+// decision log and published, but not audited, recorded in the auctions
+// table or sent to webhooks.
+func (tm *Manager) runDegradedAuction(ctx context.Context, bids []Bid, cfg AuctionConfig) (results []*AuctionResult, err error) {
+	start := time.Now()
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	ctx, end := tm.startSpan(ctx, SpanRunAuction, auctionAttrs(bids)...)
+	defer func() { end(err) }()
+
+	bids = tm.normalizeBids(bids)
+	bids, _, _, err = tm.validateBids(bids, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := tm.degraded.lockUsers(bids)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	now := tm.clock.Now()
+	nowMs := now.UnixMilli()
+	auctionID, err := tm.newID("auction_", now)
+	if err != nil {
+		return nil, err
+	}
+
+	teamIDs := make([]string, len(bids))
+	for i, bid := range bids {
+		teamIDs[i] = bid.TeamID
+	}
+	state := tm.degraded.state(teamIDs, nowMs)
+	if len(state) == 0 {
+		// nothing to price any bid against
+		return nil, ErrStoreUnavailable
+	}
+
+	tm.publishAuctionStarted(auctionID, bids)
+
+	var candidates, scored []*candidate
+	defer func() {
+		tm.publishAuctionWon(results)
+		tm.logDecision(scored, results, err)
+		tm.observeAuction(scored, results, err, start)
+	}()
+
+	for _, bid := range bids {
+		row, ok := state[bid.TeamID]
+		if !ok {
+			tm.logger.Warn("team has no cached balance, leaving its bid out of degraded auction", zap.String("team_id", bid.TeamID))
+			continue
+		}
+
+		c, err := tm.scoreBidWithState(bid, &row, cfg)
+		if err != nil {
+			return nil, err
+		}
+		scored = append(scored, c)
+
+		switch {
+		case row.canBid() != nil:
+			c.skipReason = SkipReasonTeamInactive
+		case !cfg.meetsReserve(c):
+			c.skipReason = SkipReasonBelowReserve
+		case !c.affordable():
+			c.skipReason = SkipReasonInsufficientBalance
+		case tm.inCooldown(c.lastWinAtMs, nowMs):
+			c.skipReason = SkipReasonWinCooldown
+		default:
+			candidates = append(candidates, c)
+		}
+	}
+
+	if len(candidates) == 0 && noWinnerReason(scored, candidates) == NoWinnerReserveNotMet {
+		return nil, ErrReserveNotMet
+	}
+	rankCandidates(candidates, tm.tieBreak)
+
+	winners := cfg.winners()
+	won := make(map[string]bool, winners)
+	for i, c := range candidates {
+		if len(results) == winners {
+			break
+		}
+		if won[c.bid.TeamID] {
+			continue
+		}
+
+		vetoed, err := tm.vetoed(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if vetoed {
+			continue
+		}
+
+		c.price, err = tm.clearingPrice(ctx, c, candidates[i+1:], won, true)
+		if err != nil {
+			return nil, err
+		}
+		err = tm.degraded.enqueue(&DegradedSettlement{
+			AuctionID:  auctionID,
+			TeamID:     c.bid.TeamID,
+			UserID:     c.bid.UserID,
+			Priority:   c.bid.Priority,
+			Currency:   c.bid.Currency,
+			Cost:       c.price,
+			QueuedAtMs: nowMs,
+		})
+		if err != nil {
+			if len(results) == 0 {
+				return nil, err
+			}
+			break
+		}
+
+		c.won = true
+		won[c.bid.TeamID] = true
+		results = append(results, &AuctionResult{
+			TeamID:            c.bid.TeamID,
+			Score:             c.score,
+			Cost:              c.price,
+			RemainingBalance:  c.balance - c.price,
+			SettlementPending: true,
+		})
+		tm.logger.Info(
+			"degraded auction won",
+			zap.String("auction_id", auctionID),
+			zap.String("team_id", c.bid.TeamID),
+			zap.String("user_id", c.bid.UserID),
+			zap.Int64("priority", c.bid.Priority),
+			zap.Int64("price", c.price),
+		)
+	}
+
+	if len(results) == 0 {
+		return nil, ErrNoWinner
+	}
+	tm.describeResults(results, auctionID, scored)
+	return results, nil
+}
+
+// DegradedSettlements returns the charges of degraded auctions not yet
+// settled, oldest first.
+func (tm *Manager) DegradedSettlements() []DegradedSettlement {
+	if tm.degraded == nil {
+		return nil
+	}
+	return tm.degraded.settlements()
+}
+
+// StoreState returns where the store's circuit breaker stands, or
+// BreakerClosed without one; see WithCircuitBreaker.
+func (tm *Manager) StoreState() BreakerState {
+	if tm.breaker == nil {
+		return BreakerClosed
+	}
+	return tm.breaker.State()
+}
+
+// settleDegraded charges the queued settlements, oldest first, as spends
+// keyed by auction so a charge is never applied twice. A settlement the
+// team can no longer pay, or can't spend because it was suspended or
+// archived meanwhile, is given up on and logged as an error for
+// reconciliation. It stops at the first failure for want of the store,
+// leaving the rest for the next run.
+func (tm *Manager) settleDegraded(ctx context.Context) {
+	for {
+		s := tm.degraded.next()
+		if s == nil {
+			return
+		}
+
+		bid := Bid{TeamID: s.TeamID, UserID: s.UserID, Priority: s.Priority, Currency: s.Currency}
+		price := s.Cost
+		balance, err := tm.spendTokens(ctx, &bid, "degraded_"+s.AuctionID+"_"+s.TeamID, &price)
+		switch {
+		case err == nil:
+			tm.degraded.dequeue(s)
+			tm.degraded.charged(s.TeamID, s.Currency, balance, false, tm.clock.Now().UnixMilli())
+			tm.logger.Info(
+				"settled degraded auction",
+				zap.String("auction_id", s.AuctionID),
+				zap.String("team_id", s.TeamID),
+				zap.Int64("cost", s.Cost),
+				zap.Int64("remaining_balance", balance),
+			)
+		case errors.Is(err, ErrInsufficientBalance), errors.Is(err, ErrBudgetExceeded), errors.Is(err, ErrQuotaExceeded),
+			errors.Is(err, ErrTeamNotFound), errors.Is(err, ErrInvalidCurrency), errors.Is(err, ErrUnknownPriority),
+			errors.Is(err, ErrTeamSuspended), errors.Is(err, ErrTeamArchived):
+			tm.degraded.dequeue(s)
+			tm.logger.Error(
+				"failed to settle degraded auction, giving up",
+				zap.String("auction_id", s.AuctionID),
+				zap.String("team_id", s.TeamID),
+				zap.String("user_id", s.UserID),
+				zap.Int64("priority", s.Priority),
+				zap.String("currency", s.Currency),
+				zap.Int64("cost", s.Cost),
+				zap.Error(err),
+			)
+		default:
+			tm.degraded.failed(s)
+			if ctx.Err() == nil {
+				tm.logger.Warn("failed to settle degraded auction", zap.String("auction_id", s.AuctionID), zap.Error(err))
+			}
+			return
+		}
+	}
+}
+
+// runDegradedSettlement runs settleDegraded every interval until the Manager
+// is closed, then closes done.
+func (tm *Manager) runDegradedSettlement(interval time.Duration, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tm.baseCtx.Done():
+			return
+		case <-ticker.C:
+			tm.settleDegraded(tm.baseCtx)
+		}
+	}
+}
+
+// closeDegraded makes a last attempt to settle degraded auctions when the
+// Manager is closed, logging any it couldn't as errors for reconciliation.
+func (tm *Manager) closeDegraded() {
+	ctx, cancel := context.WithTimeout(context.Background(), degradedCloseTimeout)
+	defer cancel()
+
+	tm.settleDegraded(ctx)
+	for _, s := range tm.degraded.settlements() {
+		tm.logger.Error(
+			"unsettled degraded auction",
+			zap.String("auction_id", s.AuctionID),
+			zap.String("team_id", s.TeamID),
+			zap.String("user_id", s.UserID),
+			zap.Int64("priority", s.Priority),
+			zap.String("currency", s.Currency),
+			zap.Int64("cost", s.Cost),
+			zap.Int64("queued_at_ms", s.QueuedAtMs),
+		)
+	}
+}
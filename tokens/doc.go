@@ -0,0 +1,28 @@
+// Package tokens is the auction engine: teams hold token balances and spend
+// them on bids for a user's attention, and an auction picks the winning bid
+// and charges its team.
+//
+// A Manager runs auctions and owns the pricing and reputation rules. Create
+// one with NewManager and functional options, or NewManagerFromConfig with a
+// Config, e.g. from LoadConfig. Its rows live in a Store: a DynamoStore by
+// default, a MemoryStore for tests and local runs, or any other
+// implementation passed with WithStore.
+//
+//	tm, err := tokens.NewManager(tokens.WithStore(tokens.NewMemoryStore()))
+//	if err != nil {
+//		return err
+//	}
+//	defer tm.Close()
+//
+//	if err := tm.InitializeTokens(ctx, []string{"team-a", "team-b"}); err != nil {
+//		return err
+//	}
+//	result, err := tm.RunAuction(ctx, []tokens.Bid{
+//		{TeamID: "team-a", UserID: "user-1", Priority: 3},
+//		{TeamID: "team-b", UserID: "user-1", Priority: 2},
+//	})
+//
+// Errors match the package's sentinel errors, such as ErrTeamNotFound or
+// ErrInsufficientBalance, with errors.Is; HTTPStatus maps them to status
+// codes.
+package tokens
@@ -0,0 +1,127 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// BalanceChangeDrip is the reason recorded for balance snapshots taken after
+// a drip refill.
+const BalanceChangeDrip = "drip"
+
+// DripRefill regenerates tokens over time: every Interval since a team's last
+// refill credits it Amount tokens, without taking its balance above Cap.
+//
+// Credits are applied lazily whenever a team's balance is read, using the
+// last_refill_time on its token row, so balances are correct however long
+// it has been since the last drip. With ScheduleInterval set, the Manager
+// also drips every team on that schedule, so balances stay current for
+// teams nobody reads.
+type DripRefill struct {
+	Interval time.Duration
+	Amount   int64
+	// Cap defaults to the initial token count.
+	Cap int64
+	// ScheduleInterval is how often to drip every team; zero only drips
+	// lazily.
+	ScheduleInterval time.Duration
+}
+
+// drip credits a team the tokens its row has regenerated by nowMs, updating
+// row in place. A team whose row changed since it was read is left alone:
+// whoever changed it either dripped it already or will on the next read.
+func (tm *Manager) drip(ctx context.Context, row *TokenDBRow, nowMs int64) error {
+	if tm.dripRefill == nil {
+		return nil
+	}
+	d := tm.dripRefill
+
+	intervalMs := d.Interval.Milliseconds()
+	periods := (nowMs - row.LastRefillTime) / intervalMs
+	if periods <= 0 {
+		return nil
+	}
+
+	// a team at or above the cap regenerates nothing, but its refill time
+	// still moves on so the idle periods aren't credited later
+	credit := max(min(periods*d.Amount, d.Cap-row.TokenBalance), 0)
+	refillMs := row.LastRefillTime + periods*intervalMs
+
+	err := tm.store.DripTokenRow(ctx, row.TeamID, credit, row.LastRefillTime, refillMs)
+	if errors.Is(err, ErrConditionFailed) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	row.TokenBalance += credit
+	row.LastRefillTime = refillMs
+	row.Version++
+	if credit > 0 {
+		tm.recordBalance(ctx, row.TeamID, row.TokenBalance, BalanceChangeDrip)
+	}
+	return nil
+}
+
+// DripAll applies drip refills to every team and returns how many were
+// credited. It is a no-op unless WithDripRefill is set. The refill scheduler
+// calls it every DripRefill.ScheduleInterval.
+func (tm *Manager) DripAll(ctx context.Context) (int, error) {
+	if tm.dripRefill == nil {
+		return 0, nil
+	}
+
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	rows, err := tm.store.ScanTokenRows(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := tm.clock.Now().UnixMilli()
+	credited := 0
+	for i := range rows {
+		// tombstones don't accrue
+		if rows[i].status() == TeamArchived {
+			continue
+		}
+		before := rows[i].TokenBalance
+		if err := tm.drip(ctx, &rows[i], now); err != nil {
+			return credited, err
+		}
+		if rows[i].TokenBalance != before {
+			credited++
+		}
+	}
+	return credited, nil
+}
+
+// runDripScheduler calls DripAll every ScheduleInterval until the Manager is
+// closed, then closes done.
+func (tm *Manager) runDripScheduler(done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(tm.dripRefill.ScheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tm.baseCtx.Done():
+			return
+		case <-ticker.C:
+			n, err := tm.DripAll(tm.baseCtx)
+			if err != nil && tm.baseCtx.Err() == nil {
+				tm.logger.Warn("failed to drip refill tokens", zap.Error(err))
+				continue
+			}
+			if n > 0 {
+				tm.logger.Debug("drip refilled tokens", zap.Int("teams", n))
+			}
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/christopherwong-hinge/auction/events"
+)
+
+// States of a Dutch auction.
+const (
+	DutchAuctionOpen = "open"
+	DutchAuctionSold = "sold"
+)
+
+// PriceSchedule is the descending price of a Dutch auction: StartPrice when
+// it opens, dropping by Decrement every StepMs until it reaches FloorPrice.
+type PriceSchedule struct {
+	StartPrice int64 `dynamodbav:"start_price" json:"start_price"`
+	FloorPrice int64 `dynamodbav:"floor_price" json:"floor_price"`
+	Decrement  int64 `dynamodbav:"decrement" json:"decrement"`
+	StepMs     int64 `dynamodbav:"step_ms" json:"step_ms"`
+}
+
+func (p PriceSchedule) validate() error {
+	if p.FloorPrice < 0 || p.StartPrice < p.FloorPrice {
+		return fmt.Errorf("%w: prices must satisfy 0 <= floor <= start, got floor %d and start %d",
+			ErrInvalidPriceSchedule, p.FloorPrice, p.StartPrice)
+	}
+	if p.Decrement <= 0 || p.StepMs <= 0 {
+		return fmt.Errorf("%w: decrement and step must be positive, got %d and %dms",
+			ErrInvalidPriceSchedule, p.Decrement, p.StepMs)
+	}
+	return nil
+}
+
+// PriceAt returns the price elapsedMs after the auction opened.
+func (p PriceSchedule) PriceAt(elapsedMs int64) int64 {
+	steps := max(elapsedMs, 0) / p.StepMs
+	// past this many steps the price is at the floor, and multiplying
+	// further could overflow
+	if drops := (p.StartPrice - p.FloorPrice + p.Decrement - 1) / p.Decrement; steps >= drops {
+		return p.FloorPrice
+	}
+	return p.StartPrice - steps*p.Decrement
+}
+
+// DutchAuction is a descending-price auction for one user, e.g. to clear
+// inventory few teams bid on: its price drops on a PriceSchedule until a
+// team accepts it with AcceptDutchAuction or its deadline passes unsold.
+// The first team to accept wins at the price then. Dutch auctions live in
+// the tokens table.
+type DutchAuction struct {
+	Pk        string `dynamodbav:"pk" json:"pk"`
+	AuctionID string `dynamodbav:"auction_id" json:"auction_id"`
+	UserID    string `dynamodbav:"user_id" json:"user_id"`
+	// Priority is what the winner's spend counts as in its priority usage.
+	Priority   int64         `dynamodbav:"priority" json:"priority"`
+	Schedule   PriceSchedule `dynamodbav:"schedule" json:"schedule"`
+	DeadlineMs int64         `dynamodbav:"deadline_ms" json:"deadline_ms"`
+	State      string        `dynamodbav:"state" json:"state"`
+	// TeamID, Price and SoldAtMs are set once a team accepts.
+	TeamID      string `dynamodbav:"team_id,omitempty" json:"team_id,omitempty"`
+	Price       int64  `dynamodbav:"price,omitempty" json:"price,omitempty"`
+	CreatedAtMs int64  `dynamodbav:"created_at_ms" json:"created_at_ms"`
+	SoldAtMs    int64  `dynamodbav:"sold_at_ms,omitempty" json:"sold_at_ms,omitempty"`
+}
+
+// PriceAt returns the auction's price at nowMs.
+func (a *DutchAuction) PriceAt(nowMs int64) int64 {
+	return a.Schedule.PriceAt(nowMs - a.CreatedAtMs)
+}
+
+// DutchAuctionResult is a sold Dutch auction and the winner's balance after
+// paying for it.
+type DutchAuctionResult struct {
+	Auction DutchAuction `json:"auction"`
+	Balance int64        `json:"balance"`
+}
+
+// OpenDutchAuction opens a Dutch auction for userID, priced on schedule
+// until deadline. priority must be one the Manager can price, though the
+// schedule sets what the winner pays.
+func (tm *Manager) OpenDutchAuction(
+	ctx context.Context,
+	userID string,
+	priority int64,
+	schedule PriceSchedule,
+	deadline time.Time,
+) (*DutchAuction, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	if err := schedule.validate(); err != nil {
+		return nil, err
+	}
+	if !tm.HasPriority(priority) {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownPriority, priority)
+	}
+	now := tm.clock.Now()
+	if !deadline.After(now) {
+		return nil, fmt.Errorf("%w: deadline %v has passed", ErrDutchAuctionClosed, deadline)
+	}
+
+	auctionID, err := tm.newID("dutch_", now)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &DutchAuction{
+		Pk:          GetDutchAuctionPK(auctionID),
+		AuctionID:   auctionID,
+		UserID:      tm.normalizeID(userID),
+		Priority:    priority,
+		Schedule:    schedule,
+		DeadlineMs:  deadline.UnixMilli(),
+		State:       DutchAuctionOpen,
+		CreatedAtMs: now.UnixMilli(),
+	}
+
+	err = tm.store.PutDutchAuction(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// GetDutchAuction reads a Dutch auction; see DutchAuctionPrice for its
+// current price.
+func (tm *Manager) GetDutchAuction(ctx context.Context, auctionID string) (*DutchAuction, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.store.GetDutchAuction(ctx, auctionID)
+}
+
+// DutchAuctionPrice returns what accepting a Dutch auction would cost now,
+// by the Manager's clock, or false if it can no longer be accepted.
+func (tm *Manager) DutchAuctionPrice(a *DutchAuction) (int64, bool) {
+	nowMs := tm.clock.Now().UnixMilli()
+	if a.State != DutchAuctionOpen || a.DeadlineMs <= nowMs {
+		return 0, false
+	}
+	return a.PriceAt(nowMs), true
+}
+
+// AcceptDutchAuction buys a Dutch auction for a team at its current price.
+// The auction is first claimed for the team, so only one team can win it,
+// and then the price is spent like SpendTokens, keyed on the auction and
+// team so it is charged at most once. If the spend fails without charging,
+// e.g. for ErrInsufficientBalance or ErrTeamSuspended, the claim is
+// released for other teams. It fails
+// with ErrDutchAuctionClosed once another team won the auction or its
+// deadline passed.
+//
+// Accepting an auction the team already won retries the spend at the price
+// it won at, so a spend that failed midway can be completed.
+func (tm *Manager) AcceptDutchAuction(ctx context.Context, auctionID, teamID string) (*DutchAuctionResult, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	a, err := tm.store.GetDutchAuction(ctx, auctionID)
+	if err != nil {
+		return nil, err
+	}
+
+	teamID = tm.normalizeID(teamID)
+	nowMs := tm.clock.Now().UnixMilli()
+	switch {
+	case a.State == DutchAuctionSold && a.TeamID == teamID:
+		// a retry of an accept whose spend may not have completed
+	case a.State != DutchAuctionOpen || a.DeadlineMs <= nowMs:
+		return nil, fmt.Errorf("%w: %s", ErrDutchAuctionClosed, auctionID)
+	default:
+		price := a.PriceAt(nowMs)
+		err = tm.store.ClaimDutchAuction(ctx, auctionID, teamID, price, nowMs)
+		if errors.Is(err, ErrConditionFailed) {
+			return nil, fmt.Errorf("%w: %s", ErrDutchAuctionClosed, auctionID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		a.State, a.TeamID, a.Price, a.SoldAtMs = DutchAuctionSold, teamID, price, nowMs
+	}
+
+	// the key is the team's, so a team that failed to pay doesn't hold up
+	// the next one to accept
+	bid := &Bid{TeamID: teamID, UserID: a.UserID, Priority: a.Priority}
+	balance, err := tm.spendTokens(ctx, bid, a.Pk+"#"+teamID, &a.Price)
+	if err != nil {
+		if chargedNothing(err) {
+			tm.releaseDutchAuction(ctx, a)
+		}
+		return nil, err
+	}
+
+	tm.publish(events.AuctionWon{
+		AuctionID:        a.AuctionID,
+		UserID:           a.UserID,
+		TeamID:           a.TeamID,
+		Cost:             a.Price,
+		RemainingBalance: balance,
+		OccurredAtMs:     tm.clock.Now().UnixMilli(),
+	})
+	return &DutchAuctionResult{Auction: *a, Balance: balance}, nil
+}
+
+// releaseDutchAuction reopens an auction whose winner couldn't pay for it.
+// A failure is logged rather than returned, since the caller is already
+// failing; the auction stays sold to a team that didn't pay.
+func (tm *Manager) releaseDutchAuction(ctx context.Context, a *DutchAuction) {
+	err := tm.store.ReleaseDutchAuction(ctx, a.AuctionID, a.TeamID)
+	if err != nil {
+		tm.logger.Warn(
+			"failed to release dutch auction",
+			zap.String("auction_id", a.AuctionID),
+			zap.String("team_id", a.TeamID),
+			zap.Error(err),
+		)
+	}
+}
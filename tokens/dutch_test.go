@@ -0,0 +1,81 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcceptDutchAuctionAfterFailedAccept(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		// fail keeps team a from paying for the auction
+		fail    func(ctx context.Context, t *testing.T, tm *Manager, mem *MemoryStore)
+		wantErr error
+	}{
+		{
+			name: "insufficient balance",
+			fail: func(ctx context.Context, t *testing.T, tm *Manager, mem *MemoryStore) {
+				mem.tokens["a"].TokenBalance = 0
+			},
+			wantErr: ErrInsufficientBalance,
+		},
+		{
+			name:    "budget exceeded",
+			opts:    []Option{WithBudgetPacing(BudgetPacing{Window: time.Hour, Cap: 1000, TeamCaps: map[string]int64{"a": 1}})},
+			wantErr: ErrBudgetExceeded,
+		},
+		{
+			name: "team suspended",
+			fail: func(ctx context.Context, t *testing.T, tm *Manager, mem *MemoryStore) {
+				if _, err := tm.SuspendTeam(ctx, "a", "test"); err != nil {
+					t.Fatalf("SuspendTeam: %v", err)
+				}
+			},
+			wantErr: ErrTeamSuspended,
+		},
+		{
+			name: "team archived",
+			fail: func(ctx context.Context, t *testing.T, tm *Manager, mem *MemoryStore) {
+				if _, err := tm.ArchiveTeam(ctx, "a", "test"); err != nil {
+					t.Fatalf("ArchiveTeam: %v", err)
+				}
+			},
+			wantErr: ErrTeamArchived,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := NewMemoryStore()
+			tm := newTestManager(t, []string{"a", "b"}, append(tt.opts, WithStore(mem))...)
+			if tt.fail != nil {
+				tt.fail(ctx, t, tm, mem)
+			}
+
+			schedule := PriceSchedule{StartPrice: 10, FloorPrice: 1, Decrement: 1, StepMs: time.Minute.Milliseconds()}
+			a, err := tm.OpenDutchAuction(ctx, "u", 5, schedule, tm.clock.Now().Add(time.Hour))
+			if err != nil {
+				t.Fatalf("OpenDutchAuction: %v", err)
+			}
+
+			if _, err := tm.AcceptDutchAuction(ctx, a.AuctionID, "a"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AcceptDutchAuction by a = %v, want %v", err, tt.wantErr)
+			}
+
+			// the auction went back on offer for the next team
+			result, err := tm.AcceptDutchAuction(ctx, a.AuctionID, "b")
+			if err != nil {
+				t.Fatalf("AcceptDutchAuction by b: %v", err)
+			}
+			if result.Auction.TeamID != "b" || result.Auction.State != DutchAuctionSold {
+				t.Errorf("auction %s to %s, want sold to b", result.Auction.State, result.Auction.TeamID)
+			}
+			if balance := tokenRow(t, tm, "b").TokenBalance; balance != InitialTokenCount-10 {
+				t.Errorf("balance of b = %d, want %d", balance, InitialTokenCount-10)
+			}
+		})
+	}
+}
@@ -0,0 +1,2876 @@
+package tokens
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+)
+
+// truncateParallelism bounds the concurrent BatchWriteItem calls per page
+// of scanned items.
+const truncateParallelism = 4
+
+// DynamoStore is the Store backed by DynamoDB. Token rows, holds and auction
+// locks share the tokens table; bids, auctions and balance snapshots each
+// have their own.
+type DynamoStore struct {
+	client              *dynamodb.Client
+	tables              TableNames
+	provisionedCapacity *ProvisionedCapacity
+	logger              *zap.Logger
+}
+
+// NewDynamoStore returns a Store over client. tableSuffix is appended to
+// every table name; a non-nil capacity makes EnsureSchema create provisioned
+// tables rather than on-demand ones. EnsureSchema logs to logger, which may
+// be nil.
+func NewDynamoStore(client *dynamodb.Client, tableSuffix string, capacity *ProvisionedCapacity, logger *zap.Logger) *DynamoStore {
+	return NewDynamoStoreWithTables(client, TableNames{}.withDefaults(tableSuffix), capacity, logger)
+}
+
+// NewDynamoStoreWithTables returns a Store over client using the given
+// table names; empty names default to the TableName constants.
+func NewDynamoStoreWithTables(client *dynamodb.Client, tables TableNames, capacity *ProvisionedCapacity, logger *zap.Logger) *DynamoStore {
+	return &DynamoStore{
+		client:              client,
+		tables:              tables.withDefaults(""),
+		provisionedCapacity: capacity,
+		logger:              logger,
+	}
+}
+
+func (s *DynamoStore) tokensTable() string         { return s.tables.Tokens }
+func (s *DynamoStore) bidsTable() string           { return s.tables.Bids }
+func (s *DynamoStore) auctionsTable() string       { return s.tables.Auctions }
+func (s *DynamoStore) balanceHistoryTable() string { return s.tables.BalanceHistory }
+func (s *DynamoStore) ledgerTable() string         { return s.tables.Ledger }
+func (s *DynamoStore) statsTable() string          { return s.tables.Stats }
+
+func tokenKey(pk string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: pk},
+	}
+}
+
+// EnsureSchema provisions the store's tables; see Provisioner.Provision.
+func (s *DynamoStore) EnsureSchema(ctx context.Context) error {
+	return NewProvisioner(s.client, s.tables, s.provisionedCapacity, s.logger).Provision(ctx)
+}
+
+// Truncate deletes every item in the tokens, bids, auctions, balance history,
+// ledger and stats tables.
+func (s *DynamoStore) Truncate(ctx context.Context) error {
+	if err := s.truncateTable(ctx, s.tokensTable(), "pk"); err != nil {
+		return err
+	}
+	if err := s.truncateTable(ctx, s.bidsTable(), "pk, sk"); err != nil {
+		return err
+	}
+	if err := s.truncateTable(ctx, s.auctionsTable(), "pk, sk"); err != nil {
+		return err
+	}
+	if err := s.truncateTable(ctx, s.balanceHistoryTable(), "pk, sk"); err != nil {
+		return err
+	}
+	if err := s.truncateTable(ctx, s.ledgerTable(), "pk, sk"); err != nil {
+		return err
+	}
+	return s.truncateTable(ctx, s.statsTable(), "pk")
+}
+
+// truncateTable scans table for its keys and deletes them page by page,
+// issuing the batch deletes for each page in parallel.
+func (s *DynamoStore) truncateTable(ctx context.Context, table string, keyAttributes string) error {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName:            aws.String(table),
+		ProjectionExpression: aws.String(keyAttributes),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to scan %s: %w", table, err)
+		}
+
+		var (
+			wg   sync.WaitGroup
+			mu   sync.Mutex
+			errs []error
+		)
+		sem := make(chan struct{}, truncateParallelism)
+
+		for start := 0; start < len(page.Items); start += batchWriteLimit {
+			end := min(start+batchWriteLimit, len(page.Items))
+
+			requests := make([]types.WriteRequest, 0, end-start)
+			for _, item := range page.Items[start:end] {
+				requests = append(requests, types.WriteRequest{
+					DeleteRequest: &types.DeleteRequest{Key: item},
+				})
+			}
+
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				if err := s.batchWrite(ctx, table, requests); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}()
+		}
+
+		wg.Wait()
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// batchWrite issues up to batchWriteLimit write requests against table,
+// retrying unprocessed items.
+func (s *DynamoStore) batchWrite(ctx context.Context, table string, requests []types.WriteRequest) error {
+	request := map[string][]types.WriteRequest{table: requests}
+	for attempt := 0; len(request) > 0; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * 50 * time.Millisecond):
+			}
+		}
+
+		result, err := s.client.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: request,
+		})
+		if err != nil {
+			return fmt.Errorf("error batch writing to %s: %w", table, err)
+		}
+		request = result.UnprocessedItems
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetTokenRow(ctx context.Context, teamID string, consistent bool) (*TokenDBRow, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tokensTable()),
+		Key:            tokenKey(GetTokenPK(teamID)),
+		ConsistentRead: aws.Bool(consistent),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching token balance: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: %s", ErrTeamNotFound, teamID)
+	}
+
+	var row TokenDBRow
+	err = attributevalue.UnmarshalMap(result.Item, &row)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling token row: %w", err)
+	}
+
+	return &row, nil
+}
+
+func (s *DynamoStore) BatchGetTokenRows(ctx context.Context, teamIDs []string) (map[string]TokenDBRow, error) {
+	rows := make(map[string]TokenDBRow, len(teamIDs))
+
+	var keys []map[string]types.AttributeValue
+	seen := make(map[string]bool, len(teamIDs))
+	for _, teamID := range teamIDs {
+		if seen[teamID] {
+			continue
+		}
+		seen[teamID] = true
+		keys = append(keys, tokenKey(GetTokenPK(teamID)))
+	}
+
+	items, err := s.batchGetTokensItems(ctx, keys)
+	if err != nil {
+		return nil, fmt.Errorf("error batch fetching token balances: %w", err)
+	}
+
+	var page []TokenDBRow
+	err = attributevalue.UnmarshalListOfMaps(items, &page)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling token rows: %w", err)
+	}
+	for _, row := range page {
+		rows[strings.TrimPrefix(row.Pk, GetTokenPK(""))] = row
+	}
+
+	return rows, nil
+}
+
+// batchGetTokensItems reads the tokens table items with the given keys,
+// retrying unprocessed keys. Missing items are left out.
+func (s *DynamoStore) batchGetTokensItems(ctx context.Context, keys []map[string]types.AttributeValue) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+
+	// BatchGetItem accepts at most 100 keys per request.
+	for start := 0; start < len(keys); start += batchGetLimit {
+		end := min(start+batchGetLimit, len(keys))
+
+		request := map[string]types.KeysAndAttributes{
+			s.tokensTable(): {Keys: keys[start:end]},
+		}
+		for attempt := 0; len(request) > 0; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(time.Duration(attempt) * 50 * time.Millisecond):
+				}
+			}
+
+			result, err := s.client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: request,
+			})
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, result.Responses[s.tokensTable()]...)
+
+			request = result.UnprocessedKeys
+		}
+	}
+
+	return items, nil
+}
+
+func (s *DynamoStore) EnsureTokenRow(ctx context.Context, row *TokenDBRow) error {
+	usageAV, err := attributevalue.Marshal(row.PriorityUsage)
+	if err != nil {
+		return err
+	}
+
+	update := `
+			SET team_id = if_not_exists(team_id, :teamID),
+				token_balance = if_not_exists(token_balance, :initialBalance),
+				last_refill_time = if_not_exists(last_refill_time, :lastRefill),
+				last_reputation_recovery_ms = if_not_exists(last_reputation_recovery_ms, :lastRecovery),
+				reputation_score = if_not_exists(reputation_score, :initialReputation),
+				priority_usage = if_not_exists(priority_usage, :initialUsage),
+				created_at_ms = if_not_exists(created_at_ms, :createdAt),
+				version = if_not_exists(version, :firstVersion),
+				updated_at_ms = :now`
+	values := map[string]types.AttributeValue{
+		":teamID": &types.AttributeValueMemberS{Value: row.TeamID},
+		":initialBalance": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(row.TokenBalance, 10),
+		},
+		":initialReputation": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(row.ReputationScore, 10),
+		},
+		":initialUsage": usageAV,
+		":lastRefill":   &types.AttributeValueMemberN{Value: strconv.FormatInt(row.LastRefillTime, 10)},
+		":lastRecovery": &types.AttributeValueMemberN{Value: strconv.FormatInt(row.LastReputationRecoveryMs, 10)},
+		":createdAt":    &types.AttributeValueMemberN{Value: strconv.FormatInt(row.CreatedAtMs, 10)},
+		":now":          &types.AttributeValueMemberN{Value: strconv.FormatInt(row.UpdatedAtMs, 10)},
+		":firstVersion": &types.AttributeValueMemberN{Value: "1"},
+	}
+	if row.Balances != nil {
+		balancesAV, err := attributevalue.Marshal(row.Balances)
+		if err != nil {
+			return err
+		}
+		update += ", balances = if_not_exists(balances, :initialBalances)"
+		values[":initialBalances"] = balancesAV
+	}
+
+	entry, err := newLedgerEntry(row.TeamID, LedgerOpen, row.TokenBalance, "", row.CreatedAtMs)
+	if err != nil {
+		return err
+	}
+	ledger, err := s.ledgerPuts(entry)
+	if err != nil {
+		return err
+	}
+	if len(ledger) > 0 {
+		// a new row's balance is ledgered with it; a row that has one
+		// already fails the condition and takes the plain update below
+		_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: append([]types.TransactWriteItem{
+				{
+					Update: &types.Update{
+						TableName:                 aws.String(s.tokensTable()),
+						Key:                       tokenKey(GetTokenPK(row.TeamID)),
+						UpdateExpression:          aws.String(update),
+						ConditionExpression:       aws.String("attribute_not_exists(token_balance)"),
+						ExpressionAttributeValues: values,
+					},
+				},
+			}, ledger...),
+		})
+		if err == nil {
+			return s.ensureBalances(ctx, row)
+		}
+		if !isConditionFailure(err) {
+			return fmt.Errorf("failed to ensure tokens for %s: %w", row.TeamID, err)
+		}
+	}
+
+	_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tokensTable()),
+		Key:                       tokenKey(GetTokenPK(row.TeamID)),
+		UpdateExpression:          aws.String(update),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to ensure tokens for %s: %w", row.TeamID, err)
+	}
+
+	return s.ensureBalances(ctx, row)
+}
+
+// ensureBalances backfills the balances of an existing row in currencies it
+// has none in, e.g. one configured after the team was created. It takes a
+// second update since DynamoDB can't set a map and paths inside it at once.
+func (s *DynamoStore) ensureBalances(ctx context.Context, row *TokenDBRow) error {
+	if len(row.Balances) == 0 {
+		return nil
+	}
+
+	var sets []string
+	names := make(map[string]string, len(row.Balances))
+	values := make(map[string]types.AttributeValue, len(row.Balances))
+	i := 0
+	for currency, balance := range row.Balances {
+		name, value := fmt.Sprintf("#currency%d", i), fmt.Sprintf(":balance%d", i)
+		sets = append(sets, fmt.Sprintf("balances.%s = if_not_exists(balances.%s, %s)", name, name, value))
+		names[name] = currency
+		values[value] = &types.AttributeValueMemberN{Value: strconv.FormatInt(balance, 10)}
+		i++
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tokensTable()),
+		Key:                       tokenKey(GetTokenPK(row.TeamID)),
+		UpdateExpression:          aws.String("SET " + strings.Join(sets, ", ")),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to ensure balances for %s: %w", row.TeamID, err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) RefillTokenRow(ctx context.Context, teamID string, balance, observed int64, balances map[string]int64, usage map[int]int, reputation, nowMs int64) error {
+	entry, err := newLedgerEntry(teamID, LedgerRefill, balance-observed, "", nowMs)
+	if err != nil {
+		return err
+	}
+	ledger, err := s.ledgerPuts(entry)
+	if err != nil {
+		return err
+	}
+	usageAV, err := attributevalue.Marshal(usage)
+	if err != nil {
+		return err
+	}
+
+	update := `
+			SET token_balance = :initialBalance,
+				priority_usage = :initialUsage,
+				reputation_score = :initialReputation,
+				last_refill_time = :now`
+	condition := "token_balance = :observed"
+	if observed == 0 {
+		condition = "attribute_not_exists(token_balance) OR " + condition
+	}
+	values := map[string]types.AttributeValue{
+		":initialBalance": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(balance, 10),
+		},
+		":observed": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(observed, 10),
+		},
+		":initialUsage": usageAV,
+		":initialReputation": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(reputation, 10),
+		},
+		":now": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(nowMs, 10),
+		},
+	}
+	if balances != nil {
+		balancesAV, err := attributevalue.Marshal(balances)
+		if err != nil {
+			return err
+		}
+		update += ", balances = :initialBalances"
+		values[":initialBalances"] = balancesAV
+	}
+
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName:                 aws.String(s.tokensTable()),
+					Key:                       tokenKey(GetTokenPK(teamID)),
+					UpdateExpression:          aws.String(versioned(update, values)),
+					ConditionExpression:       aws.String(condition),
+					ExpressionAttributeValues: values,
+				},
+			},
+		}, ledger...),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error refilling tokens for %s: %w", teamID, err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) DripTokenRow(ctx context.Context, teamID string, credit, observedMs, refillMs int64) error {
+	// the credit is ledgered as of the refill time it regenerated by
+	entry, err := newLedgerEntry(teamID, LedgerDrip, credit, "", refillMs)
+	if err != nil {
+		return err
+	}
+	ledger, err := s.ledgerPuts(entry)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]types.AttributeValue{
+		":credit": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(credit, 10),
+		},
+		":refill": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(refillMs, 10),
+		},
+		":observed": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(observedMs, 10),
+		},
+	}
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName:                 aws.String(s.tokensTable()),
+					Key:                       tokenKey(GetTokenPK(teamID)),
+					UpdateExpression:          aws.String(versioned("SET token_balance = token_balance + :credit, last_refill_time = :refill", values)),
+					ConditionExpression:       aws.String("last_refill_time = :observed"),
+					ExpressionAttributeValues: values,
+				},
+			},
+		}, ledger...),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error dripping tokens for %s: %w", teamID, err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) CreateTokenRow(ctx context.Context, row *TokenDBRow) error {
+	item, err := attributevalue.MarshalMap(row)
+	if err != nil {
+		return fmt.Errorf("error marshaling token row: %w", err)
+	}
+	item["version"] = &types.AttributeValueMemberN{Value: "1"}
+	entry, err := newLedgerEntry(row.TeamID, LedgerOpen, row.TokenBalance, "", row.CreatedAtMs)
+	if err != nil {
+		return err
+	}
+	ledger, err := s.ledgerPuts(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:                           aws.String(s.tokensTable()),
+					Item:                                item,
+					ConditionExpression:                 aws.String("attribute_not_exists(pk)"),
+					ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+				},
+			},
+		}, ledger...),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return conditionFailedError(err)
+		}
+		return fmt.Errorf("error creating token row: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) SetTeamStatus(ctx context.Context, u TeamStatusUpdate) (*TokenDBRow, error) {
+	update := "SET team_status = :status, status_changed_at_ms = :now, updated_at_ms = :now"
+	values := map[string]types.AttributeValue{
+		":status": &types.AttributeValueMemberS{Value: string(u.Status)},
+		":now":    &types.AttributeValueMemberN{Value: strconv.FormatInt(u.NowMs, 10)},
+	}
+	if u.Reason != "" {
+		update += ", status_reason = :reason"
+		values[":reason"] = &types.AttributeValueMemberS{Value: u.Reason}
+	} else {
+		update += " REMOVE status_reason"
+	}
+
+	from := make([]string, len(u.From))
+	for i, status := range u.From {
+		from[i] = fmt.Sprintf(":from%d", i)
+		values[from[i]] = &types.AttributeValueMemberS{Value: string(status)}
+	}
+	allowed := fmt.Sprintf("team_status IN (%s)", strings.Join(from, ", "))
+	if slices.Contains(u.From, TeamActive) {
+		// rows from before statuses existed are active
+		allowed += " OR attribute_not_exists(team_status)"
+	}
+
+	result, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                           aws.String(s.tokensTable()),
+		Key:                                 tokenKey(GetTokenPK(u.TeamID)),
+		UpdateExpression:                    aws.String(update),
+		ConditionExpression:                 aws.String(fmt.Sprintf("attribute_exists(pk) AND (%s)", allowed)),
+		ExpressionAttributeValues:           values,
+		ReturnValues:                        types.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return nil, conditionFailedError(err)
+		}
+		return nil, fmt.Errorf("error setting team status: %w", err)
+	}
+
+	var row TokenDBRow
+	if err := attributevalue.UnmarshalMap(result.Attributes, &row); err != nil {
+		return nil, fmt.Errorf("error unmarshalling token row: %w", err)
+	}
+	return &row, nil
+}
+
+func (s *DynamoStore) DeleteTeam(ctx context.Context, teamID string, observed, nowMs int64) error {
+	entry, err := newLedgerEntry(teamID, LedgerClose, -observed, "", nowMs)
+	if err != nil {
+		return err
+	}
+	ledger, err := s.ledgerPuts(entry)
+	if err != nil {
+		return err
+	}
+
+	deletes := []types.TransactWriteItem{
+		{
+			Delete: &types.Delete{
+				TableName:           aws.String(s.tokensTable()),
+				Key:                 tokenKey(GetTokenPK(teamID)),
+				ConditionExpression: aws.String("token_balance = :observed"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":observed": &types.AttributeValueMemberN{Value: strconv.FormatInt(observed, 10)},
+				},
+			},
+		},
+		{Delete: &types.Delete{TableName: aws.String(s.tokensTable()), Key: tokenKey(GetAutoBidPolicyPK(teamID))}},
+		{Delete: &types.Delete{TableName: aws.String(s.tokensTable()), Key: tokenKey(GetWebhookPK(teamID))}},
+		{Delete: &types.Delete{TableName: aws.String(s.tokensTable()), Key: tokenKey(GetPacingPK(teamID))}},
+		{Delete: &types.Delete{TableName: aws.String(s.tokensTable()), Key: tokenKey(GetQuotaPK(teamID))}},
+		{Delete: &types.Delete{TableName: aws.String(s.statsTable()), Key: tokenKey(GetTeamStatsPK(teamID))}},
+	}
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append(deletes, ledger...),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error deleting team: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) ScanTokenRows(ctx context.Context) ([]TokenDBRow, error) {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName:        aws.String(s.tokensTable()),
+		FilterExpression: aws.String("begins_with(pk, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":prefix": &types.AttributeValueMemberS{Value: GetTokenPK("")},
+		},
+	})
+
+	var rows []TokenDBRow
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan token rows: %w", err)
+		}
+
+		var pageRows []TokenDBRow
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageRows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal token rows: %w", err)
+		}
+		rows = append(rows, pageRows...)
+	}
+	return rows, nil
+}
+
+func (s *DynamoStore) UpdateBalance(ctx context.Context, u BalanceUpdate) (*TokenDBRow, error) {
+	spend, err := s.balanceUpdate(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.WinningBid != nil || u.Reservation != nil || u.Lock != nil || len(spend.ledger) > 0 {
+		return s.settleWin(ctx, u, spend)
+	}
+
+	// Update token balance
+	// Increment priority utilization map
+	output, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                           aws.String(s.tokensTable()),
+		Key:                                 tokenKey(GetTokenPK(u.TeamID)),
+		UpdateExpression:                    aws.String(spend.update),
+		ConditionExpression:                 aws.String(spend.condition),
+		ExpressionAttributeNames:            spend.names,
+		ExpressionAttributeValues:           spend.values,
+		ReturnValues:                        types.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return nil, conditionFailedError(err)
+		}
+		return nil, fmt.Errorf("error updating token balance: %w", err)
+	}
+
+	var row TokenDBRow
+	err = attributevalue.UnmarshalMap(output.Attributes, &row)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling token row: %w", err)
+	}
+	return &row, nil
+}
+
+// UpdateBalances writes the items of every spend, as settleWin would each
+// on its own, in a single transaction.
+func (s *DynamoStore) UpdateBalances(ctx context.Context, updates []BalanceUpdate) ([]*TokenDBRow, error) {
+	var items []types.TransactWriteItem
+	keys := make([]types.TransactGetItem, len(updates))
+	for i, u := range updates {
+		spend, err := s.balanceUpdate(u)
+		if err != nil {
+			return nil, err
+		}
+		spendItems, _, err := s.spendItems(u, spend)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, spendItems...)
+		keys[i] = types.TransactGetItem{
+			Get: &types.Get{TableName: aws.String(s.tokensTable()), Key: tokenKey(GetTokenPK(u.TeamID))},
+		}
+	}
+
+	_, err := s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return nil, &ConditionFailedError{}
+		}
+		return nil, fmt.Errorf("error settling auction wins: %w", err)
+	}
+
+	// transactions can't return values, so read the rows back, consistently
+	output, err := s.client.TransactGetItems(ctx, &dynamodb.TransactGetItemsInput{TransactItems: keys})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching token rows: %w", err)
+	}
+	rows := make([]*TokenDBRow, len(output.Responses))
+	for i, response := range output.Responses {
+		var row TokenDBRow
+		if err := attributevalue.UnmarshalMap(response.Item, &row); err != nil {
+			return nil, fmt.Errorf("error unmarshaling token row: %w", err)
+		}
+		rows[i] = &row
+	}
+	return rows, nil
+}
+
+// dynamoSpend is the token row update of a BalanceUpdate and the ledger
+// entries it appends.
+type dynamoSpend struct {
+	update    string
+	condition string
+	names     map[string]string
+	values    map[string]types.AttributeValue
+	ledger    []types.TransactWriteItem
+}
+
+// balanceUpdate builds the token row update of u.
+func (s *DynamoStore) balanceUpdate(u BalanceUpdate) (*dynamoSpend, error) {
+	names := map[string]string{
+		"#usage_key": strconv.FormatInt(u.Priority, 10),
+	}
+	balance := "token_balance"
+	if u.Currency != "" {
+		balance = "balances.#currency"
+		names["#currency"] = u.Currency
+	}
+
+	update := `
+		SET ` + balance + ` = ` + balance + ` - :amount,
+			priority_usage.#usage_key = if_not_exists(priority_usage.#usage_key, :start) + :incr,
+			updated_at_ms = :now`
+	condition := balance + " >= :amount"
+	values := map[string]types.AttributeValue{
+		":amount": &types.AttributeValueMemberN{Value: strconv.FormatInt(reservedAmount(u.Amount, u.Reservation), 10)},
+		":incr":   &types.AttributeValueMemberN{Value: "1"},
+		":start": &types.AttributeValueMemberN{
+			Value: "0",
+		},
+		":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(u.NowMs, 10)},
+	}
+	if u.Win {
+		update, condition = withWin(u.NowMs, u.CooldownStartMs, update, condition, values)
+	}
+	if u.Reservation != nil {
+		update += ", held_balance = held_balance - :reserved"
+		values[":reserved"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(u.Reservation.Amount, 10)}
+	}
+	update = versioned(update, values)
+	if u.Version != nil {
+		condition += " AND " + versionCondition(*u.Version, values)
+	}
+
+	var ledger []types.TransactWriteItem
+	if u.Currency == "" {
+		entry, err := newLedgerEntry(u.TeamID, LedgerSpend, -reservedAmount(u.Amount, u.Reservation), bidRef(u.WinningBid), u.NowMs)
+		if err != nil {
+			return nil, err
+		}
+		if ledger, err = s.ledgerPuts(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return &dynamoSpend{update: update, condition: condition, names: names, values: values, ledger: ledger}, nil
+}
+
+// settleWin applies a spend's token row update, writes its winning bid,
+// deletes the reservation funding it, checks its auction lock and appends
+// ledger in one transaction, so a charged win always has its bid recorded
+// as won and a failed charge records nothing.
+func (s *DynamoStore) settleWin(ctx context.Context, u BalanceUpdate, spend *dynamoSpend) (*TokenDBRow, error) {
+	items, lockItem, err := s.spendItems(u, spend)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if u.Lock != nil && cancelledBy(err, lockItem) {
+		return nil, fmt.Errorf("%w: user %s", ErrAuctionLockLost, u.Lock.UserID)
+	}
+	if err != nil {
+		if isConditionFailure(err) {
+			return nil, conditionFailedError(err)
+		}
+		return nil, fmt.Errorf("error settling auction win: %w", err)
+	}
+
+	// transactions can't return values, so read the row back
+	return s.GetTokenRow(ctx, u.TeamID, true)
+}
+
+// spendItems returns the transaction items of a spend: its token row
+// update, winning bid, reservation release, lock check and ledger entries,
+// along with the index of the lock check.
+func (s *DynamoStore) spendItems(u BalanceUpdate, spend *dynamoSpend) ([]types.TransactWriteItem, int, error) {
+	// the token row goes first so a failed condition reports it; see
+	// conditionFailureItem
+	items := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:                           aws.String(s.tokensTable()),
+				Key:                                 tokenKey(GetTokenPK(u.TeamID)),
+				UpdateExpression:                    aws.String(spend.update),
+				ConditionExpression:                 aws.String(spend.condition),
+				ExpressionAttributeNames:            spend.names,
+				ExpressionAttributeValues:           spend.values,
+				ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+			},
+		},
+	}
+	if u.WinningBid != nil {
+		bidAV, err := attributevalue.MarshalMap(u.WinningBid)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName: aws.String(s.bidsTable()),
+				Item:      bidAV,
+			},
+		})
+	}
+	if u.Reservation != nil {
+		items = append(items, s.deleteReservation(u.Reservation))
+	}
+	lockItem := len(items)
+	if u.Lock != nil {
+		items = append(items, s.checkLock(u.Lock))
+	}
+	return append(items, spend.ledger...), lockItem, nil
+}
+
+// reservedAmount returns what is left of amount to take from the balance
+// once reservation, if any, is released.
+func reservedAmount(amount int64, reservation *HoldRow) int64 {
+	if reservation == nil {
+		return amount
+	}
+	return amount - reservation.Amount
+}
+
+// checkLock is the transaction item requiring an auction lock to still be
+// held by its owner.
+func (s *DynamoStore) checkLock(lock *LockRef) types.TransactWriteItem {
+	return types.TransactWriteItem{
+		ConditionCheck: &types.ConditionCheck{
+			TableName:           aws.String(s.tokensTable()),
+			Key:                 tokenKey(GetLockPK(lock.UserID)),
+			ConditionExpression: aws.String("#owner = :owner"),
+			ExpressionAttributeNames: map[string]string{
+				"#owner": "owner",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":owner": &types.AttributeValueMemberS{Value: lock.Owner},
+			},
+		},
+	}
+}
+
+// cancelledBy reports whether err is a transaction cancelled because the
+// condition of its item at index i failed.
+func cancelledBy(err error, i int) bool {
+	var canceledErr *types.TransactionCanceledException
+	return errors.As(err, &canceledErr) && i < len(canceledErr.CancellationReasons) &&
+		aws.ToString(canceledErr.CancellationReasons[i].Code) == "ConditionalCheckFailed"
+}
+
+// deleteReservation is the transaction item releasing a reservation that
+// funds a spend or hold; it fails the transaction if the reservation is
+// gone, e.g. because it expired and was released.
+func (s *DynamoStore) deleteReservation(reservation *HoldRow) types.TransactWriteItem {
+	return types.TransactWriteItem{
+		Delete: &types.Delete{
+			TableName:           aws.String(s.tokensTable()),
+			Key:                 tokenKey(reservation.Pk),
+			ConditionExpression: aws.String("attribute_exists(pk)"),
+		},
+	}
+}
+
+// withWin extends a token row update for an auction win. It stamps
+// last_win_at_ms, counts the win and, given a cooldown start, conditions the update on the
+// team's previous win being no later, so concurrent auctions can't both
+// award the same team within its cooldown.
+func withWin(
+	nowMilli int64,
+	cooldownStartMs int64,
+	update string,
+	condition string,
+	values map[string]types.AttributeValue,
+) (string, string) {
+	update += ", last_win_at_ms = :winAt, win_count = if_not_exists(win_count, :noWins) + :win"
+	values[":winAt"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(nowMilli, 10)}
+	values[":noWins"] = &types.AttributeValueMemberN{Value: "0"}
+	values[":win"] = &types.AttributeValueMemberN{Value: "1"}
+
+	if cooldownStartMs != 0 {
+		condition += " AND (attribute_not_exists(last_win_at_ms) OR last_win_at_ms <= :cooldownStart)"
+		values[":cooldownStart"] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(cooldownStartMs, 10),
+		}
+	}
+	return update, condition
+}
+
+// versioned extends a token row update to move the row to its next
+// version, adding the values it uses to values; see TokenDBRow.Version.
+// update must end in a SET clause.
+func versioned(update string, values map[string]types.AttributeValue) string {
+	values[":unversioned"] = &types.AttributeValueMemberN{Value: "0"}
+	values[":versionStep"] = &types.AttributeValueMemberN{Value: "1"}
+	return update + ", version = if_not_exists(version, :unversioned) + :versionStep"
+}
+
+// versionCondition returns the condition that a token row is still at
+// version, adding the value it uses to values. A row written before
+// versions existed is at version zero.
+func versionCondition(version int64, values map[string]types.AttributeValue) string {
+	values[":version"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)}
+	if version == 0 {
+		return "(attribute_not_exists(version) OR version = :version)"
+	}
+	return "version = :version"
+}
+
+func (s *DynamoStore) CountAuctionEntry(ctx context.Context, teamID string) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tokensTable()),
+		Key:                 tokenKey(GetTokenPK(teamID)),
+		UpdateExpression:    aws.String("ADD auction_count :one"),
+		ConditionExpression: aws.String("attribute_exists(pk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+		},
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error counting auction for %s: %w", teamID, err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) BatchGetFrequencyRows(ctx context.Context, userID string, teamIDs []string) (map[string]FrequencyRow, error) {
+	rows := make(map[string]FrequencyRow, len(teamIDs))
+
+	var keys []map[string]types.AttributeValue
+	for _, teamID := range teamIDs {
+		if _, ok := rows[teamID]; ok {
+			continue
+		}
+		rows[teamID] = FrequencyRow{Pk: GetFrequencyPK(teamID, userID), TeamID: teamID, UserID: userID}
+		keys = append(keys, tokenKey(GetFrequencyPK(teamID, userID)))
+	}
+
+	items, err := s.batchGetTokensItems(ctx, keys)
+	if err != nil {
+		return nil, fmt.Errorf("error batch fetching frequency rows: %w", err)
+	}
+
+	var page []FrequencyRow
+	err = attributevalue.UnmarshalListOfMaps(items, &page)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling frequency rows: %w", err)
+	}
+	for _, row := range page {
+		rows[row.TeamID] = row
+	}
+	return rows, nil
+}
+
+func (s *DynamoStore) PutFrequencyRow(ctx context.Context, row *FrequencyRow) error {
+	item, err := attributevalue.MarshalMap(row)
+	if err != nil {
+		return fmt.Errorf("error marshaling frequency row: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tokensTable()),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("error writing frequency row: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetPacingRow(ctx context.Context, teamID string) (*PacingRow, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tokensTable()),
+		Key:            tokenKey(GetPacingPK(teamID)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching budget pacing: %w", err)
+	}
+
+	row := PacingRow{Pk: GetPacingPK(teamID), TeamID: teamID}
+	if result.Item == nil {
+		return &row, nil
+	}
+	err = attributevalue.UnmarshalMap(result.Item, &row)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling budget pacing: %w", err)
+	}
+	return &row, nil
+}
+
+func (s *DynamoStore) AddPacedSpend(ctx context.Context, teamID string, amount, windowStartMs, limit int64) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tokensTable()),
+		Key:                 tokenKey(GetPacingPK(teamID)),
+		UpdateExpression:    aws.String("ADD spent :amount"),
+		ConditionExpression: aws.String("window_start_ms = :start AND spent <= :room"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":amount": &types.AttributeValueMemberN{Value: strconv.FormatInt(amount, 10)},
+			":start":  &types.AttributeValueMemberN{Value: strconv.FormatInt(windowStartMs, 10)},
+			":room":   &types.AttributeValueMemberN{Value: strconv.FormatInt(limit-amount, 10)},
+		},
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error pacing spend for %s: %w", teamID, err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) RollPacingWindow(ctx context.Context, teamID string, observedStartMs, windowStartMs, prevSpent, spent int64) error {
+	condition := "window_start_ms = :observed"
+	if observedStartMs == 0 {
+		condition = "attribute_not_exists(pk)"
+	}
+
+	values := map[string]types.AttributeValue{
+		":teamID": &types.AttributeValueMemberS{Value: teamID},
+		":start":  &types.AttributeValueMemberN{Value: strconv.FormatInt(windowStartMs, 10)},
+		":prev":   &types.AttributeValueMemberN{Value: strconv.FormatInt(prevSpent, 10)},
+		":spent":  &types.AttributeValueMemberN{Value: strconv.FormatInt(spent, 10)},
+	}
+	if observedStartMs != 0 {
+		values[":observed"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(observedStartMs, 10)}
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tokensTable()),
+		Key:       tokenKey(GetPacingPK(teamID)),
+		UpdateExpression: aws.String(`
+			SET team_id = :teamID,
+				window_start_ms = :start,
+				prev_spent = :prev,
+				spent = :spent
+		`),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error pacing spend for %s: %w", teamID, err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) RefundPacedSpend(ctx context.Context, teamID string, amount, windowStartMs int64) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tokensTable()),
+		Key:                 tokenKey(GetPacingPK(teamID)),
+		UpdateExpression:    aws.String("ADD spent :refund"),
+		ConditionExpression: aws.String("window_start_ms = :start"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":refund": &types.AttributeValueMemberN{Value: strconv.FormatInt(-amount, 10)},
+			":start":  &types.AttributeValueMemberN{Value: strconv.FormatInt(windowStartMs, 10)},
+		},
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error refunding paced spend for %s: %w", teamID, err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetQuotaRow(ctx context.Context, teamID string) (*QuotaRow, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tokensTable()),
+		Key:            tokenKey(GetQuotaPK(teamID)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching priority quota: %w", err)
+	}
+
+	row := QuotaRow{Pk: GetQuotaPK(teamID), TeamID: teamID}
+	if result.Item == nil {
+		return &row, nil
+	}
+	err = attributevalue.UnmarshalMap(result.Item, &row)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling priority quota: %w", err)
+	}
+	return &row, nil
+}
+
+func (s *DynamoStore) AddQuotaUsage(ctx context.Context, teamID string, priority, dayStartMs int64, limit int) error {
+	condition := "day_start_ms = :day"
+	values := map[string]types.AttributeValue{
+		":day":   &types.AttributeValueMemberN{Value: strconv.FormatInt(dayStartMs, 10)},
+		":start": &types.AttributeValueMemberN{Value: "0"},
+		":incr":  &types.AttributeValueMemberN{Value: "1"},
+	}
+	if limit > 0 {
+		condition += " AND (attribute_not_exists(#usage.#priority) OR #usage.#priority < :limit)"
+		values[":limit"] = &types.AttributeValueMemberN{Value: strconv.Itoa(limit)}
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tokensTable()),
+		Key:                 tokenKey(GetQuotaPK(teamID)),
+		UpdateExpression:    aws.String("SET #usage.#priority = if_not_exists(#usage.#priority, :start) + :incr"),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]string{
+			"#usage":    "usage",
+			"#priority": strconv.FormatInt(priority, 10),
+		},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error counting priority quota for %s: %w", teamID, err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) RollQuotaDay(ctx context.Context, teamID string, observedStartMs, dayStartMs, priority int64) error {
+	condition := "day_start_ms = :observed"
+	if observedStartMs == 0 {
+		condition = "attribute_not_exists(pk)"
+	}
+
+	usage, err := attributevalue.Marshal(map[int]int{int(priority): 1})
+	if err != nil {
+		return fmt.Errorf("error marshaling priority quota usage: %w", err)
+	}
+	values := map[string]types.AttributeValue{
+		":teamID": &types.AttributeValueMemberS{Value: teamID},
+		":day":    &types.AttributeValueMemberN{Value: strconv.FormatInt(dayStartMs, 10)},
+		":usage":  usage,
+	}
+	if observedStartMs != 0 {
+		values[":observed"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(observedStartMs, 10)}
+	}
+
+	_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tokensTable()),
+		Key:                       tokenKey(GetQuotaPK(teamID)),
+		UpdateExpression:          aws.String("SET team_id = :teamID, day_start_ms = :day, #usage = :usage"),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  map[string]string{"#usage": "usage"},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error counting priority quota for %s: %w", teamID, err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) RefundQuotaUsage(ctx context.Context, teamID string, priority, dayStartMs int64) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tokensTable()),
+		Key:                 tokenKey(GetQuotaPK(teamID)),
+		UpdateExpression:    aws.String("SET #usage.#priority = #usage.#priority - :decr"),
+		ConditionExpression: aws.String("day_start_ms = :day AND #usage.#priority > :zero"),
+		ExpressionAttributeNames: map[string]string{
+			"#usage":    "usage",
+			"#priority": strconv.FormatInt(priority, 10),
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":day":  &types.AttributeValueMemberN{Value: strconv.FormatInt(dayStartMs, 10)},
+			":decr": &types.AttributeValueMemberN{Value: "1"},
+			":zero": &types.AttributeValueMemberN{Value: "0"},
+		},
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error refunding priority quota for %s: %w", teamID, err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) SetTokenBalance(ctx context.Context, teamID string, balance, observed, nowMs int64) error {
+	entry, err := newLedgerEntry(teamID, LedgerCorrection, balance-observed, "", nowMs)
+	if err != nil {
+		return err
+	}
+	ledger, err := s.ledgerPuts(entry)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]types.AttributeValue{
+		":expected": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(balance, 10),
+		},
+		":observed": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(observed, 10),
+		},
+	}
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName:                 aws.String(s.tokensTable()),
+					Key:                       tokenKey(GetTokenPK(teamID)),
+					UpdateExpression:          aws.String(versioned("SET token_balance = :expected", values)),
+					ConditionExpression:       aws.String("token_balance = :observed"),
+					ExpressionAttributeValues: values,
+				},
+			},
+		}, ledger...),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error fixing token balance: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) AdjustReputation(ctx context.Context, e *ReputationEvent, observed *TokenDBRow, floor, ceiling int64) error {
+	e.Reputation = clampReputation(observed.ReputationScore, e.Delta, floor, ceiling)
+	e.Delta = e.Reputation - observed.ReputationScore
+
+	values := map[string]types.AttributeValue{
+		":reputation": &types.AttributeValueMemberN{Value: strconv.FormatInt(e.Reputation, 10)},
+	}
+	update := &types.Update{
+		TableName:                 aws.String(s.tokensTable()),
+		Key:                       tokenKey(GetTokenPK(e.TeamID)),
+		UpdateExpression:          aws.String(versioned("SET reputation_score = :reputation", values)),
+		ConditionExpression:       aws.String(versionCondition(observed.Version, values)),
+		ExpressionAttributeValues: values,
+	}
+	if e.DedupeKey == "" {
+		_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 update.TableName,
+			Key:                       update.Key,
+			UpdateExpression:          update.UpdateExpression,
+			ConditionExpression:       update.ConditionExpression,
+			ExpressionAttributeValues: update.ExpressionAttributeValues,
+		})
+		if err != nil {
+			if isConditionFailure(err) {
+				return &ConditionFailedError{}
+			}
+			return fmt.Errorf("error adjusting reputation score: %w", err)
+		}
+		return nil
+	}
+
+	eventAV, err := attributevalue.MarshalMap(e)
+	if err != nil {
+		return fmt.Errorf("error marshaling reputation event: %w", err)
+	}
+
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Update: update},
+			{
+				Put: &types.Put{
+					TableName:           aws.String(s.tokensTable()),
+					Item:                eventAV,
+					ConditionExpression: aws.String("attribute_not_exists(pk)"),
+				},
+			},
+		},
+	})
+	if cancelledBy(err, 1) {
+		return fmt.Errorf("%w: %s", ErrDuplicateReputationEvent, e.DedupeKey)
+	}
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error adjusting reputation score: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) RecoverReputation(ctx context.Context, teamID string, increase, ceiling, observedMs, recoveredMs int64) error {
+	condition := "last_reputation_recovery_ms = :observed"
+	if observedMs == 0 {
+		condition = "attribute_not_exists(last_reputation_recovery_ms) OR " + condition
+	}
+
+	values := map[string]types.AttributeValue{
+		":increase": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(increase, 10),
+		},
+		":recovered": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(recoveredMs, 10),
+		},
+		":observed": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(observedMs, 10),
+		},
+	}
+	if increase > 0 {
+		// condition expressions can't do arithmetic, so the ceiling less
+		// the increase is the highest reputation the raise may start from
+		condition = "(" + condition + ") AND reputation_score <= :highest"
+		values[":highest"] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(ceiling-increase, 10),
+		}
+	}
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tokensTable()),
+		Key:       tokenKey(GetTokenPK(teamID)),
+		UpdateExpression: aws.String(versioned(`
+			SET reputation_score = reputation_score + :increase,
+				last_reputation_recovery_ms = :recovered`, values)),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error recovering reputation for %s: %w", teamID, err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) TransferTokens(ctx context.Context, t *TransferRow) (*TokenDBRow, *TokenDBRow, error) {
+	transferAV, err := attributevalue.MarshalMap(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	debit, err := newLedgerEntry(t.FromTeamID, LedgerTransfer, -t.Amount, t.TransferID, t.CreatedAtMs)
+	if err != nil {
+		return nil, nil, err
+	}
+	credit, err := newLedgerEntry(t.ToTeamID, LedgerTransfer, t.Amount, t.TransferID, t.CreatedAtMs)
+	if err != nil {
+		return nil, nil, err
+	}
+	ledger, err := s.ledgerPuts(debit, credit)
+	if err != nil {
+		return nil, nil, err
+	}
+	amount := &types.AttributeValueMemberN{Value: strconv.FormatInt(t.Amount, 10)}
+	now := &types.AttributeValueMemberN{Value: strconv.FormatInt(t.CreatedAtMs, 10)}
+	fromValues := map[string]types.AttributeValue{":amount": amount, ":now": now}
+	toValues := map[string]types.AttributeValue{":amount": amount, ":now": now}
+
+	// the sender goes first so a failed balance check reports its row; see
+	// conditionFailureItem
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName:                           aws.String(s.tokensTable()),
+					Key:                                 tokenKey(GetTokenPK(t.FromTeamID)),
+					UpdateExpression:                    aws.String(versioned("SET token_balance = token_balance - :amount, updated_at_ms = :now", fromValues)),
+					ConditionExpression:                 aws.String("token_balance >= :amount"),
+					ExpressionAttributeValues:           fromValues,
+					ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName:                 aws.String(s.tokensTable()),
+					Key:                       tokenKey(GetTokenPK(t.ToTeamID)),
+					UpdateExpression:          aws.String(versioned("SET token_balance = token_balance + :amount, updated_at_ms = :now", toValues)),
+					ConditionExpression:       aws.String("attribute_exists(pk)"),
+					ExpressionAttributeValues: toValues,
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName:           aws.String(s.tokensTable()),
+					Item:                transferAV,
+					ConditionExpression: aws.String("attribute_not_exists(pk)"),
+				},
+			},
+		}, ledger...),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return nil, nil, conditionFailedError(err)
+		}
+		return nil, nil, fmt.Errorf("error transferring tokens: %w", err)
+	}
+
+	// transactions can't return values, so read the rows back
+	from, err := s.GetTokenRow(ctx, t.FromTeamID, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err := s.GetTokenRow(ctx, t.ToTeamID, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return from, to, nil
+}
+
+func (s *DynamoStore) AdjustBalance(ctx context.Context, a *AdjustmentRow) (*TokenDBRow, error) {
+	adjustmentAV, err := attributevalue.MarshalMap(a)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := newLedgerEntry(a.TeamID, LedgerAdjustment, a.Delta, a.AdjustmentID, a.CreatedAtMs)
+	if err != nil {
+		return nil, err
+	}
+	ledger, err := s.ledgerPuts(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	// a grant only needs the row to exist; a deduction needs the balance to
+	// cover it, which a missing row fails too
+	condition := "attribute_exists(pk)"
+	values := map[string]types.AttributeValue{
+		":delta": &types.AttributeValueMemberN{Value: strconv.FormatInt(a.Delta, 10)},
+		":now":   &types.AttributeValueMemberN{Value: strconv.FormatInt(a.CreatedAtMs, 10)},
+	}
+	if a.Delta < 0 {
+		condition = "token_balance >= :debit"
+		values[":debit"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(-a.Delta, 10)}
+	}
+
+	// the token row goes first so a failed condition reports it; see
+	// conditionFailureItem
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName:                           aws.String(s.tokensTable()),
+					Key:                                 tokenKey(GetTokenPK(a.TeamID)),
+					UpdateExpression:                    aws.String(versioned("SET token_balance = token_balance + :delta, updated_at_ms = :now", values)),
+					ConditionExpression:                 aws.String(condition),
+					ExpressionAttributeValues:           values,
+					ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName:           aws.String(s.tokensTable()),
+					Item:                adjustmentAV,
+					ConditionExpression: aws.String("attribute_not_exists(pk)"),
+				},
+			},
+		}, ledger...),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return nil, conditionFailedError(err)
+		}
+		return nil, fmt.Errorf("error adjusting token balance: %w", err)
+	}
+
+	// transactions can't return values, so read the row back
+	return s.GetTokenRow(ctx, a.TeamID, true)
+}
+
+func (s *DynamoStore) PlaceHold(ctx context.Context, hold *HoldRow, cooldownStartMs int64, winningBid *BidRow, reservation *HoldRow, lock *LockRef) error {
+	holdAV, err := attributevalue.MarshalMap(hold)
+	if err != nil {
+		return err
+	}
+
+	// a reservation's tokens are already held, so only the difference moves
+	update := `
+		SET token_balance = token_balance - :amount,
+			held_balance = if_not_exists(held_balance, :zero) + :amount`
+	condition := "token_balance >= :amount"
+	values := map[string]types.AttributeValue{
+		":amount": &types.AttributeValueMemberN{Value: strconv.FormatInt(reservedAmount(hold.Amount, reservation), 10)},
+		":zero":   &types.AttributeValueMemberN{Value: "0"},
+	}
+	update, condition = withWin(hold.CreatedAtMs, cooldownStartMs, update, condition, values)
+	update = versioned(update, values)
+
+	items := []types.TransactWriteItem{
+		{
+			Update: &types.Update{
+				TableName:                           aws.String(s.tokensTable()),
+				Key:                                 tokenKey(GetTokenPK(hold.TeamID)),
+				UpdateExpression:                    aws.String(update),
+				ConditionExpression:                 aws.String(condition),
+				ExpressionAttributeValues:           values,
+				ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+			},
+		},
+		{
+			Put: &types.Put{
+				TableName:           aws.String(s.tokensTable()),
+				Item:                holdAV,
+				ConditionExpression: aws.String("attribute_not_exists(pk)"),
+			},
+		},
+	}
+	if winningBid != nil {
+		bidAV, err := attributevalue.MarshalMap(winningBid)
+		if err != nil {
+			return err
+		}
+		items = append(items, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName: aws.String(s.bidsTable()),
+				Item:      bidAV,
+			},
+		})
+	}
+	if reservation != nil {
+		items = append(items, s.deleteReservation(reservation))
+	}
+	lockItem := len(items)
+	if lock != nil {
+		items = append(items, s.checkLock(lock))
+	}
+	entry, err := newLedgerEntry(hold.TeamID, LedgerHold, -reservedAmount(hold.Amount, reservation), hold.HoldID, hold.CreatedAtMs)
+	if err != nil {
+		return err
+	}
+	ledger, err := s.ledgerPuts(entry)
+	if err != nil {
+		return err
+	}
+	items = append(items, ledger...)
+
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if lock != nil && cancelledBy(err, lockItem) {
+		return fmt.Errorf("%w: user %s", ErrAuctionLockLost, lock.UserID)
+	}
+	if err != nil {
+		if isConditionFailure(err) {
+			return conditionFailedError(err)
+		}
+		return fmt.Errorf("error placing hold: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) ReserveTokens(ctx context.Context, hold *HoldRow) error {
+	holdAV, err := attributevalue.MarshalMap(hold)
+	if err != nil {
+		return err
+	}
+	entry, err := newLedgerEntry(hold.TeamID, LedgerHold, -hold.Amount, hold.HoldID, hold.CreatedAtMs)
+	if err != nil {
+		return err
+	}
+	ledger, err := s.ledgerPuts(entry)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]types.AttributeValue{
+		":amount": &types.AttributeValueMemberN{Value: strconv.FormatInt(hold.Amount, 10)},
+		":zero":   &types.AttributeValueMemberN{Value: "0"},
+	}
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName: aws.String(s.tokensTable()),
+					Key:       tokenKey(GetTokenPK(hold.TeamID)),
+					UpdateExpression: aws.String(versioned(`
+						SET token_balance = token_balance - :amount,
+							held_balance = if_not_exists(held_balance, :zero) + :amount`, values)),
+					ConditionExpression:                 aws.String("token_balance >= :amount"),
+					ExpressionAttributeValues:           values,
+					ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName:           aws.String(s.tokensTable()),
+					Item:                holdAV,
+					ConditionExpression: aws.String("attribute_not_exists(pk)"),
+				},
+			},
+		}, ledger...),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return conditionFailedError(err)
+		}
+		return fmt.Errorf("error reserving tokens: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetHold(ctx context.Context, holdID string) (*HoldRow, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tokensTable()),
+		Key:            tokenKey(GetHoldPK(holdID)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching hold: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: %s", ErrHoldNotFound, holdID)
+	}
+
+	var hold HoldRow
+	err = attributevalue.UnmarshalMap(result.Item, &hold)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling hold: %w", err)
+	}
+	return &hold, nil
+}
+
+func (s *DynamoStore) ConfirmHold(ctx context.Context, hold *HoldRow, nowMs int64) (*TokenDBRow, error) {
+	values := map[string]types.AttributeValue{
+		":amount": &types.AttributeValueMemberN{Value: strconv.FormatInt(hold.Amount, 10)},
+		":incr":   &types.AttributeValueMemberN{Value: "1"},
+		":start":  &types.AttributeValueMemberN{Value: "0"},
+	}
+	_, err := s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Delete: &types.Delete{
+					TableName:           aws.String(s.tokensTable()),
+					Key:                 tokenKey(hold.Pk),
+					ConditionExpression: aws.String("attribute_exists(pk) AND expires_at_ms > :now"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(nowMs, 10)},
+					},
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName: aws.String(s.tokensTable()),
+					Key:       tokenKey(GetTokenPK(hold.TeamID)),
+					UpdateExpression: aws.String(versioned(`
+						SET held_balance = held_balance - :amount,
+							priority_usage.#usage_key = if_not_exists(priority_usage.#usage_key, :start) + :incr`, values)),
+					ExpressionAttributeNames: map[string]string{
+						"#usage_key": strconv.FormatInt(hold.Priority, 10),
+					},
+					ExpressionAttributeValues: values,
+				},
+			},
+		},
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return nil, &ConditionFailedError{}
+		}
+		return nil, fmt.Errorf("error confirming hold: %w", err)
+	}
+
+	// transactions can't return values, so read the row back
+	return s.GetTokenRow(ctx, hold.TeamID, true)
+}
+
+func (s *DynamoStore) ReleaseHold(ctx context.Context, hold *HoldRow, nowMs int64) error {
+	entry, err := newLedgerEntry(hold.TeamID, LedgerRelease, hold.Amount, hold.HoldID, nowMs)
+	if err != nil {
+		return err
+	}
+	ledger, err := s.ledgerPuts(entry)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]types.AttributeValue{
+		":amount": &types.AttributeValueMemberN{Value: strconv.FormatInt(hold.Amount, 10)},
+	}
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]types.TransactWriteItem{
+			{
+				Delete: &types.Delete{
+					TableName:           aws.String(s.tokensTable()),
+					Key:                 tokenKey(hold.Pk),
+					ConditionExpression: aws.String("attribute_exists(pk)"),
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName: aws.String(s.tokensTable()),
+					Key:       tokenKey(GetTokenPK(hold.TeamID)),
+					UpdateExpression: aws.String(versioned(`
+						SET token_balance = token_balance + :amount,
+							held_balance = held_balance - :amount`, values)),
+					ExpressionAttributeValues: values,
+				},
+			},
+		}, ledger...),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error releasing hold: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) ExpiredHolds(ctx context.Context, nowMs int64) ([]HoldRow, error) {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName:        aws.String(s.tokensTable()),
+		FilterExpression: aws.String("begins_with(pk, :prefix) AND expires_at_ms <= :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":prefix": &types.AttributeValueMemberS{Value: GetHoldPK("")},
+			":now": &types.AttributeValueMemberN{
+				Value: strconv.FormatInt(nowMs, 10),
+			},
+		},
+	})
+
+	var holds []HoldRow
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan holds: %w", err)
+		}
+
+		var pageHolds []HoldRow
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageHolds)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal holds: %w", err)
+		}
+		holds = append(holds, pageHolds...)
+	}
+	return holds, nil
+}
+
+// AcquireLock puts the lock as an item in the tokens table under
+// lock#<userID>.
+func (s *DynamoStore) AcquireLock(ctx context.Context, userID, owner string, nowMs, expiresAtMs int64) error {
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tokensTable()),
+		Item: map[string]types.AttributeValue{
+			"pk":            &types.AttributeValueMemberS{Value: GetLockPK(userID)},
+			"owner":         &types.AttributeValueMemberS{Value: owner},
+			"expires_at_ms": &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAtMs, 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR expires_at_ms < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(nowMs, 10)},
+		},
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error locking auction: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) ReleaseLock(ctx context.Context, userID, owner string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(s.tokensTable()),
+		Key:                 tokenKey(GetLockPK(userID)),
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]string{
+			"#owner": "owner",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: owner},
+		},
+	})
+	if err != nil && !isConditionFailure(err) {
+		return fmt.Errorf("error unlocking auction: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) ClaimIdempotencyKey(ctx context.Context, row *IdempotencyRow, nowMs int64) error {
+	av, err := attributevalue.MarshalMap(row)
+	if err != nil {
+		return fmt.Errorf("error marshaling idempotency row: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.tokensTable()),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR expires_at_ms < :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(nowMs, 10)},
+		},
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error claiming idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetIdempotencyRow(ctx context.Context, key string) (*IdempotencyRow, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tokensTable()),
+		Key:            tokenKey(GetIdempotencyPK(key)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching idempotency row: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var row IdempotencyRow
+	err = attributevalue.UnmarshalMap(result.Item, &row)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling idempotency row: %w", err)
+	}
+	return &row, nil
+}
+
+func (s *DynamoStore) PutIdempotencyRow(ctx context.Context, row *IdempotencyRow) error {
+	av, err := attributevalue.MarshalMap(row)
+	if err != nil {
+		return fmt.Errorf("error marshaling idempotency row: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tokensTable()),
+		Item:      av,
+	})
+	if err != nil {
+		return fmt.Errorf("error recording idempotency row: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) DeleteIdempotencyRow(ctx context.Context, key string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tokensTable()),
+		Key:       tokenKey(GetIdempotencyPK(key)),
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting idempotency row: %w", err)
+	}
+	return nil
+}
+
+// PutBids writes a single row with PutItem and more in batches of
+// batchWriteLimit, retrying unprocessed items.
+func (s *DynamoStore) PutBids(ctx context.Context, rows []*BidRow) error {
+	if len(rows) == 1 {
+		brAv, err := attributevalue.MarshalMap(rows[0])
+		if err != nil {
+			return err
+		}
+
+		_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(s.bidsTable()),
+			Item:      brAv,
+		})
+		if err != nil {
+			return fmt.Errorf("error recording bid: %w", err)
+		}
+		return nil
+	}
+
+	for start := 0; start < len(rows); start += batchWriteLimit {
+		end := min(start+batchWriteLimit, len(rows))
+
+		requests := make([]types.WriteRequest, 0, end-start)
+		for _, br := range rows[start:end] {
+			brAv, err := attributevalue.MarshalMap(br)
+			if err != nil {
+				return err
+			}
+			requests = append(requests, types.WriteRequest{
+				PutRequest: &types.PutRequest{Item: brAv},
+			})
+		}
+
+		if err := s.batchWrite(ctx, s.bidsTable(), requests); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DynamoStore) MarkBidAborted(ctx context.Context, pk, sk string, nowMs int64) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.bidsTable()),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: pk},
+			"sk": &types.AttributeValueMemberS{Value: sk},
+		},
+		UpdateExpression: aws.String("SET aborted = :aborted, updated_at_ms = :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":aborted": &types.AttributeValueMemberBOOL{Value: true},
+			":now": &types.AttributeValueMemberN{
+				Value: strconv.FormatInt(nowMs, 10),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error marking bid aborted: %w", err)
+	}
+	return nil
+}
+
+// QueryBids pages through the partition until q.Limit bids are read. A
+// WonOnly or q.Filter query is filtered: DynamoDB still reads, and bills
+// for, every bid in the partition.
+func (s *DynamoStore) QueryBids(ctx context.Context, q BidQuery) ([]BidRow, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.bidsTable()),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: q.Pk},
+		},
+	}
+	switch {
+	case q.NewestFirst:
+		input.IndexName = aws.String(IndexNameBidsByCreatedAt)
+		input.ScanIndexForward = aws.Bool(false)
+	case q.AfterSk != "":
+		input.KeyConditionExpression = aws.String("pk = :pk AND sk > :afterSk")
+		input.ExpressionAttributeValues[":afterSk"] = &types.AttributeValueMemberS{Value: q.AfterSk}
+	case q.SkPrefix != "":
+		input.KeyConditionExpression = aws.String("pk = :pk AND begins_with(sk, :skPrefix)")
+		input.ExpressionAttributeValues[":skPrefix"] = &types.AttributeValueMemberS{Value: q.SkPrefix}
+	}
+
+	var filters []string
+	if q.WonOnly {
+		filters = append(filters, "won = :won")
+		input.ExpressionAttributeValues[":won"] = &types.AttributeValueMemberBOOL{Value: true}
+	}
+	if f := q.Filter; f != (BidFilter{}) {
+		input.ExpressionAttributeNames = map[string]string{}
+		if f.FromMs > 0 {
+			filters = append(filters, "#createdAt >= :fromMs")
+			input.ExpressionAttributeNames["#createdAt"] = "created_at_ms"
+			input.ExpressionAttributeValues[":fromMs"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(f.FromMs, 10)}
+		}
+		if f.ToMs > 0 {
+			filters = append(filters, "#createdAt < :toMs")
+			input.ExpressionAttributeNames["#createdAt"] = "created_at_ms"
+			input.ExpressionAttributeValues[":toMs"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(f.ToMs, 10)}
+		}
+		if f.Priority != 0 {
+			filters = append(filters, "#priority = :priority")
+			input.ExpressionAttributeNames["#priority"] = "priority"
+			input.ExpressionAttributeValues[":priority"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(f.Priority, 10)}
+		}
+		if f.UserID != "" {
+			filters = append(filters, "#target = :target")
+			input.ExpressionAttributeNames["#target"] = "target"
+			input.ExpressionAttributeValues[":target"] = &types.AttributeValueMemberS{Value: f.UserID}
+		}
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+	}
+	if q.Limit > 0 && len(filters) == 0 {
+		input.Limit = aws.Int32(int32(min(q.Limit, math.MaxInt32)))
+	}
+
+	var bids []BidRow
+	paginator := dynamodb.NewQueryPaginator(s.client, input)
+	for paginator.HasMorePages() && (q.Limit <= 0 || len(bids) < q.Limit) {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query table: %w", err)
+		}
+
+		var pageBids []BidRow
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageBids)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal query result: %w", err)
+		}
+		bids = append(bids, pageBids...)
+	}
+
+	if q.Limit > 0 && len(bids) > q.Limit {
+		bids = bids[:q.Limit]
+	}
+	return bids, nil
+}
+
+// QueryBidsByTarget reads the bids_by_target index, which is eventually
+// consistent.
+func (s *DynamoStore) QueryBidsByTarget(ctx context.Context, userID string) ([]BidRow, error) {
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.bidsTable()),
+		IndexName:              aws.String(IndexNameBidsByTarget),
+		KeyConditionExpression: aws.String("target = :target"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":target": &types.AttributeValueMemberS{Value: userID},
+		},
+	})
+
+	var bids []BidRow
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query table: %w", err)
+		}
+
+		var pageBids []BidRow
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageBids)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal query result: %w", err)
+		}
+		bids = append(bids, pageBids...)
+	}
+	return bids, nil
+}
+
+// QueryExpiringBids queries every expiry bucket of every hour in the range.
+func (s *DynamoStore) QueryExpiringBids(ctx context.Context, fromSec, toSec int64) ([]BidRow, error) {
+	var bids []BidRow
+	for _, bucket := range bidExpiryBuckets(fromSec, toSec) {
+		paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+			TableName:              aws.String(s.bidsTable()),
+			IndexName:              aws.String(IndexNameBidsByExpiry),
+			KeyConditionExpression: aws.String("expiry_bucket = :bucket AND expires_at BETWEEN :from AND :last"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":bucket": &types.AttributeValueMemberS{Value: bucket},
+				":from":   &types.AttributeValueMemberN{Value: strconv.FormatInt(fromSec, 10)},
+				":last":   &types.AttributeValueMemberN{Value: strconv.FormatInt(toSec-1, 10)},
+			},
+		})
+
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("error querying expiring bids: %w", err)
+			}
+
+			var pageBids []BidRow
+			err = attributevalue.UnmarshalListOfMaps(page.Items, &pageBids)
+			if err != nil {
+				return nil, fmt.Errorf("error unmarshaling bids: %w", err)
+			}
+			bids = append(bids, pageBids...)
+		}
+	}
+	return bids, nil
+}
+
+func (s *DynamoStore) GetBidArchiveWatermark(ctx context.Context) (int64, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tokensTable()),
+		Key:            tokenKey(bidArchivePK),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error fetching bid archive watermark: %w", err)
+	}
+	if result.Item == nil {
+		return 0, nil
+	}
+
+	var row struct {
+		ArchivedThrough int64 `dynamodbav:"archived_through"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, &row); err != nil {
+		return 0, fmt.Errorf("error unmarshaling bid archive watermark: %w", err)
+	}
+	return row.ArchivedThrough, nil
+}
+
+func (s *DynamoStore) AdvanceBidArchiveWatermark(ctx context.Context, fromSec, toSec int64) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tokensTable()),
+		Key:                 tokenKey(bidArchivePK),
+		UpdateExpression:    aws.String("SET archived_through = :to"),
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR archived_through = :from"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":from": &types.AttributeValueMemberN{Value: strconv.FormatInt(fromSec, 10)},
+			":to":   &types.AttributeValueMemberN{Value: strconv.FormatInt(toSec, 10)},
+		},
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error advancing bid archive watermark: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) DeleteBids(ctx context.Context, pk string) (int, error) {
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.bidsTable()),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ProjectionExpression:   aws.String("pk, sk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: pk},
+		},
+	})
+
+	var deleted int
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to query table: %w", err)
+		}
+
+		for start := 0; start < len(page.Items); start += batchWriteLimit {
+			end := min(start+batchWriteLimit, len(page.Items))
+
+			requests := make([]types.WriteRequest, 0, end-start)
+			for _, item := range page.Items[start:end] {
+				requests = append(requests, types.WriteRequest{
+					DeleteRequest: &types.DeleteRequest{Key: item},
+				})
+			}
+
+			if err := s.batchWrite(ctx, s.bidsTable(), requests); err != nil {
+				return deleted, err
+			}
+			deleted += len(requests)
+		}
+	}
+
+	return deleted, nil
+}
+
+// PutAuctionWindow puts the window as an item in the tokens table under
+// window#<auctionID>.
+func (s *DynamoStore) PutAuctionWindow(ctx context.Context, w *AuctionWindow) error {
+	item, err := attributevalue.MarshalMap(w)
+	if err != nil {
+		return fmt.Errorf("error marshaling auction window: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.tokensTable()),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error opening auction window: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetAuctionWindow(ctx context.Context, auctionID string) (*AuctionWindow, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tokensTable()),
+		Key:            tokenKey(GetAuctionWindowPK(auctionID)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching auction window: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: %s", ErrAuctionWindowNotFound, auctionID)
+	}
+
+	var w AuctionWindow
+	err = attributevalue.UnmarshalMap(result.Item, &w)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling auction window: %w", err)
+	}
+	return &w, nil
+}
+
+func (s *DynamoStore) AddWindowBid(ctx context.Context, auctionID string, bid WindowBid, nowMs int64, maxBids int) error {
+	bidAV, err := attributevalue.Marshal(bid)
+	if err != nil {
+		return fmt.Errorf("error marshaling window bid: %w", err)
+	}
+
+	_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(s.tokensTable()),
+		Key:              tokenKey(GetAuctionWindowPK(auctionID)),
+		UpdateExpression: aws.String("SET bids = list_append(bids, :bid)"),
+		ConditionExpression: aws.String(
+			"#state = :open AND deadline_ms > :now AND size(bids) < :maxBids",
+		),
+		// state is a reserved word
+		ExpressionAttributeNames: map[string]string{"#state": "state"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":bid":     &types.AttributeValueMemberL{Value: []types.AttributeValue{bidAV}},
+			":open":    &types.AttributeValueMemberS{Value: AuctionWindowOpen},
+			":now":     &types.AttributeValueMemberN{Value: strconv.FormatInt(nowMs, 10)},
+			":maxBids": &types.AttributeValueMemberN{Value: strconv.Itoa(maxBids)},
+		},
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error adding bid to auction window: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) SettleAuctionWindow(ctx context.Context, auctionID string, result *AuctionResult, nowMs int64) error {
+	update := "SET #state = :settled, settled_at_ms = :now"
+	values := map[string]types.AttributeValue{
+		":open":    &types.AttributeValueMemberS{Value: AuctionWindowOpen},
+		":settled": &types.AttributeValueMemberS{Value: AuctionWindowSettled},
+		":now":     &types.AttributeValueMemberN{Value: strconv.FormatInt(nowMs, 10)},
+	}
+	if result != nil {
+		resultAV, err := attributevalue.Marshal(result)
+		if err != nil {
+			return fmt.Errorf("error marshaling auction result: %w", err)
+		}
+		update += ", #result = :result"
+		values[":result"] = resultAV
+	}
+
+	names := map[string]string{"#state": "state"}
+	if result != nil {
+		names["#result"] = "result"
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tokensTable()),
+		Key:                       tokenKey(GetAuctionWindowPK(auctionID)),
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String("#state = :open"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error settling auction window: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) DueAuctionWindows(ctx context.Context, nowMs int64) ([]AuctionWindow, error) {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName:                aws.String(s.tokensTable()),
+		FilterExpression:         aws.String("begins_with(pk, :prefix) AND #state = :open AND deadline_ms <= :now"),
+		ExpressionAttributeNames: map[string]string{"#state": "state"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":prefix": &types.AttributeValueMemberS{Value: GetAuctionWindowPK("")},
+			":open":   &types.AttributeValueMemberS{Value: AuctionWindowOpen},
+			":now": &types.AttributeValueMemberN{
+				Value: strconv.FormatInt(nowMs, 10),
+			},
+		},
+	})
+
+	var windows []AuctionWindow
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan auction windows: %w", err)
+		}
+
+		var pageWindows []AuctionWindow
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageWindows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal auction windows: %w", err)
+		}
+		windows = append(windows, pageWindows...)
+	}
+	return windows, nil
+}
+
+// PutDutchAuction puts the auction as an item in the tokens table under
+// dutch#<auctionID>.
+func (s *DynamoStore) PutDutchAuction(ctx context.Context, a *DutchAuction) error {
+	item, err := attributevalue.MarshalMap(a)
+	if err != nil {
+		return fmt.Errorf("error marshaling dutch auction: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.tokensTable()),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error opening dutch auction: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetDutchAuction(ctx context.Context, auctionID string) (*DutchAuction, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tokensTable()),
+		Key:            tokenKey(GetDutchAuctionPK(auctionID)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching dutch auction: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDutchAuctionNotFound, auctionID)
+	}
+
+	var a DutchAuction
+	err = attributevalue.UnmarshalMap(result.Item, &a)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling dutch auction: %w", err)
+	}
+	return &a, nil
+}
+
+func (s *DynamoStore) ClaimDutchAuction(ctx context.Context, auctionID, teamID string, price, nowMs int64) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tokensTable()),
+		Key:                 tokenKey(GetDutchAuctionPK(auctionID)),
+		UpdateExpression:    aws.String("SET #state = :sold, team_id = :team, price = :price, sold_at_ms = :now"),
+		ConditionExpression: aws.String("#state = :open AND deadline_ms > :now"),
+		// state is a reserved word
+		ExpressionAttributeNames: map[string]string{"#state": "state"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":open":  &types.AttributeValueMemberS{Value: DutchAuctionOpen},
+			":sold":  &types.AttributeValueMemberS{Value: DutchAuctionSold},
+			":team":  &types.AttributeValueMemberS{Value: teamID},
+			":price": &types.AttributeValueMemberN{Value: strconv.FormatInt(price, 10)},
+			":now":   &types.AttributeValueMemberN{Value: strconv.FormatInt(nowMs, 10)},
+		},
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error claiming dutch auction: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) ReleaseDutchAuction(ctx context.Context, auctionID, teamID string) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(s.tokensTable()),
+		Key:                      tokenKey(GetDutchAuctionPK(auctionID)),
+		UpdateExpression:         aws.String("SET #state = :open REMOVE team_id, price, sold_at_ms"),
+		ConditionExpression:      aws.String("#state = :sold AND team_id = :team"),
+		ExpressionAttributeNames: map[string]string{"#state": "state"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":open": &types.AttributeValueMemberS{Value: DutchAuctionOpen},
+			":sold": &types.AttributeValueMemberS{Value: DutchAuctionSold},
+			":team": &types.AttributeValueMemberS{Value: teamID},
+		},
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error releasing dutch auction: %w", err)
+	}
+	return nil
+}
+
+// PutAutoBidPolicy puts the policy as an item in the tokens table under
+// autobid#<teamID>.
+func (s *DynamoStore) PutAutoBidPolicy(ctx context.Context, p *AutoBidPolicy) error {
+	item, err := attributevalue.MarshalMap(p)
+	if err != nil {
+		return fmt.Errorf("error marshaling auto-bid policy: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tokensTable()),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("error writing auto-bid policy: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetAutoBidPolicy(ctx context.Context, teamID string) (*AutoBidPolicy, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tokensTable()),
+		Key:            tokenKey(GetAutoBidPolicyPK(teamID)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching auto-bid policy: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: %s", ErrAutoBidPolicyNotFound, teamID)
+	}
+
+	var p AutoBidPolicy
+	err = attributevalue.UnmarshalMap(result.Item, &p)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling auto-bid policy: %w", err)
+	}
+	return &p, nil
+}
+
+func (s *DynamoStore) DeleteAutoBidPolicy(ctx context.Context, teamID string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(s.tokensTable()),
+		Key:                 tokenKey(GetAutoBidPolicyPK(teamID)),
+		ConditionExpression: aws.String("attribute_exists(pk)"),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return fmt.Errorf("%w: %s", ErrAutoBidPolicyNotFound, teamID)
+		}
+		return fmt.Errorf("error deleting auto-bid policy: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) ListAutoBidPolicies(ctx context.Context) ([]AutoBidPolicy, error) {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName:        aws.String(s.tokensTable()),
+		FilterExpression: aws.String("begins_with(pk, :prefix)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":prefix": &types.AttributeValueMemberS{Value: GetAutoBidPolicyPK("")},
+		},
+	})
+
+	var policies []AutoBidPolicy
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan auto-bid policies: %w", err)
+		}
+
+		var pagePolicies []AutoBidPolicy
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pagePolicies)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal auto-bid policies: %w", err)
+		}
+		policies = append(policies, pagePolicies...)
+	}
+	return policies, nil
+}
+
+func (s *DynamoStore) PutWebhook(ctx context.Context, w *Webhook) error {
+	item, err := attributevalue.MarshalMap(w)
+	if err != nil {
+		return fmt.Errorf("error marshaling webhook: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tokensTable()),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("error writing webhook: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetWebhook(ctx context.Context, teamID string) (*Webhook, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tokensTable()),
+		Key:            tokenKey(GetWebhookPK(teamID)),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching webhook: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: %s", ErrWebhookNotFound, teamID)
+	}
+
+	var w Webhook
+	err = attributevalue.UnmarshalMap(result.Item, &w)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling webhook: %w", err)
+	}
+	return &w, nil
+}
+
+func (s *DynamoStore) DeleteWebhook(ctx context.Context, teamID string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(s.tokensTable()),
+		Key:                 tokenKey(GetWebhookPK(teamID)),
+		ConditionExpression: aws.String("attribute_exists(pk)"),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return fmt.Errorf("%w: %s", ErrWebhookNotFound, teamID)
+		}
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) PutWebhookDeadLetter(ctx context.Context, d *WebhookDeadLetter) error {
+	item, err := attributevalue.MarshalMap(d)
+	if err != nil {
+		return fmt.Errorf("error marshaling webhook dead letter: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tokensTable()),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("error writing webhook dead letter: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) QueryWebhookDeadLetters(ctx context.Context, teamID string) ([]WebhookDeadLetter, error) {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName:        aws.String(s.tokensTable()),
+		FilterExpression: aws.String("begins_with(pk, :prefix) AND team_id = :team_id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":prefix":  &types.AttributeValueMemberS{Value: GetWebhookDeadLetterPK("")},
+			":team_id": &types.AttributeValueMemberS{Value: teamID},
+		},
+	})
+
+	var letters []WebhookDeadLetter
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook dead letters: %w", err)
+		}
+
+		var pageLetters []WebhookDeadLetter
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageLetters)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal webhook dead letters: %w", err)
+		}
+		letters = append(letters, pageLetters...)
+	}
+
+	slices.SortFunc(letters, func(a, b WebhookDeadLetter) int {
+		return cmp.Compare(a.CreatedAtMs, b.CreatedAtMs)
+	})
+	return letters, nil
+}
+
+func (s *DynamoStore) PutAuctionAudit(ctx context.Context, a *AuctionAudit) error {
+	item, err := attributevalue.MarshalMap(a)
+	if err != nil {
+		return fmt.Errorf("error marshaling auction audit: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.auctionsTable()),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	})
+	if err != nil {
+		if isConditionFailure(err) {
+			return &ConditionFailedError{}
+		}
+		return fmt.Errorf("error writing auction audit: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetAuctionAudit(ctx context.Context, auctionID string) (*AuctionAudit, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.auctionsTable()),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: GetAuctionAuditPK(auctionID)},
+			"sk": &types.AttributeValueMemberS{Value: auctionID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching auction audit: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: %s", ErrAuctionAuditNotFound, auctionID)
+	}
+
+	var a AuctionAudit
+	err = attributevalue.UnmarshalMap(result.Item, &a)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling auction audit: %w", err)
+	}
+	return &a, nil
+}
+
+func (s *DynamoStore) PutTeamStats(ctx context.Context, stats []TeamStats) error {
+	for start := 0; start < len(stats); start += batchWriteLimit {
+		end := min(start+batchWriteLimit, len(stats))
+
+		requests := make([]types.WriteRequest, 0, end-start)
+		for _, ts := range stats[start:end] {
+			item, err := attributevalue.MarshalMap(ts)
+			if err != nil {
+				return fmt.Errorf("error marshaling team stats: %w", err)
+			}
+			requests = append(requests, types.WriteRequest{
+				PutRequest: &types.PutRequest{Item: item},
+			})
+		}
+
+		if err := s.batchWrite(ctx, s.statsTable(), requests); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DynamoStore) GetTeamStats(ctx context.Context, teamID string) (*TeamStats, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.statsTable()),
+		Key:       tokenKey(GetTeamStatsPK(teamID)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching team stats: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: %s", ErrTeamStatsNotFound, teamID)
+	}
+
+	var ts TeamStats
+	err = attributevalue.UnmarshalMap(result.Item, &ts)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling team stats: %w", err)
+	}
+	return &ts, nil
+}
+
+func (s *DynamoStore) ScanTeamStats(ctx context.Context) ([]TeamStats, error) {
+	paginator := dynamodb.NewScanPaginator(s.client, &dynamodb.ScanInput{
+		TableName: aws.String(s.statsTable()),
+	})
+
+	var stats []TeamStats
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan team stats: %w", err)
+		}
+
+		var pageStats []TeamStats
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageStats)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal team stats: %w", err)
+		}
+		stats = append(stats, pageStats...)
+	}
+	return stats, nil
+}
+
+func (s *DynamoStore) PutAuction(ctx context.Context, row *AuctionRow) error {
+	arAv, err := attributevalue.MarshalMap(row)
+	if err != nil {
+		return fmt.Errorf("error marshaling auction record: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.auctionsTable()),
+		Item:      arAv,
+	})
+	if err != nil {
+		return fmt.Errorf("error recording auction: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) QueryAuctions(ctx context.Context, userID string) ([]AuctionRow, error) {
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.auctionsTable()),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: GetAuctionPK(userID)},
+		},
+		ScanIndexForward: aws.Bool(false),
+	})
+
+	var auctions []AuctionRow
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query table: %w", err)
+		}
+
+		var pageAuctions []AuctionRow
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageAuctions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal query result: %w", err)
+		}
+		auctions = append(auctions, pageAuctions...)
+	}
+
+	return auctions, nil
+}
+
+func (s *DynamoStore) PutBalanceSnapshot(ctx context.Context, snapshot *BalanceSnapshot) error {
+	snapshotAv, err := attributevalue.MarshalMap(snapshot)
+	if err != nil {
+		return fmt.Errorf("error marshaling balance snapshot: %w", err)
+	}
+
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.balanceHistoryTable()),
+		Item:      snapshotAv,
+	})
+	if err != nil {
+		return fmt.Errorf("error recording balance snapshot: %w", err)
+	}
+	return nil
+}
+
+func (s *DynamoStore) QueryBalanceSnapshots(ctx context.Context, teamID string, startMs, endMs int64) ([]BalanceSnapshot, error) {
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.balanceHistoryTable()),
+		KeyConditionExpression: aws.String("pk = :pk AND sk BETWEEN :start AND :end"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":    &types.AttributeValueMemberS{Value: GetBalanceHistoryPK(teamID)},
+			":start": &types.AttributeValueMemberS{Value: balanceHistorySkFrom(startMs)},
+			":end":   &types.AttributeValueMemberS{Value: balanceHistorySkTo(endMs)},
+		},
+	})
+
+	var snapshots []BalanceSnapshot
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query table: %w", err)
+		}
+
+		var pageSnapshots []BalanceSnapshot
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageSnapshots)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal query result: %w", err)
+		}
+		snapshots = append(snapshots, pageSnapshots...)
+	}
+
+	return snapshots, nil
+}
+
+func (s *DynamoStore) QueryLedger(ctx context.Context, teamID string, startMs, endMs int64) ([]LedgerEntry, error) {
+	paginator := dynamodb.NewQueryPaginator(s.client, &dynamodb.QueryInput{
+		TableName:              aws.String(s.ledgerTable()),
+		KeyConditionExpression: aws.String("pk = :pk AND sk BETWEEN :start AND :end"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":    &types.AttributeValueMemberS{Value: GetLedgerPK(teamID)},
+			":start": &types.AttributeValueMemberS{Value: balanceHistorySkFrom(startMs)},
+			":end":   &types.AttributeValueMemberS{Value: balanceHistorySkTo(endMs)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+
+	var entries []LedgerEntry
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query ledger: %w", err)
+		}
+
+		var pageEntries []LedgerEntry
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageEntries)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal ledger entries: %w", err)
+		}
+		entries = append(entries, pageEntries...)
+	}
+
+	return entries, nil
+}
+
+// ledgerPuts returns the transaction items appending entries to the ledger,
+// leaving out any that don't move the balance. They go after the token row
+// update they record, which reports a failed condition; see
+// conditionFailureItem.
+func (s *DynamoStore) ledgerPuts(entries ...*LedgerEntry) ([]types.TransactWriteItem, error) {
+	var items []types.TransactWriteItem
+	for _, entry := range entries {
+		if entry.Delta == 0 {
+			continue
+		}
+		entryAV, err := attributevalue.MarshalMap(entry)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling ledger entry: %w", err)
+		}
+		items = append(items, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName: aws.String(s.ledgerTable()),
+				Item:      entryAV,
+			},
+		})
+	}
+	return items, nil
+}
+
+// isConditionFailure reports whether err is a failed condition expression,
+// either on a single write or on an item of a transaction.
+func isConditionFailure(err error) bool {
+	var conditionCheckFailedErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionCheckFailedErr) {
+		return true
+	}
+
+	var canceledErr *types.TransactionCanceledException
+	if errors.As(err, &canceledErr) {
+		for _, reason := range canceledErr.CancellationReasons {
+			if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// conditionFailedError converts a failed condition on a token row write
+// into a ConditionFailedError carrying the row as DynamoDB returned it.
+func conditionFailedError(err error) error {
+	item := conditionFailureItem(err)
+	if item == nil {
+		return &ConditionFailedError{}
+	}
+
+	var row TokenDBRow
+	if attributevalue.UnmarshalMap(item, &row) != nil {
+		return &ConditionFailedError{}
+	}
+	return &ConditionFailedError{Row: &row}
+}
+
+// conditionFailureItem returns the item attached to a failed condition
+// check, either on a single write or on the first item of a transaction.
+func conditionFailureItem(err error) map[string]types.AttributeValue {
+	var conditionCheckFailedErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionCheckFailedErr) {
+		return conditionCheckFailedErr.Item
+	}
+
+	var canceledErr *types.TransactionCanceledException
+	if errors.As(err, &canceledErr) && len(canceledErr.CancellationReasons) > 0 {
+		return canceledErr.CancellationReasons[0].Item
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package tokens
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidConfig is returned by NewManagerFromConfig for settings that
+	// are out of range or inconsistent with each other.
+	ErrInvalidConfig = errors.New("invalid manager config")
+
+	// ErrSchemaMismatch is returned by EnsureTables when an existing table's
+	// key schema differs from the one the package expects.
+	ErrSchemaMismatch = errors.New("table key schema mismatch")
+
+	// ErrTooManyBids is returned by RunAuction when it is given more bids than
+	// the Manager's configured maximum.
+	ErrTooManyBids = errors.New("too many bids for auction")
+
+	// ErrInvalidBid is returned when an auction is given a bid it can't
+	// score, such as one with an unknown priority or no user ID, or several
+	// bids from one team under DuplicateBidsReject; see BidValidation.
+	ErrInvalidBid = errors.New("invalid bid")
+
+	// ErrBidNotFound is returned when a bid lookup matches no recorded bid.
+	ErrBidNotFound = errors.New("bid not found")
+
+	// ErrTeamNotFound is returned when a team has no token row.
+	ErrTeamNotFound = errors.New("team not found")
+
+	// ErrInvalidTeam is returned by CreateTeam for a team without an ID.
+	ErrInvalidTeam = errors.New("invalid team")
+
+	// ErrTeamExists is returned by CreateTeam for a team that already has a
+	// token row.
+	ErrTeamExists = errors.New("team already exists")
+
+	// ErrTeamSuspended is returned when a suspended team bids or spends;
+	// see SuspendTeam.
+	ErrTeamSuspended = errors.New("team suspended")
+
+	// ErrTeamArchived is returned when an archived team bids, spends or
+	// receives a transfer, or is suspended or reinstated; see ArchiveTeam.
+	ErrTeamArchived = errors.New("team archived")
+
+	// ErrInsufficientBalance is returned when a team cannot afford a spend.
+	ErrInsufficientBalance = errors.New("insufficient token balance")
+
+	// ErrInvalidCurrency is returned for a bid in a currency the Manager
+	// doesn't have, or one its priority can't spend; see Currency.
+	ErrInvalidCurrency = errors.New("invalid bid currency")
+
+	// ErrInvalidTransfer is returned by TransferTokens for a non-positive
+	// amount or a team transferring to itself.
+	ErrInvalidTransfer = errors.New("invalid token transfer")
+
+	// ErrInvalidAdjustment is returned by AdjustBalance for a zero delta or
+	// a missing reason or actor.
+	ErrInvalidAdjustment = errors.New("invalid balance adjustment")
+
+	// ErrInvalidPriceSchedule is returned by OpenDutchAuction for a
+	// schedule whose price doesn't descend from its start to its floor.
+	ErrInvalidPriceSchedule = errors.New("invalid price schedule")
+
+	// ErrInvalidAutoBidPolicy is returned by SetAutoBidPolicy for a
+	// non-positive max priority or a negative max cost or reserve.
+	ErrInvalidAutoBidPolicy = errors.New("invalid auto-bid policy")
+
+	// ErrUnknownPriority is returned when pricing a priority the cost map
+	// has no entry for.
+	ErrUnknownPriority = errors.New("unknown priority")
+
+	// ErrTargetCostUnreachable is returned by ReputationForTargetCost when
+	// no reputation brings a bid's cost down to the target.
+	ErrTargetCostUnreachable = errors.New("target cost unreachable")
+
+	// ErrBudgetExceeded is returned when a spend or charge would take a team
+	// past its budget pacing cap; see BudgetPacing.
+	ErrBudgetExceeded = errors.New("team budget exceeded")
+
+	// ErrQuotaExceeded is returned when a spend or charge would take a team
+	// past its daily quota for a priority under QuotaBlock; see
+	// PriorityQuotas.
+	ErrQuotaExceeded = errors.New("priority quota exceeded")
+
+	// ErrWinCooldown is returned when a team cannot win because it won
+	// another auction within its cooldown.
+	ErrWinCooldown = errors.New("team won too recently")
+
+	// ErrAuctionInProgress is returned by RunAuction when another auction
+	// for the same user is still running.
+	ErrAuctionInProgress = errors.New("auction already in progress for user")
+
+	// ErrNoWinner is returned by RunAuction when no bid could be awarded.
+	ErrNoWinner = errors.New("auction had no winner")
+
+	// ErrReserveNotMet is returned by RunAuction when no bid met the
+	// auction's reserve; see AuctionConfig.MinScore. It matches ErrNoWinner
+	// too.
+	ErrReserveNotMet = fmt.Errorf("reserve not met: %w", ErrNoWinner)
+
+	// ErrAuctionLockLost is returned when an auction's lock on its user
+	// expired and was taken over by another auction before a winner was
+	// charged, so nothing was charged. It matches ErrAuctionInProgress too.
+	ErrAuctionLockLost = fmt.Errorf("auction lock lost: %w", ErrAuctionInProgress)
+
+	// ErrAuctionConflict is returned when a charge lost a race with a
+	// concurrent write for a reason other than the team's balance or
+	// cooldown, e.g. its bid reservation was released. Retrying may succeed.
+	ErrAuctionConflict = errors.New("auction conflicted with a concurrent update")
+
+	// ErrHoldNotFound is returned when a hold does not exist, including when
+	// it was already confirmed, cancelled or released.
+	ErrHoldNotFound = errors.New("hold not found")
+
+	// ErrHoldExpired is returned when confirming a hold past its expiry.
+	ErrHoldExpired = errors.New("hold expired")
+
+	// ErrTruncateDisabled is returned by TruncateAll unless it was enabled
+	// with WithTruncateAll.
+	ErrTruncateDisabled = errors.New("truncate is disabled")
+
+	// ErrBidNotWon is returned by GetWinningBid for a bid that lost.
+	ErrBidNotWon = errors.New("bid did not win its auction")
+
+	// ErrIdempotencyKeyInUse is returned when a request reuses the
+	// idempotency key of one that is still running, or that failed without
+	// it being known whether it charged a team.
+	ErrIdempotencyKeyInUse = errors.New("idempotency key in use")
+
+	// ErrAuctionWindowNotFound is returned when an auction window does not
+	// exist.
+	ErrAuctionWindowNotFound = errors.New("auction window not found")
+
+	// ErrAuctionWindowClosed is returned when submitting a bid to an auction
+	// window whose deadline has passed.
+	ErrAuctionWindowClosed = errors.New("auction window closed")
+
+	// ErrAuctionWindowOpen is returned when settling an auction window
+	// before its deadline.
+	ErrAuctionWindowOpen = errors.New("auction window still open")
+
+	// ErrDutchAuctionNotFound is returned when a Dutch auction does not
+	// exist.
+	ErrDutchAuctionNotFound = errors.New("dutch auction not found")
+
+	// ErrDutchAuctionClosed is returned when accepting a Dutch auction
+	// another team won or whose deadline has passed.
+	ErrDutchAuctionClosed = errors.New("dutch auction closed")
+
+	// ErrAutoBidPolicyNotFound is returned when a team has no auto-bid
+	// policy.
+	ErrAutoBidPolicyNotFound = errors.New("auto-bid policy not found")
+
+	// ErrInvalidWebhook is returned when registering a webhook URL that
+	// isn't HTTPS.
+	ErrInvalidWebhook = errors.New("invalid webhook")
+
+	// ErrWebhookNotFound is returned when a team has no webhook.
+	ErrWebhookNotFound = errors.New("webhook not found")
+
+	// ErrTeamStatsNotFound is returned when a team has no stats, e.g.
+	// because ComputeTeamStats hasn't run since it was created.
+	ErrTeamStatsNotFound = errors.New("team stats not found")
+
+	// ErrAuctionAuditNotFound is returned when an auction has no audit
+	// record.
+	ErrAuctionAuditNotFound = errors.New("auction audit not found")
+
+	// ErrStoreUnavailable is returned while the store's circuit breaker is
+	// open; see WithCircuitBreaker.
+	ErrStoreUnavailable = errors.New("store unavailable")
+
+	// ErrInvalidCursor is returned by GetBidsPage for a cursor it didn't
+	// issue.
+	ErrInvalidCursor = errors.New("invalid page cursor")
+
+	// ErrConditionFailed is matched by errors from Store writes whose
+	// condition didn't hold; see ConditionFailedError.
+	ErrConditionFailed = errors.New("store condition failed")
+
+	// ErrDuplicateReputationEvent is returned by Store.AdjustReputation for
+	// a reputation event whose dedupe key was already recorded.
+	ErrDuplicateReputationEvent = errors.New("reputation event already applied")
+)
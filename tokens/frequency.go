@@ -0,0 +1,108 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// FrequencyCap limits how often a team can win a user: at most MaxWins
+// auctions for the same user within any Window. Bids from a team at its cap
+// for the auction's user are skipped.
+type FrequencyCap struct {
+	MaxWins int
+	Window  time.Duration
+}
+
+func (f *FrequencyCap) validate() error {
+	if f.MaxWins < 1 || f.Window < time.Millisecond {
+		return fmt.Errorf("frequency cap needs a positive max wins and window, got %d and %v", f.MaxWins, f.Window)
+	}
+	return nil
+}
+
+// FrequencyRow is a team's recent wins of a user, for FrequencyCap. It lives
+// in the tokens table. Wins are written under the user's auction lock, so
+// they need no condition.
+type FrequencyRow struct {
+	Pk     string `dynamodbav:"pk"`
+	TeamID string `dynamodbav:"team_id"`
+	UserID string `dynamodbav:"user_id"`
+	// WinTimesMs holds up to MaxWins of the latest wins, oldest first.
+	WinTimesMs []int64 `dynamodbav:"win_times_ms"`
+}
+
+// recentWins returns the wins of row since sinceMs.
+func (row *FrequencyRow) recentWins(sinceMs int64) []int64 {
+	for i, t := range row.WinTimesMs {
+		if t > sinceMs {
+			return row.WinTimesMs[i:]
+		}
+	}
+	return nil
+}
+
+// frequencyCapped returns which bids come from a team at its frequency cap
+// for the bid's user as of nowMs, keyed by GetFrequencyPK, or nil without a
+// cap.
+func (tm *Manager) frequencyCapped(ctx context.Context, bids []Bid, nowMs int64) (map[string]bool, error) {
+	f := tm.frequencyCap
+	if f == nil {
+		return nil, nil
+	}
+
+	teamsByUser := make(map[string][]string)
+	for _, bid := range bids {
+		teamsByUser[bid.UserID] = append(teamsByUser[bid.UserID], bid.TeamID)
+	}
+
+	capped := make(map[string]bool)
+	for userID, teamIDs := range teamsByUser {
+		rows, err := tm.store.BatchGetFrequencyRows(ctx, userID, teamIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			if len(row.recentWins(nowMs-f.Window.Milliseconds())) >= f.MaxWins {
+				capped[row.Pk] = true
+			}
+		}
+	}
+	return capped, nil
+}
+
+// recordUserWin adds a win of userID to a team's frequency row. Failures
+// are logged rather than returned since the team was already charged; the
+// win is then not counted against the cap.
+func (tm *Manager) recordUserWin(ctx context.Context, teamID, userID string, nowMs int64) {
+	f := tm.frequencyCap
+	if f == nil {
+		return
+	}
+
+	rows, err := tm.store.BatchGetFrequencyRows(ctx, userID, []string{teamID})
+	if err == nil {
+		row := rows[teamID]
+		wins := append(row.recentWins(nowMs-f.Window.Milliseconds()), nowMs)
+		if len(wins) > f.MaxWins {
+			wins = wins[len(wins)-f.MaxWins:]
+		}
+
+		err = tm.store.PutFrequencyRow(ctx, &FrequencyRow{
+			Pk:         GetFrequencyPK(teamID, userID),
+			TeamID:     teamID,
+			UserID:     userID,
+			WinTimesMs: wins,
+		})
+	}
+	if err != nil {
+		tm.logger.Warn(
+			"failed to record win for frequency cap",
+			zap.String("team_id", teamID),
+			zap.String("user_id", userID),
+			zap.Error(err),
+		)
+	}
+}
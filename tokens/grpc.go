@@ -0,0 +1,165 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	auctionv1 "github.com/christopherwong-hinge/auction/api/auction/v1"
+)
+
+type grpcServer struct {
+	auctionv1.UnimplementedAuctionServiceServer
+
+	tm *Manager
+}
+
+// NewGRPCServer exposes a Manager as the AuctionService of
+// api/auction/v1, to register with auctionv1.RegisterAuctionServiceServer.
+// It mirrors NewHTTPHandler, whose pending bids it shares: bids submitted
+// with SubmitBid wait per user until RunAuction is called for that user
+// without bids of its own. Errors carry the code GRPCCode maps them to.
+func NewGRPCServer(tm *Manager) auctionv1.AuctionServiceServer {
+	return &grpcServer{tm: tm}
+}
+
+func (s *grpcServer) RunAuction(ctx context.Context, req *auctionv1.RunAuctionRequest) (*auctionv1.RunAuctionResponse, error) {
+	cfg := AuctionConfig{IdempotencyKey: req.GetIdempotencyKey()}
+	var result *AuctionResult
+	var err error
+	if len(req.GetBids()) > 0 {
+		bids := make([]Bid, len(req.GetBids()))
+		for i, b := range req.GetBids() {
+			bids[i] = bidFromProto(b)
+			// the request's user is the default for its bids
+			if bids[i].UserID == "" {
+				bids[i].UserID = req.GetUserId()
+			}
+		}
+		result, err = s.tm.RunAuctionWithConfig(ctx, bids, cfg)
+	} else {
+		if req.GetUserId() == "" {
+			return nil, status.Error(codes.InvalidArgument, "user_id or bids are required")
+		}
+		// the bids are consumed unless a retry may get past the failure
+		result, err = s.tm.runPendingAuction(ctx, req.GetUserId(), cfg)
+	}
+	if errors.Is(err, errNoPendingBids) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, s.error(err)
+	}
+
+	resp := &auctionv1.RunAuctionResponse{
+		TeamId:            result.TeamID,
+		BidId:             result.BidID,
+		HoldId:            result.HoldID,
+		Score:             result.Score,
+		Cost:              result.Cost,
+		AuctionId:         result.AuctionID,
+		UserId:            result.UserID,
+		RemainingBalance:  result.RemainingBalance,
+		SettlementPending: result.SettlementPending,
+	}
+	for _, lb := range result.LosingBids {
+		resp.LosingBids = append(resp.LosingBids, &auctionv1.LosingBid{
+			TeamId:     lb.TeamID,
+			BidId:      lb.BidID,
+			Priority:   lb.Priority,
+			Score:      lb.Score,
+			Cost:       lb.Cost,
+			SkipReason: lb.SkipReason,
+		})
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) SubmitBid(ctx context.Context, req *auctionv1.SubmitBidRequest) (*auctionv1.SubmitBidResponse, error) {
+	bid := bidFromProto(req.GetBid())
+	if bid.TeamID == "" || bid.UserID == "" {
+		return nil, status.Error(codes.InvalidArgument, "team_id and user_id are required")
+	}
+	if !s.tm.HasPriority(bid.Priority) {
+		return nil, s.error(ErrUnknownPriority)
+	}
+
+	n, err := s.tm.submitPendingBid(bid)
+	if err != nil {
+		return nil, s.error(err)
+	}
+	return &auctionv1.SubmitBidResponse{Pending: int32(n)}, nil
+}
+
+func (s *grpcServer) GetBalance(ctx context.Context, req *auctionv1.GetBalanceRequest) (*auctionv1.GetBalanceResponse, error) {
+	balances, err := s.tm.GetTokenBalances(ctx, []string{req.GetTeamId()})
+	if err != nil {
+		return nil, s.error(err)
+	}
+
+	// the manager may have normalized the ID
+	for _, b := range balances {
+		return &auctionv1.GetBalanceResponse{
+			TeamId:          b.TeamID,
+			TokenBalance:    b.TokenBalance,
+			ReputationScore: b.ReputationScore,
+		}, nil
+	}
+	return nil, s.error(ErrTeamNotFound)
+}
+
+func (s *grpcServer) RefillTokens(ctx context.Context, req *auctionv1.RefillTokensRequest) (*auctionv1.RefillTokensResponse, error) {
+	if err := s.tm.RefillTokens(ctx, req.GetTeamIds()); err != nil {
+		return nil, s.error(err)
+	}
+	return &auctionv1.RefillTokensResponse{}, nil
+}
+
+func (s *grpcServer) error(err error) error {
+	code := GRPCCode(err)
+	if code == codes.Internal {
+		s.tm.logger.Error("request failed", zap.Error(err))
+	}
+	return status.Error(code, err.Error())
+}
+
+func bidFromProto(b *auctionv1.Bid) Bid {
+	return Bid{
+		TeamID:   b.GetTeamId(),
+		UserID:   b.GetUserId(),
+		Priority: b.GetPriority(),
+		Currency: b.GetCurrency(),
+	}
+}
+
+// GRPCCode maps the package's sentinel errors to gRPC status codes, in
+// line with HTTPStatus.
+func GRPCCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	}
+
+	switch HTTPStatus(err) {
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusPaymentRequired, http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusForbidden, http.StatusGone, http.StatusUnprocessableEntity:
+		return codes.FailedPrecondition
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,175 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	auctionv1 "github.com/christopherwong-hinge/auction/api/auction/v1"
+)
+
+func TestGRPCCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{ErrTeamNotFound, codes.NotFound},
+		{ErrInsufficientBalance, codes.ResourceExhausted},
+		{ErrQuotaExceeded, codes.ResourceExhausted},
+		{ErrTeamSuspended, codes.FailedPrecondition},
+		{ErrNoWinner, codes.FailedPrecondition},
+		{ErrAuctionConflict, codes.Aborted},
+		{ErrInvalidBid, codes.InvalidArgument},
+		{ErrStoreUnavailable, codes.Unavailable},
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+		{errors.New("boom"), codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			err := fmt.Errorf("%w: detail", tt.err)
+			if got := GRPCCode(err); got != tt.want {
+				t.Errorf("GRPCCode(%v) = %v, want %v", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGRPCServerRunAuction(t *testing.T) {
+	tests := []struct {
+		name string
+		// submitted are bids sent with SubmitBid first
+		submitted []*auctionv1.Bid
+		req       *auctionv1.RunAuctionRequest
+		wantCode  codes.Code
+		wantTeam  string
+	}{
+		{
+			name: "request's bids",
+			req: &auctionv1.RunAuctionRequest{Bids: []*auctionv1.Bid{
+				{TeamId: "a", UserId: "u", Priority: 5},
+				{TeamId: "b", UserId: "u", Priority: 1},
+			}},
+			wantTeam: "a",
+		},
+		{
+			name: "request's user for bids without one",
+			req: &auctionv1.RunAuctionRequest{UserId: "u", Bids: []*auctionv1.Bid{
+				{TeamId: "a", Priority: 1},
+				{TeamId: "b", Priority: 5},
+			}},
+			wantTeam: "b",
+		},
+		{
+			name: "submitted bids",
+			submitted: []*auctionv1.Bid{
+				{TeamId: "a", UserId: "u", Priority: 1},
+				{TeamId: "b", UserId: "u", Priority: 5},
+			},
+			req:      &auctionv1.RunAuctionRequest{UserId: "u"},
+			wantTeam: "b",
+		},
+		{
+			name:      "no submitted bids for the user",
+			submitted: []*auctionv1.Bid{{TeamId: "a", UserId: "v", Priority: 1}},
+			req:       &auctionv1.RunAuctionRequest{UserId: "u"},
+			wantCode:  codes.NotFound,
+		},
+		{name: "neither user nor bids", req: &auctionv1.RunAuctionRequest{}, wantCode: codes.InvalidArgument},
+		{
+			name:     "unknown team",
+			req:      &auctionv1.RunAuctionRequest{Bids: []*auctionv1.Bid{{TeamId: "missing", UserId: "u", Priority: 1}}},
+			wantCode: codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			srv := NewGRPCServer(newTestManager(t, []string{"a", "b"}))
+
+			for _, bid := range tt.submitted {
+				if _, err := srv.SubmitBid(ctx, &auctionv1.SubmitBidRequest{Bid: bid}); err != nil {
+					t.Fatalf("SubmitBid: %v", err)
+				}
+			}
+
+			resp, err := srv.RunAuction(ctx, tt.req)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("RunAuction = %v, want code %v", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+			if resp.GetTeamId() != tt.wantTeam {
+				t.Errorf("winner = %s, want %s", resp.GetTeamId(), tt.wantTeam)
+			}
+			if len(resp.GetLosingBids()) != 1 {
+				t.Errorf("got %d losing bids, want 1", len(resp.GetLosingBids()))
+			}
+		})
+	}
+}
+
+func TestGRPCServerSharesPendingBids(t *testing.T) {
+	ctx := context.Background()
+	tm := newTestManager(t, []string{"a"})
+	srv := NewGRPCServer(tm)
+
+	// a bid submitted over HTTP is auctioned over gRPC
+	if _, err := tm.submitPendingBid(Bid{TeamID: "a", UserID: "u", Priority: 1}); err != nil {
+		t.Fatalf("submitPendingBid: %v", err)
+	}
+	resp, err := srv.SubmitBid(ctx, &auctionv1.SubmitBidRequest{Bid: &auctionv1.Bid{TeamId: "a", UserId: "u", Priority: 5}})
+	if err != nil {
+		t.Fatalf("SubmitBid: %v", err)
+	}
+	if resp.GetPending() != 2 {
+		t.Errorf("pending = %d, want 2", resp.GetPending())
+	}
+
+	_, err = srv.SubmitBid(ctx, &auctionv1.SubmitBidRequest{Bid: &auctionv1.Bid{TeamId: "a", UserId: "u", Priority: 99}})
+	if code := status.Code(err); code != codes.InvalidArgument {
+		t.Errorf("SubmitBid at unknown priority = %v, want code %v", err, codes.InvalidArgument)
+	}
+
+	if _, err := srv.RunAuction(ctx, &auctionv1.RunAuctionRequest{UserId: "u"}); err != nil {
+		t.Fatalf("RunAuction: %v", err)
+	}
+	if bids := tm.pending.take("u", tm.clock.Now().UnixMilli()); len(bids) != 0 {
+		t.Errorf("%d bids still pending after the auction", len(bids))
+	}
+}
+
+func TestGRPCServerBalance(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryStore()
+	srv := NewGRPCServer(newTestManager(t, []string{"a"}, WithStore(mem)))
+	mem.tokens["a"].TokenBalance = 10
+
+	resp, err := srv.GetBalance(ctx, &auctionv1.GetBalanceRequest{TeamId: "a"})
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	if resp.GetTeamId() != "a" || resp.GetTokenBalance() != 10 {
+		t.Errorf("balance = %s %d, want a 10", resp.GetTeamId(), resp.GetTokenBalance())
+	}
+
+	if _, err := srv.RefillTokens(ctx, &auctionv1.RefillTokensRequest{TeamIds: []string{"a"}}); err != nil {
+		t.Fatalf("RefillTokens: %v", err)
+	}
+	resp, err = srv.GetBalance(ctx, &auctionv1.GetBalanceRequest{TeamId: "a"})
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	if resp.GetTokenBalance() != InitialTokenCount {
+		t.Errorf("balance after refill = %d, want %d", resp.GetTokenBalance(), InitialTokenCount)
+	}
+
+	_, err = srv.GetBalance(ctx, &auctionv1.GetBalanceRequest{TeamId: "missing"})
+	if code := status.Code(err); code != codes.NotFound {
+		t.Errorf("GetBalance of unknown team = %v, want code %v", err, codes.NotFound)
+	}
+}
@@ -0,0 +1,158 @@
+package tokens
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// Reasons an auction ended without a winner.
+const (
+	// NoWinnerEmptyBids means the auction was run with no bids.
+	NoWinnerEmptyBids = "empty_bids"
+	// NoWinnerAllBroke means no bidding team could afford its bid.
+	NoWinnerAllBroke = "all_broke"
+	// NoWinnerAllInCooldown means every bidding team was in win cooldown.
+	NoWinnerAllInCooldown = "all_in_cooldown"
+	// NoWinnerNoEligibleBids means every bid was skipped, for mixed reasons.
+	NoWinnerNoEligibleBids = "no_eligible_bids"
+	// NoWinnerAllVetoed means every eligible bid was vetoed by the
+	// WinnerVeto hook.
+	NoWinnerAllVetoed = "all_vetoed"
+	// NoWinnerChargeFailed means eligible bids existed but charging each
+	// of them failed, e.g. because their balances were spent concurrently.
+	NoWinnerChargeFailed = "charge_failed"
+	// NoWinnerAllFrequencyCapped means every bidding team was at its
+	// frequency cap for the user.
+	NoWinnerAllFrequencyCapped = "all_frequency_capped"
+	// NoWinnerReserveNotMet means no bid met the auction's reserve.
+	NoWinnerReserveNotMet = "reserve_not_met"
+)
+
+// AuctionRow is the record of an auction in the auctions table, keyed by
+// the user the auction was for.
+type AuctionRow struct {
+	Pk        string   `dynamodbav:"pk" json:"pk"`
+	Sk        string   `dynamodbav:"sk" json:"sk"`
+	AuctionID string   `dynamodbav:"auction_id" json:"auction_id"`
+	UserID    string   `dynamodbav:"user_id" json:"user_id"`
+	TeamIDs   []string `dynamodbav:"team_ids" json:"team_ids"`
+	// Results are the winners', best first; NoWinnerReason is set instead
+	// for an auction without a winner.
+	Results        []AuctionResult `dynamodbav:"results,omitempty" json:"results,omitempty"`
+	NoWinnerReason string          `dynamodbav:"no_winner_reason,omitempty" json:"no_winner_reason,omitempty"`
+	CreatedAtMs    int64           `dynamodbav:"created_at_ms" json:"created_at_ms"`
+}
+
+// noWinnerReason explains why an auction over scored bids, of which
+// candidates were eligible to win, had no winner.
+func noWinnerReason(scored []*candidate, candidates []*candidate) string {
+	if len(scored) == 0 {
+		return NoWinnerEmptyBids
+	}
+	if len(candidates) > 0 {
+		for _, c := range candidates {
+			if c.skipReason != SkipReasonVetoed {
+				return NoWinnerChargeFailed
+			}
+		}
+		return NoWinnerAllVetoed
+	}
+
+	reason := scored[0].skipReason
+	for _, c := range scored[1:] {
+		if c.skipReason != reason {
+			return NoWinnerNoEligibleBids
+		}
+	}
+
+	switch reason {
+	case SkipReasonInsufficientBalance:
+		return NoWinnerAllBroke
+	case SkipReasonWinCooldown:
+		return NoWinnerAllInCooldown
+	case SkipReasonFrequencyCap:
+		return NoWinnerAllFrequencyCapped
+	case SkipReasonBelowReserve:
+		return NoWinnerReserveNotMet
+	default:
+		return NoWinnerNoEligibleBids
+	}
+}
+
+// recordAuction writes an auction to the auctions table, with its results
+// or, if it had none, the reason it had no winner. Failures are logged
+// rather than returned so they don't mask the auction's outcome.
+func (tm *Manager) recordAuction(
+	ctx context.Context,
+	auctionID string,
+	bids []Bid,
+	scored []*candidate,
+	candidates []*candidate,
+	results []*AuctionResult,
+) {
+	// empty auctions carry no user and are recorded under the empty user ID
+	var userID string
+	teamIDs := make([]string, 0, len(bids))
+	for _, bid := range bids {
+		userID = bid.UserID
+		teamIDs = append(teamIDs, bid.TeamID)
+	}
+
+	ar := AuctionRow{
+		Pk:          GetAuctionPK(userID),
+		Sk:          auctionID,
+		AuctionID:   auctionID,
+		UserID:      userID,
+		TeamIDs:     teamIDs,
+		CreatedAtMs: tm.clock.Now().UnixMilli(),
+	}
+	for _, result := range results {
+		ar.Results = append(ar.Results, *result)
+	}
+	if len(results) == 0 {
+		ar.NoWinnerReason = noWinnerReason(scored, candidates)
+	}
+
+	err := tm.store.PutAuction(ctx, &ar)
+	if err != nil {
+		tm.logger.Warn(
+			"failed to record auction",
+			zap.String("auction_id", auctionID),
+			zap.String("user_id", userID),
+			zap.Error(err),
+		)
+	}
+}
+
+// countAuctionEntries counts an auction towards the win rate of each team
+// that bid in it, if ties are broken by win rate. Failures are logged like
+// recordAuction's.
+func (tm *Manager) countAuctionEntries(ctx context.Context, bids []Bid) {
+	if tm.tieBreak != TieBreakWinRate {
+		return
+	}
+
+	counted := make(map[string]bool, len(bids))
+	for _, bid := range bids {
+		if counted[bid.TeamID] {
+			continue
+		}
+		counted[bid.TeamID] = true
+
+		err := tm.store.CountAuctionEntry(ctx, bid.TeamID)
+		if err != nil {
+			tm.logger.Warn("failed to count auction entry", zap.String("team_id", bid.TeamID), zap.Error(err))
+		}
+	}
+}
+
+// GetAuctionHistory returns the recorded auctions for a user, newest first.
+func (tm *Manager) GetAuctionHistory(ctx context.Context, userID string) ([]AuctionRow, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	userID = tm.normalizeID(userID)
+
+	return tm.store.QueryAuctions(ctx, userID)
+}
@@ -0,0 +1,63 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAuctionHistoryNoWinner(t *testing.T) {
+	vetoAll := func(context.Context, string) (bool, error) { return true, nil }
+	tests := []struct {
+		name string
+		opts []Option
+		// broke teams have no tokens
+		broke      []string
+		wantWinner string
+		wantReason string
+	}{
+		{name: "won", wantWinner: "a"},
+		{name: "every team broke", broke: []string{"a", "b"}, wantReason: NoWinnerAllBroke},
+		{name: "every winner vetoed", opts: []Option{WithWinnerVeto(vetoAll)}, wantReason: NoWinnerAllVetoed},
+		{name: "one team broke, the other vetoed", broke: []string{"a"}, opts: []Option{WithWinnerVeto(vetoAll)}, wantReason: NoWinnerAllVetoed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := NewMemoryStore()
+			tm := newTestManager(t, []string{"a", "b"}, append([]Option{WithStore(mem)}, tt.opts...)...)
+			for _, team := range tt.broke {
+				mem.tokens[team].TokenBalance = 0
+			}
+
+			_, err := tm.RunAuction(ctx, []Bid{
+				{TeamID: "a", UserID: "u", Priority: 5},
+				{TeamID: "b", UserID: "u", Priority: 1},
+			})
+			if tt.wantWinner == "" && !errors.Is(err, ErrNoWinner) {
+				t.Fatalf("RunAuction = %v, want %v", err, ErrNoWinner)
+			}
+			if tt.wantWinner != "" && err != nil {
+				t.Fatalf("RunAuction: %v", err)
+			}
+
+			history, err := tm.GetAuctionHistory(ctx, "u")
+			if err != nil {
+				t.Fatalf("GetAuctionHistory: %v", err)
+			}
+			if len(history) != 1 {
+				t.Fatalf("got %d recorded auctions, want 1", len(history))
+			}
+			ar := history[0]
+			if ar.NoWinnerReason != tt.wantReason {
+				t.Errorf("no winner reason = %q, want %q", ar.NoWinnerReason, tt.wantReason)
+			}
+			if tt.wantWinner != "" && (len(ar.Results) != 1 || ar.Results[0].TeamID != tt.wantWinner) {
+				t.Errorf("results %+v, want a win by %s", ar.Results, tt.wantWinner)
+			}
+			if len(ar.TeamIDs) != 2 {
+				t.Errorf("team IDs %v, want both bidders", ar.TeamIDs)
+			}
+		})
+	}
+}
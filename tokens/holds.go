@@ -0,0 +1,248 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultHoldTTL is how long an auction hold lasts when
+// AuctionConfig.HoldTTL is unset.
+const DefaultHoldTTL = 5 * time.Minute
+
+// DefaultReservationTTL is how long a bid reservation lasts. Reservations
+// are settled when their auction ends; the TTL only matters for auctions
+// that never did, e.g. because the process died, whose reservations
+// ReleaseExpiredHolds returns to their teams once expired.
+const DefaultReservationTTL = time.Minute
+
+// HoldRow is a reservation of a team's tokens for an auction it won but
+// whose delivery is not yet confirmed, or, with Reservation set, for a bid
+// in an auction still running. Holds live in the tokens table; the held
+// amount is moved out of the team's token_balance into held_balance until
+// the hold is confirmed, cancelled or expires.
+type HoldRow struct {
+	Pk          string `dynamodbav:"pk" json:"pk"`
+	HoldID      string `dynamodbav:"hold_id" json:"hold_id"`
+	TeamID      string `dynamodbav:"team_id" json:"team_id"`
+	UserID      string `dynamodbav:"user_id" json:"user_id"`
+	BidID       string `dynamodbav:"bid_id" json:"bid_id"`
+	Priority    int64  `dynamodbav:"priority" json:"priority"`
+	Amount      int64  `dynamodbav:"amount" json:"amount"`
+	ExpiresAtMs int64  `dynamodbav:"expires_at_ms" json:"expires_at_ms"`
+	CreatedAtMs int64  `dynamodbav:"created_at_ms" json:"created_at_ms"`
+	// Reservation marks a bid reservation; see AuctionConfig.ReserveBids.
+	Reservation bool `dynamodbav:"reservation" json:"reservation"`
+}
+
+// placeHold reserves the winning candidate's cost instead of spending it,
+// recording its bid as won and releasing its bid reservation, if any, in the
+// same transaction, made under lock if it is non-nil.
+func (tm *Manager) placeHold(ctx context.Context, winner *candidate, ttl time.Duration, lock *LockRef) (hold *HoldRow, err error) {
+	ctx, end := tm.startSpan(ctx, SpanPlaceHold, bidAttrs(&winner.bid)...)
+	defer func() { end(err) }()
+
+	if ttl <= 0 {
+		ttl = DefaultHoldTTL
+	}
+
+	now := tm.clock.Now()
+	holdID, err := tm.newID("hold_", now)
+	if err != nil {
+		return nil, err
+	}
+
+	hold = &HoldRow{
+		Pk:          GetHoldPK(holdID),
+		HoldID:      holdID,
+		TeamID:      winner.bid.TeamID,
+		UserID:      winner.bid.UserID,
+		Priority:    winner.bid.Priority,
+		Amount:      winner.price,
+		ExpiresAtMs: now.Add(ttl).UnixMilli(),
+		CreatedAtMs: now.UnixMilli(),
+	}
+	if winner.row != nil {
+		hold.BidID = winner.row.BidID
+	}
+
+	quota, err := tm.countQuota(ctx, hold.TeamID, hold.Priority, hold.Amount, now)
+	if err != nil {
+		return nil, err
+	}
+	hold.Amount = quota.cost
+
+	refund, err := tm.paceSpend(ctx, hold.TeamID, hold.Amount, now)
+	if err != nil {
+		quota.refund()
+		return nil, err
+	}
+
+	err = tm.store.PlaceHold(ctx, hold, tm.cooldownStart(hold.CreatedAtMs), tm.wonBidRow(winner.row), winner.reservation, lock)
+	if err != nil {
+		quota.refund()
+		refund()
+		return nil, tm.chargeFailure(hold.TeamID, "", hold.Amount, err, hold.CreatedAtMs)
+	}
+
+	err = tm.takeReputation(ctx, &winner.bid, quota.penalty, quota.penaltyKey)
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// reserveBid holds a scored bid's cost until its auction settles. It fails
+// with ErrInsufficientBalance if the team's balance no longer covers it.
+func (tm *Manager) reserveBid(ctx context.Context, c *candidate) error {
+	now := tm.clock.Now()
+	holdID, err := tm.newID("hold_", now)
+	if err != nil {
+		return err
+	}
+
+	hold := &HoldRow{
+		Pk:          GetHoldPK(holdID),
+		HoldID:      holdID,
+		TeamID:      c.bid.TeamID,
+		UserID:      c.bid.UserID,
+		Priority:    c.bid.Priority,
+		Amount:      c.cost,
+		ExpiresAtMs: now.Add(DefaultReservationTTL).UnixMilli(),
+		CreatedAtMs: now.UnixMilli(),
+		Reservation: true,
+	}
+	if c.row != nil {
+		hold.BidID = c.row.BidID
+	}
+
+	err = tm.store.ReserveTokens(ctx, hold)
+	if err != nil {
+		return tm.chargeFailure(hold.TeamID, "", hold.Amount, err, hold.CreatedAtMs)
+	}
+
+	c.reservation = hold
+	return nil
+}
+
+// releaseReservations returns the tokens reserved for an auction's bids
+// that weren't charged. Like abortBids it runs after the auction's context
+// may have been cancelled. A reservation that can't be released is left to
+// expire.
+func (tm *Manager) releaseReservations(ctx context.Context, scored []*candidate) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortBidsTimeout)
+	defer cancel()
+
+	for _, c := range scored {
+		if c.reservation == nil {
+			continue
+		}
+
+		err := tm.releaseHold(ctx, c.reservation)
+		if err != nil {
+			tm.logger.Warn("failed to release bid reservation", zap.String("hold_id", c.reservation.HoldID), zap.Error(err))
+		}
+		c.reservation = nil
+	}
+}
+
+// ConfirmAuctionDelivery converts the hold from an auction run with
+// AuctionConfig.UseHolds into a spend, once the notification was delivered.
+// An expired hold is released instead and ErrHoldExpired is returned.
+func (tm *Manager) ConfirmAuctionDelivery(ctx context.Context, holdID string) error {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	hold, err := tm.getDeliveryHold(ctx, holdID)
+	if err != nil {
+		return err
+	}
+
+	now := tm.clock.Now().UnixMilli()
+	if hold.ExpiresAtMs <= now {
+		if err := tm.releaseHold(ctx, hold); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s", ErrHoldExpired, holdID)
+	}
+
+	row, err := tm.store.ConfirmHold(ctx, hold, now)
+	if err != nil {
+		if errors.Is(err, ErrConditionFailed) {
+			return fmt.Errorf("%w: %s", ErrHoldNotFound, holdID)
+		}
+		return err
+	}
+
+	// the spend is settled; apply the same reputation rules as SpendTokens
+	bid := &Bid{TeamID: hold.TeamID, UserID: hold.UserID, Priority: hold.Priority}
+	return tm.applyPriorityUsage(ctx, bid, row)
+}
+
+// CancelAuctionDelivery releases the hold from an auction run with
+// AuctionConfig.UseHolds, returning the held tokens to the team.
+func (tm *Manager) CancelAuctionDelivery(ctx context.Context, holdID string) error {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	hold, err := tm.getDeliveryHold(ctx, holdID)
+	if err != nil {
+		return err
+	}
+	return tm.releaseHold(ctx, hold)
+}
+
+// getDeliveryHold reads the hold of an auction win. Bid reservations are
+// settled by their auction, so they are reported as not found.
+func (tm *Manager) getDeliveryHold(ctx context.Context, holdID string) (*HoldRow, error) {
+	hold, err := tm.store.GetHold(ctx, holdID)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Reservation {
+		return nil, fmt.Errorf("%w: %s", ErrHoldNotFound, holdID)
+	}
+	return hold, nil
+}
+
+// releaseHold deletes a hold and returns its amount to the team's balance.
+func (tm *Manager) releaseHold(ctx context.Context, hold *HoldRow) error {
+	err := tm.store.ReleaseHold(ctx, hold, tm.clock.Now().UnixMilli())
+	if errors.Is(err, ErrConditionFailed) {
+		return fmt.Errorf("%w: %s", ErrHoldNotFound, hold.HoldID)
+	}
+	return err
+}
+
+// ReleaseExpiredHolds returns the tokens of every expired hold, including
+// bid reservations left by auctions that never settled, to its team and
+// reports how many holds were released. Expired holds are also released
+// lazily by ConfirmAuctionDelivery; callers should run this periodically so
+// holds that are never confirmed or cancelled don't keep tokens locked.
+func (tm *Manager) ReleaseExpiredHolds(ctx context.Context) (int, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	holds, err := tm.store.ExpiredHolds(ctx, tm.clock.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	var released int
+	for i := range holds {
+		err := tm.releaseHold(ctx, &holds[i])
+		if errors.Is(err, ErrHoldNotFound) {
+			// confirmed or cancelled since the scan
+			continue
+		}
+		if err != nil {
+			return released, err
+		}
+		released++
+	}
+
+	return released, nil
+}
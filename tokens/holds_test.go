@@ -0,0 +1,75 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAuctionDeliveryHold(t *testing.T) {
+	const cost = 5 // priority 5 at max reputation
+	tests := []struct {
+		name    string
+		settle  func(tm *Manager, ctx context.Context, holdID string) error
+		expire  bool
+		wantErr error
+		// wantBalance is the team's balance once the hold is settled
+		wantBalance int64
+	}{
+		{name: "confirmed", settle: (*Manager).ConfirmAuctionDelivery, wantBalance: InitialTokenCount - cost},
+		{name: "cancelled", settle: (*Manager).CancelAuctionDelivery, wantBalance: InitialTokenCount},
+		{
+			name: "confirmed after expiry", settle: (*Manager).ConfirmAuctionDelivery, expire: true,
+			wantErr: ErrHoldExpired, wantBalance: InitialTokenCount,
+		},
+		{
+			name: "unknown hold",
+			settle: func(tm *Manager, ctx context.Context, _ string) error {
+				return tm.ConfirmAuctionDelivery(ctx, "hold_missing")
+			},
+			wantErr: ErrHoldNotFound, wantBalance: InitialTokenCount - cost,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := newTestClock()
+			tm := newTestManager(t, []string{"a"}, WithClock(clock))
+
+			result, err := tm.RunAuctionWithConfig(ctx, []Bid{{TeamID: "a", UserID: "u", Priority: 5}},
+				AuctionConfig{UseHolds: true})
+			if err != nil {
+				t.Fatalf("RunAuctionWithConfig: %v", err)
+			}
+			if result.HoldID == "" {
+				t.Fatal("auction with holds returned no hold ID")
+			}
+			// the held cost is out of the spendable balance until settled
+			if row := tokenRow(t, tm, "a"); row.TokenBalance != InitialTokenCount-cost || row.HeldBalance != cost {
+				t.Fatalf("balance %d held %d, want %d held %d",
+					row.TokenBalance, row.HeldBalance, InitialTokenCount-cost, cost)
+			}
+
+			if tt.expire {
+				clock.Advance(DefaultHoldTTL + 1)
+			}
+			if err := tt.settle(tm, ctx, result.HoldID); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("settling = %v, want %v", err, tt.wantErr)
+			}
+
+			row := tokenRow(t, tm, "a")
+			if row.TokenBalance != tt.wantBalance {
+				t.Errorf("balance = %d, want %d", row.TokenBalance, tt.wantBalance)
+			}
+			if tt.wantErr == nil && row.HeldBalance != 0 {
+				t.Errorf("held balance = %d after settling, want 0", row.HeldBalance)
+			}
+			if tt.wantErr == nil {
+				// a hold settles once
+				if err := tm.CancelAuctionDelivery(ctx, result.HoldID); !errors.Is(err, ErrHoldNotFound) {
+					t.Errorf("settling again = %v, want %v", err, ErrHoldNotFound)
+				}
+			}
+		})
+	}
+}
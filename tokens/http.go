@@ -0,0 +1,987 @@
+package tokens
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// IdempotencyKeyHeader carries the idempotency key of an auction request.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// bidRowResponse is a BidRow with its team, which its keys only encode.
+type bidRowResponse struct {
+	BidRow
+	TeamID string `json:"team_id"`
+}
+
+func newBidRowResponse(row BidRow) bidRowResponse {
+	return bidRowResponse{BidRow: row, TeamID: row.TeamID()}
+}
+
+type bidPageResponse struct {
+	Bids       []bidRowResponse `json:"bids"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+type submitBidResponse struct {
+	UserID string `json:"user_id"`
+	// Pending is the number of bids waiting on the user's next auction,
+	// including this one.
+	Pending int `json:"pending"`
+}
+
+type openWindowRequest struct {
+	UserID string `json:"user_id"`
+	// Deadline is an RFC 3339 time.
+	Deadline time.Time `json:"deadline"`
+}
+
+type sealedBidRequest struct {
+	TeamID   string `json:"team_id"`
+	Priority int64  `json:"priority"`
+}
+
+type openDutchAuctionRequest struct {
+	UserID   string        `json:"user_id"`
+	Priority int64         `json:"priority"`
+	Schedule PriceSchedule `json:"schedule"`
+	// Deadline is an RFC 3339 time.
+	Deadline time.Time `json:"deadline"`
+}
+
+// dutchAuctionResponse is a Dutch auction with the price a team accepting it
+// now would pay, which is only set while it's open.
+type dutchAuctionResponse struct {
+	DutchAuction
+	CurrentPrice int64 `json:"current_price,omitempty"`
+}
+
+type acceptDutchAuctionRequest struct {
+	TeamID string `json:"team_id"`
+}
+
+type createTeamRequest struct {
+	TeamID string `json:"team_id"`
+	Name   string `json:"name"`
+}
+
+// teamStatusRequest is the body of a suspension or archival.
+type teamStatusRequest struct {
+	Reason string `json:"reason"`
+}
+
+type webhookRequest struct {
+	URL string `json:"url"`
+}
+
+type transferRequest struct {
+	FromTeamID string `json:"from_team_id"`
+	ToTeamID   string `json:"to_team_id"`
+	Amount     int64  `json:"amount"`
+}
+
+// adjustmentRequest is the body of an adjustment. Its actor is the
+// authenticated operator making it; see WithAdminAuth.
+type adjustmentRequest struct {
+	// Delta is the tokens to grant, or deduct if negative.
+	Delta  int64  `json:"delta"`
+	Reason string `json:"reason"`
+}
+
+// storeStatusResponse is where the store's circuit breaker stands and the
+// degraded auctions waiting to be charged.
+type storeStatusResponse struct {
+	State       string               `json:"state"`
+	Settlements []DegradedSettlement `json:"settlements"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type httpHandler struct {
+	tm        *Manager
+	adminAuth AdminAuthenticator
+}
+
+// AdminAuthenticator identifies the operator who made a request to one of
+// NewHTTPHandler's admin routes, e.g. from a bearer token, returning false
+// if the request isn't authenticated as one. The operator is recorded as the
+// actor of the balance adjustments they make.
+type AdminAuthenticator func(r *http.Request) (actor string, ok bool)
+
+// HTTPOption configures NewHTTPHandler.
+type HTTPOption func(*httpHandler)
+
+// WithAdminAuth serves NewHTTPHandler's admin routes to the requests auth
+// authenticates. Without it they're refused.
+func WithAdminAuth(auth AdminAuthenticator) HTTPOption {
+	return func(h *httpHandler) {
+		h.adminAuth = auth
+	}
+}
+
+// adminActorKey is the context key of the operator an admin request was
+// authenticated as.
+type adminActorKey struct{}
+
+// NewHTTPHandler exposes a Manager as a JSON API. Bids submitted with
+// POST /bids wait per user, in memory, until an auction for that user is
+// run; the Manager's gRPC server shares them. Both auction endpoints take an Idempotency-Key header to make
+// retries safe, and min_score and min_priority query parameters to set a
+// reserve. Routes marked admin change teams' standing or balances outside
+// auctions; they answer 401 unless authenticated by WithAdminAuth:
+//
+//	POST /bids                   body: Bid, response: submitBidResponse
+//	POST /users/{id}/auction     runs the user's pending bids, response: AuctionResult
+//	GET  /users/{id}/bids        every team's bids for the user, response: []bidRowResponse
+//	POST /auctions               body: []Bid, response: AuctionResult
+//	GET  /auctions/{id}/audit    response: AuctionAudit
+//	POST /teams                  admin, body: createTeamRequest, response: Team
+//	GET  /teams                  ?status=active|suspended|archived, response: []Team
+//	GET  /teams/{id}             response: Team
+//	POST /teams/{id}/suspend     admin, body: teamStatusRequest, response: Team
+//	POST /teams/{id}/reinstate   admin, response: Team
+//	POST /teams/{id}/archive     admin, body: teamStatusRequest, response: Team
+//	DELETE /teams/{id}           admin, deletes the team for good
+//	GET  /teams/{id}/balance     response: TeamBalance
+//	POST /teams/{id}/adjustments admin, body: adjustmentRequest, response: AdjustmentRow
+//	GET  /teams/{id}/ledger      ?from_ms, to_ms, response: []LedgerEntry
+//	GET  /teams/{id}/ledger/reconcile response: LedgerReport
+//	GET  /teams/{id}/stats       response: TeamStats
+//	GET  /teams/{id}/quota       response: uses today per priority with a quota
+//	GET  /leaderboard            ?limit=n for the top n, response: []TeamStats
+//	POST /stats                  admin, recomputes every team's stats, response: []TeamStats
+//	PUT  /teams/{id}/autobid     body: AutoBidPolicy, response: AutoBidPolicy
+//	GET  /teams/{id}/autobid     response: AutoBidPolicy
+//	DELETE /teams/{id}/autobid   stops auto-bidding for the team
+//	PUT  /teams/{id}/webhook     body: webhookRequest, response: Webhook with its secret
+//	GET  /teams/{id}/webhook     response: Webhook
+//	DELETE /teams/{id}/webhook   stops notifying the team
+//	GET  /teams/{id}/webhook/dead-letters response: []WebhookDeadLetter
+//	GET  /balances               ?teams=a,b,..., response: []TeamBalance
+//	GET  /teams/{id}/bids        ?limit=n for the newest n, response: []bidRowResponse
+//	GET  /teams/{id}/bids/page   ?cursor, page_size, from_ms, to_ms, priority, user_id, response: bidPageResponse
+//	POST /transfers              admin, body: transferRequest, response: TransferResult
+//	POST /windows                body: openWindowRequest, response: AuctionWindow
+//	GET  /windows/{id}           response: AuctionWindow
+//	POST /windows/{id}/bids      body: sealedBidRequest, response: bidRowResponse
+//	POST /windows/{id}/settle    settles a window past its deadline, response: AuctionResult
+//	POST /dutch-auctions         body: openDutchAuctionRequest, response: DutchAuction
+//	GET  /dutch-auctions/{id}    response: dutchAuctionResponse
+//	POST /dutch-auctions/{id}/accept body: acceptDutchAuctionRequest, response: DutchAuctionResult
+//	GET  /store                  response: storeStatusResponse
+//
+// Errors are answered with the status HTTPStatus maps them to; those
+// mapped to 500 are logged.
+func NewHTTPHandler(tm *Manager, opts ...HTTPOption) http.Handler {
+	h := &httpHandler{tm: tm}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /bids", h.submitBid)
+	mux.HandleFunc("POST /users/{id}/auction", h.runPendingAuction)
+	mux.HandleFunc("GET /users/{id}/bids", h.getUserBids)
+	mux.HandleFunc("POST /auctions", h.runAuction)
+	mux.HandleFunc("GET /auctions/{id}/audit", h.getAuctionAudit)
+	mux.HandleFunc("POST /teams", h.admin(h.createTeam))
+	mux.HandleFunc("GET /teams", h.listTeams)
+	mux.HandleFunc("GET /teams/{id}", h.getTeam)
+	mux.HandleFunc("POST /teams/{id}/suspend", h.admin(h.suspendTeam))
+	mux.HandleFunc("POST /teams/{id}/reinstate", h.admin(h.reinstateTeam))
+	mux.HandleFunc("POST /teams/{id}/archive", h.admin(h.archiveTeam))
+	mux.HandleFunc("DELETE /teams/{id}", h.admin(h.deleteTeam))
+	mux.HandleFunc("GET /teams/{id}/balance", h.getBalance)
+	mux.HandleFunc("POST /teams/{id}/adjustments", h.admin(h.adjustBalance))
+	mux.HandleFunc("GET /teams/{id}/ledger", h.getLedger)
+	mux.HandleFunc("GET /teams/{id}/ledger/reconcile", h.reconcileLedger)
+	mux.HandleFunc("GET /teams/{id}/stats", h.getTeamStats)
+	mux.HandleFunc("GET /teams/{id}/quota", h.getQuotaUsage)
+	mux.HandleFunc("GET /leaderboard", h.getLeaderboard)
+	mux.HandleFunc("POST /stats", h.admin(h.computeTeamStats))
+	mux.HandleFunc("PUT /teams/{id}/autobid", h.setAutoBidPolicy)
+	mux.HandleFunc("GET /teams/{id}/autobid", h.getAutoBidPolicy)
+	mux.HandleFunc("DELETE /teams/{id}/autobid", h.deleteAutoBidPolicy)
+	mux.HandleFunc("PUT /teams/{id}/webhook", h.setWebhook)
+	mux.HandleFunc("GET /teams/{id}/webhook", h.getWebhook)
+	mux.HandleFunc("DELETE /teams/{id}/webhook", h.deleteWebhook)
+	mux.HandleFunc("GET /teams/{id}/webhook/dead-letters", h.getWebhookDeadLetters)
+	mux.HandleFunc("GET /balances", h.getBalances)
+	mux.HandleFunc("GET /teams/{id}/bids", h.getBids)
+	mux.HandleFunc("GET /teams/{id}/bids/page", h.getBidsPage)
+	mux.HandleFunc("POST /transfers", h.admin(h.transfer))
+	mux.HandleFunc("POST /windows", h.openWindow)
+	mux.HandleFunc("GET /windows/{id}", h.getWindow)
+	mux.HandleFunc("POST /windows/{id}/bids", h.submitSealedBid)
+	mux.HandleFunc("POST /windows/{id}/settle", h.settleWindow)
+	mux.HandleFunc("POST /dutch-auctions", h.openDutchAuction)
+	mux.HandleFunc("GET /dutch-auctions/{id}", h.getDutchAuction)
+	mux.HandleFunc("POST /dutch-auctions/{id}/accept", h.acceptDutchAuction)
+	mux.HandleFunc("GET /store", h.getStoreStatus)
+	return mux
+}
+
+// admin serves next only to requests authenticated by the handler's
+// AdminAuthenticator, with the operator in the request's context.
+func (h *httpHandler) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.adminAuth == nil {
+			h.writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "admin routes are disabled"})
+			return
+		}
+		actor, ok := h.adminAuth(r)
+		if !ok {
+			h.writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "admin authentication required"})
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), adminActorKey{}, actor)))
+	}
+}
+
+func (h *httpHandler) submitBid(w http.ResponseWriter, r *http.Request) {
+	var bid Bid
+	if err := json.NewDecoder(r.Body).Decode(&bid); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if bid.TeamID == "" || bid.UserID == "" {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: "team_id and user_id are required"})
+		return
+	}
+	if !h.tm.HasPriority(bid.Priority) {
+		h.writeError(w, ErrUnknownPriority)
+		return
+	}
+
+	n, err := h.tm.submitPendingBid(bid)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusAccepted, submitBidResponse{UserID: bid.UserID, Pending: n})
+}
+
+// runPendingAuction takes the user's pending bids and auctions them. The bids
+// are consumed whether or not the auction finds a winner, unless it fails
+// for a reason a retry may get past; see Manager.runPendingAuction.
+func (h *httpHandler) runPendingAuction(w http.ResponseWriter, r *http.Request) {
+	cfg, err := requestAuctionConfig(r)
+	if err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	result, err := h.tm.runPendingAuction(r.Context(), r.PathValue("id"), cfg)
+	if errors.Is(err, errNoPendingBids) {
+		h.writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, result)
+}
+
+func (h *httpHandler) runAuction(w http.ResponseWriter, r *http.Request) {
+	cfg, err := requestAuctionConfig(r)
+	if err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	var bids []Bid
+	if err := json.NewDecoder(r.Body).Decode(&bids); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	h.auction(w, r, bids, cfg)
+}
+
+// auctionConfig reads an auction request's idempotency key and reserve.
+func requestAuctionConfig(r *http.Request) (AuctionConfig, error) {
+	cfg := AuctionConfig{
+		IdempotencyKey: r.Header.Get(IdempotencyKeyHeader),
+	}
+
+	query := r.URL.Query()
+	if v := query.Get("min_score"); v != "" {
+		score, err := strconv.ParseFloat(v, 64)
+		if err != nil || score < 0 {
+			return cfg, errors.New("min_score must be a non-negative number")
+		}
+		cfg.MinScore = score
+	}
+	if v := query.Get("min_priority"); v != "" {
+		priority, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || priority <= 0 {
+			return cfg, errors.New("min_priority must be a positive integer")
+		}
+		cfg.MinPriority = priority
+	}
+	return cfg, nil
+}
+
+func (h *httpHandler) auction(w http.ResponseWriter, r *http.Request, bids []Bid, cfg AuctionConfig) {
+	result, err := h.tm.RunAuctionWithConfig(r.Context(), bids, cfg)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, result)
+}
+
+func (h *httpHandler) getBalance(w http.ResponseWriter, r *http.Request) {
+	teamID := r.PathValue("id")
+
+	balances, err := h.tm.GetTokenBalances(r.Context(), []string{teamID})
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	// the manager may have normalized the ID
+	for _, b := range balances {
+		h.writeJSON(w, http.StatusOK, b)
+	}
+}
+
+func (h *httpHandler) getBalances(w http.ResponseWriter, r *http.Request) {
+	teams := r.URL.Query().Get("teams")
+	if teams == "" {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: "teams is required"})
+		return
+	}
+
+	balances, err := h.tm.GetTokenBalances(r.Context(), strings.Split(teams, ","))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	resp := make([]TeamBalance, 0, len(balances))
+	for _, b := range balances {
+		resp = append(resp, b)
+	}
+	slices.SortFunc(resp, func(a, b TeamBalance) int { return strings.Compare(a.TeamID, b.TeamID) })
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *httpHandler) getBids(w http.ResponseWriter, r *http.Request) {
+	teamID := r.PathValue("id")
+
+	var (
+		rows []BidRow
+		err  error
+	)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, perr := strconv.Atoi(v)
+		if perr != nil || limit <= 0 {
+			h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: "limit must be a positive integer"})
+			return
+		}
+		rows, err = h.tm.GetRecentBids(r.Context(), teamID, limit)
+	} else {
+		rows, err = h.tm.GetBids(r.Context(), teamID)
+	}
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	resp := make([]bidRowResponse, len(rows))
+	for i, row := range rows {
+		resp[i] = newBidRowResponse(row)
+	}
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *httpHandler) getUserBids(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.tm.GetBidsForUser(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	resp := make([]bidRowResponse, len(rows))
+	for i, row := range rows {
+		resp[i] = newBidRowResponse(row)
+	}
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *httpHandler) getBidsPage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := BidPageQuery{
+		BidFilter: BidFilter{UserID: query.Get("user_id")},
+		Cursor:    query.Get("cursor"),
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  *int64
+	}{
+		{"from_ms", &q.FromMs},
+		{"to_ms", &q.ToMs},
+		{"priority", &q.Priority},
+	} {
+		v := query.Get(param.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: param.name + " must be a positive integer"})
+			return
+		}
+		*param.dst = n
+	}
+	if v := query.Get("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: "page_size must be a positive integer"})
+			return
+		}
+		q.PageSize = n
+	}
+
+	page, err := h.tm.GetBidsPage(r.Context(), r.PathValue("id"), q)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	resp := bidPageResponse{
+		Bids:       make([]bidRowResponse, len(page.Bids)),
+		NextCursor: page.NextCursor,
+	}
+	for i, row := range page.Bids {
+		resp.Bids[i] = newBidRowResponse(row)
+	}
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *httpHandler) adjustBalance(w http.ResponseWriter, r *http.Request) {
+	var req adjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	actor, _ := r.Context().Value(adminActorKey{}).(string)
+	adjustment, err := h.tm.AdjustBalance(r.Context(), r.PathValue("id"), req.Delta, req.Reason, actor)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, adjustment)
+}
+
+func (h *httpHandler) getLedger(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	fromMs, toMs := int64(0), int64(math.MaxInt64)
+	for _, param := range []struct {
+		name string
+		dst  *int64
+	}{
+		{"from_ms", &fromMs},
+		{"to_ms", &toMs},
+	} {
+		v := query.Get(param.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: param.name + " must be a positive integer"})
+			return
+		}
+		*param.dst = n
+	}
+
+	entries, err := h.tm.GetLedger(r.Context(), r.PathValue("id"), fromMs, toMs)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if entries == nil {
+		entries = []LedgerEntry{}
+	}
+
+	h.writeJSON(w, http.StatusOK, entries)
+}
+
+func (h *httpHandler) reconcileLedger(w http.ResponseWriter, r *http.Request) {
+	report, err := h.tm.ReconcileBalance(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, report)
+}
+
+func (h *httpHandler) getAuctionAudit(w http.ResponseWriter, r *http.Request) {
+	audit, err := h.tm.GetAuctionAudit(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, audit)
+}
+
+func (h *httpHandler) getTeamStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.tm.GetTeamStats(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, stats)
+}
+
+func (h *httpHandler) getQuotaUsage(w http.ResponseWriter, r *http.Request) {
+	usage, err := h.tm.GetQuotaUsage(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, usage)
+}
+
+func (h *httpHandler) getLeaderboard(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: "limit must be a positive integer"})
+			return
+		}
+		limit = n
+	}
+
+	stats, err := h.tm.GetLeaderboard(r.Context(), limit)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if stats == nil {
+		stats = []TeamStats{}
+	}
+
+	h.writeJSON(w, http.StatusOK, stats)
+}
+
+func (h *httpHandler) computeTeamStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.tm.ComputeTeamStats(r.Context())
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, stats)
+}
+
+func (h *httpHandler) transfer(w http.ResponseWriter, r *http.Request) {
+	var req transferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if req.FromTeamID == "" || req.ToTeamID == "" {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: "from_team_id and to_team_id are required"})
+		return
+	}
+
+	result, err := h.tm.TransferTokens(r.Context(), req.FromTeamID, req.ToTeamID, req.Amount)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, result)
+}
+
+func (h *httpHandler) setAutoBidPolicy(w http.ResponseWriter, r *http.Request) {
+	var req AutoBidPolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	// only the policy's terms come from the body
+	policy, err := h.tm.SetAutoBidPolicy(r.Context(), AutoBidPolicy{
+		TeamID:         r.PathValue("id"),
+		MaxPriority:    req.MaxPriority,
+		MaxCost:        req.MaxCost,
+		ReserveBalance: req.ReserveBalance,
+		UserIDs:        req.UserIDs,
+	})
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, policy)
+}
+
+func (h *httpHandler) getAutoBidPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.tm.GetAutoBidPolicy(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, policy)
+}
+
+func (h *httpHandler) deleteAutoBidPolicy(w http.ResponseWriter, r *http.Request) {
+	if err := h.tm.DeleteAutoBidPolicy(r.Context(), r.PathValue("id")); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *httpHandler) createTeam(w http.ResponseWriter, r *http.Request) {
+	var req createTeamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	team, err := h.tm.CreateTeam(r.Context(), req.TeamID, req.Name)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, team)
+}
+
+func (h *httpHandler) listTeams(w http.ResponseWriter, r *http.Request) {
+	status := TeamStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", TeamActive, TeamSuspended, TeamArchived:
+	default:
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: "status must be active, suspended or archived"})
+		return
+	}
+
+	teams, err := h.tm.ListTeams(r.Context(), status)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if teams == nil {
+		teams = []Team{}
+	}
+
+	h.writeJSON(w, http.StatusOK, teams)
+}
+
+func (h *httpHandler) getTeam(w http.ResponseWriter, r *http.Request) {
+	team, err := h.tm.GetTeam(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, team)
+}
+
+func (h *httpHandler) suspendTeam(w http.ResponseWriter, r *http.Request) {
+	var req teamStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	team, err := h.tm.SuspendTeam(r.Context(), r.PathValue("id"), req.Reason)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, team)
+}
+
+func (h *httpHandler) reinstateTeam(w http.ResponseWriter, r *http.Request) {
+	team, err := h.tm.ReinstateTeam(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, team)
+}
+
+func (h *httpHandler) archiveTeam(w http.ResponseWriter, r *http.Request) {
+	var req teamStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	team, err := h.tm.ArchiveTeam(r.Context(), r.PathValue("id"), req.Reason)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, team)
+}
+
+func (h *httpHandler) deleteTeam(w http.ResponseWriter, r *http.Request) {
+	if err := h.tm.DeleteTeam(r.Context(), r.PathValue("id")); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *httpHandler) setWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	hook, err := h.tm.SetWebhook(r.Context(), r.PathValue("id"), req.URL)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, hook)
+}
+
+func (h *httpHandler) getWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, err := h.tm.GetWebhook(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, hook)
+}
+
+func (h *httpHandler) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := h.tm.DeleteWebhook(r.Context(), r.PathValue("id")); err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *httpHandler) getWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	letters, err := h.tm.GetWebhookDeadLetters(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	if letters == nil {
+		letters = []WebhookDeadLetter{}
+	}
+
+	h.writeJSON(w, http.StatusOK, letters)
+}
+
+func (h *httpHandler) getStoreStatus(w http.ResponseWriter, r *http.Request) {
+	settlements := h.tm.DegradedSettlements()
+	if settlements == nil {
+		settlements = []DegradedSettlement{}
+	}
+
+	h.writeJSON(w, http.StatusOK, storeStatusResponse{
+		State:       h.tm.StoreState().String(),
+		Settlements: settlements,
+	})
+}
+
+func (h *httpHandler) openWindow(w http.ResponseWriter, r *http.Request) {
+	var req openWindowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if req.UserID == "" {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: "user_id is required"})
+		return
+	}
+
+	window, err := h.tm.OpenAuctionWindow(r.Context(), req.UserID, req.Deadline)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, window)
+}
+
+func (h *httpHandler) getWindow(w http.ResponseWriter, r *http.Request) {
+	window, err := h.tm.GetAuctionWindow(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, window)
+}
+
+func (h *httpHandler) submitSealedBid(w http.ResponseWriter, r *http.Request) {
+	var req sealedBidRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if req.TeamID == "" {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: "team_id is required"})
+		return
+	}
+
+	row, err := h.tm.SubmitSealedBid(r.Context(), r.PathValue("id"), req.TeamID, req.Priority)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusAccepted, newBidRowResponse(*row))
+}
+
+func (h *httpHandler) settleWindow(w http.ResponseWriter, r *http.Request) {
+	result, err := h.tm.SettleAuctionWindow(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, result)
+}
+
+func (h *httpHandler) openDutchAuction(w http.ResponseWriter, r *http.Request) {
+	var req openDutchAuctionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if req.UserID == "" {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: "user_id is required"})
+		return
+	}
+
+	auction, err := h.tm.OpenDutchAuction(r.Context(), req.UserID, req.Priority, req.Schedule, req.Deadline)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusCreated, auction)
+}
+
+func (h *httpHandler) getDutchAuction(w http.ResponseWriter, r *http.Request) {
+	auction, err := h.tm.GetDutchAuction(r.Context(), r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	resp := dutchAuctionResponse{DutchAuction: *auction}
+	if price, ok := h.tm.DutchAuctionPrice(auction); ok {
+		resp.CurrentPrice = price
+	}
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *httpHandler) acceptDutchAuction(w http.ResponseWriter, r *http.Request) {
+	var req acceptDutchAuctionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if req.TeamID == "" {
+		h.writeJSON(w, http.StatusBadRequest, errorResponse{Error: "team_id is required"})
+		return
+	}
+
+	result, err := h.tm.AcceptDutchAuction(r.Context(), r.PathValue("id"), req.TeamID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, result)
+}
+
+// HTTPStatus maps the package's sentinel errors to HTTP status codes, as
+// NewHTTPHandler answers them, for other servers and transports built on a
+// Manager.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrTeamNotFound), errors.Is(err, ErrBidNotFound),
+		errors.Is(err, ErrHoldNotFound), errors.Is(err, ErrAuctionWindowNotFound),
+		errors.Is(err, ErrDutchAuctionNotFound), errors.Is(err, ErrAutoBidPolicyNotFound),
+		errors.Is(err, ErrWebhookNotFound), errors.Is(err, ErrTeamStatsNotFound),
+		errors.Is(err, ErrAuctionAuditNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInsufficientBalance):
+		return http.StatusPaymentRequired
+	case errors.Is(err, ErrTeamSuspended):
+		return http.StatusForbidden
+	case errors.Is(err, ErrTeamArchived):
+		return http.StatusGone
+	case errors.Is(err, ErrBudgetExceeded), errors.Is(err, ErrQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrNoWinner):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrAuctionConflict), errors.Is(err, ErrConditionFailed),
+		errors.Is(err, ErrHoldExpired), errors.Is(err, ErrWinCooldown),
+		errors.Is(err, ErrAuctionInProgress), errors.Is(err, ErrIdempotencyKeyInUse),
+		errors.Is(err, ErrAuctionWindowClosed), errors.Is(err, ErrAuctionWindowOpen),
+		errors.Is(err, ErrDutchAuctionClosed), errors.Is(err, ErrTeamExists):
+		return http.StatusConflict
+	case errors.Is(err, ErrTooManyBids), errors.Is(err, ErrInvalidBid), errors.Is(err, ErrUnknownPriority),
+		errors.Is(err, ErrInvalidCursor), errors.Is(err, ErrInvalidTransfer),
+		errors.Is(err, ErrInvalidAdjustment), errors.Is(err, ErrInvalidCurrency),
+		errors.Is(err, ErrInvalidPriceSchedule), errors.Is(err, ErrInvalidAutoBidPolicy),
+		errors.Is(err, ErrInvalidWebhook), errors.Is(err, ErrInvalidTeam):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrStoreUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (h *httpHandler) writeError(w http.ResponseWriter, err error) {
+	status := HTTPStatus(err)
+	if status == http.StatusInternalServerError {
+		h.tm.logger.Error("request failed", zap.Error(err))
+	}
+	h.writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func (h *httpHandler) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.tm.logger.Warn("failed to write response", zap.Error(err))
+	}
+}
@@ -0,0 +1,282 @@
+package tokens
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{ErrTeamNotFound, http.StatusNotFound},
+		{ErrBidNotFound, http.StatusNotFound},
+		{ErrAuctionWindowNotFound, http.StatusNotFound},
+		{ErrInsufficientBalance, http.StatusPaymentRequired},
+		{ErrTeamSuspended, http.StatusForbidden},
+		{ErrTeamArchived, http.StatusGone},
+		{ErrQuotaExceeded, http.StatusTooManyRequests},
+		{ErrNoWinner, http.StatusUnprocessableEntity},
+		{ErrAuctionConflict, http.StatusConflict},
+		{ErrAuctionInProgress, http.StatusConflict},
+		{ErrIdempotencyKeyInUse, http.StatusConflict},
+		{ErrTooManyBids, http.StatusBadRequest},
+		{ErrInvalidBid, http.StatusBadRequest},
+		{ErrUnknownPriority, http.StatusBadRequest},
+		{ErrStoreUnavailable, http.StatusServiceUnavailable},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			// the Manager wraps its sentinels with detail
+			err := fmt.Errorf("%w: detail", tt.err)
+			if got := HTTPStatus(err); got != tt.want {
+				t.Errorf("HTTPStatus(%v) = %d, want %d", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		// wantBody is a substring of the response body
+		wantBody string
+	}{
+		{
+			name: "balance", method: http.MethodGet, path: "/teams/a/balance",
+			wantStatus: http.StatusOK, wantBody: `"token_balance":1000`,
+		},
+		{
+			name: "balance of unknown team", method: http.MethodGet, path: "/teams/missing/balance",
+			wantStatus: http.StatusNotFound, wantBody: "team not found",
+		},
+		{
+			name: "bids of team without any", method: http.MethodGet, path: "/teams/a/bids",
+			wantStatus: http.StatusOK, wantBody: "[]",
+		},
+		{
+			name: "auction", method: http.MethodPost, path: "/auctions",
+			body:       `[{"team_id":"a","user_id":"u","priority":5},{"team_id":"b","user_id":"u","priority":1}]`,
+			wantStatus: http.StatusOK, wantBody: `"team_id":"a"`,
+		},
+		{
+			name: "auction with malformed body", method: http.MethodPost, path: "/auctions",
+			body: `{`, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "auction with unknown priority", method: http.MethodPost, path: "/auctions",
+			body:       `[{"team_id":"a","user_id":"u","priority":99}]`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "auction with unknown team", method: http.MethodPost, path: "/auctions",
+			body:       `[{"team_id":"missing","user_id":"u","priority":1}]`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "auction with malformed reserve", method: http.MethodPost, path: "/auctions?min_score=x",
+			body: `[{"team_id":"a","user_id":"u","priority":5}]`, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "balances", method: http.MethodGet, path: "/balances?teams=b,a",
+			wantStatus: http.StatusOK, wantBody: `[{"team_id":"a","token_balance":1000`,
+		},
+		{name: "balances without teams", method: http.MethodGet, path: "/balances", wantStatus: http.StatusBadRequest},
+		{
+			name: "auction of user without pending bids", method: http.MethodPost, path: "/users/u/auction",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name: "pending bid with unknown priority", method: http.MethodPost, path: "/bids",
+			body: `{"team_id":"a","user_id":"u","priority":99}`, wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "store status", method: http.MethodGet, path: "/store",
+			wantStatus: http.StatusOK, wantBody: `"settlements":[]`,
+		},
+		{name: "unknown route", method: http.MethodGet, path: "/nope", wantStatus: http.StatusNotFound},
+		{name: "wrong method", method: http.MethodGet, path: "/auctions", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := newTestManager(t, []string{"a", "b"})
+			handler := NewHTTPHandler(tm)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.path, rec.Code, rec.Body, tt.wantStatus)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body %s doesn't contain %s", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestHTTPHandlerIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name string
+		keys [2]string
+		// wantSame is whether both requests return the same auction
+		wantSame bool
+	}{
+		{name: "same key", keys: [2]string{"k1", "k1"}, wantSame: true},
+		{name: "different keys", keys: [2]string{"k1", "k2"}},
+		{name: "no key", keys: [2]string{"", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := newTestManager(t, []string{"a"})
+			handler := NewHTTPHandler(tm)
+
+			var results [2]AuctionResult
+			for i, key := range tt.keys {
+				req := httptest.NewRequest(http.MethodPost, "/auctions",
+					strings.NewReader(`[{"team_id":"a","user_id":"u","priority":5}]`))
+				if key != "" {
+					req.Header.Set(IdempotencyKeyHeader, key)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("request %d = %d %s", i, rec.Code, rec.Body)
+				}
+				if err := json.NewDecoder(rec.Body).Decode(&results[i]); err != nil {
+					t.Fatalf("decoding result: %v", err)
+				}
+			}
+
+			if same := results[0].AuctionID == results[1].AuctionID; same != tt.wantSame {
+				t.Errorf("auctions %s and %s, want same=%t", results[0].AuctionID, results[1].AuctionID, tt.wantSame)
+			}
+			charges := int64(2)
+			if tt.wantSame {
+				charges = 1
+			}
+			balance, _, err := tm.GetTokenBalance(context.Background(), "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := InitialTokenCount - charges*results[0].Cost; balance != want {
+				t.Errorf("balance = %d, want %d after %d charges", balance, want, charges)
+			}
+		})
+	}
+}
+
+func TestHTTPHandlerPendingBids(t *testing.T) {
+	tm := newTestManager(t, []string{"a", "b"})
+	handler := NewHTTPHandler(tm)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	for i, body := range []string{
+		`{"team_id":"a","user_id":"u","priority":5}`,
+		`{"team_id":"b","user_id":"u","priority":1}`,
+	} {
+		rec := do(http.MethodPost, "/bids", body)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("POST /bids = %d %s", rec.Code, rec.Body)
+		}
+		if want := fmt.Sprintf(`"pending":%d`, i+1); !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("body %s doesn't contain %s", rec.Body, want)
+		}
+	}
+
+	rec := do(http.MethodPost, "/users/u/auction", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"team_id":"a"`) {
+		t.Fatalf("POST /users/u/auction = %d %s, want a to win", rec.Code, rec.Body)
+	}
+	// the auction consumed the pending bids
+	if rec := do(http.MethodPost, "/users/u/auction", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("second auction = %d %s, want %d", rec.Code, rec.Body, http.StatusNotFound)
+	}
+
+	// bid rows name their team
+	rec = do(http.MethodGet, "/users/u/bids", "")
+	var rows []struct {
+		TeamID string `json:"team_id"`
+		Won    bool   `json:"won"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&rows); err != nil {
+		t.Fatalf("decoding bids: %v", err)
+	}
+	won := map[string]bool{}
+	for _, row := range rows {
+		won[row.TeamID] = row.Won
+	}
+	if len(won) != 2 || !won["a"] || won["b"] {
+		t.Errorf("bids on u = %+v, want a's won and b's lost", rows)
+	}
+}
+
+func TestHTTPHandlerAdminAuth(t *testing.T) {
+	// alice's requests carry her token
+	auth := func(r *http.Request) (string, bool) {
+		return "alice", r.Header.Get("Authorization") == "Bearer alice-token"
+	}
+	tests := []struct {
+		name       string
+		opts       []HTTPOption
+		token      string
+		wantStatus int
+	}{
+		{name: "admin routes disabled", token: "alice-token", wantStatus: http.StatusUnauthorized},
+		{name: "unauthenticated", opts: []HTTPOption{WithAdminAuth(auth)}, wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", opts: []HTTPOption{WithAdminAuth(auth)}, token: "mallory-token", wantStatus: http.StatusUnauthorized},
+		{name: "authenticated", opts: []HTTPOption{WithAdminAuth(auth)}, token: "alice-token", wantStatus: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := newTestManager(t, []string{"a"})
+			handler := NewHTTPHandler(tm, tt.opts...)
+
+			// the actor in the body is ignored for the authenticated one
+			req := httptest.NewRequest(http.MethodPost, "/teams/a/adjustments",
+				strings.NewReader(`{"delta":50,"reason":"credit","actor":"bob"}`))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("POST /teams/a/adjustments = %d %s, want %d", rec.Code, rec.Body, tt.wantStatus)
+			}
+
+			wantBalance := int64(InitialTokenCount)
+			if tt.wantStatus == http.StatusCreated {
+				wantBalance += 50
+				var adjustment AdjustmentRow
+				if err := json.NewDecoder(rec.Body).Decode(&adjustment); err != nil {
+					t.Fatalf("decoding adjustment: %v", err)
+				}
+				if adjustment.Actor != "alice" {
+					t.Errorf("adjustment by %q, want alice", adjustment.Actor)
+				}
+			}
+			if balance := tokenRow(t, tm, "a").TokenBalance; balance != wantBalance {
+				t.Errorf("balance = %d, want %d", balance, wantBalance)
+			}
+		})
+	}
+}
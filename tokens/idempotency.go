@@ -0,0 +1,159 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultIdempotencyTTL is how long an idempotency key is remembered when
+// WithIdempotencyTTL is unset.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// Operations an idempotency key can be claimed for. Keys are scoped to their
+// operation, so the same key used for an auction and a spend doesn't collide.
+const (
+	idempotencyOpAuction = "auction"
+	idempotencyOpSpend   = "spend"
+)
+
+// IdempotencyRow records a request made with an idempotency key. It is
+// written when the request starts, claiming the key, and completed with the
+// request's result once it succeeds. Idempotency rows live in the tokens
+// table.
+type IdempotencyRow struct {
+	Pk string `dynamodbav:"pk" json:"pk"`
+	// Key is the operation and the caller's key, operation#key.
+	Key       string `dynamodbav:"idempotency_key" json:"idempotency_key"`
+	Completed bool   `dynamodbav:"completed" json:"completed"`
+	// Result is set for a completed auction, and Results too for a
+	// completed multi-winner auction.
+	Result  *AuctionResult   `dynamodbav:"result,omitempty" json:"result,omitempty"`
+	Results []*AuctionResult `dynamodbav:"results,omitempty" json:"results,omitempty"`
+	// Balance is set for a completed spend.
+	Balance     int64 `dynamodbav:"balance" json:"balance"`
+	ExpiresAtMs int64 `dynamodbav:"expires_at_ms" json:"expires_at_ms"`
+	CreatedAtMs int64 `dynamodbav:"created_at_ms" json:"created_at_ms"`
+}
+
+// claimIdempotencyKey claims key for op. It returns the completed row of an
+// earlier request that used the key, or nil if this request claimed it. A
+// key claimed by a request that hasn't completed returns
+// ErrIdempotencyKeyInUse.
+func (tm *Manager) claimIdempotencyKey(ctx context.Context, op, key string) (*IdempotencyRow, error) {
+	now := tm.clock.Now()
+
+	ttl := tm.idempotencyTTL
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+
+	row := &IdempotencyRow{
+		Pk:          GetIdempotencyPK(op + "#" + key),
+		Key:         op + "#" + key,
+		ExpiresAtMs: now.Add(ttl).UnixMilli(),
+		CreatedAtMs: now.UnixMilli(),
+	}
+
+	err := tm.store.ClaimIdempotencyKey(ctx, row, now.UnixMilli())
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, ErrConditionFailed) {
+		return nil, err
+	}
+
+	prior, err := tm.store.GetIdempotencyRow(ctx, row.Key)
+	if err != nil {
+		return nil, err
+	}
+	if prior == nil || !prior.Completed {
+		return nil, fmt.Errorf("%w: %s", ErrIdempotencyKeyInUse, key)
+	}
+	return prior, nil
+}
+
+// completeIdempotencyKey stores the result of the request that claimed key.
+// Failures are logged rather than returned since the request itself
+// succeeded; the key then stays claimed until it expires, so retries fail
+// with ErrIdempotencyKeyInUse instead of repeating the request.
+func (tm *Manager) completeIdempotencyKey(ctx context.Context, op, key string, results []*AuctionResult, balance int64) {
+	now := tm.clock.Now()
+
+	ttl := tm.idempotencyTTL
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+
+	row := &IdempotencyRow{
+		Pk:          GetIdempotencyPK(op + "#" + key),
+		Key:         op + "#" + key,
+		Completed:   true,
+		Balance:     balance,
+		ExpiresAtMs: now.Add(ttl).UnixMilli(),
+		CreatedAtMs: now.UnixMilli(),
+	}
+	if len(results) > 0 {
+		row.Result = results[0]
+	}
+	if len(results) > 1 {
+		row.Results = results
+	}
+
+	err := tm.store.PutIdempotencyRow(ctx, row)
+	if err != nil {
+		tm.logger.Warn("failed to record idempotent result", zap.String("idempotency_key", key), zap.Error(err))
+	}
+}
+
+// auctionResults returns the results of the completed auction row records.
+func (row *IdempotencyRow) auctionResults() []*AuctionResult {
+	if len(row.Results) > 0 {
+		return row.Results
+	}
+	return []*AuctionResult{row.Result}
+}
+
+// releaseIdempotencyKey gives up the claim on key after its request failed
+// without charging anyone, so a retry runs the request again. A failure
+// that may have charged a team keeps the key claimed until it expires.
+func (tm *Manager) releaseIdempotencyKey(ctx context.Context, op, key string, cause error) {
+	if !chargedNothing(cause) {
+		tm.logger.Warn(
+			"keeping idempotency key claimed after ambiguous failure",
+			zap.String("idempotency_key", key),
+			zap.Error(cause),
+		)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortBidsTimeout)
+	defer cancel()
+
+	err := tm.store.DeleteIdempotencyRow(ctx, op+"#"+key)
+	if err != nil {
+		tm.logger.Warn("failed to release idempotency key", zap.String("idempotency_key", key), zap.Error(err))
+	}
+}
+
+// chargedNothing reports whether err means a request failed before any
+// tokens could have been charged, including a charge whose condition kept
+// failing until its retries ran out (ErrAuctionConflict). Other errors, e.g.
+// a store timeout during the charge itself, leave it unknown whether the
+// charge committed.
+func chargedNothing(err error) bool {
+	for _, target := range []error{
+		ErrNoWinner, ErrInsufficientBalance, ErrWinCooldown, ErrTeamNotFound,
+		ErrUnknownPriority, ErrTooManyBids, ErrAuctionInProgress,
+		ErrBudgetExceeded, ErrQuotaExceeded, ErrTeamSuspended, ErrTeamArchived,
+		ErrInvalidCurrency, ErrAuctionConflict,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
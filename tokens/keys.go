@@ -0,0 +1,172 @@
+package tokens
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+func GetTokenPK(teamID string) string {
+	return fmt.Sprintf("team#%s", strings.TrimSpace(teamID))
+}
+
+func GetBidPK(teamID string) string {
+	return fmt.Sprintf("bid#%s", strings.TrimSpace(teamID))
+}
+
+// GetBidShardPK is the partition key of one shard of a team's bids when
+// bid sharding is enabled.
+func GetBidShardPK(teamID string, shard int) string {
+	return fmt.Sprintf("bid#%s#%d", strings.TrimSpace(teamID), shard)
+}
+
+// bidPK returns the partition key a bid is written under. The shard is
+// derived from the bid ID so a bid can be found again from its ID alone.
+func (tm *Manager) bidPK(teamID, bidID string) string {
+	if tm.bidShards <= 1 {
+		return GetBidPK(teamID)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(bidID))
+	return GetBidShardPK(teamID, int(h.Sum32()%uint32(tm.bidShards)))
+}
+
+// bidExpiryShards is how many expiry buckets each hour's expiring bids are
+// spread over, so the bids recorded at any one time don't all write to one
+// partition of IndexNameBidsByExpiry.
+const bidExpiryShards = 8
+
+// GetBidExpiryBucket is the expiry_bucket of the bids expiring in the hour
+// of expiresAt, in Unix seconds, in one shard.
+func GetBidExpiryBucket(expiresAt int64, shard int) string {
+	return fmt.Sprintf("expiry#%d#%d", expiresAt/3600, shard)
+}
+
+// bidExpiryBucket returns the expiry bucket of a bid expiring at expiresAt,
+// or "" if it never expires. Like bidPK, the shard comes from the bid ID.
+func bidExpiryBucket(bidID string, expiresAt int64) string {
+	if expiresAt <= 0 {
+		return ""
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(bidID))
+	return GetBidExpiryBucket(expiresAt, int(h.Sum32()%bidExpiryShards))
+}
+
+// bidExpiryBuckets returns every expiry bucket a bid expiring in
+// [fromSec, toSec) may be in.
+func bidExpiryBuckets(fromSec, toSec int64) []string {
+	var buckets []string
+	for hour := fromSec / 3600; hour <= (toSec-1)/3600; hour++ {
+		for shard := range bidExpiryShards {
+			buckets = append(buckets, GetBidExpiryBucket(hour*3600, shard))
+		}
+	}
+	return buckets
+}
+
+// bidPKs returns every partition key a team's bids may live under. With
+// sharding enabled it includes the unsharded key, so bids recorded before
+// sharding was turned on are still read.
+func (tm *Manager) bidPKs(teamID string) []string {
+	pks := []string{GetBidPK(teamID)}
+	for shard := 0; tm.bidShards > 1 && shard < tm.bidShards; shard++ {
+		pks = append(pks, GetBidShardPK(teamID, shard))
+	}
+	return pks
+}
+
+// TeamID returns the ID of the team that placed the bid.
+func (row *BidRow) TeamID() string {
+	return bidTeamID(row)
+}
+
+// bidTeamID recovers the team of a bid row from its sort key,
+// teamID#bidID#createdAtMs, since the partition key may carry a shard.
+func bidTeamID(row *BidRow) string {
+	parts := strings.Split(row.Sk, "#")
+	if len(parts) < 3 {
+		return row.Sk
+	}
+	return strings.Join(parts[:len(parts)-2], "#")
+}
+
+func GetBalanceHistoryPK(teamID string) string {
+	return fmt.Sprintf("balance#%s", strings.TrimSpace(teamID))
+}
+
+func GetLedgerPK(teamID string) string {
+	return fmt.Sprintf("ledger#%s", strings.TrimSpace(teamID))
+}
+
+func GetLockPK(userID string) string {
+	return fmt.Sprintf("lock#%s", strings.TrimSpace(userID))
+}
+
+func GetAuctionPK(userID string) string {
+	return fmt.Sprintf("auction#%s", strings.TrimSpace(userID))
+}
+
+func GetHoldPK(holdID string) string {
+	return fmt.Sprintf("hold#%s", holdID)
+}
+
+func GetAuctionWindowPK(auctionID string) string {
+	return fmt.Sprintf("window#%s", auctionID)
+}
+
+func GetDutchAuctionPK(auctionID string) string {
+	return fmt.Sprintf("dutch#%s", auctionID)
+}
+
+func GetAutoBidPolicyPK(teamID string) string {
+	return fmt.Sprintf("autobid#%s", strings.TrimSpace(teamID))
+}
+
+func GetWebhookPK(teamID string) string {
+	return fmt.Sprintf("webhook#%s", strings.TrimSpace(teamID))
+}
+
+func GetWebhookDeadLetterPK(notificationID string) string {
+	return fmt.Sprintf("webhook_dlq#%s", notificationID)
+}
+
+func GetTeamStatsPK(teamID string) string {
+	return fmt.Sprintf("stats#%s", strings.TrimSpace(teamID))
+}
+
+func GetAuctionAuditPK(auctionID string) string {
+	return fmt.Sprintf("audit#%s", auctionID)
+}
+
+func GetPacingPK(teamID string) string {
+	return fmt.Sprintf("pacing#%s", strings.TrimSpace(teamID))
+}
+
+func GetQuotaPK(teamID string) string {
+	return fmt.Sprintf("quota#%s", strings.TrimSpace(teamID))
+}
+
+func GetFrequencyPK(teamID, userID string) string {
+	return fmt.Sprintf("frequency#%s#%s", strings.TrimSpace(teamID), strings.TrimSpace(userID))
+}
+
+func GetTransferPK(transferID string) string {
+	return fmt.Sprintf("transfer#%s", transferID)
+}
+
+func GetAdjustmentPK(adjustmentID string) string {
+	return fmt.Sprintf("adjustment#%s", adjustmentID)
+}
+
+// GetReputationEventPK is the key a reputation event is recorded under,
+// which makes its dedupe key unique per team.
+func GetReputationEventPK(teamID, dedupeKey string) string {
+	return fmt.Sprintf("reputation#%s#%s", strings.TrimSpace(teamID), dedupeKey)
+}
+
+func GetIdempotencyPK(key string) string {
+	return fmt.Sprintf("idempotency#%s", key)
+}
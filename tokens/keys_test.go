@@ -0,0 +1,115 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestBidShards(t *testing.T) {
+	tests := []struct {
+		name   string
+		shards int
+		// wantPKs is how many partitions a team's bids may live under
+		wantPKs int
+	}{
+		{name: "unsharded", shards: 0, wantPKs: 1},
+		{name: "one shard", shards: 1, wantPKs: 1},
+		{name: "sharded", shards: 4, wantPKs: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := newTestManager(t, nil, WithBidShards(tt.shards))
+
+			pks := tm.bidPKs("a")
+			if len(pks) != tt.wantPKs {
+				t.Errorf("got %d partition keys %v, want %d", len(pks), pks, tt.wantPKs)
+			}
+			used := make(map[string]bool)
+			for i := range 100 {
+				bidID := fmt.Sprintf("bid_%d", i)
+				pk := tm.bidPK("a", bidID)
+				if pk != tm.bidPK("a", bidID) {
+					t.Fatalf("bid %s has no stable partition key", bidID)
+				}
+				if !slices.Contains(pks, pk) {
+					t.Fatalf("partition key %s of bid %s not read by bidPKs %v", pk, bidID, pks)
+				}
+				used[pk] = true
+			}
+			// the unsharded key is only read, for bids from before sharding
+			if want := max(tt.wantPKs-1, 1); len(used) != want {
+				t.Errorf("bids spread over %d partitions, want %d", len(used), want)
+			}
+		})
+	}
+}
+
+func TestBidShardsKeepUnshardedBids(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryStore()
+	bids := []Bid{
+		{TeamID: "a", UserID: "u", Priority: 5},
+		{TeamID: "b", UserID: "u", Priority: 1},
+	}
+
+	before := newTestManager(t, []string{"a", "b"}, WithStore(mem))
+	if _, err := before.RunAuction(ctx, bids); err != nil {
+		t.Fatalf("RunAuction: %v", err)
+	}
+	after := newTestManager(t, nil, WithStore(mem), WithBidShards(4))
+	for range 3 {
+		if _, err := after.RunAuction(ctx, bids); err != nil {
+			t.Fatalf("RunAuction: %v", err)
+		}
+	}
+
+	got, err := after.GetBids(ctx, "b")
+	if err != nil {
+		t.Fatalf("GetBids: %v", err)
+	}
+	if len(got) != 4 {
+		t.Errorf("got %d bids, want 4 including the one from before sharding", len(got))
+	}
+}
+
+func TestBidTeamID(t *testing.T) {
+	tests := []struct {
+		sk   string
+		want string
+	}{
+		{sk: "a#bid_1#1000", want: "a"},
+		{sk: "team#with#hashes#bid_1#1000", want: "team#with#hashes"},
+		{sk: "malformed", want: "malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sk, func(t *testing.T) {
+			row := &BidRow{Sk: tt.sk}
+			if got := row.TeamID(); got != tt.want {
+				t.Errorf("TeamID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBidExpiryBuckets(t *testing.T) {
+	const hour = 3600
+	from, to := int64(100*hour+1800), int64(102*hour)
+	buckets := bidExpiryBuckets(from, to)
+	if len(buckets) != 2*bidExpiryShards {
+		t.Errorf("got %d buckets for two hours, want %d", len(buckets), 2*bidExpiryShards)
+	}
+	for i := range 100 {
+		bidID := fmt.Sprintf("bid_%d", i)
+		if bucket := bidExpiryBucket(bidID, to-1); !slices.Contains(buckets, bucket) {
+			t.Fatalf("bucket %s of bid %s not queried by %v", bucket, bidID, buckets)
+		}
+	}
+	if bucket := bidExpiryBucket("bid", to); slices.Contains(buckets, bucket) {
+		t.Errorf("bucket %s past the range is queried", bucket)
+	}
+	if bucket := bidExpiryBucket("bid", 0); bucket != "" {
+		t.Errorf("bid that never expires has bucket %q", bucket)
+	}
+}
@@ -0,0 +1,221 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/segmentio/ksuid"
+	"go.uber.org/zap"
+)
+
+// reconcileAttempts bounds how often ReconcileBalance rereads a team whose
+// balance changed while it was being read.
+const reconcileAttempts = 3
+
+// Kinds of ledger entries.
+const (
+	// LedgerOpen credits a new team its initial balance.
+	LedgerOpen = "open"
+	// LedgerRefill moves a team's balance to the initial balance, by
+	// whatever delta that takes.
+	LedgerRefill     = "refill"
+	LedgerSpend      = "spend"
+	LedgerHold       = "hold"
+	LedgerRelease    = "release"
+	LedgerDrip       = "drip"
+	LedgerTransfer   = "transfer"
+	LedgerAdjustment = "adjustment"
+	LedgerCorrection = "correction"
+	// LedgerClose takes a deleted team's balance off, so its ledger sums to
+	// zero; see DeleteTeam.
+	LedgerClose = "close"
+)
+
+// LedgerEntry is one credit or debit of a team's standard token balance,
+// kept in the ledger table. Every write to token_balance appends an entry in
+// the same transaction, so the balance is always the sum of the team's
+// entries. Balances in other currencies aren't ledgered.
+type LedgerEntry struct {
+	Pk      string `dynamodbav:"pk" json:"-"`
+	Sk      string `dynamodbav:"sk" json:"-"`
+	TeamID  string `dynamodbav:"team_id" json:"team_id"`
+	EntryID string `dynamodbav:"entry_id" json:"entry_id"`
+	Kind    string `dynamodbav:"kind" json:"kind"`
+	// Delta is the tokens credited, or debited if negative.
+	Delta int64 `dynamodbav:"delta" json:"delta"`
+	// Ref identifies what moved the tokens, e.g. a bid, hold, transfer or
+	// adjustment ID, if anything.
+	Ref         string `dynamodbav:"ref,omitempty" json:"ref,omitempty"`
+	CreatedAtMs int64  `dynamodbav:"created_at_ms" json:"created_at_ms"`
+}
+
+// newLedgerEntry returns an entry moving delta tokens of a team's balance at
+// nowMs. Stores build the entries for their own writes.
+func newLedgerEntry(teamID, kind string, delta int64, ref string, nowMs int64) (*LedgerEntry, error) {
+	id, err := ksuid.NewRandomWithTime(time.UnixMilli(nowMs))
+	if err != nil {
+		return nil, fmt.Errorf("error generating ledger entry ID: %v", err)
+	}
+
+	return &LedgerEntry{
+		Pk:          GetLedgerPK(teamID),
+		Sk:          balanceHistorySk(nowMs, id.String()),
+		TeamID:      teamID,
+		EntryID:     id.String(),
+		Kind:        kind,
+		Delta:       delta,
+		Ref:         ref,
+		CreatedAtMs: nowMs,
+	}, nil
+}
+
+// bidRef is the ledger reference of a spend on bid, if any.
+func bidRef(bid *BidRow) string {
+	if bid == nil {
+		return ""
+	}
+	return bid.BidID
+}
+
+// ledgerBalance sums entries into the balance they leave.
+func ledgerBalance(entries []LedgerEntry) int64 {
+	var balance int64
+	for _, entry := range entries {
+		balance += entry.Delta
+	}
+	return balance
+}
+
+// GetLedger returns a team's ledger entries created between startMs and
+// endMs inclusive, oldest first. Entries from the same millisecond are in no
+// particular order.
+func (tm *Manager) GetLedger(ctx context.Context, teamID string, startMs, endMs int64) ([]LedgerEntry, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.store.QueryLedger(ctx, tm.normalizeID(teamID), startMs, endMs)
+}
+
+// LedgerReport compares a team's materialized balance with its ledger.
+type LedgerReport struct {
+	TeamID string `json:"team_id"`
+	// Balance is the team's token_balance.
+	Balance int64 `json:"balance"`
+	// LedgerBalance is the sum of the team's Entries ledger entries.
+	LedgerBalance int64 `json:"ledger_balance"`
+	Entries       int   `json:"entries"`
+	// Drift is Balance - LedgerBalance; zero means the team reconciles.
+	Drift int64 `json:"drift"`
+}
+
+// ReconcileBalance verifies a team's token_balance against its ledger. The
+// ledger is reread until no entry was appended while the balance was read,
+// so a concurrent spend doesn't show up as drift. A team created before the
+// ledger drifts by its balance at the time, since its opening credit was
+// never recorded.
+//
+// Unlike ReconcileTeam it never changes the balance.
+func (tm *Manager) ReconcileBalance(ctx context.Context, teamID string) (*LedgerReport, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.reconcileBalance(ctx, tm.normalizeID(teamID))
+}
+
+func (tm *Manager) reconcileBalance(ctx context.Context, teamID string) (*LedgerReport, error) {
+	entries, err := tm.store.QueryLedger(ctx, teamID, 0, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+
+	for range reconcileAttempts {
+		row, err := tm.store.GetTokenRow(ctx, teamID, true)
+		if err != nil {
+			return nil, err
+		}
+
+		after, err := tm.store.QueryLedger(ctx, teamID, 0, math.MaxInt64)
+		if err != nil {
+			return nil, err
+		}
+		if len(after) != len(entries) {
+			// entries are only ever appended, so the balance moved while
+			// it was read
+			entries = after
+			continue
+		}
+
+		report := &LedgerReport{
+			TeamID:        teamID,
+			Balance:       row.TokenBalance,
+			LedgerBalance: ledgerBalance(entries),
+			Entries:       len(entries),
+		}
+		report.Drift = report.Balance - report.LedgerBalance
+		return report, nil
+	}
+	return nil, fmt.Errorf("%w: balance of %s kept changing during reconcile", ErrAuctionConflict, teamID)
+}
+
+// ReconcileBalances runs ReconcileBalance over every team and returns the
+// reports of the teams that drifted, logging each. A team that can't be
+// reconciled is logged and skipped.
+func (tm *Manager) ReconcileBalances(ctx context.Context) ([]LedgerReport, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	rows, err := tm.store.ScanTokenRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifted []LedgerReport
+	for _, row := range rows {
+		report, err := tm.reconcileBalance(ctx, row.TeamID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return drifted, ctx.Err()
+			}
+			tm.logger.Warn("failed to reconcile balance", zap.String("team_id", row.TeamID), zap.Error(err))
+			continue
+		}
+		if report.Drift == 0 {
+			continue
+		}
+
+		tm.logger.Warn(
+			"balance drifted from ledger",
+			zap.String("team_id", report.TeamID),
+			zap.Int64("balance", report.Balance),
+			zap.Int64("ledger_balance", report.LedgerBalance),
+			zap.Int64("drift", report.Drift),
+		)
+		drifted = append(drifted, *report)
+	}
+	return drifted, nil
+}
+
+// runLedgerReconcile runs ReconcileBalances every interval until the Manager
+// is closed, then closes done.
+func (tm *Manager) runLedgerReconcile(interval time.Duration, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tm.baseCtx.Done():
+			return
+		case <-ticker.C:
+			drifted, err := tm.ReconcileBalances(tm.baseCtx)
+			if err != nil && tm.baseCtx.Err() == nil {
+				tm.logger.Warn("failed to reconcile balances", zap.Error(err))
+				continue
+			}
+			tm.logger.Info("reconciled balances", zap.Int("drifted", len(drifted)))
+		}
+	}
+}
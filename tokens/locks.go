@@ -0,0 +1,89 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultAuctionLockTTL is how long a per-user auction lock is held before
+// it is considered abandoned, e.g. because its process crashed.
+const DefaultAuctionLockTTL = 30 * time.Second
+
+// auctionLock is a held lock on the users of one auction.
+type auctionLock struct {
+	owner   string
+	userIDs []string
+}
+
+// lockAuction takes the lock of every user bid on, so two concurrent
+// auctions can't both serve the same user, even when run by different
+// processes. A lock whose TTL has passed is taken over; the auction that
+// held it then fails to charge its winner with ErrAuctionLockLost, since
+// every charge checks the lock (see settle). If any user is already
+// locked, the locks taken so far are released and ErrAuctionInProgress is
+// returned.
+func (tm *Manager) lockAuction(ctx context.Context, bids []Bid) (*auctionLock, error) {
+	now := tm.clock.Now()
+	owner, err := tm.newID("lock_", now)
+	if err != nil {
+		return nil, err
+	}
+
+	var userIDs []string
+	for _, bid := range bids {
+		userIDs = append(userIDs, bid.UserID)
+	}
+	// a fixed order keeps auctions over the same users from deadlocking
+	slices.Sort(userIDs)
+	userIDs = slices.Compact(userIDs)
+
+	ttl := tm.auctionLockTTL
+	if ttl <= 0 {
+		ttl = DefaultAuctionLockTTL
+	}
+
+	lock := &auctionLock{owner: owner}
+	for _, userID := range userIDs {
+		err := tm.store.AcquireLock(ctx, userID, owner, now.UnixMilli(), now.Add(ttl).UnixMilli())
+		if err != nil {
+			tm.unlockAuction(ctx, lock)
+			if errors.Is(err, ErrConditionFailed) {
+				return nil, fmt.Errorf("%w: user %s", ErrAuctionInProgress, userID)
+			}
+			return nil, err
+		}
+		lock.userIDs = append(lock.userIDs, userID)
+	}
+
+	return lock, nil
+}
+
+// ref returns the lock held on userID, for a write that must only be made
+// under it. It returns nil for a nil lock, e.g. an auction that isn't
+// locked.
+func (l *auctionLock) ref(userID string) *LockRef {
+	if l == nil {
+		return nil
+	}
+	return &LockRef{UserID: userID, Owner: l.owner}
+}
+
+// unlockAuction releases the locks taken by lockAuction, unless they expired
+// and were taken over since. It runs even if ctx is cancelled, so an
+// abandoned auction doesn't hold its users until the TTL passes.
+func (tm *Manager) unlockAuction(ctx context.Context, lock *auctionLock) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortBidsTimeout)
+	defer cancel()
+
+	for _, userID := range lock.userIDs {
+		err := tm.store.ReleaseLock(ctx, userID, lock.owner)
+		if err != nil {
+			tm.logger.Warn("failed to release auction lock", zap.String("user_id", userID), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAuctionLockTakenOver(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      AuctionConfig
+		takeOver bool
+		wantErr  error
+	}{
+		{name: "charge under held lock"},
+		{name: "hold under held lock", cfg: AuctionConfig{UseHolds: true}},
+		{name: "charge after takeover", takeOver: true, wantErr: ErrAuctionLockLost},
+		{name: "hold after takeover", cfg: AuctionConfig{UseHolds: true}, takeOver: true, wantErr: ErrAuctionLockLost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := newTestClock()
+			store := NewMemoryStore()
+
+			// the veto runs after scoring and before the winner is charged,
+			// when a slow auction could outlive its lock
+			veto := func(ctx context.Context, teamID string) (bool, error) {
+				if tt.takeOver {
+					clock.Advance(DefaultAuctionLockTTL * 2)
+					now := clock.Now().UnixMilli()
+					if err := store.AcquireLock(ctx, "u", "other", now, now+1000); err != nil {
+						t.Fatalf("AcquireLock: %v", err)
+					}
+				}
+				return false, nil
+			}
+			tm := newTestManager(t, []string{"a"}, WithStore(store), WithClock(clock), WithWinnerVeto(veto))
+
+			_, err := tm.RunAuctionWithConfig(ctx, []Bid{{TeamID: "a", UserID: "u", Priority: 1}}, tt.cfg)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RunAuctionWithConfig = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				return
+			}
+			if !errors.Is(err, ErrAuctionInProgress) {
+				t.Errorf("%v doesn't match ErrAuctionInProgress", err)
+			}
+			if row := tokenRow(t, tm, "a"); row.TokenBalance != InitialTokenCount || row.HeldBalance != 0 {
+				t.Errorf("balance = %d held %d, want nothing charged", row.TokenBalance, row.HeldBalance)
+			}
+			// the lock stays with the auction that took it over
+			if err := store.AcquireLock(ctx, "u", "third", clock.Now().UnixMilli(), 0); !errors.Is(err, ErrConditionFailed) {
+				t.Errorf("AcquireLock = %v, want the taken over lock still held", err)
+			}
+		})
+	}
+}
+
+func TestAuctionLockPerUser(t *testing.T) {
+	tests := []struct {
+		name string
+		// user is who the second auction is for, while the first holds u
+		user    string
+		elapsed time.Duration
+		wantErr error
+	}{
+		{name: "same user", user: "u", wantErr: ErrAuctionInProgress},
+		{name: "other user", user: "v"},
+		{name: "same user after the lock expired", user: "u", elapsed: DefaultAuctionLockTTL * 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := newTestClock()
+
+			var (
+				tm     *Manager
+				second error
+				nested bool
+			)
+			// the second auction runs from the first's veto, while the
+			// first holds its lock
+			veto := func(ctx context.Context, teamID string) (bool, error) {
+				if nested {
+					return false, nil
+				}
+				nested = true
+				clock.Advance(tt.elapsed)
+				_, second = tm.RunAuction(ctx, []Bid{{TeamID: "b", UserID: tt.user, Priority: 1}})
+				return false, nil
+			}
+			tm = newTestManager(t, []string{"a", "b"}, WithClock(clock), WithWinnerVeto(veto))
+
+			_, first := tm.RunAuction(ctx, []Bid{{TeamID: "a", UserID: "u", Priority: 1}})
+			if !errors.Is(second, tt.wantErr) {
+				t.Errorf("second auction = %v, want %v", second, tt.wantErr)
+			}
+			// an auction whose lock was taken over can't charge its winner
+			if tt.elapsed > 0 && !errors.Is(first, ErrAuctionLockLost) {
+				t.Errorf("first auction = %v, want %v", first, ErrAuctionLockLost)
+			}
+			if tt.elapsed == 0 && first != nil {
+				t.Errorf("first auction = %v", first)
+			}
+
+			// both auctions released their locks
+			if _, err := tm.RunAuction(ctx, []Bid{{TeamID: "a", UserID: tt.user, Priority: 1}}); err != nil {
+				t.Errorf("auction after both ended = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package tokens
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a Clock tests move by hand.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestManager returns a Manager on a fresh MemoryStore with the given
+// teams initialized. opts are applied after the store, so they can wrap or
+// replace it.
+func newTestManager(t *testing.T, teams []string, opts ...Option) *Manager {
+	t.Helper()
+
+	tm, err := NewManager(append([]Option{WithStore(NewMemoryStore()), WithClock(newTestClock())}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	t.Cleanup(func() { tm.Close() })
+
+	if err := tm.InitializeTokens(context.Background(), teams); err != nil {
+		t.Fatalf("InitializeTokens: %v", err)
+	}
+	return tm
+}
+
+// tokenRow reads a team's token row straight from the Manager's store.
+func tokenRow(t *testing.T, tm *Manager, teamID string) *TokenDBRow {
+	t.Helper()
+
+	row, err := tm.store.GetTokenRow(context.Background(), teamID, true)
+	if err != nil {
+		t.Fatalf("GetTokenRow(%s): %v", teamID, err)
+	}
+	return row
+}
@@ -0,0 +1,1415 @@
+package tokens
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// MemoryStore is a Store that keeps every row in process memory, for tests
+// and local runs without DynamoDB. It is safe for concurrent use; each
+// method is atomic, so conditional writes behave as they do in DynamoDB.
+type MemoryStore struct {
+	mu          sync.Mutex
+	tokens      map[string]*TokenDBRow
+	holds       map[string]HoldRow
+	locks       map[string]memoryLock
+	idem        map[string]IdempotencyRow
+	bids        map[string]map[string]BidRow
+	auctions    map[string][]AuctionRow
+	windows     map[string]*AuctionWindow
+	dutch       map[string]DutchAuction
+	autoBids    map[string]AutoBidPolicy
+	webhooks    map[string]Webhook
+	deadLetters map[string][]WebhookDeadLetter
+	snapshots   map[string][]BalanceSnapshot
+	pacing      map[string]*PacingRow
+	quotas      map[string]*QuotaRow
+	frequency   map[string]FrequencyRow
+	transfers   map[string]TransferRow
+	adjustments map[string]AdjustmentRow
+	ledger      map[string][]LedgerEntry
+	stats       map[string]TeamStats
+	audits      map[string]AuctionAudit
+	reputation  map[string]ReputationEvent
+
+	bidArchiveWatermark int64
+}
+
+type memoryLock struct {
+	owner       string
+	expiresAtMs int64
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{}
+	s.reset()
+	return s
+}
+
+func (s *MemoryStore) reset() {
+	s.tokens = make(map[string]*TokenDBRow)
+	s.holds = make(map[string]HoldRow)
+	s.locks = make(map[string]memoryLock)
+	s.idem = make(map[string]IdempotencyRow)
+	s.bids = make(map[string]map[string]BidRow)
+	s.auctions = make(map[string][]AuctionRow)
+	s.windows = make(map[string]*AuctionWindow)
+	s.dutch = make(map[string]DutchAuction)
+	s.autoBids = make(map[string]AutoBidPolicy)
+	s.webhooks = make(map[string]Webhook)
+	s.deadLetters = make(map[string][]WebhookDeadLetter)
+	s.snapshots = make(map[string][]BalanceSnapshot)
+	s.pacing = make(map[string]*PacingRow)
+	s.quotas = make(map[string]*QuotaRow)
+	s.frequency = make(map[string]FrequencyRow)
+	s.transfers = make(map[string]TransferRow)
+	s.adjustments = make(map[string]AdjustmentRow)
+	s.ledger = make(map[string][]LedgerEntry)
+	s.stats = make(map[string]TeamStats)
+	s.audits = make(map[string]AuctionAudit)
+	s.reputation = make(map[string]ReputationEvent)
+	s.bidArchiveWatermark = 0
+}
+
+// appendLedger records entries in the ledger, leaving out any that don't
+// move the balance. s.mu must be held.
+func (s *MemoryStore) appendLedger(entries ...*LedgerEntry) {
+	for _, entry := range entries {
+		if entry.Delta != 0 {
+			s.ledger[entry.TeamID] = append(s.ledger[entry.TeamID], *entry)
+		}
+	}
+}
+
+// cloneTokenRow copies row so callers can't mutate the stored one.
+func cloneTokenRow(row *TokenDBRow) *TokenDBRow {
+	c := *row
+	c.PriorityUsage = maps.Clone(row.PriorityUsage)
+	c.Balances = maps.Clone(row.Balances)
+	return &c
+}
+
+func (s *MemoryStore) EnsureSchema(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) Truncate(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reset()
+	return nil
+}
+
+func (s *MemoryStore) GetTokenRow(ctx context.Context, teamID string, consistent bool) (*TokenDBRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.tokens[teamID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTeamNotFound, teamID)
+	}
+	return cloneTokenRow(row), nil
+}
+
+func (s *MemoryStore) BatchGetTokenRows(ctx context.Context, teamIDs []string) (map[string]TokenDBRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows := make(map[string]TokenDBRow, len(teamIDs))
+	for _, teamID := range teamIDs {
+		if row, ok := s.tokens[teamID]; ok {
+			rows[teamID] = *cloneTokenRow(row)
+		}
+	}
+	return rows, nil
+}
+
+// EnsureTokenRow treats a zero attribute of an existing row as missing.
+func (s *MemoryStore) EnsureTokenRow(ctx context.Context, row *TokenDBRow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.tokens[row.TeamID]
+	if !ok {
+		entry, err := newLedgerEntry(row.TeamID, LedgerOpen, row.TokenBalance, "", row.CreatedAtMs)
+		if err != nil {
+			return err
+		}
+		created := cloneTokenRow(row)
+		created.Pk = GetTokenPK(row.TeamID)
+		created.Version = 1
+		s.tokens[row.TeamID] = created
+		s.appendLedger(entry)
+		return nil
+	}
+
+	if existing.PriorityUsage == nil {
+		existing.PriorityUsage = maps.Clone(row.PriorityUsage)
+	}
+	for currency, balance := range row.Balances {
+		if _, ok := existing.Balances[currency]; !ok {
+			if existing.Balances == nil {
+				existing.Balances = make(map[string]int64)
+			}
+			existing.Balances[currency] = balance
+		}
+	}
+	if existing.LastRefillTime == 0 {
+		existing.LastRefillTime = row.LastRefillTime
+	}
+	if existing.LastReputationRecoveryMs == 0 {
+		existing.LastReputationRecoveryMs = row.LastReputationRecoveryMs
+	}
+	if existing.CreatedAtMs == 0 {
+		existing.CreatedAtMs = row.CreatedAtMs
+	}
+	existing.UpdatedAtMs = row.UpdatedAtMs
+	return nil
+}
+
+func (s *MemoryStore) RefillTokenRow(ctx context.Context, teamID string, balance, observed int64, balances map[string]int64, usage map[int]int, reputation, nowMs int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.tokens[teamID]
+	if ok && row.TokenBalance != observed || !ok && observed != 0 {
+		return &ConditionFailedError{}
+	}
+	entry, err := newLedgerEntry(teamID, LedgerRefill, balance-observed, "", nowMs)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		row = &TokenDBRow{Pk: GetTokenPK(teamID)}
+		s.tokens[teamID] = row
+	}
+	s.appendLedger(entry)
+	row.TokenBalance = balance
+	if balances != nil {
+		row.Balances = maps.Clone(balances)
+	}
+	row.PriorityUsage = maps.Clone(usage)
+	row.ReputationScore = reputation
+	row.LastRefillTime = nowMs
+	row.Version++
+	return nil
+}
+
+func (s *MemoryStore) DripTokenRow(ctx context.Context, teamID string, credit, observedMs, refillMs int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.tokens[teamID]
+	if !ok || row.LastRefillTime != observedMs {
+		return &ConditionFailedError{}
+	}
+	entry, err := newLedgerEntry(teamID, LedgerDrip, credit, "", refillMs)
+	if err != nil {
+		return err
+	}
+
+	s.appendLedger(entry)
+	row.TokenBalance += credit
+	row.LastRefillTime = refillMs
+	row.Version++
+	return nil
+}
+
+func (s *MemoryStore) CreateTokenRow(ctx context.Context, row *TokenDBRow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[row.TeamID]; ok {
+		return s.conditionFailed(row.TeamID)
+	}
+	entry, err := newLedgerEntry(row.TeamID, LedgerOpen, row.TokenBalance, "", row.CreatedAtMs)
+	if err != nil {
+		return err
+	}
+
+	created := cloneTokenRow(row)
+	created.Pk = GetTokenPK(row.TeamID)
+	created.Version = 1
+	s.tokens[row.TeamID] = created
+	s.appendLedger(entry)
+	return nil
+}
+
+func (s *MemoryStore) SetTeamStatus(ctx context.Context, u TeamStatusUpdate) (*TokenDBRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.tokens[u.TeamID]
+	if !ok || !slices.Contains(u.From, row.status()) {
+		return nil, s.conditionFailed(u.TeamID)
+	}
+
+	row.Status = u.Status
+	row.StatusReason = u.Reason
+	row.StatusChangedAtMs = u.NowMs
+	row.UpdatedAtMs = u.NowMs
+	return cloneTokenRow(row), nil
+}
+
+func (s *MemoryStore) DeleteTeam(ctx context.Context, teamID string, observed, nowMs int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.tokens[teamID]
+	if !ok || row.TokenBalance != observed {
+		return &ConditionFailedError{}
+	}
+	entry, err := newLedgerEntry(teamID, LedgerClose, -observed, "", nowMs)
+	if err != nil {
+		return err
+	}
+
+	s.appendLedger(entry)
+	delete(s.tokens, teamID)
+	delete(s.autoBids, teamID)
+	delete(s.webhooks, teamID)
+	delete(s.pacing, teamID)
+	delete(s.quotas, teamID)
+	delete(s.stats, teamID)
+	return nil
+}
+
+func (s *MemoryStore) ScanTokenRows(ctx context.Context) ([]TokenDBRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows := make([]TokenDBRow, 0, len(s.tokens))
+	for _, row := range s.tokens {
+		rows = append(rows, *cloneTokenRow(row))
+	}
+	slices.SortFunc(rows, func(a, b TokenDBRow) int {
+		return strings.Compare(a.TeamID, b.TeamID)
+	})
+	return rows, nil
+}
+
+func (s *MemoryStore) UpdateBalance(ctx context.Context, u BalanceUpdate) (*TokenDBRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spend, err := s.checkBalanceUpdate(u)
+	if err != nil {
+		return nil, err
+	}
+	return s.applyBalanceUpdate(u, spend), nil
+}
+
+func (s *MemoryStore) UpdateBalances(ctx context.Context, updates []BalanceUpdate) ([]*TokenDBRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spends := make([]memorySpend, len(updates))
+	seen := make(map[string]bool, len(updates))
+	for i, u := range updates {
+		if seen[u.TeamID] {
+			return nil, fmt.Errorf("team %s updated twice in one transaction", u.TeamID)
+		}
+		seen[u.TeamID] = true
+
+		spend, err := s.checkBalanceUpdate(u)
+		if errors.Is(err, ErrConditionFailed) || errors.Is(err, ErrAuctionLockLost) {
+			// like a cancelled transaction, which doesn't say which failed
+			return nil, &ConditionFailedError{}
+		}
+		if err != nil {
+			return nil, err
+		}
+		spends[i] = spend
+	}
+
+	rows := make([]*TokenDBRow, len(updates))
+	for i, u := range updates {
+		rows[i] = s.applyBalanceUpdate(u, spends[i])
+	}
+	return rows, nil
+}
+
+// memorySpend is a checked BalanceUpdate, ready to apply.
+type memorySpend struct {
+	amount   int64
+	reserved int64
+	entry    *LedgerEntry
+}
+
+// checkBalanceUpdate checks the conditions of u without applying it. s.mu
+// must be held.
+func (s *MemoryStore) checkBalanceUpdate(u BalanceUpdate) (memorySpend, error) {
+	if err := s.checkLock(u.Lock); err != nil {
+		return memorySpend{}, err
+	}
+	amount, reserved, ok := s.reserved(u.Amount, u.Reservation)
+	if !ok {
+		return memorySpend{}, &ConditionFailedError{}
+	}
+
+	row, ok := s.tokens[u.TeamID]
+	if !ok || !canSpend(row, u.Currency, amount, u.Win, u.CooldownStartMs) ||
+		u.Version != nil && row.Version != *u.Version {
+		return memorySpend{}, s.conditionFailed(u.TeamID)
+	}
+	spend := memorySpend{amount: amount, reserved: reserved}
+	if u.Currency == "" {
+		var err error
+		spend.entry, err = newLedgerEntry(u.TeamID, LedgerSpend, -amount, bidRef(u.WinningBid), u.NowMs)
+		if err != nil {
+			return memorySpend{}, err
+		}
+	}
+	return spend, nil
+}
+
+// applyBalanceUpdate applies u, checked by checkBalanceUpdate, and returns
+// the token row after it. s.mu must be held.
+func (s *MemoryStore) applyBalanceUpdate(u BalanceUpdate, spend memorySpend) *TokenDBRow {
+	row := s.tokens[u.TeamID]
+	amount, reserved, entry := spend.amount, spend.reserved, spend.entry
+
+	if u.Reservation != nil {
+		delete(s.holds, u.Reservation.HoldID)
+		row.HeldBalance -= reserved
+	}
+	if u.Currency == "" {
+		s.appendLedger(entry)
+		row.TokenBalance -= amount
+	} else {
+		row.Balances[u.Currency] -= amount
+	}
+	if row.PriorityUsage == nil {
+		row.PriorityUsage = make(map[int]int)
+	}
+	row.PriorityUsage[int(u.Priority)]++
+	row.UpdatedAtMs = u.NowMs
+	row.Version++
+	if u.Win {
+		row.LastWinAtMs = u.NowMs
+		row.WinCount++
+	}
+	if u.WinningBid != nil {
+		s.putBid(u.WinningBid)
+	}
+	return cloneTokenRow(row)
+}
+
+// reserved returns what is left of amount to take from the balance once
+// reservation, if any, is released, along with the reservation's amount. It
+// reports false if the reservation no longer exists. s.mu must be held.
+func (s *MemoryStore) reserved(amount int64, reservation *HoldRow) (int64, int64, bool) {
+	if reservation == nil {
+		return amount, 0, true
+	}
+	stored, ok := s.holds[reservation.HoldID]
+	if !ok {
+		return 0, 0, false
+	}
+	return amount - stored.Amount, stored.Amount, true
+}
+
+// canSpend is the condition on UpdateBalance and PlaceHold.
+func canSpend(row *TokenDBRow, currency string, amount int64, win bool, cooldownStartMs int64) bool {
+	if _, ok := row.Balances[currency]; currency != "" && !ok {
+		// like DynamoDB, a missing balance covers nothing
+		return false
+	}
+	if row.balanceIn(currency) < amount {
+		return false
+	}
+	return !win || cooldownStartMs == 0 || row.LastWinAtMs <= cooldownStartMs
+}
+
+// conditionFailed returns the error for a failed condition on a team's
+// token row. s.mu must be held.
+func (s *MemoryStore) conditionFailed(teamID string) error {
+	if row, ok := s.tokens[teamID]; ok {
+		return &ConditionFailedError{Row: cloneTokenRow(row)}
+	}
+	return &ConditionFailedError{}
+}
+
+func (s *MemoryStore) CountAuctionEntry(ctx context.Context, teamID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.tokens[teamID]
+	if !ok {
+		return &ConditionFailedError{}
+	}
+	row.AuctionCount++
+	return nil
+}
+
+func (s *MemoryStore) BatchGetFrequencyRows(ctx context.Context, userID string, teamIDs []string) (map[string]FrequencyRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows := make(map[string]FrequencyRow, len(teamIDs))
+	for _, teamID := range teamIDs {
+		pk := GetFrequencyPK(teamID, userID)
+		row, ok := s.frequency[pk]
+		if !ok {
+			row = FrequencyRow{Pk: pk, TeamID: teamID, UserID: userID}
+		}
+		row.WinTimesMs = slices.Clone(row.WinTimesMs)
+		rows[teamID] = row
+	}
+	return rows, nil
+}
+
+func (s *MemoryStore) PutFrequencyRow(ctx context.Context, row *FrequencyRow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *row
+	stored.WinTimesMs = slices.Clone(row.WinTimesMs)
+	s.frequency[row.Pk] = stored
+	return nil
+}
+
+func (s *MemoryStore) GetPacingRow(ctx context.Context, teamID string) (*PacingRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if row, ok := s.pacing[teamID]; ok {
+		stored := *row
+		return &stored, nil
+	}
+	return &PacingRow{Pk: GetPacingPK(teamID), TeamID: teamID}, nil
+}
+
+func (s *MemoryStore) AddPacedSpend(ctx context.Context, teamID string, amount, windowStartMs, limit int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.pacing[teamID]
+	if !ok || row.WindowStartMs != windowStartMs || row.Spent+amount > limit {
+		return &ConditionFailedError{}
+	}
+	row.Spent += amount
+	return nil
+}
+
+func (s *MemoryStore) RollPacingWindow(ctx context.Context, teamID string, observedStartMs, windowStartMs, prevSpent, spent int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var observed int64
+	if row, ok := s.pacing[teamID]; ok {
+		observed = row.WindowStartMs
+	}
+	if observed != observedStartMs {
+		return &ConditionFailedError{}
+	}
+	s.pacing[teamID] = &PacingRow{
+		Pk:            GetPacingPK(teamID),
+		TeamID:        teamID,
+		WindowStartMs: windowStartMs,
+		Spent:         spent,
+		PrevSpent:     prevSpent,
+	}
+	return nil
+}
+
+func (s *MemoryStore) RefundPacedSpend(ctx context.Context, teamID string, amount, windowStartMs int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.pacing[teamID]
+	if !ok || row.WindowStartMs != windowStartMs {
+		return &ConditionFailedError{}
+	}
+	row.Spent -= amount
+	return nil
+}
+
+func (s *MemoryStore) GetQuotaRow(ctx context.Context, teamID string) (*QuotaRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if row, ok := s.quotas[teamID]; ok {
+		stored := *row
+		stored.Usage = maps.Clone(row.Usage)
+		return &stored, nil
+	}
+	return &QuotaRow{Pk: GetQuotaPK(teamID), TeamID: teamID}, nil
+}
+
+func (s *MemoryStore) AddQuotaUsage(ctx context.Context, teamID string, priority, dayStartMs int64, limit int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.quotas[teamID]
+	if !ok || row.DayStartMs != dayStartMs || (limit > 0 && row.Usage[int(priority)] >= limit) {
+		return &ConditionFailedError{}
+	}
+	row.Usage[int(priority)]++
+	return nil
+}
+
+func (s *MemoryStore) RollQuotaDay(ctx context.Context, teamID string, observedStartMs, dayStartMs, priority int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var observed int64
+	if row, ok := s.quotas[teamID]; ok {
+		observed = row.DayStartMs
+	}
+	if observed != observedStartMs {
+		return &ConditionFailedError{}
+	}
+	s.quotas[teamID] = &QuotaRow{
+		Pk:         GetQuotaPK(teamID),
+		TeamID:     teamID,
+		DayStartMs: dayStartMs,
+		Usage:      map[int]int{int(priority): 1},
+	}
+	return nil
+}
+
+func (s *MemoryStore) RefundQuotaUsage(ctx context.Context, teamID string, priority, dayStartMs int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.quotas[teamID]
+	if !ok || row.DayStartMs != dayStartMs || row.Usage[int(priority)] <= 0 {
+		return &ConditionFailedError{}
+	}
+	row.Usage[int(priority)]--
+	return nil
+}
+
+func (s *MemoryStore) SetTokenBalance(ctx context.Context, teamID string, balance, observed, nowMs int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.tokens[teamID]
+	if !ok || row.TokenBalance != observed {
+		return &ConditionFailedError{}
+	}
+	entry, err := newLedgerEntry(teamID, LedgerCorrection, balance-observed, "", nowMs)
+	if err != nil {
+		return err
+	}
+
+	s.appendLedger(entry)
+	row.TokenBalance = balance
+	row.Version++
+	return nil
+}
+
+func (s *MemoryStore) AdjustReputation(ctx context.Context, e *ReputationEvent, observed *TokenDBRow, floor, ceiling int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.tokens[e.TeamID]
+	if !ok || row.Version != observed.Version {
+		return &ConditionFailedError{}
+	}
+	if _, ok := s.reputation[e.Pk]; ok && e.DedupeKey != "" {
+		return fmt.Errorf("%w: %s", ErrDuplicateReputationEvent, e.DedupeKey)
+	}
+
+	e.Reputation = clampReputation(observed.ReputationScore, e.Delta, floor, ceiling)
+	e.Delta = e.Reputation - observed.ReputationScore
+	row.ReputationScore = e.Reputation
+	row.Version++
+	if e.DedupeKey != "" {
+		s.reputation[e.Pk] = *e
+	}
+	return nil
+}
+
+func (s *MemoryStore) RecoverReputation(ctx context.Context, teamID string, increase, ceiling, observedMs, recoveredMs int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.tokens[teamID]
+	if !ok || row.LastReputationRecoveryMs != observedMs {
+		return &ConditionFailedError{}
+	}
+	if increase > 0 && row.ReputationScore > ceiling-increase {
+		return &ConditionFailedError{}
+	}
+	row.ReputationScore += increase
+	row.LastReputationRecoveryMs = recoveredMs
+	row.Version++
+	return nil
+}
+
+func (s *MemoryStore) TransferTokens(ctx context.Context, t *TransferRow) (*TokenDBRow, *TokenDBRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, ok := s.tokens[t.FromTeamID]
+	if !ok || !canSpend(from, "", t.Amount, false, 0) {
+		return nil, nil, s.conditionFailed(t.FromTeamID)
+	}
+	to, ok := s.tokens[t.ToTeamID]
+	if !ok {
+		return nil, nil, &ConditionFailedError{}
+	}
+	if _, ok := s.transfers[t.TransferID]; ok {
+		return nil, nil, &ConditionFailedError{}
+	}
+	debit, err := newLedgerEntry(t.FromTeamID, LedgerTransfer, -t.Amount, t.TransferID, t.CreatedAtMs)
+	if err != nil {
+		return nil, nil, err
+	}
+	credit, err := newLedgerEntry(t.ToTeamID, LedgerTransfer, t.Amount, t.TransferID, t.CreatedAtMs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.appendLedger(debit, credit)
+
+	from.TokenBalance -= t.Amount
+	from.UpdatedAtMs = t.CreatedAtMs
+	from.Version++
+	to.TokenBalance += t.Amount
+	to.UpdatedAtMs = t.CreatedAtMs
+	to.Version++
+	s.transfers[t.TransferID] = *t
+	return cloneTokenRow(from), cloneTokenRow(to), nil
+}
+
+func (s *MemoryStore) AdjustBalance(ctx context.Context, a *AdjustmentRow) (*TokenDBRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.tokens[a.TeamID]
+	if !ok || !canSpend(row, "", -a.Delta, false, 0) {
+		return nil, s.conditionFailed(a.TeamID)
+	}
+	if _, ok := s.adjustments[a.AdjustmentID]; ok {
+		return nil, &ConditionFailedError{}
+	}
+	entry, err := newLedgerEntry(a.TeamID, LedgerAdjustment, a.Delta, a.AdjustmentID, a.CreatedAtMs)
+	if err != nil {
+		return nil, err
+	}
+
+	s.appendLedger(entry)
+
+	row.TokenBalance += a.Delta
+	row.UpdatedAtMs = a.CreatedAtMs
+	row.Version++
+	s.adjustments[a.AdjustmentID] = *a
+	return cloneTokenRow(row), nil
+}
+
+func (s *MemoryStore) PlaceHold(ctx context.Context, hold *HoldRow, cooldownStartMs int64, winningBid *BidRow, reservation *HoldRow, lock *LockRef) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkLock(lock); err != nil {
+		return err
+	}
+	amount, _, ok := s.reserved(hold.Amount, reservation)
+	if !ok {
+		return &ConditionFailedError{}
+	}
+
+	row, ok := s.tokens[hold.TeamID]
+	if !ok || !canSpend(row, "", amount, true, cooldownStartMs) {
+		return s.conditionFailed(hold.TeamID)
+	}
+	if _, ok := s.holds[hold.HoldID]; ok {
+		return &ConditionFailedError{}
+	}
+	entry, err := newLedgerEntry(hold.TeamID, LedgerHold, -amount, hold.HoldID, hold.CreatedAtMs)
+	if err != nil {
+		return err
+	}
+
+	s.appendLedger(entry)
+	if reservation != nil {
+		delete(s.holds, reservation.HoldID)
+	}
+	row.TokenBalance -= amount
+	row.HeldBalance += amount
+	row.LastWinAtMs = hold.CreatedAtMs
+	row.WinCount++
+	row.Version++
+	s.holds[hold.HoldID] = *hold
+	if winningBid != nil {
+		s.putBid(winningBid)
+	}
+	return nil
+}
+
+func (s *MemoryStore) ReserveTokens(ctx context.Context, hold *HoldRow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.tokens[hold.TeamID]
+	if !ok || !canSpend(row, "", hold.Amount, false, 0) {
+		return s.conditionFailed(hold.TeamID)
+	}
+	if _, ok := s.holds[hold.HoldID]; ok {
+		return &ConditionFailedError{}
+	}
+	entry, err := newLedgerEntry(hold.TeamID, LedgerHold, -hold.Amount, hold.HoldID, hold.CreatedAtMs)
+	if err != nil {
+		return err
+	}
+
+	s.appendLedger(entry)
+	row.TokenBalance -= hold.Amount
+	row.HeldBalance += hold.Amount
+	row.Version++
+	s.holds[hold.HoldID] = *hold
+	return nil
+}
+
+func (s *MemoryStore) GetHold(ctx context.Context, holdID string) (*HoldRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hold, ok := s.holds[holdID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrHoldNotFound, holdID)
+	}
+	return &hold, nil
+}
+
+func (s *MemoryStore) ConfirmHold(ctx context.Context, hold *HoldRow, nowMs int64) (*TokenDBRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.holds[hold.HoldID]
+	row, rowOK := s.tokens[hold.TeamID]
+	if !ok || !rowOK || stored.ExpiresAtMs <= nowMs {
+		return nil, &ConditionFailedError{}
+	}
+
+	delete(s.holds, hold.HoldID)
+	row.HeldBalance -= stored.Amount
+	if row.PriorityUsage == nil {
+		row.PriorityUsage = make(map[int]int)
+	}
+	row.PriorityUsage[int(stored.Priority)]++
+	row.Version++
+	return cloneTokenRow(row), nil
+}
+
+func (s *MemoryStore) ReleaseHold(ctx context.Context, hold *HoldRow, nowMs int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.holds[hold.HoldID]
+	if !ok {
+		return &ConditionFailedError{}
+	}
+	entry, err := newLedgerEntry(hold.TeamID, LedgerRelease, stored.Amount, hold.HoldID, nowMs)
+	if err != nil {
+		return err
+	}
+
+	delete(s.holds, hold.HoldID)
+	if row, ok := s.tokens[hold.TeamID]; ok {
+		s.appendLedger(entry)
+		row.TokenBalance += stored.Amount
+		row.HeldBalance -= stored.Amount
+		row.Version++
+	}
+	return nil
+}
+
+func (s *MemoryStore) ExpiredHolds(ctx context.Context, nowMs int64) ([]HoldRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var holds []HoldRow
+	for _, hold := range s.holds {
+		if hold.ExpiresAtMs <= nowMs {
+			holds = append(holds, hold)
+		}
+	}
+	slices.SortFunc(holds, func(a, b HoldRow) int {
+		return strings.Compare(a.HoldID, b.HoldID)
+	})
+	return holds, nil
+}
+
+func (s *MemoryStore) PutAuctionWindow(ctx context.Context, w *AuctionWindow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.windows[w.AuctionID]; ok {
+		return &ConditionFailedError{}
+	}
+	s.windows[w.AuctionID] = cloneAuctionWindow(w)
+	return nil
+}
+
+func (s *MemoryStore) GetAuctionWindow(ctx context.Context, auctionID string) (*AuctionWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.windows[auctionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAuctionWindowNotFound, auctionID)
+	}
+	return cloneAuctionWindow(w), nil
+}
+
+func (s *MemoryStore) AddWindowBid(ctx context.Context, auctionID string, bid WindowBid, nowMs int64, maxBids int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.windows[auctionID]
+	if !ok || w.State != AuctionWindowOpen || w.DeadlineMs <= nowMs || len(w.Bids) >= maxBids {
+		return &ConditionFailedError{}
+	}
+	w.Bids = append(w.Bids, bid)
+	return nil
+}
+
+func (s *MemoryStore) SettleAuctionWindow(ctx context.Context, auctionID string, result *AuctionResult, nowMs int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.windows[auctionID]
+	if !ok || w.State != AuctionWindowOpen {
+		return &ConditionFailedError{}
+	}
+	w.State = AuctionWindowSettled
+	w.Result = result
+	w.SettledAtMs = nowMs
+	return nil
+}
+
+func (s *MemoryStore) DueAuctionWindows(ctx context.Context, nowMs int64) ([]AuctionWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var windows []AuctionWindow
+	for _, w := range s.windows {
+		if w.State == AuctionWindowOpen && w.DeadlineMs <= nowMs {
+			windows = append(windows, *cloneAuctionWindow(w))
+		}
+	}
+	slices.SortFunc(windows, func(a, b AuctionWindow) int {
+		return cmp.Compare(a.DeadlineMs, b.DeadlineMs)
+	})
+	return windows, nil
+}
+
+// cloneAuctionWindow copies w so callers can't mutate the stored one.
+func cloneAuctionWindow(w *AuctionWindow) *AuctionWindow {
+	c := *w
+	c.Bids = slices.Clone(w.Bids)
+	return &c
+}
+
+func (s *MemoryStore) PutDutchAuction(ctx context.Context, a *DutchAuction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.dutch[a.AuctionID]; ok {
+		return &ConditionFailedError{}
+	}
+	s.dutch[a.AuctionID] = *a
+	return nil
+}
+
+func (s *MemoryStore) GetDutchAuction(ctx context.Context, auctionID string) (*DutchAuction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.dutch[auctionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrDutchAuctionNotFound, auctionID)
+	}
+	return &a, nil
+}
+
+func (s *MemoryStore) ClaimDutchAuction(ctx context.Context, auctionID, teamID string, price, nowMs int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.dutch[auctionID]
+	if !ok || a.State != DutchAuctionOpen || a.DeadlineMs <= nowMs {
+		return &ConditionFailedError{}
+	}
+	a.State, a.TeamID, a.Price, a.SoldAtMs = DutchAuctionSold, teamID, price, nowMs
+	s.dutch[auctionID] = a
+	return nil
+}
+
+func (s *MemoryStore) ReleaseDutchAuction(ctx context.Context, auctionID, teamID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.dutch[auctionID]
+	if !ok || a.State != DutchAuctionSold || a.TeamID != teamID {
+		return &ConditionFailedError{}
+	}
+	a.State, a.TeamID, a.Price, a.SoldAtMs = DutchAuctionOpen, "", 0, 0
+	s.dutch[auctionID] = a
+	return nil
+}
+
+func (s *MemoryStore) PutAutoBidPolicy(ctx context.Context, p *AutoBidPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.autoBids[p.TeamID] = cloneAutoBidPolicy(*p)
+	return nil
+}
+
+func (s *MemoryStore) GetAutoBidPolicy(ctx context.Context, teamID string) (*AutoBidPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.autoBids[teamID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAutoBidPolicyNotFound, teamID)
+	}
+	p = cloneAutoBidPolicy(p)
+	return &p, nil
+}
+
+func (s *MemoryStore) DeleteAutoBidPolicy(ctx context.Context, teamID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.autoBids[teamID]; !ok {
+		return fmt.Errorf("%w: %s", ErrAutoBidPolicyNotFound, teamID)
+	}
+	delete(s.autoBids, teamID)
+	return nil
+}
+
+func (s *MemoryStore) ListAutoBidPolicies(ctx context.Context) ([]AutoBidPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policies := make([]AutoBidPolicy, 0, len(s.autoBids))
+	for _, p := range s.autoBids {
+		policies = append(policies, cloneAutoBidPolicy(p))
+	}
+	slices.SortFunc(policies, func(a, b AutoBidPolicy) int {
+		return strings.Compare(a.TeamID, b.TeamID)
+	})
+	return policies, nil
+}
+
+// cloneAutoBidPolicy copies p so callers can't mutate the stored one.
+func cloneAutoBidPolicy(p AutoBidPolicy) AutoBidPolicy {
+	p.UserIDs = slices.Clone(p.UserIDs)
+	return p
+}
+
+func (s *MemoryStore) AcquireLock(ctx context.Context, userID, owner string, nowMs, expiresAtMs int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lock, ok := s.locks[userID]; ok && lock.expiresAtMs >= nowMs {
+		return &ConditionFailedError{}
+	}
+	s.locks[userID] = memoryLock{owner: owner, expiresAtMs: expiresAtMs}
+	return nil
+}
+
+func (s *MemoryStore) ReleaseLock(ctx context.Context, userID, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lock, ok := s.locks[userID]; ok && lock.owner == owner {
+		delete(s.locks, userID)
+	}
+	return nil
+}
+
+// checkLock fails with ErrAuctionLockLost unless lock is nil or still held
+// by its owner. s.mu must be held.
+func (s *MemoryStore) checkLock(lock *LockRef) error {
+	if lock == nil {
+		return nil
+	}
+	if held, ok := s.locks[lock.UserID]; !ok || held.owner != lock.Owner {
+		return fmt.Errorf("%w: user %s", ErrAuctionLockLost, lock.UserID)
+	}
+	return nil
+}
+
+func (s *MemoryStore) ClaimIdempotencyKey(ctx context.Context, row *IdempotencyRow, nowMs int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.idem[row.Key]; ok && existing.ExpiresAtMs >= nowMs {
+		return &ConditionFailedError{}
+	}
+	s.idem[row.Key] = *row
+	return nil
+}
+
+func (s *MemoryStore) GetIdempotencyRow(ctx context.Context, key string) (*IdempotencyRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.idem[key]
+	if !ok {
+		return nil, nil
+	}
+	if row.Result != nil {
+		result := *row.Result
+		row.Result = &result
+	}
+	return &row, nil
+}
+
+func (s *MemoryStore) PutIdempotencyRow(ctx context.Context, row *IdempotencyRow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *row
+	if row.Result != nil {
+		result := *row.Result
+		stored.Result = &result
+	}
+	s.idem[row.Key] = stored
+	return nil
+}
+
+func (s *MemoryStore) DeleteIdempotencyRow(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.idem, key)
+	return nil
+}
+
+func (s *MemoryStore) PutBids(ctx context.Context, rows []*BidRow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, br := range rows {
+		s.putBid(br)
+	}
+	return nil
+}
+
+// putBid stores a copy of br. s.mu must be held.
+func (s *MemoryStore) putBid(br *BidRow) {
+	partition, ok := s.bids[br.Pk]
+	if !ok {
+		partition = make(map[string]BidRow)
+		s.bids[br.Pk] = partition
+	}
+	partition[br.Sk] = *br
+}
+
+// MarkBidAborted, like a DynamoDB update, is not an error for a bid that
+// isn't stored; it is stored with only its keys.
+func (s *MemoryStore) MarkBidAborted(ctx context.Context, pk, sk string, nowMs int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	br, ok := s.bids[pk][sk]
+	if !ok {
+		br = BidRow{Pk: pk, Sk: sk}
+	}
+	br.Aborted = true
+	br.UpdatedAtMs = nowMs
+	s.putBid(&br)
+	return nil
+}
+
+func (s *MemoryStore) QueryBids(ctx context.Context, q BidQuery) ([]BidRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var bids []BidRow
+	for _, br := range s.bids[q.Pk] {
+		switch {
+		case q.NewestFirst:
+		case q.AfterSk != "":
+			if br.Sk <= q.AfterSk {
+				continue
+			}
+		case !strings.HasPrefix(br.Sk, q.SkPrefix):
+			continue
+		}
+		if q.WonOnly && !br.Won {
+			continue
+		}
+		if !q.Filter.matches(&br) {
+			continue
+		}
+		bids = append(bids, br)
+	}
+
+	if q.NewestFirst {
+		slices.SortFunc(bids, func(a, b BidRow) int {
+			return cmp.Or(cmp.Compare(b.CreatedAtMs, a.CreatedAtMs), strings.Compare(b.Sk, a.Sk))
+		})
+	} else {
+		slices.SortFunc(bids, func(a, b BidRow) int {
+			return strings.Compare(a.Sk, b.Sk)
+		})
+	}
+
+	if q.Limit > 0 && len(bids) > q.Limit {
+		bids = bids[:q.Limit]
+	}
+	return bids, nil
+}
+
+func (s *MemoryStore) QueryBidsByTarget(ctx context.Context, userID string) ([]BidRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var bids []BidRow
+	for _, partition := range s.bids {
+		for _, br := range partition {
+			if br.Target == userID {
+				bids = append(bids, br)
+			}
+		}
+	}
+
+	slices.SortFunc(bids, func(a, b BidRow) int {
+		return cmp.Or(cmp.Compare(a.CreatedAtMs, b.CreatedAtMs), strings.Compare(a.Pk, b.Pk), strings.Compare(a.Sk, b.Sk))
+	})
+	return bids, nil
+}
+
+// QueryExpiringBids returns bids by ExpiresAt. Like the DynamoDB index, it
+// skips bids without an expiry bucket; unlike DynamoDB, the MemoryStore
+// never deletes expired bids.
+func (s *MemoryStore) QueryExpiringBids(ctx context.Context, fromSec, toSec int64) ([]BidRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var bids []BidRow
+	for _, partition := range s.bids {
+		for _, br := range partition {
+			if br.ExpiryBucket != "" && br.ExpiresAt >= fromSec && br.ExpiresAt < toSec {
+				bids = append(bids, br)
+			}
+		}
+	}
+	return bids, nil
+}
+
+func (s *MemoryStore) GetBidArchiveWatermark(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bidArchiveWatermark, nil
+}
+
+func (s *MemoryStore) AdvanceBidArchiveWatermark(ctx context.Context, fromSec, toSec int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.bidArchiveWatermark != fromSec {
+		return &ConditionFailedError{}
+	}
+	s.bidArchiveWatermark = toSec
+	return nil
+}
+
+func (s *MemoryStore) DeleteBids(ctx context.Context, pk string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := len(s.bids[pk])
+	delete(s.bids, pk)
+	return deleted, nil
+}
+
+func (s *MemoryStore) PutWebhook(ctx context.Context, w *Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.webhooks[w.TeamID] = *w
+	return nil
+}
+
+func (s *MemoryStore) GetWebhook(ctx context.Context, teamID string) (*Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.webhooks[teamID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrWebhookNotFound, teamID)
+	}
+	return &w, nil
+}
+
+func (s *MemoryStore) DeleteWebhook(ctx context.Context, teamID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[teamID]; !ok {
+		return fmt.Errorf("%w: %s", ErrWebhookNotFound, teamID)
+	}
+	delete(s.webhooks, teamID)
+	return nil
+}
+
+func (s *MemoryStore) PutWebhookDeadLetter(ctx context.Context, d *WebhookDeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deadLetters[d.TeamID] = append(s.deadLetters[d.TeamID], *d)
+	return nil
+}
+
+func (s *MemoryStore) QueryWebhookDeadLetters(ctx context.Context, teamID string) ([]WebhookDeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.deadLetters[teamID]), nil
+}
+
+func (s *MemoryStore) PutAuctionAudit(ctx context.Context, a *AuctionAudit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.audits[a.AuctionID]; ok {
+		return &ConditionFailedError{}
+	}
+	s.audits[a.AuctionID] = cloneAuctionAudit(*a)
+	return nil
+}
+
+func (s *MemoryStore) GetAuctionAudit(ctx context.Context, auctionID string) (*AuctionAudit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.audits[auctionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAuctionAuditNotFound, auctionID)
+	}
+	a = cloneAuctionAudit(a)
+	return &a, nil
+}
+
+func cloneAuctionAudit(a AuctionAudit) AuctionAudit {
+	a.Bids = slices.Clone(a.Bids)
+	a.Results = slices.Clone(a.Results)
+	return a
+}
+
+func (s *MemoryStore) PutTeamStats(ctx context.Context, stats []TeamStats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ts := range stats {
+		s.stats[ts.TeamID] = cloneTeamStats(ts)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetTeamStats(ctx context.Context, teamID string) (*TeamStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts, ok := s.stats[teamID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTeamStatsNotFound, teamID)
+	}
+	ts = cloneTeamStats(ts)
+	return &ts, nil
+}
+
+func (s *MemoryStore) ScanTeamStats(ctx context.Context) ([]TeamStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]TeamStats, 0, len(s.stats))
+	for _, ts := range s.stats {
+		stats = append(stats, cloneTeamStats(ts))
+	}
+	slices.SortFunc(stats, func(a, b TeamStats) int {
+		return strings.Compare(a.TeamID, b.TeamID)
+	})
+	return stats, nil
+}
+
+func cloneTeamStats(ts TeamStats) TeamStats {
+	ts.SpentByPriority = maps.Clone(ts.SpentByPriority)
+	return ts
+}
+
+func (s *MemoryStore) PutAuction(ctx context.Context, row *AuctionRow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *row
+	stored.TeamIDs = slices.Clone(row.TeamIDs)
+	stored.Results = slices.Clone(row.Results)
+	s.auctions[row.Pk] = append(s.auctions[row.Pk], stored)
+	return nil
+}
+
+func (s *MemoryStore) QueryAuctions(ctx context.Context, userID string) ([]AuctionRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auctions := slices.Clone(s.auctions[GetAuctionPK(userID)])
+	slices.SortFunc(auctions, func(a, b AuctionRow) int {
+		return strings.Compare(b.Sk, a.Sk)
+	})
+	return auctions, nil
+}
+
+func (s *MemoryStore) PutBalanceSnapshot(ctx context.Context, snapshot *BalanceSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshots[snapshot.Pk] = append(s.snapshots[snapshot.Pk], *snapshot)
+	return nil
+}
+
+func (s *MemoryStore) QueryBalanceSnapshots(ctx context.Context, teamID string, startMs, endMs int64) ([]BalanceSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, to := balanceHistorySkFrom(startMs), balanceHistorySkTo(endMs)
+
+	var snapshots []BalanceSnapshot
+	for _, snapshot := range s.snapshots[GetBalanceHistoryPK(teamID)] {
+		if snapshot.Sk >= from && snapshot.Sk <= to {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	slices.SortFunc(snapshots, func(a, b BalanceSnapshot) int {
+		return strings.Compare(a.Sk, b.Sk)
+	})
+	return snapshots, nil
+}
+
+func (s *MemoryStore) QueryLedger(ctx context.Context, teamID string, startMs, endMs int64) ([]LedgerEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	from, to := balanceHistorySkFrom(startMs), balanceHistorySkTo(endMs)
+
+	var entries []LedgerEntry
+	for _, entry := range s.ledger[teamID] {
+		if entry.Sk >= from && entry.Sk <= to {
+			entries = append(entries, entry)
+		}
+	}
+	slices.SortFunc(entries, func(a, b LedgerEntry) int {
+		return strings.Compare(a.Sk, b.Sk)
+	})
+	return entries, nil
+}
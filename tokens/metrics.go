@@ -0,0 +1,150 @@
+package tokens
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Outcomes an auction is counted under in auction_auctions_total.
+const (
+	AuctionOutcomeWon      = "won"
+	AuctionOutcomeNoWinner = "no_winner"
+	AuctionOutcomeError    = "error"
+)
+
+var (
+	// auctionDurationBuckets are the upper bounds, in seconds, of the
+	// auction latency histogram.
+	auctionDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// bidCostBuckets are the upper bounds, in tokens, of the bid cost
+	// histogram.
+	bidCostBuckets = []float64{1, 2, 5, 10, 15, 20, 25, 50, 100}
+)
+
+// Metrics counts what a Manager's auctions do, as Prometheus collectors:
+//
+//	auction_auctions_total{outcome}           auctions by outcome: won, no_winner or error
+//	auction_wins_total{team_id}               auctions won per team
+//	auction_bid_skips_total{team_id,reason}   bids kept from winning, e.g. insufficient_balance
+//	auction_token_balance{team_id}            each team's balance after its last spend or refill
+//	auction_duration_seconds                  histogram of RunAuction latency
+//	auction_bid_cost                          histogram of the cost of every scored bid
+//
+// Metrics is a prometheus.Collector, to register with a registry of the
+// caller's, and an http.Handler serving just its own metrics. Share one
+// Metrics between Managers to aggregate them; see WithMetrics.
+type Metrics struct {
+	auctions        *prometheus.CounterVec
+	wins            *prometheus.CounterVec
+	skips           *prometheus.CounterVec
+	balances        *prometheus.GaugeVec
+	auctionDuration prometheus.Histogram
+	bidCost         prometheus.Histogram
+
+	handler http.Handler
+}
+
+// NewMetrics returns an empty Metrics.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		auctions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auction_auctions_total",
+			Help: "Auctions run, by outcome.",
+		}, []string{"outcome"}),
+		wins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auction_wins_total",
+			Help: "Auctions won, by team.",
+		}, []string{"team_id"}),
+		skips: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auction_bid_skips_total",
+			Help: "Bids kept from winning, by team and reason.",
+		}, []string{"team_id", "reason"}),
+		balances: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "auction_token_balance",
+			Help: "Token balance after a team's last spend or refill.",
+		}, []string{"team_id"}),
+		auctionDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "auction_duration_seconds",
+			Help:    "RunAuction latency in seconds.",
+			Buckets: auctionDurationBuckets,
+		}),
+		bidCost: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "auction_bid_cost",
+			Help:    "Cost of scored bids in tokens.",
+			Buckets: bidCostBuckets,
+		}),
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m)
+	m.handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	return m
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.auctions, m.wins, m.skips, m.balances, m.auctionDuration, m.bidCost}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// observeAuction counts an auction over scored bids that ended with results
+// or err after starting at start.
+func (tm *Manager) observeAuction(scored []*candidate, results []*AuctionResult, err error, start time.Time) {
+	m := tm.metrics
+	if m == nil {
+		return
+	}
+
+	// winners settled before a multi-winner auction failed still won
+	for _, result := range results {
+		m.wins.WithLabelValues(result.TeamID).Inc()
+	}
+
+	switch {
+	case err == nil:
+		m.auctions.WithLabelValues(AuctionOutcomeWon).Inc()
+	case errors.Is(err, ErrNoWinner):
+		m.auctions.WithLabelValues(AuctionOutcomeNoWinner).Inc()
+	default:
+		m.auctions.WithLabelValues(AuctionOutcomeError).Inc()
+	}
+	m.auctionDuration.Observe(time.Since(start).Seconds())
+
+	for _, c := range scored {
+		m.bidCost.Observe(float64(c.cost))
+		if c.skipReason != "" {
+			m.skips.WithLabelValues(c.bid.TeamID, c.skipReason).Inc()
+		}
+	}
+}
+
+// observeBalance records a team's balance after it changed.
+func (tm *Manager) observeBalance(teamID string, balance int64) {
+	m := tm.metrics
+	if m == nil {
+		return
+	}
+
+	m.balances.WithLabelValues(teamID).Set(float64(balance))
+}
+
+// ServeHTTP serves the metrics in the Prometheus exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,62 @@
+package tokens
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	m := NewMetrics()
+	mem := NewMemoryStore()
+	tm := newTestManager(t, []string{"a", "b"}, WithStore(mem), WithMetrics(m))
+	mem.tokens["b"].TokenBalance = 0
+
+	bids := []Bid{
+		{TeamID: "a", UserID: "u", Priority: 5},
+		{TeamID: "b", UserID: "u", Priority: 10},
+	}
+	if _, err := tm.RunAuction(ctx, bids); err != nil {
+		t.Fatalf("RunAuction: %v", err)
+	}
+	if _, err := tm.RunAuction(ctx, bids[1:]); err == nil {
+		t.Fatal("auction of a broke team found a winner")
+	}
+
+	tests := []struct {
+		name      string
+		collector prometheus.Collector
+		want      float64
+	}{
+		{name: "won auctions", collector: m.auctions.WithLabelValues(AuctionOutcomeWon), want: 1},
+		{name: "auctions without winner", collector: m.auctions.WithLabelValues(AuctionOutcomeNoWinner), want: 1},
+		{name: "wins of a", collector: m.wins.WithLabelValues("a"), want: 1},
+		{name: "skips of b", collector: m.skips.WithLabelValues("b", SkipReasonInsufficientBalance), want: 2},
+		{name: "balance of a", collector: m.balances.WithLabelValues("a"), want: float64(InitialTokenCount - 5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testutil.ToFloat64(tt.collector); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`auction_auctions_total{outcome="won"} 1`,
+		`auction_duration_seconds_count 2`,
+		`auction_bid_cost_count 3`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics don't contain %s:\n%s", want, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package tokens
+
+import "strings"
+
+// normalizeID canonicalizes a team or user ID so that IDs differing only in
+// surrounding whitespace, or in case with WithLowercaseIDs, name the same
+// team or user.
+func (tm *Manager) normalizeID(id string) string {
+	id = strings.TrimSpace(id)
+	if tm.lowercaseIDs {
+		id = strings.ToLower(id)
+	}
+	return id
+}
+
+// normalizeBids returns a copy of bids with normalized team and user IDs and
+// currencies.
+func (tm *Manager) normalizeBids(bids []Bid) []Bid {
+	normalized := make([]Bid, len(bids))
+	for i, bid := range bids {
+		bid.TeamID = tm.normalizeID(bid.TeamID)
+		bid.UserID = tm.normalizeID(bid.UserID)
+		bid.Currency = normalizeCurrency(bid.Currency)
+		normalized[i] = bid
+	}
+	return normalized
+}
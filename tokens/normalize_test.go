@@ -0,0 +1,51 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNormalizeIDs(t *testing.T) {
+	tests := []struct {
+		name      string
+		lowercase bool
+		// bidTeam is how the bid names team "team-a"
+		bidTeam string
+		wantErr error
+	}{
+		{name: "exact", bidTeam: "team-a"},
+		{name: "surrounding whitespace", bidTeam: "  team-a\t"},
+		{name: "case kept by default", bidTeam: "Team-A", wantErr: ErrTeamNotFound},
+		{name: "case folded", lowercase: true, bidTeam: " Team-A "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tm := newTestManager(t, []string{" team-a "}, WithLowercaseIDs(tt.lowercase))
+
+			result, err := tm.RunAuction(ctx, []Bid{{TeamID: tt.bidTeam, UserID: " User-1 ", Priority: 5}})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RunAuction = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if result.TeamID != "team-a" {
+				t.Errorf("winner = %q, want the normalized team-a", result.TeamID)
+			}
+
+			wantUser := "User-1"
+			if tt.lowercase {
+				wantUser = "user-1"
+			}
+			if result.UserID != wantUser {
+				t.Errorf("user = %q, want %q", result.UserID, wantUser)
+			}
+			// reads normalize the same way
+			if bids, err := tm.GetBids(ctx, tt.bidTeam); err != nil || len(bids) != 1 {
+				t.Errorf("GetBids(%q) = %d bids, %v, want one", tt.bidTeam, len(bids), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,555 @@
+package tokens
+
+import (
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/exp/rand"
+
+	"github.com/christopherwong-hinge/auction/events"
+)
+
+// Option configures optional behavior on a Manager.
+type Option func(*Manager)
+
+// WithEndpoint overrides the DynamoDB endpoint, by default the one the SDK's
+// default config resolves for its region.
+func WithEndpoint(endpoint string) Option {
+	return func(tm *Manager) {
+		tm.endpoint = endpoint
+	}
+}
+
+// WithLocalStack points the Manager's DynamoDB client at LocalStack: at
+// DefaultEndpoint unless WithEndpoint is given, with LocalStack's static
+// credentials instead of the SDK's default credential chain.
+func WithLocalStack() Option {
+	return func(tm *Manager) {
+		tm.localStack = true
+	}
+}
+
+// WithDynamoClient makes the Manager's DynamoDB store use client instead
+// of one it builds from the SDK's default config, WithEndpoint and
+// WithLocalStack.
+func WithDynamoClient(client *dynamodb.Client) Option {
+	return func(tm *Manager) {
+		tm.dynamoClient = client
+	}
+}
+
+// WithTableNames names the tables outright; see TableNames. Names left
+// empty default to the TableName constants plus any WithTableSuffix.
+func WithTableNames(names TableNames) Option {
+	return func(tm *Manager) {
+		tm.tableNames = names
+	}
+}
+
+// WithTableSuffix appends suffix to every table name, e.g. "_v2" for
+// tokens_v2 and bids_v2, to run two table versions side by side.
+func WithTableSuffix(suffix string) Option {
+	return func(tm *Manager) {
+		tm.tableSuffix = suffix
+	}
+}
+
+// WithLogger sets the logger the Manager reports to. Without it, or with a
+// nil logger, logs are discarded.
+func WithLogger(logger *zap.Logger) Option {
+	return func(tm *Manager) {
+		tm.logger = logger
+	}
+}
+
+// WithClock makes the Manager read the time from clock instead of the
+// system clock, e.g. a fake clock in tests. Latency metrics and scheduler
+// tickers still use real time.
+func WithClock(clock Clock) Option {
+	return func(tm *Manager) {
+		tm.clock = clock
+	}
+}
+
+// WithProvisionedCapacity makes EnsureTables create provisioned tables
+// rather than on-demand ones.
+func WithProvisionedCapacity(c ProvisionedCapacity) Option {
+	return func(tm *Manager) {
+		tm.provisionedCapacity = &c
+	}
+}
+
+// WithRandSource makes every random decision the Manager takes (tie-breaking,
+// weighted auctions, bid IDs) draw from src, so a fixed seed reproduces a run.
+func WithRandSource(src rand.Source) Option {
+	return func(tm *Manager) {
+		tm.rand = rand.New(src)
+	}
+}
+
+// WithMaxBidsPerAuction overrides DefaultMaxBidsPerAuction. RunAuction rejects
+// larger bid sets with ErrTooManyBids before touching DynamoDB. n must be
+// positive; there is no way to turn the limit off, and NewManager fails for
+// n <= 0.
+func WithMaxBidsPerAuction(n int) Option {
+	return func(tm *Manager) {
+		tm.maxBidsPerAuction = n
+	}
+}
+
+// WithBalanceFetchParallelism overrides DefaultBalanceFetchParallelism, the
+// number of batched balance reads, of up to 100 teams each, that auctions and
+// GetTokenBalances issue at once.
+func WithBalanceFetchParallelism(n int) Option {
+	return func(tm *Manager) {
+		tm.balanceFetchParallelism = n
+	}
+}
+
+// WithStore replaces the DynamoDB store the Manager would otherwise create,
+// e.g. with NewMemoryStore to run without DynamoDB. WithEndpoint,
+// WithLocalStack, WithDynamoClient, WithTableNames, WithTableSuffix and
+// WithProvisionedCapacity only configure the DynamoDB store and have no
+// effect alongside it.
+func WithStore(store Store) Option {
+	return func(tm *Manager) {
+		tm.store = store
+	}
+}
+
+// WithSkipTableCreation stops NewManager from calling CreateTable, for
+// environments where the tables are provisioned separately and the caller
+// lacks CreateTable permission. The tables are assumed to exist.
+func WithSkipTableCreation(skip bool) Option {
+	return func(tm *Manager) {
+		tm.skipTableCreation = skip
+	}
+}
+
+// WithReputationReward enables reputation rewards for low-priority spends.
+func WithReputationReward(r ReputationReward) Option {
+	return func(tm *Manager) {
+		tm.reputationReward = r
+	}
+}
+
+// WithReputationPenalty overrides DefaultReputationPenalty.
+func WithReputationPenalty(p ReputationPenalty) Option {
+	return func(tm *Manager) {
+		tm.reputationPenalty = p
+	}
+}
+
+// WithBidBuffer records bids through a buffer flushed with BatchWriteItem.
+// See BidBufferConfig for the durability tradeoff; callers should Close the
+// Manager on shutdown so queued bids are written.
+func WithBidBuffer(cfg BidBufferConfig) Option {
+	return func(tm *Manager) {
+		tm.bidBufferConfig = &cfg
+	}
+}
+
+// WithPendingBids bounds the bids submitted with POST /bids or SubmitBid
+// while they wait for their user's auction. The bids are held in memory by
+// the Manager that received them, so with several replicas a user's bids
+// and auction must be routed to the same one; sealed-bid windows (see
+// OpenAuctionWindow) are kept in the store instead.
+func WithPendingBids(cfg PendingBidsConfig) Option {
+	return func(tm *Manager) {
+		tm.pendingConfig = cfg
+	}
+}
+
+// WithRetry retries the store's transient failures, such as DynamoDB
+// throttling, with exponential backoff and jitter; see RetryStore.
+func WithRetry(cfg RetryConfig) Option {
+	return func(tm *Manager) {
+		tm.retryConfig = &cfg
+	}
+}
+
+// WithCircuitBreaker puts the store behind a circuit breaker, so that while
+// DynamoDB is unhealthy calls fail fast with ErrStoreUnavailable instead of
+// waiting on it; see BreakerStore.
+func WithCircuitBreaker(cfg BreakerConfig) Option {
+	return func(tm *Manager) {
+		tm.breakerConfig = &cfg
+	}
+}
+
+// WithDegradedMode lets RunAuction and RunMultiWinnerAuction keep awarding
+// while the circuit breaker is open, rather than fail every auction: bids
+// are priced against each team's balance as last read, and the winners'
+// charges are queued and settled once the store recovers. A team can
+// overspend by what it won in between if its balance changed meanwhile;
+// a settlement it can't pay is logged as an error and dropped. Auctions
+// with holds, reservations or an idempotency key still fail. It needs
+// WithCircuitBreaker, and callers should Close the Manager on shutdown so
+// queued settlements get a last chance to be charged.
+func WithDegradedMode(cfg DegradedConfig) Option {
+	return func(tm *Manager) {
+		tm.degradedConfig = &cfg
+	}
+}
+
+// WithWebhooks notifies teams' webhooks when they win or lose an auction;
+// see SetWebhook. Callers should Close the Manager on shutdown so queued
+// notifications are dead-lettered rather than lost.
+func WithWebhooks(cfg WebhookConfig) Option {
+	return func(tm *Manager) {
+		tm.webhookConfig = &cfg
+	}
+}
+
+// WithMaxReputation sets the top of the reputation scale, MaxReputationScore
+// by default. Teams start at it and are reset to it on refill, scores and
+// cost multipliers are normalized against it, and reputation rewards never
+// raise a team above it.
+func WithMaxReputation(maxReputation int64) Option {
+	return func(tm *Manager) {
+		tm.maxReputation = maxReputation
+	}
+}
+
+// WithMaxPriority sets the highest priority a bid may have, MaxPriority by
+// default. Priorities above MaxPriority need WithCostTiers to be priced.
+// Scores normalize priority against it and new teams' priority_usage has a
+// zero count for each priority up to it.
+func WithMaxPriority(maxPriority int64) Option {
+	return func(tm *Manager) {
+		tm.maxPriority = maxPriority
+	}
+}
+
+// WithCostTiers prices bids with a piecewise-linear function of priority
+// instead of the fixed cost map. NewManager rejects tiers that are unsorted
+// or don't cover every priority from 1 to the max priority.
+func WithCostTiers(tiers []CostTier) Option {
+	return func(tm *Manager) {
+		tm.costTiers = tiers
+	}
+}
+
+// WithTruncateAll enables TruncateAll. Only use it against test
+// environments; it deletes all data.
+func WithTruncateAll() Option {
+	return func(tm *Manager) {
+		tm.allowTruncate = true
+	}
+}
+
+// WithChargeFallback sets whether RunAuction awards the next-highest eligible
+// bid when charging the winner fails for lack of balance or a cooldown, e.g.
+// because another auction spent the team's tokens after this one scored its
+// bid. It cascades down the ranking until a charge succeeds, failing with
+// ErrNoWinner if none does. Fallback is on by default; with it off, the
+// auction fails with the first charge's error.
+func WithChargeFallback(fallback bool) Option {
+	return func(tm *Manager) {
+		tm.chargeFallback = fallback
+	}
+}
+
+// WithWaitForConsistency makes SpendTokens poll the team's token row with
+// strongly consistent reads after a spend, for up to timeout, until the
+// write is visible. This guards auctions that run right after a spend
+// against stale reads, e.g. from a lagging Global Tables replica, at the
+// cost of at least one extra read and up to timeout of added latency per
+// spend.
+func WithWaitForConsistency(timeout time.Duration) Option {
+	return func(tm *Manager) {
+		tm.consistencyTimeout = timeout
+	}
+}
+
+// WithTeamScoreWeights overrides the score weights for the given teams,
+// keyed by team ID, e.g. to weigh reputation more for premium partners.
+func WithTeamScoreWeights(weights map[string]ScoreWeights) Option {
+	return func(tm *Manager) {
+		tm.teamScoreWeights = weights
+	}
+}
+
+// WithScoreWeights overrides DefaultScoreWeights for every team without
+// weights of its own from WithTeamScoreWeights.
+func WithScoreWeights(weights ScoreWeights) Option {
+	return func(tm *Manager) {
+		tm.scoreWeights = weights
+	}
+}
+
+// WithScorer replaces the default score, priority and reputation weighted
+// by ScoreWeights, with scorer. Bids are still priced as usual.
+func WithScorer(scorer Scorer) Option {
+	return func(tm *Manager) {
+		tm.scorer = scorer
+	}
+}
+
+// WithCostMap overrides the default priority to base cost map. It must price
+// every priority up to the max priority, and is ignored when cost tiers are
+// configured.
+func WithCostMap(costs map[int64]int64) Option {
+	return func(tm *Manager) {
+		tm.costMap = costs
+	}
+}
+
+// WithInitialTokenCount overrides InitialTokenCount as the balance new teams
+// start with and refills reset to.
+func WithInitialTokenCount(n int64) Option {
+	return func(tm *Manager) {
+		tm.initialTokenCount = n
+	}
+}
+
+// WithBudgetPacing caps how fast teams spend; see BudgetPacing. Holds count
+// against the cap when placed, and aren't given back if cancelled.
+func WithBudgetPacing(p BudgetPacing) Option {
+	return func(tm *Manager) {
+		tm.budgetPacing = &p
+	}
+}
+
+// WithPriorityQuotas caps how often teams spend at each priority per day;
+// see PriorityQuotas. The quotas replace the ReputationPenalty, which
+// counts usage since the last refill: the default penalty's equivalent is
+// a QuotaPenalize quota on priority 10 with a DailyCap of 5 and a Penalty
+// of 10. Holds count against their quota when placed, and aren't given
+// back if cancelled.
+func WithPriorityQuotas(q PriorityQuotas) Option {
+	return func(tm *Manager) {
+		tm.priorityQuotas = &q
+	}
+}
+
+// WithFrequencyCap limits how often a team can win the same user; see
+// FrequencyCap. It applies to RunAuction and its variants.
+func WithFrequencyCap(f FrequencyCap) Option {
+	return func(tm *Manager) {
+		tm.frequencyCap = &f
+	}
+}
+
+// WithCurrencies adds token currencies besides the standard one, by name;
+// see Currency. Names are lowercase and can't be CurrencyStandard.
+func WithCurrencies(currencies map[string]Currency) Option {
+	return func(tm *Manager) {
+		tm.currencies = currencies
+	}
+}
+
+// WithDripRefill regenerates team balances over time; see DripRefill. Full
+// refills with RefillTokens restart a team's drip interval.
+func WithDripRefill(d DripRefill) Option {
+	return func(tm *Manager) {
+		tm.dripRefill = &d
+	}
+}
+
+// WithWindowSettlement settles auction windows whose deadline has passed
+// every interval, until the Manager is closed; see SettleDueAuctionWindows.
+// Without it, windows are only settled by SettleAuctionWindow.
+func WithWindowSettlement(interval time.Duration) Option {
+	return func(tm *Manager) {
+		tm.windowSettleInterval = interval
+	}
+}
+
+// WithLedgerReconcile checks every team's balance against its ledger every
+// interval, until the Manager is closed, logging any that drifted; see
+// ReconcileBalances.
+func WithLedgerReconcile(interval time.Duration) Option {
+	return func(tm *Manager) {
+		tm.ledgerReconcileInterval = interval
+	}
+}
+
+// WithStatsAggregation runs ComputeTeamStats every interval, until the
+// Manager is closed, so GetTeamStats and GetLeaderboard stay current.
+func WithStatsAggregation(interval time.Duration) Option {
+	return func(tm *Manager) {
+		tm.statsInterval = interval
+	}
+}
+
+// WithBidRetention has DynamoDB delete bid rows retention after they are
+// recorded, through the bids table's TTL on expires_at. Bids recorded
+// without a retention are kept forever.
+func WithBidRetention(retention time.Duration) Option {
+	return func(tm *Manager) {
+		tm.bidRetention = retention
+	}
+}
+
+// WithBidArchiver hands bids to archiver before they expire, every
+// interval, until the Manager is closed; see ArchiveExpiringBids. It
+// requires WithBidRetention, of more than twice interval. With a zero
+// interval bids are only archived by calling ArchiveExpiringBids.
+func WithBidArchiver(archiver BidArchiver, interval time.Duration) Option {
+	return func(tm *Manager) {
+		tm.bidArchiver = archiver
+		tm.bidArchiveInterval = interval
+	}
+}
+
+// WithReputationRecovery regenerates team reputation over time; see
+// ReputationRecovery.
+func WithReputationRecovery(r ReputationRecovery) Option {
+	return func(tm *Manager) {
+		tm.reputationRecovery = &r
+	}
+}
+
+// WithReputationFloor sets the reputation penalties can't take a team below.
+// It must be less than the max reputation.
+func WithReputationFloor(floor int64) Option {
+	return func(tm *Manager) {
+		tm.reputationFloor = floor
+	}
+}
+
+// WithReputationLog writes a ReputationEvent as NDJSON to w for every change
+// to a team's reputation. Writes are serialized.
+func WithReputationLog(w io.Writer) Option {
+	return func(tm *Manager) {
+		tm.reputationLog = newJSONLog(w)
+	}
+}
+
+// WithIdempotencyTTL overrides DefaultIdempotencyTTL as how long an
+// idempotency key is remembered, and so how long a retry with it is safe.
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(tm *Manager) {
+		tm.idempotencyTTL = ttl
+	}
+}
+
+// WithMetrics counts the Manager's auctions, bid skips and balances in m,
+// which serves them to Prometheus.
+func WithMetrics(m *Metrics) Option {
+	return func(tm *Manager) {
+		tm.metrics = m
+	}
+}
+
+// WithTracer starts spans with tracer around each auction and each of its
+// balance reads, bid writes, spends and holds, tagged with the team and
+// user. Spans are children of any span in the caller's context. Without it
+// the Manager uses the global TracerProvider's tracer named TracerName.
+func WithTracer(tracer trace.Tracer) Option {
+	return func(tm *Manager) {
+		tm.tracer = tracer
+	}
+}
+
+// WithDecisionLog writes every auction's outcome, with a breakdown of each
+// bid, to w as one JSON object per line. Writes from concurrent auctions are
+// serialized.
+func WithDecisionLog(w io.Writer) Option {
+	return func(tm *Manager) {
+		tm.decisionLog = newJSONLog(w)
+	}
+}
+
+// WithEventPublisher publishes an event to p as auctions start, are won and
+// settle, bids are recorded, tokens are spent and reputations change; see
+// package events.
+func WithEventPublisher(p events.Publisher) Option {
+	return func(tm *Manager) {
+		tm.publisher = p
+	}
+}
+
+// WithSettlementPublisher publishes an events.AuctionSettled to p as each
+// auction settles, with every bid and the winners, e.g. for a Kinesis stream
+// or Kafka topic that feeds analytics. It goes to the event publisher as
+// well, if there is one.
+func WithSettlementPublisher(p events.Publisher) Option {
+	return func(tm *Manager) {
+		tm.settlementPublisher = p
+	}
+}
+
+// WithWinnerVeto installs a hook run on each auction's winner before it is
+// charged. See WinnerVeto.
+func WithWinnerVeto(veto WinnerVeto) Option {
+	return func(tm *Manager) {
+		tm.winnerVeto = veto
+	}
+}
+
+// WithBidShards spreads each team's bid writes over n partitions,
+// bid#<teamID>#<shard>, for teams active enough to be throttled on a single
+// partition. Reads fan out over every shard, plus the unsharded partition,
+// and merge. Sharding is off for n <= 1. Changing n later hides bids
+// written under shards that no longer exist.
+func WithBidShards(n int) Option {
+	return func(tm *Manager) {
+		tm.bidShards = n
+	}
+}
+
+// WithBalanceHistory snapshots a team's balance into the balance_history
+// table on every spend and refill, for GetBalanceHistory. Each snapshot is
+// an extra write.
+func WithBalanceHistory(enabled bool) Option {
+	return func(tm *Manager) {
+		tm.balanceHistory = enabled
+	}
+}
+
+// WithLowercaseIDs lowercases team and user IDs before they are used in
+// keys, for upstream systems that don't case IDs consistently. IDs are
+// always trimmed of surrounding whitespace. Enabling it hides rows written
+// under IDs with upper-case letters.
+func WithLowercaseIDs(lowercase bool) Option {
+	return func(tm *Manager) {
+		tm.lowercaseIDs = lowercase
+	}
+}
+
+// WithAuctionLockTTL overrides DefaultAuctionLockTTL. It should comfortably
+// exceed the longest auction, or a slow auction's lock may be taken over.
+func WithAuctionLockTTL(ttl time.Duration) Option {
+	return func(tm *Manager) {
+		tm.auctionLockTTL = ttl
+	}
+}
+
+// WithAuctionStrategy sets what auction winners pay, FirstPrice by default.
+func WithAuctionStrategy(strategy AuctionStrategy) Option {
+	return func(tm *Manager) {
+		tm.auctionStrategy = strategy
+	}
+}
+
+// WithTieBreak sets how bids with the same score are ranked,
+// TieBreakReputation by default.
+func WithTieBreak(tieBreak TieBreak) Option {
+	return func(tm *Manager) {
+		tm.tieBreak = tieBreak
+	}
+}
+
+// WithBidValidation sets the checks an auction's bids pass before they are
+// scored. By default a bid that fails them fails its auction with
+// ErrInvalidBid and a team's duplicate bids collapse to its highest
+// priority.
+func WithBidValidation(v BidValidation) Option {
+	return func(tm *Manager) {
+		tm.bidValidation = v
+	}
+}
+
+// WithWinCooldown bars a team from winning again until cooldown has passed
+// since its last win, to spread wins across teams. Bids from teams in
+// cooldown are skipped.
+func WithWinCooldown(cooldown time.Duration) Option {
+	return func(tm *Manager) {
+		tm.winCooldown = cooldown
+	}
+}
@@ -0,0 +1,134 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// pacingAttempts bounds how often paceSpend retries a pacing row that
+// changed under it.
+const pacingAttempts = 3
+
+// BudgetPacing caps how many tokens a team can spend over a rolling window,
+// e.g. 200 an hour, so a team can't drain its balance in the first minutes
+// after a refill. Spends and auction charges past the cap fail with
+// ErrBudgetExceeded.
+//
+// The rolling total is estimated from two fixed windows: everything spent
+// in the current one, plus the previous one's spend weighted by how much of
+// it still overlaps the rolling window.
+type BudgetPacing struct {
+	Window time.Duration
+	Cap    int64
+	// TeamCaps overrides Cap for individual teams.
+	TeamCaps map[string]int64
+}
+
+// PacingRow tracks a team's spend for BudgetPacing. It lives in the tokens
+// table.
+type PacingRow struct {
+	Pk     string `dynamodbav:"pk"`
+	TeamID string `dynamodbav:"team_id"`
+	// WindowStartMs is when the current fixed window started.
+	WindowStartMs int64 `dynamodbav:"window_start_ms"`
+	Spent         int64 `dynamodbav:"spent"`
+	// PrevSpent is what was spent in the window before.
+	PrevSpent int64 `dynamodbav:"prev_spent"`
+}
+
+func (p *BudgetPacing) validate() error {
+	if p.Window < time.Millisecond || p.Cap <= 0 {
+		return fmt.Errorf("budget pacing needs a positive window and cap, got %v and %d", p.Window, p.Cap)
+	}
+	for teamID, budget := range p.TeamCaps {
+		if budget < 0 {
+			return fmt.Errorf("budget pacing cap for team %s is negative", teamID)
+		}
+	}
+	return nil
+}
+
+// teamCap returns a team's spend cap.
+func (p *BudgetPacing) teamCap(teamID string) int64 {
+	if budget, ok := p.TeamCaps[teamID]; ok {
+		return budget
+	}
+	return p.Cap
+}
+
+// paceSpend counts amount against a team's budget as of now, failing with
+// ErrBudgetExceeded if it doesn't fit. The returned refund gives the amount
+// back, for a charge that fails after it was paced.
+func (tm *Manager) paceSpend(ctx context.Context, teamID string, amount int64, now time.Time) (refund func(), err error) {
+	p := tm.budgetPacing
+	if p == nil {
+		return func() {}, nil
+	}
+
+	budget := p.teamCap(teamID)
+	windowMs := p.Window.Milliseconds()
+	nowMs := now.UnixMilli()
+	startMs := nowMs - nowMs%windowMs
+	// the share of the previous window still inside the rolling window
+	overlap := float64(windowMs-(nowMs-startMs)) / float64(windowMs)
+
+	for range pacingAttempts {
+		row, err := tm.store.GetPacingRow(ctx, teamID)
+		if err != nil {
+			return nil, err
+		}
+
+		spent, prevSpent := row.Spent, row.PrevSpent
+		if row.WindowStartMs != startMs {
+			// the first spend of a new window rolls the row over
+			spent, prevSpent = 0, 0
+			if row.WindowStartMs == startMs-windowMs {
+				prevSpent = row.Spent
+			}
+		}
+
+		limit := budget - int64(float64(prevSpent)*overlap)
+		if spent+amount > limit {
+			return nil, fmt.Errorf("%w: team %s has spent %d of %d", ErrBudgetExceeded, teamID, spent, limit)
+		}
+
+		if row.WindowStartMs == startMs {
+			err = tm.store.AddPacedSpend(ctx, teamID, amount, startMs, limit)
+		} else {
+			err = tm.store.RollPacingWindow(ctx, teamID, row.WindowStartMs, startMs, prevSpent, amount)
+		}
+		if errors.Is(err, ErrConditionFailed) {
+			// spent concurrently; check again against the new total
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return func() { tm.refundPacedSpend(ctx, teamID, amount, startMs) }, nil
+	}
+	return nil, fmt.Errorf("%w: budget pacing for team %s", ErrAuctionConflict, teamID)
+}
+
+// refundPacedSpend gives back a paced amount whose charge failed. Like
+// releaseReservations it may run after ctx was cancelled. A refund that
+// fails, or comes after its window ended, is logged and lost: the team's
+// budget runs short until the window passes.
+func (tm *Manager) refundPacedSpend(ctx context.Context, teamID string, amount, windowStartMs int64) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortBidsTimeout)
+	defer cancel()
+
+	err := tm.store.RefundPacedSpend(ctx, teamID, amount, windowStartMs)
+	if err != nil {
+		tm.logger.Warn(
+			"failed to refund paced spend",
+			zap.String("team_id", teamID),
+			zap.Int64("amount", amount),
+			zap.Error(err),
+		)
+	}
+}
@@ -0,0 +1,176 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPendingMaxBids = 10000
+	defaultPendingMaxAge  = 10 * time.Minute
+)
+
+// errNoPendingBids is returned by runPendingAuction for a user with no bids
+// waiting.
+var errNoPendingBids = errors.New("no pending bids")
+
+// PendingBidsConfig bounds the bids submitted ahead of their user's auction;
+// see WithPendingBids. Zero fields take their defaults.
+type PendingBidsConfig struct {
+	// MaxBids bounds the bids waiting across all users. Once it is reached,
+	// submitting a bid fails with ErrTooManyBids. It defaults to 10000.
+	MaxBids int
+	// MaxAge is how long a bid waits for its user's auction before it is
+	// dropped. It defaults to 10 minutes.
+	MaxAge time.Duration
+}
+
+func (c PendingBidsConfig) withDefaults() PendingBidsConfig {
+	if c.MaxBids <= 0 {
+		c.MaxBids = defaultPendingMaxBids
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = defaultPendingMaxAge
+	}
+	return c
+}
+
+// pendingBids are bids submitted ahead of their user's auction, e.g. with
+// POST /bids, keyed by normalized user ID. They are kept in memory only, so
+// they are lost when the process exits, and a bid submitted to one process
+// can only be auctioned by that process.
+type pendingBids struct {
+	cfg PendingBidsConfig
+	// maxPerUser is the most bids one user's auction can take.
+	maxPerUser int
+
+	mu    sync.Mutex
+	bids  map[string][]pendingBid
+	count int
+}
+
+// pendingBid is a bid waiting on its user's auction, with when it was
+// submitted.
+type pendingBid struct {
+	bid       Bid
+	addedAtMs int64
+}
+
+func newPendingBids(cfg PendingBidsConfig, maxPerUser int) *pendingBids {
+	return &pendingBids{
+		cfg:        cfg.withDefaults(),
+		maxPerUser: maxPerUser,
+		bids:       make(map[string][]pendingBid),
+	}
+}
+
+// add queues bid, submitted at nowMs, for its user's next auction and returns
+// how many bids are now waiting on it. It fails with ErrTooManyBids if the
+// user's auction couldn't take another bid or the queue is full.
+func (p *pendingBids) add(bid Bid, nowMs int64) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expireUser(bid.UserID, nowMs)
+	if n := len(p.bids[bid.UserID]); n >= p.maxPerUser {
+		return 0, fmt.Errorf("%w: %d bids pending for user %s, max %d", ErrTooManyBids, n, bid.UserID, p.maxPerUser)
+	}
+	if p.count >= p.cfg.MaxBids {
+		// make room from every user's stale bids before refusing
+		for userID := range p.bids {
+			p.expireUser(userID, nowMs)
+		}
+		if p.count >= p.cfg.MaxBids {
+			return 0, fmt.Errorf("%w: %d bids pending, max %d", ErrTooManyBids, p.count, p.cfg.MaxBids)
+		}
+	}
+
+	p.bids[bid.UserID] = append(p.bids[bid.UserID], pendingBid{bid: bid, addedAtMs: nowMs})
+	p.count++
+	return len(p.bids[bid.UserID]), nil
+}
+
+// take removes and returns the bids waiting on the user's auction at nowMs,
+// oldest first, leaving out those older than MaxAge.
+func (p *pendingBids) take(userID string, nowMs int64) []pendingBid {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expireUser(userID, nowMs)
+	bids := p.bids[userID]
+	delete(p.bids, userID)
+	p.count -= len(bids)
+	return bids
+}
+
+// requeue puts bids taken for the user's auction back ahead of any submitted
+// since, keeping when they were submitted so they still expire on time.
+func (p *pendingBids) requeue(userID string, bids []pendingBid) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.bids[userID] = append(bids, p.bids[userID]...)
+	p.count += len(bids)
+}
+
+// expireUser drops the user's bids older than MaxAge at nowMs. p.mu must be
+// held.
+func (p *pendingBids) expireUser(userID string, nowMs int64) {
+	bids := p.bids[userID]
+	fresh := 0
+	for fresh < len(bids) && nowMs-bids[fresh].addedAtMs > p.cfg.MaxAge.Milliseconds() {
+		fresh++
+	}
+	if fresh == 0 {
+		return
+	}
+	p.count -= fresh
+	if fresh == len(bids) {
+		delete(p.bids, userID)
+		return
+	}
+	p.bids[userID] = bids[fresh:]
+}
+
+// submitPendingBid queues bid for its user's next auction and returns how
+// many bids are now waiting on it.
+func (tm *Manager) submitPendingBid(bid Bid) (int, error) {
+	bid.TeamID = tm.normalizeID(bid.TeamID)
+	bid.UserID = tm.normalizeID(bid.UserID)
+	return tm.pending.add(bid, tm.clock.Now().UnixMilli())
+}
+
+// runPendingAuction auctions the bids waiting on the user's auction, failing
+// with errNoPendingBids if there are none. The bids are consumed whether or
+// not the auction finds a winner, unless it fails for a reason a retry may
+// get past before anyone is charged (see requeueable): then they are queued
+// again for the next attempt.
+func (tm *Manager) runPendingAuction(ctx context.Context, userID string, cfg AuctionConfig) (*AuctionResult, error) {
+	userID = tm.normalizeID(userID)
+	pending := tm.pending.take(userID, tm.clock.Now().UnixMilli())
+	if len(pending) == 0 {
+		return nil, fmt.Errorf("%w for user %s", errNoPendingBids, userID)
+	}
+
+	bids := make([]Bid, len(pending))
+	for i, p := range pending {
+		bids[i] = p.bid
+	}
+	result, err := tm.RunAuctionWithConfig(ctx, bids, cfg)
+	if requeueable(err) {
+		tm.pending.requeue(userID, pending)
+	}
+	return result, err
+}
+
+// requeueable reports whether a pending auction that failed with err charged
+// no one and may succeed if run again over the same bids: another auction
+// for the user was running, a charge kept losing races, or the store was
+// unavailable.
+func requeueable(err error) bool {
+	return errors.Is(err, ErrAuctionInProgress) || errors.Is(err, ErrAuctionConflict) ||
+		errors.Is(err, ErrStoreUnavailable)
+}
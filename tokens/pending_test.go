@@ -0,0 +1,91 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPendingBidsLimits(t *testing.T) {
+	clock := newTestClock()
+	tm := newTestManager(t, []string{"a", "b", "c"}, WithClock(clock), WithMaxBidsPerAuction(2),
+		WithPendingBids(PendingBidsConfig{MaxBids: 3, MaxAge: time.Minute}))
+
+	submit := func(teamID, userID string) (int, error) {
+		t.Helper()
+		return tm.submitPendingBid(Bid{TeamID: teamID, UserID: userID, Priority: 1})
+	}
+
+	// IDs are normalized, so both bids wait on the same user
+	if _, err := submit("a", "u"); err != nil {
+		t.Fatalf("submit a: %v", err)
+	}
+	if n, err := submit(" b ", " u "); err != nil || n != 2 {
+		t.Fatalf("submit b = %d, %v, want 2 pending", n, err)
+	}
+	// u's auction can't take a third bid
+	if _, err := submit("c", "u"); !errors.Is(err, ErrTooManyBids) {
+		t.Errorf("third bid for u = %v, want %v", err, ErrTooManyBids)
+	}
+
+	if _, err := submit("a", "v"); err != nil {
+		t.Fatalf("submit for v: %v", err)
+	}
+	// the queue is full
+	if _, err := submit("a", "w"); !errors.Is(err, ErrTooManyBids) {
+		t.Errorf("bid for w = %v, want %v", err, ErrTooManyBids)
+	}
+
+	// the stale bids make room
+	clock.Advance(2 * time.Minute)
+	if n, err := submit("a", "w"); err != nil || n != 1 {
+		t.Fatalf("bid for w after expiry = %d, %v, want 1 pending", n, err)
+	}
+	if _, err := tm.runPendingAuction(context.Background(), "u", AuctionConfig{}); !errors.Is(err, errNoPendingBids) {
+		t.Errorf("auction of u after expiry = %v, want %v", err, errNoPendingBids)
+	}
+}
+
+func TestRunPendingAuctionRequeue(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryStore()
+	tm := newTestManager(t, []string{"a", "b"}, WithStore(mem))
+	for _, teamID := range []string{"a", "b"} {
+		if _, err := tm.submitPendingBid(Bid{TeamID: teamID, UserID: "u", Priority: 1}); err != nil {
+			t.Fatalf("submitPendingBid: %v", err)
+		}
+	}
+
+	// another process is running u's auction
+	nowMs := tm.clock.Now().UnixMilli()
+	if err := mem.AcquireLock(ctx, "u", "other", nowMs, nowMs+time.Minute.Milliseconds()); err != nil {
+		t.Fatalf("AcquireLock: %v", err)
+	}
+	if _, err := tm.runPendingAuction(ctx, "u", AuctionConfig{}); !errors.Is(err, ErrAuctionInProgress) {
+		t.Fatalf("runPendingAuction = %v, want %v", err, ErrAuctionInProgress)
+	}
+	if err := mem.ReleaseLock(ctx, "u", "other"); err != nil {
+		t.Fatalf("ReleaseLock: %v", err)
+	}
+
+	// the bids waited for the retry
+	if _, err := tm.runPendingAuction(ctx, "u", AuctionConfig{}); err != nil {
+		t.Fatalf("retried runPendingAuction: %v", err)
+	}
+
+	// an auction that fails for good consumes its bids
+	mem.tokens["a"].TokenBalance = 0
+	mem.tokens["b"].TokenBalance = 0
+	for _, teamID := range []string{"a", "b"} {
+		if _, err := tm.submitPendingBid(Bid{TeamID: teamID, UserID: "u", Priority: 1}); err != nil {
+			t.Fatalf("submitPendingBid: %v", err)
+		}
+	}
+	if _, err := tm.runPendingAuction(ctx, "u", AuctionConfig{}); !errors.Is(err, ErrNoWinner) {
+		t.Fatalf("runPendingAuction without balance = %v, want %v", err, ErrNoWinner)
+	}
+	if _, err := tm.runPendingAuction(ctx, "u", AuctionConfig{}); !errors.Is(err, errNoPendingBids) {
+		t.Errorf("second runPendingAuction = %v, want %v", err, errNoPendingBids)
+	}
+}
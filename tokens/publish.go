@@ -0,0 +1,121 @@
+package tokens
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/christopherwong-hinge/auction/events"
+)
+
+// publish sends e to the Manager's event publisher, if any. Events are
+// published on the Manager's base context, so one for a change that was
+// made still goes out if the request behind it is cancelled. A failure is
+// logged and the event dropped.
+func (tm *Manager) publish(e events.Event) {
+	tm.publishTo(tm.publisher, e)
+}
+
+// publishTo sends e to p, if not nil, as publish does.
+func (tm *Manager) publishTo(p events.Publisher, e events.Event) {
+	if p == nil {
+		return
+	}
+
+	if err := p.Publish(tm.baseCtx, e); err != nil {
+		tm.logger.Warn(
+			"failed to publish event",
+			zap.String("type", e.EventType()),
+			zap.String("key", e.EventKey()),
+			zap.Error(err),
+		)
+	}
+}
+
+// publishAuctionStarted publishes an AuctionStarted for bids.
+func (tm *Manager) publishAuctionStarted(auctionID string, bids []Bid) {
+	if tm.publisher == nil || len(bids) == 0 {
+		return
+	}
+
+	teamIDs := make([]string, len(bids))
+	for i, bid := range bids {
+		teamIDs[i] = bid.TeamID
+	}
+	tm.publish(events.AuctionStarted{
+		AuctionID:    auctionID,
+		UserID:       bids[0].UserID,
+		TeamIDs:      teamIDs,
+		OccurredAtMs: tm.clock.Now().UnixMilli(),
+	})
+}
+
+// publishAuctionWon publishes an AuctionWon for each result.
+func (tm *Manager) publishAuctionWon(results []*AuctionResult) {
+	nowMs := tm.clock.Now().UnixMilli()
+	for _, result := range results {
+		tm.publish(events.AuctionWon{
+			AuctionID:        result.AuctionID,
+			UserID:           result.UserID,
+			TeamID:           result.TeamID,
+			BidID:            result.BidID,
+			Cost:             result.Cost,
+			Score:            result.Score,
+			RemainingBalance: result.RemainingBalance,
+			OccurredAtMs:     nowMs,
+		})
+	}
+}
+
+// publishAuctionSettled publishes an AuctionSettled for an auction over
+// bids, of which scored were scored and candidates eligible to win, to the
+// settlement publisher and the event publisher.
+func (tm *Manager) publishAuctionSettled(
+	auctionID string,
+	startedAt time.Time,
+	bids []Bid,
+	scored []*candidate,
+	candidates []*candidate,
+	results []*AuctionResult,
+) {
+	if (tm.publisher == nil && tm.settlementPublisher == nil) || len(bids) == 0 {
+		return
+	}
+
+	e := events.AuctionSettled{
+		AuctionID:    auctionID,
+		UserID:       bids[0].UserID,
+		Bids:         make([]events.SettledBid, 0, len(scored)),
+		Winners:      make([]events.SettledWinner, 0, len(results)),
+		StartedAtMs:  startedAt.UnixMilli(),
+		OccurredAtMs: tm.clock.Now().UnixMilli(),
+	}
+	for _, c := range scored {
+		sb := events.SettledBid{
+			TeamID:     c.bid.TeamID,
+			Priority:   c.bid.Priority,
+			Score:      c.score,
+			Cost:       c.breakdown.Cost,
+			SkipReason: c.skipReason,
+			Won:        c.won,
+		}
+		if c.row != nil {
+			sb.BidID = c.row.BidID
+		}
+		e.Bids = append(e.Bids, sb)
+	}
+	for _, result := range results {
+		e.Winners = append(e.Winners, events.SettledWinner{
+			TeamID: result.TeamID,
+			BidID:  result.BidID,
+			Score:  result.Score,
+			Cost:   result.Cost,
+		})
+	}
+	if len(results) == 0 {
+		e.NoWinnerReason = noWinnerReason(scored, candidates)
+	}
+
+	tm.publishTo(tm.settlementPublisher, e)
+	tm.publish(e)
+}
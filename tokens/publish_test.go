@@ -0,0 +1,112 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/christopherwong-hinge/auction/events"
+)
+
+// recordingPublisher keeps every event published to it.
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []events.Event
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, e events.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, e)
+	return nil
+}
+
+// settled returns the AuctionSettled events published so far.
+func (p *recordingPublisher) settled() []events.AuctionSettled {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var settled []events.AuctionSettled
+	for _, e := range p.events {
+		if s, ok := e.(events.AuctionSettled); ok {
+			settled = append(settled, s)
+		}
+	}
+	return settled
+}
+
+func TestAuctionSettledPublished(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial int64
+		bids    []Bid
+		wantErr error
+		// wantWinner is empty for an auction without a winner
+		wantWinner   string
+		wantReason   string
+		wantBidCount int
+	}{
+		{
+			name:         "winner and loser",
+			initial:      InitialTokenCount,
+			bids:         []Bid{{TeamID: "a", UserID: "u1", Priority: 5}, {TeamID: "b", UserID: "u1", Priority: 1}},
+			wantWinner:   "a",
+			wantBidCount: 2,
+		},
+		{
+			name:         "no winner",
+			initial:      1,
+			bids:         []Bid{{TeamID: "a", UserID: "u1", Priority: 10}, {TeamID: "b", UserID: "u1", Priority: 10}},
+			wantErr:      ErrNoWinner,
+			wantReason:   NoWinnerAllBroke,
+			wantBidCount: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &recordingPublisher{}
+			bus := &recordingPublisher{}
+			tm := newTestManager(t, []string{"a", "b"},
+				WithInitialTokenCount(tt.initial), WithSettlementPublisher(sink), WithEventPublisher(bus))
+
+			result, err := tm.RunAuction(context.Background(), tt.bids)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RunAuction: got %v, want %v", err, tt.wantErr)
+			}
+
+			settled := sink.settled()
+			if len(settled) != 1 {
+				t.Fatalf("got %d AuctionSettled on the settlement publisher, want 1", len(settled))
+			}
+			if got := len(bus.settled()); got != 1 {
+				t.Errorf("got %d AuctionSettled on the event publisher, want 1", got)
+			}
+			e := settled[0]
+			if e.UserID != "u1" || len(e.Bids) != tt.wantBidCount {
+				t.Errorf("got user %q with %d bids, want u1 with %d", e.UserID, len(e.Bids), tt.wantBidCount)
+			}
+			if e.NoWinnerReason != tt.wantReason {
+				t.Errorf("got no winner reason %q, want %q", e.NoWinnerReason, tt.wantReason)
+			}
+
+			if tt.wantWinner == "" {
+				if len(e.Winners) != 0 {
+					t.Errorf("got winners %+v, want none", e.Winners)
+				}
+				return
+			}
+			if len(e.Winners) != 1 || e.Winners[0].TeamID != tt.wantWinner {
+				t.Fatalf("got winners %+v, want %s", e.Winners, tt.wantWinner)
+			}
+			if e.AuctionID != result.AuctionID || e.Winners[0].BidID != result.BidID || e.Winners[0].Cost != result.Cost {
+				t.Errorf("got %+v, want auction %s won by bid %s for %d", e, result.AuctionID, result.BidID, result.Cost)
+			}
+			for _, b := range e.Bids {
+				if b.Won != (b.TeamID == tt.wantWinner) {
+					t.Errorf("bid of %s has won=%t", b.TeamID, b.Won)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// QuotaAction is what happens to a spend past its priority's daily quota.
+type QuotaAction int
+
+const (
+	// QuotaBlock fails the spend with ErrQuotaExceeded.
+	QuotaBlock QuotaAction = iota
+	// QuotaSurcharge charges the spend its cost times the quota's
+	// Surcharge.
+	QuotaSurcharge
+	// QuotaPenalize lets the spend through and takes the quota's Penalty
+	// from the team's reputation.
+	QuotaPenalize
+)
+
+func (a QuotaAction) String() string {
+	switch a {
+	case QuotaBlock:
+		return "block"
+	case QuotaSurcharge:
+		return "surcharge"
+	case QuotaPenalize:
+		return "penalize"
+	default:
+		return fmt.Sprintf("QuotaAction(%d)", int(a))
+	}
+}
+
+// GraduatedPenalty takes
+//
+//	Base + PerOveruse*(n-1)
+//
+// reputation for the nth spend past a limit, capped at MaxDecrement when it
+// is non-zero, so the penalty can grow with continued overuse.
+type GraduatedPenalty struct {
+	Base         int64 `json:"base"`
+	PerOveruse   int64 `json:"per_overuse"`
+	MaxDecrement int64 `json:"max_decrement"`
+}
+
+// decrement returns the reputation to take for the overage'th spend past
+// the limit, or nothing if overage isn't positive.
+func (p GraduatedPenalty) decrement(overage int) int64 {
+	if overage <= 0 {
+		return 0
+	}
+
+	d := p.Base + p.PerOveruse*int64(overage-1)
+	if p.MaxDecrement > 0 {
+		d = min(d, p.MaxDecrement)
+	}
+	return max(d, 0)
+}
+
+// PriorityQuota caps how often a team can spend at Priority each day.
+type PriorityQuota struct {
+	Priority int64
+	// DailyCap is how many spends at Priority a team gets each day before
+	// Action applies.
+	DailyCap int
+	Action   QuotaAction
+	// Surcharge multiplies the cost of spends past DailyCap under
+	// QuotaSurcharge, e.g. 2 to double it.
+	Surcharge float64
+	// Penalty is taken from the team's reputation for spends past DailyCap
+	// under QuotaPenalize.
+	Penalty GraduatedPenalty
+}
+
+// PriorityQuotas caps each team's daily spends per priority. Every spend,
+// auction charge and hold counts against its priority's quota, which
+// resets at the start of each day by the Manager's Clock. Counts live on a
+// quota# row per team in the tokens table.
+type PriorityQuotas struct {
+	Quotas []PriorityQuota
+	// Location is the time zone days start in, UTC when nil.
+	Location *time.Location
+}
+
+// QuotaRow counts a team's spends per priority for PriorityQuotas over the
+// current day. It lives in the tokens table.
+type QuotaRow struct {
+	Pk     string `dynamodbav:"pk"`
+	TeamID string `dynamodbav:"team_id"`
+	// DayStartMs is when the day being counted started.
+	DayStartMs int64       `dynamodbav:"day_start_ms"`
+	Usage      map[int]int `dynamodbav:"usage"`
+}
+
+func (q *PriorityQuotas) validate(maxPriority int64) error {
+	seen := make(map[int64]bool, len(q.Quotas))
+	for _, quota := range q.Quotas {
+		if quota.Priority < 1 || quota.Priority > maxPriority {
+			return fmt.Errorf("priority quota priority must be between 1 and %d, got %d", maxPriority, quota.Priority)
+		}
+		if seen[quota.Priority] {
+			return fmt.Errorf("priority %d has more than one quota", quota.Priority)
+		}
+		seen[quota.Priority] = true
+
+		if quota.DailyCap < 0 {
+			return fmt.Errorf("priority %d quota has a negative daily cap", quota.Priority)
+		}
+		switch quota.Action {
+		case QuotaBlock:
+		case QuotaSurcharge:
+			if quota.Surcharge < 1 {
+				return fmt.Errorf("priority %d quota surcharge must be at least 1, got %v", quota.Priority, quota.Surcharge)
+			}
+		case QuotaPenalize:
+			if quota.Penalty.Base <= 0 || quota.Penalty.PerOveruse < 0 || quota.Penalty.MaxDecrement < 0 {
+				return fmt.Errorf("priority %d quota penalty needs a positive base", quota.Priority)
+			}
+		default:
+			return fmt.Errorf("priority %d quota has unknown action %d", quota.Priority, quota.Action)
+		}
+	}
+	return nil
+}
+
+// quota returns the quota for priority, or nil if it has none.
+func (q *PriorityQuotas) quota(priority int64) *PriorityQuota {
+	for i := range q.Quotas {
+		if q.Quotas[i].Priority == priority {
+			return &q.Quotas[i]
+		}
+	}
+	return nil
+}
+
+// dayStart returns when the day containing now started.
+func (q *PriorityQuotas) dayStart(now time.Time) int64 {
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	y, m, d := now.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc).UnixMilli()
+}
+
+// quotaCharge is what a priority quota made of a spend.
+type quotaCharge struct {
+	// cost is the spend's cost, surcharged if it was past its quota.
+	cost int64
+	// penalty is the reputation to take once the spend is charged, at most
+	// once per penaltyKey.
+	penalty    int64
+	penaltyKey string
+	// refund gives the spend's count back, for a charge that fails after
+	// it was counted.
+	refund func()
+}
+
+// countQuota counts a spend at priority costing cost against the team's
+// quota for the day as of now. Past the quota it fails with
+// ErrQuotaExceeded under QuotaBlock, or returns the surcharged cost or the
+// penalty to take.
+func (tm *Manager) countQuota(ctx context.Context, teamID string, priority, cost int64, now time.Time) (*quotaCharge, error) {
+	charge := &quotaCharge{cost: cost, refund: func() {}}
+	if tm.priorityQuotas == nil {
+		return charge, nil
+	}
+	q := tm.priorityQuotas.quota(priority)
+	if q == nil {
+		return charge, nil
+	}
+
+	dayStartMs := tm.priorityQuotas.dayStart(now)
+	limit := 0
+	if q.Action == QuotaBlock {
+		limit = q.DailyCap
+	}
+
+	for range pacingAttempts {
+		row, err := tm.store.GetQuotaRow(ctx, teamID)
+		if err != nil {
+			return nil, err
+		}
+
+		used := row.Usage[int(priority)]
+		if row.DayStartMs != dayStartMs {
+			// the first spend of a new day rolls the row over
+			used = 0
+		}
+		if q.Action == QuotaBlock && used >= q.DailyCap {
+			return nil, fmt.Errorf("%w: team %s has used priority %d %d times today", ErrQuotaExceeded, teamID, priority, used)
+		}
+
+		if row.DayStartMs == dayStartMs {
+			err = tm.store.AddQuotaUsage(ctx, teamID, priority, dayStartMs, limit)
+		} else {
+			err = tm.store.RollQuotaDay(ctx, teamID, row.DayStartMs, dayStartMs, priority)
+		}
+		if errors.Is(err, ErrConditionFailed) {
+			// counted concurrently; check again against the new count
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		charge.refund = func() { tm.refundQuotaUsage(ctx, teamID, priority, dayStartMs) }
+		if overage := used + 1 - q.DailyCap; overage > 0 {
+			switch q.Action {
+			case QuotaSurcharge:
+				charge.cost = int64(float64(cost) * q.Surcharge)
+			case QuotaPenalize:
+				charge.penalty = q.Penalty.decrement(overage)
+				charge.penaltyKey = fmt.Sprintf("quota#%d#%d#%d", priority, dayStartMs, used+1)
+			}
+		}
+		return charge, nil
+	}
+	return nil, fmt.Errorf("%w: priority quota for team %s", ErrAuctionConflict, teamID)
+}
+
+// refundQuotaUsage gives back a spend's count whose charge failed. Like
+// refundPacedSpend it may run after ctx was cancelled, and a refund that
+// fails or comes after its day ended is logged and lost.
+func (tm *Manager) refundQuotaUsage(ctx context.Context, teamID string, priority, dayStartMs int64) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortBidsTimeout)
+	defer cancel()
+
+	err := tm.store.RefundQuotaUsage(ctx, teamID, priority, dayStartMs)
+	if err != nil {
+		tm.logger.Warn(
+			"failed to refund priority quota usage",
+			zap.String("team_id", teamID),
+			zap.Int64("priority", priority),
+			zap.Error(err),
+		)
+	}
+}
+
+// GetQuotaUsage returns how many times a team has spent at each priority
+// today, for the priorities with a quota.
+func (tm *Manager) GetQuotaUsage(ctx context.Context, teamID string) (map[int64]int, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	usage := make(map[int64]int)
+	if tm.priorityQuotas == nil {
+		return usage, nil
+	}
+
+	row, err := tm.store.GetQuotaRow(ctx, tm.normalizeID(teamID))
+	if err != nil {
+		return nil, err
+	}
+	today := row.DayStartMs == tm.priorityQuotas.dayStart(tm.clock.Now())
+	for _, q := range tm.priorityQuotas.Quotas {
+		usage[q.Priority] = 0
+		if today {
+			usage[q.Priority] = row.Usage[int(q.Priority)]
+		}
+	}
+	return usage, nil
+}
@@ -0,0 +1,146 @@
+package tokens
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Reasons a scored bid was kept out of an auction.
+const (
+	SkipReasonInsufficientBalance = "insufficient_balance"
+	SkipReasonWinCooldown         = "win_cooldown"
+	SkipReasonVetoed              = "vetoed"
+	// SkipReasonBudgetExceeded marks a winning bid whose team was past its
+	// budget pacing cap, so the auction moved on to the next bid.
+	SkipReasonBudgetExceeded = "budget_exceeded"
+	// SkipReasonQuotaExceeded marks a winning bid whose team had used up
+	// its daily quota for the bid's priority under QuotaBlock, so the
+	// auction moved on to the next bid.
+	SkipReasonQuotaExceeded = "quota_exceeded"
+	// SkipReasonFrequencyCap marks a bid from a team that won the bid's
+	// user as often as its FrequencyCap allows.
+	SkipReasonFrequencyCap = "frequency_cap"
+	// SkipReasonBelowReserve marks a bid below its auction's reserve; see
+	// AuctionConfig.MinScore.
+	SkipReasonBelowReserve = "below_reserve"
+	// SkipReasonChargeFailed marks a winning bid whose charge failed, e.g.
+	// because another auction spent the team's tokens after this one
+	// scored it, so the auction moved on to the next bid.
+	SkipReasonChargeFailed = "charge_failed"
+	// SkipReasonTeamInactive marks a bid from a suspended or archived team;
+	// see SuspendTeam and ArchiveTeam.
+	SkipReasonTeamInactive = "team_inactive"
+)
+
+// candidate is a priced and scored bid competing in an auction. row is nil
+// when the bid has not been recorded, e.g. in a simulation.
+type candidate struct {
+	bid  Bid
+	row  *BidRow
+	cost int64
+	// price is what the candidate is charged if it wins; see clearingPrice.
+	price       int64
+	breakdown   CostBreakdown
+	score       float64
+	balance     int64
+	reputation  int64
+	createdAtMs int64
+	lastWinAtMs int64
+	won         bool
+	// reservation holds the bid's cost while its auction runs; see
+	// AuctionConfig.ReserveBids.
+	reservation *HoldRow
+	// skipReason explains why a scored bid did not compete.
+	skipReason string
+	// vetoChecked is set once the WinnerVeto was asked about the bid.
+	vetoChecked bool
+	// winRate and tieKey break ties under TieBreakWinRate and
+	// TieBreakRandom.
+	winRate float64
+	tieKey  float64
+}
+
+// TieBreak decides which of two bids with the same score ranks first.
+type TieBreak int
+
+const (
+	// TieBreakReputation ranks the bid of the team with the highest
+	// reputation first, then the earliest recorded bid. It is the default.
+	TieBreakReputation TieBreak = iota
+	// TieBreakRandom ranks tied bids in random order, drawn from the
+	// Manager's rand source if it has one (see WithRandSource).
+	TieBreakRandom
+	// TieBreakWinRate ranks the bid of the team with the lowest share of
+	// auctions won first, then the earliest recorded bid. Auctions are
+	// counted towards a team's share only while it is configured, at one
+	// extra write per bidding team per auction; wins are always counted.
+	TieBreakWinRate
+	// TieBreakEarliest ranks the earliest recorded bid first.
+	TieBreakEarliest
+)
+
+// String returns the tie break's name in the config file.
+func (t TieBreak) String() string {
+	switch t {
+	case TieBreakReputation:
+		return "reputation"
+	case TieBreakRandom:
+		return "random"
+	case TieBreakWinRate:
+		return "win_rate"
+	case TieBreakEarliest:
+		return "earliest"
+	default:
+		return fmt.Sprintf("TieBreak(%d)", int(t))
+	}
+}
+
+// winRate is the share of auctions a team won, from its token row. Wins from
+// before auctions were counted can't push it past 1.
+func winRate(row *TokenDBRow) float64 {
+	auctions := max(row.AuctionCount, row.WinCount)
+	if auctions == 0 {
+		return 0
+	}
+	return float64(row.WinCount) / float64(auctions)
+}
+
+// outranks reports whether c beats other: by highest score, then by
+// tieBreak. A complete tie keeps other, i.e. the bid seen first.
+func (c *candidate) outranks(other *candidate, tieBreak TieBreak) bool {
+	if other == nil {
+		return true
+	}
+	if c.score != other.score {
+		return c.score > other.score
+	}
+
+	switch tieBreak {
+	case TieBreakRandom:
+		return c.tieKey < other.tieKey
+	case TieBreakWinRate:
+		if c.winRate != other.winRate {
+			return c.winRate < other.winRate
+		}
+	case TieBreakReputation:
+		if c.reputation != other.reputation {
+			return c.reputation > other.reputation
+		}
+	}
+	return c.createdAtMs < other.createdAtMs
+}
+
+// rankCandidates sorts candidates best first, keeping the original order of
+// bids that tie completely.
+func rankCandidates(candidates []*candidate, tieBreak TieBreak) {
+	slices.SortStableFunc(candidates, func(a, b *candidate) int {
+		switch {
+		case a.outranks(b, tieBreak):
+			return -1
+		case b.outranks(a, tieBreak):
+			return 1
+		default:
+			return 0
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package tokens
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestRankCandidates(t *testing.T) {
+	tests := []struct {
+		name       string
+		tieBreak   TieBreak
+		candidates []*candidate
+		want       []string
+	}{
+		{
+			name: "score first",
+			candidates: []*candidate{
+				{bid: Bid{TeamID: "a"}, score: 10, reputation: 100},
+				{bid: Bid{TeamID: "b"}, score: 20, reputation: 0},
+			},
+			want: []string{"b", "a"},
+		},
+		{
+			name: "tie broken by reputation",
+			candidates: []*candidate{
+				{bid: Bid{TeamID: "a"}, score: 10, reputation: 50, createdAtMs: 1},
+				{bid: Bid{TeamID: "b"}, score: 10, reputation: 80, createdAtMs: 2},
+			},
+			want: []string{"b", "a"},
+		},
+		{
+			name: "reputation tie broken by recency",
+			candidates: []*candidate{
+				{bid: Bid{TeamID: "a"}, score: 10, reputation: 50, createdAtMs: 2},
+				{bid: Bid{TeamID: "b"}, score: 10, reputation: 50, createdAtMs: 1},
+			},
+			want: []string{"b", "a"},
+		},
+		{
+			name: "complete tie keeps bid order",
+			candidates: []*candidate{
+				{bid: Bid{TeamID: "a"}, score: 10, reputation: 50, createdAtMs: 1},
+				{bid: Bid{TeamID: "b"}, score: 10, reputation: 50, createdAtMs: 1},
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name:     "earliest ignores reputation",
+			tieBreak: TieBreakEarliest,
+			candidates: []*candidate{
+				{bid: Bid{TeamID: "a"}, score: 10, reputation: 80, createdAtMs: 2},
+				{bid: Bid{TeamID: "b"}, score: 10, reputation: 50, createdAtMs: 1},
+			},
+			want: []string{"b", "a"},
+		},
+		{
+			name:     "lowest win rate first",
+			tieBreak: TieBreakWinRate,
+			candidates: []*candidate{
+				{bid: Bid{TeamID: "a"}, score: 10, winRate: 0.5, createdAtMs: 1},
+				{bid: Bid{TeamID: "b"}, score: 10, winRate: 0.2, createdAtMs: 2},
+			},
+			want: []string{"b", "a"},
+		},
+		{
+			name:     "random by tie key",
+			tieBreak: TieBreakRandom,
+			candidates: []*candidate{
+				{bid: Bid{TeamID: "a"}, score: 10, tieKey: 0.9, createdAtMs: 1},
+				{bid: Bid{TeamID: "b"}, score: 10, tieKey: 0.1, createdAtMs: 2},
+			},
+			want: []string{"b", "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rankCandidates(tt.candidates, tt.tieBreak)
+
+			var got []string
+			for _, c := range tt.candidates {
+				got = append(got, c.bid.TeamID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ranked %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTeamScoreWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]ScoreWeights
+		// want is the score of a's bid at max priority and zero reputation
+		want float64
+	}{
+		{name: "default weights", want: 70},
+		{name: "team override", weights: map[string]ScoreWeights{"a": {Priority: 1}}, want: 100},
+		{name: "other team's override", weights: map[string]ScoreWeights{"b": {Priority: 1}}, want: 70},
+		{name: "weights summing past 1", weights: map[string]ScoreWeights{"a": {Priority: 2, Reputation: 1}}, want: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := NewMemoryStore()
+			tm := newTestManager(t, []string{"a"}, WithStore(mem), WithTeamScoreWeights(tt.weights))
+			mem.tokens["a"].ReputationScore = 0
+
+			result, err := tm.RunAuction(context.Background(), []Bid{{TeamID: "a", UserID: "u", Priority: MaxPriority}})
+			if err != nil {
+				t.Fatalf("RunAuction: %v", err)
+			}
+			if result.Score != tt.want {
+				t.Errorf("score = %v, want %v", result.Score, tt.want)
+			}
+		})
+	}
+}
+
+func TestScoreClamped(t *testing.T) {
+	tests := []struct {
+		name   string
+		scorer Scorer
+		// reputation is the bidding team's, above the max to test
+		// normalization
+		reputation int64
+		want       float64
+	}{
+		{name: "reputation above the max", reputation: 2 * MaxReputationScore, want: 100},
+		{name: "scorer above 100", scorer: func(ScoreInput) float64 { return 250 }, reputation: 50, want: 100},
+		{name: "scorer below 0", scorer: func(ScoreInput) float64 { return -5 }, reputation: 50, want: 0},
+		{name: "scorer in range", scorer: func(ScoreInput) float64 { return 42 }, reputation: 50, want: 42},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := NewMemoryStore()
+			opts := []Option{WithStore(mem)}
+			if tt.scorer != nil {
+				opts = append(opts, WithScorer(tt.scorer))
+			}
+			tm := newTestManager(t, []string{"a"}, opts...)
+			mem.tokens["a"].ReputationScore = tt.reputation
+
+			result, err := tm.RunAuction(context.Background(), []Bid{{TeamID: "a", UserID: "u", Priority: MaxPriority}})
+			if err != nil {
+				t.Fatalf("RunAuction: %v", err)
+			}
+			if result.Score != tt.want {
+				t.Errorf("winning score = %v, want %v", result.Score, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ReconcileReport compares a team's balance with what its recorded winning
+// bids say it should be.
+type ReconcileReport struct {
+	TeamID string `json:"team_id"`
+	// Balance is the team's current token balance.
+	Balance int64 `json:"balance"`
+	// ExpectedBalance is the initial token count less the cost of every bid the
+	// team won since its last refill.
+	ExpectedBalance int64 `json:"expected_balance"`
+	WinningBids     int   `json:"winning_bids"`
+	Spent           int64 `json:"spent"`
+	// Drift is Balance - ExpectedBalance; zero means the team reconciles.
+	Drift int64 `json:"drift"`
+	// Fixed is set when the balance was reset to ExpectedBalance.
+	Fixed bool `json:"fixed"`
+}
+
+// ReconcileTeam checks a team's balance for drift from its recorded
+// spends. Refills reset the balance to the initial token count, so only bids won
+// since the team's last refill count. Tokens spent outside of auctions,
+// e.g. by calling SpendTokens directly, leave no bid record and show up as
+// drift, as do cancelled holds, whose bids stay marked as won, and the
+// credits of WithDripRefill.
+//
+// ReconcileTeam is read-only unless fix is set, in which case a drifted
+// balance is reset to the expected balance, provided it hasn't changed
+// since it was read.
+func (tm *Manager) ReconcileTeam(ctx context.Context, teamID string, fix bool) (*ReconcileReport, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	teamID = tm.normalizeID(teamID)
+
+	row, err := tm.getTokenRow(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	bids, err := tm.GetWinningBids(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{
+		TeamID:  teamID,
+		Balance: row.TokenBalance,
+	}
+	for _, bid := range bids {
+		if bid.CreatedAtMs < row.LastRefillTime {
+			continue
+		}
+		report.WinningBids++
+		report.Spent += bid.Cost
+	}
+	report.ExpectedBalance = tm.initialTokenCount - report.Spent
+	report.Drift = report.Balance - report.ExpectedBalance
+
+	if !fix || report.Drift == 0 {
+		return report, nil
+	}
+
+	err = tm.store.SetTokenBalance(ctx, teamID, report.ExpectedBalance, report.Balance, tm.clock.Now().UnixMilli())
+	if err != nil {
+		if errors.Is(err, ErrConditionFailed) {
+			return report, fmt.Errorf("balance of %s changed during reconcile, not fixed", teamID)
+		}
+		return report, err
+	}
+
+	report.Fixed = true
+	return report, nil
+}
@@ -0,0 +1,270 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/christopherwong-hinge/auction/events"
+)
+
+// Reasons a team's reputation changed, recorded on ReputationEvents.
+const (
+	ReputationEventPenalty  = "penalty"
+	ReputationEventReward   = "reward"
+	ReputationEventRecovery = "recovery"
+	ReputationEventRefill   = "refill"
+)
+
+// ReputationEvent records a change to a team's reputation. Events are written
+// as NDJSON to the writer given to WithReputationLog. Penalties and rewards
+// are also kept in the tokens table under their dedupe key, which is how
+// each is applied at most once; see Store.AdjustReputation.
+type ReputationEvent struct {
+	Pk     string `json:"-" dynamodbav:"pk"`
+	TeamID string `json:"team_id" dynamodbav:"team_id"`
+	Reason string `json:"reason" dynamodbav:"reason"`
+	// Delta is the change in reputation. It is zero for refills, which reset
+	// reputation without reading it first.
+	Delta      int64 `json:"delta" dynamodbav:"delta"`
+	Reputation int64 `json:"reputation" dynamodbav:"reputation"`
+	// Priority is the priority of the spend behind a penalty or reward.
+	Priority    int64 `json:"priority,omitempty" dynamodbav:"priority,omitempty"`
+	TimestampMs int64 `json:"timestamp_ms" dynamodbav:"timestamp_ms"`
+	// DedupeKey names the penalty or reward, e.g. the refill period a
+	// penalty is for, so that applying it again does nothing.
+	DedupeKey string `json:"dedupe_key,omitempty" dynamodbav:"dedupe_key,omitempty"`
+}
+
+// logReputation appends event to the reputation log, if any, and publishes
+// it as a ReputationChanged.
+func (tm *Manager) logReputation(event ReputationEvent) {
+	if event.TimestampMs == 0 {
+		event.TimestampMs = tm.clock.Now().UnixMilli()
+	}
+	tm.publish(events.ReputationChanged{
+		TeamID:       event.TeamID,
+		Reason:       event.Reason,
+		Delta:        event.Delta,
+		Reputation:   event.Reputation,
+		Priority:     event.Priority,
+		OccurredAtMs: event.TimestampMs,
+	})
+
+	if tm.reputationLog == nil {
+		return
+	}
+	if err := tm.reputationLog.write(event); err != nil {
+		tm.logger.Warn("failed to write reputation event", zap.Error(err))
+	}
+}
+
+// DefaultReputationPenalty takes 10 reputation from a team once it has used
+// priority 10 more than 5 times.
+var DefaultReputationPenalty = ReputationPenalty{
+	Priority:  10,
+	Threshold: 5,
+	Base:      10,
+}
+
+// ReputationPenalty lowers a team's reputation for overusing Priority: the
+// first spend at Priority once usage exceeds Threshold costs the team Base
+// reputation, capped at MaxDecrement when it is non-zero. The penalty is
+// applied at most once per refill, so heavy users don't spiral down.
+// Reputation never drops below the Manager's reputation floor, 0 unless
+// WithReputationFloor is set. PriorityQuotas count usage per day instead,
+// with penalties that can grow with continued overuse, and replace the
+// penalty when set.
+type ReputationPenalty struct {
+	Priority  int64 `json:"priority"`
+	Threshold int   `json:"threshold"`
+	Base      int64 `json:"base"`
+	// Deprecated: the penalty is applied once per refill, so it no longer
+	// grows. Use a QuotaPenalize priority quota for graduated penalties.
+	PerOveruse   int64 `json:"per_overuse"`
+	MaxDecrement int64 `json:"max_decrement"`
+}
+
+// decrement returns the reputation to take once usage exceeds the
+// threshold.
+func (p ReputationPenalty) decrement() int64 {
+	g := GraduatedPenalty{Base: p.Base, MaxDecrement: p.MaxDecrement}
+	return g.decrement(1)
+}
+
+// penalizeReputation applies the configured ReputationPenalty after a spend.
+// row is the team's token row including the spend of bid.
+func (tm *Manager) penalizeReputation(ctx context.Context, bid *Bid, row *TokenDBRow) error {
+	penalty := tm.reputationPenalty
+	if bid.Priority != penalty.Priority || row.PriorityUsage[int(penalty.Priority)] <= penalty.Threshold {
+		return nil
+	}
+
+	key := fmt.Sprintf("penalty#%d#%d", penalty.Priority, row.LastRefillTime)
+	return tm.takeReputation(ctx, bid, penalty.decrement(), key)
+}
+
+// takeReputation lowers the bidding team's reputation by decrease as a
+// penalty for bid, down to the reputation floor, at most once per
+// dedupeKey.
+func (tm *Manager) takeReputation(ctx context.Context, bid *Bid, decrease int64, dedupeKey string) error {
+	if decrease == 0 {
+		return nil
+	}
+	return tm.adjustReputation(ctx, ReputationEvent{
+		TeamID:    bid.TeamID,
+		Reason:    ReputationEventPenalty,
+		Delta:     -decrease,
+		Priority:  bid.Priority,
+		DedupeKey: dedupeKey,
+	})
+}
+
+// adjustReputation changes a team's reputation by e.Delta, clamped to
+// between the reputation floor and the max reputation, and logs the change.
+// An event whose dedupe key was applied before does nothing.
+func (tm *Manager) adjustReputation(ctx context.Context, e ReputationEvent) error {
+	if e.DedupeKey != "" {
+		e.Pk = GetReputationEventPK(e.TeamID, e.DedupeKey)
+	}
+
+	for range refillAttempts {
+		row, err := tm.store.GetTokenRow(ctx, e.TeamID, true)
+		if err != nil {
+			return err
+		}
+
+		applied := e
+		applied.TimestampMs = tm.clock.Now().UnixMilli()
+		err = tm.store.AdjustReputation(ctx, &applied, row, tm.reputationFloor, tm.maxReputation)
+		if errors.Is(err, ErrDuplicateReputationEvent) {
+			return nil
+		}
+		if errors.Is(err, ErrConditionFailed) {
+			// the row changed under us; adjust the new one
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if applied.Delta != 0 {
+			tm.logReputation(applied)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: reputation of team %s", ErrAuctionConflict, e.TeamID)
+}
+
+// clampReputation returns reputation moved by delta, kept within floor and
+// ceiling. A reputation already outside them is never moved further out.
+func clampReputation(reputation, delta, floor, ceiling int64) int64 {
+	if delta < 0 {
+		return max(reputation+delta, min(floor, reputation))
+	}
+	return min(reputation+delta, max(ceiling, reputation))
+}
+
+// ReputationReward raises a team's reputation for sticking to low
+// priorities. Every Threshold spends across the watched Priorities earns the
+// team Amount reputation, up to the Manager's max reputation. A zero Threshold
+// disables the reward.
+type ReputationReward struct {
+	Priorities []int64 `json:"priorities"`
+	Threshold  int     `json:"threshold"`
+	Amount     int64   `json:"amount"`
+}
+
+func (r ReputationReward) enabled() bool {
+	return r.Threshold > 0 && r.Amount > 0 && len(r.Priorities) > 0
+}
+
+// rewardReputation applies the configured ReputationReward after a spend.
+// row is the team's token row including the spend of bid.
+func (tm *Manager) rewardReputation(ctx context.Context, bid *Bid, row *TokenDBRow) error {
+	reward := tm.reputationReward
+	if !reward.enabled() || !slices.Contains(reward.Priorities, bid.Priority) {
+		return nil
+	}
+
+	var usage int
+	for _, p := range reward.Priorities {
+		usage += row.PriorityUsage[int(p)]
+	}
+	if usage%reward.Threshold != 0 {
+		return nil
+	}
+
+	return tm.adjustReputation(ctx, ReputationEvent{
+		TeamID:   bid.TeamID,
+		Reason:   ReputationEventReward,
+		Delta:    reward.Amount,
+		Priority: bid.Priority,
+		// usage only grows until a refill resets it, so each reward is
+		// earned once per refill
+		DedupeKey: fmt.Sprintf("reward#%d#%d", row.LastRefillTime, usage),
+	})
+}
+
+// ReputationRecovery regenerates reputation over time: every Interval since a
+// team's reputation last recovered credits it Amount reputation, without
+// taking it above Cap.
+//
+// Like DripRefill, recovery is applied lazily whenever a team's balance is
+// read, using the last_reputation_recovery_ms on its token row. Teams created
+// before recovery was enabled start recovering from their first read.
+type ReputationRecovery struct {
+	Interval time.Duration
+	Amount   int64
+	// Cap defaults to the Manager's max reputation.
+	Cap int64
+}
+
+// recoverReputation credits a team the reputation its row has regenerated by
+// nowMs, updating row in place. As with drip, a row that changed since it
+// was read is left for the next read.
+func (tm *Manager) recoverReputation(ctx context.Context, row *TokenDBRow, nowMs int64) error {
+	if tm.reputationRecovery == nil {
+		return nil
+	}
+	r := tm.reputationRecovery
+
+	var increase, recoveredMs int64
+	if row.LastReputationRecoveryMs == 0 {
+		// start the clock without crediting the time before recovery existed
+		recoveredMs = nowMs
+	} else {
+		intervalMs := r.Interval.Milliseconds()
+		periods := (nowMs - row.LastReputationRecoveryMs) / intervalMs
+		if periods <= 0 {
+			return nil
+		}
+		increase = max(min(periods*r.Amount, r.Cap-row.ReputationScore), 0)
+		recoveredMs = row.LastReputationRecoveryMs + periods*intervalMs
+	}
+
+	err := tm.store.RecoverReputation(ctx, row.TeamID, increase, r.Cap, row.LastReputationRecoveryMs, recoveredMs)
+	if errors.Is(err, ErrConditionFailed) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	row.ReputationScore += increase
+	row.LastReputationRecoveryMs = recoveredMs
+	row.Version++
+	if increase > 0 {
+		tm.logReputation(ReputationEvent{
+			TeamID:     row.TeamID,
+			Reason:     ReputationEventRecovery,
+			Delta:      increase,
+			Reputation: row.ReputationScore,
+		})
+	}
+	return nil
+}
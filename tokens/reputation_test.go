@@ -0,0 +1,267 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// reputationRacingStore runs race once, just before the first reputation
+// adjustment reaches the store, as a concurrent writer would.
+type reputationRacingStore struct {
+	Store
+	race func()
+	once sync.Once
+}
+
+func (s *reputationRacingStore) AdjustReputation(ctx context.Context, e *ReputationEvent, observed *TokenDBRow, floor, ceiling int64) error {
+	s.once.Do(s.race)
+	return s.Store.AdjustReputation(ctx, e, observed, floor, ceiling)
+}
+
+func TestRewardReputationConcurrentChange(t *testing.T) {
+	tests := []struct {
+		name           string
+		race           bool
+		wantReputation int64
+	}{
+		{name: "no concurrent change", wantReputation: 55},
+		// the penalty lands between the reward's read and write; the reward
+		// must apply on top of it rather than overwrite it
+		{name: "penalty between read and write", race: true, wantReputation: 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := NewMemoryStore()
+			store := &reputationRacingStore{Store: mem, race: func() {}}
+			tm := newTestManager(t, []string{"a"}, WithStore(store),
+				WithReputationReward(ReputationReward{Priorities: []int64{1}, Threshold: 1, Amount: 5}))
+			mem.tokens["a"].ReputationScore = 50
+
+			if tt.race {
+				store.race = func() {
+					row := tokenRow(t, tm, "a")
+					penalty := &ReputationEvent{TeamID: "a", Reason: ReputationEventPenalty, Delta: -30}
+					if err := mem.AdjustReputation(ctx, penalty, row, 0, MaxReputationScore); err != nil {
+						t.Fatalf("AdjustReputation: %v", err)
+					}
+				}
+			}
+
+			if _, err := tm.SpendTokens(ctx, &Bid{TeamID: "a", UserID: "u", Priority: 1}); err != nil {
+				t.Fatalf("SpendTokens: %v", err)
+			}
+			if got := tokenRow(t, tm, "a").ReputationScore; got != tt.wantReputation {
+				t.Errorf("reputation = %d, want %d", got, tt.wantReputation)
+			}
+		})
+	}
+}
+
+func TestRewardReputationAfterRefill(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryStore()
+	tm := newTestManager(t, []string{"a"}, WithStore(mem),
+		WithReputationReward(ReputationReward{Priorities: []int64{1}, Threshold: 2, Amount: 5}))
+	spend := func() {
+		t.Helper()
+		if _, err := tm.SpendTokens(ctx, &Bid{TeamID: "a", UserID: "u", Priority: 1}); err != nil {
+			t.Fatalf("SpendTokens: %v", err)
+		}
+	}
+
+	spend()
+	if err := tm.RefillTokens(ctx, []string{"a"}); err != nil {
+		t.Fatalf("RefillTokens: %v", err)
+	}
+	if usage := tokenRow(t, tm, "a").PriorityUsage[1]; usage != 0 {
+		t.Fatalf("priority 1 usage = %d after refill, want 0", usage)
+	}
+	mem.tokens["a"].ReputationScore = 50
+
+	// the spend before the refill doesn't count towards the threshold
+	spend()
+	if got := tokenRow(t, tm, "a").ReputationScore; got != 50 {
+		t.Errorf("reputation = %d after 1 spend since refill, want 50", got)
+	}
+	spend()
+	if got := tokenRow(t, tm, "a").ReputationScore; got != 55 {
+		t.Errorf("reputation = %d after 2 spends since refill, want 55", got)
+	}
+}
+
+func TestRewardReputationConcurrentSpends(t *testing.T) {
+	const spends = 10
+	ctx := context.Background()
+	mem := NewMemoryStore()
+	tm := newTestManager(t, []string{"a"}, WithStore(mem),
+		WithReputationReward(ReputationReward{Priorities: []int64{1}, Threshold: 1, Amount: 2}))
+	mem.tokens["a"].ReputationScore = 50
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		spent int64
+	)
+	for range spends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := tm.SpendTokens(ctx, &Bid{TeamID: "a", UserID: "u", Priority: 1})
+			if errors.Is(err, ErrAuctionConflict) {
+				// outraced too often to reprice; no spend, no reward
+				return
+			}
+			if err != nil {
+				t.Errorf("SpendTokens: %v", err)
+				return
+			}
+			mu.Lock()
+			spent++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// every spend earns its own reward, none lost to another's write
+	if got, want := tokenRow(t, tm, "a").ReputationScore, 50+spent*2; got != want {
+		t.Errorf("reputation = %d after %d spends, want %d", got, spent, want)
+	}
+}
+
+func TestReputationPenalty(t *testing.T) {
+	tests := []struct {
+		name     string
+		penalty  ReputationPenalty
+		start    int64
+		priority int64
+		spends   int
+		want     int64
+	}{
+		{
+			name:    "at the threshold",
+			penalty: ReputationPenalty{Priority: 3, Threshold: 2, Base: 10},
+			start:   50, priority: 3, spends: 2, want: 50,
+		},
+		{
+			name:    "past the threshold",
+			penalty: ReputationPenalty{Priority: 3, Threshold: 2, Base: 10},
+			start:   50, priority: 3, spends: 3, want: 40,
+		},
+		{
+			name:    "once per refill",
+			penalty: ReputationPenalty{Priority: 3, Threshold: 2, Base: 10},
+			start:   50, priority: 3, spends: 6, want: 40,
+		},
+		{
+			name:    "capped by max decrement",
+			penalty: ReputationPenalty{Priority: 3, Threshold: 2, Base: 30, MaxDecrement: 15},
+			start:   50, priority: 3, spends: 3, want: 35,
+		},
+		{
+			name:    "floored at zero",
+			penalty: ReputationPenalty{Priority: 3, Threshold: 2, Base: 10},
+			start:   5, priority: 3, spends: 3, want: 0,
+		},
+		{
+			name:    "other priority",
+			penalty: ReputationPenalty{Priority: 3, Threshold: 2, Base: 10},
+			start:   50, priority: 2, spends: 6, want: 50,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := NewMemoryStore()
+			tm := newTestManager(t, []string{"a"}, WithStore(mem), WithReputationPenalty(tt.penalty))
+			mem.tokens["a"].ReputationScore = tt.start
+
+			for range tt.spends {
+				if _, err := tm.SpendTokens(ctx, &Bid{TeamID: "a", UserID: "u", Priority: tt.priority}); err != nil {
+					t.Fatalf("SpendTokens: %v", err)
+				}
+			}
+			if got := tokenRow(t, tm, "a").ReputationScore; got != tt.want {
+				t.Errorf("reputation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// recoveryRacingStore runs race once, just before the first reputation
+// recovery reaches the store.
+type recoveryRacingStore struct {
+	Store
+	race func()
+	once sync.Once
+}
+
+func (s *recoveryRacingStore) RecoverReputation(ctx context.Context, teamID string, increase, ceiling, observedMs, recoveredMs int64) error {
+	s.once.Do(s.race)
+	return s.Store.RecoverReputation(ctx, teamID, increase, ceiling, observedMs, recoveredMs)
+}
+
+func TestRecoverReputationConcurrentRaise(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryStore()
+	clock := newTestClock()
+	store := &recoveryRacingStore{Store: mem, race: func() {}}
+	tm := newTestManager(t, []string{"a"}, WithStore(store), WithClock(clock),
+		WithReputationRecovery(ReputationRecovery{Interval: time.Minute, Amount: 10}))
+	mem.tokens["a"].ReputationScore = 50
+	mem.tokens["a"].LastReputationRecoveryMs = clock.Now().Add(-10 * time.Minute).UnixMilli()
+
+	// a reward lands between the recovery's read and write; the recovery
+	// computed from the old reputation must not take it over the cap
+	store.race = func() {
+		row := tokenRow(t, tm, "a")
+		reward := &ReputationEvent{TeamID: "a", Reason: ReputationEventReward, Delta: 40}
+		if err := mem.AdjustReputation(ctx, reward, row, 0, MaxReputationScore); err != nil {
+			t.Fatalf("AdjustReputation: %v", err)
+		}
+	}
+	if _, _, err := tm.GetTokenBalance(ctx, "a"); err != nil {
+		t.Fatalf("GetTokenBalance: %v", err)
+	}
+	if got := tokenRow(t, tm, "a").ReputationScore; got != 90 {
+		t.Errorf("reputation after the raced recovery = %d, want 90", got)
+	}
+
+	// the next read recovers what's left under the cap
+	_, reputation, err := tm.GetTokenBalance(ctx, "a")
+	if err != nil {
+		t.Fatalf("GetTokenBalance: %v", err)
+	}
+	if reputation != MaxReputationScore {
+		t.Errorf("reputation = %d, want %d", reputation, MaxReputationScore)
+	}
+}
+
+// failingReputationStore fails every reputation adjustment.
+type failingReputationStore struct {
+	Store
+}
+
+func (s *failingReputationStore) AdjustReputation(ctx context.Context, e *ReputationEvent, observed *TokenDBRow, floor, ceiling int64) error {
+	return errors.New("reputation write failed")
+}
+
+func TestSpendSurvivesReputationFailure(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryStore()
+	tm := newTestManager(t, []string{"a"}, WithStore(&failingReputationStore{Store: mem}),
+		WithReputationReward(ReputationReward{Priorities: []int64{1}, Threshold: 1, Amount: 5}))
+
+	// the spend committed before the reward failed, so it's reported as
+	// one rather than retried or refunded
+	balance, err := tm.SpendTokens(ctx, &Bid{TeamID: "a", UserID: "u", Priority: 1})
+	if err != nil {
+		t.Fatalf("SpendTokens: %v", err)
+	}
+	if want := int64(InitialTokenCount - 1); balance != want || tokenRow(t, tm, "a").TokenBalance != want {
+		t.Errorf("balance = %d, want %d", balance, want)
+	}
+}
@@ -0,0 +1,648 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"go.uber.org/zap"
+	"golang.org/x/exp/rand"
+)
+
+const (
+	defaultRetryMaxAttempts    = 5
+	defaultRetryInitialBackoff = 25 * time.Millisecond
+	defaultRetryMaxBackoff     = time.Second
+)
+
+// RetryConfig tunes a RetryStore. Zero fields take their defaults.
+type RetryConfig struct {
+	// MaxAttempts is how many times a call is made before its error is
+	// returned. It defaults to 5.
+	MaxAttempts int
+	// InitialBackoff caps the wait before the first retry, doubling with
+	// each one up to MaxBackoff; each wait is drawn at random below its cap.
+	// They default to 25 milliseconds and a second.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Budget bounds the time spent on one call, retries included. A call
+	// never retries past its context's deadline either. Zero means only the
+	// deadline and MaxAttempts bound it.
+	Budget time.Duration
+}
+
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultRetryMaxBackoff
+	}
+	return c
+}
+
+// retryMode is which failures of a call are safe to retry.
+type retryMode int
+
+const (
+	// retryTransient retries every transient failure. It suits reads and
+	// writes that can be repeated, for which a failure that may have been
+	// applied anyway, such as a 5xx, does no harm.
+	retryTransient retryMode = iota
+	// retryUnapplied retries only failures DynamoDB guarantees weren't
+	// applied, throttling and transaction conflicts. It suits conditional
+	// and incremental writes, which a repeat would apply twice or fail.
+	retryUnapplied
+)
+
+// RetryStore retries the transient failures of another Store, such as
+// DynamoDB throttling, 5xx responses and transaction conflicts, with
+// exponential backoff and jitter. These come on top of the AWS SDK's own
+// retries, which give up quickly under sustained throttling and never
+// retry transaction conflicts. See WithRetry.
+type RetryStore struct {
+	store  Store
+	cfg    RetryConfig
+	logger *zap.Logger
+	clock  Clock
+}
+
+// NewRetryStore returns store with its calls retried as configured. Retries
+// are logged at debug level to logger, which may be nil. The Budget is timed
+// by the clock given with WithStoreClock.
+func NewRetryStore(store Store, cfg RetryConfig, logger *zap.Logger, opts ...StoreOption) *RetryStore {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	o := newStoreOptions(opts)
+	return &RetryStore{store: store, cfg: cfg.withDefaults(), logger: logger, clock: o.clock}
+}
+
+// retry calls fn until it succeeds, fails in a way mode doesn't retry, or
+// runs out of attempts or time.
+func (s *RetryStore) retry(ctx context.Context, op string, mode retryMode, fn func(ctx context.Context) error) error {
+	var budgetEnd time.Time
+	if s.cfg.Budget > 0 {
+		budgetEnd = s.clock.Now().Add(s.cfg.Budget)
+	}
+
+	backoff := s.cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt == s.cfg.MaxAttempts || !retryable(err, mode) {
+			return err
+		}
+
+		wait := time.Duration(rand.Int63n(int64(backoff) + 1))
+		if !budgetEnd.IsZero() && s.clock.Now().Add(wait).After(budgetEnd) {
+			return err
+		}
+		// context deadlines are set by the wall clock, whatever the store's
+		if d, ok := ctx.Deadline(); ok && time.Until(d) < wait {
+			return err
+		}
+		s.logger.Debug(
+			"retrying store call",
+			zap.String("op", op),
+			zap.Int("attempt", attempt),
+			zap.Duration("wait", wait),
+			zap.Error(err),
+		)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, s.cfg.MaxBackoff)
+	}
+}
+
+func retryValue[T any](ctx context.Context, s *RetryStore, op string, mode retryMode, fn func(ctx context.Context) (T, error)) (T, error) {
+	var v T
+	err := s.retry(ctx, op, mode, func(ctx context.Context) error {
+		var err error
+		v, err = fn(ctx)
+		return err
+	})
+	return v, err
+}
+
+// retryable reports whether a call that failed with err may succeed if
+// retried under mode.
+func retryable(err error, mode retryMode) bool {
+	if unapplied(err) {
+		return true
+	}
+	if mode != retryTransient {
+		return false
+	}
+
+	var internalErr *types.InternalServerError
+	if errors.As(err, &internalErr) {
+		return true
+	}
+	var respErr *awshttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() >= 500
+}
+
+// unapplied reports whether err is a throttling or transaction conflict
+// failure, which DynamoDB rejects before applying anything.
+func unapplied(err error) bool {
+	var canceledErr *types.TransactionCanceledException
+	if errors.As(err, &canceledErr) {
+		// a transaction is only worth retrying if nothing but conflicts and
+		// throttling cancelled it
+		retry := false
+		for _, reason := range canceledErr.CancellationReasons {
+			switch code := aws.ToString(reason.Code); code {
+			case "None", "":
+			case "TransactionConflict", "ThrottlingError", "ProvisionedThroughputExceeded":
+				retry = true
+			default:
+				return false
+			}
+		}
+		return retry
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "ProvisionedThroughputExceededException", "RequestLimitExceeded",
+			"ThrottlingException", "TransactionConflictException":
+			return true
+		}
+	}
+	return false
+}
+
+func (s *RetryStore) EnsureSchema(ctx context.Context) error {
+	return s.store.EnsureSchema(ctx)
+}
+
+func (s *RetryStore) Truncate(ctx context.Context) error {
+	return s.store.Truncate(ctx)
+}
+
+func (s *RetryStore) GetTokenRow(ctx context.Context, teamID string, consistent bool) (*TokenDBRow, error) {
+	return retryValue(ctx, s, "GetTokenRow", retryTransient, func(ctx context.Context) (*TokenDBRow, error) {
+		return s.store.GetTokenRow(ctx, teamID, consistent)
+	})
+}
+
+func (s *RetryStore) BatchGetTokenRows(ctx context.Context, teamIDs []string) (map[string]TokenDBRow, error) {
+	return retryValue(ctx, s, "BatchGetTokenRows", retryTransient, func(ctx context.Context) (map[string]TokenDBRow, error) {
+		return s.store.BatchGetTokenRows(ctx, teamIDs)
+	})
+}
+
+func (s *RetryStore) EnsureTokenRow(ctx context.Context, row *TokenDBRow) error {
+	return s.retry(ctx, "EnsureTokenRow", retryTransient, func(ctx context.Context) error {
+		return s.store.EnsureTokenRow(ctx, row)
+	})
+}
+
+func (s *RetryStore) RefillTokenRow(ctx context.Context, teamID string, balance, observed int64, balances map[string]int64, usage map[int]int, reputation, nowMs int64) error {
+	return s.retry(ctx, "RefillTokenRow", retryUnapplied, func(ctx context.Context) error {
+		return s.store.RefillTokenRow(ctx, teamID, balance, observed, balances, usage, reputation, nowMs)
+	})
+}
+
+func (s *RetryStore) DripTokenRow(ctx context.Context, teamID string, credit, observedMs, refillMs int64) error {
+	return s.retry(ctx, "DripTokenRow", retryUnapplied, func(ctx context.Context) error {
+		return s.store.DripTokenRow(ctx, teamID, credit, observedMs, refillMs)
+	})
+}
+
+func (s *RetryStore) CreateTokenRow(ctx context.Context, row *TokenDBRow) error {
+	return s.retry(ctx, "CreateTokenRow", retryUnapplied, func(ctx context.Context) error {
+		return s.store.CreateTokenRow(ctx, row)
+	})
+}
+
+func (s *RetryStore) SetTeamStatus(ctx context.Context, u TeamStatusUpdate) (*TokenDBRow, error) {
+	return retryValue(ctx, s, "SetTeamStatus", retryUnapplied, func(ctx context.Context) (*TokenDBRow, error) {
+		return s.store.SetTeamStatus(ctx, u)
+	})
+}
+
+func (s *RetryStore) DeleteTeam(ctx context.Context, teamID string, observed, nowMs int64) error {
+	return s.retry(ctx, "DeleteTeam", retryUnapplied, func(ctx context.Context) error {
+		return s.store.DeleteTeam(ctx, teamID, observed, nowMs)
+	})
+}
+
+func (s *RetryStore) ScanTokenRows(ctx context.Context) ([]TokenDBRow, error) {
+	return retryValue(ctx, s, "ScanTokenRows", retryTransient, func(ctx context.Context) ([]TokenDBRow, error) {
+		return s.store.ScanTokenRows(ctx)
+	})
+}
+
+func (s *RetryStore) UpdateBalance(ctx context.Context, u BalanceUpdate) (*TokenDBRow, error) {
+	return retryValue(ctx, s, "UpdateBalance", retryUnapplied, func(ctx context.Context) (*TokenDBRow, error) {
+		return s.store.UpdateBalance(ctx, u)
+	})
+}
+
+func (s *RetryStore) UpdateBalances(ctx context.Context, updates []BalanceUpdate) ([]*TokenDBRow, error) {
+	return retryValue(ctx, s, "UpdateBalances", retryUnapplied, func(ctx context.Context) ([]*TokenDBRow, error) {
+		return s.store.UpdateBalances(ctx, updates)
+	})
+}
+
+func (s *RetryStore) CountAuctionEntry(ctx context.Context, teamID string) error {
+	return s.retry(ctx, "CountAuctionEntry", retryUnapplied, func(ctx context.Context) error {
+		return s.store.CountAuctionEntry(ctx, teamID)
+	})
+}
+
+func (s *RetryStore) GetPacingRow(ctx context.Context, teamID string) (*PacingRow, error) {
+	return retryValue(ctx, s, "GetPacingRow", retryTransient, func(ctx context.Context) (*PacingRow, error) {
+		return s.store.GetPacingRow(ctx, teamID)
+	})
+}
+
+func (s *RetryStore) AddPacedSpend(ctx context.Context, teamID string, amount, windowStartMs, limit int64) error {
+	return s.retry(ctx, "AddPacedSpend", retryUnapplied, func(ctx context.Context) error {
+		return s.store.AddPacedSpend(ctx, teamID, amount, windowStartMs, limit)
+	})
+}
+
+func (s *RetryStore) RollPacingWindow(ctx context.Context, teamID string, observedStartMs, windowStartMs, prevSpent, spent int64) error {
+	return s.retry(ctx, "RollPacingWindow", retryUnapplied, func(ctx context.Context) error {
+		return s.store.RollPacingWindow(ctx, teamID, observedStartMs, windowStartMs, prevSpent, spent)
+	})
+}
+
+func (s *RetryStore) RefundPacedSpend(ctx context.Context, teamID string, amount, windowStartMs int64) error {
+	return s.retry(ctx, "RefundPacedSpend", retryUnapplied, func(ctx context.Context) error {
+		return s.store.RefundPacedSpend(ctx, teamID, amount, windowStartMs)
+	})
+}
+
+func (s *RetryStore) GetQuotaRow(ctx context.Context, teamID string) (*QuotaRow, error) {
+	return retryValue(ctx, s, "GetQuotaRow", retryTransient, func(ctx context.Context) (*QuotaRow, error) {
+		return s.store.GetQuotaRow(ctx, teamID)
+	})
+}
+
+func (s *RetryStore) AddQuotaUsage(ctx context.Context, teamID string, priority, dayStartMs int64, limit int) error {
+	return s.retry(ctx, "AddQuotaUsage", retryUnapplied, func(ctx context.Context) error {
+		return s.store.AddQuotaUsage(ctx, teamID, priority, dayStartMs, limit)
+	})
+}
+
+func (s *RetryStore) RollQuotaDay(ctx context.Context, teamID string, observedStartMs, dayStartMs, priority int64) error {
+	return s.retry(ctx, "RollQuotaDay", retryUnapplied, func(ctx context.Context) error {
+		return s.store.RollQuotaDay(ctx, teamID, observedStartMs, dayStartMs, priority)
+	})
+}
+
+func (s *RetryStore) RefundQuotaUsage(ctx context.Context, teamID string, priority, dayStartMs int64) error {
+	return s.retry(ctx, "RefundQuotaUsage", retryUnapplied, func(ctx context.Context) error {
+		return s.store.RefundQuotaUsage(ctx, teamID, priority, dayStartMs)
+	})
+}
+
+func (s *RetryStore) BatchGetFrequencyRows(ctx context.Context, userID string, teamIDs []string) (map[string]FrequencyRow, error) {
+	return retryValue(ctx, s, "BatchGetFrequencyRows", retryTransient, func(ctx context.Context) (map[string]FrequencyRow, error) {
+		return s.store.BatchGetFrequencyRows(ctx, userID, teamIDs)
+	})
+}
+
+func (s *RetryStore) PutFrequencyRow(ctx context.Context, row *FrequencyRow) error {
+	return s.retry(ctx, "PutFrequencyRow", retryTransient, func(ctx context.Context) error {
+		return s.store.PutFrequencyRow(ctx, row)
+	})
+}
+
+func (s *RetryStore) SetTokenBalance(ctx context.Context, teamID string, balance, observed, nowMs int64) error {
+	return s.retry(ctx, "SetTokenBalance", retryUnapplied, func(ctx context.Context) error {
+		return s.store.SetTokenBalance(ctx, teamID, balance, observed, nowMs)
+	})
+}
+
+func (s *RetryStore) AdjustReputation(ctx context.Context, e *ReputationEvent, observed *TokenDBRow, floor, ceiling int64) error {
+	return s.retry(ctx, "AdjustReputation", retryUnapplied, func(ctx context.Context) error {
+		return s.store.AdjustReputation(ctx, e, observed, floor, ceiling)
+	})
+}
+
+func (s *RetryStore) RecoverReputation(ctx context.Context, teamID string, increase, ceiling, observedMs, recoveredMs int64) error {
+	return s.retry(ctx, "RecoverReputation", retryUnapplied, func(ctx context.Context) error {
+		return s.store.RecoverReputation(ctx, teamID, increase, ceiling, observedMs, recoveredMs)
+	})
+}
+
+func (s *RetryStore) TransferTokens(ctx context.Context, t *TransferRow) (from, to *TokenDBRow, err error) {
+	err = s.retry(ctx, "TransferTokens", retryUnapplied, func(ctx context.Context) error {
+		var err error
+		from, to, err = s.store.TransferTokens(ctx, t)
+		return err
+	})
+	return from, to, err
+}
+
+func (s *RetryStore) AdjustBalance(ctx context.Context, a *AdjustmentRow) (*TokenDBRow, error) {
+	return retryValue(ctx, s, "AdjustBalance", retryUnapplied, func(ctx context.Context) (*TokenDBRow, error) {
+		return s.store.AdjustBalance(ctx, a)
+	})
+}
+
+func (s *RetryStore) PlaceHold(ctx context.Context, hold *HoldRow, cooldownStartMs int64, winningBid *BidRow, reservation *HoldRow, lock *LockRef) error {
+	return s.retry(ctx, "PlaceHold", retryUnapplied, func(ctx context.Context) error {
+		return s.store.PlaceHold(ctx, hold, cooldownStartMs, winningBid, reservation, lock)
+	})
+}
+
+func (s *RetryStore) ReserveTokens(ctx context.Context, hold *HoldRow) error {
+	return s.retry(ctx, "ReserveTokens", retryUnapplied, func(ctx context.Context) error {
+		return s.store.ReserveTokens(ctx, hold)
+	})
+}
+
+func (s *RetryStore) GetHold(ctx context.Context, holdID string) (*HoldRow, error) {
+	return retryValue(ctx, s, "GetHold", retryTransient, func(ctx context.Context) (*HoldRow, error) {
+		return s.store.GetHold(ctx, holdID)
+	})
+}
+
+func (s *RetryStore) ConfirmHold(ctx context.Context, hold *HoldRow, nowMs int64) (*TokenDBRow, error) {
+	return retryValue(ctx, s, "ConfirmHold", retryUnapplied, func(ctx context.Context) (*TokenDBRow, error) {
+		return s.store.ConfirmHold(ctx, hold, nowMs)
+	})
+}
+
+func (s *RetryStore) ReleaseHold(ctx context.Context, hold *HoldRow, nowMs int64) error {
+	return s.retry(ctx, "ReleaseHold", retryUnapplied, func(ctx context.Context) error {
+		return s.store.ReleaseHold(ctx, hold, nowMs)
+	})
+}
+
+func (s *RetryStore) ExpiredHolds(ctx context.Context, nowMs int64) ([]HoldRow, error) {
+	return retryValue(ctx, s, "ExpiredHolds", retryTransient, func(ctx context.Context) ([]HoldRow, error) {
+		return s.store.ExpiredHolds(ctx, nowMs)
+	})
+}
+
+func (s *RetryStore) AcquireLock(ctx context.Context, userID, owner string, nowMs, expiresAtMs int64) error {
+	return s.retry(ctx, "AcquireLock", retryUnapplied, func(ctx context.Context) error {
+		return s.store.AcquireLock(ctx, userID, owner, nowMs, expiresAtMs)
+	})
+}
+
+func (s *RetryStore) ReleaseLock(ctx context.Context, userID, owner string) error {
+	return s.retry(ctx, "ReleaseLock", retryUnapplied, func(ctx context.Context) error {
+		return s.store.ReleaseLock(ctx, userID, owner)
+	})
+}
+
+func (s *RetryStore) ClaimIdempotencyKey(ctx context.Context, row *IdempotencyRow, nowMs int64) error {
+	return s.retry(ctx, "ClaimIdempotencyKey", retryUnapplied, func(ctx context.Context) error {
+		return s.store.ClaimIdempotencyKey(ctx, row, nowMs)
+	})
+}
+
+func (s *RetryStore) GetIdempotencyRow(ctx context.Context, key string) (*IdempotencyRow, error) {
+	return retryValue(ctx, s, "GetIdempotencyRow", retryTransient, func(ctx context.Context) (*IdempotencyRow, error) {
+		return s.store.GetIdempotencyRow(ctx, key)
+	})
+}
+
+func (s *RetryStore) PutIdempotencyRow(ctx context.Context, row *IdempotencyRow) error {
+	return s.retry(ctx, "PutIdempotencyRow", retryTransient, func(ctx context.Context) error {
+		return s.store.PutIdempotencyRow(ctx, row)
+	})
+}
+
+func (s *RetryStore) DeleteIdempotencyRow(ctx context.Context, key string) error {
+	return s.retry(ctx, "DeleteIdempotencyRow", retryTransient, func(ctx context.Context) error {
+		return s.store.DeleteIdempotencyRow(ctx, key)
+	})
+}
+
+func (s *RetryStore) PutBids(ctx context.Context, rows []*BidRow) error {
+	return s.retry(ctx, "PutBids", retryTransient, func(ctx context.Context) error {
+		return s.store.PutBids(ctx, rows)
+	})
+}
+
+func (s *RetryStore) MarkBidAborted(ctx context.Context, pk, sk string, nowMs int64) error {
+	return s.retry(ctx, "MarkBidAborted", retryTransient, func(ctx context.Context) error {
+		return s.store.MarkBidAborted(ctx, pk, sk, nowMs)
+	})
+}
+
+func (s *RetryStore) QueryBids(ctx context.Context, q BidQuery) ([]BidRow, error) {
+	return retryValue(ctx, s, "QueryBids", retryTransient, func(ctx context.Context) ([]BidRow, error) {
+		return s.store.QueryBids(ctx, q)
+	})
+}
+
+func (s *RetryStore) QueryBidsByTarget(ctx context.Context, userID string) ([]BidRow, error) {
+	return retryValue(ctx, s, "QueryBidsByTarget", retryTransient, func(ctx context.Context) ([]BidRow, error) {
+		return s.store.QueryBidsByTarget(ctx, userID)
+	})
+}
+
+func (s *RetryStore) QueryExpiringBids(ctx context.Context, fromSec, toSec int64) ([]BidRow, error) {
+	return retryValue(ctx, s, "QueryExpiringBids", retryTransient, func(ctx context.Context) ([]BidRow, error) {
+		return s.store.QueryExpiringBids(ctx, fromSec, toSec)
+	})
+}
+
+func (s *RetryStore) GetBidArchiveWatermark(ctx context.Context) (int64, error) {
+	return retryValue(ctx, s, "GetBidArchiveWatermark", retryTransient, func(ctx context.Context) (int64, error) {
+		return s.store.GetBidArchiveWatermark(ctx)
+	})
+}
+
+func (s *RetryStore) AdvanceBidArchiveWatermark(ctx context.Context, fromSec, toSec int64) error {
+	return s.retry(ctx, "AdvanceBidArchiveWatermark", retryUnapplied, func(ctx context.Context) error {
+		return s.store.AdvanceBidArchiveWatermark(ctx, fromSec, toSec)
+	})
+}
+
+func (s *RetryStore) DeleteBids(ctx context.Context, pk string) (int, error) {
+	return retryValue(ctx, s, "DeleteBids", retryTransient, func(ctx context.Context) (int, error) {
+		return s.store.DeleteBids(ctx, pk)
+	})
+}
+
+func (s *RetryStore) PutAuctionWindow(ctx context.Context, w *AuctionWindow) error {
+	return s.retry(ctx, "PutAuctionWindow", retryUnapplied, func(ctx context.Context) error {
+		return s.store.PutAuctionWindow(ctx, w)
+	})
+}
+
+func (s *RetryStore) GetAuctionWindow(ctx context.Context, auctionID string) (*AuctionWindow, error) {
+	return retryValue(ctx, s, "GetAuctionWindow", retryTransient, func(ctx context.Context) (*AuctionWindow, error) {
+		return s.store.GetAuctionWindow(ctx, auctionID)
+	})
+}
+
+func (s *RetryStore) AddWindowBid(ctx context.Context, auctionID string, bid WindowBid, nowMs int64, maxBids int) error {
+	return s.retry(ctx, "AddWindowBid", retryUnapplied, func(ctx context.Context) error {
+		return s.store.AddWindowBid(ctx, auctionID, bid, nowMs, maxBids)
+	})
+}
+
+func (s *RetryStore) SettleAuctionWindow(ctx context.Context, auctionID string, result *AuctionResult, nowMs int64) error {
+	return s.retry(ctx, "SettleAuctionWindow", retryUnapplied, func(ctx context.Context) error {
+		return s.store.SettleAuctionWindow(ctx, auctionID, result, nowMs)
+	})
+}
+
+func (s *RetryStore) DueAuctionWindows(ctx context.Context, nowMs int64) ([]AuctionWindow, error) {
+	return retryValue(ctx, s, "DueAuctionWindows", retryTransient, func(ctx context.Context) ([]AuctionWindow, error) {
+		return s.store.DueAuctionWindows(ctx, nowMs)
+	})
+}
+
+func (s *RetryStore) PutDutchAuction(ctx context.Context, a *DutchAuction) error {
+	return s.retry(ctx, "PutDutchAuction", retryUnapplied, func(ctx context.Context) error {
+		return s.store.PutDutchAuction(ctx, a)
+	})
+}
+
+func (s *RetryStore) GetDutchAuction(ctx context.Context, auctionID string) (*DutchAuction, error) {
+	return retryValue(ctx, s, "GetDutchAuction", retryTransient, func(ctx context.Context) (*DutchAuction, error) {
+		return s.store.GetDutchAuction(ctx, auctionID)
+	})
+}
+
+func (s *RetryStore) ClaimDutchAuction(ctx context.Context, auctionID, teamID string, price, nowMs int64) error {
+	return s.retry(ctx, "ClaimDutchAuction", retryUnapplied, func(ctx context.Context) error {
+		return s.store.ClaimDutchAuction(ctx, auctionID, teamID, price, nowMs)
+	})
+}
+
+func (s *RetryStore) ReleaseDutchAuction(ctx context.Context, auctionID, teamID string) error {
+	return s.retry(ctx, "ReleaseDutchAuction", retryUnapplied, func(ctx context.Context) error {
+		return s.store.ReleaseDutchAuction(ctx, auctionID, teamID)
+	})
+}
+
+func (s *RetryStore) PutAutoBidPolicy(ctx context.Context, p *AutoBidPolicy) error {
+	return s.retry(ctx, "PutAutoBidPolicy", retryTransient, func(ctx context.Context) error {
+		return s.store.PutAutoBidPolicy(ctx, p)
+	})
+}
+
+func (s *RetryStore) GetAutoBidPolicy(ctx context.Context, teamID string) (*AutoBidPolicy, error) {
+	return retryValue(ctx, s, "GetAutoBidPolicy", retryTransient, func(ctx context.Context) (*AutoBidPolicy, error) {
+		return s.store.GetAutoBidPolicy(ctx, teamID)
+	})
+}
+
+func (s *RetryStore) DeleteAutoBidPolicy(ctx context.Context, teamID string) error {
+	return s.retry(ctx, "DeleteAutoBidPolicy", retryUnapplied, func(ctx context.Context) error {
+		return s.store.DeleteAutoBidPolicy(ctx, teamID)
+	})
+}
+
+func (s *RetryStore) ListAutoBidPolicies(ctx context.Context) ([]AutoBidPolicy, error) {
+	return retryValue(ctx, s, "ListAutoBidPolicies", retryTransient, func(ctx context.Context) ([]AutoBidPolicy, error) {
+		return s.store.ListAutoBidPolicies(ctx)
+	})
+}
+
+func (s *RetryStore) PutWebhook(ctx context.Context, w *Webhook) error {
+	return s.retry(ctx, "PutWebhook", retryTransient, func(ctx context.Context) error {
+		return s.store.PutWebhook(ctx, w)
+	})
+}
+
+func (s *RetryStore) GetWebhook(ctx context.Context, teamID string) (*Webhook, error) {
+	return retryValue(ctx, s, "GetWebhook", retryTransient, func(ctx context.Context) (*Webhook, error) {
+		return s.store.GetWebhook(ctx, teamID)
+	})
+}
+
+func (s *RetryStore) DeleteWebhook(ctx context.Context, teamID string) error {
+	return s.retry(ctx, "DeleteWebhook", retryUnapplied, func(ctx context.Context) error {
+		return s.store.DeleteWebhook(ctx, teamID)
+	})
+}
+
+func (s *RetryStore) PutWebhookDeadLetter(ctx context.Context, d *WebhookDeadLetter) error {
+	return s.retry(ctx, "PutWebhookDeadLetter", retryTransient, func(ctx context.Context) error {
+		return s.store.PutWebhookDeadLetter(ctx, d)
+	})
+}
+
+func (s *RetryStore) QueryWebhookDeadLetters(ctx context.Context, teamID string) ([]WebhookDeadLetter, error) {
+	return retryValue(ctx, s, "QueryWebhookDeadLetters", retryTransient, func(ctx context.Context) ([]WebhookDeadLetter, error) {
+		return s.store.QueryWebhookDeadLetters(ctx, teamID)
+	})
+}
+
+func (s *RetryStore) PutTeamStats(ctx context.Context, stats []TeamStats) error {
+	return s.retry(ctx, "PutTeamStats", retryTransient, func(ctx context.Context) error {
+		return s.store.PutTeamStats(ctx, stats)
+	})
+}
+
+func (s *RetryStore) GetTeamStats(ctx context.Context, teamID string) (*TeamStats, error) {
+	return retryValue(ctx, s, "GetTeamStats", retryTransient, func(ctx context.Context) (*TeamStats, error) {
+		return s.store.GetTeamStats(ctx, teamID)
+	})
+}
+
+func (s *RetryStore) ScanTeamStats(ctx context.Context) ([]TeamStats, error) {
+	return retryValue(ctx, s, "ScanTeamStats", retryTransient, func(ctx context.Context) ([]TeamStats, error) {
+		return s.store.ScanTeamStats(ctx)
+	})
+}
+
+func (s *RetryStore) PutAuction(ctx context.Context, row *AuctionRow) error {
+	return s.retry(ctx, "PutAuction", retryTransient, func(ctx context.Context) error {
+		return s.store.PutAuction(ctx, row)
+	})
+}
+
+func (s *RetryStore) QueryAuctions(ctx context.Context, userID string) ([]AuctionRow, error) {
+	return retryValue(ctx, s, "QueryAuctions", retryTransient, func(ctx context.Context) ([]AuctionRow, error) {
+		return s.store.QueryAuctions(ctx, userID)
+	})
+}
+
+func (s *RetryStore) PutAuctionAudit(ctx context.Context, a *AuctionAudit) error {
+	return s.retry(ctx, "PutAuctionAudit", retryUnapplied, func(ctx context.Context) error {
+		return s.store.PutAuctionAudit(ctx, a)
+	})
+}
+
+func (s *RetryStore) GetAuctionAudit(ctx context.Context, auctionID string) (*AuctionAudit, error) {
+	return retryValue(ctx, s, "GetAuctionAudit", retryTransient, func(ctx context.Context) (*AuctionAudit, error) {
+		return s.store.GetAuctionAudit(ctx, auctionID)
+	})
+}
+
+func (s *RetryStore) PutBalanceSnapshot(ctx context.Context, snapshot *BalanceSnapshot) error {
+	return s.retry(ctx, "PutBalanceSnapshot", retryTransient, func(ctx context.Context) error {
+		return s.store.PutBalanceSnapshot(ctx, snapshot)
+	})
+}
+
+func (s *RetryStore) QueryBalanceSnapshots(ctx context.Context, teamID string, startMs, endMs int64) ([]BalanceSnapshot, error) {
+	return retryValue(ctx, s, "QueryBalanceSnapshots", retryTransient, func(ctx context.Context) ([]BalanceSnapshot, error) {
+		return s.store.QueryBalanceSnapshots(ctx, teamID, startMs, endMs)
+	})
+}
+
+func (s *RetryStore) QueryLedger(ctx context.Context, teamID string, startMs, endMs int64) ([]LedgerEntry, error) {
+	return retryValue(ctx, s, "QueryLedger", retryTransient, func(ctx context.Context) ([]LedgerEntry, error) {
+		return s.store.QueryLedger(ctx, teamID, startMs, endMs)
+	})
+}
@@ -0,0 +1,33 @@
+package tokens
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestRetryStoreBudget(t *testing.T) {
+	clock := newTestClock()
+	flaky := &flakyStore{
+		Store: NewMemoryStore(),
+		err:   &smithy.GenericAPIError{Code: "ThrottlingException"},
+		// each throttled call takes a second and a half
+		onCall: func() { clock.Advance(1500 * time.Millisecond) },
+	}
+	s := NewRetryStore(flaky, RetryConfig{
+		MaxAttempts:    10,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		Budget:         2 * time.Second,
+	}, nil, WithStoreClock(clock))
+
+	if _, err := s.GetTokenRow(context.Background(), "a", true); err == nil {
+		t.Fatal("GetTokenRow of a throttled store succeeded")
+	}
+	// the second call ends past the budget, so there's no third
+	if flaky.calls != 2 {
+		t.Errorf("store called %d times, want 2", flaky.calls)
+	}
+}
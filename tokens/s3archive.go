@@ -0,0 +1,52 @@
+package tokens
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3BidArchiver is a BidArchiver writing each batch to an S3 bucket as a
+// JSON-lines object, keyed by the batch's expiry range:
+//
+//	<prefix>expiring-<FromSec>-<ToSec>.jsonl
+//
+// A range archived twice, by a retry or a concurrent run, overwrites the
+// same object.
+type S3BidArchiver struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// NewS3BidArchiver returns an S3BidArchiver writing to bucket under prefix,
+// e.g. "bids/".
+func NewS3BidArchiver(client *s3.Client, bucket, prefix string) *S3BidArchiver {
+	return &S3BidArchiver{client: client, bucket: bucket, prefix: prefix}
+}
+
+// Key returns the object key a batch is written to.
+func (a *S3BidArchiver) Key(batch BidArchiveBatch) string {
+	return fmt.Sprintf("%sexpiring-%d-%d.jsonl", a.prefix, batch.FromSec, batch.ToSec)
+}
+
+func (a *S3BidArchiver) ArchiveBids(ctx context.Context, batch BidArchiveBatch) error {
+	var buf bytes.Buffer
+	if err := batch.WriteJSONLines(&buf); err != nil {
+		return err
+	}
+
+	_, err := a.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(a.bucket),
+		Key:         aws.String(a.Key(batch)),
+		Body:        bytes.NewReader(buf.Bytes()),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	if err != nil {
+		return fmt.Errorf("error writing bids to s3://%s/%s: %w", a.bucket, a.Key(batch), err)
+	}
+	return nil
+}
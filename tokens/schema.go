@@ -0,0 +1,424 @@
+package tokens
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.uber.org/zap"
+)
+
+// tableActiveTimeout bounds the wait for a new table to become active.
+const tableActiveTimeout = 2 * time.Minute
+
+// TableNames names the DynamoDB tables. Empty names default to the
+// TableName constants.
+type TableNames struct {
+	Tokens         string `json:"tokens"`
+	Bids           string `json:"bids"`
+	Auctions       string `json:"auctions"`
+	BalanceHistory string `json:"balance_history"`
+	Ledger         string `json:"ledger"`
+	Stats          string `json:"stats"`
+}
+
+// withDefaults fills in the empty names with the TableName constants plus
+// suffix.
+func (n TableNames) withDefaults(suffix string) TableNames {
+	n.Tokens = cmp.Or(n.Tokens, TableNameTokens+suffix)
+	n.Bids = cmp.Or(n.Bids, TableNameBids+suffix)
+	n.Auctions = cmp.Or(n.Auctions, TableNameAuctions+suffix)
+	n.BalanceHistory = cmp.Or(n.BalanceHistory, TableNameBalanceHistory+suffix)
+	n.Ledger = cmp.Or(n.Ledger, TableNameLedger+suffix)
+	n.Stats = cmp.Or(n.Stats, TableNameStats+suffix)
+	return n
+}
+
+// Provisioner creates and checks the DynamoDB tables a DynamoStore uses,
+// apart from constructing a Manager, e.g. from a deploy step such as
+// `auctiond migrate`.
+type Provisioner struct {
+	client   *dynamodb.Client
+	tables   TableNames
+	capacity *ProvisionedCapacity
+	logger   *zap.Logger
+}
+
+// NewProvisioner returns a Provisioner of the given tables over client;
+// empty names default to the TableName constants. A non-nil capacity
+// creates provisioned tables rather than on-demand ones. Progress is logged
+// to logger; a nil logger discards it.
+func NewProvisioner(client *dynamodb.Client, tables TableNames, capacity *ProvisionedCapacity, logger *zap.Logger) *Provisioner {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Provisioner{
+		client:   client,
+		tables:   tables.withDefaults(""),
+		capacity: capacity,
+		logger:   logger,
+	}
+}
+
+// Provision creates the tokens, bids, auctions, balance history, ledger and
+// stats tables, then checks the key schema of each. Create failures, including the tables
+// already existing, are logged; a table that is missing or whose keys don't
+// match returns an error, ErrSchemaMismatch for the latter.
+func (p *Provisioner) Provision(ctx context.Context) error {
+	billingMode := types.BillingModePayPerRequest
+	var throughput *types.ProvisionedThroughput
+	if p.capacity != nil {
+		billingMode = types.BillingModeProvisioned
+		throughput = p.capacity.throughput()
+	}
+
+	_, err := p.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(p.tables.Tokens),
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("pk"),
+				KeyType:       types.KeyTypeHash,
+			},
+		},
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("pk"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		BillingMode:           billingMode,
+		ProvisionedThroughput: throughput,
+	})
+	if err != nil {
+		p.logger.Warn("failed table create", zap.Error(err))
+	} else {
+		p.logger.Info("created tokens table")
+	}
+
+	_, err = p.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(p.tables.Bids),
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("pk"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("sk"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("pk"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("sk"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("created_at_ms"),
+				AttributeType: types.ScalarAttributeTypeN,
+			},
+			{
+				AttributeName: aws.String("target"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("expiry_bucket"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("expires_at"),
+				AttributeType: types.ScalarAttributeTypeN,
+			},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+			{
+				IndexName: aws.String(IndexNameBidsByCreatedAt),
+				KeySchema: []types.KeySchemaElement{
+					{
+						AttributeName: aws.String("pk"),
+						KeyType:       types.KeyTypeHash,
+					},
+					{
+						AttributeName: aws.String("created_at_ms"),
+						KeyType:       types.KeyTypeRange,
+					},
+				},
+				Projection: &types.Projection{
+					ProjectionType: types.ProjectionTypeAll,
+				},
+				ProvisionedThroughput: throughput,
+			},
+			{
+				IndexName: aws.String(IndexNameBidsByTarget),
+				KeySchema: []types.KeySchemaElement{
+					{
+						AttributeName: aws.String("target"),
+						KeyType:       types.KeyTypeHash,
+					},
+					{
+						AttributeName: aws.String("created_at_ms"),
+						KeyType:       types.KeyTypeRange,
+					},
+				},
+				Projection: &types.Projection{
+					ProjectionType: types.ProjectionTypeAll,
+				},
+				ProvisionedThroughput: throughput,
+			},
+			{
+				IndexName: aws.String(IndexNameBidsByExpiry),
+				KeySchema: []types.KeySchemaElement{
+					{
+						AttributeName: aws.String("expiry_bucket"),
+						KeyType:       types.KeyTypeHash,
+					},
+					{
+						AttributeName: aws.String("expires_at"),
+						KeyType:       types.KeyTypeRange,
+					},
+				},
+				Projection: &types.Projection{
+					ProjectionType: types.ProjectionTypeAll,
+				},
+				ProvisionedThroughput: throughput,
+			},
+		},
+		// the stream feeds BidStreamConsumer
+		StreamSpecification: &types.StreamSpecification{
+			StreamEnabled:  aws.Bool(true),
+			StreamViewType: types.StreamViewTypeNewAndOldImages,
+		},
+		BillingMode:           billingMode,
+		ProvisionedThroughput: throughput,
+	})
+	if err != nil {
+		p.logger.Warn("failed table create", zap.Error(err))
+	} else {
+		p.logger.Info("created bids table")
+
+		if err := p.enableBidTTL(ctx); err != nil {
+			p.logger.Warn("failed to enable bids table TTL", zap.Error(err))
+		}
+	}
+
+	_, err = p.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(p.tables.Auctions),
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("pk"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("sk"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("pk"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("sk"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		BillingMode:           billingMode,
+		ProvisionedThroughput: throughput,
+	})
+	if err != nil {
+		p.logger.Warn("failed table create", zap.Error(err))
+	} else {
+		p.logger.Info("created auctions table")
+	}
+
+	_, err = p.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(p.tables.BalanceHistory),
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("pk"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("sk"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("pk"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("sk"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		BillingMode:           billingMode,
+		ProvisionedThroughput: throughput,
+	})
+	if err != nil {
+		p.logger.Warn("failed table create", zap.Error(err))
+	} else {
+		p.logger.Info("created balance history table")
+	}
+
+	_, err = p.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(p.tables.Ledger),
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("pk"),
+				KeyType:       types.KeyTypeHash,
+			},
+			{
+				AttributeName: aws.String("sk"),
+				KeyType:       types.KeyTypeRange,
+			},
+		},
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("pk"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+			{
+				AttributeName: aws.String("sk"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		BillingMode:           billingMode,
+		ProvisionedThroughput: throughput,
+	})
+	if err != nil {
+		p.logger.Warn("failed table create", zap.Error(err))
+	} else {
+		p.logger.Info("created ledger table")
+	}
+
+	_, err = p.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(p.tables.Stats),
+		KeySchema: []types.KeySchemaElement{
+			{
+				AttributeName: aws.String("pk"),
+				KeyType:       types.KeyTypeHash,
+			},
+		},
+		AttributeDefinitions: []types.AttributeDefinition{
+			{
+				AttributeName: aws.String("pk"),
+				AttributeType: types.ScalarAttributeTypeS,
+			},
+		},
+		BillingMode:           billingMode,
+		ProvisionedThroughput: throughput,
+	})
+	if err != nil {
+		p.logger.Warn("failed table create", zap.Error(err))
+	} else {
+		p.logger.Info("created stats table")
+	}
+
+	return p.validateTableSchemas(ctx)
+}
+
+// enableBidTTL turns on the TTL of a newly created bids table, on
+// expires_at, once the table is active.
+func (p *Provisioner) enableBidTTL(ctx context.Context) error {
+	waiter := dynamodb.NewTableExistsWaiter(p.client)
+	err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(p.tables.Bids)}, tableActiveTimeout)
+	if err != nil {
+		return fmt.Errorf("error waiting for table %s: %v", p.tables.Bids, err)
+	}
+
+	_, err = p.client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(p.tables.Bids),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String("expires_at"),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error enabling TTL on table %s: %v", p.tables.Bids, err)
+	}
+	return nil
+}
+
+// keyAttribute is one element of a table's expected primary key.
+type keyAttribute struct {
+	name     string
+	keyType  types.KeyType
+	attrType types.ScalarAttributeType
+}
+
+func (k keyAttribute) String() string {
+	return fmt.Sprintf("%s (%s, %s)", k.name, k.keyType, k.attrType)
+}
+
+// expectedKeySchemas is the primary key of each table, by table name.
+func (p *Provisioner) expectedKeySchemas() map[string][]keyAttribute {
+	hashAndRange := []keyAttribute{
+		{"pk", types.KeyTypeHash, types.ScalarAttributeTypeS},
+		{"sk", types.KeyTypeRange, types.ScalarAttributeTypeS},
+	}
+	return map[string][]keyAttribute{
+		p.tables.Tokens: {
+			{"pk", types.KeyTypeHash, types.ScalarAttributeTypeS},
+		},
+		p.tables.Bids:           hashAndRange,
+		p.tables.Auctions:       hashAndRange,
+		p.tables.BalanceHistory: hashAndRange,
+		p.tables.Ledger:         hashAndRange,
+		p.tables.Stats: {
+			{"pk", types.KeyTypeHash, types.ScalarAttributeTypeS},
+		},
+	}
+}
+
+// validateTableSchemas describes every table and checks its primary key
+// against what the package expects, so a table created by hand with the
+// wrong keys fails at startup rather than at query time.
+func (p *Provisioner) validateTableSchemas(ctx context.Context) error {
+	for table, expected := range p.expectedKeySchemas() {
+		out, err := p.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(table),
+		})
+		if err != nil {
+			return fmt.Errorf("error describing table %s: %v", table, err)
+		}
+
+		if err := checkKeySchema(out.Table, expected); err != nil {
+			return fmt.Errorf("%w: table %s: %v", ErrSchemaMismatch, table, err)
+		}
+	}
+	return nil
+}
+
+// checkKeySchema compares a table's key schema with the expected one.
+func checkKeySchema(table *types.TableDescription, expected []keyAttribute) error {
+	attrTypes := make(map[string]types.ScalarAttributeType, len(table.AttributeDefinitions))
+	for _, def := range table.AttributeDefinitions {
+		attrTypes[aws.ToString(def.AttributeName)] = def.AttributeType
+	}
+
+	actual := make([]keyAttribute, 0, len(table.KeySchema))
+	for _, elem := range table.KeySchema {
+		name := aws.ToString(elem.AttributeName)
+		actual = append(actual, keyAttribute{name, elem.KeyType, attrTypes[name]})
+	}
+
+	if len(actual) != len(expected) {
+		return fmt.Errorf("key schema is %v, expected %v", actual, expected)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			return fmt.Errorf("key schema is %v, expected %v", actual, expected)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package tokens
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// tableWithKeys describes a table keyed by the given attributes.
+func tableWithKeys(keys ...keyAttribute) *types.TableDescription {
+	table := &types.TableDescription{}
+	for _, k := range keys {
+		table.KeySchema = append(table.KeySchema, types.KeySchemaElement{
+			AttributeName: aws.String(k.name),
+			KeyType:       k.keyType,
+		})
+		table.AttributeDefinitions = append(table.AttributeDefinitions, types.AttributeDefinition{
+			AttributeName: aws.String(k.name),
+			AttributeType: k.attrType,
+		})
+	}
+	return table
+}
+
+func TestCheckKeySchema(t *testing.T) {
+	pk := keyAttribute{"pk", types.KeyTypeHash, types.ScalarAttributeTypeS}
+	sk := keyAttribute{"sk", types.KeyTypeRange, types.ScalarAttributeTypeS}
+	tests := []struct {
+		name     string
+		table    *types.TableDescription
+		expected []keyAttribute
+		wantErr  bool
+	}{
+		{name: "hash key", table: tableWithKeys(pk), expected: []keyAttribute{pk}},
+		{name: "hash and range keys", table: tableWithKeys(pk, sk), expected: []keyAttribute{pk, sk}},
+		{name: "missing range key", table: tableWithKeys(pk), expected: []keyAttribute{pk, sk}, wantErr: true},
+		{name: "extra range key", table: tableWithKeys(pk, sk), expected: []keyAttribute{pk}, wantErr: true},
+		{
+			name:     "wrong attribute name",
+			table:    tableWithKeys(keyAttribute{"id", types.KeyTypeHash, types.ScalarAttributeTypeS}),
+			expected: []keyAttribute{pk}, wantErr: true,
+		},
+		{
+			name:     "wrong attribute type",
+			table:    tableWithKeys(keyAttribute{"pk", types.KeyTypeHash, types.ScalarAttributeTypeN}),
+			expected: []keyAttribute{pk}, wantErr: true,
+		},
+		{name: "keys swapped", table: tableWithKeys(sk, pk), expected: []keyAttribute{pk, sk}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkKeySchema(tt.table, tt.expected)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkKeySchema = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
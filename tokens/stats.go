@@ -0,0 +1,166 @@
+package tokens
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TeamStats summarizes a team's bidding for leaderboards and spend
+// analytics. Stats are computed from the bids still in the bids table by
+// ComputeTeamStats, and stored in the stats table until the next run.
+type TeamStats struct {
+	Pk     string `dynamodbav:"pk" json:"pk"`
+	TeamID string `dynamodbav:"team_id" json:"team_id"`
+	// Rank is the team's place on the leaderboard, from 1: by wins, then
+	// win rate, then fewest tokens spent.
+	Rank int   `dynamodbav:"rank" json:"rank"`
+	Bids int64 `dynamodbav:"bids" json:"bids"`
+	Wins int64 `dynamodbav:"wins" json:"wins"`
+	// WinRate is Wins over Bids, zero for a team that hasn't bid.
+	WinRate         float64 `dynamodbav:"win_rate" json:"win_rate"`
+	AvgWinningScore float64 `dynamodbav:"avg_winning_score" json:"avg_winning_score"`
+	// Spent is the cost of the team's winning bids, and SpentByPriority
+	// the same by bid priority. Under second-price auctions a winner is
+	// charged less than its bid's cost.
+	Spent           int64           `dynamodbav:"spent" json:"spent"`
+	SpentByPriority map[int64]int64 `dynamodbav:"spent_by_priority" json:"spent_by_priority"`
+	ComputedAtMs    int64           `dynamodbav:"computed_at_ms" json:"computed_at_ms"`
+}
+
+// ComputeTeamStats aggregates every team's bids into its TeamStats, ranks
+// the teams and writes the stats to the stats table, replacing the last
+// run's. Aborted bids are left out. It returns the stats in rank order.
+func (tm *Manager) ComputeTeamStats(ctx context.Context) ([]TeamStats, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	rows, err := tm.store.ScanTokenRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nowMs := tm.clock.Now().UnixMilli()
+	stats := make([]TeamStats, 0, len(rows))
+	for _, row := range rows {
+		bids, err := tm.GetBids(ctx, row.TeamID)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, teamStats(row.TeamID, bids, nowMs))
+	}
+	rankTeamStats(stats)
+
+	err = tm.store.PutTeamStats(ctx, stats)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func teamStats(teamID string, bids []BidRow, nowMs int64) TeamStats {
+	s := TeamStats{
+		Pk:              GetTeamStatsPK(teamID),
+		TeamID:          teamID,
+		SpentByPriority: make(map[int64]int64),
+		ComputedAtMs:    nowMs,
+	}
+
+	var winningScore float64
+	for _, br := range bids {
+		if br.Aborted {
+			continue
+		}
+		s.Bids++
+		if !br.Won {
+			continue
+		}
+		s.Wins++
+		winningScore += br.Score
+		s.Spent += br.Cost
+		s.SpentByPriority[br.Priority] += br.Cost
+	}
+
+	if s.Bids > 0 {
+		s.WinRate = float64(s.Wins) / float64(s.Bids)
+	}
+	if s.Wins > 0 {
+		s.AvgWinningScore = winningScore / float64(s.Wins)
+	}
+	return s
+}
+
+// rankTeamStats sorts stats into leaderboard order and numbers them.
+func rankTeamStats(stats []TeamStats) {
+	slices.SortFunc(stats, func(a, b TeamStats) int {
+		if c := cmp.Compare(b.Wins, a.Wins); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.WinRate, a.WinRate); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Spent, b.Spent); c != 0 {
+			return c
+		}
+		return strings.Compare(a.TeamID, b.TeamID)
+	})
+	for i := range stats {
+		stats[i].Rank = i + 1
+	}
+}
+
+// GetTeamStats reads a team's stats from the last ComputeTeamStats run. It
+// fails with ErrTeamStatsNotFound if the team wasn't in it.
+func (tm *Manager) GetTeamStats(ctx context.Context, teamID string) (*TeamStats, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.store.GetTeamStats(ctx, tm.normalizeID(teamID))
+}
+
+// GetLeaderboard returns the top limit teams from the last ComputeTeamStats
+// run, in rank order, or every team if limit is zero or less.
+func (tm *Manager) GetLeaderboard(ctx context.Context, limit int) ([]TeamStats, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	stats, err := tm.store.ScanTeamStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(stats, func(a, b TeamStats) int {
+		return cmp.Compare(a.Rank, b.Rank)
+	})
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+// runStatsAggregation runs ComputeTeamStats every interval until the Manager
+// is closed, then closes done.
+func (tm *Manager) runStatsAggregation(interval time.Duration, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tm.baseCtx.Done():
+			return
+		case <-ticker.C:
+			stats, err := tm.ComputeTeamStats(tm.baseCtx)
+			if err != nil && tm.baseCtx.Err() == nil {
+				tm.logger.Warn("failed to compute team stats", zap.Error(err))
+				continue
+			}
+			tm.logger.Info("computed team stats", zap.Int("teams", len(stats)))
+		}
+	}
+}
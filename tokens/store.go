@@ -0,0 +1,386 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+)
+
+// Store is the persistence layer behind a Manager. The Manager owns the
+// auction and pricing rules; a Store only reads and writes rows, applying
+// the few conditions that have to hold atomically with a write, such as a
+// balance covering a spend. NewManager uses a DynamoStore unless WithStore
+// is given; MemoryStore keeps everything in process, for tests.
+//
+// Every write that changes a team's token_balance appends a LedgerEntry with
+// the change in the same atomic write, so the ledger always sums to the
+// balance.
+//
+// Every write that changes a team's balances or reputation moves its token
+// row to the next Version, so that writes computed from a read can be
+// conditioned on the version read.
+//
+// Conditional writes whose condition doesn't hold return an error matching
+// ErrConditionFailed. Lookups of a missing token row or hold return
+// ErrTeamNotFound or ErrHoldNotFound.
+type Store interface {
+	// EnsureSchema creates whatever the store needs to hold its rows, e.g.
+	// tables, and checks that what already exists is usable.
+	EnsureSchema(ctx context.Context) error
+	// Truncate deletes every row in the store.
+	Truncate(ctx context.Context) error
+
+	// GetTokenRow reads a team's token row. consistent asks for a read that
+	// reflects every completed write, where the store distinguishes.
+	GetTokenRow(ctx context.Context, teamID string, consistent bool) (*TokenDBRow, error)
+	// BatchGetTokenRows reads the token rows of many teams, keyed by team
+	// ID. Teams without a row are left out of the result.
+	BatchGetTokenRows(ctx context.Context, teamIDs []string) (map[string]TokenDBRow, error)
+	// EnsureTokenRow creates row if the team has none, and otherwise sets
+	// only the attributes the existing row lacks, including balances in
+	// currencies it has none in. UpdatedAtMs is always set.
+	EnsureTokenRow(ctx context.Context, row *TokenDBRow) error
+	// RefillTokenRow resets a team's balance, reputation and priority usage
+	// and stamps its last refill time, provided the balance is still
+	// observed; an observed balance of zero also matches a team without a
+	// row. balances, if non-nil, replaces its balances in other currencies.
+	RefillTokenRow(ctx context.Context, teamID string, balance, observed int64, balances map[string]int64, usage map[int]int, reputation, nowMs int64) error
+	// DripTokenRow adds credit to a team's balance and moves its last refill
+	// time to refillMs, provided the last refill time is still observedMs.
+	DripTokenRow(ctx context.Context, teamID string, credit, observedMs, refillMs int64) error
+	// CreateTokenRow creates a team's token row with its opening ledger
+	// entry. It fails with a *ConditionFailedError carrying the existing row
+	// if the team has one.
+	CreateTokenRow(ctx context.Context, row *TokenDBRow) error
+	// SetTeamStatus moves a team to u.Status, provided its status is one of
+	// u.From, a row without a status counting as TeamActive, and returns the
+	// row after. It fails with a *ConditionFailedError carrying the row if
+	// the status isn't in u.From, and without one if the team has no row.
+	SetTeamStatus(ctx context.Context, u TeamStatusUpdate) (*TokenDBRow, error)
+	// DeleteTeam deletes a team's token row, provided its balance is still
+	// observed, along with its auto-bid policy, webhook, pacing row and
+	// stats, and closes its ledger with an entry taking the balance off. It
+	// fails with a *ConditionFailedError if the balance moved or the team
+	// has no row.
+	DeleteTeam(ctx context.Context, teamID string, observed, nowMs int64) error
+	// ScanTokenRows returns the token rows of every team.
+	ScanTokenRows(ctx context.Context) ([]TokenDBRow, error)
+	// UpdateBalance applies a spend to a team's token row and returns the row
+	// after it, writing u.WinningBid in the same transaction. It fails with a
+	// *ConditionFailedError, writing nothing, if the balance doesn't cover
+	// the spend or, for a win, the team is in cooldown.
+	UpdateBalance(ctx context.Context, u BalanceUpdate) (*TokenDBRow, error)
+	// UpdateBalances applies the spends of several teams, each at most once,
+	// in one transaction and returns their token rows after them, in order.
+	// It fails with ErrConditionFailed, writing nothing, if the condition of
+	// any of them fails.
+	UpdateBalances(ctx context.Context, updates []BalanceUpdate) ([]*TokenDBRow, error)
+	// CountAuctionEntry adds one to the number of auctions a team has bid in;
+	// see TieBreakWinRate.
+	CountAuctionEntry(ctx context.Context, teamID string) error
+	// GetPacingRow reads a team's budget pacing row; a team without one gets
+	// an empty row.
+	GetPacingRow(ctx context.Context, teamID string) (*PacingRow, error)
+	// AddPacedSpend adds amount to a team's spend in the pacing window
+	// starting at windowStartMs, provided the row is in that window and the
+	// spend stays within limit.
+	AddPacedSpend(ctx context.Context, teamID string, amount, windowStartMs, limit int64) error
+	// RollPacingWindow moves a team's pacing row from the window starting at
+	// observedStartMs, zero for a team without one, to the window starting
+	// at windowStartMs, with prevSpent carried over and spent spent in it.
+	RollPacingWindow(ctx context.Context, teamID string, observedStartMs, windowStartMs, prevSpent, spent int64) error
+	// RefundPacedSpend takes amount off a team's spend, provided its pacing
+	// row is still in the window starting at windowStartMs.
+	RefundPacedSpend(ctx context.Context, teamID string, amount, windowStartMs int64) error
+	// GetQuotaRow reads a team's priority quota row; a team without one
+	// gets an empty row.
+	GetQuotaRow(ctx context.Context, teamID string) (*QuotaRow, error)
+	// AddQuotaUsage adds one to a team's usage of priority on the day
+	// starting at dayStartMs, provided the row is on that day and, for a
+	// positive limit, the usage stays within it.
+	AddQuotaUsage(ctx context.Context, teamID string, priority, dayStartMs int64, limit int) error
+	// RollQuotaDay moves a team's quota row from the day starting at
+	// observedStartMs, zero for a team without one, to the day starting at
+	// dayStartMs, with one use of priority.
+	RollQuotaDay(ctx context.Context, teamID string, observedStartMs, dayStartMs, priority int64) error
+	// RefundQuotaUsage takes one off a team's usage of priority, provided
+	// its quota row is still on the day starting at dayStartMs.
+	RefundQuotaUsage(ctx context.Context, teamID string, priority, dayStartMs int64) error
+	// BatchGetFrequencyRows reads the frequency rows of teams for a user,
+	// keyed by team ID. Teams without one get an empty row.
+	BatchGetFrequencyRows(ctx context.Context, userID string, teamIDs []string) (map[string]FrequencyRow, error)
+	// PutFrequencyRow writes a frequency row.
+	PutFrequencyRow(ctx context.Context, row *FrequencyRow) error
+	// SetTokenBalance sets a team's balance, provided it is still observed,
+	// recording the change as a correction.
+	SetTokenBalance(ctx context.Context, teamID string, balance, observed, nowMs int64) error
+	// AdjustReputation changes a team's reputation by e.Delta, provided its
+	// token row is still at the version of observed, clamping the result to
+	// between floor and ceiling without moving a reputation already outside
+	// them further out. It sets
+	// e.Delta and e.Reputation to what was applied and, if e.DedupeKey is
+	// set, records e under e.Pk in the same write. It fails with
+	// ErrDuplicateReputationEvent, writing nothing, if e was recorded
+	// before.
+	AdjustReputation(ctx context.Context, e *ReputationEvent, observed *TokenDBRow, floor, ceiling int64) error
+	// RecoverReputation raises a team's reputation by increase and moves its
+	// last reputation recovery time to recoveredMs, provided that time is
+	// still observedMs and, if increase is positive, the raise doesn't take
+	// the reputation above ceiling. An observedMs of zero also matches a row
+	// without one.
+	RecoverReputation(ctx context.Context, teamID string, increase, ceiling, observedMs, recoveredMs int64) error
+	// TransferTokens moves t.Amount from t.FromTeamID's balance to
+	// t.ToTeamID's and records t, all at once, and returns both token rows
+	// after it. It fails with a *ConditionFailedError, writing nothing, if
+	// the sender's balance doesn't cover the amount or either team has no
+	// token row; Row is the sender's only in the first case.
+	TransferTokens(ctx context.Context, t *TransferRow) (from, to *TokenDBRow, err error)
+	// AdjustBalance adds a.Delta to a.TeamID's balance and records a, all at
+	// once, and returns the token row after it. It fails with a
+	// *ConditionFailedError, writing nothing, if the team has no token row
+	// or a deduction would take its balance below zero.
+	AdjustBalance(ctx context.Context, a *AdjustmentRow) (*TokenDBRow, error)
+
+	// PlaceHold records hold and moves its amount from the team's balance to
+	// its held balance, stamping the hold's creation as the team's last win.
+	// winningBid, if non-nil, is written in the same transaction, and
+	// reservation, if non-nil, is released in it to fund the hold. lock, if
+	// non-nil, must still be held, as for BalanceUpdate.Lock. It fails like
+	// UpdateBalance.
+	PlaceHold(ctx context.Context, hold *HoldRow, cooldownStartMs int64, winningBid *BidRow, reservation *HoldRow, lock *LockRef) error
+	// ReserveTokens records hold and moves its amount from the team's
+	// balance to its held balance, conditional on the balance covering it.
+	// Unlike PlaceHold it doesn't count as a win.
+	ReserveTokens(ctx context.Context, hold *HoldRow) error
+	// GetHold reads a hold by ID.
+	GetHold(ctx context.Context, holdID string) (*HoldRow, error)
+	// ConfirmHold deletes hold if it hasn't expired by nowMs, spends its
+	// amount from the team's held balance and counts its priority usage. It
+	// returns the team's token row after the spend.
+	ConfirmHold(ctx context.Context, hold *HoldRow, nowMs int64) (*TokenDBRow, error)
+	// ReleaseHold deletes hold and returns its amount to the team's balance.
+	ReleaseHold(ctx context.Context, hold *HoldRow, nowMs int64) error
+	// ExpiredHolds returns every hold that expired by nowMs.
+	ExpiredHolds(ctx context.Context, nowMs int64) ([]HoldRow, error)
+
+	// AcquireLock takes a user's auction lock for owner until expiresAtMs,
+	// unless another owner holds it past nowMs. An expired lock is taken
+	// over, so writes that must only be made under a lock check that their
+	// owner still holds it; see LockRef.
+	AcquireLock(ctx context.Context, userID, owner string, nowMs, expiresAtMs int64) error
+	// ReleaseLock releases a user's auction lock if owner still holds it.
+	ReleaseLock(ctx context.Context, userID, owner string) error
+
+	// ClaimIdempotencyKey writes row unless a row with its key exists and
+	// hasn't expired by nowMs.
+	ClaimIdempotencyKey(ctx context.Context, row *IdempotencyRow, nowMs int64) error
+	// GetIdempotencyRow reads the row of an idempotency key, or returns nil if
+	// there is none.
+	GetIdempotencyRow(ctx context.Context, key string) (*IdempotencyRow, error)
+	// PutIdempotencyRow writes row, replacing any with the same key.
+	PutIdempotencyRow(ctx context.Context, row *IdempotencyRow) error
+	// DeleteIdempotencyRow deletes the row of an idempotency key.
+	DeleteIdempotencyRow(ctx context.Context, key string) error
+
+	// PutBids writes bid rows, replacing any with the same keys.
+	PutBids(ctx context.Context, rows []*BidRow) error
+	// MarkBidAborted flags a recorded bid as aborted.
+	MarkBidAborted(ctx context.Context, pk, sk string, nowMs int64) error
+	// QueryBids returns the bids in one bid partition.
+	QueryBids(ctx context.Context, q BidQuery) ([]BidRow, error)
+	// QueryBidsByTarget returns every team's bids for a user, oldest first.
+	QueryBidsByTarget(ctx context.Context, userID string) ([]BidRow, error)
+	// QueryExpiringBids returns every bid whose ExpiresAt is in
+	// [fromSec, toSec), from IndexNameBidsByExpiry.
+	QueryExpiringBids(ctx context.Context, fromSec, toSec int64) ([]BidRow, error)
+	// GetBidArchiveWatermark returns the ExpiresAt bids have been archived
+	// up to, or zero if none have.
+	GetBidArchiveWatermark(ctx context.Context) (int64, error)
+	// AdvanceBidArchiveWatermark moves the watermark from fromSec to toSec.
+	// It fails with ErrConditionFailed if the watermark isn't at fromSec.
+	AdvanceBidArchiveWatermark(ctx context.Context, fromSec, toSec int64) error
+	// DeleteBids deletes every bid in one bid partition and returns how many
+	// were deleted.
+	DeleteBids(ctx context.Context, pk string) (int, error)
+
+	// PutAuctionWindow writes a new auction window. It fails with
+	// ErrConditionFailed if a window with its ID exists.
+	PutAuctionWindow(ctx context.Context, w *AuctionWindow) error
+	// GetAuctionWindow reads an auction window by ID.
+	GetAuctionWindow(ctx context.Context, auctionID string) (*AuctionWindow, error)
+	// AddWindowBid appends bid to an auction window, provided the window is
+	// open past nowMs and holds fewer than maxBids bids.
+	AddWindowBid(ctx context.Context, auctionID string, bid WindowBid, nowMs int64, maxBids int) error
+	// SettleAuctionWindow marks an open auction window settled with result,
+	// which is nil if it had no winner.
+	SettleAuctionWindow(ctx context.Context, auctionID string, result *AuctionResult, nowMs int64) error
+	// DueAuctionWindows returns every open auction window whose deadline
+	// passed by nowMs.
+	DueAuctionWindows(ctx context.Context, nowMs int64) ([]AuctionWindow, error)
+
+	// PutDutchAuction writes a new Dutch auction. It fails with
+	// ErrConditionFailed if an auction with its ID exists.
+	PutDutchAuction(ctx context.Context, a *DutchAuction) error
+	// GetDutchAuction reads a Dutch auction by ID.
+	GetDutchAuction(ctx context.Context, auctionID string) (*DutchAuction, error)
+	// ClaimDutchAuction marks a Dutch auction sold to teamID at price,
+	// provided it is open past nowMs.
+	ClaimDutchAuction(ctx context.Context, auctionID, teamID string, price, nowMs int64) error
+	// ReleaseDutchAuction reopens a Dutch auction sold to teamID.
+	ReleaseDutchAuction(ctx context.Context, auctionID, teamID string) error
+
+	// PutAutoBidPolicy writes a team's auto-bid policy, replacing any it
+	// had.
+	PutAutoBidPolicy(ctx context.Context, p *AutoBidPolicy) error
+	// GetAutoBidPolicy reads a team's auto-bid policy.
+	GetAutoBidPolicy(ctx context.Context, teamID string) (*AutoBidPolicy, error)
+	// DeleteAutoBidPolicy deletes a team's auto-bid policy. It fails with
+	// ErrAutoBidPolicyNotFound if the team has none.
+	DeleteAutoBidPolicy(ctx context.Context, teamID string) error
+	// ListAutoBidPolicies returns every team's auto-bid policy.
+	ListAutoBidPolicies(ctx context.Context) ([]AutoBidPolicy, error)
+
+	// PutWebhook writes a team's webhook, replacing any it had.
+	PutWebhook(ctx context.Context, w *Webhook) error
+	// GetWebhook reads a team's webhook.
+	GetWebhook(ctx context.Context, teamID string) (*Webhook, error)
+	// DeleteWebhook deletes a team's webhook. It fails with
+	// ErrWebhookNotFound if the team has none.
+	DeleteWebhook(ctx context.Context, teamID string) error
+	// PutWebhookDeadLetter records an undelivered webhook notification.
+	PutWebhookDeadLetter(ctx context.Context, d *WebhookDeadLetter) error
+	// QueryWebhookDeadLetters returns a team's dead letters, oldest first.
+	QueryWebhookDeadLetters(ctx context.Context, teamID string) ([]WebhookDeadLetter, error)
+
+	// PutTeamStats writes teams' stats, replacing any they had.
+	PutTeamStats(ctx context.Context, stats []TeamStats) error
+	// GetTeamStats reads a team's stats. It fails with ErrTeamStatsNotFound
+	// if the team has none.
+	GetTeamStats(ctx context.Context, teamID string) (*TeamStats, error)
+	// ScanTeamStats returns every team's stats.
+	ScanTeamStats(ctx context.Context) ([]TeamStats, error)
+
+	// PutAuction records an auction.
+	PutAuction(ctx context.Context, row *AuctionRow) error
+	// QueryAuctions returns the recorded auctions for a user, newest first.
+	QueryAuctions(ctx context.Context, userID string) ([]AuctionRow, error)
+	// PutAuctionAudit writes an auction's audit record. It fails with a
+	// *ConditionFailedError if the auction already has one.
+	PutAuctionAudit(ctx context.Context, a *AuctionAudit) error
+	// GetAuctionAudit reads an auction's audit record.
+	GetAuctionAudit(ctx context.Context, auctionID string) (*AuctionAudit, error)
+
+	// PutBalanceSnapshot records a balance snapshot.
+	PutBalanceSnapshot(ctx context.Context, snapshot *BalanceSnapshot) error
+	// QueryBalanceSnapshots returns a team's snapshots taken between startMs
+	// and endMs inclusive, oldest first.
+	QueryBalanceSnapshots(ctx context.Context, teamID string, startMs, endMs int64) ([]BalanceSnapshot, error)
+
+	// QueryLedger returns a team's ledger entries created between startMs and
+	// endMs inclusive, oldest first.
+	QueryLedger(ctx context.Context, teamID string, startMs, endMs int64) ([]LedgerEntry, error)
+}
+
+// BalanceUpdate is a spend applied with Store.UpdateBalance.
+type BalanceUpdate struct {
+	TeamID string
+	// Currency is the balance to deduct from, empty for token_balance; see
+	// Currency. Reservation is only supported in the standard currency.
+	Currency string
+	// Amount is deducted from the balance, which must cover it.
+	Amount int64
+	// Priority has its priority_usage count incremented.
+	Priority int64
+	NowMs    int64
+	// Win stamps NowMs as the team's last win.
+	Win bool
+	// CooldownStartMs, if non-zero, additionally requires a win's team to
+	// not have won after it.
+	CooldownStartMs int64
+	// WinningBid, if set, is the bid row to record for a win, with Won set.
+	// It is written only if the spend is.
+	WinningBid *BidRow
+	// Reservation, if set, funds the spend: it is deleted and its amount
+	// returned from the held balance in the same write, so the balance need
+	// only cover the part of Amount the reservation doesn't.
+	Reservation *HoldRow
+	// Version, if set, additionally requires the row to still be at this
+	// version, e.g. the one Amount was priced from.
+	Version *int64
+	// Lock, if set, additionally requires the auction lock to still be held
+	// by its owner; the update fails with ErrAuctionLockLost otherwise.
+	Lock *LockRef
+}
+
+// LockRef is an auction lock on a user, held by Owner. A write made under a
+// lock checks it in the same transaction, so an auction that outlived its
+// lock and had it taken over can't settle the user's auction a second time.
+type LockRef struct {
+	UserID string
+	Owner  string
+}
+
+// BidQuery selects bids from one bid partition, in sort key order unless
+// NewestFirst is set.
+type BidQuery struct {
+	Pk string
+	// SkPrefix restricts the bids to sort keys with this prefix.
+	SkPrefix string
+	WonOnly  bool
+	// NewestFirst orders by CreatedAtMs, newest first. The DynamoStore reads
+	// these from the eventually consistent bids_by_created_at index and
+	// ignores SkPrefix.
+	NewestFirst bool
+	// Limit caps the number of bids returned; zero returns all of them.
+	Limit int
+	// AfterSk restricts the bids to sort keys after this one. It takes
+	// precedence over SkPrefix and is ignored by NewestFirst queries.
+	AfterSk string
+	// Filter restricts the bids like WonOnly does, read but not returned.
+	Filter BidFilter
+}
+
+// ConditionFailedError is returned by a conditional Store write whose
+// condition didn't hold. Row is the token row as it was when the condition
+// was checked, if the write was against one and the store reports it.
+type ConditionFailedError struct {
+	Row *TokenDBRow
+}
+
+func (e *ConditionFailedError) Error() string {
+	if e.Row != nil {
+		return fmt.Sprintf("%v: team %s", ErrConditionFailed, e.Row.TeamID)
+	}
+	return ErrConditionFailed.Error()
+}
+
+func (e *ConditionFailedError) Is(target error) bool {
+	return target == ErrConditionFailed
+}
+
+// StoreOption configures a Store wrapper, such as a RetryStore or a
+// BreakerStore.
+type StoreOption func(*storeOptions)
+
+type storeOptions struct {
+	clock Clock
+}
+
+func newStoreOptions(opts []StoreOption) storeOptions {
+	o := storeOptions{clock: systemClock{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.clock == nil {
+		o.clock = systemClock{}
+	}
+	return o
+}
+
+// WithStoreClock sets the Clock a Store wrapper times its cooldowns and
+// budgets by, the wall clock by default. The Manager passes its own; see
+// WithClock.
+func WithStoreClock(clock Clock) StoreOption {
+	return func(o *storeOptions) {
+		o.clock = clock
+	}
+}
@@ -0,0 +1,86 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+)
+
+// AuctionStrategy decides what an auction's winner pays.
+type AuctionStrategy int
+
+const (
+	// FirstPrice charges the winner its own bid cost. It is the default.
+	FirstPrice AuctionStrategy = iota
+	// SecondPrice charges the winner the cost of the runner-up's bid, capped
+	// at its own, so a team gains nothing by shading its priority. The
+	// runner-up is the best bid that could have won instead: the winner's
+	// own team's other bids, teams that already won a slot and vetoed teams
+	// don't count. A winner without a runner-up, or whose runner-up bid
+	// another currency, pays its own cost.
+	SecondPrice
+)
+
+// String returns the strategy's name in the config file.
+func (s AuctionStrategy) String() string {
+	switch s {
+	case FirstPrice:
+		return "first_price"
+	case SecondPrice:
+		return "second_price"
+	default:
+		return fmt.Sprintf("AuctionStrategy(%d)", int(s))
+	}
+}
+
+// clearingPrice returns what winner pays under the Manager's strategy, given
+// the candidates ranked below it and the teams already awarded a slot of the
+// auction. Under SecondPrice the price is set by the runner-up: the best of
+// rest that could have won in winner's place, i.e. a bid from another team
+// that hasn't won already, wasn't skipped and, if checkVeto is set, passes
+// the Manager's WinnerVeto.
+func (tm *Manager) clearingPrice(ctx context.Context, winner *candidate, rest []*candidate, won map[string]bool, checkVeto bool) (int64, error) {
+	if tm.auctionStrategy != SecondPrice {
+		return winner.cost, nil
+	}
+
+	for _, c := range rest {
+		// a team's other bids, and those of teams that already won or never
+		// competed, were never in the running for winner's slot
+		if c.bid.TeamID == winner.bid.TeamID || won[c.bid.TeamID] || c.skipReason != "" {
+			continue
+		}
+		if checkVeto {
+			vetoed, err := tm.vetoed(ctx, c)
+			if err != nil {
+				return 0, err
+			}
+			if vetoed {
+				continue
+			}
+		}
+		// costs in different currencies don't compare
+		if c.bid.Currency != winner.bid.Currency {
+			return winner.cost, nil
+		}
+		return min(winner.cost, c.cost), nil
+	}
+	return winner.cost, nil
+}
+
+// vetoed reports whether the Manager's WinnerVeto rejects c's team. The
+// answer is kept on the candidate, so a runner-up asked about while pricing
+// a second-price win isn't asked again when its own turn comes.
+func (tm *Manager) vetoed(ctx context.Context, c *candidate) (bool, error) {
+	if tm.winnerVeto == nil || c.vetoChecked {
+		return c.skipReason == SkipReasonVetoed, nil
+	}
+	c.vetoChecked = true
+	vetoed, err := tm.winnerVeto(ctx, c.bid.TeamID)
+	if err != nil {
+		return false, fmt.Errorf("error checking winner veto: %w", err)
+	}
+	if vetoed {
+		c.skipReason = SkipReasonVetoed
+	}
+	return vetoed, nil
+}
@@ -0,0 +1,168 @@
+package tokens
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestClearingPrice(t *testing.T) {
+	winner := &candidate{bid: Bid{TeamID: "a"}, cost: 10}
+	tests := []struct {
+		name     string
+		strategy AuctionStrategy
+		rest     []*candidate
+		won      map[string]bool
+		vetoed   []string
+		want     int64
+		// wantAsked is the teams the veto is asked about
+		wantAsked []string
+	}{
+		{
+			name: "first price",
+			rest: []*candidate{{bid: Bid{TeamID: "b"}, cost: 5}},
+			want: 10,
+		},
+		{
+			name:      "runner-up's cost",
+			strategy:  SecondPrice,
+			rest:      []*candidate{{bid: Bid{TeamID: "b"}, cost: 5}},
+			want:      5,
+			wantAsked: []string{"b"},
+		},
+		{
+			name:     "no runner-up",
+			strategy: SecondPrice,
+			want:     10,
+		},
+		{
+			name:     "capped at the winner's cost",
+			strategy: SecondPrice,
+			rest:     []*candidate{{bid: Bid{TeamID: "b"}, cost: 12}},
+			want:     10,
+			// the veto is asked about b anyway
+			wantAsked: []string{"b"},
+		},
+		{
+			name:     "winner's own team skipped",
+			strategy: SecondPrice,
+			rest: []*candidate{
+				{bid: Bid{TeamID: "a"}, cost: 7},
+				{bid: Bid{TeamID: "b"}, cost: 1},
+			},
+			want:      1,
+			wantAsked: []string{"b"},
+		},
+		{
+			name:     "team that already won skipped",
+			strategy: SecondPrice,
+			rest: []*candidate{
+				{bid: Bid{TeamID: "b"}, cost: 7},
+				{bid: Bid{TeamID: "c"}, cost: 1},
+			},
+			won:       map[string]bool{"b": true},
+			want:      1,
+			wantAsked: []string{"c"},
+		},
+		{
+			name:     "skipped bid passed over",
+			strategy: SecondPrice,
+			rest: []*candidate{
+				{bid: Bid{TeamID: "b"}, cost: 7, skipReason: SkipReasonChargeFailed},
+				{bid: Bid{TeamID: "c"}, cost: 1},
+			},
+			want:      1,
+			wantAsked: []string{"c"},
+		},
+		{
+			name:     "vetoed runner-up passed over",
+			strategy: SecondPrice,
+			rest: []*candidate{
+				{bid: Bid{TeamID: "b"}, cost: 7},
+				{bid: Bid{TeamID: "c"}, cost: 1},
+			},
+			vetoed:    []string{"b"},
+			want:      1,
+			wantAsked: []string{"b", "c"},
+		},
+		{
+			name:     "no eligible runner-up",
+			strategy: SecondPrice,
+			rest:     []*candidate{{bid: Bid{TeamID: "b"}, cost: 7}},
+			vetoed:   []string{"b"},
+			want:     10,
+			// the veto is asked about b anyway
+			wantAsked: []string{"b"},
+		},
+		{
+			name:     "runner-up in another currency",
+			strategy: SecondPrice,
+			rest: []*candidate{
+				{bid: Bid{TeamID: "b", Currency: "boost"}, cost: 1},
+				{bid: Bid{TeamID: "c"}, cost: 5},
+			},
+			want:      10,
+			wantAsked: []string{"b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			var asked []string
+			veto := func(_ context.Context, teamID string) (bool, error) {
+				asked = append(asked, teamID)
+				return slices.Contains(tt.vetoed, teamID), nil
+			}
+			tm := newTestManager(t, []string{"a"}, WithAuctionStrategy(tt.strategy), WithWinnerVeto(veto))
+
+			got, err := tm.clearingPrice(ctx, winner, tt.rest, tt.won, true)
+			if err != nil {
+				t.Fatalf("clearingPrice: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("price = %d, want %d", got, tt.want)
+			}
+			if !slices.Equal(asked, tt.wantAsked) {
+				t.Errorf("veto asked about %v, want %v", asked, tt.wantAsked)
+			}
+
+			// a runner-up isn't asked about twice
+			asked = nil
+			for _, c := range tt.rest {
+				if _, err := tm.vetoed(ctx, c); err != nil {
+					t.Fatalf("vetoed: %v", err)
+				}
+			}
+			for _, team := range asked {
+				if slices.Contains(tt.wantAsked, team) {
+					t.Errorf("veto asked about %s again", team)
+				}
+			}
+		})
+	}
+}
+
+func TestSecondPriceMultiWinner(t *testing.T) {
+	ctx := context.Background()
+	tm := newTestManager(t, []string{"a", "b", "c"}, WithAuctionStrategy(SecondPrice))
+
+	results, err := tm.RunMultiWinnerAuction(ctx, []Bid{
+		{TeamID: "a", UserID: "u", Priority: 10},
+		{TeamID: "b", UserID: "u", Priority: 7},
+		{TeamID: "c", UserID: "u", Priority: 5},
+	}, AuctionConfig{Winners: 2})
+	if err != nil {
+		t.Fatalf("RunMultiWinnerAuction: %v", err)
+	}
+
+	// each winner pays the cost of the best bid below it that didn't win
+	want := map[string]int64{"a": 7, "b": 5}
+	if len(results) != len(want) {
+		t.Fatalf("got %d winners, want %d", len(results), len(want))
+	}
+	for _, result := range results {
+		if result.Cost != want[result.TeamID] {
+			t.Errorf("%s paid %d, want %d", result.TeamID, result.Cost, want[result.TeamID])
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"go.uber.org/zap"
+)
+
+// Types of bid event.
+const (
+	EventBidPlaced  = "BidPlaced"
+	EventAuctionWon = "AuctionWon"
+)
+
+// BidEvent is a normalized change to the bids table: a bid being placed, or
+// a bid winning its auction.
+type BidEvent struct {
+	Type     string  `json:"type"`
+	TeamID   string  `json:"team_id"`
+	UserID   string  `json:"user_id"`
+	BidID    string  `json:"bid_id"`
+	Priority int64   `json:"priority"`
+	Cost     int64   `json:"cost"`
+	Score    float64 `json:"score"`
+	// OccurredAtMs is when the bid was placed, or when it won.
+	OccurredAtMs int64 `json:"occurred_at_ms"`
+	// SequenceNumber is the stream record's. Events are delivered at least
+	// once, so consumers should deduplicate on it.
+	SequenceNumber string `json:"sequence_number"`
+}
+
+// EventPublisher delivers bid events downstream, e.g. to an SNS topic or a
+// Kafka topic. A failed Publish is retried until it succeeds or the consumer
+// is stopped.
+type EventPublisher interface {
+	Publish(ctx context.Context, event BidEvent) error
+}
+
+// jsonEventPublisher writes events as NDJSON.
+type jsonEventPublisher struct {
+	log *jsonLog
+}
+
+// NewJSONEventPublisher returns an EventPublisher that writes each event as
+// a line of JSON to w.
+func NewJSONEventPublisher(w io.Writer) EventPublisher {
+	return &jsonEventPublisher{log: newJSONLog(w)}
+}
+
+func (p *jsonEventPublisher) Publish(_ context.Context, event BidEvent) error {
+	return p.log.write(event)
+}
+
+// Default settings of a BidStreamConsumer.
+const (
+	DefaultStreamPollInterval  = time.Second
+	DefaultStreamShardInterval = time.Minute
+)
+
+// BidStreamConfig configures a BidStreamConsumer.
+type BidStreamConfig struct {
+	// StreamARN is the bids table's stream; see DynamoStore.BidsStreamARN.
+	StreamARN string
+	// FromTrimHorizon replays every record still in the stream, up to 24
+	// hours, instead of starting at the latest.
+	FromTrimHorizon bool
+	// PollInterval is how long a shard is left alone after it returned no
+	// records, or after a failed read or publish. It defaults to
+	// DefaultStreamPollInterval.
+	PollInterval time.Duration
+	// ShardInterval is how often the stream is described to find new
+	// shards. It defaults to DefaultStreamShardInterval.
+	ShardInterval time.Duration
+	Logger        *zap.Logger
+}
+
+// BidStreamConsumer tails the bids table's DynamoDB stream and publishes a
+// BidEvent for every bid placed and every auction won.
+//
+// Shards are read concurrently, each after its parent, so events for a bid
+// are published in order. Positions are not checkpointed: a restarted
+// consumer starts over from the latest record, or the trim horizon.
+type BidStreamConsumer struct {
+	client    *dynamodbstreams.Client
+	publisher EventPublisher
+	cfg       BidStreamConfig
+	logger    *zap.Logger
+
+	// started and finished are only used by Run
+	started  map[string]bool
+	finished map[string]chan struct{}
+}
+
+// NewBidStreamConsumer creates a consumer of the stream in cfg.StreamARN.
+func NewBidStreamConsumer(client *dynamodbstreams.Client, publisher EventPublisher, cfg BidStreamConfig) (*BidStreamConsumer, error) {
+	if cfg.StreamARN == "" {
+		return nil, fmt.Errorf("%w: a bid stream consumer needs a stream ARN", ErrInvalidConfig)
+	}
+	if publisher == nil {
+		return nil, fmt.Errorf("%w: a bid stream consumer needs a publisher", ErrInvalidConfig)
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultStreamPollInterval
+	}
+	if cfg.ShardInterval <= 0 {
+		cfg.ShardInterval = DefaultStreamShardInterval
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &BidStreamConsumer{
+		client:    client,
+		publisher: publisher,
+		cfg:       cfg,
+		logger:    logger,
+		started:   make(map[string]bool),
+		finished:  make(map[string]chan struct{}),
+	}, nil
+}
+
+// Run consumes the stream until ctx is cancelled, then waits for its shard
+// readers to stop and returns ctx's error.
+func (c *BidStreamConsumer) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ticker := time.NewTicker(c.cfg.ShardInterval)
+	defer ticker.Stop()
+
+	// only the shards in the stream when the consumer starts begin at the
+	// latest record; any shard after them is read in full
+	startAt := streamtypes.ShardIteratorTypeLatest
+	if c.cfg.FromTrimHorizon {
+		startAt = streamtypes.ShardIteratorTypeTrimHorizon
+	}
+
+	for {
+		shards, err := c.describeShards(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.logger.Warn("failed to describe bid stream", zap.Error(err))
+		}
+
+		for _, shard := range shards {
+			id := aws.ToString(shard.ShardId)
+			if c.started[id] {
+				continue
+			}
+			c.started[id] = true
+
+			// a parent that has aged out of the stream has nothing left to
+			// wait for
+			parent := c.shardDone(aws.ToString(shard.ParentShardId), shards)
+			done := c.shardDone(id, shards)
+
+			wg.Add(1)
+			go func(iteratorType streamtypes.ShardIteratorType) {
+				defer wg.Done()
+				c.readShard(ctx, id, iteratorType, parent, done)
+			}(startAt)
+		}
+		if len(shards) > 0 {
+			startAt = streamtypes.ShardIteratorTypeTrimHorizon
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// shardDone returns the channel closed once shard id has been read to its
+// end, or nil if the shard isn't in the stream.
+func (c *BidStreamConsumer) shardDone(id string, shards []streamtypes.Shard) chan struct{} {
+	if done, ok := c.finished[id]; ok {
+		return done
+	}
+	for _, shard := range shards {
+		if aws.ToString(shard.ShardId) == id {
+			done := make(chan struct{})
+			c.finished[id] = done
+			return done
+		}
+	}
+	return nil
+}
+
+// describeShards lists every shard in the stream.
+func (c *BidStreamConsumer) describeShards(ctx context.Context) ([]streamtypes.Shard, error) {
+	var shards []streamtypes.Shard
+	var start *string
+	for {
+		out, err := c.client.DescribeStream(ctx, &dynamodbstreams.DescribeStreamInput{
+			StreamArn:             aws.String(c.cfg.StreamARN),
+			ExclusiveStartShardId: start,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error describing stream %s: %v", c.cfg.StreamARN, err)
+		}
+		shards = append(shards, out.StreamDescription.Shards...)
+
+		start = out.StreamDescription.LastEvaluatedShardId
+		if start == nil {
+			return shards, nil
+		}
+	}
+}
+
+// readShard publishes the events in a shard once its parent, if any, has
+// been read, until the shard is closed or ctx is cancelled.
+func (c *BidStreamConsumer) readShard(ctx context.Context, shardID string, iteratorType streamtypes.ShardIteratorType, parent <-chan struct{}, done chan<- struct{}) {
+	if parent != nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-parent:
+		}
+	}
+
+	iterator, ok := c.shardIterator(ctx, shardID, iteratorType)
+	if !ok {
+		return
+	}
+
+	for iterator != nil {
+		out, err := c.client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+			ShardIterator: iterator,
+		})
+		if err != nil {
+			var expired *streamtypes.ExpiredIteratorException
+			if errors.As(err, &expired) {
+				// start over at the shard's oldest record; consumers
+				// deduplicate on sequence numbers
+				iterator, ok = c.shardIterator(ctx, shardID, streamtypes.ShardIteratorTypeTrimHorizon)
+				if !ok {
+					return
+				}
+				continue
+			}
+			if !c.wait(ctx, "failed to read shard", shardID, err) {
+				return
+			}
+			continue
+		}
+
+		for _, record := range out.Records {
+			if !c.publishRecord(ctx, shardID, record) {
+				return
+			}
+		}
+
+		iterator = out.NextShardIterator
+		if len(out.Records) == 0 && iterator != nil && !c.wait(ctx, "", shardID, nil) {
+			return
+		}
+	}
+
+	// the shard was closed and all of it was published
+	if done != nil {
+		close(done)
+	}
+}
+
+// shardIterator gets an iterator over a shard, retrying until it succeeds.
+// It returns false if ctx was cancelled first.
+func (c *BidStreamConsumer) shardIterator(ctx context.Context, shardID string, iteratorType streamtypes.ShardIteratorType) (*string, bool) {
+	for {
+		out, err := c.client.GetShardIterator(ctx, &dynamodbstreams.GetShardIteratorInput{
+			StreamArn:         aws.String(c.cfg.StreamARN),
+			ShardId:           aws.String(shardID),
+			ShardIteratorType: iteratorType,
+		})
+		if err == nil {
+			return out.ShardIterator, true
+		}
+		if !c.wait(ctx, "failed to get shard iterator", shardID, err) {
+			return nil, false
+		}
+	}
+}
+
+// publishRecord publishes a record's events, retrying until they are all
+// published. It returns false if ctx was cancelled first.
+func (c *BidStreamConsumer) publishRecord(ctx context.Context, shardID string, record streamtypes.Record) bool {
+	events, err := bidEvents(record)
+	if err != nil {
+		// a record that can't be decoded never will be
+		c.logger.Error(
+			"skipping undecodable bid stream record",
+			zap.String("shard_id", shardID),
+			zap.String("sequence_number", streamSequenceNumber(record)),
+			zap.Error(err),
+		)
+		return true
+	}
+
+	for _, event := range events {
+		for {
+			err := c.publisher.Publish(ctx, event)
+			if err == nil {
+				break
+			}
+			if !c.wait(ctx, "failed to publish bid event", shardID, err) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// wait logs err, if any, and sleeps for the poll interval. It returns false
+// if ctx was cancelled first.
+func (c *BidStreamConsumer) wait(ctx context.Context, msg, shardID string, err error) bool {
+	if err != nil && ctx.Err() == nil {
+		c.logger.Warn(msg, zap.String("shard_id", shardID), zap.Error(err))
+	}
+
+	timer := time.NewTimer(c.cfg.PollInterval)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func streamSequenceNumber(record streamtypes.Record) string {
+	if record.Dynamodb == nil {
+		return ""
+	}
+	return aws.ToString(record.Dynamodb.SequenceNumber)
+}
+
+// bidEvents normalizes a bids table stream record: inserting a bid places
+// it, and a bid's won flag being set wins its auction. A bid that was
+// recorded already won, e.g. by the bid buffer, does both. Every other
+// change is ignored.
+func bidEvents(record streamtypes.Record) ([]BidEvent, error) {
+	if record.Dynamodb == nil || record.Dynamodb.NewImage == nil {
+		return nil, nil
+	}
+
+	newRow, err := unmarshalStreamBid(record.Dynamodb.NewImage)
+	if err != nil {
+		return nil, err
+	}
+	wasWon := false
+	if record.Dynamodb.OldImage != nil {
+		oldRow, err := unmarshalStreamBid(record.Dynamodb.OldImage)
+		if err != nil {
+			return nil, err
+		}
+		wasWon = oldRow.Won
+	}
+
+	event := BidEvent{
+		TeamID:         bidTeamID(newRow),
+		UserID:         newRow.Target,
+		BidID:          newRow.BidID,
+		Priority:       newRow.Priority,
+		Cost:           newRow.Cost,
+		Score:          newRow.Score,
+		SequenceNumber: aws.ToString(record.Dynamodb.SequenceNumber),
+	}
+
+	var events []BidEvent
+	if record.EventName == streamtypes.OperationTypeInsert {
+		placed := event
+		placed.Type = EventBidPlaced
+		placed.OccurredAtMs = newRow.CreatedAtMs
+		events = append(events, placed)
+	}
+	if newRow.Won && !wasWon && !newRow.Aborted {
+		won := event
+		won.Type = EventAuctionWon
+		won.OccurredAtMs = newRow.UpdatedAtMs
+		events = append(events, won)
+	}
+	return events, nil
+}
+
+func unmarshalStreamBid(image map[string]streamtypes.AttributeValue) (*BidRow, error) {
+	item, err := attributevalue.FromDynamoDBStreamsMap(image)
+	if err != nil {
+		return nil, fmt.Errorf("error converting stream image: %v", err)
+	}
+	row := &BidRow{}
+	if err := attributevalue.UnmarshalMap(item, row); err != nil {
+		return nil, fmt.Errorf("error unmarshalling bid: %v", err)
+	}
+	return row, nil
+}
+
+// BidsStreamARN returns the ARN of the bids table's stream, for a
+// BidStreamConsumer. It fails if the table has no stream enabled.
+func (s *DynamoStore) BidsStreamARN(ctx context.Context) (string, error) {
+	out, err := s.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(s.bidsTable()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error describing table %s: %v", s.bidsTable(), err)
+	}
+
+	arn := aws.ToString(out.Table.LatestStreamArn)
+	if arn == "" {
+		return "", fmt.Errorf("%w: table %s has no stream", ErrSchemaMismatch, s.bidsTable())
+	}
+	return arn, nil
+}
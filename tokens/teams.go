@@ -0,0 +1,240 @@
+package tokens
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TeamStatus is where a team is in its lifecycle.
+type TeamStatus string
+
+const (
+	// TeamActive teams bid and are charged as usual. Teams created before
+	// statuses existed have no status, which counts as active.
+	TeamActive TeamStatus = "active"
+	// TeamSuspended teams can't bid until they are reinstated, but keep
+	// their balance and history.
+	TeamSuspended TeamStatus = "suspended"
+	// TeamArchived teams are tombstones: they can't bid, be reinstated or
+	// receive transfers, and their ID can't be reused until DeleteTeam
+	// removes them.
+	TeamArchived TeamStatus = "archived"
+)
+
+// Team is a team's lifecycle state, as kept on its token row.
+type Team struct {
+	TeamID string     `json:"team_id"`
+	Name   string     `json:"name,omitempty"`
+	Status TeamStatus `json:"status"`
+	// StatusReason is why the team was last suspended or archived.
+	StatusReason      string `json:"status_reason,omitempty"`
+	StatusChangedAtMs int64  `json:"status_changed_at_ms,omitempty"`
+	Balance           int64  `json:"balance"`
+	CreatedAtMs       int64  `json:"created_at_ms"`
+	UpdatedAtMs       int64  `json:"updated_at_ms"`
+}
+
+// TeamStatusUpdate moves a team to Status, provided its status is one of
+// From; see Store.SetTeamStatus.
+type TeamStatusUpdate struct {
+	TeamID string
+	Status TeamStatus
+	Reason string
+	From   []TeamStatus
+	NowMs  int64
+}
+
+// status returns the team's status, TeamActive if it has none.
+func (row *TokenDBRow) status() TeamStatus {
+	if row.Status == "" {
+		return TeamActive
+	}
+	return row.Status
+}
+
+// canBid fails with ErrTeamSuspended or ErrTeamArchived for a team that
+// can't bid.
+func (row *TokenDBRow) canBid() error {
+	switch row.status() {
+	case TeamSuspended:
+		return fmt.Errorf("%w: %s", ErrTeamSuspended, row.TeamID)
+	case TeamArchived:
+		return fmt.Errorf("%w: %s", ErrTeamArchived, row.TeamID)
+	}
+	return nil
+}
+
+func teamFromRow(row *TokenDBRow) *Team {
+	return &Team{
+		TeamID:            row.TeamID,
+		Name:              row.Name,
+		Status:            row.status(),
+		StatusReason:      row.StatusReason,
+		StatusChangedAtMs: row.StatusChangedAtMs,
+		Balance:           row.TokenBalance,
+		CreatedAtMs:       row.CreatedAtMs,
+		UpdatedAtMs:       row.UpdatedAtMs,
+	}
+}
+
+// CreateTeam onboards a team, provisioning its token row with the initial
+// balance and reputation as EnsureTeam does. Unlike EnsureTeam it fails with
+// ErrTeamExists if the team already has a row, archived teams included.
+func (tm *Manager) CreateTeam(ctx context.Context, teamID, name string) (*Team, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	teamID = tm.normalizeID(teamID)
+	if strings.TrimSpace(teamID) == "" {
+		return nil, fmt.Errorf("%w: team ID is required", ErrInvalidTeam)
+	}
+
+	now := tm.clock.Now().UnixMilli()
+	row := &TokenDBRow{
+		Pk:              GetTokenPK(teamID),
+		TeamID:          teamID,
+		Name:            name,
+		Status:          TeamActive,
+		TokenBalance:    tm.initialTokenCount,
+		Balances:        tm.initialBalances(),
+		LastRefillTime:  now,
+		ReputationScore: tm.maxReputation,
+		// reputation starts recovering from creation
+		LastReputationRecoveryMs: now,
+		PriorityUsage:            tm.InitialPriorityUsage(),
+		CreatedAtMs:              now,
+		UpdatedAtMs:              now,
+	}
+	err := tm.store.CreateTokenRow(ctx, row)
+	if errors.Is(err, ErrConditionFailed) {
+		return nil, fmt.Errorf("%w: %s", ErrTeamExists, teamID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return teamFromRow(row), nil
+}
+
+// GetTeam returns a team's lifecycle state.
+func (tm *Manager) GetTeam(ctx context.Context, teamID string) (*Team, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	row, err := tm.store.GetTokenRow(ctx, tm.normalizeID(teamID), true)
+	if err != nil {
+		return nil, err
+	}
+	return teamFromRow(row), nil
+}
+
+// ListTeams returns every team with status, or every team if status is
+// empty, ordered by team ID.
+func (tm *Manager) ListTeams(ctx context.Context, status TeamStatus) ([]Team, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	rows, err := tm.store.ScanTokenRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var teams []Team
+	for i := range rows {
+		if status != "" && rows[i].status() != status {
+			continue
+		}
+		teams = append(teams, *teamFromRow(&rows[i]))
+	}
+	slices.SortFunc(teams, func(a, b Team) int {
+		return cmp.Compare(a.TeamID, b.TeamID)
+	})
+	return teams, nil
+}
+
+// SuspendTeam stops a team from bidding: its bids are left out of auctions
+// and spends fail with ErrTeamSuspended, while its balance and history are
+// kept. Suspending a suspended team updates the reason. It fails with
+// ErrTeamArchived for an archived team.
+func (tm *Manager) SuspendTeam(ctx context.Context, teamID, reason string) (*Team, error) {
+	return tm.setTeamStatus(ctx, teamID, TeamSuspended, reason, TeamActive, TeamSuspended)
+}
+
+// ReinstateTeam lets a suspended team bid again. An active team stays
+// active; an archived team can't be reinstated and fails with
+// ErrTeamArchived.
+func (tm *Manager) ReinstateTeam(ctx context.Context, teamID string) (*Team, error) {
+	return tm.setTeamStatus(ctx, teamID, TeamActive, "", TeamActive, TeamSuspended)
+}
+
+// ArchiveTeam tombstones a team: it can no longer bid, be reinstated or
+// receive transfers, and its ID stays taken, but its row and history are
+// kept for the record. Archiving an archived team returns it unchanged.
+func (tm *Manager) ArchiveTeam(ctx context.Context, teamID, reason string) (*Team, error) {
+	team, err := tm.setTeamStatus(ctx, teamID, TeamArchived, reason, TeamActive, TeamSuspended)
+	if errors.Is(err, ErrTeamArchived) {
+		return tm.GetTeam(ctx, teamID)
+	}
+	return team, err
+}
+
+// setTeamStatus moves a team to status from any of from.
+func (tm *Manager) setTeamStatus(
+	ctx context.Context,
+	teamID string,
+	status TeamStatus,
+	reason string,
+	from ...TeamStatus,
+) (*Team, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	teamID = tm.normalizeID(teamID)
+	row, err := tm.store.SetTeamStatus(ctx, TeamStatusUpdate{
+		TeamID: teamID,
+		Status: status,
+		Reason: reason,
+		From:   from,
+		NowMs:  tm.clock.Now().UnixMilli(),
+	})
+	var condErr *ConditionFailedError
+	if errors.As(err, &condErr) {
+		if condErr.Row == nil {
+			return nil, fmt.Errorf("%w: %s", ErrTeamNotFound, teamID)
+		}
+		// the only status a transition is never allowed from
+		return nil, fmt.Errorf("%w: %s", ErrTeamArchived, teamID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return teamFromRow(row), nil
+}
+
+// DeleteTeam removes a team for good: its token row, auto-bid policy,
+// webhook, budget pacing and stats. Its bids, auctions and ledger are kept
+// as history, the ledger closing with the balance the team had, and the
+// team ID can be created again. Use ArchiveTeam to retire a team while
+// keeping it on record.
+func (tm *Manager) DeleteTeam(ctx context.Context, teamID string) error {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	teamID = tm.normalizeID(teamID)
+	for range refillAttempts {
+		row, err := tm.store.GetTokenRow(ctx, teamID, true)
+		if err != nil {
+			return err
+		}
+
+		err = tm.store.DeleteTeam(ctx, teamID, row.TokenBalance, tm.clock.Now().UnixMilli())
+		if !errors.Is(err, ErrConditionFailed) {
+			return err
+		}
+		// the balance moved since it was read
+	}
+	return fmt.Errorf("%w: team %s", ErrAuctionConflict, teamID)
+}
@@ -0,0 +1,1026 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/exp/rand"
+
+	"github.com/christopherwong-hinge/auction/events"
+)
+
+const (
+	TableNameTokens string = "tokens"
+	TableNameBids   string = "bids"
+	// TableNameAuctions records the auctions run, with their results.
+	TableNameAuctions string = "auctions"
+	// TableNameBalanceHistory holds balance snapshots; see
+	// WithBalanceHistory.
+	TableNameBalanceHistory string = "balance_history"
+	// TableNameLedger holds every movement of team balances; see
+	// LedgerEntry.
+	TableNameLedger string = "ledger"
+	// TableNameStats holds each team's TeamStats.
+	TableNameStats string = "stats"
+	// IndexNameBidsByCreatedAt is a GSI on the bids table keyed by pk and
+	// created_at_ms, used to read a team's most recent bids.
+	IndexNameBidsByCreatedAt string = "bids_by_created_at"
+	// IndexNameBidsByTarget is a GSI on the bids table keyed by target and
+	// created_at_ms, used to read every team's bids for a user.
+	IndexNameBidsByTarget string = "bids_by_target"
+	// IndexNameBidsByExpiry is a sparse GSI on the bids table keyed by
+	// expiry_bucket and expires_at, used to archive bids before they expire.
+	IndexNameBidsByExpiry  string = "bids_by_expiry"
+	InitialTokenCount      int64  = 1000
+	InitialReputationScore int64  = 100
+	MaxReputationScore     int64  = 100
+	MaxPriority            int64  = 10
+
+	// DefaultMaxBidsPerAuction bounds the number of bids a single RunAuction
+	// call will consider, since each bid costs a balance read.
+	DefaultMaxBidsPerAuction int = 100
+	// DefaultBidPageSize is the number of bids in a GetBidsPage page when the
+	// query doesn't give one.
+	DefaultBidPageSize int = 100
+	// DefaultBalanceFetchParallelism bounds the batched balance reads, of
+	// up to 100 teams each, issued at once.
+	DefaultBalanceFetchParallelism int = 8
+
+	// batchGetLimit is the maximum number of keys per BatchGetItem request.
+	batchGetLimit = 100
+	// batchWriteLimit is the maximum number of items per BatchWriteItem request.
+	batchWriteLimit = 25
+)
+
+var (
+	// priority -> cost
+	costMap = map[int64]int64{
+		1:  1,
+		2:  1,
+		3:  1,
+		4:  5,
+		5:  5,
+		6:  5,
+		7:  7,
+		8:  7,
+		9:  7,
+		10: 10,
+	}
+
+	// InitialPriorityUsage is the priority_usage of a new team under the
+	// default MaxPriority.
+	//
+	// Deprecated: use Manager.InitialPriorityUsage, which follows the
+	// configured max priority.
+	InitialPriorityUsage = map[int]int{
+		1:  0,
+		2:  0,
+		3:  0,
+		4:  0,
+		5:  0,
+		6:  0,
+		7:  0,
+		8:  0,
+		9:  0,
+		10: 0,
+	}
+)
+
+type Bid struct {
+	TeamID   string `json:"team_id"`
+	UserID   string `json:"user_id"`
+	Priority int64  `json:"priority"`
+	// Currency is the currency the bid spends, empty for the standard one;
+	// see Currency.
+	Currency string `json:"currency,omitempty"`
+}
+
+type Manager struct {
+	store  Store
+	logger *zap.Logger
+	clock  Clock
+
+	endpoint            string
+	localStack          bool
+	dynamoClient        *dynamodb.Client
+	tableNames          TableNames
+	tableSuffix         string
+	provisionedCapacity *ProvisionedCapacity
+
+	// rand is nil unless WithRandSource is given; randMu guards it since
+	// *rand.Rand is not safe for concurrent use.
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	maxBidsPerAuction int
+	// balanceFetchParallelism bounds batchGetTokenRows' concurrent batches
+	balanceFetchParallelism int
+	skipTableCreation       bool
+	reputationReward        ReputationReward
+	reputationPenalty       ReputationPenalty
+	reputationFloor         int64
+	maxReputation           int64
+	maxPriority             int64
+	costTiers               []CostTier
+	costMap                 map[int64]int64
+	initialTokenCount       int64
+	scoreWeights            ScoreWeights
+	scorer                  Scorer
+	allowTruncate           bool
+	chargeFallback          bool
+	teamScoreWeights        map[string]ScoreWeights
+	decisionLog             *jsonLog
+	reputationLog           *jsonLog
+	publisher               events.Publisher
+	settlementPublisher     events.Publisher
+	winCooldown             time.Duration
+	winnerVeto              WinnerVeto
+	bidShards               int
+	balanceHistory          bool
+	lowercaseIDs            bool
+	auctionLockTTL          time.Duration
+	auctionStrategy         AuctionStrategy
+	tieBreak                TieBreak
+	bidValidation           BidValidation
+
+	consistencyTimeout time.Duration
+	idempotencyTTL     time.Duration
+	metrics            *Metrics
+	tracer             trace.Tracer
+
+	bidBufferConfig *BidBufferConfig
+	bidBuffer       *bidBuffer
+	// pending holds the bids submitted to the HTTP and gRPC APIs until
+	// their user's auction is run.
+	pendingConfig PendingBidsConfig
+	pending       *pendingBids
+
+	webhookConfig *WebhookConfig
+	retryConfig   *RetryConfig
+	webhooks      *webhookNotifier
+
+	breakerConfig  *BreakerConfig
+	breaker        *BreakerStore
+	degradedConfig *DegradedConfig
+	degraded       *degradedMode
+	// degradedDone is closed when the degraded settlement scheduler, if
+	// any, stops.
+	degradedDone chan struct{}
+
+	dripRefill         *DripRefill
+	reputationRecovery *ReputationRecovery
+	budgetPacing       *BudgetPacing
+	priorityQuotas     *PriorityQuotas
+	frequencyCap       *FrequencyCap
+	currencies         map[string]Currency
+	// dripDone is closed when the drip refill scheduler, if any, stops.
+	dripDone chan struct{}
+
+	windowSettleInterval time.Duration
+	// windowSettleDone is closed when the auction window settlement
+	// scheduler, if any, stops.
+	windowSettleDone chan struct{}
+
+	ledgerReconcileInterval time.Duration
+	// ledgerReconcileDone is closed when the ledger reconcile scheduler, if
+	// any, stops.
+	ledgerReconcileDone chan struct{}
+
+	statsInterval time.Duration
+	// statsDone is closed when the stats aggregation scheduler, if any,
+	// stops.
+	statsDone chan struct{}
+
+	bidRetention       time.Duration
+	bidArchiver        BidArchiver
+	bidArchiveInterval time.Duration
+	// bidArchiveDone is closed when the bid archiver scheduler, if any,
+	// stops.
+	bidArchiveDone chan struct{}
+
+	// baseCtx bounds every operation and is cancelled by Close.
+	baseCtx    context.Context
+	baseCancel context.CancelFunc
+}
+
+type TokenDBRow struct {
+	Pk           string `dynamodbav:"pk"`
+	TeamID       string `dynamodbav:"team_id"`
+	TokenBalance int64  `dynamodbav:"token_balance"`
+	// Balances holds the team's balance in each currency besides the
+	// standard one; see Currency.
+	Balances        map[string]int64 `dynamodbav:"balances,omitempty"`
+	HeldBalance     int64            `dynamodbav:"held_balance"`
+	LastRefillTime  int64            `dynamodbav:"last_refill_time"`
+	LastWinAtMs     int64            `dynamodbav:"last_win_at_ms"`
+	ReputationScore int64            `dynamodbav:"reputation_score"`
+	// LastReputationRecoveryMs is when reputation last recovered; see
+	// WithReputationRecovery.
+	LastReputationRecoveryMs int64       `dynamodbav:"last_reputation_recovery_ms"`
+	PriorityUsage            map[int]int `dynamodbav:"priority_usage"`
+	// WinCount counts the team's auction wins, and AuctionCount the auctions
+	// it bid in while TieBreakWinRate was configured.
+	WinCount     int64 `dynamodbav:"win_count"`
+	AuctionCount int64 `dynamodbav:"auction_count"`
+	// Name and Status are set by CreateTeam, and Status and StatusReason
+	// changed by SuspendTeam, ReinstateTeam and ArchiveTeam; see Team.
+	Name              string     `dynamodbav:"team_name,omitempty"`
+	Status            TeamStatus `dynamodbav:"team_status,omitempty"`
+	StatusReason      string     `dynamodbav:"status_reason,omitempty"`
+	StatusChangedAtMs int64      `dynamodbav:"status_changed_at_ms,omitempty"`
+	CreatedAtMs       int64      `dynamodbav:"created_at_ms"`
+	UpdatedAtMs       int64      `dynamodbav:"updated_at_ms"`
+	// Version counts the writes that changed the row's balances or
+	// reputation, so a write computed from a read can be conditioned on
+	// nothing having changed since; see BalanceUpdate.Version. Rows written
+	// before versions existed read as version zero.
+	Version int64 `dynamodbav:"version"`
+}
+
+type BidRow struct {
+	Pk         string  `dynamodbav:"pk" json:"pk"`
+	Sk         string  `dynamodbav:"sk" json:"sk"`
+	BidID      string  `dynamodbav:"bid_id" json:"bid_id"`
+	Target     string  `dynamodbav:"target" json:"target"`
+	Priority   int64   `dynamodbav:"priority" json:"priority"`
+	Cost       int64   `dynamodbav:"cost" json:"cost"`
+	Score      float64 `dynamodbav:"score" json:"score"`
+	BaseCost   int64   `dynamodbav:"base_cost" json:"base_cost"`
+	Multiplier float64 `dynamodbav:"multiplier" json:"multiplier"`
+	Reputation int64   `dynamodbav:"reputation" json:"reputation"`
+	// Currency is the currency the bid spends, empty for the standard one.
+	Currency string `dynamodbav:"currency,omitempty" json:"currency,omitempty"`
+	Won      bool   `dynamodbav:"won" json:"won"`
+	// Aborted marks a bid recorded by an auction that was cancelled before
+	// it resolved.
+	Aborted     bool  `dynamodbav:"aborted,omitempty" json:"aborted,omitempty"`
+	CreatedAtMs int64 `dynamodbav:"created_at_ms" json:"created_at_ms"`
+	UpdatedAtMs int64 `dynamodbav:"updated_at_ms" json:"updated_at_ms"`
+	// ExpiresAt is when DynamoDB's TTL deletes the bid, in Unix seconds, if
+	// the Manager has a bid retention; see WithBidRetention.
+	ExpiresAt int64 `dynamodbav:"expires_at,omitempty" json:"expires_at,omitempty"`
+	// ExpiryBucket keys the bid in IndexNameBidsByExpiry, if it expires; see
+	// GetBidExpiryBucket.
+	ExpiryBucket string `dynamodbav:"expiry_bucket,omitempty" json:"-"`
+}
+
+// WinnerVeto gives fraud and abuse systems a last chance to reject an
+// auction's winner, e.g. a team that was just suspended. It runs after
+// ranking and before charging; returning true vetoes the team and the
+// auction moves on to the next eligible bid, or ends with ErrNoWinner. An
+// error fails the auction.
+type WinnerVeto func(ctx context.Context, teamID string) (vetoed bool, err error)
+
+// AuctionResult describes the outcome of a RunAuction call.
+type AuctionResult struct {
+	// AuctionID identifies the auction in the auctions table; see
+	// GetAuctionHistory. The winners of a multi-winner auction share it.
+	AuctionID string `json:"auction_id"`
+	UserID    string `json:"user_id"`
+	TeamID    string `json:"team_id"`
+	// BidID identifies the winning BidRow; see GetWinningBid.
+	BidID string `json:"bid_id"`
+	// HoldID is set when the auction ran with AuctionConfig.UseHolds; see
+	// ConfirmAuctionDelivery.
+	HoldID string `json:"hold_id,omitempty"`
+	// Score is the winning bid's score, always within [0, 100].
+	Score float64 `json:"score"`
+	// Cost is what the winner was charged, which under SecondPrice may be
+	// less than its bid cost.
+	Cost int64 `json:"cost"`
+	// RemainingBalance is the winner's token balance after the charge. With
+	// holds it is estimated from the balance read when the bid was scored.
+	RemainingBalance int64 `json:"remaining_balance"`
+	// LosingBids are the auction's other bids, best first.
+	LosingBids []LosingBid `json:"losing_bids"`
+	// SettlementPending is set when the auction ran in degraded mode: the
+	// winner is charged once the store is available again, and
+	// RemainingBalance is estimated from its cached balance. See
+	// WithDegradedMode.
+	SettlementPending bool `json:"settlement_pending,omitempty"`
+}
+
+// LosingBid is a bid that didn't win its auction. SkipReason says why it
+// didn't compete, and is empty for a bid that was outranked.
+type LosingBid struct {
+	TeamID     string  `json:"team_id"`
+	BidID      string  `json:"bid_id,omitempty"`
+	Priority   int64   `json:"priority"`
+	Score      float64 `json:"score"`
+	Cost       int64   `json:"cost"`
+	SkipReason string  `json:"skip_reason,omitempty"`
+}
+
+// Initialize DynamoDB Client
+func NewManager(opts ...Option) (*Manager, error) {
+	tm := &Manager{
+		logger:                  zap.NewNop(),
+		clock:                   systemClock{},
+		maxBidsPerAuction:       DefaultMaxBidsPerAuction,
+		balanceFetchParallelism: DefaultBalanceFetchParallelism,
+		chargeFallback:          true,
+		reputationPenalty:       DefaultReputationPenalty,
+		maxReputation:           MaxReputationScore,
+		maxPriority:             MaxPriority,
+		costMap:                 costMap,
+		initialTokenCount:       InitialTokenCount,
+		scoreWeights:            DefaultScoreWeights,
+	}
+	for _, opt := range opts {
+		opt(tm)
+	}
+	tm.baseCtx, tm.baseCancel = context.WithCancel(context.Background())
+
+	if err := tm.init(); err != nil {
+		tm.baseCancel()
+		return nil, err
+	}
+	return tm, nil
+}
+
+// init validates the Manager's configuration and connects it to DynamoDB,
+// unless a store was given.
+func (tm *Manager) init() error {
+	if tm.logger == nil {
+		tm.logger = zap.NewNop()
+	}
+	if tm.clock == nil {
+		tm.clock = systemClock{}
+	}
+	if tm.maxPriority < 1 {
+		return fmt.Errorf("max priority must be at least 1, got %d", tm.maxPriority)
+	}
+	if err := validateCostTiers(tm.costTiers, tm.maxPriority); err != nil {
+		return err
+	}
+	if len(tm.costTiers) == 0 {
+		if err := validateCostMap(tm.costMap, tm.maxPriority); err != nil {
+			return err
+		}
+	}
+	if p := tm.budgetPacing; p != nil {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	if f := tm.frequencyCap; f != nil {
+		if err := f.validate(); err != nil {
+			return err
+		}
+	}
+	if q := tm.priorityQuotas; q != nil {
+		if err := q.validate(tm.maxPriority); err != nil {
+			return err
+		}
+	}
+	for name, c := range tm.currencies {
+		if err := c.validate(name, tm.maxPriority); err != nil {
+			return err
+		}
+	}
+	if tm.initialTokenCount < 0 {
+		return fmt.Errorf("initial token count must not be negative, got %d", tm.initialTokenCount)
+	}
+	if d := tm.dripRefill; d != nil {
+		if d.Interval < time.Millisecond || d.Amount <= 0 || d.Cap < 0 || d.ScheduleInterval < 0 {
+			return fmt.Errorf("drip refill needs a positive interval and amount, got %v and %d", d.Interval, d.Amount)
+		}
+		if d.Cap == 0 {
+			d.Cap = tm.initialTokenCount
+		}
+	}
+	if tm.maxBidsPerAuction < 1 {
+		return fmt.Errorf("max bids per auction must be positive, got %d", tm.maxBidsPerAuction)
+	}
+	if tm.balanceFetchParallelism < 1 {
+		return fmt.Errorf("balance fetch parallelism must be positive, got %d", tm.balanceFetchParallelism)
+	}
+	if tm.reputationFloor < 0 || tm.reputationFloor >= tm.maxReputation {
+		return fmt.Errorf("reputation floor must be between 0 and the max reputation %d, got %d", tm.maxReputation, tm.reputationFloor)
+	}
+	if r := tm.reputationRecovery; r != nil {
+		if r.Interval < time.Millisecond || r.Amount <= 0 || r.Cap < 0 {
+			return fmt.Errorf("reputation recovery needs a positive interval and amount, got %v and %d", r.Interval, r.Amount)
+		}
+		if r.Cap == 0 || r.Cap > tm.maxReputation {
+			r.Cap = tm.maxReputation
+		}
+	}
+
+	if tm.bidArchiver != nil && tm.bidRetention <= 0 {
+		return fmt.Errorf("a bid archiver needs a bid retention")
+	}
+	// each run archives two intervals ahead, so a shorter retention would
+	// let bids recorded after a run expire before the next one reaches them
+	if tm.bidArchiver != nil && tm.bidArchiveInterval > 0 && tm.bidRetention <= 2*tm.bidArchiveInterval {
+		return fmt.Errorf("bid retention %v must be more than twice the bid archive interval %v", tm.bidRetention, tm.bidArchiveInterval)
+	}
+
+	if tm.store == nil {
+		client := tm.dynamoClient
+		if client == nil {
+			cfg, err := config.LoadDefaultConfig(tm.baseCtx)
+			if err != nil {
+				return fmt.Errorf("unable to load SDK config: %v", err)
+			}
+			if tm.localStack && tm.endpoint == "" {
+				tm.endpoint = DefaultEndpoint
+			}
+			client = dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+				if tm.endpoint != "" {
+					o.BaseEndpoint = aws.String(tm.endpoint)
+				}
+				if tm.localStack {
+					o.Credentials = credentials.NewStaticCredentialsProvider("test", "test", "")
+				}
+			})
+		}
+		tm.store = NewDynamoStoreWithTables(client, tm.tableNames.withDefaults(tm.tableSuffix), tm.provisionedCapacity, tm.logger)
+	}
+	if tm.retryConfig != nil {
+		tm.store = NewRetryStore(tm.store, *tm.retryConfig, tm.logger, WithStoreClock(tm.clock))
+	}
+	if tm.breakerConfig != nil {
+		// outside the retries, so a call retried to no avail fails once
+		tm.breaker = NewBreakerStore(tm.store, *tm.breakerConfig, tm.logger, WithStoreClock(tm.clock))
+		tm.store = tm.breaker
+	}
+	if tm.degradedConfig != nil {
+		if tm.breaker == nil {
+			return fmt.Errorf("%w: degraded mode needs a circuit breaker", ErrInvalidConfig)
+		}
+		tm.degraded = newDegradedMode(*tm.degradedConfig)
+	}
+
+	if !tm.skipTableCreation {
+		if err := tm.EnsureTables(tm.baseCtx); err != nil {
+			return err
+		}
+	}
+
+	if tm.bidBufferConfig != nil {
+		tm.bidBuffer = newBidBuffer(tm, *tm.bidBufferConfig)
+	}
+	tm.pending = newPendingBids(tm.pendingConfig, tm.maxBidsPerAuction)
+
+	if tm.webhookConfig != nil {
+		tm.webhooks = newWebhookNotifier(tm, *tm.webhookConfig)
+	}
+
+	if tm.dripRefill != nil && tm.dripRefill.ScheduleInterval > 0 {
+		tm.dripDone = make(chan struct{})
+		go tm.runDripScheduler(tm.dripDone)
+	}
+
+	if tm.windowSettleInterval > 0 {
+		tm.windowSettleDone = make(chan struct{})
+		go tm.runWindowSettlement(tm.windowSettleInterval, tm.windowSettleDone)
+	}
+
+	if tm.bidArchiver != nil && tm.bidArchiveInterval > 0 {
+		tm.bidArchiveDone = make(chan struct{})
+		go tm.runBidArchiver(tm.bidArchiveInterval, tm.bidArchiveDone)
+	}
+
+	if tm.ledgerReconcileInterval > 0 {
+		tm.ledgerReconcileDone = make(chan struct{})
+		go tm.runLedgerReconcile(tm.ledgerReconcileInterval, tm.ledgerReconcileDone)
+	}
+
+	if tm.statsInterval > 0 {
+		tm.statsDone = make(chan struct{})
+		go tm.runStatsAggregation(tm.statsInterval, tm.statsDone)
+	}
+
+	if tm.degraded != nil {
+		tm.degradedDone = make(chan struct{})
+		go tm.runDegradedSettlement(tm.degraded.cfg.SettleInterval, tm.degradedDone)
+	}
+
+	return nil
+}
+
+// withBase derives a context from ctx that is also cancelled when the
+// Manager is closed.
+func (tm *Manager) withBase(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(tm.baseCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// Close releases the Manager's resources. It cancels operations still in
+// flight and stops the drip refill scheduler, makes a last attempt to settle
+// degraded auctions, dead-letters undelivered webhook notifications, then
+// writes any buffered bids.
+func (tm *Manager) Close() error {
+	tm.baseCancel()
+
+	if tm.dripDone != nil {
+		<-tm.dripDone
+	}
+	if tm.windowSettleDone != nil {
+		<-tm.windowSettleDone
+	}
+	if tm.bidArchiveDone != nil {
+		<-tm.bidArchiveDone
+	}
+	if tm.ledgerReconcileDone != nil {
+		<-tm.ledgerReconcileDone
+	}
+	if tm.statsDone != nil {
+		<-tm.statsDone
+	}
+	if tm.degradedDone != nil {
+		<-tm.degradedDone
+		tm.closeDegraded()
+	}
+
+	if tm.webhooks != nil {
+		tm.webhooks.close()
+	}
+
+	if tm.bidBuffer != nil {
+		return tm.bidBuffer.close(context.Background())
+	}
+	return nil
+}
+
+// EnsureTables prepares the Manager's store. With DynamoDB it creates the
+// tokens, bids, auctions and balance history tables, then checks the key
+// schema of each. Create failures, including the tables already existing,
+// are logged; a table that is missing or whose keys don't match returns an
+// error, ErrSchemaMismatch for the latter.
+func (tm *Manager) EnsureTables(ctx context.Context) error {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.store.EnsureSchema(ctx)
+}
+
+// Initialize tokens for all teams
+func (tm *Manager) InitializeTokens(ctx context.Context, teams []string) error {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	for _, teamID := range teams {
+		if err := tm.EnsureTeam(ctx, teamID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitialPriorityUsage returns the priority_usage of a new team: a zero count
+// for every priority from 1 to the configured max priority.
+func (tm *Manager) InitialPriorityUsage() map[int]int {
+	usage := make(map[int]int, tm.maxPriority)
+	for p := 1; p <= int(tm.maxPriority); p++ {
+		usage[p] = 0
+	}
+	return usage
+}
+
+// EnsureTeam creates the token row for a team if it does not exist. If it
+// does, any attribute missing from the row (e.g. priority_usage on teams
+// created before it was introduced) is backfilled with its initial value;
+// attributes that are already set, such as the balance, are left untouched.
+func (tm *Manager) EnsureTeam(ctx context.Context, teamID string) error {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	teamID = tm.normalizeID(teamID)
+
+	now := tm.clock.Now().UnixMilli()
+
+	return tm.store.EnsureTokenRow(ctx, &TokenDBRow{
+		Pk:              GetTokenPK(teamID),
+		TeamID:          teamID,
+		TokenBalance:    tm.initialTokenCount,
+		Balances:        tm.initialBalances(),
+		LastRefillTime:  now,
+		ReputationScore: tm.maxReputation,
+		// an old row without one starts recovering from its first read
+		LastReputationRecoveryMs: now,
+		PriorityUsage:            tm.InitialPriorityUsage(),
+		CreatedAtMs:              now,
+		UpdatedAtMs:              now,
+	})
+}
+
+func (tm *Manager) computeBidcost(bid *Bid, reputation int64) (int64, error) {
+	cur, err := tm.currency(bid)
+	if err != nil {
+		return 0, err
+	}
+
+	breakdown, err := tm.priceBid(bid.Priority, cur, reputation, tm.maxReputation)
+	if err != nil {
+		return 0, err
+	}
+	return breakdown.Cost, nil
+}
+
+// HasPriority reports whether p is a priority the Manager can price.
+func (tm *Manager) HasPriority(p int64) bool {
+	if len(tm.costTiers) > 0 {
+		return p >= 1 && p <= tm.maxPriority
+	}
+	_, ok := tm.costMap[p]
+	return ok && p <= tm.maxPriority
+}
+
+// CalculateCost returns what a bid at priority costs a team with the given
+// reputation, or ErrUnknownPriority if it cannot be priced.
+func (tm *Manager) CalculateCost(priority int64, reputation int64) (int64, error) {
+	return tm.calculateCost(priority, reputation, tm.maxReputation)
+}
+
+func (tm *Manager) calculateCost(priority int64, reputation int64, maxReputation int64) (int64, error) {
+	breakdown, err := tm.priceBid(priority, nil, reputation, maxReputation)
+	if err != nil {
+		return 0, err
+	}
+	return breakdown.Cost, nil
+}
+
+// CostBreakdown records how a bid's cost was derived: Cost is BaseCost
+// scaled by Multiplier, which in turn depends on Reputation.
+type CostBreakdown struct {
+	BaseCost   int64   `json:"base_cost"`
+	Multiplier float64 `json:"multiplier"`
+	Reputation int64   `json:"reputation"`
+	Cost       int64   `json:"cost"`
+}
+
+// priceBid prices a bid at priority in currency cur, nil for the standard
+// currency.
+func (tm *Manager) priceBid(priority int64, cur *Currency, reputation int64, maxReputation int64) (CostBreakdown, error) {
+	baseCost, err := tm.baseCost(priority)
+	if err != nil {
+		return CostBreakdown{}, err
+	}
+	if cur != nil && cur.CostMap != nil {
+		var ok bool
+		baseCost, ok = cur.CostMap[priority]
+		if !ok {
+			return CostBreakdown{}, fmt.Errorf("%w: %d", ErrUnknownPriority, priority)
+		}
+	}
+
+	minMultiplier := 1.0 // No price increase at max reputation
+	maxMultiplier := 2.5 // 2.5x price increase at minimum reputation
+	priceMultiplier := minMultiplier + (maxMultiplier-minMultiplier)*(1-float64(reputation)/float64(maxReputation))
+
+	cost := float64(baseCost) * priceMultiplier
+
+	return CostBreakdown{
+		BaseCost:   baseCost,
+		Multiplier: priceMultiplier,
+		Reputation: reputation,
+		Cost:       int64(cost),
+	}, nil
+}
+
+// CostSchedule returns, for every priority the Manager can price, what a bid
+// would currently cost teamID given its reputation.
+func (tm *Manager) CostSchedule(ctx context.Context, teamID string) (map[int64]int64, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	_, reputation, err := tm.GetTokenBalance(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	priorities := tm.priorities()
+	schedule := make(map[int64]int64, len(priorities))
+	for _, priority := range priorities {
+		cost, err := tm.CalculateCost(priority, reputation)
+		if err != nil {
+			return nil, err
+		}
+		schedule[priority] = cost
+	}
+	return schedule, nil
+}
+
+// Spend tokens. A suspended or archived team can't spend and fails with
+// ErrTeamSuspended or ErrTeamArchived.
+func (tm *Manager) SpendTokens(
+	ctx context.Context,
+	bid *Bid,
+) (int64, error) {
+	return tm.SpendTokensWithKey(ctx, bid, "")
+}
+
+// SpendTokensWithKey spends tokens like SpendTokens. A non-empty
+// idempotencyKey makes retries safe: a spend made again with the same key
+// returns the balance the first one left instead of charging again. Keys
+// are claimed and given up as for AuctionConfig.IdempotencyKey.
+func (tm *Manager) SpendTokensWithKey(
+	ctx context.Context,
+	bid *Bid,
+	idempotencyKey string,
+) (int64, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.spendTokens(ctx, bid, idempotencyKey, nil)
+}
+
+// spendTokens is SpendTokensWithKey, charging price instead of the bid's
+// cost if price is non-nil.
+func (tm *Manager) spendTokens(
+	ctx context.Context,
+	bid *Bid,
+	idempotencyKey string,
+	price *int64,
+) (balance int64, err error) {
+	if idempotencyKey != "" {
+		prior, claimErr := tm.claimIdempotencyKey(ctx, idempotencyOpSpend, idempotencyKey)
+		if claimErr != nil {
+			return 0, claimErr
+		}
+		if prior != nil {
+			return prior.Balance, nil
+		}
+
+		defer func() {
+			if err != nil {
+				tm.releaseIdempotencyKey(ctx, idempotencyOpSpend, idempotencyKey, err)
+				return
+			}
+			tm.completeIdempotencyKey(ctx, idempotencyOpSpend, idempotencyKey, nil, balance)
+		}()
+	}
+
+	bid = &tm.normalizeBids([]Bid{*bid})[0]
+
+	for range spendAttempts {
+		spanCtx, end := tm.startSpan(ctx, SpanGetTokenBalance, bidAttrs(bid)...)
+		row, err := tm.getTokenRow(spanCtx, bid.TeamID)
+		end(err)
+		if err != nil {
+			return 0, err
+		}
+		if err := row.canBid(); err != nil {
+			return 0, err
+		}
+
+		var bidCost int64
+		if price != nil {
+			bidCost = *price
+		} else {
+			bidCost, err = tm.computeBidcost(bid, row.ReputationScore)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		if balance := row.balanceIn(bid.Currency); balance < bidCost {
+			return 0, fmt.Errorf("%w: %d", ErrInsufficientBalance, balance)
+		}
+
+		balance, _, err = tm.chargeTokens(ctx, bid, bidCost, nil, &row.Version)
+		if errors.Is(err, errStaleVersion) {
+			// the row changed since the cost was priced from it
+			continue
+		}
+		return balance, err
+	}
+	return 0, fmt.Errorf("%w: team %s", ErrAuctionConflict, bid.TeamID)
+}
+
+// spendAttempts bounds how often spendTokens reprices a spend whose token
+// row changed between being read and charged.
+const spendAttempts = 3
+
+// errStaleVersion is returned by chargeTokens when the token row moved on
+// from the version the charge was priced from, before anything was charged.
+var errStaleVersion = fmt.Errorf("token row changed: %w", ErrAuctionConflict)
+
+// winCharge describes the auction win a charge settles.
+type winCharge struct {
+	// bid is the won bid row, written in the same transaction as the
+	// charge, or nil for a bid that wasn't recorded.
+	bid *BidRow
+	// reservation, if non-nil, is the bid reservation funding the charge.
+	reservation *HoldRow
+	// lock, if non-nil, is the auction lock the charge is made under; see
+	// BalanceUpdate.Lock.
+	lock *LockRef
+	// group, if non-nil, commits the charge along with those of other
+	// auctions' winners; see RunAuctions.
+	group *settleGroups
+}
+
+// chargeTokens deducts cost from the bidding team's balance and records the
+// bid's priority usage. The deduction is conditional on the balance
+// covering it, so a stale cost or balance can't overdraw the team. win, if
+// non-nil, marks the charge as the settlement of an auction win. version, if
+// non-nil, is the token row version bidCost was priced from; a row that
+// moved on fails the charge with errStaleVersion. It returns the team's
+// balance in the bid's currency after the charge and what it was charged,
+// bidCost unless a priority quota surcharged it.
+func (tm *Manager) chargeTokens(
+	ctx context.Context,
+	bid *Bid,
+	bidCost int64,
+	win *winCharge,
+	version *int64,
+) (balance, charged int64, err error) {
+	ctx, end := tm.startSpan(ctx, SpanSpendTokens, bidAttrs(bid)...)
+	defer func() { end(err) }()
+
+	now := tm.clock.Now()
+	nowMilli := now.UnixMilli()
+
+	quota, err := tm.countQuota(ctx, bid.TeamID, bid.Priority, bidCost, now)
+	if err != nil {
+		return 0, 0, err
+	}
+	bidCost = quota.cost
+
+	// only standard tokens are paced
+	refund := quota.refund
+	if bid.Currency == "" {
+		refundPaced, err := tm.paceSpend(ctx, bid.TeamID, bidCost, now)
+		if err != nil {
+			quota.refund()
+			return 0, 0, err
+		}
+		refund = func() {
+			quota.refund()
+			refundPaced()
+		}
+	}
+
+	u := BalanceUpdate{
+		TeamID:   bid.TeamID,
+		Currency: bid.Currency,
+		Amount:   bidCost,
+		Priority: bid.Priority,
+		NowMs:    nowMilli,
+		Version:  version,
+	}
+	var row *TokenDBRow
+	if win != nil {
+		u.Win = true
+		u.CooldownStartMs = tm.cooldownStart(nowMilli)
+		u.WinningBid = win.bid
+		u.Reservation = win.reservation
+		u.Lock = win.lock
+	}
+	if win != nil && win.group != nil {
+		row, err = win.group.update(ctx, u)
+	} else {
+		row, err = tm.store.UpdateBalance(ctx, u)
+	}
+	if err != nil {
+		refund()
+		var condErr *ConditionFailedError
+		if version != nil && errors.As(err, &condErr) && condErr.Row != nil && condErr.Row.Version != *version {
+			return 0, 0, fmt.Errorf("%w: team %s", errStaleVersion, bid.TeamID)
+		}
+		return 0, 0, tm.chargeFailure(bid.TeamID, bid.Currency, bidCost, err, nowMilli)
+	}
+	tm.publish(events.TokensSpent{
+		TeamID:       bid.TeamID,
+		Amount:       bidCost,
+		Priority:     bid.Priority,
+		Currency:     bid.Currency,
+		Balance:      row.balanceIn(bid.Currency),
+		OccurredAtMs: nowMilli,
+	})
+
+	// the spend has committed, so failing to adjust reputation after it
+	// mustn't fail the charge and have the caller retry or refund it
+	if err := tm.applyPriorityUsage(ctx, bid, row); err != nil {
+		tm.logger.Warn(
+			"failed to apply priority usage to reputation",
+			zap.String("team_id", bid.TeamID),
+			zap.Int64("priority", bid.Priority),
+			zap.Error(err),
+		)
+	}
+	if err := tm.takeReputation(ctx, bid, quota.penalty, quota.penaltyKey); err != nil {
+		tm.logger.Warn(
+			"failed to take quota reputation penalty",
+			zap.String("team_id", bid.TeamID),
+			zap.Int64("priority", bid.Priority),
+			zap.Error(err),
+		)
+	}
+
+	if bid.Currency == "" {
+		tm.recordBalance(ctx, bid.TeamID, row.TokenBalance, BalanceChangeSpend)
+	}
+
+	if tm.consistencyTimeout > 0 {
+		tm.waitForConsistency(ctx, bid.TeamID, nowMilli)
+	}
+
+	return row.balanceIn(bid.Currency), bidCost, nil
+}
+
+// applyPriorityUsage adjusts a team's reputation after a spend. row is the
+// team's token row after the spend's priority usage was incremented.
+func (tm *Manager) applyPriorityUsage(ctx context.Context, bid *Bid, row *TokenDBRow) error {
+	// priority quotas replace the penalty for usage since the last refill
+	if tm.priorityQuotas == nil {
+		err := tm.penalizeReputation(ctx, bid, row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tm.rewardReputation(ctx, bid, row)
+}
+
+// ScoreWeights sets how much priority and reputation contribute to a bid's
+// score. The weights should sum to 1 to keep scores within 0-100.
+type ScoreWeights struct {
+	Priority   float64 `json:"priority"`
+	Reputation float64 `json:"reputation"`
+}
+
+// DefaultScoreWeights weighs priority at 70% and reputation at 30%.
+var DefaultScoreWeights = ScoreWeights{Priority: 0.7, Reputation: 0.3}
+
+// teamWeights returns the weights for a team's bids.
+func (tm *Manager) teamWeights(teamID string) ScoreWeights {
+	if weights, ok := tm.teamScoreWeights[teamID]; ok {
+		return weights
+	}
+	return tm.scoreWeights
+}
+
+func calculateScore(
+	priority int64,
+	maxPriority int64,
+	reputation int64,
+	maxReputation int64,
+	weights ScoreWeights,
+) float64 {
+	// Normalize priority (1-maxPriority scale)
+	normalizedPriority := 100.0
+	if maxPriority > 1 {
+		normalizedPriority = clampScore(float64(priority-1) / float64(maxPriority-1) * 100.0)
+	}
+
+	// Normalize reputation (0-maxReputation scale); a reputation above the
+	// ceiling must not push the score past 100
+	normalizedReputation := clampScore(float64(reputation) / float64(maxReputation) * 100.0)
+
+	// Assign weights (70% priority, 30% reputation by default)
+	score := (weights.Priority * normalizedPriority) + (weights.Reputation * normalizedReputation)
+
+	// per-team weights need not sum to 1
+	return clampScore(score)
+}
+
+// ScoreInput is what a Scorer scores a bid from.
+type ScoreInput struct {
+	Bid           Bid
+	MaxPriority   int64
+	Reputation    int64
+	MaxReputation int64
+	// Weights are the bidding team's score weights.
+	Weights ScoreWeights
+}
+
+// Scorer replaces the default weighted priority and reputation score; see
+// WithScorer. Scores outside [0, 100] are clamped.
+type Scorer func(in ScoreInput) float64
+
+// score scores a bid with the Manager's Scorer, or calculateScore.
+func (tm *Manager) score(bid Bid, reputation, maxReputation int64) float64 {
+	weights := tm.teamWeights(bid.TeamID)
+	if tm.scorer == nil {
+		return calculateScore(bid.Priority, tm.maxPriority, reputation, maxReputation, weights)
+	}
+	return clampScore(tm.scorer(ScoreInput{
+		Bid:           bid,
+		MaxPriority:   tm.maxPriority,
+		Reputation:    reputation,
+		MaxReputation: maxReputation,
+		Weights:       weights,
+	}))
+}
+
+// clampScore bounds a score or score component to [0, 100].
+func clampScore(score float64) float64 {
+	return min(max(score, 0), 100)
+}
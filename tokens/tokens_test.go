@@ -0,0 +1,509 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// interferingStore runs interfere once, just before the first balance
+// update reaches the store, as a concurrent writer would.
+type interferingStore struct {
+	Store
+	interfere func()
+	once      bool
+}
+
+func (s *interferingStore) UpdateBalance(ctx context.Context, u BalanceUpdate) (*TokenDBRow, error) {
+	if !s.once {
+		s.once = true
+		s.interfere()
+	}
+	return s.Store.UpdateBalance(ctx, u)
+}
+
+// conflictingStore fails every balance update's condition without saying
+// why, as if a concurrent write always got there first.
+type conflictingStore struct {
+	Store
+}
+
+func (s *conflictingStore) UpdateBalance(ctx context.Context, u BalanceUpdate) (*TokenDBRow, error) {
+	return nil, &ConditionFailedError{}
+}
+
+func TestSpendTokensWithKeyReleasedOnFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		setup   func(ctx context.Context, t *testing.T, tm *Manager)
+		bid     Bid
+		wantErr error
+	}{
+		{
+			name:    "budget exceeded",
+			opts:    []Option{WithBudgetPacing(BudgetPacing{Window: time.Hour, Cap: 1})},
+			bid:     Bid{TeamID: "a", UserID: "u", Priority: 5},
+			wantErr: ErrBudgetExceeded,
+		},
+		{
+			name: "quota exceeded",
+			opts: []Option{WithPriorityQuotas(PriorityQuotas{
+				Quotas: []PriorityQuota{{Priority: 5, DailyCap: 1, Action: QuotaBlock}},
+			})},
+			setup: func(ctx context.Context, t *testing.T, tm *Manager) {
+				if _, err := tm.SpendTokens(ctx, &Bid{TeamID: "a", UserID: "u", Priority: 5}); err != nil {
+					t.Fatalf("SpendTokens: %v", err)
+				}
+			},
+			bid:     Bid{TeamID: "a", UserID: "u", Priority: 5},
+			wantErr: ErrQuotaExceeded,
+		},
+		{
+			name: "team suspended",
+			setup: func(ctx context.Context, t *testing.T, tm *Manager) {
+				if _, err := tm.SuspendTeam(ctx, "a", "test"); err != nil {
+					t.Fatalf("SuspendTeam: %v", err)
+				}
+			},
+			bid:     Bid{TeamID: "a", UserID: "u", Priority: 5},
+			wantErr: ErrTeamSuspended,
+		},
+		{
+			name: "team archived",
+			setup: func(ctx context.Context, t *testing.T, tm *Manager) {
+				if _, err := tm.ArchiveTeam(ctx, "a", "test"); err != nil {
+					t.Fatalf("ArchiveTeam: %v", err)
+				}
+			},
+			bid:     Bid{TeamID: "a", UserID: "u", Priority: 5},
+			wantErr: ErrTeamArchived,
+		},
+		{
+			name:    "invalid currency",
+			bid:     Bid{TeamID: "a", UserID: "u", Priority: 5, Currency: "gems"},
+			wantErr: ErrInvalidCurrency,
+		},
+		{
+			name:    "conflicts exhaust retries",
+			opts:    []Option{WithStore(&conflictingStore{Store: NewMemoryStore()})},
+			bid:     Bid{TeamID: "a", UserID: "u", Priority: 5},
+			wantErr: ErrAuctionConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tm := newTestManager(t, []string{"a"}, tt.opts...)
+			if tt.setup != nil {
+				tt.setup(ctx, t, tm)
+			}
+
+			// a retry runs the spend again rather than finding the key
+			// still claimed
+			for range 2 {
+				bid := tt.bid
+				if _, err := tm.SpendTokensWithKey(ctx, &bid, "k"); !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SpendTokensWithKey = %v, want %v", err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestSpendTokensVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		interfere   bool
+		wantVersion int64
+	}{
+		{name: "unchanged row", wantVersion: 2},
+		{name: "row changed after read", interfere: true, wantVersion: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := NewMemoryStore()
+			store := &interferingStore{Store: mem, once: !tt.interfere}
+			tm := newTestManager(t, []string{"a"}, WithStore(store))
+
+			store.interfere = func() {
+				if err := mem.SetTokenBalance(ctx, "a", 50, InitialTokenCount, 0); err != nil {
+					t.Fatalf("SetTokenBalance: %v", err)
+				}
+			}
+
+			bid := &Bid{TeamID: "a", UserID: "u", Priority: 2}
+			before := tokenRow(t, tm, "a")
+			cost, err := tm.computeBidcost(bid, before.ReputationScore)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			balance, err := tm.SpendTokens(ctx, bid)
+			if err != nil {
+				t.Fatalf("SpendTokens: %v", err)
+			}
+
+			start := InitialTokenCount
+			if tt.interfere {
+				start = 50
+			}
+			if balance != start-cost {
+				t.Errorf("balance = %d, want %d", balance, start-cost)
+			}
+			if row := tokenRow(t, tm, "a"); row.Version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", row.Version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestChargeTokensStaleVersion(t *testing.T) {
+	ctx := context.Background()
+	tm := newTestManager(t, []string{"a"})
+
+	stale := tokenRow(t, tm, "a").Version - 1
+	bid := &Bid{TeamID: "a", UserID: "u", Priority: 1}
+	_, _, err := tm.chargeTokens(ctx, bid, 1, nil, &stale)
+	if !errors.Is(err, errStaleVersion) {
+		t.Fatalf("chargeTokens = %v, want errStaleVersion", err)
+	}
+	if row := tokenRow(t, tm, "a"); row.TokenBalance != InitialTokenCount {
+		t.Errorf("balance = %d, want it untouched at %d", row.TokenBalance, InitialTokenCount)
+	}
+}
+
+func TestEnsureTeam(t *testing.T) {
+	tests := []struct {
+		name string
+		// existing is the team's row before EnsureTeam, nil for none
+		existing    *TokenDBRow
+		wantBalance int64
+	}{
+		{name: "new team", wantBalance: InitialTokenCount},
+		{
+			name:        "row without priority usage",
+			existing:    &TokenDBRow{TeamID: "a", TokenBalance: 42, ReputationScore: 90, Version: 1},
+			wantBalance: 42,
+		},
+		{
+			name: "complete row",
+			existing: &TokenDBRow{
+				TeamID: "a", TokenBalance: 7, ReputationScore: 90, Version: 1,
+				PriorityUsage: map[int]int{1: 3}, LastRefillTime: 1, CreatedAtMs: 1,
+			},
+			wantBalance: 7,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			if tt.existing != nil {
+				store.tokens["a"] = cloneTokenRow(tt.existing)
+			}
+			tm := newTestManager(t, nil, WithStore(store))
+
+			if err := tm.EnsureTeam(context.Background(), "a"); err != nil {
+				t.Fatalf("EnsureTeam: %v", err)
+			}
+
+			row := tokenRow(t, tm, "a")
+			if row.TokenBalance != tt.wantBalance {
+				t.Errorf("balance = %d, want %d", row.TokenBalance, tt.wantBalance)
+			}
+			if len(row.PriorityUsage) == 0 {
+				t.Error("priority usage not backfilled")
+			}
+			if tt.existing != nil && tt.existing.PriorityUsage != nil && row.PriorityUsage[1] != 3 {
+				t.Errorf("priority usage = %v, want it kept", row.PriorityUsage)
+			}
+			if row.LastRefillTime == 0 || row.CreatedAtMs == 0 {
+				t.Errorf("refill time %d and created at %d, want both set", row.LastRefillTime, row.CreatedAtMs)
+			}
+			if tt.existing != nil && row.ReputationScore != tt.existing.ReputationScore {
+				t.Errorf("reputation = %d, want it kept at %d", row.ReputationScore, tt.existing.ReputationScore)
+			}
+		})
+	}
+}
+
+func TestMaxReputationInitialAndRefill(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxReputation int64
+	}{
+		{name: "default", maxReputation: MaxReputationScore},
+		{name: "raised", maxReputation: 250},
+		{name: "lowered", maxReputation: 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := NewMemoryStore()
+			tm := newTestManager(t, []string{"a"}, WithStore(mem), WithMaxReputation(tt.maxReputation))
+
+			if got := tokenRow(t, tm, "a").ReputationScore; got != tt.maxReputation {
+				t.Errorf("initial reputation = %d, want %d", got, tt.maxReputation)
+			}
+			team, err := tm.CreateTeam(ctx, "b", "B")
+			if err != nil {
+				t.Fatalf("CreateTeam: %v", err)
+			}
+			if got := tokenRow(t, tm, team.TeamID).ReputationScore; got != tt.maxReputation {
+				t.Errorf("created team reputation = %d, want %d", got, tt.maxReputation)
+			}
+
+			mem.tokens["a"].ReputationScore = 1
+			if err := tm.RefillTokens(ctx, []string{"a"}); err != nil {
+				t.Fatalf("RefillTokens: %v", err)
+			}
+			if got := tokenRow(t, tm, "a").ReputationScore; got != tt.maxReputation {
+				t.Errorf("refilled reputation = %d, want %d", got, tt.maxReputation)
+			}
+		})
+	}
+}
+
+func TestChargeFallback(t *testing.T) {
+	tests := []struct {
+		name       string
+		fallback   bool
+		wantWinner string
+		wantErr    error
+	}{
+		{name: "next bid wins", fallback: true, wantWinner: "b"},
+		{name: "disabled", fallback: false, wantErr: ErrInsufficientBalance},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := NewMemoryStore()
+			// another auction spends a's tokens after this one scored a's bid
+			store := &interferingStore{Store: mem, interfere: func() {
+				mem.tokens["a"].TokenBalance = 1
+				mem.tokens["a"].Version++
+			}}
+			tm := newTestManager(t, []string{"a", "b"}, WithStore(store), WithChargeFallback(tt.fallback))
+
+			result, err := tm.RunAuction(context.Background(), []Bid{
+				{TeamID: "a", UserID: "u", Priority: 5},
+				{TeamID: "b", UserID: "u", Priority: 1},
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RunAuction = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && result.TeamID != tt.wantWinner {
+				t.Errorf("winner = %s, want %s", result.TeamID, tt.wantWinner)
+			}
+			if balance := tokenRow(t, tm, "a").TokenBalance; balance != 1 {
+				t.Errorf("balance of a = %d, want it left at 1", balance)
+			}
+		})
+	}
+}
+
+func TestWinnerVeto(t *testing.T) {
+	errVeto := errors.New("veto unavailable")
+	tests := []struct {
+		name       string
+		veto       WinnerVeto
+		wantWinner string
+		wantErr    error
+		// wantAsked is the teams the veto was asked about, in order
+		wantAsked []string
+	}{
+		{
+			name:       "none vetoed",
+			veto:       func(context.Context, string) (bool, error) { return false, nil },
+			wantWinner: "a", wantAsked: []string{"a"},
+		},
+		{
+			name:       "winner vetoed",
+			veto:       func(_ context.Context, teamID string) (bool, error) { return teamID == "a", nil },
+			wantWinner: "b", wantAsked: []string{"a", "b"},
+		},
+		{
+			name:    "all vetoed",
+			veto:    func(context.Context, string) (bool, error) { return true, nil },
+			wantErr: ErrNoWinner, wantAsked: []string{"a", "b"},
+		},
+		{
+			name:    "veto fails",
+			veto:    func(context.Context, string) (bool, error) { return false, errVeto },
+			wantErr: errVeto, wantAsked: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var asked []string
+			veto := func(ctx context.Context, teamID string) (bool, error) {
+				asked = append(asked, teamID)
+				return tt.veto(ctx, teamID)
+			}
+			tm := newTestManager(t, []string{"a", "b"}, WithWinnerVeto(veto))
+
+			result, err := tm.RunAuction(context.Background(), []Bid{
+				{TeamID: "a", UserID: "u", Priority: 5},
+				{TeamID: "b", UserID: "u", Priority: 1},
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RunAuction = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && result.TeamID != tt.wantWinner {
+				t.Errorf("winner = %s, want %s", result.TeamID, tt.wantWinner)
+			}
+			if !slices.Equal(asked, tt.wantAsked) {
+				t.Errorf("veto asked about %v, want %v", asked, tt.wantAsked)
+			}
+			// vetoed teams are never charged
+			for _, team := range []string{"a", "b"} {
+				if team == tt.wantWinner {
+					continue
+				}
+				if balance := tokenRow(t, tm, team).TokenBalance; balance != InitialTokenCount {
+					t.Errorf("balance of %s = %d, want %d", team, balance, InitialTokenCount)
+				}
+			}
+		})
+	}
+}
+
+func TestInitialPriorityUsage(t *testing.T) {
+	tiers := []CostTier{{MinPriority: 1, CostPerUnit: 1}}
+	tests := []struct {
+		name        string
+		opts        []Option
+		maxPriority int
+	}{
+		{name: "default", maxPriority: int(MaxPriority)},
+		{name: "lowered", opts: []Option{WithMaxPriority(5)}, maxPriority: 5},
+		{name: "raised with cost tiers", opts: []Option{WithMaxPriority(20), WithCostTiers(tiers)}, maxPriority: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := newTestManager(t, []string{"a"}, tt.opts...)
+
+			usage := tokenRow(t, tm, "a").PriorityUsage
+			if len(usage) != tt.maxPriority {
+				t.Errorf("new team has usage for %d priorities, want %d", len(usage), tt.maxPriority)
+			}
+			for p := 1; p <= tt.maxPriority; p++ {
+				if count, ok := usage[p]; !ok || count != 0 {
+					t.Errorf("usage of priority %d = %d, %t, want a zero count", p, count, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestCloseCancelsInFlight(t *testing.T) {
+	started := make(chan struct{})
+	// the veto blocks the auction until its context is cancelled
+	veto := func(ctx context.Context, teamID string) (bool, error) {
+		close(started)
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	tm := newTestManager(t, []string{"a"}, WithWinnerVeto(veto))
+
+	done := make(chan error, 1)
+	go func() {
+		// the caller's own context is never cancelled
+		_, err := tm.RunAuction(context.Background(), []Bid{{TeamID: "a", UserID: "u", Priority: 1}})
+		done <- err
+	}()
+	<-started
+	tm.Close()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("RunAuction = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("auction still running after Close")
+	}
+	if balance := tokenRow(t, tm, "a").TokenBalance; balance != InitialTokenCount {
+		t.Errorf("balance = %d, want the cancelled auction to charge nothing", balance)
+	}
+}
+
+func TestMaxBidsPerAuction(t *testing.T) {
+	tests := []struct {
+		name       string
+		max        int
+		bids       int
+		wantNewErr bool
+		wantErr    error
+	}{
+		{name: "under the limit", max: 2, bids: 2},
+		{name: "over the limit", max: 2, bids: 3, wantErr: ErrTooManyBids},
+		{name: "zero", max: 0, wantNewErr: true},
+		{name: "negative", max: -1, wantNewErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm, err := NewManager(WithStore(NewMemoryStore()), WithMaxBidsPerAuction(tt.max))
+			if tt.wantNewErr {
+				if err == nil {
+					tm.Close()
+					t.Fatal("NewManager succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewManager: %v", err)
+			}
+			defer tm.Close()
+
+			ctx := context.Background()
+			teams := []string{"a", "b", "c"}
+			if err := tm.InitializeTokens(ctx, teams); err != nil {
+				t.Fatalf("InitializeTokens: %v", err)
+			}
+			var bids []Bid
+			for _, team := range teams[:tt.bids] {
+				bids = append(bids, Bid{TeamID: team, UserID: "u", Priority: 1})
+			}
+
+			_, err = tm.RunAuction(ctx, bids)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RunAuction = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// schemaCountingStore counts the calls to EnsureSchema.
+type schemaCountingStore struct {
+	Store
+	ensured int
+}
+
+func (s *schemaCountingStore) EnsureSchema(ctx context.Context) error {
+	s.ensured++
+	return s.Store.EnsureSchema(ctx)
+}
+
+func TestSkipTableCreation(t *testing.T) {
+	tests := []struct {
+		name        string
+		skip        bool
+		wantEnsured int
+	}{
+		{name: "tables created", wantEnsured: 1},
+		{name: "creation skipped", skip: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &schemaCountingStore{Store: NewMemoryStore()}
+			newTestManager(t, nil, WithStore(store), WithSkipTableCreation(tt.skip))
+
+			if store.ensured != tt.wantEnsured {
+				t.Errorf("EnsureSchema called %d times, want %d", store.ensured, tt.wantEnsured)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package tokens
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name of the Manager's default tracer,
+// taken from the global TracerProvider; see WithTracer.
+const TracerName = "github.com/christopherwong-hinge/auction/tokens"
+
+// Names of the spans the Manager starts with its tracer.
+const (
+	SpanRunAuction      = "auction.RunAuction"
+	SpanGetTokenBalance = "auction.GetTokenBalance"
+	SpanRecordBid       = "auction.RecordBid"
+	SpanSpendTokens     = "auction.SpendTokens"
+	SpanPlaceHold       = "auction.PlaceHold"
+)
+
+// Span attribute keys.
+const (
+	AttrTeamID    = attribute.Key("auction.team_id")
+	AttrUserID    = attribute.Key("auction.user_id")
+	AttrBidCount  = attribute.Key("auction.bid_count")
+	AttrTeamCount = attribute.Key("auction.team_count")
+)
+
+// defaultTracer is the tracer of a Manager without WithTracer. It is looked
+// up on every call so a global TracerProvider set after NewManager is used.
+func defaultTracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+// startSpan starts a span named name as a child of any span in ctx. It
+// returns the context carrying the new span, which the Manager passes on to
+// the store, and a function that ends the span, recording err if non-nil.
+func (tm *Manager) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	tracer := tm.tracer
+	if tracer == nil {
+		tracer = defaultTracer()
+	}
+
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// auctionAttrs returns the span attributes of an auction over bids, which
+// are normally all for the same user.
+func auctionAttrs(bids []Bid) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{AttrBidCount.Int(len(bids))}
+	if len(bids) > 0 {
+		attrs = append(attrs, AttrUserID.String(bids[0].UserID))
+	}
+	return attrs
+}
+
+// bidAttrs returns the span attributes identifying bid.
+func bidAttrs(bid *Bid) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		AttrTeamID.String(bid.TeamID),
+		AttrUserID.String(bid.UserID),
+	}
+}
@@ -0,0 +1,77 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	tests := []struct {
+		name string
+		bids []Bid
+		// wantErr is the error recorded on the auction's span
+		wantErr error
+		// wantSpans are the names of the ended spans, in the order they
+		// ended
+		wantSpans []string
+	}{
+		{
+			name:      "won auction",
+			bids:      []Bid{{TeamID: "a", UserID: "u", Priority: 5}},
+			wantSpans: []string{SpanGetTokenBalance, SpanRecordBid, SpanSpendTokens, SpanRunAuction},
+		},
+		{
+			name:      "failed auction",
+			bids:      []Bid{{TeamID: "missing", UserID: "u", Priority: 5}},
+			wantErr:   ErrTeamNotFound,
+			wantSpans: []string{SpanGetTokenBalance, SpanRunAuction},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			tm := newTestManager(t, []string{"a"}, WithTracer(provider.Tracer(TracerName)))
+
+			_, err := tm.RunAuction(context.Background(), tt.bids)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RunAuction = %v, want %v", err, tt.wantErr)
+			}
+
+			spans := recorder.Ended()
+			var names []string
+			for _, span := range spans {
+				names = append(names, span.Name())
+			}
+			if !slices.Equal(names, tt.wantSpans) {
+				t.Fatalf("spans %v, want %v", names, tt.wantSpans)
+			}
+
+			auction := spans[len(spans)-1]
+			if !slices.Contains(auction.Attributes(), AttrUserID.String("u")) ||
+				!slices.Contains(auction.Attributes(), attribute.Int(string(AttrBidCount), 1)) {
+				t.Errorf("auction span attributes %v, want its user and bid count", auction.Attributes())
+			}
+			wantStatus := codes.Unset
+			if tt.wantErr != nil {
+				wantStatus = codes.Error
+			}
+			if got := auction.Status().Code; got != wantStatus {
+				t.Errorf("auction span status %v, want %v", got, wantStatus)
+			}
+			// every span is part of the auction's trace
+			for _, span := range spans[:len(spans)-1] {
+				if span.Parent().SpanID() != auction.SpanContext().SpanID() {
+					t.Errorf("span %s isn't a child of the auction's", span.Name())
+				}
+			}
+		})
+	}
+}
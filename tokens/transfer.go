@@ -0,0 +1,110 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// BalanceChangeTransfer is the reason recorded for balance snapshots taken
+// after a transfer, on both teams.
+const BalanceChangeTransfer = "transfer"
+
+// TransferRow is the ledger entry of a token transfer between two teams. It
+// lives in the tokens table and is written in the same transaction as the
+// balance changes it records.
+type TransferRow struct {
+	Pk          string `dynamodbav:"pk" json:"-"`
+	TransferID  string `dynamodbav:"transfer_id" json:"transfer_id"`
+	FromTeamID  string `dynamodbav:"from_team_id" json:"from_team_id"`
+	ToTeamID    string `dynamodbav:"to_team_id" json:"to_team_id"`
+	Amount      int64  `dynamodbav:"amount" json:"amount"`
+	CreatedAtMs int64  `dynamodbav:"created_at_ms" json:"created_at_ms"`
+}
+
+// TransferResult is a completed transfer and both teams' balances after it.
+type TransferResult struct {
+	Transfer    TransferRow `json:"transfer"`
+	FromBalance int64       `json:"from_balance"`
+	ToBalance   int64       `json:"to_balance"`
+}
+
+// TransferTokens moves amount tokens from one team's balance to another's,
+// e.g. to shift budget between sister teams without a refill. Both balances
+// change and the transfer is recorded in one transaction, so a failed
+// transfer changes nothing. It fails with ErrTeamNotFound if either team has
+// no token row, with ErrTeamArchived if either was archived, and with
+// ErrInsufficientBalance if the sender can't cover amount. A transfer that
+// lost a race with another write fails with ErrAuctionConflict and can be
+// retried.
+func (tm *Manager) TransferTokens(ctx context.Context, fromTeam, toTeam string, amount int64) (*TransferResult, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	fromTeam, toTeam = tm.normalizeID(fromTeam), tm.normalizeID(toTeam)
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive, got %d", ErrInvalidTransfer, amount)
+	}
+	if fromTeam == toTeam {
+		return nil, fmt.Errorf("%w: team %s can't transfer to itself", ErrInvalidTransfer, fromTeam)
+	}
+
+	// reading the rows applies any drip due, so the sender's balance is
+	// current before it is checked
+	rows, missing, err := tm.batchGetTokenRows(ctx, []string{fromTeam, toTeam})
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrTeamNotFound, missing[0])
+	}
+	for _, teamID := range []string{fromTeam, toTeam} {
+		if row := rows[teamID]; row.status() == TeamArchived {
+			return nil, fmt.Errorf("%w: %s", ErrTeamArchived, teamID)
+		}
+	}
+	if balance := rows[fromTeam].TokenBalance; balance < amount {
+		return nil, fmt.Errorf("%w: team %s has %d, transfer needs %d", ErrInsufficientBalance, fromTeam, balance, amount)
+	}
+
+	now := tm.clock.Now()
+	transferID, err := tm.newID("transfer_", now)
+	if err != nil {
+		return nil, err
+	}
+	transfer := &TransferRow{
+		Pk:          GetTransferPK(transferID),
+		TransferID:  transferID,
+		FromTeamID:  fromTeam,
+		ToTeamID:    toTeam,
+		Amount:      amount,
+		CreatedAtMs: now.UnixMilli(),
+	}
+
+	from, to, err := tm.store.TransferTokens(ctx, transfer)
+	if err != nil {
+		var condErr *ConditionFailedError
+		if !errors.As(err, &condErr) {
+			return nil, err
+		}
+		switch {
+		case condErr.Row == nil:
+			// a team's row was deleted since it was read
+			return nil, fmt.Errorf("%w: transfer from %s to %s", ErrTeamNotFound, fromTeam, toTeam)
+		case condErr.Row.TokenBalance < amount:
+			return nil, fmt.Errorf("%w: team %s has %d, transfer needs %d",
+				ErrInsufficientBalance, fromTeam, condErr.Row.TokenBalance, amount)
+		}
+		// the sender could cover it, so some other write got in the way
+		return nil, fmt.Errorf("%w: transfer from %s to %s", ErrAuctionConflict, fromTeam, toTeam)
+	}
+
+	tm.recordBalance(ctx, fromTeam, from.TokenBalance, BalanceChangeTransfer)
+	tm.recordBalance(ctx, toTeam, to.TokenBalance, BalanceChangeTransfer)
+
+	return &TransferResult{
+		Transfer:    *transfer,
+		FromBalance: from.TokenBalance,
+		ToBalance:   to.TokenBalance,
+	}, nil
+}
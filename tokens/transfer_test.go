@@ -0,0 +1,41 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// transferFailingStore fails every transfer's condition, reporting the
+// sender's row with the given balance.
+type transferFailingStore struct {
+	Store
+	balance int64
+}
+
+func (s *transferFailingStore) TransferTokens(ctx context.Context, t *TransferRow) (*TokenDBRow, *TokenDBRow, error) {
+	return nil, nil, &ConditionFailedError{Row: &TokenDBRow{TeamID: t.FromTeamID, TokenBalance: s.balance}}
+}
+
+func TestTransferTokensConditionFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		// balance is the sender's balance when the condition failed
+		balance int64
+		wantErr error
+	}{
+		{name: "balance spent since it was read", balance: 5, wantErr: ErrInsufficientBalance},
+		{name: "balance still covers the transfer", balance: InitialTokenCount, wantErr: ErrAuctionConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &transferFailingStore{Store: NewMemoryStore(), balance: tt.balance}
+			tm := newTestManager(t, []string{"a", "b"}, WithStore(store))
+
+			_, err := tm.TransferTokens(context.Background(), "a", "b", 10)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("TransferTokens = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
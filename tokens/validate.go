@@ -0,0 +1,159 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// DuplicateBids says what an auction does with more than one bid from the
+// same team.
+type DuplicateBids int
+
+const (
+	// DuplicateBidsCollapse keeps each team's highest-priority bid, the
+	// earliest of equal ones, and drops the rest.
+	DuplicateBidsCollapse DuplicateBids = iota
+	// DuplicateBidsReject fails the auction with ErrInvalidBid, and
+	// SubmitSealedBid a team's second bid in a window.
+	DuplicateBidsReject
+)
+
+func (d DuplicateBids) String() string {
+	switch d {
+	case DuplicateBidsCollapse:
+		return "collapse"
+	case DuplicateBidsReject:
+		return "reject"
+	default:
+		return fmt.Sprintf("DuplicateBids(%d)", int(d))
+	}
+}
+
+// BidValidation configures the checks an auction's bids pass before they
+// are scored; see WithBidValidation. Every bid needs a team and user ID, a
+// priority the Manager can price and a currency it has. A team with no
+// token row fails the auction with ErrTeamNotFound, and a suspended or
+// archived team's bids are skipped as SkipReasonTeamInactive, since both
+// are only known once balances are read.
+type BidValidation struct {
+	// Duplicates is what happens to several bids from one team in one
+	// auction.
+	Duplicates DuplicateBids
+	// DropInvalid leaves invalid bids, and bids from teams with no token
+	// row, out of the auction instead of failing it. Dropped bids are
+	// logged, and any recorded ahead of the auction are marked aborted.
+	DropInvalid bool
+}
+
+// validateBid fails with ErrInvalidBid for a normalized bid no auction can
+// score.
+func (tm *Manager) validateBid(bid *Bid) error {
+	if bid.TeamID == "" {
+		return fmt.Errorf("%w: team ID is required", ErrInvalidBid)
+	}
+	if bid.UserID == "" {
+		return fmt.Errorf("%w: user ID is required", ErrInvalidBid)
+	}
+	if !tm.HasPriority(bid.Priority) {
+		return fmt.Errorf("%w: %w: %d", ErrInvalidBid, ErrUnknownPriority, bid.Priority)
+	}
+	if _, err := tm.currency(bid); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidBid, err)
+	}
+	return nil
+}
+
+// validateBids applies the Manager's BidValidation to normalized bids
+// before they are scored, returning the bids to score. rows, if non-nil,
+// holds the row each bid was recorded under and is filtered alongside
+// bids; dropped holds the rows of the bids left out.
+func (tm *Manager) validateBids(bids []Bid, rows []*BidRow) (kept []Bid, keptRows, dropped []*BidRow, err error) {
+	best := make(map[string]int, len(bids))
+	keep := make([]bool, len(bids))
+	for i := range bids {
+		bid := &bids[i]
+		if err := tm.validateBid(bid); err != nil {
+			if !tm.bidValidation.DropInvalid {
+				return nil, nil, nil, fmt.Errorf("bid %d: %w", i, err)
+			}
+			tm.logger.Warn("dropping invalid bid", zap.String("team_id", bid.TeamID), zap.Error(err))
+			continue
+		}
+
+		j, seen := best[bid.TeamID]
+		if !seen {
+			best[bid.TeamID] = i
+			keep[i] = true
+			continue
+		}
+		// bids recorded ahead of the auction were accepted already, so
+		// they collapse rather than leave it unsettleable
+		if tm.bidValidation.Duplicates == DuplicateBidsReject && rows == nil {
+			return nil, nil, nil, fmt.Errorf("%w: team %s bid more than once", ErrInvalidBid, bid.TeamID)
+		}
+		if bid.Priority > bids[j].Priority {
+			keep[j] = false
+			best[bid.TeamID] = i
+			keep[i] = true
+		}
+	}
+
+	kept, keptRows, dropped = filterBids(bids, rows, func(i int) bool { return keep[i] })
+	return kept, keptRows, dropped, nil
+}
+
+// dropTeamless leaves out the bids of teams with no token row, which
+// fetchTokenRows only allows when invalid bids are dropped; see
+// validateBids.
+func (tm *Manager) dropTeamless(
+	bids []Bid,
+	rows []*BidRow,
+	tokenRows map[string]*TokenDBRow,
+) (kept []Bid, keptRows, dropped []*BidRow) {
+	return filterBids(bids, rows, func(i int) bool {
+		if tokenRows[bids[i].TeamID] != nil {
+			return true
+		}
+		tm.logger.Warn("dropping bid from unknown team", zap.String("team_id", bids[i].TeamID))
+		return false
+	})
+}
+
+// filterBids keeps the bids, and the rows recorded for them if any, for
+// which keep is true.
+func filterBids(
+	bids []Bid,
+	rows []*BidRow,
+	keep func(i int) bool,
+) (kept []Bid, keptRows, dropped []*BidRow) {
+	kept = make([]Bid, 0, len(bids))
+	if rows != nil {
+		keptRows = make([]*BidRow, 0, len(rows))
+	}
+	for i, bid := range bids {
+		if keep(i) {
+			kept = append(kept, bid)
+			if rows != nil {
+				keptRows = append(keptRows, rows[i])
+			}
+		} else if rows != nil {
+			dropped = append(dropped, rows[i])
+		}
+	}
+	return kept, keptRows, dropped
+}
+
+// abortDropped marks the recorded rows of bids left out of an auction
+// aborted, as they will never be settled.
+func (tm *Manager) abortDropped(ctx context.Context, dropped []*BidRow) {
+	if len(dropped) == 0 {
+		return
+	}
+	candidates := make([]*candidate, len(dropped))
+	for i, row := range dropped {
+		candidates[i] = &candidate{row: row}
+	}
+	tm.abortBids(ctx, candidates)
+}
@@ -0,0 +1,468 @@
+package tokens
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Types of webhook notification.
+const (
+	WebhookAuctionWon  = "auction.won"
+	WebhookAuctionLost = "auction.lost"
+)
+
+// Headers set on every webhook request. The signature is
+// "sha256=" followed by SignWebhook's result.
+const (
+	WebhookIDHeader        = "X-Auction-Webhook-Id"
+	WebhookTimestampHeader = "X-Auction-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Auction-Webhook-Signature"
+)
+
+const (
+	defaultWebhookMaxAttempts    = 5
+	defaultWebhookInitialBackoff = time.Second
+	defaultWebhookMaxBackoff     = time.Minute
+	defaultWebhookTimeout        = 10 * time.Second
+	defaultWebhookWorkers        = 4
+	defaultWebhookQueueSize      = 1000
+
+	// webhookDeadLetterTimeout bounds writing a dead letter, which may
+	// happen while the Manager is closing.
+	webhookDeadLetterTimeout = 5 * time.Second
+)
+
+// Webhook is the HTTPS URL a team is notified at when it wins or loses an
+// auction. Webhooks live in the tokens table, one per team.
+type Webhook struct {
+	Pk     string `dynamodbav:"pk" json:"pk"`
+	TeamID string `dynamodbav:"team_id" json:"team_id"`
+	URL    string `dynamodbav:"url" json:"url"`
+	// Secret signs the team's notifications. It is only returned by
+	// SetWebhook.
+	Secret      string `dynamodbav:"secret" json:"secret,omitempty"`
+	CreatedAtMs int64  `dynamodbav:"created_at_ms" json:"created_at_ms"`
+	UpdatedAtMs int64  `dynamodbav:"updated_at_ms" json:"updated_at_ms"`
+}
+
+// WebhookNotification is the JSON body posted to a team's webhook after an
+// auction it bid in.
+type WebhookNotification struct {
+	// NotificationID is the same on every attempt to deliver a
+	// notification, so receivers can deduplicate on it.
+	NotificationID string `dynamodbav:"notification_id" json:"notification_id"`
+	// Type is WebhookAuctionWon or WebhookAuctionLost.
+	Type      string `dynamodbav:"type" json:"type"`
+	AuctionID string `dynamodbav:"auction_id" json:"auction_id"`
+	UserID    string `dynamodbav:"user_id" json:"user_id"`
+	TeamID    string `dynamodbav:"team_id" json:"team_id"`
+	BidID     string `dynamodbav:"bid_id,omitempty" json:"bid_id,omitempty"`
+	Priority  int64  `dynamodbav:"priority" json:"priority"`
+	// Cost is what the team paid if it won, or what its bid would have
+	// cost.
+	Cost int64 `dynamodbav:"cost" json:"cost"`
+	// SkipReason is why a losing bid was passed over, if it was.
+	SkipReason   string `dynamodbav:"skip_reason,omitempty" json:"skip_reason,omitempty"`
+	OccurredAtMs int64  `dynamodbav:"occurred_at_ms" json:"occurred_at_ms"`
+}
+
+// WebhookDeadLetter records a notification that was never delivered, after
+// its last attempt failed or because the Manager closed first. Dead letters
+// live in the tokens table.
+type WebhookDeadLetter struct {
+	Pk           string              `dynamodbav:"pk" json:"pk"`
+	TeamID       string              `dynamodbav:"team_id" json:"team_id"`
+	URL          string              `dynamodbav:"url" json:"url"`
+	Notification WebhookNotification `dynamodbav:"notification" json:"notification"`
+	Attempts     int                 `dynamodbav:"attempts" json:"attempts"`
+	// LastStatus is the status of the last response, or zero if there was
+	// none.
+	LastStatus  int    `dynamodbav:"last_status,omitempty" json:"last_status,omitempty"`
+	LastError   string `dynamodbav:"last_error" json:"last_error"`
+	CreatedAtMs int64  `dynamodbav:"created_at_ms" json:"created_at_ms"`
+}
+
+// WebhookConfig enables webhook delivery; see WithWebhooks. Zero fields take
+// their defaults.
+type WebhookConfig struct {
+	// MaxAttempts is how many times a notification is posted before it is
+	// dead-lettered. It defaults to 5.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubling with each
+	// one up to MaxBackoff. They default to a second and a minute.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Timeout bounds each attempt. It defaults to 10 seconds.
+	Timeout time.Duration
+	// Workers is how many notifications are delivered at once, and
+	// QueueSize how many can wait; past it they are dead-lettered. They
+	// default to 4 and 1000.
+	Workers   int
+	QueueSize int
+	// Client posts the notifications. It defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+func (c WebhookConfig) withDefaults() WebhookConfig {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = defaultWebhookMaxAttempts
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = defaultWebhookInitialBackoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = defaultWebhookMaxBackoff
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultWebhookTimeout
+	}
+	if c.Workers <= 0 {
+		c.Workers = defaultWebhookWorkers
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaultWebhookQueueSize
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	return c
+}
+
+// SignWebhook returns the hex HMAC-SHA256, keyed with a webhook's secret, of
+// a notification's timestamp header, a dot and its body. Receivers verify
+// a notification by comparing it to the signature header.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SetWebhook registers the HTTPS URL a team is notified at, replacing any it
+// had, with a new signing secret. The returned Webhook is the only place the
+// secret is given out.
+func (tm *Manager) SetWebhook(ctx context.Context, teamID, rawURL string) (*Webhook, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("%w: %q is not an https URL", ErrInvalidWebhook, rawURL)
+	}
+
+	teamID = tm.normalizeID(teamID)
+	if _, err := tm.getTokenRow(ctx, teamID); err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("error generating webhook secret: %v", err)
+	}
+
+	nowMs := tm.clock.Now().UnixMilli()
+	w := &Webhook{
+		Pk:          GetWebhookPK(teamID),
+		TeamID:      teamID,
+		URL:         u.String(),
+		Secret:      hex.EncodeToString(secret),
+		CreatedAtMs: nowMs,
+		UpdatedAtMs: nowMs,
+	}
+	if prior, err := tm.store.GetWebhook(ctx, teamID); err == nil {
+		w.CreatedAtMs = prior.CreatedAtMs
+	}
+
+	err = tm.store.PutWebhook(ctx, w)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// GetWebhook reads a team's webhook, without its secret.
+func (tm *Manager) GetWebhook(ctx context.Context, teamID string) (*Webhook, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	w, err := tm.store.GetWebhook(ctx, tm.normalizeID(teamID))
+	if err != nil {
+		return nil, err
+	}
+	w.Secret = ""
+	return w, nil
+}
+
+// DeleteWebhook stops notifying a team.
+func (tm *Manager) DeleteWebhook(ctx context.Context, teamID string) error {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.store.DeleteWebhook(ctx, tm.normalizeID(teamID))
+}
+
+// GetWebhookDeadLetters returns the notifications a team's webhook never
+// received, oldest first.
+func (tm *Manager) GetWebhookDeadLetters(ctx context.Context, teamID string) ([]WebhookDeadLetter, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.store.QueryWebhookDeadLetters(ctx, tm.normalizeID(teamID))
+}
+
+// notifyWebhooks queues a notification for every team that bid in an
+// auction: a win for each result's team and a loss for the rest.
+func (tm *Manager) notifyWebhooks(auctionID string, scored []*candidate, results []*AuctionResult) {
+	if tm.webhooks == nil || len(scored) == 0 {
+		return
+	}
+
+	won := make(map[string]*AuctionResult, len(results))
+	for _, result := range results {
+		won[result.TeamID] = result
+	}
+
+	now := tm.clock.Now()
+	notified := make(map[string]bool, len(scored))
+	for _, c := range scored {
+		// a team hears once per auction, about its best bid
+		if notified[c.bid.TeamID] {
+			continue
+		}
+		if _, ok := won[c.bid.TeamID]; ok && !c.won {
+			continue
+		}
+		notified[c.bid.TeamID] = true
+
+		id, err := tm.newID("notification_", now)
+		if err != nil {
+			tm.logger.Warn("failed to create webhook notification", zap.Error(err))
+			continue
+		}
+
+		n := WebhookNotification{
+			NotificationID: id,
+			Type:           WebhookAuctionLost,
+			AuctionID:      auctionID,
+			UserID:         c.bid.UserID,
+			TeamID:         c.bid.TeamID,
+			Priority:       c.bid.Priority,
+			Cost:           c.cost,
+			SkipReason:     c.skipReason,
+			OccurredAtMs:   now.UnixMilli(),
+		}
+		if c.row != nil {
+			n.BidID = c.row.BidID
+		}
+		if result, ok := won[c.bid.TeamID]; ok {
+			n.Type = WebhookAuctionWon
+			n.Cost = result.Cost
+		}
+		tm.webhooks.enqueue(n)
+	}
+}
+
+// webhookNotifier delivers notifications in the background, retrying each
+// with exponential backoff and dead-lettering those it gives up on.
+type webhookNotifier struct {
+	tm  *Manager
+	cfg WebhookConfig
+
+	mu     sync.Mutex
+	closed bool
+	queue  chan WebhookNotification
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newWebhookNotifier(tm *Manager, cfg WebhookConfig) *webhookNotifier {
+	cfg = cfg.withDefaults()
+	n := &webhookNotifier{
+		tm:    tm,
+		cfg:   cfg,
+		queue: make(chan WebhookNotification, cfg.QueueSize),
+		stop:  make(chan struct{}),
+	}
+
+	n.wg.Add(cfg.Workers)
+	for range cfg.Workers {
+		go n.run()
+	}
+	return n
+}
+
+func (n *webhookNotifier) run() {
+	defer n.wg.Done()
+
+	for notification := range n.queue {
+		n.deliver(notification)
+	}
+}
+
+// enqueue queues a notification, or dead-letters it if the queue is full or
+// the notifier closed.
+func (n *webhookNotifier) enqueue(notification WebhookNotification) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		n.deadLetter(notification, "", 0, 0, errors.New("manager closed before delivery"))
+		return
+	}
+	select {
+	case n.queue <- notification:
+	default:
+		n.deadLetter(notification, "", 0, 0, errors.New("webhook queue full"))
+	}
+}
+
+// close stops retries and waits for the workers, which dead-letter every
+// notification still queued or waiting to be retried.
+func (n *webhookNotifier) close() {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return
+	}
+	n.closed = true
+	close(n.stop)
+	close(n.queue)
+	n.mu.Unlock()
+
+	n.wg.Wait()
+}
+
+// deliver posts a notification to its team's webhook, if it has one, until
+// it is accepted, fails permanently or runs out of attempts.
+func (n *webhookNotifier) deliver(notification WebhookNotification) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.Timeout)
+	hook, err := n.tm.store.GetWebhook(ctx, notification.TeamID)
+	cancel()
+	if errors.Is(err, ErrWebhookNotFound) {
+		return
+	}
+	if err != nil {
+		n.deadLetter(notification, "", 0, 0, fmt.Errorf("error reading webhook: %v", err))
+		return
+	}
+
+	body, err := json.Marshal(notification)
+	if err != nil {
+		n.deadLetter(notification, hook.URL, 0, 0, fmt.Errorf("error marshaling notification: %v", err))
+		return
+	}
+
+	backoff := n.cfg.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-n.stop:
+			n.deadLetter(notification, hook.URL, attempt-1, 0, errors.New("manager closed before delivery"))
+			return
+		default:
+		}
+
+		status, err := n.post(hook, notification.NotificationID, body)
+		if err == nil {
+			return
+		}
+		if !retryableWebhookStatus(status) || attempt == n.cfg.MaxAttempts {
+			n.deadLetter(notification, hook.URL, attempt, status, err)
+			return
+		}
+
+		select {
+		case <-n.stop:
+			n.deadLetter(notification, hook.URL, attempt, status, err)
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, n.cfg.MaxBackoff)
+	}
+}
+
+// post makes one attempt to deliver body, returning the response status if
+// there was one.
+func (n *webhookNotifier) post(hook *Webhook, notificationID string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := n.tm.clock.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIDHeader, notificationID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(hook.Secret, timestamp, body))
+
+	resp, err := n.cfg.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryableWebhookStatus reports whether a failed attempt that got status,
+// zero for none, may succeed if retried. Client errors other than timeouts
+// and rate limiting won't.
+func retryableWebhookStatus(status int) bool {
+	if status >= 400 && status < 500 {
+		return status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+func (n *webhookNotifier) deadLetter(notification WebhookNotification, url string, attempts, status int, err error) {
+	n.tm.logger.Warn(
+		"webhook notification dead-lettered",
+		zap.String("notification_id", notification.NotificationID),
+		zap.String("team_id", notification.TeamID),
+		zap.Int("attempts", attempts),
+		zap.Error(err),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookDeadLetterTimeout)
+	defer cancel()
+
+	putErr := n.tm.store.PutWebhookDeadLetter(ctx, &WebhookDeadLetter{
+		Pk:           GetWebhookDeadLetterPK(notification.NotificationID),
+		TeamID:       notification.TeamID,
+		URL:          url,
+		Notification: notification,
+		Attempts:     attempts,
+		LastStatus:   status,
+		LastError:    err.Error(),
+		CreatedAtMs:  n.tm.clock.Now().UnixMilli(),
+	})
+	if putErr != nil {
+		n.tm.logger.Error(
+			"failed to record webhook dead letter",
+			zap.String("notification_id", notification.NotificationID),
+			zap.Error(putErr),
+		)
+	}
+}
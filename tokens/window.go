@@ -0,0 +1,298 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// States of an auction window.
+const (
+	AuctionWindowOpen    = "open"
+	AuctionWindowSettled = "settled"
+)
+
+// AuctionWindow is a sealed-bid auction for one user. Bids are submitted to
+// it with SubmitSealedBid until its deadline, without bidders seeing each
+// other's bids, and the auction is run over them once the deadline passes,
+// either by SettleAuctionWindow or by the settlement scheduler (see
+// WithWindowSettlement). Auction windows live in the tokens table.
+type AuctionWindow struct {
+	Pk         string      `dynamodbav:"pk" json:"pk"`
+	AuctionID  string      `dynamodbav:"auction_id" json:"auction_id"`
+	UserID     string      `dynamodbav:"user_id" json:"user_id"`
+	DeadlineMs int64       `dynamodbav:"deadline_ms" json:"deadline_ms"`
+	State      string      `dynamodbav:"state" json:"state"`
+	Bids       []WindowBid `dynamodbav:"bids" json:"bids"`
+	// Result is set once a window that had a winner is settled.
+	Result      *AuctionResult `dynamodbav:"result,omitempty" json:"result,omitempty"`
+	CreatedAtMs int64          `dynamodbav:"created_at_ms" json:"created_at_ms"`
+	SettledAtMs int64          `dynamodbav:"settled_at_ms,omitempty" json:"settled_at_ms,omitempty"`
+}
+
+// WindowBid is a bid submitted to an auction window. Pk, Sk and BidID locate
+// the BidRow it was recorded as.
+type WindowBid struct {
+	TeamID      string `dynamodbav:"team_id" json:"team_id"`
+	Priority    int64  `dynamodbav:"priority" json:"priority"`
+	BidID       string `dynamodbav:"bid_id" json:"bid_id"`
+	Pk          string `dynamodbav:"pk" json:"pk"`
+	Sk          string `dynamodbav:"sk" json:"sk"`
+	CreatedAtMs int64  `dynamodbav:"created_at_ms" json:"created_at_ms"`
+}
+
+// OpenAuctionWindow opens a sealed-bid auction for userID that takes bids
+// until deadline. Teams whose AutoBidPolicy matches the user bid on it as
+// it opens; their bids are in the returned window.
+func (tm *Manager) OpenAuctionWindow(ctx context.Context, userID string, deadline time.Time) (*AuctionWindow, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	now := tm.clock.Now()
+	if !deadline.After(now) {
+		return nil, fmt.Errorf("%w: deadline %v has passed", ErrAuctionWindowClosed, deadline)
+	}
+
+	auctionID, err := tm.newID("auction_", now)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &AuctionWindow{
+		Pk:          GetAuctionWindowPK(auctionID),
+		AuctionID:   auctionID,
+		UserID:      tm.normalizeID(userID),
+		DeadlineMs:  deadline.UnixMilli(),
+		State:       AuctionWindowOpen,
+		Bids:        []WindowBid{},
+		CreatedAtMs: now.UnixMilli(),
+	}
+
+	err = tm.store.PutAuctionWindow(ctx, w)
+	if err != nil {
+		return nil, err
+	}
+
+	tm.placeAutoBids(ctx, w)
+	return w, nil
+}
+
+// GetAuctionWindow reads an auction window, including its bids and, once
+// settled, its result.
+func (tm *Manager) GetAuctionWindow(ctx context.Context, auctionID string) (*AuctionWindow, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	return tm.store.GetAuctionWindow(ctx, auctionID)
+}
+
+// SubmitSealedBid records a team's bid in an open auction window. The bid
+// is priced and scored now for the record, and again against the team's
+// balance and reputation when the window is settled. It fails with
+// ErrAuctionWindowClosed once the deadline has passed and with
+// ErrTooManyBids once the window holds the Manager's max bids per auction.
+func (tm *Manager) SubmitSealedBid(ctx context.Context, auctionID, teamID string, priority int64) (*BidRow, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	w, err := tm.store.GetAuctionWindow(ctx, auctionID)
+	if err != nil {
+		return nil, err
+	}
+	if w.State != AuctionWindowOpen || w.DeadlineMs <= tm.clock.Now().UnixMilli() {
+		return nil, fmt.Errorf("%w: %s", ErrAuctionWindowClosed, auctionID)
+	}
+
+	return tm.addWindowBid(ctx, w, Bid{TeamID: tm.normalizeID(teamID), UserID: w.UserID, Priority: priority})
+}
+
+// addWindowBid records bid and adds it to w, in the store and in w.Bids.
+func (tm *Manager) addWindowBid(ctx context.Context, w *AuctionWindow, bid Bid) (*BidRow, error) {
+	if err := tm.validateBid(&bid); err != nil {
+		return nil, err
+	}
+	if tm.bidValidation.Duplicates == DuplicateBidsReject &&
+		slices.ContainsFunc(w.Bids, func(wb WindowBid) bool { return wb.TeamID == bid.TeamID }) {
+		return nil, fmt.Errorf("%w: team %s already bid in window %s", ErrInvalidBid, bid.TeamID, w.AuctionID)
+	}
+
+	c, err := tm.scoreBid(ctx, bid, AuctionConfig{})
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := tm.RecordBid(ctx, &bid, c.breakdown, c.score)
+	if err != nil {
+		return nil, err
+	}
+
+	wb := WindowBid{
+		TeamID:      bid.TeamID,
+		Priority:    bid.Priority,
+		BidID:       row.BidID,
+		Pk:          row.Pk,
+		Sk:          row.Sk,
+		CreatedAtMs: row.CreatedAtMs,
+	}
+	err = tm.store.AddWindowBid(ctx, w.AuctionID, wb, tm.clock.Now().UnixMilli(), tm.maxBidsPerAuction)
+	if err != nil {
+		// the bid was recorded but will never be settled
+		c.row = row
+		tm.abortBids(ctx, []*candidate{c})
+
+		if errors.Is(err, ErrConditionFailed) {
+			return nil, tm.windowBidFailure(ctx, w.AuctionID)
+		}
+		return nil, err
+	}
+
+	w.Bids = append(w.Bids, wb)
+	return row, nil
+}
+
+// windowBidFailure explains why a bid couldn't be added to an auction
+// window: it closed, or it is full.
+func (tm *Manager) windowBidFailure(ctx context.Context, auctionID string) error {
+	w, err := tm.store.GetAuctionWindow(ctx, auctionID)
+	if err != nil {
+		return err
+	}
+	if w.State == AuctionWindowOpen && w.DeadlineMs > tm.clock.Now().UnixMilli() {
+		return fmt.Errorf("%w: auction window %s has %d bids", ErrTooManyBids, auctionID, len(w.Bids))
+	}
+	return fmt.Errorf("%w: %s", ErrAuctionWindowClosed, auctionID)
+}
+
+// SettleAuctionWindow closes an auction window whose deadline has passed
+// and runs its auction, returning the winner. Settling a window that was
+// already settled returns its result again, or ErrNoWinner; one whose
+// deadline hasn't passed fails with ErrAuctionWindowOpen.
+//
+// The auction is run with the window as its idempotency key, so a window is
+// charged at most once even if settlement is retried or runs on several
+// instances at once.
+func (tm *Manager) SettleAuctionWindow(ctx context.Context, auctionID string) (*AuctionResult, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	w, err := tm.store.GetAuctionWindow(ctx, auctionID)
+	if err != nil {
+		return nil, err
+	}
+	return tm.settleWindow(ctx, w)
+}
+
+func (tm *Manager) settleWindow(ctx context.Context, w *AuctionWindow) (*AuctionResult, error) {
+	if w.State == AuctionWindowSettled {
+		if w.Result == nil {
+			return nil, ErrNoWinner
+		}
+		return w.Result, nil
+	}
+
+	now := tm.clock.Now().UnixMilli()
+	if w.DeadlineMs > now {
+		return nil, fmt.Errorf("%w: %s closes at %d", ErrAuctionWindowOpen, w.AuctionID, w.DeadlineMs)
+	}
+
+	bids := make([]Bid, len(w.Bids))
+	rows := make([]*BidRow, len(w.Bids))
+	for i, wb := range w.Bids {
+		bids[i] = Bid{TeamID: wb.TeamID, UserID: w.UserID, Priority: wb.Priority}
+		expiresAt := tm.bidExpiresAt(wb.CreatedAtMs)
+		rows[i] = &BidRow{
+			Pk:           wb.Pk,
+			Sk:           wb.Sk,
+			BidID:        wb.BidID,
+			Target:       w.UserID,
+			Priority:     wb.Priority,
+			CreatedAtMs:  wb.CreatedAtMs,
+			UpdatedAtMs:  now,
+			ExpiresAt:    expiresAt,
+			ExpiryBucket: bidExpiryBucket(wb.BidID, expiresAt),
+		}
+	}
+
+	var result *AuctionResult
+	results, err := tm.runAuction(ctx, bids, rows, AuctionConfig{IdempotencyKey: w.Pk})
+	switch {
+	case err == nil:
+		result = results[0]
+	case !errors.Is(err, ErrNoWinner):
+		// the window stays open for the next attempt
+		return nil, err
+	}
+
+	err = tm.store.SettleAuctionWindow(ctx, w.AuctionID, result, tm.clock.Now().UnixMilli())
+	if err != nil && !errors.Is(err, ErrConditionFailed) {
+		return nil, err
+	}
+	// a failed condition means a concurrent settlement got there first with
+	// the same idempotent result
+
+	if result == nil {
+		return nil, ErrNoWinner
+	}
+	return result, nil
+}
+
+// SettleDueAuctionWindows settles every open auction window whose deadline
+// has passed and returns how many were settled. Windows that fail to settle
+// are logged and left open for the next run. The settlement scheduler calls
+// it every interval given to WithWindowSettlement.
+func (tm *Manager) SettleDueAuctionWindows(ctx context.Context) (int, error) {
+	ctx, cancel := tm.withBase(ctx)
+	defer cancel()
+
+	windows, err := tm.store.DueAuctionWindows(ctx, tm.clock.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	settled := 0
+	for i := range windows {
+		_, err := tm.settleWindow(ctx, &windows[i])
+		if err != nil && !errors.Is(err, ErrNoWinner) {
+			if ctx.Err() != nil {
+				return settled, ctx.Err()
+			}
+			tm.logger.Warn(
+				"failed to settle auction window",
+				zap.String("auction_id", windows[i].AuctionID),
+				zap.Error(err),
+			)
+			continue
+		}
+		settled++
+	}
+	return settled, nil
+}
+
+// runWindowSettlement calls SettleDueAuctionWindows every interval until
+// the Manager is closed, then closes done.
+func (tm *Manager) runWindowSettlement(interval time.Duration, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tm.baseCtx.Done():
+			return
+		case <-ticker.C:
+			n, err := tm.SettleDueAuctionWindows(tm.baseCtx)
+			if err != nil && tm.baseCtx.Err() == nil {
+				tm.logger.Warn("failed to settle auction windows", zap.Error(err))
+				continue
+			}
+			if n > 0 {
+				tm.logger.Debug("settled auction windows", zap.Int("windows", n))
+			}
+		}
+	}
+}